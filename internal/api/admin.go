@@ -0,0 +1,398 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/secret"
+	"matchmaking_project/internal/store"
+	"matchmaking_project/internal/tracing"
+)
+
+// adminSecretHeader は管理用エンドポイントの共有シークレットを渡すヘッダーです。
+const adminSecretHeader = "X-Admin-Secret"
+
+// adminMiddleware は共有シークレット、または scope に admin を含むトークンを検証するミドルウェアです。どちらもない場合は 401 を返します。
+// 監査イベントに記録するため、リクエストの主体（adminActor）を context に格納します。
+func (s *Server) adminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor, ok := s.authenticateAdmin(r.Header)
+		if !ok {
+			writeJSONError(w, http.StatusUnauthorized, errCodeUnauthorized, "Missing or invalid admin secret")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withAuditActor(r.Context(), actor)))
+	})
+}
+
+// authenticateAdmin は共有シークレット、または scope に admin を含むトークンを検証し、監査イベントに記録する主体（adminActor）を返します。
+// どちらもない場合は false を返します。
+func (s *Server) authenticateAdmin(h http.Header) (string, bool) {
+	given := h.Get(adminSecretHeader)
+	var subject string
+	if s.cfg.AdminSecret == "" || given == "" || !secret.SecretEqual(s.cfg.AdminSecret, given) {
+		sub, ok := s.adminTokenSubject(h)
+		if !ok {
+			return "", false
+		}
+		subject = sub
+	}
+	return s.adminActor(h, subject), true
+}
+
+// adminQueuedPlayer は GET /admin/queue で返す待機中のプレイヤーと、結果を待っているリクエストの有無です。
+type adminQueuedPlayer struct {
+	store.QueuedPlayer
+	// HasWaitingClient はマッチング結果を待っているリクエスト（long-poll または SSE）があるかどうかです。
+	HasWaitingClient bool `json:"has_waiting_client"`
+}
+
+// adminQueueHandler は待機キューの全プレイヤーを DB から取得して返します。
+func (s *Server) adminQueueHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.Store.ListQueuedPlayers(r.Context())
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "待機キュー取得エラー", "func", "adminQueueHandler", "error", err)
+		metrics.HandlerErrors.WithLabelValues("admin").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to list queue")
+		return
+	}
+	// パーティのメンバーは同じキーで待機しているため、キーごとに1回だけ確認する
+	waiting := make(map[string]bool)
+	players := make([]adminQueuedPlayer, len(rows))
+	for i, row := range rows {
+		key := store.ParticipantEntryKey(model.Participant{Player: model.Player{ID: row.ID}, PartyID: row.PartyID})
+		ok, checked := waiting[key]
+		if !checked {
+			if ok, err = s.notifier.Subscribed(r.Context(), key); err != nil {
+				s.logger.ErrorContext(r.Context(), "購読確認エラー", "func", "adminQueueHandler", "entry", key, "error", err)
+				metrics.HandlerErrors.WithLabelValues("admin").Inc()
+				writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to list queue")
+				return
+			}
+			waiting[key] = ok
+		}
+		players[i] = adminQueuedPlayer{QueuedPlayer: row, HasWaitingClient: ok}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"players": players}); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "adminQueueHandler", "error", err)
+	}
+}
+
+// setRatingRequest は PUT /players/{id}/rating のリクエストボディです。
+type setRatingRequest struct {
+	// Rating は必須です（省略と 0 を区別するためポインタにする）。
+	Rating *int `json:"rating"`
+}
+
+// setPlayerRatingHandler はプレイヤーのレーティングを更新し、更新後のプレイヤー情報を返します。
+// 存在しないプレイヤーであれば作成して 201 を返します。待機中のエントリのレーティングは次回のマッチングから反映されます。
+func (s *Server) setPlayerRatingHandler(w http.ResponseWriter, r *http.Request) {
+	var req setRatingRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+	if req.Rating == nil {
+		writeQueueEntryError(w, &model.FieldError{Field: "rating", Message: "rating is required"})
+		return
+	}
+	p := model.Player{ID: r.PathValue("id"), Rating: *req.Rating}
+	if err := p.Validate(s.cfg.RatingSeeds); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+
+	profile, created, err := s.Store.SetPlayerRating(r.Context(), p.ID, p.Rating)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "レーティング更新エラー", "func", "setPlayerRatingHandler", "player_id", p.ID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("admin").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update rating")
+		return
+	}
+	s.logger.InfoContext(r.Context(), "player rating updated by admin", "player_id", p.ID, "rating", p.Rating, "created", created)
+	s.leaderboard.invalidate()
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	if err := json.NewEncoder(w).Encode(profile); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "setPlayerRatingHandler", "player_id", p.ID, "error", err)
+	}
+}
+
+// sessionRemovedByAdmin は管理者が待機キューから削除したことを、待機中のリクエストへ通知する際の SessionResult.Status です。
+// セッションの状態としては保存しません。
+const sessionRemovedByAdmin = "removed_by_admin"
+
+// adminDequeueHandler はプレイヤー（パーティで参加している場合はパーティ全体）を待機キューから強制的に削除し、
+// 結果を待っているリクエストへ removed_by_admin のエラーを返させます。
+// dry_run=true の場合は削除する待機中のプレイヤーと確認トークンを返し、削除にはそのトークンが必要です。
+func (s *Server) adminDequeueHandler(w http.ResponseWriter, r *http.Request) {
+	playerID := r.PathValue("player_id")
+	dryRun, err := dryRunParam(r)
+	if err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+	params := map[string]string{"player_id": playerID}
+	if dryRun {
+		pos, err := s.Store.QueuePosition(r.Context(), playerID)
+		if errors.Is(err, store.ErrNotQueued) {
+			writeJSONError(w, http.StatusNotFound, errCodeNotQueued, store.ErrNotQueued.Error())
+			return
+		}
+		if err != nil {
+			s.logger.ErrorContext(r.Context(), "待機キュー取得エラー", "func", "adminDequeueHandler", "player_id", playerID, "error", err)
+			metrics.HandlerErrors.WithLabelValues("admin").Inc()
+			writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to get queued player")
+			return
+		}
+		s.issueConfirmation(w, r, adminOpDequeue, []string{playerID}, params, pos.Player)
+		return
+	}
+	if !s.confirmAdminAction(w, r, adminOpDequeue, []string{playerID}, params) {
+		return
+	}
+	err = s.removeFromQueue(r.Context(), playerID)
+	if errors.Is(err, store.ErrNotQueued) {
+		writeJSONError(w, http.StatusNotFound, errCodeNotQueued, store.ErrNotQueued.Error())
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "待機キュー削除エラー", "func", "adminDequeueHandler", "player_id", playerID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("admin").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to remove player")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeFromQueue はプレイヤー（パーティの場合はパーティ全体）を待機キューから削除し、結果を待っているリクエストへ削除を通知します。
+// 待機キューにいない場合は ErrNotQueued を返します。
+func (s *Server) removeFromQueue(ctx context.Context, playerID string) error {
+	removed, err := s.dequeueAndNotify(ctx, playerID, sessionRemovedByAdmin)
+	if err != nil {
+		return err
+	}
+	s.logger.InfoContext(ctx, "player removed from queue by admin", "player_id", playerID, "mode", removed.GameMode)
+	s.auditPlayer(ctx, auditActorSystem, auditRemovedByAdmin, playerID, dequeuedDetails(removed))
+	return nil
+}
+
+// dequeueAndNotify はプレイヤー（パーティの場合はパーティ全体）を待機キューから削除し、結果を待っているリクエストへ status の SessionResult で通知します。
+// 待機キューにいない場合は ErrNotQueued を返します。
+func (s *Server) dequeueAndNotify(ctx context.Context, playerID, status string) (store.QueuedPlayer, error) {
+	pos, err := s.Store.QueuePosition(ctx, playerID)
+	if err != nil {
+		return store.QueuedPlayer{}, err
+	}
+	if err := s.Store.DequeuePlayer(ctx, playerID); err != nil {
+		return store.QueuedPlayer{}, err
+	}
+
+	key := store.ParticipantEntryKey(model.Participant{Player: model.Player{ID: playerID}, PartyID: pos.Player.PartyID})
+	if err := s.notifier.Publish(key, model.SessionResult{Status: status}); err != nil {
+		s.logger.ErrorContext(ctx, "削除通知エラー", "func", "dequeueAndNotify", "entry", key, "status", status, "error", err)
+	}
+	return pos.Player, nil
+}
+
+// dequeuedDetails は待機キューから削除したプレイヤーの監査イベントの詳細です。
+func dequeuedDetails(p store.QueuedPlayer) map[string]interface{} {
+	details := map[string]interface{}{"game_mode": p.GameMode}
+	if p.PartyID != "" {
+		details["party_id"] = p.PartyID
+	}
+	return details
+}
+
+// writeRemovedByAdmin は管理者に待機キューから削除されたリクエストへ 409 を返します。
+func writeRemovedByAdmin(w http.ResponseWriter) {
+	writeJSONError(w, http.StatusConflict, errCodeRemovedByAdmin, "Removed from the matchmaking queue by an administrator")
+}
+
+// adminMatchRequest は POST /admin/match のリクエストボディです。
+type adminMatchRequest struct {
+	PlayerIDs []string `json:"player_ids"`
+}
+
+// errMatcherBusy は別のインスタンスがマッチングを実行中で、待機キューを確認できなかったことを表します。
+var errMatcherBusy = errors.New("another instance is running the matchmaker; retry")
+
+// errAllocationFailed はセッションのゲームサーバを割り当てられず、プレイヤーを待機キューに残したことを表します。
+var errAllocationFailed = errors.New("failed to allocate a game server; players remain queued")
+
+// adminMatchHandler は待機中の2人のプレイヤーを、レーティングや地域の条件に関係なくただちにマッチングさせます。
+// セッションの作成と通知はマッチングプロセッサーと同じ処理で行うため、参加者には通常どおり承諾待ちのセッションが届きます。
+// dry_run=true の場合はマッチングさせる待機中のプレイヤーと確認トークンを返し、マッチングにはそのトークンが必要です。
+func (s *Server) adminMatchHandler(w http.ResponseWriter, r *http.Request) {
+	var req adminMatchRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, errCodeInvalidRequest, "Invalid request: "+err.Error())
+		return
+	}
+	if len(req.PlayerIDs) != 2 || req.PlayerIDs[0] == req.PlayerIDs[1] {
+		writeJSONError(w, http.StatusBadRequest, errCodeInvalidRequest, "Invalid request: player_ids must contain two different player ids")
+		return
+	}
+	dryRun, err := dryRunParam(r)
+	if err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+	if dryRun {
+		players := make([]store.QueuedPlayer, len(req.PlayerIDs))
+		for i, id := range req.PlayerIDs {
+			pos, err := s.Store.QueuePosition(r.Context(), id)
+			if errors.Is(err, store.ErrNotQueued) {
+				writeJSONError(w, http.StatusNotFound, errCodeNotQueued, fmt.Sprintf("%v: %s", store.ErrNotQueued, id))
+				return
+			}
+			if err != nil {
+				s.logger.ErrorContext(r.Context(), "待機キュー取得エラー", "func", "adminMatchHandler", "player_id", id, "error", err)
+				metrics.HandlerErrors.WithLabelValues("admin").Inc()
+				writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to get queued players")
+				return
+			}
+			players[i] = pos.Player
+		}
+		s.issueConfirmation(w, r, adminOpForceMatch, req.PlayerIDs, req, map[string]interface{}{"players": players})
+		return
+	}
+	if !s.confirmAdminAction(w, r, adminOpForceMatch, req.PlayerIDs, req) {
+		return
+	}
+
+	now := s.now()
+	var l queue.Lobby
+	var allocated []model.SessionResult
+	planErr := errMatcherBusy
+	sessions, err := s.Store.CreateSessions(r.Context(), func(entries []model.QueueEntry, _, _ model.OpponentSet) []model.SessionResult {
+		l, planErr = s.forcedLobby(entries, req.PlayerIDs[0], req.PlayerIDs[1])
+		if planErr != nil {
+			return nil
+		}
+		allocated = []model.SessionResult{s.createSession(l, now)}
+		if ok := s.allocateGameServers(r.Context(), allocated); !ok[0] {
+			planErr = errAllocationFailed
+			allocated = nil
+			return nil
+		}
+		return allocated
+	})
+	if err != nil {
+		s.releaseGameServers(allocated)
+	}
+	if err == nil {
+		err = planErr
+	}
+	var fe *model.FieldError
+	switch {
+	case errors.Is(err, store.ErrNotQueued):
+		writeJSONError(w, http.StatusNotFound, errCodeNotQueued, err.Error())
+		return
+	case errors.As(err, &fe):
+		writeErrorResponse(w, http.StatusConflict, ErrorDetail{Code: errCodeCannotMatch, Message: fe.Message, Details: map[string]interface{}{"field": fe.Field}})
+		return
+	case errors.Is(err, errMatcherBusy):
+		writeJSONError(w, http.StatusServiceUnavailable, errCodeMatcherBusy, err.Error())
+		return
+	case errors.Is(err, errAllocationFailed):
+		writeJSONError(w, http.StatusServiceUnavailable, errCodeAllocationFailed, err.Error())
+		return
+	case err != nil:
+		s.logger.ErrorContext(r.Context(), "強制マッチングエラー", "func", "adminMatchHandler", "player_ids", req.PlayerIDs, "error", err)
+		metrics.HandlerErrors.WithLabelValues("admin").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to create session")
+		return
+	}
+
+	s.logger.InfoContext(r.Context(), "players matched by admin", "session_id", sessions[0].SessionID, "player_ids", req.PlayerIDs)
+	s.announceLobbies([]queue.Lobby{l}, sessions, now)
+	tracing.TraceMatchedLobbies(r.Context(), []queue.Lobby{l}, sessions, now)
+	s.auditSessions(r.Context(), auditActorSystem, auditForceMatched, sessions, nil, nil)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(versionedSession(r.Context(), sessions[0])); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "adminMatchHandler", "error", err)
+	}
+}
+
+// forcedLobby は2人のプレイヤーのエントリ（パーティの場合はパーティ全体）を別々のチームに割り当てたロビーを返します。
+// レーティング・地域・最近の対戦相手の条件は確認しませんが、同じ2チーム制のゲームモードで待機している必要があります。
+func (s *Server) forcedLobby(entries []model.QueueEntry, id1, id2 string) (queue.Lobby, error) {
+	find := func(id string) (int, error) {
+		for i, e := range entries {
+			for _, p := range e.Players {
+				if p.ID == id {
+					return i, nil
+				}
+			}
+		}
+		return 0, fmt.Errorf("%w: %s", store.ErrNotQueued, id)
+	}
+	i1, err := find(id1)
+	if err != nil {
+		return queue.Lobby{}, err
+	}
+	i2, err := find(id2)
+	if err != nil {
+		return queue.Lobby{}, err
+	}
+	e1, e2 := entries[i1], entries[i2]
+	switch {
+	case i1 == i2:
+		return queue.Lobby{}, &model.FieldError{Field: "player_ids", Message: fmt.Sprintf("players are in the same party %q", e1.PartyID)}
+	case e1.GameMode != e2.GameMode:
+		return queue.Lobby{}, &model.FieldError{Field: "player_ids", Message: fmt.Sprintf("players are waiting in different game modes (%q, %q)", e1.GameMode, e2.GameMode)}
+	case s.cfg.Queue.GameModes[e1.GameMode].TeamCount() != 2:
+		return queue.Lobby{}, &model.FieldError{Field: "player_ids", Message: fmt.Sprintf("game mode %q does not have two teams", e1.GameMode)}
+	}
+	return queue.Lobby{GameMode: e1.GameMode, Teams: [][]model.QueueEntry{{e1}, {e2}}}, nil
+}
+
+// AdminRoutes は管理用エンドポイント（/admin/... と PUT /players/{id}/rating、ゲームサーバ向けの POST /sessions/{id}/noshow・POST /sessions/{id}/result、観戦者の /sessions/{id}/spectators）のルーティングを組み立てます。すべて共有シークレットで保護します。
+// ADMIN_ADDR の設定により、API と同じポート・別のポートのいずれかで公開するか、公開しません。
+func (s *Server) AdminRoutes() http.Handler {
+	mux := http.NewServeMux()
+	admin := func(h http.HandlerFunc) http.Handler {
+		return s.adminMiddleware(h)
+	}
+	mux.Handle("GET /admin/queue", admin(s.adminQueueHandler))
+	mux.Handle("DELETE /admin/queue/{player_id}", admin(s.adminDequeueHandler))
+	mux.Handle("POST /admin/match", admin(s.adminMatchHandler))
+	mux.Handle("PUT /admin/bans/{player_id}", admin(s.banPlayerHandler))
+	mux.Handle("POST /admin/bans", admin(s.banPlayerHandler))
+	mux.Handle("DELETE /admin/bans/{player_id}", admin(s.unbanPlayerHandler))
+	mux.Handle("GET /admin/flags", admin(s.listFeatureFlagsHandler))
+	mux.Handle("PUT /admin/flags/{name}", admin(s.setFeatureFlagHandler))
+	mux.Handle("GET /admin/diagnostics/queries", admin(s.adminQueryDiagnosticsHandler))
+	mux.Handle("GET /admin/stats/match-quality", admin(s.adminMatchQualityStatsHandler))
+	mux.Handle("GET /admin/stats/waits", admin(s.adminWaitStatsHandler))
+	mux.Handle("GET /admin/audit", admin(s.adminAuditHandler))
+	mux.Handle("PUT /players/{id}/rating", admin(s.setPlayerRatingHandler))
+	mux.Handle("POST /sessions/{id}/noshow", admin(s.noShowHandler))
+	mux.Handle("POST /sessions/{id}/result", admin(s.sessionResultHandler))
+	mux.Handle("POST /sessions/{id}/spectators", admin(s.addSpectatorHandler))
+	mux.Handle("DELETE /sessions/{id}/spectators/{player_id}", admin(s.removeSpectatorHandler))
+	return jsonRouteErrors(mux)
+}
+
+// AdminHandler は管理用エンドポイントを別のポート（ADMIN_ADDR）で公開する場合のハンドラです。
+// API のポートと同じく、リクエストID・パニックからの復帰・BASE_PATH・トレースを適用します。
+func (s *Server) AdminHandler() http.Handler {
+	return RequestIDMiddleware(RecoverMiddleware(s.BasePathMiddleware(apiVersionMiddleware(TracingMiddleware(s.AdminRoutes())))))
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+func TestAdminQueueRequiresSecret(t *testing.T) {
+	ts := newTestServer(t, nil)
+	wrong := make(http.Header)
+	wrong.Set(adminSecretHeader, "not-the-secret")
+	for name, header := range map[string]http.Header{"missing": nil, "wrong": wrong} {
+		rec := serve(t, ts.AdminHandler(), "GET", "/admin/queue", nil, header)
+		if rec.Code != http.StatusUnauthorized || errorCode(t, rec) != errCodeUnauthorized {
+			t.Fatalf("%s secret: status %d, want 401: %s", name, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestAdminQueueLists(t *testing.T) {
+	ts := newTestServer(t, nil)
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice", "region": "asia", "game_mode": "ranked"})
+	ts.waitQueued(t, 1)
+	ts.clock.Advance(5 * time.Second)
+
+	rec := serve(t, ts.AdminHandler(), "GET", "/admin/queue", nil, adminHeader())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Players []map[string]interface{} `json:"players"`
+	}
+	decodeJSON(t, rec, &resp)
+	if len(resp.Players) != 1 {
+		t.Fatalf("players = %v, want alice", resp.Players)
+	}
+	got := resp.Players[0]
+	want := map[string]interface{}{
+		"id":                 "alice",
+		"rating":             float64(ts.cfg.RatingSeeds.Default),
+		"game_mode":          "ranked",
+		"region":             "asia",
+		"waiting_since":      testEpoch.Format(time.RFC3339),
+		"has_waiting_client": true,
+	}
+	for key, v := range want {
+		if got[key] != v {
+			t.Errorf("%s = %v, want %v", key, got[key], v)
+		}
+	}
+
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob", "region": "asia", "game_mode": "ranked"})
+	ts.waitQueued(t, 2)
+	ts.clock.Advance(10 * time.Second)
+	ts.tick(t)
+	receive(t, alice)
+	receive(t, bob)
+
+	// マッチングした後は待機キューに含めない
+	rec = serve(t, ts.AdminHandler(), "GET", "/admin/queue", nil, adminHeader())
+	decodeJSON(t, rec, &resp)
+	if len(resp.Players) != 0 {
+		t.Fatalf("players after the match = %v, want none", resp.Players)
+	}
+}
+
+func TestSetPlayerRating(t *testing.T) {
+	ts := newTestServer(t, nil)
+	put := func(id string, body interface{}, header http.Header) *httptest.ResponseRecorder {
+		return serve(t, ts.AdminHandler(), "PUT", "/players/"+id+"/rating", body, header)
+	}
+	if rec := put("alice", map[string]int{"rating": 1800}, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without admin secret: status %d, want 401", rec.Code)
+	}
+
+	// 存在しないプレイヤーは作成して 201 を返す
+	rec := put("alice", map[string]int{"rating": 1800}, adminHeader())
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", rec.Code, rec.Body)
+	}
+	var profile model.PlayerProfile
+	decodeJSON(t, rec, &profile)
+	if profile.ID != "alice" || profile.Rating != 1800 {
+		t.Fatalf("created = %+v, want alice at 1800", profile)
+	}
+
+	// 既存のプレイヤーは更新して 200 を返す（対戦数などは変えない）
+	rec = put("alice", map[string]int{"rating": 1200}, adminHeader())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: status %d: %s", rec.Code, rec.Body)
+	}
+	decodeJSON(t, rec, &profile)
+	if profile.Rating != 1200 {
+		t.Fatalf("updated = %+v, want 1200", profile)
+	}
+	stored, err := ts.store.GetPlayerProfile(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Rating != 1200 || !stored.CreatedAt.Equal(profile.CreatedAt) {
+		t.Fatalf("stored = %+v, want the updated rating and the original created_at %v", stored, profile.CreatedAt)
+	}
+
+	for _, tc := range []struct {
+		name, id string
+		body     interface{}
+		field    string
+	}{
+		{"missing rating", "alice", map[string]int{}, "rating"},
+		{"negative rating", "alice", map[string]int{"rating": -1}, "rating"},
+		{"rating above the maximum", "alice", map[string]int{"rating": 5001}, "rating"},
+		{"unknown field", "alice", map[string]int{"rating": 1500, "games_played": 3}, "games_played"},
+		{"invalid id", "al:ice", map[string]int{"rating": 1500}, "id"},
+	} {
+		rec := put(tc.id, tc.body, adminHeader())
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400: %s", tc.name, rec.Code, rec.Body)
+			continue
+		}
+		var resp ErrorResponse
+		decodeJSON(t, rec, &resp)
+		if resp.Error.Details["field"] != tc.field {
+			t.Errorf("%s: error = %+v, want field %s", tc.name, resp.Error, tc.field)
+		}
+	}
+	if got, _ := ts.store.GetPlayerProfile(context.Background(), "alice"); got.Rating != 1200 {
+		t.Errorf("rating = %d after rejected updates, want 1200", got.Rating)
+	}
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+)
+
+// SessionAllocator はマッチングの成立時にセッションのゲームサーバを割り当てる仕組みです（ゲームモードの allocator_url または環境変数 SESSION_ALLOCATOR_URL）。
+// Allocate はセッションを保存する前に待機キューをロックしたまま SessionAllocatorTimeout の期限付きで呼び出すため、すぐに応答してください。
+// 割り当てに失敗したロビーは作成せず、エントリは元の待機開始時刻のまま待機キューに残ります。
+// Release は割り当てたもののセッションを保存できなかった（トランザクションが失敗した）場合に呼び出します。
+type SessionAllocator interface {
+	// Allocate はセッションのゲームサーバを割り当てます。nil を返した場合は割り当てなし（SessionResult.GameServer を省略）です。
+	Allocate(ctx context.Context, session model.SessionResult) (*model.GameServer, error)
+	// Release は Allocate で割り当てたゲームサーバを解放します。
+	Release(ctx context.Context, session model.SessionResult) error
+}
+
+// noopAllocator はゲームサーバを割り当てない SessionAllocator です（既定）。
+type noopAllocator struct{}
+
+// Allocate は何もせずに nil を返します。
+func (noopAllocator) Allocate(context.Context, model.SessionResult) (*model.GameServer, error) {
+	return nil, nil
+}
+
+// Release は何もしません。
+func (noopAllocator) Release(context.Context, model.SessionResult) error { return nil }
+
+// httpAllocatorRequest は HTTP のアロケーターへ送信する割り当ての依頼です。
+type httpAllocatorRequest struct {
+	SessionID    string                `json:"session_id"`
+	GameMode     string                `json:"game_mode"`
+	Region       string                `json:"region,omitempty"`
+	Participants []httpAllocatorPlayer `json:"participants"`
+}
+
+// httpAllocatorPlayer は割り当ての依頼に含める参加者です。
+type httpAllocatorPlayer struct {
+	ID    string `json:"id"`
+	Team  int    `json:"team"`
+	IsBot bool   `json:"is_bot,omitempty"`
+}
+
+// httpAllocator はゲームサーバの割り当てを HTTP で依頼する SessionAllocator です。
+// 割り当ては URL へ httpAllocatorRequest を POST し、200 または 201 の {"host": ..., "port": ...} を受け取ります。
+// 解放は URL/{session_id} へ DELETE します（404 は解放済みとして扱います）。
+type httpAllocator struct {
+	url    string
+	client *http.Client
+}
+
+// newHTTPAllocator は rawURL へ割り当てを依頼する httpAllocator を生成します。
+func newHTTPAllocator(rawURL string) (*httpAllocator, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("アロケーターの URL が不正です: %q", rawURL)
+	}
+	return &httpAllocator{url: rawURL, client: &http.Client{}}, nil
+}
+
+// Allocate はセッションのゲームサーバの割り当てを依頼します。
+func (a *httpAllocator) Allocate(ctx context.Context, session model.SessionResult) (*model.GameServer, error) {
+	body := httpAllocatorRequest{SessionID: session.SessionID, GameMode: session.GameMode, Region: session.Region}
+	for _, p := range session.Participants {
+		body.Participants = append(body.Participants, httpAllocatorPlayer{ID: p.ID, Team: p.Team, IsBot: p.IsBot})
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ゲームサーバ割り当てエラー: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		return nil, fmt.Errorf("ゲームサーバ割り当てエラー: status %d", resp.StatusCode)
+	}
+	var server model.GameServer
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&server); err != nil {
+		return nil, fmt.Errorf("ゲームサーバ割り当て応答解析エラー: %v", err)
+	}
+	if server.Host == "" || server.Port < 1 || server.Port > 65535 {
+		return nil, fmt.Errorf("ゲームサーバ割り当て応答が不正です: host=%q port=%d", server.Host, server.Port)
+	}
+	return &server, nil
+}
+
+// Release はセッションのゲームサーバの解放を依頼します。
+func (a *httpAllocator) Release(ctx context.Context, session model.SessionResult) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, a.url+"/"+url.PathEscape(session.SessionID), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ゲームサーバ解放エラー: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("ゲームサーバ解放エラー: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// modeAllocator はゲームモードごとに SessionAllocator を切り替えます。設定のないモードには fallback を使います。
+type modeAllocator struct {
+	modes    map[string]SessionAllocator
+	fallback SessionAllocator
+}
+
+// NewModeAllocator はゲームモード modes の allocator_url と、それ以外のモードに使う defaultURL（空の場合は割り当てない）から SessionAllocator を生成します。
+// どのモードにも設定がない場合は noopAllocator を返します。
+func NewModeAllocator(defaultURL string, modes queue.Modes) (SessionAllocator, error) {
+	m := &modeAllocator{modes: make(map[string]SessionAllocator), fallback: noopAllocator{}}
+	if defaultURL != "" {
+		a, err := newHTTPAllocator(defaultURL)
+		if err != nil {
+			return nil, err
+		}
+		m.fallback = a
+	}
+	for name, mode := range modes {
+		if mode.AllocatorURL == "" {
+			continue
+		}
+		a, err := newHTTPAllocator(mode.AllocatorURL)
+		if err != nil {
+			return nil, fmt.Errorf("game mode %q: %v", name, err)
+		}
+		m.modes[name] = a
+	}
+	if _, noop := m.fallback.(noopAllocator); noop && len(m.modes) == 0 {
+		return noopAllocator{}, nil
+	}
+	return m, nil
+}
+
+// forMode はゲームモードの SessionAllocator を返します。
+func (m *modeAllocator) forMode(mode string) SessionAllocator {
+	if a, ok := m.modes[mode]; ok {
+		return a
+	}
+	return m.fallback
+}
+
+// Allocate はセッションのゲームモードの SessionAllocator で割り当てます。
+func (m *modeAllocator) Allocate(ctx context.Context, session model.SessionResult) (*model.GameServer, error) {
+	return m.forMode(session.GameMode).Allocate(ctx, session)
+}
+
+// Release はセッションのゲームモードの SessionAllocator で解放します。
+func (m *modeAllocator) Release(ctx context.Context, session model.SessionResult) error {
+	return m.forMode(session.GameMode).Release(ctx, session)
+}
+
+// allocateGameServers は sessions のゲームサーバを並行して割り当て、割り当てたセッションの GameServer を設定します。
+// 戻り値の ok[i] は sessions[i] の割り当てに成功したかどうかです。失敗したセッションは作成せず、エントリを待機キューに残してください。
+func (s *Server) allocateGameServers(ctx context.Context, sessions []model.SessionResult) []bool {
+	ok := make([]bool, len(sessions))
+	var wg sync.WaitGroup
+	for i := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			actx, cancel := context.WithTimeout(ctx, s.cfg.SessionAllocatorTimeout)
+			defer cancel()
+			start := time.Now()
+			server, err := s.Allocator.Allocate(actx, sessions[i])
+			metrics.AllocationSeconds.Observe(time.Since(start).Seconds())
+			if err != nil {
+				metrics.SessionAllocations.WithLabelValues(sessions[i].GameMode, "failed").Inc()
+				s.logger.Error("ゲームサーバ割り当てエラー。エントリを待機キューに残します", "func", "allocateGameServers", "session_id", sessions[i].SessionID, "mode", sessions[i].GameMode, "error", err)
+				return
+			}
+			sessions[i].GameServer = server
+			ok[i] = true
+			if server != nil {
+				metrics.SessionAllocations.WithLabelValues(sessions[i].GameMode, "allocated").Inc()
+			}
+		}()
+	}
+	wg.Wait()
+	return ok
+}
+
+// releaseGameServers は保存できなかったセッションに割り当てたゲームサーバを解放します。
+func (s *Server) releaseGameServers(sessions []model.SessionResult) {
+	for _, session := range sessions {
+		if session.GameServer == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.SessionAllocatorTimeout)
+		err := s.Allocator.Release(ctx, session)
+		cancel()
+		if err != nil {
+			s.logger.Error("ゲームサーバ解放エラー", "func", "releaseGameServers", "session_id", session.SessionID, "error", err)
+			continue
+		}
+		metrics.SessionAllocations.WithLabelValues(session.GameMode, "released").Inc()
+	}
+}
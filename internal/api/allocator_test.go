@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+)
+
+// fakeAllocatorServer は HTTP のアロケーターの代わりに割り当ての依頼を記録し、status で応答するサーバです。
+type fakeAllocatorServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	delay    time.Duration
+	requests []httpAllocatorRequest
+	released []string
+}
+
+func newFakeAllocatorServer(t *testing.T) *fakeAllocatorServer {
+	f := &fakeAllocatorServer{status: http.StatusCreated}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		status, delay := f.status, f.delay
+		if r.Method == http.MethodDelete {
+			f.released = append(f.released, r.URL.Path)
+			f.mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		var req httpAllocatorRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		f.requests = append(f.requests, req)
+		f.mu.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(model.GameServer{Host: "game-1.example.com", Port: 7777})
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// set は以降の割り当てに status と遅延 delay で応答するようにします。
+func (f *fakeAllocatorServer) set(status int, delay time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status, f.delay = status, delay
+}
+
+// allocatorServer は割り当てを f へ依頼するサーバです。
+func allocatorServer(t *testing.T, f *fakeAllocatorServer) *testServer {
+	ts := newTestServer(t, func(cfg *Config) { cfg.SessionAllocatorTimeout = 200 * time.Millisecond })
+	allocator, err := NewModeAllocator(f.URL, queue.DefaultModes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Allocator = allocator
+	return ts
+}
+
+// 割り当てたゲームサーバをセッションに保存し、参加者に返す
+func TestAllocatorSuccess(t *testing.T) {
+	f := newFakeAllocatorServer(t)
+	ts := allocatorServer(t, f)
+	session := ts.matchPair(t, "alice", "bob")
+
+	want := model.GameServer{Host: "game-1.example.com", Port: 7777}
+	if session.GameServer == nil || *session.GameServer != want {
+		t.Fatalf("game server = %+v, want %+v", session.GameServer, want)
+	}
+	stored, err := ts.store.GetSession(context.Background(), session.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.GameServer == nil || *stored.GameServer != want {
+		t.Fatalf("stored game server = %+v, want %+v", stored.GameServer, want)
+	}
+	if len(f.requests) != 1 || f.requests[0].SessionID != session.SessionID || len(f.requests[0].Participants) != 2 {
+		t.Fatalf("allocation requests = %+v, want one for the session with both players", f.requests)
+	}
+}
+
+// 割り当てに失敗（エラー・タイムアウト）したロビーは作成せず、エントリを元の待機開始時刻のまま待機キューに残す
+func TestAllocatorFailureRollsBack(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status int
+		delay  time.Duration
+	}{
+		{"error", http.StatusServiceUnavailable, 0},
+		{"timeout", http.StatusCreated, time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFakeAllocatorServer(t)
+			ts := allocatorServer(t, f)
+			waitingSince := ts.now()
+			alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+			ts.waitQueued(t, 1)
+			bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+			ts.waitQueued(t, 2)
+
+			f.set(tc.status, tc.delay)
+			if cycle := ts.tick(t); cycle.Matched != 0 {
+				t.Fatalf("tick created %d sessions, want none after the failed allocation", cycle.Matched)
+			}
+			queued := ts.queuedPlayers(t)
+			if len(queued) != 2 {
+				t.Fatalf("queued = %+v, want alice and bob kept", queued)
+			}
+			for _, p := range queued {
+				if !p.WaitingSince.Equal(waitingSince) {
+					t.Fatalf("%s waiting since %v, want the original %v", p.ID, p.WaitingSince, waitingSince)
+				}
+			}
+
+			// 割り当てが回復すれば次のマッチングで作成する
+			f.set(http.StatusCreated, 0)
+			if cycle := ts.tick(t); cycle.Matched != 1 {
+				t.Fatalf("tick created %d sessions, want 1 after the allocator recovered", cycle.Matched)
+			}
+			for _, done := range []<-chan *httptest.ResponseRecorder{alice, bob} {
+				rec := receive(t, done)
+				var session model.SessionResult
+				decodeJSON(t, rec, &session)
+				if rec.Code != http.StatusOK || session.GameServer == nil {
+					t.Fatalf("status %d, game server %+v, want the allocated server", rec.Code, session.GameServer)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPAllocatorRelease(t *testing.T) {
+	f := newFakeAllocatorServer(t)
+	a, err := newHTTPAllocator(f.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Release(context.Background(), model.SessionResult{SessionID: "s-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.released) != 1 || f.released[0] != "/s-1" {
+		t.Fatalf("released = %v, want /s-1", f.released)
+	}
+	for _, raw := range []string{"", "ftp://example.com", "http://"} {
+		if _, err := newHTTPAllocator(raw); err == nil {
+			t.Errorf("allocator URL %q accepted", raw)
+		}
+	}
+}
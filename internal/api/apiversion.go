@@ -0,0 +1,197 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// apiVersion はクライアントが指定した API のバージョンです。
+// マッチングの結果（SessionResult）のレスポンスの形をバージョンごとに固定し、項目を追加しても古いクライアントが壊れないようにします。
+type apiVersion int
+
+const (
+	// apiVersionLatest はバージョンを指定しないリクエストです。SessionResult をそのまま（全ての項目を）返します。
+	apiVersionLatest apiVersion = 0
+	// apiVersion1 は1対1 の従来の形式です（session_id・status・accept_deadline・player1・player2 のみ）。
+	apiVersion1 apiVersion = 1
+	// apiVersion2 は参加者を players に含め、player1・player2 を返さない形式です。
+	apiVersion2 apiVersion = 2
+)
+
+// apiVendorMediaTypePrefix はバージョンを指定する Accept のメディアタイプ（application/vnd.matchmaking.v1+json など）の接頭辞です。
+const apiVendorMediaTypePrefix = "application/vnd.matchmaking.v"
+
+// apiVersionKey は context にリクエストの API のバージョンを格納するためのキーです。
+type apiVersionKey struct{}
+
+// requestAPIVersion は ctx のリクエストが指定した API のバージョンを返します。指定がない場合は apiVersionLatest です。
+func requestAPIVersion(ctx context.Context) apiVersion {
+	v, _ := ctx.Value(apiVersionKey{}).(apiVersion)
+	return v
+}
+
+// parseAPIVersion は "1"・"2" のバージョン番号を解析します。対応していないバージョンの場合は ok が false です。
+func parseAPIVersion(s string) (apiVersion, bool) {
+	n, err := strconv.Atoi(s)
+	if err != nil || (apiVersion(n) != apiVersion1 && apiVersion(n) != apiVersion2) {
+		return 0, false
+	}
+	return apiVersion(n), true
+}
+
+// acceptAPIVersion は Accept ヘッダーからバージョンを指定するメディアタイプを探し、対応している最初のバージョンを返します。
+// 指定がない場合は apiVersionLatest を返します。対応していないバージョンだけを指定した場合はエラーですが、
+// application/json（または */*）も受け付けるクライアントには apiVersionLatest を返します。
+func acceptAPIVersion(accept string) (apiVersion, error) {
+	var unsupported string
+	fallback := false
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		if mediaType == "application/json" || mediaType == "application/*" || mediaType == "*/*" {
+			fallback = true
+			continue
+		}
+		if !strings.HasPrefix(mediaType, apiVendorMediaTypePrefix) {
+			continue
+		}
+		n, ok := strings.CutSuffix(strings.TrimPrefix(mediaType, apiVendorMediaTypePrefix), "+json")
+		if v, supported := parseAPIVersion(n); ok && supported {
+			return v, nil
+		}
+		if unsupported == "" {
+			unsupported = mediaType
+		}
+	}
+	if unsupported != "" && !fallback {
+		return 0, fmt.Errorf("unsupported media type %q", unsupported)
+	}
+	return apiVersionLatest, nil
+}
+
+// apiVersionMediaType はバージョンを指定するメディアタイプ（application/vnd.matchmaking.v1+json など）を返します。
+func apiVersionMediaType(v apiVersion) string {
+	return apiVendorMediaTypePrefix + strconv.Itoa(int(v)) + "+json"
+}
+
+// vendorContentTypeWriter は Accept でバージョンを指定したリクエストへの JSON のレスポンスの Content-Type を、
+// 指定されたメディアタイプに置き換えます。
+type vendorContentTypeWriter struct {
+	http.ResponseWriter
+	mediaType   string
+	wroteHeader bool
+}
+
+func (w *vendorContentTypeWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if ct, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type")); ct == "application/json" {
+			w.Header().Set("Content-Type", w.mediaType)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *vendorContentTypeWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap は http.ResponseController が元の ResponseWriter の Flush・SetWriteDeadline を使えるようにします。
+func (w *vendorContentTypeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// apiVersionMiddleware はリクエストの API のバージョンを context に格納するミドルウェアです。
+// パスの接頭辞（/v1/...・/v2/...、取り除いて次のハンドラへ渡す）か Accept ヘッダー（application/vnd.matchmaking.v1+json など）で指定でき、
+// 両方ある場合はパスを優先します。Accept で対応していないバージョンだけを指定した場合は 406 を返し、
+// Accept で指定したバージョンで応答する場合は JSON のレスポンスの Content-Type をそのメディアタイプにします。
+func apiVersionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		version := apiVersionLatest
+		if prefix, rest, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/"); ok && strings.HasPrefix(prefix, "v") {
+			if v, supported := parseAPIVersion(strings.TrimPrefix(prefix, "v")); supported {
+				version = v
+				r2 := r.Clone(r.Context())
+				r2.URL.Path = "/" + rest
+				r2.URL.RawPath = ""
+				r = r2
+			}
+		}
+		if version == apiVersionLatest {
+			v, err := acceptAPIVersion(r.Header.Get("Accept"))
+			if err != nil {
+				writeErrorResponse(w, http.StatusNotAcceptable, ErrorDetail{
+					Code:    errCodeUnsupportedAPIVersion,
+					Message: "Unsupported API version",
+					Details: map[string]interface{}{"supported": []string{apiVersionMediaType(apiVersion1), apiVersionMediaType(apiVersion2)}},
+				})
+				return
+			}
+			if version = v; version != apiVersionLatest {
+				w = &vendorContentTypeWriter{ResponseWriter: w, mediaType: apiVersionMediaType(version)}
+			}
+		}
+		if version != apiVersionLatest {
+			w.Header().Set("X-API-Version", strconv.Itoa(int(version)))
+			r = r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sessionResultV1 は API バージョン 1 の SessionResult です。
+type sessionResultV1 struct {
+	SessionID      string     `json:"session_id"`
+	Status         string     `json:"status"`
+	AcceptDeadline *time.Time `json:"accept_deadline,omitempty"`
+	Player1        playerV1   `json:"player1"`
+	Player2        playerV1   `json:"player2"`
+}
+
+// playerV1 は API バージョン 1 のプレイヤーです。
+type playerV1 struct {
+	ID     string `json:"id"`
+	Rating int    `json:"rating"`
+}
+
+// sessionResultV2 は API バージョン 2 の SessionResult です。参加者を players で返し、player1・player2 は返しません。
+// SessionResult に追加した項目はそのまま含めます。participants・player1・player2 は、同じ名前の空の項目で埋め込んだ SessionResult の項目を隠して省略します。
+type sessionResultV2 struct {
+	model.SessionResult
+	Participants []model.Participant `json:"participants,omitempty"`
+	Player1      *model.Player       `json:"player1,omitempty"`
+	Player2      *model.Player       `json:"player2,omitempty"`
+	Players      []model.Participant `json:"players"`
+}
+
+// versionedSession はリクエストの API のバージョン（requestAPIVersion）に合わせた形の session を返します。レスポンスのエンコードに使います。
+// バージョン 1 の player1・player2 は各チームの先頭の参加者で、2チーム制でないモードのセッションでは空です。
+func versionedSession(ctx context.Context, session model.SessionResult) interface{} {
+	switch requestAPIVersion(ctx) {
+	case apiVersion1:
+		v1 := sessionResultV1{SessionID: session.SessionID, Status: session.Status, AcceptDeadline: session.AcceptDeadline}
+		if p := session.Player1; p != nil {
+			v1.Player1 = playerV1{ID: p.ID, Rating: p.Rating}
+		}
+		if p := session.Player2; p != nil {
+			v1.Player2 = playerV1{ID: p.ID, Rating: p.Rating}
+		}
+		return v1
+	case apiVersion2:
+		return sessionResultV2{SessionResult: session, Players: session.Participants}
+	}
+	return session
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// sessionFields は h にリクエストを送り、セッションのレスポンスの項目とレスポンスを返します。
+func sessionFields(t *testing.T, h http.Handler, method, path string, body interface{}, header http.Header) (map[string]json.RawMessage, *http.Response) {
+	t.Helper()
+	rec := serve(t, h, method, path, body, header)
+	if rec.Code/100 != 2 {
+		t.Fatalf("%s %s = %d: %s", method, path, rec.Code, rec.Body)
+	}
+	var fields map[string]json.RawMessage
+	decodeJSON(t, rec, &fields)
+	return fields, rec.Result()
+}
+
+func TestSessionResponseShapeByVersion(t *testing.T) {
+	ts := newTestServer(t, nil)
+	id := ts.matchPair(t, "alice", "bob").SessionID
+	accept := func(v string) http.Header { return http.Header{"Accept": {v}} }
+
+	for _, tc := range []struct {
+		name        string
+		path        string
+		header      http.Header
+		contentType string
+		want        []string
+		absent      []string
+	}{
+		{"latest", "/sessions/" + id, nil, "application/json", []string{"session_id", "participants", "player1"}, []string{"players"}},
+		{"v1 prefix", "/v1/sessions/" + id, nil, "application/json", []string{"session_id", "status", "player1", "player2"}, []string{"participants", "players", "game_mode"}},
+		{"v2 prefix", "/v2/sessions/" + id, nil, "application/json", []string{"session_id", "players", "game_mode"}, []string{"participants", "player1", "player2"}},
+		{"v1 accept", "/sessions/" + id, accept("application/vnd.matchmaking.v1+json"), "application/vnd.matchmaking.v1+json", []string{"player1", "player2"}, []string{"players"}},
+		{"v2 accept", "/sessions/" + id, accept("application/vnd.matchmaking.v2+json"), "application/vnd.matchmaking.v2+json", []string{"players"}, []string{"player1"}},
+		{"unsupported with json fallback", "/sessions/" + id, accept("application/vnd.matchmaking.v9+json, application/json;q=0.5"), "application/json", []string{"participants"}, []string{"players"}},
+		{"supported after unsupported", "/sessions/" + id, accept("application/vnd.matchmaking.v9+json, application/vnd.matchmaking.v2+json"), "application/vnd.matchmaking.v2+json", []string{"players"}, []string{"player1"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fields, res := sessionFields(t, ts.Server, "GET", tc.path, nil, tc.header)
+			if got := res.Header.Get("Content-Type"); got != tc.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tc.contentType)
+			}
+			for _, k := range tc.want {
+				if _, ok := fields[k]; !ok {
+					t.Errorf("missing %q in %v", k, keys(fields))
+				}
+			}
+			for _, k := range tc.absent {
+				if _, ok := fields[k]; ok {
+					t.Errorf("unexpected %q in %v", k, keys(fields))
+				}
+			}
+		})
+	}
+}
+
+func TestUnsupportedAPIVersionOnly(t *testing.T) {
+	ts := newTestServer(t, nil)
+	rec := ts.do(t, "GET", "/sessions/00000000-0000-4000-8000-000000000000", nil, http.Header{"Accept": {"application/vnd.matchmaking.v9+json"}})
+	if rec.Code != http.StatusNotAcceptable {
+		t.Fatalf("status = %d, want 406: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAdminHandlerNegotiatesVersion(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) { c.MountAdmin = false })
+	ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+
+	body := map[string]interface{}{"player_ids": []string{"alice", "bob"}}
+	header := confirmedHeader(t, ts.AdminHandler(), "POST", "/admin/match", body)
+	header.Set("Accept", "application/vnd.matchmaking.v1+json")
+	fields, res := sessionFields(t, ts.AdminHandler(), "POST", "/admin/match", body, header)
+	if got := res.Header.Get("Content-Type"); got != "application/vnd.matchmaking.v1+json" {
+		t.Errorf("Content-Type = %q, want the v1 media type", got)
+	}
+	if _, ok := fields["player1"]; !ok {
+		t.Errorf("admin force-match response %v is not the v1 shape", keys(fields))
+	}
+	if _, ok := fields["participants"]; ok {
+		t.Errorf("admin force-match response %v is not the v1 shape", keys(fields))
+	}
+}
+
+func keys(m map[string]json.RawMessage) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"fmt"
+
+	"matchmaking_project/internal/model"
+)
+
+// validatePartyAttributes は、パーティのメンバーが MatchAttributeKeys の属性で同じ値を指定していることを確認します。
+// 値が異なるメンバーを含むパーティはどの相手とも組めないため、待機キューに登録する前に拒否します。
+func (s *Server) validatePartyAttributes(players []model.Player) error {
+	for _, key := range s.cfg.Queue.MatchAttributeKeys {
+		for i, p := range players[1:] {
+			if p.Attributes[key] != players[0].Attributes[key] {
+				return &model.FieldError{Field: fmt.Sprintf("players[%d].attributes.%s", i+1, key), Message: fmt.Sprintf("party members must share the same %q attribute", key)}
+			}
+		}
+	}
+	return nil
+}
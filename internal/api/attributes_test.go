@@ -0,0 +1,73 @@
+package api
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"testing"
+
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// 登録時の属性を待機キューに保存し、必須の属性が一致する相手とだけマッチングする
+func TestEnqueueMatchAttributes(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.Queue.MatchAttributeKeys = []string{"crossplay"}
+		cfg.PlayerRateLimit = ratelimit.Config{}
+	})
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice", "attributes": map[string]string{"crossplay": "off", "language": "ja"}})
+	ts.waitQueued(t, 1)
+	ts.startEnqueue(t, map[string]interface{}{"id": "bob", "attributes": map[string]string{"crossplay": "on", "language": "ja"}})
+	ts.waitQueued(t, 2)
+	if cycle := ts.tick(t); cycle.Matched != 0 {
+		t.Fatalf("tick created %d sessions, want none for different crossplay", cycle.Matched)
+	}
+	players := ts.queuedPlayers(t)
+	if len(players) != 2 || !maps.Equal(players[0].Attributes, map[string]string{"crossplay": "off", "language": "ja"}) {
+		t.Fatalf("queued = %+v, want alice's attributes stored", players)
+	}
+
+	carol := ts.startEnqueue(t, map[string]interface{}{"id": "carol", "attributes": map[string]string{"crossplay": "off", "language": "en"}})
+	ts.waitQueued(t, 3)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want alice and carol matched", cycle.Matched)
+	}
+	for _, rec := range []int{receive(t, alice).Code, receive(t, carol).Code} {
+		if rec != http.StatusOK {
+			t.Fatalf("status %d, want 200", rec)
+		}
+	}
+	if ids := ts.queuedIDs(t); !slices.Equal(ids, []string{"bob"}) {
+		t.Fatalf("queued = %v, want bob left", ids)
+	}
+}
+
+// 必須の属性が異なるメンバーを含むパーティや、不正な属性は登録時に拒否する
+func TestEnqueueAttributesValidation(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.Queue.MatchAttributeKeys = []string{"crossplay"} })
+	for _, tc := range []struct {
+		name string
+		body map[string]interface{}
+	}{
+		{"party members differ", map[string]interface{}{"party_id": "p1", "game_mode": "2v2", "players": []map[string]interface{}{
+			{"id": "alice", "attributes": map[string]string{"crossplay": "off"}},
+			{"id": "bob", "attributes": map[string]string{"crossplay": "on"}},
+		}}},
+		{"bad key", map[string]interface{}{"id": "alice", "attributes": map[string]string{"cross play": "off"}}},
+	} {
+		rec := ts.do(t, "POST", "/matchmaking", tc.body, nil)
+		if code := errorShape(t, rec, http.StatusBadRequest); code != errCodeInvalidRequest {
+			t.Errorf("%s: code = %q, want %q", tc.name, code, errCodeInvalidRequest)
+		}
+	}
+
+	if keys, err := queue.ParseMatchAttributeKeys("crossplay, language"); err != nil || !slices.Equal(keys, []string{"crossplay", "language"}) {
+		t.Fatalf("keys = %v (%v), want crossplay and language", keys, err)
+	}
+	for _, v := range []string{"crossplay,crossplay", "cross play"} {
+		if _, err := queue.ParseMatchAttributeKeys(v); err == nil {
+			t.Errorf("%q accepted", v)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/secret"
+	"matchmaking_project/internal/store"
+)
+
+// 監査イベントの操作です。
+const (
+	auditQueued         = "queued"
+	auditMatched        = "matched"
+	auditForceMatched   = "force_matched"
+	auditCancelled      = "cancelled"
+	auditRemovedByAdmin = "removed_by_admin"
+	auditBanned         = "banned"
+	auditUnbanned       = "unbanned"
+	auditCooldown       = "cooldown"
+	auditResultReported = "result_reported"
+	// auditFeatureFlagChanged は PUT /admin/flags/{name} による機能フラグの変更です。
+	auditFeatureFlagChanged = "feature_flag_changed"
+	// auditDryRun は破壊的な管理操作の dry_run（確認トークンの発行）です。
+	auditDryRun = "dry_run"
+	// auditConfirmationRejected は確認トークンがない・使えないために実行しなかった破壊的な管理操作です。
+	auditConfirmationRejected = "confirmation_rejected"
+)
+
+// 操作を行った主体が API キー・トークン・管理用シークレットで分からない場合の主体です。
+const (
+	auditActorMatchmaker = "matchmaker"
+	auditActorSystem     = "system"
+)
+
+// GET /admin/audit の1ページの件数
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+)
+
+// auditClockSkewMargin はインスタンス間の時計のずれを見込んで、監査イベントの確定を待つ時間に加える余裕です。
+const auditClockSkewMargin = 5 * time.Second
+
+// auditActorKey は管理用エンドポイントのリクエストの主体を context に格納するキーです。
+type auditActorKey struct{}
+
+// withAuditActor は監査イベントの主体を格納した context を返します。
+func withAuditActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// auditActor は ctx のリクエストを行った主体を返します。
+// 管理用エンドポイントの主体、API キーのサービス、本人確認済みのプレイヤーの順に確認し、いずれもなければ fallback を返します。
+func auditActor(ctx context.Context, fallback string) string {
+	if actor, ok := ctx.Value(auditActorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	if service := serviceFrom(ctx); service != "" {
+		return "service:" + service
+	}
+	if id, ok := playerFrom(ctx); ok && id != "" {
+		return "player:" + id
+	}
+	return fallback
+}
+
+// adminActor は管理用エンドポイントのリクエストの主体を返します。
+// API キーが付いていればそのサービス名を（キーそのものは記録しない）、なければトークンの sub か共有シークレットであることを返します。
+func (s *Server) adminActor(h http.Header, tokenSubject string) string {
+	if key := h.Get(apiKeyHeader); key != "" {
+		if service, ok := secret.LookupSecret(s.cfg.APIKeys, key); ok {
+			return "admin:service:" + service
+		}
+	}
+	if tokenSubject != "" {
+		return "admin:token:" + tokenSubject
+	}
+	return "admin:secret"
+}
+
+// recordAudit は監査イベントを追記します。記録できなくても利用者の操作は失敗させず、ログとメトリクスに残します。
+// 発生時刻が設定されていないイベントは現在時刻にします。
+func (s *Server) recordAudit(ctx context.Context, events []store.AuditEvent) {
+	if s.audit == nil || len(events) == 0 {
+		return
+	}
+	now := s.now()
+	for i := range events {
+		if events[i].OccurredAt.IsZero() {
+			events[i].OccurredAt = now
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.cfg.TickTimeout)
+	defer cancel()
+	if err := s.audit.AppendAuditEvents(ctx, events); err != nil {
+		metrics.AuditWriteFailures.Add(float64(len(events)))
+		s.logger.ErrorContext(ctx, "監査イベントの記録エラー", "func", "recordAudit", "action", events[0].Action, "events", len(events), "error", err)
+	}
+}
+
+// auditEntry はエントリのメンバーごとに監査イベントを記録します。主体が分からない場合は先頭のメンバー本人とみなします。
+func (s *Server) auditEntry(ctx context.Context, action string, entry model.QueueEntry, details map[string]interface{}) {
+	actor := auditActor(ctx, "player:"+entry.Players[0].ID)
+	events := make([]store.AuditEvent, 0, len(entry.Players))
+	for _, p := range entry.Players {
+		d := map[string]interface{}{"game_mode": entry.GameMode}
+		if entry.PartyID != "" {
+			d["party_id"] = entry.PartyID
+		}
+		for k, v := range details {
+			d[k] = v
+		}
+		events = append(events, store.AuditEvent{Actor: actor, Action: action, SubjectPlayerID: p.ID, Details: d})
+	}
+	s.recordAudit(ctx, events)
+}
+
+// auditSessions はセッションの参加者（ボットを除く）ごとに監査イベントを記録します。
+// PlayerIDs を指定した場合はそのプレイヤーのみ記録します。主体が分からない場合は fallback を使います。
+func (s *Server) auditSessions(ctx context.Context, fallback, action string, sessions []model.SessionResult, playerIDs []string, details map[string]interface{}) {
+	actor := auditActor(ctx, fallback)
+	var events []store.AuditEvent
+	for _, session := range sessions {
+		for _, p := range session.Participants {
+			if p.IsBot || (playerIDs != nil && !slices.Contains(playerIDs, p.ID)) {
+				continue
+			}
+			d := map[string]interface{}{"game_mode": session.GameMode, "team": p.Team}
+			for k, v := range details {
+				d[k] = v
+			}
+			events = append(events, store.AuditEvent{Actor: actor, Action: action, SubjectPlayerID: p.ID, SessionID: session.SessionID, Details: d})
+		}
+	}
+	s.recordAudit(ctx, events)
+}
+
+// auditPlayer はプレイヤーへの操作の監査イベントを1件記録します。
+func (s *Server) auditPlayer(ctx context.Context, fallback, action, playerID string, details map[string]interface{}) {
+	s.recordAudit(ctx, []store.AuditEvent{{Actor: auditActor(ctx, fallback), Action: action, SubjectPlayerID: playerID, Details: details}})
+}
+
+// auditSettleWindow は監査イベントを返すまで待つ時間です。event_id は追記を始めた順に採番されるため、
+// 先に採番された追記が後からコミットされると、それより大きい event_id を cursor にした次のページから漏れます。
+// 追記は TickTimeout で打ち切るため、それより古いイベントだけを返せば、返したイベントより前の event_id は全てコミット済みです。
+func (s *Server) auditSettleWindow() time.Duration {
+	return s.cfg.TickTimeout + auditClockSkewMargin
+}
+
+// settledAuditEvents は events を、auditSettleWindow より新しいイベントの手前までに切り詰めます。
+// 切り詰めた場合は true を返します（新しいイベントより後の event_id は、確定するまで返しません）。
+func settledAuditEvents(events []store.AuditEvent, settled time.Time) ([]store.AuditEvent, bool) {
+	for i, e := range events {
+		if !e.OccurredAt.Before(settled) {
+			return events[:i], true
+		}
+	}
+	return events, false
+}
+
+// auditPage は GET /admin/audit のレスポンスです。
+type auditPage struct {
+	Events []store.AuditEvent `json:"events"`
+	// NextCursor は次のページを取得するための cursor です。最後のページでは省略します。
+	// 確定を待っているイベントがある場合は、返したイベントがなくても続きを取得するための cursor を返します。
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// adminAuditHandler は監査イベントを追記した順に返します（GET /admin/audit?since=...&until=...&cursor=...&limit=...）。
+// since・until は RFC 3339 の時刻で、since 以降・until より前に起きたイベントに絞り込みます。
+func (s *Server) adminAuditHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := store.AuditQuery{Limit: defaultAuditPageSize}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		v := query.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeQueueEntryError(w, &model.FieldError{Field: p.name, Message: p.name + " must be an RFC 3339 time"})
+			return
+		}
+		*p.dst = t
+	}
+	if v := query.Get("cursor"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeQueueEntryError(w, &model.FieldError{Field: "cursor", Message: "invalid cursor"})
+			return
+		}
+		q.After = n
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditPageSize {
+			writeQueueEntryError(w, &model.FieldError{Field: "limit", Message: fmt.Sprintf("limit must be between 1 and %d", maxAuditPageSize)})
+			return
+		}
+		q.Limit = n
+	}
+
+	events, err := s.Store.ListAuditEvents(r.Context(), q)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "監査イベント取得エラー", "func", "adminAuditHandler", "error", err)
+		metrics.HandlerErrors.WithLabelValues("admin").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to list audit events")
+		return
+	}
+	full := len(events) == q.Limit
+	events, pending := settledAuditEvents(events, s.now().Add(-s.auditSettleWindow()))
+	page := auditPage{Events: events}
+	if page.Events == nil {
+		page.Events = []store.AuditEvent{}
+	}
+	switch {
+	case len(events) > 0 && (full || pending):
+		page.NextCursor = strconv.FormatInt(events[len(events)-1].EventID, 10)
+	case pending:
+		page.NextCursor = strconv.FormatInt(q.After, 10)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "adminAuditHandler", "error", err)
+	}
+}
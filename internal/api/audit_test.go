@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/store"
+)
+
+func TestAuditPageWithholdsUnsettledEvents(t *testing.T) {
+	ts := newTestServer(t, nil)
+	admin := ts.AdminHandler()
+	list := func(cursor string) auditPage {
+		t.Helper()
+		rec := serve(t, admin, "GET", "/admin/audit?cursor="+cursor, nil, adminHeader())
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /admin/audit = %d: %s", rec.Code, rec.Body)
+		}
+		var page auditPage
+		decodeJSON(t, rec, &page)
+		return page
+	}
+
+	ts.auditPlayer(context.Background(), auditActorSystem, auditBanned, "alice", nil)
+	// 追記の途中の可能性があるイベントは返さず、続きを取得する cursor を返す
+	if page := list("0"); len(page.Events) != 0 || page.NextCursor != "0" {
+		t.Fatalf("fresh event: page = %+v, want no events and next_cursor 0", page)
+	}
+
+	ts.clock.Advance(ts.auditSettleWindow() + time.Second)
+	ts.auditPlayer(context.Background(), auditActorSystem, auditBanned, "bob", nil)
+	page := list("0")
+	if len(page.Events) != 1 || page.Events[0].SubjectPlayerID != "alice" || page.NextCursor != "1" {
+		t.Fatalf("after the window: page = %+v, want only alice with next_cursor 1", page)
+	}
+
+	ts.clock.Advance(ts.auditSettleWindow() + time.Second)
+	page = list(page.NextCursor)
+	if len(page.Events) != 1 || page.Events[0].SubjectPlayerID != "bob" || page.NextCursor != "" {
+		t.Fatalf("last page = %+v, want only bob without next_cursor", page)
+	}
+}
+
+func TestSettledAuditEventsStopsAtFirstUnsettled(t *testing.T) {
+	settled := testEpoch
+	events := []store.AuditEvent{
+		{EventID: 1, OccurredAt: settled.Add(-time.Second)},
+		{EventID: 2, OccurredAt: settled},
+		// 時計のずれで古い時刻を持つイベントも、確定していないイベントより後の event_id なら返さない
+		{EventID: 3, OccurredAt: settled.Add(-time.Minute)},
+	}
+	got, pending := settledAuditEvents(events, settled)
+	if len(got) != 1 || got[0].EventID != 1 || !pending {
+		t.Fatalf("settledAuditEvents = %+v, %v, want only event 1 and pending", got, pending)
+	}
+}
+
+// auditEvents は確定を待つ時間を過ぎてから GET /admin/audit に query を付けて取得したページを返します。
+func (ts *testServer) auditEvents(t *testing.T, query string) auditPage {
+	t.Helper()
+	rec := serve(t, ts.AdminHandler(), "GET", "/admin/audit"+query, nil, adminHeader())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /admin/audit%s = %d: %s", query, rec.Code, rec.Body)
+	}
+	var page auditPage
+	decodeJSON(t, rec, &page)
+	return page
+}
+
+// failingAuditLogger は常に追記に失敗する AuditLogger です。
+type failingAuditLogger struct{}
+
+func (failingAuditLogger) AppendAuditEvents(context.Context, []store.AuditEvent) error {
+	return errors.New("audit_events is read-only")
+}
+
+// 登録・マッチング・管理者による参加禁止を、主体とともに追記した順に記録する
+func TestAuditTrail(t *testing.T) {
+	ts := newTestServer(t, nil)
+	session := ts.matchPair(t, "alice", "bob")
+	ts.clock.Advance(time.Minute)
+	ts.ban(t, "carol", map[string]int{"duration_seconds": 3600})
+	ts.clock.Advance(ts.auditSettleWindow() + time.Second)
+
+	var got []string
+	for _, e := range ts.auditEvents(t, "").Events {
+		got = append(got, e.Actor+" "+e.Action+" "+e.SubjectPlayerID)
+		if e.Action == auditMatched && e.SessionID != session.SessionID {
+			t.Errorf("matched event = %+v, want session %s", e, session.SessionID)
+		}
+	}
+	want := []string{
+		"player:alice queued alice",
+		"player:bob queued bob",
+		"matchmaker matched alice",
+		"matchmaker matched bob",
+		// 確認トークンの発行（dry_run）と実行
+		"admin:secret dry_run carol",
+		"admin:secret banned carol",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("events = %q, want %q", got, want)
+	}
+}
+
+// 発生時刻の範囲で絞り込み、limit ごとに cursor でページを進める
+func TestAuditTimeRangeAndPagination(t *testing.T) {
+	ts := newTestServer(t, nil)
+	for _, id := range []string{"alice", "bob", "carol", "dave"} {
+		ts.auditPlayer(context.Background(), auditActorSystem, auditBanned, id, nil)
+		ts.clock.Advance(time.Minute)
+	}
+	ts.clock.Advance(ts.auditSettleWindow())
+
+	var got []string
+	cursor := "0"
+	for pages := 0; cursor != ""; pages++ {
+		if pages > 3 {
+			t.Fatalf("pagination did not finish: %v", got)
+		}
+		page := ts.auditEvents(t, "?limit=3&cursor="+cursor)
+		for _, e := range page.Events {
+			got = append(got, e.SubjectPlayerID)
+		}
+		cursor = page.NextCursor
+	}
+	if !slices.Equal(got, []string{"alice", "bob", "carol", "dave"}) {
+		t.Fatalf("paged events = %v, want all 4 in order", got)
+	}
+
+	since, until := testEpoch.Add(time.Minute), testEpoch.Add(3*time.Minute)
+	page := ts.auditEvents(t, "?since="+url.QueryEscape(since.Format(time.RFC3339))+"&until="+url.QueryEscape(until.Format(time.RFC3339)))
+	got = got[:0]
+	for _, e := range page.Events {
+		got = append(got, e.SubjectPlayerID)
+	}
+	if !slices.Equal(got, []string{"bob", "carol"}) {
+		t.Fatalf("events in range = %v, want bob and carol", got)
+	}
+
+	for _, query := range []string{"?since=yesterday", "?cursor=-1", "?limit=0", "?limit=1001"} {
+		rec := serve(t, ts.AdminHandler(), "GET", "/admin/audit"+query, nil, adminHeader())
+		if code := errorShape(t, rec, http.StatusBadRequest); code != errCodeInvalidRequest {
+			t.Errorf("%s: code = %q, want %q", query, code, errCodeInvalidRequest)
+		}
+	}
+}
+
+// 監査イベントを記録できなくても利用者の操作は成功し、記録できなかった件数を数える
+func TestAuditWriteFailureDoesNotFailOperation(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.audit = failingAuditLogger{}
+	failures := testutil.ToFloat64(metrics.AuditWriteFailures)
+	ts.matchPair(t, "alice", "bob")
+	// alice と bob の登録、2人のマッチング
+	if got := testutil.ToFloat64(metrics.AuditWriteFailures) - failures; got != 4 {
+		t.Fatalf("audit write failures = %v, want 4", got)
+	}
+}
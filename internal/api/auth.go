@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"matchmaking_project/internal/secret"
+)
+
+// apiKeyHeader は Authorization ヘッダーの代わりに API キーを渡すためのヘッダーです。
+const apiKeyHeader = "X-API-Key"
+
+// serviceKey は認証したクライアントのサービス名を context に格納するためのキーです。
+type serviceKey struct{}
+
+// ParseAPIKeys は "service:key,key2" 形式の設定を API キーの一覧に変換します。
+// サービス名を省略したキーのサービス名は空文字列になります。
+func ParseAPIKeys(s string) map[string]string {
+	keys := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		service, key, ok := strings.Cut(item, ":")
+		if !ok {
+			service, key = "", item
+		}
+		keys[key] = service
+	}
+	return keys
+}
+
+// requestAPIKey は Authorization: Bearer または X-API-Key ヘッダー（gRPC の場合はメタデータ）から API キーを取り出します。
+// プレイヤーのトークン（PLAYER_TOKEN_SECRET）を使う場合、Authorization ヘッダーはトークンに使うため X-API-Key だけを見ます。
+func (s *Server) requestAPIKey(h http.Header) string {
+	if s.cfg.PlayerTokenKeys != nil {
+		return h.Get(apiKeyHeader)
+	}
+	if auth := h.Get("Authorization"); auth != "" {
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	return h.Get(apiKeyHeader)
+}
+
+// serviceFrom は context に格納された認証済みクライアントのサービス名を返します。
+func serviceFrom(ctx context.Context) string {
+	service, _ := ctx.Value(serviceKey{}).(string)
+	return service
+}
+
+// authMiddleware は API キーを検証するミドルウェアです。キーがない、または不正な場合は 401 を返します。
+// CORS の preflight を通すため、s.corsMiddleware の内側に適用してください。
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.cfg.APIKeys) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := s.requestAPIKey(r.Header)
+		service, ok := secret.LookupSecret(s.cfg.APIKeys, key)
+		if key == "" || !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="matchmaking"`)
+			writeJSONError(w, http.StatusUnauthorized, errCodeUnauthorized, "Missing or invalid API key")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), serviceKey{}, service)))
+	})
+}
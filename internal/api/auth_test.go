@@ -0,0 +1,115 @@
+package api
+
+import (
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	got := ParseAPIKeys(" lobby:key-1, key-2 ,,dashboard:key-3")
+	want := map[string]string{"key-1": "lobby", "key-2": "", "key-3": "dashboard"}
+	if !maps.Equal(got, want) {
+		t.Fatalf("keys = %v, want %v", got, want)
+	}
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.APIKeys = map[string]string{"key-1": "lobby"} })
+	for _, tc := range []struct {
+		name          string
+		header        map[string]string
+		authenticated bool
+	}{
+		{"bearer", map[string]string{"Authorization": "Bearer key-1"}, true},
+		{"x-api-key", map[string]string{apiKeyHeader: "key-1"}, true},
+		{"missing", nil, false},
+		{"wrong bearer", map[string]string{"Authorization": "Bearer key-2"}, false},
+		{"wrong x-api-key", map[string]string{apiKeyHeader: "key-2"}, false},
+		{"other scheme", map[string]string{"Authorization": "Basic a2V5LTE="}, false},
+		// Authorization ヘッダーがあれば X-API-Key より優先する
+		{"invalid authorization with a valid x-api-key", map[string]string{"Authorization": "Bearer key-2", apiKeyHeader: "key-1"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			header := make(http.Header)
+			for k, v := range tc.header {
+				header.Set(k, v)
+			}
+			rec := ts.do(t, "GET", "/leaderboard", nil, header)
+			if tc.authenticated {
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status %d, want 200: %s", rec.Code, rec.Body)
+				}
+				return
+			}
+			if rec.Code != http.StatusUnauthorized || errorCode(t, rec) != errCodeUnauthorized {
+				t.Fatalf("status %d, want 401 %s: %s", rec.Code, errCodeUnauthorized, rec.Body)
+			}
+			if rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+// 認証は CORS の preflight より内側で行い、probe 用のエンドポイントには適用しない
+func TestAPIKeyMiddlewareComposesWithCORS(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.APIKeys = map[string]string{"key-1": "lobby"}
+		cfg.CORS.AllowedOrigins = []string{"https://game.example"}
+	})
+	header := make(http.Header)
+	header.Set("Origin", "https://game.example")
+	header.Set("Access-Control-Request-Method", "POST")
+	rec := ts.do(t, "OPTIONS", "/matchmaking", nil, header)
+	if rec.Code >= http.StatusBadRequest || rec.Header().Get("Access-Control-Allow-Origin") != "https://game.example" {
+		t.Fatalf("preflight without an API key: status %d, headers %v", rec.Code, rec.Header())
+	}
+	// 認証に失敗したレスポンスにも CORS のヘッダーを付け、ブラウザから 401 を読めるようにする
+	header.Del("Access-Control-Request-Method")
+	rec = ts.do(t, "GET", "/leaderboard", nil, header)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("Access-Control-Allow-Origin") != "https://game.example" {
+		t.Fatalf("unauthenticated cross-origin request: status %d, headers %v", rec.Code, rec.Header())
+	}
+	if rec := ts.do(t, "GET", "/healthz", nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("/healthz without an API key: status %d", rec.Code)
+	}
+}
+
+// 認証したキーのサービス名をリクエストのログに付与する
+func TestAPIKeyServiceLogged(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.APIKeys = map[string]string{"key-1": "lobby", "key-2": "tournament"} })
+	logs := ts.captureLogs(slog.LevelInfo)
+
+	enqueue := func(id, key string) <-chan *httptest.ResponseRecorder {
+		header := make(http.Header)
+		header.Set(apiKeyHeader, key)
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() { done <- ts.do(t, "POST", "/matchmaking", map[string]string{"id": id}, header) }()
+		return done
+	}
+	alice := enqueue("alice", "key-1")
+	ts.waitQueued(t, 1)
+	bob := enqueue("bob", "key-2")
+	ts.waitQueued(t, 2)
+	ts.clock.Advance(10 * time.Second)
+	ts.tick(t)
+	receive(t, alice)
+	receive(t, bob)
+
+	services := make(map[string]interface{})
+	for _, rec := range logs.records(t) {
+		if rec["msg"] == "registered for matchmaking" {
+			ids, _ := rec["player_ids"].([]interface{})
+			if len(ids) == 1 {
+				services[ids[0].(string)] = rec["service"]
+			}
+		}
+	}
+	if services["alice"] != "lobby" || services["bob"] != "tournament" {
+		t.Fatalf("logged services = %v, want alice from lobby and bob from tournament", services)
+	}
+}
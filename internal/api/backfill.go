@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"matchmaking_project/internal/store"
+)
+
+// backfillBatchFunc は cursor より後のデータを最大 limit 件再計算し、次の cursor と処理件数を返します。
+// 同じ範囲を何度処理しても結果が変わらない（冪等である）必要があります。
+// 処理件数が 0 の場合は完了とみなします。
+type backfillBatchFunc func(ctx context.Context, st store.Store, cursor string, limit int) (next string, n int, err error)
+
+// backfillDatasets は名前ごとに登録された派生データのバックフィル処理です。
+var backfillDatasets = make(map[string]backfillBatchFunc)
+
+// registerBackfill は派生データのバックフィル処理を登録します。各機能のコードの近くで init から呼び出します。
+func registerBackfill(name string, fn backfillBatchFunc) {
+	if _, exists := backfillDatasets[name]; exists {
+		panic("backfill dataset already registered: " + name)
+	}
+	backfillDatasets[name] = fn
+}
+
+// backfillCheckpointKey は service_state 上のチェックポイントのキーを返します。
+func backfillCheckpointKey(name string) string {
+	return "backfill:" + name
+}
+
+// runBackfill は派生データを batchSize 件ずつ再計算します。
+// バッチごとに service_state へチェックポイントを保存するため、中断しても続きから再開できます。
+// rowsPerSec が正の場合は、1秒あたりの処理件数がその値を超えないよう待機して DB への負荷を抑えます。
+// restart が true の場合はチェックポイントを無視して最初からやり直します。
+func runBackfill(ctx context.Context, st store.Store, name string, batchSize, rowsPerSec int, restart bool) error {
+	fn, ok := backfillDatasets[name]
+	if !ok {
+		return fmt.Errorf("unknown backfill dataset %q (available: %s)", name, strings.Join(backfillDatasetNames(), ", "))
+	}
+
+	key := backfillCheckpointKey(name)
+	cursor := ""
+	if !restart {
+		var err error
+		if cursor, err = st.GetServiceState(ctx, key); err != nil {
+			return fmt.Errorf("チェックポイント取得エラー: %v", err)
+		}
+	}
+	slog.Info("backfill started", "dataset", name, "cursor", cursor)
+
+	total := 0
+	for {
+		started := time.Now()
+		next, n, err := fn(ctx, st, cursor, batchSize)
+		if err != nil {
+			return fmt.Errorf("バックフィル処理エラー [cursor=%s]: %v", cursor, err)
+		}
+		if n == 0 {
+			break
+		}
+		if err := st.SetServiceState(ctx, key, next); err != nil {
+			return fmt.Errorf("チェックポイント保存エラー: %v", err)
+		}
+		cursor = next
+		total += n
+		slog.Debug("backfill batch done", "dataset", name, "cursor", cursor, "rows", n)
+
+		if rowsPerSec > 0 {
+			minDuration := time.Duration(n) * time.Second / time.Duration(rowsPerSec)
+			if wait := minDuration - time.Since(started); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+	}
+
+	slog.Info("backfill finished", "dataset", name, "rows", total)
+	return nil
+}
+
+// backfillDatasetNames は登録済みのバックフィル対象の名前を返します。
+func backfillDatasetNames() []string {
+	names := make([]string, 0, len(backfillDatasets))
+	for name := range backfillDatasets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RunBackfillCommand は backfill サブコマンドを実行します。
+// 例: matchmaking_project backfill -batch 500 -rate 1000 games_played
+func RunBackfillCommand(st store.Store, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	batchSize := fs.Int("batch", 500, "1バッチで処理する件数")
+	rowsPerSec := fs.Int("rate", 1000, "1秒あたりの最大処理件数（0 で無制限）")
+	restart := fs.Bool("restart", false, "チェックポイントを無視して最初から処理する")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: backfill [flags] <dataset> (available: %s)", strings.Join(backfillDatasetNames(), ", "))
+	}
+	if *batchSize <= 0 {
+		return errors.New("batch must be positive")
+	}
+	return runBackfill(context.Background(), st, fs.Arg(0), *batchSize, *rowsPerSec, *restart)
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+	"matchmaking_project/internal/store"
+)
+
+// interruptedStore は failAt 回目のバックフィルのバッチを失敗させ、各バッチに渡された cursor を記録します。
+type interruptedStore struct {
+	store.Store
+	failAt  int
+	cursors []string
+}
+
+func (s *interruptedStore) batch(cursor string) error {
+	s.cursors = append(s.cursors, cursor)
+	if len(s.cursors) == s.failAt {
+		return errors.New("interrupted")
+	}
+	return nil
+}
+
+func (s *interruptedStore) BackfillWinLoss(ctx context.Context, cursor string, limit int) (string, int, error) {
+	if err := s.batch(cursor); err != nil {
+		return "", 0, err
+	}
+	return s.Store.BackfillWinLoss(ctx, cursor, limit)
+}
+
+func (s *interruptedStore) BackfillHeadToHead(ctx context.Context, cursor string, limit int) (string, int, error) {
+	if err := s.batch(cursor); err != nil {
+		return "", 0, err
+	}
+	return s.Store.BackfillHeadToHead(ctx, cursor, limit)
+}
+
+// newResultsTestServer は2つのセッション（alice と bob、carol と dave）の結果を報告した Server を返します。
+// alice と bob の対戦では先に登録したチームが勝ち、carol と dave の対戦は引き分けです。
+func newResultsTestServer(t *testing.T) (*testServer, model.SessionResult) {
+	t.Helper()
+	// 4人が続けて待機を始めるため、プレイヤーごとのレート制限は行わない
+	ts := newTestServer(t, func(cfg *Config) { cfg.PlayerRateLimit = ratelimit.Config{} })
+	ctx := context.Background()
+	won := ts.activeSession(t, "alice", "bob")
+	if _, err := ts.reportResult(ctx, won.SessionID, model.OutcomeWin, won.Participants[0].Team); err != nil {
+		t.Fatal(err)
+	}
+	drawn := ts.activeSession(t, "carol", "dave")
+	if _, err := ts.reportResult(ctx, drawn.SessionID, model.OutcomeDraw, 0); err != nil {
+		t.Fatal(err)
+	}
+	return ts, won
+}
+
+// headToHead は GET /players/{id}/head-to-head/{opponent_id} の成績を返します。
+func (ts *testServer) headToHead(t *testing.T, playerID, opponentID string) model.WinLossRecord {
+	t.Helper()
+	rec := ts.do(t, "GET", "/players/"+playerID+"/head-to-head/"+opponentID, nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("head-to-head %s vs %s: status %d: %s", playerID, opponentID, rec.Code, rec.Body)
+	}
+	var h model.HeadToHead
+	decodeJSON(t, rec, &h)
+	return h.WinLossRecord
+}
+
+func TestSessionResultUpdatesWinLossRecords(t *testing.T) {
+	ts, won := newResultsTestServer(t)
+	ctx := context.Background()
+	winner, loser := won.Participants[0].ID, won.Participants[1].ID
+
+	for id, want := range map[string]model.WinLossRecord{winner: {Wins: 1}, loser: {Losses: 1}, "carol": {Draws: 1}, "dave": {Draws: 1}} {
+		profile, err := ts.store.GetPlayerProfile(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profile.WinLossRecord != want {
+			t.Errorf("%s = %+v, want %+v", id, profile.WinLossRecord, want)
+		}
+	}
+	if got := ts.headToHead(t, winner, loser); got != (model.WinLossRecord{Wins: 1}) {
+		t.Errorf("%s vs %s = %+v, want 1 win", winner, loser, got)
+	}
+	if got := ts.headToHead(t, loser, winner); got != (model.WinLossRecord{Losses: 1}) {
+		t.Errorf("%s vs %s = %+v, want 1 loss", loser, winner, got)
+	}
+	if got := ts.headToHead(t, "alice", "carol"); got != (model.WinLossRecord{}) {
+		t.Errorf("alice vs carol = %+v, want no games", got)
+	}
+	if rec := ts.do(t, "GET", "/players/zed/head-to-head/alice", nil, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown player: status %d, want 404", rec.Code)
+	}
+}
+
+// 中断したバックフィルはチェックポイントから再開し、報告済みの結果を数え直しても成績は変わらない
+func TestBackfillResumesFromCheckpoint(t *testing.T) {
+	ts, _ := newResultsTestServer(t)
+	ctx := context.Background()
+	ids := []string{"alice", "bob", "carol", "dave"}
+	records := func() map[string]model.WinLossRecord {
+		got := make(map[string]model.WinLossRecord)
+		for _, id := range ids {
+			profile, err := ts.store.GetPlayerProfile(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got[id] = profile.WinLossRecord
+			for _, other := range ids {
+				h, err := ts.store.GetHeadToHead(ctx, id, other)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[id+" vs "+other] = h.WinLossRecord
+			}
+		}
+		return got
+	}
+	want := records()
+
+	for _, name := range []string{"wins_losses", "head_to_head"} {
+		t.Run(name, func(t *testing.T) {
+			st := &interruptedStore{Store: ts.store, failAt: 2}
+			if err := runBackfill(ctx, st, name, 1, 0, false); err == nil {
+				t.Fatal("interrupted backfill succeeded")
+			}
+			if checkpoint, _ := ts.store.GetServiceState(ctx, backfillCheckpointKey(name)); checkpoint != "alice" {
+				t.Fatalf("checkpoint = %q, want alice", checkpoint)
+			}
+			if err := runBackfill(ctx, st, name, 1, 0, false); err != nil {
+				t.Fatal(err)
+			}
+			// 失敗したバッチ（alice の後）から再開する
+			if wantCursors := []string{"", "alice", "alice", "bob", "carol", "dave"}; !slices.Equal(st.cursors, wantCursors) {
+				t.Fatalf("batch cursors = %q, want %q", st.cursors, wantCursors)
+			}
+			for k, got := range records() {
+				if got != want[k] {
+					t.Errorf("%s = %+v, want %+v", k, got, want[k])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+)
+
+// playerBannedError は参加禁止中のプレイヤー（パーティの場合はメンバーのいずれか）が待機キューへ登録しようとした場合のエラーです。
+type playerBannedError struct {
+	Ban store.PlayerBan
+}
+
+func (e *playerBannedError) Error() string {
+	if e.Ban.Until.IsZero() {
+		return fmt.Sprintf("player %s is banned from matchmaking", e.Ban.PlayerID)
+	}
+	return fmt.Sprintf("player %s is banned from matchmaking until %s", e.Ban.PlayerID, e.Ban.Until.Format(time.RFC3339))
+}
+
+// checkBans はエントリのメンバーのいずれかが now の時点で参加禁止であれば playerBannedError を返します。
+func (s *Server) checkBans(ctx context.Context, entry model.QueueEntry, now time.Time) error {
+	ids := make([]string, len(entry.Players))
+	for i, p := range entry.Players {
+		ids[i] = p.ID
+	}
+	ban, banned, err := s.Store.ActiveBan(ctx, ids, now)
+	if err != nil {
+		return fmt.Errorf("参加禁止の確認エラー: %v", err)
+	}
+	if banned {
+		return &playerBannedError{Ban: ban}
+	}
+	return nil
+}
+
+// writePlayerBanned は参加禁止中のプレイヤーのリクエストへ 403 を返します。
+func writePlayerBanned(w http.ResponseWriter, e *playerBannedError) {
+	details := map[string]interface{}{"player_id": e.Ban.PlayerID}
+	if !e.Ban.Until.IsZero() {
+		details["until"] = e.Ban.Until
+	}
+	if e.Ban.Reason != "" {
+		details["reason"] = e.Ban.Reason
+	}
+	writeErrorResponse(w, http.StatusForbidden, ErrorDetail{
+		Code:    errCodePlayerBanned,
+		Message: "Player is banned from matchmaking",
+		Details: details,
+	})
+}
+
+// banRequest は PUT /admin/bans/{player_id} と POST /admin/bans のリクエストボディです。
+// until と duration_seconds のどちらも省略した場合は無期限の禁止になります。
+type banRequest struct {
+	// PlayerID は POST /admin/bans で禁止するプレイヤーです。PUT ではパスのプレイヤーと同じ場合のみ指定できます。
+	PlayerID        string     `json:"player_id"`
+	Until           *time.Time `json:"until"`
+	DurationSeconds int        `json:"duration_seconds"`
+	Reason          string     `json:"reason"`
+}
+
+// banPlayerHandler はプレイヤーのマッチングへの参加を禁止します。既に禁止されている場合は期限と理由を上書きします。
+// 待機中であれば待機キューから削除し、結果を待っているリクエストへ removed_by_admin のエラーを返させます。
+// POST /admin/bans ではプレイヤーをボディの player_id で指定します。
+// dry_run=true の場合は登録する禁止と現在の禁止・待機の状態、確認トークンを返し、登録にはそのトークンが必要です。
+func (s *Server) banPlayerHandler(w http.ResponseWriter, r *http.Request) {
+	var req banRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	dec.DisallowUnknownFields()
+	// ボディを省略した場合は理由なしの無期限の禁止にする
+	if err := dec.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeQueueEntryError(w, err)
+		return
+	}
+	playerID := r.PathValue("player_id")
+	switch {
+	case playerID == "":
+		playerID = req.PlayerID
+	case req.PlayerID != "" && req.PlayerID != playerID:
+		writeQueueEntryError(w, &model.FieldError{Field: "player_id", Message: "player_id does not match the path"})
+		return
+	}
+	if err := model.ValidateID("player_id", playerID, "player_id"); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+
+	now := s.now()
+	ban := store.PlayerBan{PlayerID: playerID, Reason: req.Reason, CreatedAt: now}
+	switch {
+	case req.Until != nil && req.DurationSeconds != 0:
+		writeQueueEntryError(w, &model.FieldError{Field: "until", Message: "specify either until or duration_seconds, not both"})
+		return
+	case req.Until != nil:
+		if !req.Until.After(now) {
+			writeQueueEntryError(w, &model.FieldError{Field: "until", Message: "until must be in the future"})
+			return
+		}
+		ban.Until = *req.Until
+	case req.DurationSeconds < 0:
+		writeQueueEntryError(w, &model.FieldError{Field: "duration_seconds", Message: "duration_seconds must not be negative"})
+		return
+	case req.DurationSeconds > 0:
+		ban.Until = now.Add(time.Duration(req.DurationSeconds) * time.Second)
+	}
+
+	dryRun, err := dryRunParam(r)
+	if err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+	// 確認トークンはパスとボディのどちらで指定したかに関係なく、禁止するプレイヤーと期限・理由の指定に結び付ける
+	params := req
+	params.PlayerID = playerID
+	if dryRun {
+		summary, err := s.banSummary(r.Context(), playerID, now)
+		if err != nil {
+			s.logger.ErrorContext(r.Context(), "参加禁止の確認エラー", "func", "banPlayerHandler", "player_id", playerID, "error", err)
+			metrics.HandlerErrors.WithLabelValues("admin").Inc()
+			writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to get player ban")
+			return
+		}
+		summary["ban"] = ban
+		s.issueConfirmation(w, r, adminOpBan, []string{playerID}, params, summary)
+		return
+	}
+	if !s.confirmAdminAction(w, r, adminOpBan, []string{playerID}, params) {
+		return
+	}
+
+	created, err := s.Store.BanPlayer(r.Context(), ban)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "参加禁止登録エラー", "func", "banPlayerHandler", "player_id", playerID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("admin").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to ban player")
+		return
+	}
+	s.logger.InfoContext(r.Context(), "player banned by admin", "player_id", playerID, "until", ban.Until, "reason", ban.Reason)
+	details := map[string]interface{}{"reason": ban.Reason}
+	if !ban.Until.IsZero() {
+		details["until"] = ban.Until
+	}
+	s.auditPlayer(r.Context(), auditActorSystem, auditBanned, playerID, details)
+
+	if err := s.removeFromQueue(r.Context(), playerID); err != nil && !errors.Is(err, store.ErrNotQueued) {
+		// 禁止は登録済みのため、次のマッチングまでに削除されなくても再登録はできない
+		s.logger.ErrorContext(r.Context(), "参加禁止時の待機キュー削除エラー", "func", "banPlayerHandler", "player_id", playerID, "error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	if err := json.NewEncoder(w).Encode(ban); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "banPlayerHandler", "player_id", playerID, "error", err)
+	}
+}
+
+// unbanPlayerHandler はプレイヤーの参加禁止を解除します。登録されていない場合は 404 を返します。
+// dry_run=true の場合は現在の禁止の状態と確認トークンを返し、解除にはそのトークンが必要です。
+func (s *Server) unbanPlayerHandler(w http.ResponseWriter, r *http.Request) {
+	playerID := r.PathValue("player_id")
+	dryRun, err := dryRunParam(r)
+	if err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+	params := map[string]string{"player_id": playerID}
+	if dryRun {
+		summary, err := s.banSummary(r.Context(), playerID, s.now())
+		if err != nil {
+			s.logger.ErrorContext(r.Context(), "参加禁止の確認エラー", "func", "unbanPlayerHandler", "player_id", playerID, "error", err)
+			metrics.HandlerErrors.WithLabelValues("admin").Inc()
+			writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to get player ban")
+			return
+		}
+		s.issueConfirmation(w, r, adminOpUnban, []string{playerID}, params, summary)
+		return
+	}
+	if !s.confirmAdminAction(w, r, adminOpUnban, []string{playerID}, params) {
+		return
+	}
+	err = s.Store.UnbanPlayer(r.Context(), playerID)
+	if errors.Is(err, store.ErrNotBanned) {
+		writeJSONError(w, http.StatusNotFound, errCodeNotBanned, store.ErrNotBanned.Error())
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "参加禁止解除エラー", "func", "unbanPlayerHandler", "player_id", playerID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("admin").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to unban player")
+		return
+	}
+	s.logger.InfoContext(r.Context(), "player unbanned by admin", "player_id", playerID)
+	s.auditPlayer(r.Context(), auditActorSystem, auditUnbanned, playerID, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// banSummary は dry_run で返すプレイヤーの現在の参加禁止（active_ban）と、待機中かどうか（queued）です。
+func (s *Server) banSummary(ctx context.Context, playerID string, now time.Time) (map[string]interface{}, error) {
+	active, banned, err := s.Store.ActiveBan(ctx, []string{playerID}, now)
+	if err != nil {
+		return nil, err
+	}
+	summary := map[string]interface{}{"player_id": playerID, "queued": true}
+	if banned {
+		summary["active_ban"] = active
+	}
+	if _, err := s.Store.QueuePosition(ctx, playerID); errors.Is(err, store.ErrNotQueued) {
+		summary["queued"] = false
+	} else if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
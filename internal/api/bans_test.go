@@ -0,0 +1,124 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/ratelimit"
+)
+
+// ban は管理用エンドポイントで確認トークンを付けて id の参加を禁止します。
+func (ts *testServer) ban(t *testing.T, id string, body interface{}) {
+	t.Helper()
+	admin := ts.AdminHandler()
+	path := "/admin/bans/" + id
+	if rec := serve(t, admin, "PUT", path, body, confirmedHeader(t, admin, "PUT", path, body)); rec.Code != http.StatusCreated && rec.Code != http.StatusOK {
+		t.Fatalf("ban %s: status %d: %s", id, rec.Code, rec.Body)
+	}
+}
+
+// bannedDetails は待機の開始が参加禁止の 403 で拒否されたことを確認し、エラーの details を返します。
+func bannedDetails(t *testing.T, ts *testServer, body interface{}) map[string]interface{} {
+	t.Helper()
+	rec := ts.do(t, "POST", "/matchmaking", body, nil)
+	if code := errorShape(t, rec, http.StatusForbidden); code != errCodePlayerBanned {
+		t.Fatalf("code = %q, want %q", code, errCodePlayerBanned)
+	}
+	var resp struct {
+		Error ErrorDetail `json:"error"`
+	}
+	decodeJSON(t, rec, &resp)
+	return resp.Error.Details
+}
+
+func TestBannedPlayerCannotQueue(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.PlayerRateLimit = ratelimit.Config{} })
+	if rec := serve(t, ts.AdminHandler(), "PUT", "/admin/bans/alice", map[string]int{"duration_seconds": 3600}, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without admin secret: status %d, want 401", rec.Code)
+	}
+	ts.ban(t, "alice", map[string]int{"duration_seconds": 3600})
+
+	details := bannedDetails(t, ts, map[string]interface{}{"id": "alice"})
+	if details["player_id"] != "alice" || details["until"] != ts.now().Add(time.Hour).Format(time.RFC3339) {
+		t.Fatalf("details = %v, want alice banned for an hour", details)
+	}
+	// パーティのメンバーのいずれかが禁止されていれば、パーティ全体を登録しない
+	bannedDetails(t, ts, map[string]interface{}{"party_id": "p1", "game_mode": "2v2", "players": []map[string]string{{"id": "bob"}, {"id": "alice"}}})
+	if ids := ts.queuedIDs(t); len(ids) != 0 {
+		t.Fatalf("queued = %v, want nobody", ids)
+	}
+
+	// 期限を過ぎた禁止は、削除しなくても無効になる
+	ts.clock.Advance(time.Hour)
+	ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+}
+
+func TestLiftBan(t *testing.T) {
+	ts := newTestServer(t, nil)
+	admin := ts.AdminHandler()
+	ts.ban(t, "alice", nil)
+	bannedDetails(t, ts, map[string]interface{}{"id": "alice"})
+
+	path := "/admin/bans/alice"
+	if rec := serve(t, admin, "DELETE", path, nil, confirmedHeader(t, admin, "DELETE", path, nil)); rec.Code != http.StatusNoContent {
+		t.Fatalf("unban: status %d: %s", rec.Code, rec.Body)
+	}
+	ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+
+	rec := serve(t, admin, "DELETE", path, nil, confirmedHeader(t, admin, "DELETE", path, nil))
+	if code := errorShape(t, rec, http.StatusNotFound); code != errCodeNotBanned {
+		t.Fatalf("unban twice: code = %q, want %q", code, errCodeNotBanned)
+	}
+}
+
+// 無期限の禁止は期限を返さず、理由を返す
+func TestPermanentBan(t *testing.T) {
+	ts := newTestServer(t, nil)
+	admin := ts.AdminHandler()
+	body := map[string]interface{}{"player_id": "alice", "reason": "cheating"}
+	rec := serve(t, admin, "POST", "/admin/bans", body, confirmedHeader(t, admin, "POST", "/admin/bans", body))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("ban: status %d: %s", rec.Code, rec.Body)
+	}
+
+	ts.clock.Advance(365 * 24 * time.Hour)
+	details := bannedDetails(t, ts, map[string]interface{}{"id": "alice"})
+	if _, ok := details["until"]; ok || details["reason"] != "cheating" {
+		t.Fatalf("details = %v, want the reason and no expiry", details)
+	}
+}
+
+// 期限（until）を指定した禁止は、期限を過ぎれば削除しなくても待機を始められる
+func TestExpiredBanAllowsQueueing(t *testing.T) {
+	ts := newTestServer(t, nil)
+	until := ts.now().Add(30 * time.Minute)
+	ts.ban(t, "alice", map[string]interface{}{"until": until, "reason": "toxicity"})
+	details := bannedDetails(t, ts, map[string]interface{}{"id": "alice"})
+	if details["until"] != until.Format(time.RFC3339) || details["reason"] != "toxicity" {
+		t.Fatalf("details = %v, want the expiry and the reason", details)
+	}
+
+	ts.clock.Advance(30 * time.Minute)
+	ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+}
+
+// 待機中のプレイヤーを禁止すると、待機キューから削除し、結果を待っているリクエストへすぐに removed_by_admin を返す
+func TestBanWhileQueuedEvicts(t *testing.T) {
+	ts := newTestServer(t, nil)
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+
+	ts.ban(t, "alice", map[string]interface{}{"reason": "cheating"})
+	rec := receive(t, alice)
+	if code := errorShape(t, rec, http.StatusConflict); code != errCodeRemovedByAdmin {
+		t.Fatalf("code = %q, want %q", code, errCodeRemovedByAdmin)
+	}
+	if ids := ts.queuedIDs(t); len(ids) != 0 {
+		t.Fatalf("queued = %v after the ban, want empty", ids)
+	}
+	bannedDetails(t, ts, map[string]interface{}{"id": "alice"})
+}
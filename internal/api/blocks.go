@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+)
+
+// playerBlock はプレイヤー（PlayerID）がマッチングを拒否した相手（BlockedID）です。
+type playerBlock struct {
+	PlayerID  string `json:"player_id"`
+	BlockedID string `json:"blocked_id"`
+}
+
+// blockRequest は POST /players/{id}/blocks のリクエストボディです。
+type blockRequest struct {
+	// PlayerID はブロックする相手のプレイヤーIDです。
+	PlayerID string `json:"player_id"`
+}
+
+// blockPlayerHandler は、プレイヤーがボディの player_id の相手とマッチングされないよう登録します。
+// 新しく登録した場合は 201、既に登録されている場合は 200 を返します。登録数が上限に達している場合は 409 を返します。
+// 既に2人とも待機中であっても、次のマッチングから組み合わせなくなります。
+func (s *Server) blockPlayerHandler(w http.ResponseWriter, r *http.Request) {
+	playerID, err := authorizedPlayerID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writePlayerMismatch(w)
+		return
+	}
+	var req blockRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+	if err := model.ValidateID("player_id", req.PlayerID, "player_id"); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+	if req.PlayerID == playerID {
+		writeQueueEntryError(w, &model.FieldError{Field: "player_id", Message: "a player cannot block themselves"})
+		return
+	}
+
+	created, err := s.Store.BlockPlayer(r.Context(), playerID, req.PlayerID, s.cfg.MaxBlocksPerPlayer)
+	if errors.Is(err, store.ErrBlockLimitReached) {
+		writeErrorResponse(w, http.StatusConflict, ErrorDetail{
+			Code:    errCodeBlockLimitReached,
+			Message: "Player has reached the maximum number of blocks",
+			Details: map[string]interface{}{"max": s.cfg.MaxBlocksPerPlayer},
+		})
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "ブロック登録エラー", "func", "blockPlayerHandler", "player_id", playerID, "blocked_id", req.PlayerID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("blocks").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to block player")
+		return
+	}
+	if created {
+		s.logger.InfoContext(r.Context(), "player blocked", "player_id", playerID, "blocked_id", req.PlayerID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	if err := json.NewEncoder(w).Encode(playerBlock{PlayerID: playerID, BlockedID: req.PlayerID}); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "blockPlayerHandler", "player_id", playerID, "error", err)
+	}
+}
+
+// unblockPlayerHandler はプレイヤーのブロックを解除します。登録されていない場合は 404 を返します。
+// 相手も同じプレイヤーをブロックしている場合は、そちらを解除するまで組み合わせません。
+func (s *Server) unblockPlayerHandler(w http.ResponseWriter, r *http.Request) {
+	playerID, err := authorizedPlayerID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writePlayerMismatch(w)
+		return
+	}
+	blockedID := r.PathValue("other_id")
+	err = s.Store.UnblockPlayer(r.Context(), playerID, blockedID)
+	if errors.Is(err, store.ErrNotBlocked) {
+		writeJSONError(w, http.StatusNotFound, errCodeNotBlocked, store.ErrNotBlocked.Error())
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "ブロック解除エラー", "func", "unblockPlayerHandler", "player_id", playerID, "blocked_id", blockedID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("blocks").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to unblock player")
+		return
+	}
+	s.logger.InfoContext(r.Context(), "player unblocked", "player_id", playerID, "blocked_id", blockedID)
+	w.WriteHeader(http.StatusNoContent)
+}
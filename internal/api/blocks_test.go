@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// block は id のプレイヤーが other をブロックし、ステータスコードを確認します。
+func (ts *testServer) block(t *testing.T, id, other string, status int) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := ts.do(t, "POST", "/players/"+id+"/blocks", map[string]string{"player_id": other}, nil)
+	if rec.Code != status {
+		t.Fatalf("%s blocks %s: status %d, want %d: %s", id, other, rec.Code, status, rec.Body)
+	}
+	return rec
+}
+
+func TestBlockEndpoints(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.MaxBlocksPerPlayer = 2
+		cfg.PlayerRateLimit = ratelimit.Config{}
+	})
+	var created playerBlock
+	decodeJSON(t, ts.block(t, "alice", "bob", http.StatusCreated), &created)
+	if created != (playerBlock{PlayerID: "alice", BlockedID: "bob"}) {
+		t.Fatalf("block = %+v, want alice blocking bob", created)
+	}
+	ts.block(t, "alice", "bob", http.StatusOK)
+
+	if code := errorShape(t, ts.do(t, "POST", "/players/alice/blocks", map[string]string{"player_id": "alice"}, nil), http.StatusBadRequest); code != errCodeInvalidRequest {
+		t.Fatalf("self block: code = %q, want %q", code, errCodeInvalidRequest)
+	}
+
+	// ブロックの登録数は MaxBlocksPerPlayer まで
+	ts.block(t, "alice", "carol", http.StatusCreated)
+	rec := ts.do(t, "POST", "/players/alice/blocks", map[string]string{"player_id": "dave"}, nil)
+	if code := errorShape(t, rec, http.StatusConflict); code != errCodeBlockLimitReached {
+		t.Fatalf("over the cap: code = %q, want %q", code, errCodeBlockLimitReached)
+	}
+	var resp struct {
+		Error ErrorDetail `json:"error"`
+	}
+	decodeJSON(t, rec, &resp)
+	if resp.Error.Details["max"] != float64(2) {
+		t.Fatalf("details = %v, want max 2", resp.Error.Details)
+	}
+
+	if rec := ts.do(t, "DELETE", "/players/alice/blocks/carol", nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("unblock: status %d: %s", rec.Code, rec.Body)
+	}
+	if code := errorShape(t, ts.do(t, "DELETE", "/players/alice/blocks/carol", nil, nil), http.StatusNotFound); code != errCodeNotBlocked {
+		t.Fatalf("unblock twice: code = %q, want %q", code, errCodeNotBlocked)
+	}
+	// 解除した分だけ新しくブロックできる
+	ts.block(t, "alice", "dave", http.StatusCreated)
+}
+
+// どちらか一方がもう一方をブロックしていれば組み合わせず、他の相手とはマッチングする
+func TestBlockedPlayersNotMatched(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		blocks [][2]string
+	}{
+		{"mutual", [][2]string{{"alice", "bob"}, {"bob", "alice"}}},
+		{"one way", [][2]string{{"bob", "alice"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t, func(cfg *Config) { cfg.PlayerRateLimit = ratelimit.Config{} })
+			for _, b := range tc.blocks {
+				ts.block(t, b[0], b[1], http.StatusCreated)
+			}
+			alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+			ts.waitQueued(t, 1)
+			ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+			ts.waitQueued(t, 2)
+			if cycle := ts.tick(t); cycle.Matched != 0 {
+				t.Fatalf("tick created %d sessions, want none for a blocked pair", cycle.Matched)
+			}
+
+			carol := ts.startEnqueue(t, map[string]interface{}{"id": "carol"})
+			ts.waitQueued(t, 3)
+			if cycle := ts.tick(t); cycle.Matched != 1 {
+				t.Fatalf("tick created %d sessions, want alice and carol matched", cycle.Matched)
+			}
+			for _, done := range []<-chan *httptest.ResponseRecorder{alice, carol} {
+				rec := receive(t, done)
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status %d: %s", rec.Code, rec.Body)
+				}
+				var session model.SessionResult
+				decodeJSON(t, rec, &session)
+				if ids := []string{session.Player1.ID, session.Player2.ID}; slices.Contains(ids, "bob") {
+					t.Fatalf("session players = %v, want bob left out", ids)
+				}
+			}
+			if ids := ts.queuedIDs(t); !slices.Equal(ids, []string{"bob"}) {
+				t.Fatalf("queued = %v, want bob still waiting", ids)
+			}
+		})
+	}
+}
+
+// 2人とも待機中にブロックした場合も、次のマッチングから組み合わせない。解除すればマッチングする
+func TestBlockWhileQueued(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.PlayerRateLimit = ratelimit.Config{} })
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+
+	ts.block(t, "alice", "bob", http.StatusCreated)
+	if cycle := ts.tick(t); cycle.Matched != 0 {
+		t.Fatalf("tick created %d sessions, want none after the block", cycle.Matched)
+	}
+
+	if rec := ts.do(t, "DELETE", "/players/alice/blocks/bob", nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("unblock: status %d: %s", rec.Code, rec.Body)
+	}
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1 after the unblock", cycle.Matched)
+	}
+	for _, done := range []<-chan *httptest.ResponseRecorder{alice, bob} {
+		if rec := receive(t, done); rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+	}
+}
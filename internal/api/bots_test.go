@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// 待機時間がしきい値を超えた1人だけのプレイヤーは、ボットとマッチングする
+func TestLonePlayerMatchedWithBot(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.Queue.BotFillAfter = 20 * time.Second })
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+
+	ts.clock.Advance(19 * time.Second)
+	if cycle := ts.tick(t); cycle.Matched != 0 {
+		t.Fatalf("tick before the threshold created %d sessions, want 0", cycle.Matched)
+	}
+	ts.clock.Advance(2 * time.Second)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick after the threshold created %d sessions, want 1", cycle.Matched)
+	}
+
+	rec := receive(t, alice)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var session model.SessionResult
+	decodeJSON(t, rec, &session)
+	if !session.Bots || len(session.Participants) != 2 {
+		t.Fatalf("session = %+v, want alice and a bot", session)
+	}
+	var player, bot model.Participant
+	for _, p := range session.Participants {
+		if p.IsBot {
+			bot = p
+		} else {
+			player = p
+		}
+	}
+	if player.ID != "alice" || bot.ID == "" || bot.Team == player.Team {
+		t.Fatalf("participants = %+v, want alice against a bot", session.Participants)
+	}
+	if d := model.RatingDistance(bot.Rating, player.Rating); d > 50 {
+		t.Errorf("bot rating %d is %d away from alice's %d", bot.Rating, d, player.Rating)
+	}
+	// ボットは承諾を待たない
+	if bot.ReadyState != model.ReadyAccepted {
+		t.Errorf("bot ready state = %q, want %q", bot.ReadyState, model.ReadyAccepted)
+	}
+}
+
+// BOT_FILL_AFTER を指定しなければボットを使わない
+func TestBotFillOffByDefault(t *testing.T) {
+	ts := newTestServer(t, nil)
+	if ts.cfg.Queue.BotFillAfter != 0 {
+		t.Fatalf("BotFillAfter = %v by default, want off", ts.cfg.Queue.BotFillAfter)
+	}
+	ts.startEnqueue(t, map[string]interface{}{"id": "alice", "max_lifetime_seconds": 120})
+	ts.waitQueued(t, 1)
+	ts.clock.Advance(time.Minute)
+	if cycle := ts.tick(t); cycle.Matched != 0 {
+		t.Fatalf("tick created %d sessions without bot fill, want 0", cycle.Matched)
+	}
+}
+
+// ボットとの対戦結果は、ボット以外のプレイヤーのレーティングも変更しない
+func TestBotMatchResultKeepsRating(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.Queue.BotFillAfter = 20 * time.Second })
+	ctx := context.Background()
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	ts.clock.Advance(21 * time.Second)
+	ts.tick(t)
+	var session model.SessionResult
+	decodeJSON(t, receive(t, alice), &session)
+	if _, err := ts.resolveReadyCheck(ctx, session.SessionID, "alice", model.ReadyAccepted); err != nil {
+		t.Fatal(err)
+	}
+	before, err := ts.store.GetPlayerProfile(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.reportResult(ctx, session.SessionID, model.OutcomeWin, teamOf(session, "alice")); err != nil {
+		t.Fatal(err)
+	}
+	after, err := ts.store.GetPlayerProfile(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Rating != before.Rating {
+		t.Errorf("alice rating %d -> %d after beating a bot, want unchanged", before.Rating, after.Rating)
+	}
+}
+
+// teamOf はセッションの参加者 id のチームを返します。
+func teamOf(session model.SessionResult, id string) int {
+	for _, p := range session.Participants {
+		if p.ID == id {
+			return p.Team
+		}
+	}
+	return 0
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// テストの時計は 2030 年から始まるため、壁時計（time.Now）を使う箇所があれば時刻が大きくずれる
+func TestEnqueueUsesAppClock(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.clock.Advance(42 * time.Second)
+	now := ts.clock.Now()
+
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+
+	rows, err := ts.store.ListQueuedPlayers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if !row.WaitingSince.Equal(now) {
+			t.Errorf("%s waiting_since = %v, want the app clock %v", row.ID, row.WaitingSince, now)
+		}
+		if !row.ExpiresAt.After(now) || row.ExpiresAt.After(now.Add(time.Hour)) {
+			t.Errorf("%s expires_at = %v, want shortly after the app clock %v", row.ID, row.ExpiresAt, now)
+		}
+	}
+
+	// 壁時計で期限を計算していれば、待機中のリクエストは期限切れとして扱われマッチングされない
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+	receive(t, alice)
+	receive(t, bob)
+}
+
+// SSE で timeout_seconds を指定しない場合の待機時間も、アプリの時計から有効期限までの時間で決める
+func TestStreamWaitUsesAppClock(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		req := httptest.NewRequestWithContext(ctx, "GET", "/matchmaking/stream?player_id=alice&max_lifetime_seconds=120", nil)
+		rec := httptest.NewRecorder()
+		ts.ServeHTTP(rec, req)
+		done <- rec
+	}()
+	ts.waitQueued(t, 1)
+	cancel()
+
+	rec := receive(t, done)
+	if got := rec.Header().Get("X-Matchmaking-Timeout"); got != "120" {
+		t.Fatalf("X-Matchmaking-Timeout = %q, want 120 (the lifetime measured on the app clock)", got)
+	}
+}
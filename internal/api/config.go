@@ -0,0 +1,199 @@
+package api
+
+import (
+	"net/netip"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/ratelimit"
+	"matchmaking_project/internal/secret"
+)
+
+// Config は API サーバの設定です。main で環境変数から組み立て、NewServer に渡します。
+type Config struct {
+	// Queue はマッチングの条件（ゲームモード・待機時間・ボットなど）です。
+	Queue queue.Config
+	// RatingSeeds は新規プレイヤーのレーティングの初期値です（self_reported_skill の検証とレーティングの減衰に使います）。
+	RatingSeeds model.RatingSeeds
+	// Build は GET /version で返すビルドの情報です。
+	Build Build
+	// Now はアプリの時計です。マッチング・待機時間・期限の判定はこの時刻で行います（store.Config.Now と同じ時計を渡します）。
+	Now func() time.Time
+
+	// APIKeys は API キーと、そのキーを使うサービス名の対応です。空の場合は認証を行いません。
+	APIKeys map[string]string
+	// AdminSecret は管理用エンドポイントの共有シークレットです（環境変数 ADMIN_SECRET）。
+	// 空の場合は管理用エンドポイントへのリクエストをすべて拒否します。
+	AdminSecret string
+	// MountAdmin は管理用エンドポイントを Server の http.Handler にも登録するかどうかです（ADMIN_ADDR が未指定の場合）。
+	// 別のポートで公開する場合は false にして AdminHandler を使います。
+	MountAdmin bool
+	// AdminConfirmationTTL は破壊的な管理操作の dry_run で発行した確認トークンの有効期間です（環境変数 ADMIN_CONFIRMATION_TTL）。
+	AdminConfirmationTTL time.Duration
+	// PlayerTokenKeys はプレイヤーのトークンを検証する鍵です（環境変数 PLAYER_TOKEN_SECRET）。nil の場合は本人確認を行いません。
+	PlayerTokenKeys *secret.KeyRing
+	// ResumeTokenKeys は再開用のトークンの署名鍵です（環境変数 RESUME_TOKEN_SECRET、カンマ区切りで鍵の入れ替えに対応）。
+	// 再起動の前後で同じ鍵を使う必要があります。nil の場合はトークンを発行せず、サーバの停止時は従来どおり待機キューから削除します。
+	ResumeTokenKeys *secret.KeyRing
+	// MatchTokenKeys はマッチトークンの署名鍵です（環境変数 MATCH_TOKEN_SECRET、カンマ区切りで鍵の入れ替えに対応）。
+	// ゲームサーバが GET /sessions/verify を使わずに VerifyToken で検証する場合も同じ鍵を使います。nil の場合はトークンを発行しません。
+	MatchTokenKeys *secret.KeyRing
+
+	// BasePath は全てのルートの前に付けるパスです（環境変数 BASE_PATH、例: "/api/matchmaking"）。
+	// リバースプロキシがパスを書き換えずに転送する場合に使います。空文字の場合は付けません。
+	BasePath string
+	// TrustedProxies は転送ヘッダー（X-Forwarded-For・X-Real-IP・X-Forwarded-Proto・X-Forwarded-Host）を信頼するプロキシのアドレス範囲です（環境変数 TRUSTED_PROXIES）。
+	// 空の場合はどの接続元の転送ヘッダーも使いません（クライアントが偽装できるため）。
+	TrustedProxies []netip.Prefix
+	// CORS は CORS の設定です
+	// （環境変数 CORS_ALLOWED_ORIGINS / CORS_ALLOWED_METHODS / CORS_ALLOWED_HEADERS / CORS_MAX_AGE / CORS_ALLOW_CREDENTIALS）。
+	CORS corsOptions
+
+	// HTTPReadHeaderTimeout はリクエストヘッダーの読み込みの期限です。
+	HTTPReadHeaderTimeout time.Duration
+	// HTTPReadTimeout はリクエストボディを含むリクエスト全体の読み込みの期限です。ボディは小さいため短くします。
+	HTTPReadTimeout time.Duration
+	// HTTPIdleTimeout は keep-alive の接続が次のリクエストを待つ期限です。
+	HTTPIdleTimeout time.Duration
+	// HTTPWriteTimeout はリクエストヘッダーの読み込み後、レスポンスを書き終えるまでの期限です。
+	// 0 の場合は long-poll の最長の待機時間（queue.Config.LongestTimeout。既定の待機時間・ゲームモードの待機時間・MATCHMAKING_TIMEOUT_MAX のうち最長）に
+	// httpWriteTimeoutMargin を加えた値を使います。MATCHMAKING_TIMEOUT_MAX だけを基準にすると、それより長い既定の待機時間（30秒）の long-poll が
+	// 待機後のタイムアウトのレスポンスを書けずに切断されるためです。
+	// 待機後の結果は writeLongPollResponse が、SSE はイベントごとに書き込み期限を設定し直します。
+	HTTPWriteTimeout time.Duration
+	// HTTPMaxHeaderBytes はリクエストヘッダーの最大サイズです。
+	HTTPMaxHeaderBytes int
+
+	// PlayerRateLimit はプレイヤーごとの制限です（環境変数 RATE_LIMIT_PLAYER_RPS / RATE_LIMIT_PLAYER_BURST）。
+	// 通常のクライアントは待機の開始をタイムアウトごとにしか行わないため、低く設定します。
+	PlayerRateLimit ratelimit.Config
+	// IPRateLimit は接続元 IP アドレスごとの制限です（環境変数 RATE_LIMIT_IP_RPS / RATE_LIMIT_IP_BURST）。
+	// NAT の背後に複数のプレイヤーがいることを考慮して高めに設定します。
+	IPRateLimit ratelimit.Config
+	// IdempotencyTTL は完了したリクエストのレスポンスを保存しておく時間です（環境変数 IDEMPOTENCY_TTL）。0 の場合は Idempotency-Key を無視します。
+	IdempotencyTTL time.Duration
+
+	// LeaderboardMaxLimit は GET /leaderboard の limit の上限です。超えた値は上限に切り詰めます。
+	// 環境変数 LEADERBOARD_MAX_LIMIT で変更できます。
+	LeaderboardMaxLimit int
+	// LeaderboardCacheTTL は、アクセスが集中した場合に MySQL へ負荷をかけないよう、ランキングのページを保存しておく時間です（環境変数 LEADERBOARD_CACHE_TTL）。
+	// 0 の場合は保存しません。
+	LeaderboardCacheTTL time.Duration
+	// MatchResultWindow は、再接続したプレイヤーに返す成立済みのセッションの対象期間です（環境変数 MATCH_RESULT_WINDOW）。
+	// この時間より前に成立したセッションは、クライアントが既に結果を受け取ったか、放棄したものとみなします。
+	MatchResultWindow time.Duration
+	// MaxBlocksPerPlayer はプレイヤーごとに登録できるブロックの上限です（環境変数 MAX_BLOCKS_PER_PLAYER）。
+	// マッチングのたびに待機中のプレイヤーのブロックを読み込むため、1人あたりの件数を制限します。
+	MaxBlocksPerPlayer int
+	// MaxSpectatorsPerSession はセッションごとに登録できる観戦者の上限です（環境変数 MAX_SPECTATORS_PER_SESSION）。
+	MaxSpectatorsPerSession int
+	// MaxConcurrentEnqueues は待機キューへの登録（参加禁止の確認と DB への登録）を同時に行うリクエスト数の上限です（環境変数 MAX_CONCURRENT_ENQUEUES）。
+	// アクセスが集中した場合に、DB の接続を待つリクエストが際限なく増えないようにするためのものです。0 以下の場合は制限しません。
+	MaxConcurrentEnqueues int
+	// MaxQueueSize は待機キューに登録できるプレイヤー数の上限です（store.Config.MaxQueueSize と同じ値）。
+	// 待機キューが満杯の場合のレスポンスに含めます。
+	MaxQueueSize int
+	// MaxEntryLifetime は待機キューのエントリの有効期間の上限です（環境変数 MAX_ENTRY_LIFETIME）。
+	// クライアントが申告した有効期間（max_lifetime_seconds）がこれより長い場合や、申告がない場合はこの値を使います。
+	MaxEntryLifetime time.Duration
+	// StaleEntryAge は、待機を続けているクライアントがいないエントリを待機キューから削除するまでの待機時間です（環境変数 STALE_ENTRY_AGE）。
+	// 待機中にプロセスが停止するとタイムアウト時の削除が行われず、有効期限までエントリが残るため、それより早く削除します。
+	// 最も長い待機時間（queue.Config.LongestTimeout）より長くします。0 以下の場合は削除しません。
+	StaleEntryAge time.Duration
+	// SoftTimeoutMaxWait は keep_waiting を指定したクライアントが待機を続けられる上限です（環境変数 SOFT_TIMEOUT_MAX_WAIT）。
+	// 待機開始からこの時間を過ぎると、通常のタイムアウトと同じく待機キューから削除して 504 を返します。0 の場合は keep_waiting を無視します。
+	SoftTimeoutMaxWait time.Duration
+	// TrustClientRating は POST /matchmaking のリクエストの rating を信頼して、プレイヤーのレーティングを上書きするかどうかです（環境変数 TRUST_CLIENT_RATING、既定は無効）。
+	// 本人確認なしにレーティングを変えられるため、ローカルでの検証用です。無効の場合、rating は無視して DB のレーティング（未登録なら初期レーティング）を使います。
+	TrustClientRating bool
+	// NoShowPenalty は、承諾しなかった、またはゲームサーバがゲームに現れなかったと報告したプレイヤーのマッチングへの参加を禁止する時間です（環境変数 NO_SHOW_PENALTY）。
+	// 0 の場合は禁止しません。禁止は参加禁止（PUT /admin/bans）と同じ仕組みで、理由は noShowBanReason です。
+	NoShowPenalty time.Duration
+	// TimeoutHints はキュー（ゲームモード）ごと・言語ごとのタイムアウト時のヒントです（LoadTimeoutHints）。
+	TimeoutHints TimeoutHints
+
+	// ProcessorInterval はマッチングプロセッサーが待機キューを確認する間隔です（環境変数 PROCESSOR_INTERVAL）。
+	// このインスタンスで待機キューへの登録があった場合は、間隔を待たずに確認します（wakeMatcher）。
+	ProcessorInterval time.Duration
+	// TickTimeout はマッチングプロセッサーなどのバックグラウンド処理が1回の処理で DB を待つ時間の上限です（環境変数 TICK_TIMEOUT）。
+	// 応答しない DB で処理が止まり続けないよう、期限を過ぎた処理はロールバックして次回に再試行します。
+	TickTimeout time.Duration
+	// NotifyConcurrency はマッチング結果を同時に通知する数の上限です（環境変数 NOTIFY_CONCURRENCY）。
+	NotifyConcurrency int
+	// SessionAllocatorTimeout はゲームサーバの割り当て・解放1回の待ち時間の上限です（環境変数 SESSION_ALLOCATOR_TIMEOUT）。
+	// 割り当ての間は待機キューをロックしているため、マッチングの間隔やロックの有効期間（MATCHER_LOCK_TTL）より短くします。
+	SessionAllocatorTimeout time.Duration
+	// AcceptWindow はマッチング成立後、参加者が承諾するまでの猶予時間です（環境変数 ACCEPT_WINDOW）。
+	// 有効期限が近いエントリをマッチングしない余裕とマッチトークンの有効期間にも使います。
+	AcceptWindow time.Duration
+	// SessionTTL は確定したセッションを、結果が報告されないまま終了したもの（expired）とみなすまでの時間です（環境変数 SESSION_TTL）。
+	SessionTTL time.Duration
+	// SessionRetention は終了した（expired・aborted の）セッションを削除するまでの保存期間です（環境変数 SESSION_RETENTION）。
+	// 0 以下の場合は削除しません（既定）。
+	SessionRetention time.Duration
+	// SessionSweepInterval はセッションの期限切れ・削除を確認する間隔です（環境変数 SESSION_SWEEP_INTERVAL）。
+	SessionSweepInterval time.Duration
+	// StatsStreamInterval は GET /stats/stream でスナップショットを送る間隔です（環境変数 STATS_STREAM_INTERVAL）。
+	StatsStreamInterval time.Duration
+	// WaitStatsRatingBands は GET /admin/stats/waits でレーティング帯を区切る境界です（環境変数 WAIT_STATS_RATING_BANDS）。
+	// 境界の値はその上の帯に含めます。
+	WaitStatsRatingBands []int
+
+	// RatingDecayInactiveDays はレーティングを減衰させるまでの、対戦していない日数です（環境変数 RATING_DECAY_INACTIVE_DAYS）。
+	// 0 の場合は減衰させません（既定）。
+	RatingDecayInactiveDays int
+	// RatingDecayFactor は1回の減衰で、レーティングと初期レーティング（RatingSeeds.Default）の差を縮める割合です（環境変数 RATING_DECAY_FACTOR）。
+	RatingDecayFactor float64
+	// RatingDecayInterval はレーティングを減衰させる間隔です（環境変数 RATING_DECAY_INTERVAL）。
+	RatingDecayInterval time.Duration
+
+	// Flags は機能フラグです。store.Config.ExplainCapture などサーバの生成前に参照する場合は NewFeatureFlags で生成して渡します。
+	// nil の場合は NewServer が既定値で生成します。
+	Flags *featureFlags
+}
+
+// DefaultConfig は環境変数を指定しない場合の Config を返します。
+func DefaultConfig() Config {
+	q := queue.DefaultConfig()
+	return Config{
+		Queue:       q,
+		RatingSeeds: model.DefaultRatingSeeds(),
+		Build:       Build{Version: "unknown", Commit: "unknown", Time: "unknown"},
+		Now:         time.Now,
+		MountAdmin:  true,
+		CORS: corsOptions{
+			AllowedMethods: []string{"GET", "POST", "DELETE", "OPTIONS"},
+			AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key", "X-Request-ID"},
+			MaxAge:         10 * time.Minute,
+		},
+		AdminConfirmationTTL:    2 * time.Minute,
+		HTTPReadHeaderTimeout:   5 * time.Second,
+		HTTPReadTimeout:         15 * time.Second,
+		HTTPIdleTimeout:         120 * time.Second,
+		HTTPMaxHeaderBytes:      16 << 10,
+		PlayerRateLimit:         ratelimit.Config{RPS: 0.5, Burst: 3},
+		IPRateLimit:             ratelimit.Config{RPS: 5, Burst: 20},
+		IdempotencyTTL:          5 * time.Minute,
+		LeaderboardMaxLimit:     100,
+		LeaderboardCacheTTL:     5 * time.Second,
+		MatchResultWindow:       5 * time.Minute,
+		MaxBlocksPerPlayer:      100,
+		MaxSpectatorsPerSession: 10,
+		MaxEntryLifetime:        10 * time.Minute,
+		StaleEntryAge:           2 * q.LongestTimeout(),
+		SoftTimeoutMaxWait:      5 * time.Minute,
+		TimeoutHints:            DefaultTimeoutHints(),
+		ProcessorInterval:       1 * time.Second,
+		TickTimeout:             5 * time.Second,
+		NotifyConcurrency:       16,
+		SessionAllocatorTimeout: 3 * time.Second,
+		AcceptWindow:            10 * time.Second,
+		SessionTTL:              2 * time.Hour,
+		SessionSweepInterval:    time.Minute,
+		StatsStreamInterval:     5 * time.Second,
+		WaitStatsRatingBands:    []int{1000, 1200, 1400, 1600},
+		RatingDecayFactor:       0.1,
+		RatingDecayInterval:     24 * time.Hour,
+	}
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+)
+
+// adminConfirmationHeader は破壊的な管理操作を実行するリクエストで、dry_run で発行した確認トークンを渡すヘッダーです。
+const adminConfirmationHeader = "X-Confirmation-Token"
+
+// adminConfirmationStateKey は発行済みの確認トークンを保存する service_state のキーです。
+// 値はトークンのハッシュから adminConfirmation への JSON で、インスタンス間で同時に更新されても失われないよう CAS で書き換えます。
+const adminConfirmationStateKey = "admin_confirmations"
+
+// adminConfirmationMaxAttempts は確認トークンの発行・消費で、他のリクエストとの CAS の競合を再試行する回数です。
+const adminConfirmationMaxAttempts = 5
+
+// 確認トークンが必要な管理操作です（監査イベントの details.operation）。
+const (
+	adminOpForceMatch = "force_match"
+	adminOpDequeue    = "dequeue"
+	adminOpBan        = "ban"
+	adminOpUnban      = "unban"
+)
+
+// errConfirmationBusy は他のリクエストと競合し続け、確認トークンを保存・消費できなかったことを表します。
+var errConfirmationBusy = errors.New("confirmation tokens are being updated by other requests; retry")
+
+// adminConfirmation は service_state に保存する発行済みの確認トークンです。トークンそのものは保存しません。
+type adminConfirmation struct {
+	Operation string `json:"operation"`
+	// ParamsHash は dry_run のリクエストの操作対象とパラメータのハッシュです。実行のリクエストと一致する必要があります。
+	ParamsHash string    `json:"params_hash"`
+	Actor      string    `json:"actor"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// dryRunResponse は dry_run のリクエストへのレスポンスです。
+type dryRunResponse struct {
+	DryRun    bool   `json:"dry_run"`
+	Operation string `json:"operation"`
+	// Summary は実行した場合に変更される対象です（操作ごとに異なる）。
+	Summary interface{} `json:"summary"`
+	// ConfirmationToken は同じパラメータで実行する場合に X-Confirmation-Token ヘッダーで渡すトークンです。ExpiresAt まで1回だけ使えます。
+	ConfirmationToken string    `json:"confirmation_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// confirmationError は実行のリクエストの確認トークンを受け付けなかった理由です。
+type confirmationError struct {
+	Code    string
+	Message string
+}
+
+func (e *confirmationError) Error() string { return e.Message }
+
+// dryRunParam は dry_run クエリパラメータを返します。
+func dryRunParam(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("dry_run")
+	if v == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, &model.FieldError{Field: "dry_run", Message: fmt.Sprintf("invalid dry_run: %v", err)}
+	}
+	return dryRun, nil
+}
+
+// adminParamsHash は操作と、操作対象を含むパラメータのハッシュを返します。
+func adminParamsHash(op string, params interface{}) string {
+	b, _ := json.Marshal(struct {
+		Operation string      `json:"operation"`
+		Params    interface{} `json:"params"`
+	}{op, params})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// confirmationTokenHash は service_state に保存する確認トークンのハッシュです。
+func confirmationTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// updateConfirmations は発行済みの確認トークンを update で書き換え、他のリクエストと競合した場合は読み直して再試行します。
+// 有効期限を過ぎたトークンは update の後に取り除きます（update には取り除く前のトークンを渡す）。
+func (s *Server) updateConfirmations(ctx context.Context, update func(map[string]adminConfirmation) error) error {
+	for range adminConfirmationMaxAttempts {
+		old, err := s.Store.GetServiceState(ctx, adminConfirmationStateKey)
+		if err != nil {
+			return err
+		}
+		tokens := map[string]adminConfirmation{}
+		if old != "" {
+			if err := json.Unmarshal([]byte(old), &tokens); err != nil {
+				// 読めない値は捨てて作り直す（発行済みのトークンは使えなくなる）
+				s.logger.ErrorContext(ctx, "確認トークンの読み込みエラー", "func", "updateConfirmations", "error", err)
+				tokens = map[string]adminConfirmation{}
+			}
+		}
+		if err := update(tokens); err != nil {
+			return err
+		}
+		now := s.now()
+		for h, c := range tokens {
+			if !now.Before(c.ExpiresAt) {
+				delete(tokens, h)
+			}
+		}
+		var next string
+		if len(tokens) > 0 {
+			b, err := json.Marshal(tokens)
+			if err != nil {
+				return err
+			}
+			next = string(b)
+		}
+		ok, err := s.Store.CompareAndSwapServiceState(ctx, adminConfirmationStateKey, old, next)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+	return errConfirmationBusy
+}
+
+// issueConfirmation は dry_run のリクエストに、summary と、同じ op・params の実行にだけ使える確認トークンを返します。
+// dry_run のリクエストも監査イベントに記録します（subjects は操作対象のプレイヤー）。
+func (s *Server) issueConfirmation(w http.ResponseWriter, r *http.Request, op string, subjects []string, params, summary interface{}) {
+	b := make([]byte, 32)
+	// crypto/rand.Read は失敗しない（失敗した場合はプロセスを終了する）
+	rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+	c := adminConfirmation{
+		Operation:  op,
+		ParamsHash: adminParamsHash(op, params),
+		Actor:      auditActor(r.Context(), auditActorSystem),
+		ExpiresAt:  s.now().Add(s.cfg.AdminConfirmationTTL),
+	}
+	err := s.updateConfirmations(r.Context(), func(tokens map[string]adminConfirmation) error {
+		tokens[confirmationTokenHash(token)] = c
+		return nil
+	})
+	if err != nil {
+		s.writeConfirmationError(w, r, op, err)
+		return
+	}
+	s.logger.InfoContext(r.Context(), "admin dry run", "operation", op, "subjects", subjects, "expires_at", c.ExpiresAt)
+	s.auditAdminOperation(r.Context(), auditDryRun, subjects, map[string]interface{}{"operation": op, "params": params, "expires_at": c.ExpiresAt})
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dryRunResponse{DryRun: true, Operation: op, Summary: summary, ConfirmationToken: token, ExpiresAt: c.ExpiresAt}); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "issueConfirmation", "operation", op, "error", err)
+	}
+}
+
+// confirmAdminAction は実行のリクエストの確認トークンを消費し、同じ op・params の dry_run で有効期限内に発行されたものであれば true を返します。
+// 受け付けない場合はエラーを返して監査イベントに記録し、false を返します。
+// 同時に同じトークンで実行されても一方だけが実行するよう、検証の前に消費します（一致しなかったトークンも使えなくなる）。
+func (s *Server) confirmAdminAction(w http.ResponseWriter, r *http.Request, op string, subjects []string, params interface{}) bool {
+	token := r.Header.Get(adminConfirmationHeader)
+	if token == "" {
+		s.rejectConfirmation(w, r, op, subjects, http.StatusPreconditionRequired, &confirmationError{
+			Code:    errCodeConfirmationRequired,
+			Message: "This operation requires a confirmation token; call it with dry_run=true first and send the token in the " + adminConfirmationHeader + " header",
+		})
+		return false
+	}
+	var c adminConfirmation
+	found := false
+	err := s.updateConfirmations(r.Context(), func(tokens map[string]adminConfirmation) error {
+		h := confirmationTokenHash(token)
+		c, found = tokens[h]
+		delete(tokens, h)
+		return nil
+	})
+	if err != nil {
+		s.writeConfirmationError(w, r, op, err)
+		return false
+	}
+	var rejected *confirmationError
+	switch {
+	case !found:
+		rejected = &confirmationError{Code: errCodeConfirmationInvalid, Message: "Confirmation token is unknown or has already been used"}
+	case !s.now().Before(c.ExpiresAt):
+		rejected = &confirmationError{Code: errCodeConfirmationExpired, Message: "Confirmation token has expired; run dry_run again"}
+	case c.Operation != op || c.ParamsHash != adminParamsHash(op, params):
+		rejected = &confirmationError{Code: errCodeConfirmationMismatch, Message: "Confirmation token was issued for different parameters; run dry_run again"}
+	}
+	if rejected != nil {
+		s.rejectConfirmation(w, r, op, subjects, http.StatusConflict, rejected)
+		return false
+	}
+	return true
+}
+
+// rejectConfirmation は受け付けなかった実行のリクエストを監査イベントに記録してエラーを返します。
+func (s *Server) rejectConfirmation(w http.ResponseWriter, r *http.Request, op string, subjects []string, status int, e *confirmationError) {
+	s.logger.InfoContext(r.Context(), "admin operation rejected", "operation", op, "subjects", subjects, "reason", e.Code)
+	s.auditAdminOperation(r.Context(), auditConfirmationRejected, subjects, map[string]interface{}{"operation": op, "reason": e.Code})
+	writeJSONError(w, status, e.Code, e.Message)
+}
+
+// writeConfirmationError は確認トークンを保存・消費できなかったリクエストへエラーを返します。
+func (s *Server) writeConfirmationError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	if errors.Is(err, errConfirmationBusy) {
+		writeJSONError(w, http.StatusServiceUnavailable, errCodeServerBusy, err.Error())
+		return
+	}
+	s.logger.ErrorContext(r.Context(), "確認トークンの更新エラー", "func", "writeConfirmationError", "operation", op, "error", err)
+	metrics.HandlerErrors.WithLabelValues("admin").Inc()
+	writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update confirmation tokens")
+}
+
+// auditAdminOperation は操作対象のプレイヤーごとに管理操作の監査イベントを記録します。対象がない場合は1件だけ記録します。
+func (s *Server) auditAdminOperation(ctx context.Context, action string, subjects []string, details map[string]interface{}) {
+	actor := auditActor(ctx, auditActorSystem)
+	if len(subjects) == 0 {
+		s.recordAudit(ctx, []store.AuditEvent{{Actor: actor, Action: action, Details: details}})
+		return
+	}
+	events := make([]store.AuditEvent, len(subjects))
+	for i, id := range subjects {
+		events[i] = store.AuditEvent{Actor: actor, Action: action, SubjectPlayerID: id, Details: details}
+	}
+	s.recordAudit(ctx, events)
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/store"
+)
+
+// dryRun は path へ dry_run=true のリクエストを送り、レスポンスを返します。
+func dryRun(t *testing.T, h http.Handler, method, path string, body interface{}) dryRunResponse {
+	t.Helper()
+	rec := serve(t, h, method, path+"?dry_run=true", body, adminHeader())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s %s?dry_run=true = %d: %s", method, path, rec.Code, rec.Body)
+	}
+	var resp dryRunResponse
+	decodeJSON(t, rec, &resp)
+	if !resp.DryRun || resp.ConfirmationToken == "" {
+		t.Fatalf("dry run response = %+v, want a confirmation token", resp)
+	}
+	return resp
+}
+
+// confirmedHeader は dry_run で発行した確認トークンを付けた管理用のヘッダーを返します。
+func confirmedHeader(t *testing.T, h http.Handler, method, path string, body interface{}) http.Header {
+	t.Helper()
+	header := adminHeader()
+	header.Set(adminConfirmationHeader, dryRun(t, h, method, path, body).ConfirmationToken)
+	return header
+}
+
+// auditActions は記録された監査イベントの操作を順に返します。
+func (ts *testServer) auditActions(t *testing.T) []string {
+	t.Helper()
+	events, err := ts.store.ListAuditEvents(context.Background(), store.AuditQuery{Limit: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := make([]string, len(events))
+	for i, e := range events {
+		actions[i] = e.Action
+	}
+	return actions
+}
+
+func TestAdminDequeueRequiresConfirmation(t *testing.T) {
+	ts := newTestServer(t, nil)
+	admin := ts.AdminHandler()
+	ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+
+	if rec := serve(t, admin, "DELETE", "/admin/queue/alice", nil, adminHeader()); rec.Code != http.StatusPreconditionRequired {
+		t.Fatalf("without a token: status %d, want 428: %s", rec.Code, rec.Body)
+	}
+	resp := dryRun(t, admin, "DELETE", "/admin/queue/alice", nil)
+	if resp.Operation != adminOpDequeue || !resp.ExpiresAt.Equal(ts.now().Add(ts.cfg.AdminConfirmationTTL)) {
+		t.Fatalf("dry run = %+v, want dequeue expiring after the TTL", resp)
+	}
+	// dry_run では削除しない
+	if got := ts.queuedIDs(t); len(got) != 1 {
+		t.Fatalf("queued after dry run = %v, want alice to remain", got)
+	}
+
+	header := adminHeader()
+	header.Set(adminConfirmationHeader, resp.ConfirmationToken)
+	if rec := serve(t, admin, "DELETE", "/admin/queue/alice", nil, header); rec.Code != http.StatusNoContent {
+		t.Fatalf("with the token: status %d, want 204: %s", rec.Code, rec.Body)
+	}
+	ts.waitQueued(t, 0)
+
+	want := []string{auditQueued, auditConfirmationRejected, auditDryRun, auditRemovedByAdmin}
+	if got := ts.auditActions(t); !slices.Equal(got, want) {
+		t.Fatalf("audit actions = %v, want %v", got, want)
+	}
+	if state, _ := ts.store.GetServiceState(context.Background(), adminConfirmationStateKey); state != "" {
+		t.Errorf("confirmation state after use = %q, want it removed", state)
+	}
+}
+
+func TestConfirmationTokenIsSingleUse(t *testing.T) {
+	ts := newTestServer(t, nil)
+	admin := ts.AdminHandler()
+	body := map[string]interface{}{"reason": "cheating"}
+
+	header := confirmedHeader(t, admin, "PUT", "/admin/bans/alice", body)
+	if rec := serve(t, admin, "PUT", "/admin/bans/alice", body, header); rec.Code != http.StatusCreated {
+		t.Fatalf("first use: status %d, want 201: %s", rec.Code, rec.Body)
+	}
+	rec := serve(t, admin, "PUT", "/admin/bans/alice", body, header)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("reuse: status %d, want 409: %s", rec.Code, rec.Body)
+	}
+	var e ErrorResponse
+	decodeJSON(t, rec, &e)
+	if e.Error.Code != errCodeConfirmationInvalid {
+		t.Fatalf("reuse: code %q, want %q", e.Error.Code, errCodeConfirmationInvalid)
+	}
+}
+
+// 同じトークンで同時に実行しても、一方だけが実行する（CAS の再試行の回数を超えて競合しない数で送る）
+func TestConfirmationTokenConcurrentUse(t *testing.T) {
+	ts := newTestServer(t, nil)
+	admin := ts.AdminHandler()
+	if rec := serve(t, admin, "PUT", "/admin/bans/alice", nil, confirmedHeader(t, admin, "PUT", "/admin/bans/alice", nil)); rec.Code != http.StatusCreated {
+		t.Fatalf("ban: status %d: %s", rec.Code, rec.Body)
+	}
+
+	header := confirmedHeader(t, admin, "DELETE", "/admin/bans/alice", nil)
+	codes := make([]int, adminConfirmationMaxAttempts-1)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = serve(t, admin, "DELETE", "/admin/bans/alice", nil, header).Code
+		}()
+	}
+	wg.Wait()
+	executed := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusNoContent:
+			executed++
+		case http.StatusConflict:
+		default:
+			t.Errorf("status %d, want 204 or 409", code)
+		}
+	}
+	if executed != 1 {
+		t.Fatalf("executed %d times, want once (statuses %v)", executed, codes)
+	}
+}
+
+func TestConfirmationTokenBoundToParameters(t *testing.T) {
+	ts := newTestServer(t, nil)
+	admin := ts.AdminHandler()
+
+	for _, tc := range []struct {
+		name         string
+		method, path string
+		body         interface{}
+	}{
+		{"different duration", "PUT", "/admin/bans/alice", map[string]interface{}{"duration_seconds": 3600}},
+		{"different player", "PUT", "/admin/bans/bob", map[string]interface{}{"duration_seconds": 60}},
+		{"different operation", "DELETE", "/admin/bans/alice", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			header := confirmedHeader(t, admin, "PUT", "/admin/bans/alice", map[string]interface{}{"duration_seconds": 60})
+			rec := serve(t, admin, tc.method, tc.path, tc.body, header)
+			if rec.Code != http.StatusConflict {
+				t.Fatalf("status %d, want 409: %s", rec.Code, rec.Body)
+			}
+			var e ErrorResponse
+			decodeJSON(t, rec, &e)
+			if e.Error.Code != errCodeConfirmationMismatch {
+				t.Fatalf("code %q, want %q", e.Error.Code, errCodeConfirmationMismatch)
+			}
+			// 一致しなかったトークンは使えなくなる
+			if rec := serve(t, admin, "PUT", "/admin/bans/alice", map[string]interface{}{"duration_seconds": 60}, header); rec.Code != http.StatusConflict {
+				t.Fatalf("after a mismatch: status %d, want 409", rec.Code)
+			}
+		})
+	}
+	if _, banned, _ := ts.store.ActiveBan(context.Background(), []string{"alice", "bob"}, ts.now()); banned {
+		t.Fatal("a mismatched token banned a player")
+	}
+
+	// POST /admin/bans と PUT /admin/bans/{player_id} は同じ禁止の指定であれば同じパラメータとみなす
+	header := confirmedHeader(t, admin, "POST", "/admin/bans", map[string]interface{}{"player_id": "alice"})
+	if rec := serve(t, admin, "PUT", "/admin/bans/alice", nil, header); rec.Code != http.StatusCreated {
+		t.Fatalf("PUT with a POST token: status %d, want 201: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestConfirmationTokenExpires(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.AdminConfirmationTTL = time.Minute })
+	admin := ts.AdminHandler()
+	ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	body := map[string]interface{}{"player_ids": []string{"alice", "bob"}}
+
+	resp := dryRun(t, admin, "POST", "/admin/match", body)
+	summary, _ := resp.Summary.(map[string]interface{})
+	if players, _ := summary["players"].([]interface{}); len(players) != 2 {
+		t.Fatalf("summary = %v, want the two queued players", resp.Summary)
+	}
+	ts.clock.Advance(time.Minute)
+	header := adminHeader()
+	header.Set(adminConfirmationHeader, resp.ConfirmationToken)
+	rec := serve(t, admin, "POST", "/admin/match", body, header)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expired token: status %d, want 409: %s", rec.Code, rec.Body)
+	}
+	var e ErrorResponse
+	decodeJSON(t, rec, &e)
+	if e.Error.Code != errCodeConfirmationExpired {
+		t.Fatalf("code %q, want %q", e.Error.Code, errCodeConfirmationExpired)
+	}
+	if got := ts.queuedIDs(t); len(got) != 2 {
+		t.Fatalf("queued after an expired token = %v, want both players to remain", got)
+	}
+
+	// 使われなかった期限切れのトークンは、次に発行するときに取り除く
+	dryRun(t, admin, "POST", "/admin/match", body)
+	ts.clock.Advance(time.Minute)
+	header = confirmedHeader(t, admin, "POST", "/admin/match", body)
+	if rec := serve(t, admin, "POST", "/admin/match", body, header); rec.Code != http.StatusCreated {
+		t.Fatalf("fresh token: status %d, want 201: %s", rec.Code, rec.Body)
+	}
+	if state, _ := ts.store.GetServiceState(context.Background(), adminConfirmationStateKey); state != "" {
+		t.Errorf("confirmation state = %q, want expired tokens removed", state)
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+)
+
+// クールダウンの理由です（matchmaking_cooldowns_total のラベルと監査イベントの reason に使います）。
+const (
+	cooldownDeclined      = "declined"
+	cooldownNoShow        = "no_show"
+	cooldownAcceptTimeout = "accept_timeout"
+	cooldownAbandoned     = "abandoned"
+)
+
+// playerCooldownError はクールダウン中のプレイヤー（パーティの場合はメンバーのいずれか）が待機キューへ登録しようとした場合のエラーです。
+type playerCooldownError struct {
+	Cooldown store.PlayerCooldown
+}
+
+func (e *playerCooldownError) Error() string {
+	return fmt.Sprintf("player %s is on matchmaking cooldown until %s", e.Cooldown.PlayerID, e.Cooldown.Until.Format(time.RFC3339))
+}
+
+// checkCooldowns はエントリのメンバーのいずれかが now の時点でクールダウン中であれば playerCooldownError を返します。
+func (s *Server) checkCooldowns(ctx context.Context, entry model.QueueEntry, now time.Time) error {
+	ids := make([]string, len(entry.Players))
+	for i, p := range entry.Players {
+		ids[i] = p.ID
+	}
+	cooldown, active, err := s.Store.ActiveCooldown(ctx, ids, now)
+	if err != nil {
+		return fmt.Errorf("クールダウンの確認エラー: %v", err)
+	}
+	if active {
+		return &playerCooldownError{Cooldown: cooldown}
+	}
+	return nil
+}
+
+// writePlayerCooldown はクールダウン中のプレイヤーのリクエストへ、Retry-After ヘッダー（秒単位に切り上げ）付きの 403 を返します。
+func writePlayerCooldown(w http.ResponseWriter, e *playerCooldownError, now time.Time) {
+	seconds := max(int(math.Ceil(e.Cooldown.Until.Sub(now).Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeErrorResponse(w, http.StatusForbidden, ErrorDetail{
+		Code:    errCodeMatchmakingCooldown,
+		Message: "Player is on matchmaking cooldown",
+		Details: map[string]interface{}{"player_id": e.Cooldown.PlayerID, "until": e.Cooldown.Until, "offenses": e.Cooldown.Offenses},
+	})
+}
+
+// applyCooldown はプレイヤーの違反を記録し、回数に応じたクールダウンを設定します。クールダウンが無効（store.ErrCooldownDisabled）の場合は何もしません。
+// 既にクールダウン中の場合は、新しい期限の方が遅ければ延ばします。
+func (s *Server) applyCooldown(ctx context.Context, session model.SessionResult, playerID, reason string) {
+	cooldown, err := s.Store.RecordCooldownOffense(ctx, playerID, s.now())
+	if errors.Is(err, store.ErrCooldownDisabled) {
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(ctx, "クールダウンの登録エラー", "func", "applyCooldown", "session_id", session.SessionID, "player_id", playerID, "reason", reason, "error", err)
+		return
+	}
+	metrics.MatchCooldowns.WithLabelValues(reason).Inc()
+	s.logger.InfoContext(ctx, "player put on matchmaking cooldown", "session_id", session.SessionID, "player_id", playerID, "reason", reason, "until", cooldown.Until, "offenses", cooldown.Offenses)
+	s.auditPlayer(ctx, auditActorMatchmaker, auditCooldown, playerID, map[string]interface{}{
+		"reason": reason, "session_id": session.SessionID, "until": cooldown.Until, "offenses": cooldown.Offenses,
+	})
+}
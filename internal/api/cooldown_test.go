@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/store"
+)
+
+func TestDeclineCooldownRejectsAndExpires(t *testing.T) {
+	ts := newTestServer(t, nil)
+	session := ts.matchPair(t, "alice", "bob")
+
+	rec := ts.do(t, "POST", "/sessions/"+session.SessionID+"/decline", map[string]string{"player_id": "alice"}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("decline = %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = ts.do(t, "POST", "/matchmaking", map[string]interface{}{"id": "alice"}, nil)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("enqueue during cooldown = %d, want 403: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60 (the default MATCH_COOLDOWN)", got)
+	}
+	var body struct{ Error ErrorDetail }
+	decodeJSON(t, rec, &body)
+	if body.Error.Code != errCodeMatchmakingCooldown {
+		t.Errorf("error code = %q, want %q", body.Error.Code, errCodeMatchmakingCooldown)
+	}
+
+	ts.clock.Advance(time.Minute)
+	ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+}
+
+func TestForceReenqueueAbandonCooldown(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.matchPair(t, "alice", "bob")
+
+	// 放棄したセッションのもう1人（bob）は待機キューへ戻る
+	ts.startEnqueue(t, map[string]interface{}{"id": "alice", "force": true})
+	ts.waitQueued(t, 2)
+
+	var cooldown store.PlayerCooldown
+	waitFor(t, "alice's cooldown", func() bool {
+		var active bool
+		cooldown, active, _ = ts.store.ActiveCooldown(t.Context(), []string{"alice"}, ts.clock.Now())
+		return active
+	})
+	if cooldown.Offenses != 1 {
+		t.Fatalf("cooldown = %+v, want the first offense for abandoning the session", cooldown)
+	}
+	if _, active, _ := ts.store.ActiveCooldown(t.Context(), []string{"bob"}, ts.clock.Now()); active {
+		t.Error("bob did not abandon the session but is on cooldown")
+	}
+}
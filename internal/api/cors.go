@@ -0,0 +1,110 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// corsOptions は CORS の設定です。
+type corsOptions struct {
+	// AllowedOrigins はリクエストを許可するオリジンです。"*" を含む場合は全オリジンを許可します（開発用）。
+	// "https://*.example.com" のように指定すると、そのドメインのサブドメインを許可します（example.com 自体は含みません）。
+	// 空の場合はどのオリジンにも CORS のヘッダーを返しません。
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// MaxAge は preflight の結果をブラウザがキャッシュできる時間です。
+	MaxAge time.Duration
+	// AllowCredentials は Access-Control-Allow-Credentials: true を返すかどうかです（Cookie などを送るクライアント向け）。
+	// 全オリジンを許可する場合は返しません（ブラウザが "*" との組み合わせを拒否するため）。
+	AllowCredentials bool
+}
+
+// ParseCORSOrigins は CORS_ALLOWED_ORIGINS の値を分割し、各オリジンの形式を確認します。
+// "*" は単独でのみ、サブドメインのワイルドカードは "<scheme>://*.<domain>" の形でのみ使えます。
+func ParseCORSOrigins(v string) ([]string, error) {
+	origins := model.SplitCommaList(v)
+	for _, o := range origins {
+		if o == "*" {
+			continue
+		}
+		scheme, host, ok := strings.Cut(o, "://")
+		if !ok || scheme == "" || host == "" || strings.Contains(host, "/") {
+			return nil, fmt.Errorf("オリジンの形式が不正です（<scheme>://<host>[:<port>]）: %q", o)
+		}
+		if strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			return nil, fmt.Errorf("ワイルドカードはサブドメインの先頭（%s://*.example.com）にのみ指定できます: %q", scheme, o)
+		}
+	}
+	return origins, nil
+}
+
+// matchOrigin はオリジンが許可リストの1件（完全一致、またはサブドメインのワイルドカード）に一致するかどうかを返します。
+func matchOrigin(pattern, origin string) bool {
+	prefix, suffix, wildcard := strings.Cut(pattern, "://*.")
+	if !wildcard {
+		return origin == pattern
+	}
+	// https://*.example.com は https://a.example.com・https://a.b.example.com に一致し、https://example.com・https://evil-example.com には一致しない
+	sub, ok := strings.CutPrefix(origin, prefix+"://")
+	if !ok {
+		return false
+	}
+	sub, ok = strings.CutSuffix(sub, "."+suffix)
+	return ok && sub != "" && !strings.ContainsAny(sub, ":/")
+}
+
+// allowOrigin は Access-Control-Allow-Origin に返す値を返します。許可しないオリジンの場合は空文字です。
+func (c corsOptions) allowOrigin(origin string) string {
+	if slices.Contains(c.AllowedOrigins, "*") {
+		return "*"
+	}
+	if origin == "" {
+		return ""
+	}
+	for _, pattern := range c.AllowedOrigins {
+		if matchOrigin(pattern, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// corsMiddleware はCORSのためのヘッダーを追加するミドルウェアです。
+// 許可リストに含まれるオリジンのみ、リクエストの Origin をそのまま返します。許可しないオリジンには CORS のヘッダーを返しません。
+// OPTIONS（preflight）はハンドラを呼ばずに 204 を返します。
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// オリジンによってレスポンスが変わるため、キャッシュがオリジンごとに分かれるようにする
+		w.Header().Add("Vary", "Origin")
+
+		preflight := r.Method == http.MethodOptions
+		if origin := s.cfg.CORS.allowOrigin(r.Header.Get("Origin")); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if s.cfg.CORS.AllowCredentials && origin != "*" {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			if preflight {
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(s.cfg.CORS.AllowedMethods, ", "))
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(s.cfg.CORS.AllowedHeaders, ", "))
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(s.cfg.CORS.MaxAge.Seconds())))
+			} else {
+				w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+			}
+		}
+
+		// preflightリクエストの場合はここで終了
+		if preflight {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
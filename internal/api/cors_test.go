@@ -0,0 +1,171 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// corsRequest は origin からの preflight（preflight が true の場合）または GET /leaderboard のレスポンスのヘッダーを返します。
+func (ts *testServer) corsRequest(t *testing.T, origin string, preflight bool) (int, http.Header) {
+	t.Helper()
+	header := make(http.Header)
+	if origin != "" {
+		header.Set("Origin", origin)
+	}
+	if preflight {
+		header.Set("Access-Control-Request-Method", "POST")
+		rec := ts.do(t, "OPTIONS", "/matchmaking", nil, header)
+		return rec.Code, rec.Header()
+	}
+	rec := ts.do(t, "GET", "/leaderboard", nil, header)
+	return rec.Code, rec.Header()
+}
+
+func TestCORSAllowList(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.CORS.AllowedOrigins = []string{"https://game.example", "https://admin.example"}
+		cfg.CORS.AllowedMethods = []string{"GET", "POST"}
+		cfg.CORS.AllowedHeaders = []string{"Content-Type", "X-Custom"}
+		cfg.CORS.MaxAge = 5 * time.Minute
+	})
+
+	_, h := ts.corsRequest(t, "https://game.example", true)
+	for name, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://game.example",
+		"Access-Control-Allow-Methods": "GET, POST",
+		"Access-Control-Allow-Headers": "Content-Type, X-Custom",
+		"Access-Control-Max-Age":       "300",
+	} {
+		if got := h.Get(name); got != want {
+			t.Errorf("preflight %s = %q, want %q", name, got, want)
+		}
+	}
+	// 許可リストの別のオリジンには、そのオリジンを返す
+	if _, h := ts.corsRequest(t, "https://admin.example", false); h.Get("Access-Control-Allow-Origin") != "https://admin.example" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the request origin", h.Get("Access-Control-Allow-Origin"))
+	}
+
+	// 許可しないオリジンにはリクエストのオリジンも "*" も返さない
+	for _, preflight := range []bool{true, false} {
+		_, h := ts.corsRequest(t, "https://evil.example", preflight)
+		if got := h.Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("disallowed origin (preflight %v): Access-Control-Allow-Origin = %q, want none", preflight, got)
+		}
+	}
+}
+
+// "*" は明示的に指定した場合のみ全オリジンを許可する（開発用）
+func TestCORSWildcardIsOptIn(t *testing.T) {
+	if _, h := newTestServer(t, nil).corsRequest(t, "https://game.example", false); h.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("default config: Access-Control-Allow-Origin = %q, want none", h.Get("Access-Control-Allow-Origin"))
+	}
+	ts := newTestServer(t, func(cfg *Config) { cfg.CORS.AllowedOrigins = []string{"*"} })
+	if _, h := ts.corsRequest(t, "https://anything.example", false); h.Get("Access-Control-Allow-Origin") != "*" {
+		t.Fatalf("with *: Access-Control-Allow-Origin = %q, want *", h.Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestCORSPreflightAndCredentials(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.CORS.AllowedOrigins = []string{"https://*.game.example"}
+		cfg.CORS.AllowCredentials = true
+	})
+	for _, tc := range []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://play.game.example", true},
+		{"https://eu.play.game.example", true},
+		{"https://game.example", false},
+		{"https://evilgame.example", false},
+		{"http://play.game.example", false},
+		{"https://play.game.example.evil", false},
+	} {
+		for _, preflight := range []bool{true, false} {
+			code, h := ts.corsRequest(t, tc.origin, preflight)
+			if preflight && code != http.StatusNoContent {
+				t.Errorf("%s preflight: status %d, want 204", tc.origin, code)
+			}
+			if !preflight && code != http.StatusOK {
+				t.Errorf("%s: status %d, want 200", tc.origin, code)
+			}
+			if got := h.Values("Vary"); !slices.Contains(got, "Origin") {
+				t.Errorf("%s (preflight %v): Vary = %q, want Origin", tc.origin, preflight, got)
+			}
+			if !tc.allowed {
+				// 許可しないオリジンには CORS のヘッダーを1つも返さない
+				for name := range h {
+					if strings.HasPrefix(name, "Access-Control-") {
+						t.Errorf("%s (preflight %v): %s = %q, want no CORS headers", tc.origin, preflight, name, h.Get(name))
+					}
+				}
+				continue
+			}
+			if got := h.Get("Access-Control-Allow-Origin"); got != tc.origin {
+				t.Errorf("%s (preflight %v): Access-Control-Allow-Origin = %q", tc.origin, preflight, got)
+			}
+			if got := h.Get("Access-Control-Allow-Credentials"); got != "true" {
+				t.Errorf("%s (preflight %v): Access-Control-Allow-Credentials = %q, want true", tc.origin, preflight, got)
+			}
+			// 認証付きのクライアントの preflight のため、既定で Authorization を許可する
+			if preflight && !strings.Contains(h.Get("Access-Control-Allow-Headers"), "Authorization") {
+				t.Errorf("%s preflight: Access-Control-Allow-Headers = %q, want Authorization", tc.origin, h.Get("Access-Control-Allow-Headers"))
+			}
+			if preflight && h.Get("Access-Control-Max-Age") != "600" {
+				t.Errorf("%s preflight: Access-Control-Max-Age = %q, want 600", tc.origin, h.Get("Access-Control-Max-Age"))
+			}
+		}
+	}
+
+	// 全オリジンを許可する場合は Allow-Credentials を返さない（ブラウザが "*" との組み合わせを拒否するため）
+	ts = newTestServer(t, func(cfg *Config) {
+		cfg.CORS.AllowedOrigins = []string{"*"}
+		cfg.CORS.AllowCredentials = true
+	})
+	if _, h := ts.corsRequest(t, "https://game.example", false); h.Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("with *: Access-Control-Allow-Credentials = %q, want none", h.Get("Access-Control-Allow-Credentials"))
+	}
+}
+
+func TestParseCORSOrigins(t *testing.T) {
+	got, err := ParseCORSOrigins("https://game.example, https://*.game.example,http://localhost:3000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"https://game.example", "https://*.game.example", "http://localhost:3000"}; !slices.Equal(got, want) {
+		t.Fatalf("origins = %q, want %q", got, want)
+	}
+	for _, v := range []string{"game.example", "https://", "https://game.example/path", "https://play.*.example", "https://*game.example"} {
+		if _, err := ParseCORSOrigins(v); err == nil {
+			t.Errorf("ParseCORSOrigins(%q) succeeded, want an error", v)
+		}
+	}
+}
+
+// ブロックの解除（DELETE）の preflight には、次のハンドラを呼ばずに 204 と既定で DELETE を含む許可メソッドを返し、
+// 許可しないオリジンには CORS のヘッダーなしで 204 を返す
+func TestCORSPreflightBlockEndpoints(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.CORS.AllowedOrigins = []string{"https://game.example"} })
+	for _, path := range []string{"/players/alice/blocks", "/players/alice/blocks/bob"} {
+		header := http.Header{"Origin": {"https://game.example"}, "Access-Control-Request-Method": {"DELETE"}}
+		rec := ts.do(t, "OPTIONS", path, nil, header)
+		if rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+			t.Fatalf("OPTIONS %s: status %d with %q, want an empty 204", path, rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://game.example" {
+			t.Errorf("OPTIONS %s: Access-Control-Allow-Origin = %q", path, got)
+		}
+		if got := strings.Split(rec.Header().Get("Access-Control-Allow-Methods"), ", "); !slices.Contains(got, "DELETE") {
+			t.Errorf("OPTIONS %s: Access-Control-Allow-Methods = %q, want DELETE", path, got)
+		}
+
+		header.Set("Origin", "https://evil.example")
+		rec = ts.do(t, "OPTIONS", path, nil, header)
+		if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "" || rec.Header().Get("Access-Control-Allow-Methods") != "" {
+			t.Errorf("OPTIONS %s from a disallowed origin: status %d, headers %v, want 204 without CORS headers", path, rec.Code, rec.Header())
+		}
+	}
+}
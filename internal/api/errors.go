@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// エラーレスポンスのコード。クライアントはメッセージではなくこの値で判定します。
+const (
+	errCodeInvalidRequest        = "invalid_request"
+	errCodeRequestTooLarge       = "request_too_large"
+	errCodeMethodNotAllowed      = "method_not_allowed"
+	errCodeNotFound              = "not_found"
+	errCodeUnknownGameMode       = "unknown_game_mode"
+	errCodeModeClosed            = "mode_closed"
+	errCodeUnauthorized          = "unauthorized"
+	errCodeForbidden             = "forbidden"
+	errCodeAlreadyQueued         = "already_queued"
+	errCodeAlreadyInSession      = "already_in_session"
+	errCodeNotQueued             = "not_queued"
+	errCodeNotMatched            = "not_matched"
+	errCodeRemovedByAdmin        = "removed_by_admin"
+	errCodeCannotMatch           = "cannot_match"
+	errCodeMatcherBusy           = "matcher_busy"
+	errCodeAllocationFailed      = "allocation_failed"
+	errCodeReadyCheckInProgress  = "ready_check_in_progress"
+	errCodePlayerNotFound        = "player_not_found"
+	errCodeSessionNotFound       = "session_not_found"
+	errCodeInvalidSessionID      = "invalid_session_id"
+	errCodeSessionEnded          = "session_ended"
+	errCodeSessionNotActive      = "session_not_active"
+	errCodeSpectatorLimitReached = "spectator_limit_reached"
+	errCodeNotSpectating         = "not_spectating"
+	errCodeUnknownFeatureFlag    = "unknown_feature_flag"
+	errCodeMatchmakingTimeout    = "matchmaking_timeout"
+	errCodeCancelled             = "cancelled"
+	errCodeRateLimited           = "rate_limited"
+	errCodeQueueFull             = "queue_full"
+	errCodeServerBusy            = "server_busy"
+	errCodePlayerBanned          = "player_banned"
+	errCodeNotBanned             = "not_banned"
+	errCodeMatchmakingCooldown   = "matchmaking_cooldown"
+	errCodeUnsupportedAPIVersion = "unsupported_api_version"
+	errCodeNotBlocked            = "not_blocked"
+	errCodeBlockLimitReached     = "block_limit_reached"
+	errCodeIdempotencyKeyReused  = "idempotency_key_reused"
+	errCodeResumeTokenInvalid    = "resume_token_invalid"
+	errCodeMatchTokenInvalid     = "match_token_invalid"
+	errCodeConfirmationRequired  = "confirmation_required"
+	errCodeConfirmationInvalid   = "confirmation_invalid"
+	errCodeConfirmationExpired   = "confirmation_expired"
+	errCodeConfirmationMismatch  = "confirmation_mismatch"
+	errCodeInternal              = "internal_error"
+)
+
+// ErrorResponse はエラー時のレスポンスボディです。
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail はエラーの内容です。ValidModes と Hints は該当するエラーの場合のみ含めます。
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// ValidModes は unknown_game_mode の場合に、受け付けるゲームモードの一覧を返します。
+	ValidModes []string `json:"valid_modes,omitempty"`
+	// Hints は matchmaking_timeout の場合に、次に取れる行動の案内を返します。
+	Hints []string `json:"hints,omitempty"`
+	// Details はコードごとの補足情報です（rate_limited の retry_after_seconds など）。
+	Details map[string]interface{} `json:"details,omitempty"`
+	// RequestID は 5xx の場合に、ログと照合するためのリクエスト ID（X-Request-ID ヘッダーと同じ値）を返します。
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeJSONError はエラーを ErrorResponse の JSON で返します。
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	writeErrorResponse(w, status, ErrorDetail{Code: code, Message: message})
+}
+
+// writeErrorResponse は追加の情報を含むエラーを ErrorResponse の JSON で返します。
+// 5xx の Message には DB ドライバなどの内部のエラーを含めず、詳細はリクエスト ID 付きでログに出力してください。
+func writeErrorResponse(w http.ResponseWriter, status int, detail ErrorDetail) {
+	if status >= http.StatusInternalServerError {
+		detail.RequestID = w.Header().Get(requestIDHeader)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(ErrorResponse{Error: detail}); err != nil {
+		slog.Warn("エラーレスポンス書き込みエラー", "func", "writeErrorResponse", "code", detail.Code, "error", err)
+	}
+}
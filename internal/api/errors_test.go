@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+)
+
+// errorShape は JSON のエラーレスポンスが {"error": {"code": ..., "message": ...}} の形であることを確認し、code を返します。
+func errorShape(t *testing.T, rec *httptest.ResponseRecorder, status int) string {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status %d, want %d: %s", rec.Code, status, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	var body map[string]map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body %q is not {\"error\": {...}}: %v", rec.Body, err)
+	}
+	if len(body) != 1 || body["error"] == nil {
+		t.Fatalf("error body = %s, want only the error object", rec.Body)
+	}
+	code, _ := body["error"]["code"].(string)
+	message, _ := body["error"]["message"].(string)
+	if code == "" || message == "" {
+		t.Fatalf("error = %v, want a code and a message", body["error"])
+	}
+	return code
+}
+
+func TestBadRequestErrorShape(t *testing.T) {
+	ts := newTestServer(t, nil)
+	rec := ts.do(t, "POST", "/matchmaking", json.RawMessage(`{"id": "alice", "rating": "high"}`), nil)
+	if code := errorShape(t, rec, http.StatusBadRequest); code != errCodeInvalidRequest {
+		t.Fatalf("code = %q, want %q", code, errCodeInvalidRequest)
+	}
+}
+
+func TestTimeoutErrorShape(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.Queue.MinTimeout = time.Second })
+	rec := receive(t, ts.startEnqueue(t, map[string]interface{}{"id": "alice", "timeout_seconds": 1}))
+	if code := errorShape(t, rec, http.StatusGatewayTimeout); code != errCodeMatchmakingTimeout {
+		t.Fatalf("code = %q, want %q", code, errCodeMatchmakingTimeout)
+	}
+	if ids := ts.queuedIDs(t); len(ids) != 0 {
+		t.Fatalf("queued = %v after the timeout, want empty", ids)
+	}
+}
+
+func TestAlreadyQueuedErrorShape(t *testing.T) {
+	ts := newTestServer(t, nil)
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	rec := ts.do(t, "POST", "/matchmaking", map[string]interface{}{"id": "alice"}, nil)
+	if code := errorShape(t, rec, http.StatusConflict); code != errCodeAlreadyQueued {
+		t.Fatalf("code = %q, want %q", code, errCodeAlreadyQueued)
+	}
+
+	// 先に待機していたリクエストはそのまま待ち続け、マッチングする
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	ts.tick(t)
+	for _, done := range []<-chan *httptest.ResponseRecorder{alice, bob} {
+		if rec := receive(t, done); rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestCancelledErrorShape(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := ts.startEnqueueContext(t, ctx, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	cancel()
+	if code := errorShape(t, receive(t, done), http.StatusServiceUnavailable); code != errCodeCancelled {
+		t.Fatalf("code = %q, want %q", code, errCodeCancelled)
+	}
+}
+
+// failingEnqueueStore は待機キューへの登録を err で失敗させます。
+type failingEnqueueStore struct {
+	store.Store
+	err error
+}
+
+func (s *failingEnqueueStore) EnqueueEntry(context.Context, model.QueueEntry) (model.QueueEntry, error) {
+	return model.QueueEntry{}, s.err
+}
+
+// DB のエラーはレスポンスに含めず、ログと照合するためのリクエスト ID を X-Request-ID ヘッダーとボディで返す
+func TestInternalErrorReturnsRequestID(t *testing.T) {
+	ts := newTestServer(t, nil)
+	logs := ts.captureLogs(slog.LevelError)
+	cause := "Error 1213 (40001): Deadlock found; INSERT INTO matchmaking_queue (player_id) VALUES ('alice')"
+	ts.Store = &failingEnqueueStore{Store: ts.store, err: errors.New(cause)}
+
+	rec := ts.do(t, "POST", "/matchmaking", map[string]interface{}{"id": "alice"}, nil)
+	errorShape(t, rec, http.StatusInternalServerError)
+	id := rec.Header().Get(requestIDHeader)
+	if id == "" {
+		t.Fatalf("response has no %s header", requestIDHeader)
+	}
+	var resp ErrorResponse
+	decodeJSON(t, rec, &resp)
+	if resp.Error.RequestID != id {
+		t.Errorf("body request_id = %q, want the header's %q", resp.Error.RequestID, id)
+	}
+	for _, leaked := range []string{"INSERT", "Deadlock", "1213"} {
+		if strings.Contains(rec.Body.String(), leaked) {
+			t.Errorf("error body leaks %q: %s", leaked, rec.Body)
+		}
+	}
+
+	// 詳細なエラーは同じリクエスト ID 付きでログに出力する
+	logged := false
+	for _, r := range logs.records(t) {
+		if r["request_id"] == id && strings.Contains(fmt.Sprint(r["error"]), "Deadlock found") {
+			logged = true
+		}
+	}
+	if !logged {
+		t.Fatalf("no error log with request_id %q and the cause: %s", id, logs)
+	}
+}
+
+// 内部のエラーは internal_error とし、エラーの内容はレスポンスに含めない
+func TestInternalErrorShape(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.Store = &failingEnqueueStore{Store: ts.store, err: errors.New("dial tcp 10.0.0.5:3306: connection refused")}
+	rec := ts.do(t, "POST", "/matchmaking", map[string]interface{}{"id": "alice"}, nil)
+	if code := errorShape(t, rec, http.StatusInternalServerError); code != errCodeInternal {
+		t.Fatalf("code = %q, want %q", code, errCodeInternal)
+	}
+	if strings.Contains(rec.Body.String(), "10.0.0.5") {
+		t.Errorf("error body leaks the cause: %s", rec.Body)
+	}
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"slices"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+)
+
+// eventLogQueueSize は書き込み待ちのイベントの上限です。超えた分は破棄します（リクエストの処理を待たせないため）。
+const eventLogQueueSize = 4096
+
+// マッチングイベントの種類です。
+const (
+	eventJoin    = "join"
+	eventMatch   = "match"
+	eventTimeout = "timeout"
+	eventCancel  = "cancel"
+)
+
+// matchEvent は分析用のイベントログに1行の JSON として書き込むマッチングのイベントです。
+type matchEvent struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	GameMode string    `json:"mode"`
+	Region   string    `json:"region,omitempty"`
+	PartyID  string    `json:"party_id,omitempty"`
+	// SessionID は match と、セッションの辞退・配信失敗による cancel のセッションです。
+	SessionID string `json:"session_id,omitempty"`
+	// Reason は cancel の理由です（client disconnected、declined など）。
+	Reason  string        `json:"reason,omitempty"`
+	Players []eventPlayer `json:"players"`
+}
+
+// eventPlayer はイベントに含めるプレイヤーです。WaitSeconds はイベントの時点での待機時間です。
+type eventPlayer struct {
+	ID          string  `json:"id"`
+	Rating      int     `json:"rating"`
+	Team        int     `json:"team,omitempty"`
+	IsBot       bool    `json:"is_bot,omitempty"`
+	WaitSeconds float64 `json:"wait_seconds"`
+}
+
+// EventLogger はマッチングのイベント（登録・成立・タイムアウト・キャンセル）を、運用のログとは別に改行区切りの JSON で書き込みます（環境変数 EVENT_LOG）。
+// 書き込みは run のゴルーチンで行い、イベントを記録するメソッドはブロックしません。nil の EventLogger は何もしません。
+type EventLogger struct {
+	w     io.Writer
+	queue chan matchEvent
+}
+
+// NewEventLogger は w へイベントを書き込む EventLogger を生成します。
+func NewEventLogger(w io.Writer) *EventLogger {
+	return &EventLogger{w: w, queue: make(chan matchEvent, eventLogQueueSize)}
+}
+
+// Join は待機キューへの登録を記録します。
+func (l *EventLogger) Join(entry model.QueueEntry, now time.Time) {
+	l.emit(entryEvent(eventJoin, entry, now))
+}
+
+// Match はセッションの成立を記録します。
+func (l *EventLogger) Match(session model.SessionResult, now time.Time) {
+	e := matchEvent{Type: eventMatch, Time: now, GameMode: session.GameMode, Region: session.Region, SessionID: session.SessionID}
+	for _, p := range session.Participants {
+		e.Players = append(e.Players, eventPlayer{ID: p.ID, Rating: p.Rating, Team: p.Team, IsBot: p.IsBot, WaitSeconds: now.Sub(p.WaitingSince).Seconds()})
+	}
+	l.emit(e)
+}
+
+// Timeout は相手が見つからずに待機を終えたことを記録します。
+func (l *EventLogger) Timeout(entry model.QueueEntry, now time.Time) {
+	l.emit(entryEvent(eventTimeout, entry, now))
+}
+
+// Cancel はクライアントが待機をやめたこと（切断など）を記録します。
+func (l *EventLogger) Cancel(entry model.QueueEntry, reason string, now time.Time) {
+	e := entryEvent(eventCancel, entry, now)
+	e.Reason = reason
+	l.emit(e)
+}
+
+// CancelSession は成立したセッションを PlayerIDs のプレイヤーが辞退した（または結果を受け取れなかった）ことを記録します。
+func (l *EventLogger) CancelSession(session model.SessionResult, playerIDs []string, reason string, now time.Time) {
+	e := matchEvent{Type: eventCancel, Time: now, GameMode: session.GameMode, Region: session.Region, SessionID: session.SessionID, Reason: reason}
+	for _, p := range session.Participants {
+		if slices.Contains(playerIDs, p.ID) {
+			e.PartyID = p.PartyID
+			e.Players = append(e.Players, eventPlayer{ID: p.ID, Rating: p.Rating, Team: p.Team, WaitSeconds: now.Sub(p.WaitingSince).Seconds()})
+		}
+	}
+	l.emit(e)
+}
+
+// entryEvent は待機キューのエントリについてのイベントを生成します。
+func entryEvent(typ string, entry model.QueueEntry, now time.Time) matchEvent {
+	e := matchEvent{Type: typ, Time: now, GameMode: entry.GameMode, Region: entry.Region, PartyID: entry.PartyID}
+	for _, p := range entry.Players {
+		e.Players = append(e.Players, eventPlayer{ID: p.ID, Rating: p.Rating, WaitSeconds: now.Sub(entry.WaitingSince).Seconds()})
+	}
+	return e
+}
+
+// emit はイベントを書き込み待ちに追加します。書き込み待ちが上限に達している場合は破棄します（ブロックしない）。
+func (l *EventLogger) emit(e matchEvent) {
+	if l == nil {
+		return
+	}
+	select {
+	case l.queue <- e:
+	default:
+		metrics.EventsDropped.Inc()
+	}
+}
+
+// Run は別ゴルーチンで動作し、書き込み待ちのイベントを順に書き込みます。
+// 停止時は書き込み待ちのイベントを書き込んでから終了します。
+func (l *EventLogger) Run(ctx context.Context) {
+	bw := bufio.NewWriter(l.w)
+	enc := json.NewEncoder(bw)
+	write := func(e matchEvent) {
+		if err := enc.Encode(e); err != nil {
+			slog.Error("イベントログ書き込みエラー", "func", "run", "type", e.Type, "error", err)
+		}
+	}
+	flush := func() {
+		if err := bw.Flush(); err != nil {
+			slog.Error("イベントログ書き込みエラー", "func", "run", "error", err)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-l.queue:
+					write(e)
+				default:
+					flush()
+					return
+				}
+			}
+		case e := <-l.queue:
+			write(e)
+			// 続けて届いているイベントはまとめて書き込む
+			if len(l.queue) == 0 {
+				flush()
+			}
+		}
+	}
+}
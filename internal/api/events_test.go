@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// startEventLog は Server のイベントログを logBuffer に書き込み始めます。返す関数はイベントログを停止し、書き込まれたイベントを返します。
+func (ts *testServer) startEventLog(t *testing.T) func() []map[string]interface{} {
+	t.Helper()
+	b := &logBuffer{}
+	ts.Events = NewEventLogger(b)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ts.Events.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return func() []map[string]interface{} {
+		t.Helper()
+		cancel()
+		<-done
+		return b.records(t)
+	}
+}
+
+// eventPlayers はイベントの players を ID ごとに返します。
+func eventPlayers(t *testing.T, event map[string]interface{}) map[string]map[string]interface{} {
+	t.Helper()
+	players := make(map[string]map[string]interface{})
+	for _, p := range event["players"].([]interface{}) {
+		player := p.(map[string]interface{})
+		players[player["id"].(string)] = player
+	}
+	return players
+}
+
+// 登録・成立・キャンセル・タイムアウトを、時刻・モード・プレイヤーのレーティングと待機時間とともに1行ずつ書き込む
+func TestEventLogShapes(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.Queue.MinTimeout = time.Second
+		cfg.PlayerRateLimit = ratelimit.Config{}
+	})
+	stop := ts.startEventLog(t)
+	ts.seedRatings(t, map[string]int{"alice": 1500, "bob": 1520})
+
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice", "region": "asia"})
+	ts.waitQueued(t, 1)
+	ts.clock.Advance(5 * time.Second)
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob", "region": "asia"})
+	ts.waitQueued(t, 2)
+	ts.tick(t)
+	var sessionID string
+	for _, done := range []<-chan *httptest.ResponseRecorder{alice, bob} {
+		rec := receive(t, done)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var session model.SessionResult
+		decodeJSON(t, rec, &session)
+		sessionID = session.SessionID
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	carol := ts.startEnqueueContext(t, ctx, map[string]interface{}{"id": "carol"})
+	ts.waitQueued(t, 1)
+	cancel()
+	receive(t, carol)
+	if rec := receive(t, ts.startEnqueue(t, map[string]interface{}{"id": "dave", "timeout_seconds": 1})); rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("dave: status %d, want 504: %s", rec.Code, rec.Body)
+	}
+
+	events := stop()
+	var types []string
+	for _, e := range events {
+		types = append(types, e["type"].(string))
+		if _, err := time.Parse(time.RFC3339Nano, e["time"].(string)); err != nil || e["mode"] != "duel" {
+			t.Errorf("event %v: want a timestamp and the duel mode", e)
+		}
+	}
+	if want := []string{"join", "join", "match", "join", "cancel", "join", "timeout"}; !slices.Equal(types, want) {
+		t.Fatalf("event types = %v, want %v", types, want)
+	}
+
+	if join := eventPlayers(t, events[0])["alice"]; join["rating"] != float64(1500) || join["wait_seconds"] != float64(0) || events[0]["region"] != "asia" {
+		t.Errorf("join = %v, want alice at 1500 in asia with no wait", events[0])
+	}
+	match := events[2]
+	if match["session_id"] != sessionID {
+		t.Errorf("match session_id = %v, want %s", match["session_id"], sessionID)
+	}
+	players := eventPlayers(t, match)
+	if len(players) != 2 || players["alice"]["wait_seconds"] != float64(5) || players["bob"]["wait_seconds"] != float64(0) || players["bob"]["rating"] != float64(1520) {
+		t.Errorf("match players = %v, want alice after 5s and bob at 1520 with no wait", players)
+	}
+	if players["alice"]["team"] == players["bob"]["team"] {
+		t.Errorf("match teams = %v, want alice and bob on different teams", players)
+	}
+	if cancel := events[4]; cancel["reason"] != "client disconnected" || eventPlayers(t, cancel)["carol"] == nil {
+		t.Errorf("cancel = %v, want carol disconnected", cancel)
+	}
+	if timeout := events[6]; eventPlayers(t, timeout)["dave"] == nil {
+		t.Errorf("timeout = %v, want dave", timeout)
+	}
+}
+
+// イベントログの書き込み待ちが上限に達しても、イベントを記録する側はブロックせず、あふれたイベントを数える
+func TestEventLogNeverBlocks(t *testing.T) {
+	l := NewEventLogger(&logBuffer{})
+	before := testutil.ToFloat64(metrics.EventsDropped)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range eventLogQueueSize + 10 {
+			l.Join(model.QueueEntry{GameMode: "duel", Players: []model.Player{{ID: "alice"}}}, testEpoch)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Join blocked while the event log was not being written")
+	}
+	if got := testutil.ToFloat64(metrics.EventsDropped) - before; got != 10 {
+		t.Fatalf("dropped events = %v, want 10", got)
+	}
+	// nil の EventLogger は何もしない
+	var none *EventLogger
+	none.Timeout(model.QueueEntry{}, testEpoch)
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/store"
+)
+
+// expirySweepInterval は有効期限切れのエントリを待機キューから削除する間隔です。
+const expirySweepInterval = 5 * time.Second
+
+// entryLifetime はクライアントが申告した有効期間（秒）とサーバの上限のうち短い方を返します。0 は申告なしとして扱います。
+// バックグラウンドで一時停止されるとネットワーク切断を通知できないプラットフォーム（コンソールなど）向けです。
+// 待機をあきらめるまでの時間ではなく、クライアントが応答可能であり続ける時間を表します。
+func (s *Server) entryLifetime(declaredSeconds int) (time.Duration, error) {
+	if declaredSeconds < 0 {
+		return 0, &model.FieldError{Field: "max_lifetime_seconds", Message: "max_lifetime_seconds must not be negative"}
+	}
+	declared := time.Duration(declaredSeconds) * time.Second
+	if declared == 0 || declared > s.cfg.MaxEntryLifetime {
+		return s.cfg.MaxEntryLifetime, nil
+	}
+	return declared, nil
+}
+
+// requestTimeout はクライアントが指定した待機時間（秒）を検証して返します。0 は指定なしとして扱います。
+func (s *Server) requestTimeout(seconds int) (time.Duration, error) {
+	if seconds == 0 {
+		return 0, nil
+	}
+	timeout := time.Duration(seconds) * time.Second
+	if timeout < s.cfg.Queue.MinTimeout || timeout > s.cfg.Queue.MaxTimeout {
+		lo, hi := int(s.cfg.Queue.MinTimeout/time.Second), int(s.cfg.Queue.MaxTimeout/time.Second)
+		return 0, &model.FieldError{
+			Field:   "timeout_seconds",
+			Message: fmt.Sprintf("timeout_seconds must be between %d and %d", lo, hi),
+			Details: map[string]interface{}{"min": lo, "max": hi},
+		}
+	}
+	return timeout, nil
+}
+
+// matchmakingWait はロングポーリングでマッチング結果を待つ時間を返します。
+// リクエストで待機時間が指定されていればそれを、なければゲームモードの待機時間を使い、
+// エントリの有効期限が先に来る場合は、有効期限までしか待ちません。
+func (s *Server) matchmakingWait(e model.QueueEntry, now time.Time) time.Duration {
+	wait := queue.MatchmakingTimeout
+	if mode, ok := s.cfg.Queue.GameModes[e.GameMode]; ok && mode.Timeout > 0 {
+		wait = mode.Timeout
+	}
+	if e.Timeout > 0 {
+		wait = e.Timeout
+	}
+	if !e.ExpiresAt.IsZero() {
+		wait = min(wait, e.ExpiresAt.Sub(now))
+	}
+	return max(wait, 0)
+}
+
+// setExpiryHeader はエントリの有効期限を X-Queue-Expires-At ヘッダーで返します。
+func setExpiryHeader(w http.ResponseWriter, e model.QueueEntry) {
+	if !e.ExpiresAt.IsZero() {
+		w.Header().Set("X-Queue-Expires-At", e.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+}
+
+// setTimeoutHeader はマッチング結果を待つ時間（秒）を X-Matchmaking-Timeout ヘッダーで返します。
+func setTimeoutHeader(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("X-Matchmaking-Timeout", strconv.Itoa(int(wait.Round(time.Second)/time.Second)))
+}
+
+// ExpirySweeper は有効期限を過ぎたエントリを定期的に待機キューから削除します。
+// 切断を通知できないまま一時停止したクライアントのエントリが残り続けないようにするためのものです。
+func (s *Server) ExpirySweeper(ctx context.Context) {
+	ticker := time.NewTicker(expirySweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sweepCtx, cancel := context.WithTimeout(ctx, s.cfg.TickTimeout)
+		n, err := s.Store.SweepExpiredEntries(sweepCtx, s.now())
+		cancel()
+		if err != nil {
+			s.logger.Warn("有効期限切れエントリ削除エラー", "func", "expirySweeper", "error", err)
+			continue
+		}
+		if n > 0 {
+			s.logger.Info("expired queue entries removed", "players", n)
+		}
+		s.reapStaleEntries(ctx)
+	}
+}
+
+// reapStaleEntries は待機開始から StaleEntryAge を過ぎ、通知を待っているクライアントがいないエントリを待機キューから削除します。
+// 中止されたセッションから戻されたエントリはクライアントの再接続を待っているため対象にしません（有効期限で削除されます）。
+func (s *Server) reapStaleEntries(ctx context.Context) {
+	if s.cfg.StaleEntryAge <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.TickTimeout)
+	defer cancel()
+
+	rows, err := s.Store.ListQueuedPlayers(ctx)
+	if err != nil {
+		s.logger.Warn("待機プレイヤー取得エラー", "func", "reapStaleEntries", "error", err)
+		return
+	}
+	requeued := make(map[string]bool)
+	for _, row := range rows {
+		if row.Requeued {
+			requeued[row.ID] = true
+		}
+	}
+
+	cutoff := s.now().Add(-s.cfg.StaleEntryAge)
+	reaped := 0
+	for _, e := range store.GroupQueueEntries(rows) {
+		if !e.WaitingSince.Before(cutoff) || requeued[e.Players[0].ID] {
+			continue
+		}
+		// ロングポーリングの購読は待機キューへの登録より前に行うため、購読がなければ待機しているクライアントはいない
+		subscribed, err := s.notifier.Subscribed(ctx, e.Key())
+		if err != nil {
+			s.logger.Warn("購読確認エラー", "func", "reapStaleEntries", "entry", e.Key(), "error", err)
+			return
+		}
+		if subscribed {
+			continue
+		}
+		if err := s.Store.DequeuePlayer(ctx, e.Players[0].ID); err != nil {
+			s.logger.Warn("待機キュー削除エラー", "func", "reapStaleEntries", "entry", e.Key(), "error", err)
+			return
+		}
+		reaped += len(e.Players)
+	}
+	if reaped > 0 {
+		s.logger.Info("stale queue entries removed", "players", reaped, "max_age", s.cfg.StaleEntryAge.String())
+	}
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/ratelimit"
+)
+
+func TestEntryLifetime(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.MaxEntryLifetime = 5 * time.Minute })
+	for _, tc := range []struct {
+		declared int
+		want     time.Duration
+	}{
+		{0, 5 * time.Minute},
+		{60, time.Minute},
+		{300, 5 * time.Minute},
+		// サーバの上限より長い申告は上限に切り詰める
+		{3600, 5 * time.Minute},
+	} {
+		if got, err := ts.entryLifetime(tc.declared); err != nil || got != tc.want {
+			t.Errorf("entryLifetime(%d) = %v, %v, want %v", tc.declared, got, err, tc.want)
+		}
+	}
+	if _, err := ts.entryLifetime(-1); err == nil {
+		t.Error("negative lifetime accepted")
+	}
+}
+
+// queuedExpiry は GET /admin/queue で返すプレイヤーの有効期限を返します。
+func (ts *testServer) queuedExpiry(t *testing.T, id string) time.Time {
+	t.Helper()
+	rec := serve(t, ts.AdminHandler(), "GET", "/admin/queue", nil, adminHeader())
+	var resp struct {
+		Players []struct {
+			ID        string    `json:"id"`
+			ExpiresAt time.Time `json:"expires_at"`
+		} `json:"players"`
+	}
+	decodeJSON(t, rec, &resp)
+	for _, p := range resp.Players {
+		if p.ID == id {
+			return p.ExpiresAt
+		}
+	}
+	t.Fatalf("%s is not queued", id)
+	return time.Time{}
+}
+
+// 中止されたセッションから待機キューへ戻したエントリは、申告された有効期限を延ばさない
+func TestDeclaredLifetimeKeptOnRequeue(t *testing.T) {
+	ts := newTestServer(t, nil)
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob", "max_lifetime_seconds": 60})
+	ts.waitQueued(t, 2)
+	wantExpiry := testEpoch.Add(time.Minute)
+	if got := ts.queuedExpiry(t, "bob"); !got.Equal(wantExpiry) {
+		t.Fatalf("bob expires at %v, want %v", got, wantExpiry)
+	}
+
+	ts.clock.Advance(10 * time.Second)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+	var session model.SessionResult
+	decodeJSON(t, receive(t, alice), &session)
+	if rec := receive(t, bob); rec.Code != http.StatusOK {
+		t.Fatalf("bob: status %d: %s", rec.Code, rec.Body)
+	}
+
+	ts.clock.Advance(5 * time.Second)
+	if got := readyCheckResult(t, ts.startReadyCheck(t, session.SessionID, "alice", "decline")); !requeued(got, "bob") {
+		t.Fatalf("participants = %+v, want bob requeued", got.Participants)
+	}
+	if got := ts.queuedExpiry(t, "bob"); !got.Equal(wantExpiry) {
+		t.Fatalf("bob expires at %v after the requeue, want the declared %v", got, wantExpiry)
+	}
+
+	// 有効期限を過ぎたエントリは削除する
+	ts.clock.Advance(time.Minute)
+	if n, err := ts.Store.SweepExpiredEntries(context.Background(), ts.now()); err != nil || n != 1 {
+		t.Fatalf("sweep = %d, %v, want bob removed", n, err)
+	}
+	if ids := ts.queuedIDs(t); len(ids) != 0 {
+		t.Fatalf("queued = %v after the sweep, want empty", ids)
+	}
+}
+
+// 通知を待っているクライアントがいない古いエントリ（クラッシュしたインスタンスの残り）は削除し、待機中のクライアントのエントリは残す
+func TestReapStaleEntries(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.StaleEntryAge = time.Minute })
+	logs := ts.captureLogs(slog.LevelInfo)
+	ctx := context.Background()
+
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	orphan := model.QueueEntry{Players: []model.Player{{ID: "bob", Rating: 1500}}, Rating: 1500, GameMode: "duel", WaitingSince: ts.now().Add(-30 * time.Second)}
+	if _, err := ts.store.EnqueueEntry(ctx, orphan); err != nil {
+		t.Fatal(err)
+	}
+
+	// 待機開始から StaleEntryAge を過ぎるまでは削除しない
+	ts.reapStaleEntries(ctx)
+	if ids := ts.queuedIDs(t); len(ids) != 2 {
+		t.Fatalf("queued = %v before the max age, want both", ids)
+	}
+
+	ts.clock.Advance(45 * time.Second)
+	ts.reapStaleEntries(ctx)
+	if ids := ts.queuedIDs(t); !slices.Equal(ids, []string{"alice"}) {
+		t.Fatalf("queued = %v, want only alice, who is still waiting", ids)
+	}
+	var reaped []map[string]interface{}
+	for _, rec := range logs.records(t) {
+		if rec["msg"] == "stale queue entries removed" {
+			reaped = append(reaped, rec)
+		}
+	}
+	if len(reaped) != 1 || reaped[0]["players"] != float64(1) {
+		t.Fatalf("reap logs = %v, want 1 player removed", reaped)
+	}
+
+	// alice の待機は続いており、そのままマッチングできる
+	ts.clock.Advance(time.Minute)
+	ts.reapStaleEntries(ctx)
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	ts.tick(t)
+	for _, done := range []<-chan *httptest.ResponseRecorder{alice, bob} {
+		if rec := receive(t, done); rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+	}
+}
+
+// 待機時間はボディまたはクエリパラメータの timeout_seconds で指定でき（ボディを優先）、範囲外の値は許容範囲を付けて拒否する
+func TestRequestTimeoutRange(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.PlayerRateLimit = ratelimit.Config{} })
+	for _, tc := range []struct {
+		path string
+		body map[string]interface{}
+	}{
+		{"/matchmaking", map[string]interface{}{"id": "alice", "timeout_seconds": 4}},
+		{"/matchmaking", map[string]interface{}{"id": "alice", "timeout_seconds": 181}},
+		{"/matchmaking", map[string]interface{}{"id": "alice", "timeout_seconds": -1}},
+		{"/matchmaking?timeout_seconds=600", map[string]interface{}{"id": "alice"}},
+	} {
+		rec := ts.do(t, "POST", tc.path, tc.body, nil)
+		if code := errorShape(t, rec, http.StatusBadRequest); code != errCodeInvalidRequest {
+			t.Fatalf("%s %v: code = %q, want %q", tc.path, tc.body, code, errCodeInvalidRequest)
+		}
+		var resp struct {
+			Error ErrorDetail `json:"error"`
+		}
+		decodeJSON(t, rec, &resp)
+		if d := resp.Error.Details; d["field"] != "timeout_seconds" || d["min"] != float64(5) || d["max"] != float64(180) {
+			t.Fatalf("%s %v: details = %v, want the allowed range 5..180", tc.path, tc.body, d)
+		}
+	}
+	if code := errorShape(t, ts.do(t, "POST", "/matchmaking?timeout_seconds=abc", map[string]interface{}{"id": "alice"}, nil), http.StatusBadRequest); code != errCodeInvalidRequest {
+		t.Fatalf("timeout_seconds=abc: code = %q, want %q", code, errCodeInvalidRequest)
+	}
+
+	waits := map[string]<-chan *httptest.ResponseRecorder{
+		"120": ts.startEnqueue(t, map[string]interface{}{"id": "alice", "timeout_seconds": 120}),
+	}
+	ts.waitQueued(t, 1)
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- ts.do(t, "POST", "/matchmaking?timeout_seconds=120", map[string]interface{}{"id": "bob", "timeout_seconds": 45}, nil)
+	}()
+	waits["45"] = done
+	ts.waitQueued(t, 2)
+	ts.tick(t)
+	for want, ch := range waits {
+		rec := receive(t, ch)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get("X-Matchmaking-Timeout"); got != want {
+			t.Errorf("X-Matchmaking-Timeout = %q, want %q", got, want)
+		}
+	}
+}
+
+// 古いエントリの削除は、ゲームモードやリクエストで指定できる最も長い待機時間を基準にする
+func TestStaleEntryAgeFollowsLongestTimeout(t *testing.T) {
+	q := queue.DefaultConfig()
+	if got := q.LongestTimeout(); got != q.MaxTimeout {
+		t.Fatalf("LongestTimeout = %v, want MaxTimeout %v", got, q.MaxTimeout)
+	}
+	ranked := q.GameModes["duel"]
+	ranked.Timeout = 5 * time.Minute
+	q.GameModes["ranked"] = ranked
+	if got := q.LongestTimeout(); got != 5*time.Minute {
+		t.Fatalf("LongestTimeout = %v, want the ranked mode's 5m", got)
+	}
+	if cfg := DefaultConfig(); cfg.StaleEntryAge != 2*cfg.Queue.LongestTimeout() {
+		t.Fatalf("StaleEntryAge = %v, want twice the longest timeout %v", cfg.StaleEntryAge, cfg.Queue.LongestTimeout())
+	}
+}
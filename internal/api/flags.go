@@ -0,0 +1,238 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/store"
+)
+
+// 機能フラグ
+const (
+	// flagAvoidRematch は直前の対戦相手との再戦を避けるかどうかです。
+	flagAvoidRematch = "avoid_rematch"
+	// flagCrossRegionMatching は待機時間に応じて地域をまたいだマッチングを許可するかどうかです。
+	flagCrossRegionMatching = "cross_region_matching"
+	// flagExplainCapture は遅いクエリの EXPLAIN を取得して query_diagnostics に保存するかどうかです。
+	flagExplainCapture = "explain_capture"
+	// flagBestPairing は1対1のモードで、待機開始順ではなくマッチ品質の合計が大きくなる組み合わせを選ぶかどうかです。
+	flagBestPairing = "best_pairing"
+	// flagResumeMatchedSession は POST /matchmaking で、成立直後の未終了のセッションがあれば待機キューへ登録せずにそれを返すかどうかです。
+	flagResumeMatchedSession = "resume_matched_session"
+)
+
+// featureFlagDefaults は機能フラグとその既定値です。新しいフラグはここに追加します。
+var featureFlagDefaults = map[string]bool{
+	flagAvoidRematch:         true,
+	flagCrossRegionMatching:  true,
+	flagExplainCapture:       false,
+	flagBestPairing:          false,
+	flagResumeMatchedSession: false,
+}
+
+// featureFlagRefreshInterval は他のインスタンスで変更されたフラグを service_state から読み直す間隔です。
+const featureFlagRefreshInterval = 15 * time.Second
+
+// featureFlags は機能フラグの現在値を保持します。
+// 値の参照はマッチングの処理中など頻繁に行われるため、変更のたびに作り直したスナップショットを atomic に参照します。
+type featureFlags struct {
+	snapshot atomic.Pointer[map[string]bool]
+
+	// mu は値の更新（スナップショットの作り直し）を直列化します。
+	mu sync.Mutex
+	// config は環境変数で上書きされた値です。
+	config map[string]bool
+	// runtime は管理用エンドポイントで変更され、service_state に保存された値です。
+	runtime map[string]bool
+}
+
+// NewFeatureFlags は既定値のみの featureFlags を生成します。
+func NewFeatureFlags() *featureFlags {
+	f := &featureFlags{config: make(map[string]bool), runtime: make(map[string]bool)}
+	f.rebuild()
+	return f
+}
+
+// enabled はフラグが有効かどうかを返します。未定義のフラグは無効とみなします。
+func (f *featureFlags) enabled(name string) bool {
+	return (*f.snapshot.Load())[name]
+}
+
+// ExplainCaptureEnabled は機能フラグ explain_capture が有効かどうかを返します。store.Config.ExplainCapture に設定します。
+func (f *featureFlags) ExplainCaptureEnabled() bool {
+	return f.enabled(flagExplainCapture)
+}
+
+// values は全フラグの現在値を返します。
+func (f *featureFlags) values() map[string]bool {
+	current := *f.snapshot.Load()
+	values := make(map[string]bool, len(current))
+	for name, v := range current {
+		values[name] = v
+	}
+	return values
+}
+
+// rebuild は既定値・環境変数・実行時の変更の順に値を重ねてスナップショットを作り直します。mu を保持して呼び出します。
+func (f *featureFlags) rebuild() {
+	values := make(map[string]bool, len(featureFlagDefaults))
+	for name, v := range featureFlagDefaults {
+		values[name] = v
+	}
+	for name, v := range f.config {
+		values[name] = v
+	}
+	for name, v := range f.runtime {
+		values[name] = v
+	}
+	f.snapshot.Store(&values)
+}
+
+// ApplyConfig は "name=true,name2=false" 形式の設定で既定値を上書きします。
+func (f *featureFlags) ApplyConfig(s string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, item := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return fmt.Errorf("invalid feature flag setting %q", item)
+		}
+		if _, defined := featureFlagDefaults[name]; !defined {
+			return fmt.Errorf("unknown feature flag %q", name)
+		}
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for feature flag %q: %v", name, err)
+		}
+		f.config[name] = v
+	}
+	f.rebuild()
+	return nil
+}
+
+// featureFlagStateKey は service_state 上のフラグのキーを返します。
+func featureFlagStateKey(name string) string {
+	return "flag:" + name
+}
+
+// Load は service_state に保存された実行時の変更を読み込みます。
+func (f *featureFlags) Load(ctx context.Context, st store.StateStore) error {
+	runtime := make(map[string]bool)
+	for name := range featureFlagDefaults {
+		value, err := st.GetServiceState(ctx, featureFlagStateKey(name))
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			continue
+		}
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			slog.Warn("保存された機能フラグの値が不正です", "flag", name, "value", value)
+			continue
+		}
+		runtime[name] = v
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.runtime = runtime
+	f.rebuild()
+	return nil
+}
+
+// set はフラグの値を実行時に変更し、service_state に保存します。
+func (f *featureFlags) set(ctx context.Context, st store.StateStore, name string, v bool) error {
+	if _, defined := featureFlagDefaults[name]; !defined {
+		return fmt.Errorf("unknown feature flag %q", name)
+	}
+	if err := st.SetServiceState(ctx, featureFlagStateKey(name), strconv.FormatBool(v)); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.runtime[name] = v
+	f.rebuild()
+	return nil
+}
+
+// RefreshFeatureFlags は他のインスタンスでの変更を反映するため、定期的に service_state からフラグを読み直します。
+func (s *Server) RefreshFeatureFlags(ctx context.Context, st store.StateStore) {
+	ticker := time.NewTicker(featureFlagRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.flags.Load(ctx, st); err != nil {
+			s.logger.Warn("機能フラグ読み込みエラー", "func", "refreshFeatureFlags", "error", err)
+		}
+	}
+}
+
+// featureFlagRequest は PUT /admin/flags/{name} のリクエストボディです。
+type featureFlagRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// listFeatureFlagsHandler は全フラグの現在値を返します。
+func (s *Server) listFeatureFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	values := s.flags.values()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type flagValue struct {
+		Name    string `json:"name"`
+		Enabled bool   `json:"enabled"`
+		Default bool   `json:"default"`
+	}
+	resp := make([]flagValue, 0, len(names))
+	for _, name := range names {
+		resp = append(resp, flagValue{Name: name, Enabled: values[name], Default: featureFlagDefaults[name]})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "listFeatureFlagsHandler", "error", err)
+	}
+}
+
+// setFeatureFlagHandler はフラグの値を実行時に変更します。変更は監査ログに記録します。
+func (s *Server) setFeatureFlagHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, defined := featureFlagDefaults[name]; !defined {
+		writeJSONError(w, http.StatusNotFound, errCodeUnknownFeatureFlag, "Unknown feature flag")
+		return
+	}
+	var req featureFlagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		writeJSONError(w, http.StatusBadRequest, errCodeInvalidRequest, "Invalid request")
+		return
+	}
+
+	previous := s.flags.enabled(name)
+	if err := s.flags.set(r.Context(), s.Store, name, *req.Enabled); err != nil {
+		s.logger.ErrorContext(r.Context(), "機能フラグ更新エラー", "func", "setFeatureFlagHandler", "flag", name, "error", err)
+		metrics.HandlerErrors.WithLabelValues("flags").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to update feature flag")
+		return
+	}
+	s.logger.InfoContext(r.Context(), "feature flag changed", "flag", name, "from", previous, "to", *req.Enabled, "client_ip", s.clientIP(r))
+	s.auditAdminOperation(r.Context(), auditFeatureFlagChanged, nil, map[string]interface{}{"flag": name, "from": previous, "to": *req.Enabled})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// setFlag は PUT /admin/flags/{name} で機能フラグを変更します。
+func (ts *testServer) setFlag(t *testing.T, name string, enabled bool) {
+	t.Helper()
+	rec := serve(t, ts.AdminHandler(), "PUT", "/admin/flags/"+name, map[string]bool{"enabled": enabled}, adminHeader())
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("set %s: status %d: %s", name, rec.Code, rec.Body)
+	}
+}
+
+// 実行時に変更したフラグは再起動せずに次のマッチングから反映する
+func TestFeatureFlagFlipTakesEffectAtRuntime(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.setFlag(t, flagCrossRegionMatching, false)
+
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice", "region": "asia", "timeout_seconds": 60})
+	ts.waitQueued(t, 1)
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob", "region": "eu", "timeout_seconds": 60})
+	ts.waitQueued(t, 2)
+	ts.clock.Advance(ts.cfg.Queue.CrossRegionFallback)
+	if cycle := ts.tick(t); cycle.Matched != 0 {
+		t.Fatalf("tick with cross_region_matching disabled created %d sessions, want 0", cycle.Matched)
+	}
+
+	ts.setFlag(t, flagCrossRegionMatching, true)
+	rec := serve(t, ts.AdminHandler(), "GET", "/admin/flags", nil, adminHeader())
+	var listed []struct {
+		Name    string `json:"name"`
+		Enabled bool   `json:"enabled"`
+	}
+	decodeJSON(t, rec, &listed)
+	for _, f := range listed {
+		if f.Name == flagCrossRegionMatching && !f.Enabled {
+			t.Fatalf("GET /admin/flags reports %s disabled after enabling it", f.Name)
+		}
+	}
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick after enabling cross_region_matching created %d sessions, want 1", cycle.Matched)
+	}
+	receive(t, alice)
+	receive(t, bob)
+
+	if rec := serve(t, ts.AdminHandler(), "PUT", "/admin/flags/no_such_flag", map[string]bool{"enabled": true}, adminHeader()); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown flag: status %d, want 404", rec.Code)
+	}
+}
+
+// 実行時の変更は service_state に保存し、再起動したインスタンスでも環境変数の設定より優先する
+func TestFeatureFlagPersistsAcrossRestart(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.setFlag(t, flagBestPairing, true)
+
+	// 再起動したインスタンスは起動時に環境変数の設定を適用してから service_state を読み込む
+	restarted := NewFeatureFlags()
+	if err := restarted.ApplyConfig(flagBestPairing + "=false"); err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.Load(context.Background(), ts.store); err != nil {
+		t.Fatal(err)
+	}
+	if !restarted.enabled(flagBestPairing) {
+		t.Fatal("best_pairing disabled after a restart, want the runtime change kept")
+	}
+	// 変更していないフラグは既定値のまま
+	if restarted.enabled(flagExplainCapture) != featureFlagDefaults[flagExplainCapture] {
+		t.Errorf("explain_capture = %v, want the default", restarted.enabled(flagExplainCapture))
+	}
+}
+
+// フラグの変更は変更前後の値とともに監査イベントに記録し、GET /admin/audit で確認できる
+func TestFeatureFlagChangeIsAudited(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.setFlag(t, flagCrossRegionMatching, false)
+	ts.clock.Advance(ts.auditSettleWindow() + time.Second)
+
+	events := ts.auditEvents(t, "").Events
+	if len(events) != 1 {
+		t.Fatalf("events = %+v, want one feature flag change", events)
+	}
+	e := events[0]
+	if e.Actor != "admin:secret" || e.Action != auditFeatureFlagChanged || e.SubjectPlayerID != "" {
+		t.Fatalf("event = %+v, want admin:secret %s without a subject", e, auditFeatureFlagChanged)
+	}
+	if e.Details["flag"] != flagCrossRegionMatching || e.Details["from"] != true || e.Details["to"] != false {
+		t.Fatalf("details = %v, want %s from true to false", e.Details, flagCrossRegionMatching)
+	}
+}
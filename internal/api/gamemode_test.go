@@ -0,0 +1,149 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// writeGameModes は GAME_MODES_FILE の形式の JSON を一時ファイルに書き込み、そのパスを返します。
+func writeGameModes(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "modes.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const multiQueueModes = `{
+	"duel": {"lobby_size": 2, "teams": 2, "rating_window": 100, "timeout_seconds": 30},
+	"2v2":  {"lobby_size": 4, "teams": 2, "rating_window": 200, "timeout_seconds": 45},
+	"3v3":  {"lobby_size": 6, "teams": 2, "rating_window": 300, "timeout_seconds": 60}
+}`
+
+// 設定した複数のゲームモードを1回の確認でそれぞれ独立してマッチングする
+func TestMultipleQueuesMatchIndependently(t *testing.T) {
+	modes, err := queue.LoadGameModes(writeGameModes(t, multiQueueModes), time.Second, 120*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.Queue.GameModes = modes
+		cfg.PlayerRateLimit = ratelimit.Config{}
+		cfg.IPRateLimit = ratelimit.Config{}
+	})
+
+	if rec := ts.do(t, "POST", "/matchmaking", map[string]interface{}{"id": "zed", "game_mode": "ffa4"}, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unconfigured mode: status %d, want 400: %s", rec.Code, rec.Body)
+	} else {
+		var resp ErrorResponse
+		decodeJSON(t, rec, &resp)
+		if resp.Error.Code != errCodeUnknownGameMode || !slices.Equal(resp.Error.ValidModes, []string{"2v2", "3v3", "duel"}) {
+			t.Fatalf("error = %+v, want unknown_game_mode listing the configured modes", resp.Error)
+		}
+	}
+
+	// 各モードに1ロビー分と1人を登録する（余った1人はどのモードでもマッチングしない）
+	done := make(map[string][]<-chan *httptest.ResponseRecorder)
+	queued := 0
+	for _, mode := range []string{"duel", "2v2", "3v3"} {
+		for i := range modes[mode].LobbySize + 1 {
+			done[mode] = append(done[mode], ts.startEnqueue(t, map[string]interface{}{"id": fmt.Sprintf("%s-%d", mode, i), "game_mode": mode}))
+			queued++
+			ts.waitQueued(t, queued)
+		}
+	}
+	if cycle := ts.tick(t); cycle.Matched != 3 {
+		t.Fatalf("tick created %d sessions, want one per mode", cycle.Matched)
+	}
+
+	for mode, chans := range done {
+		size := modes[mode].LobbySize
+		for _, ch := range chans[:size] {
+			rec := receive(t, ch)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s: status %d: %s", mode, rec.Code, rec.Body)
+			}
+			var session model.SessionResult
+			decodeJSON(t, rec, &session)
+			if session.GameMode != mode || len(session.Participants) != size {
+				t.Fatalf("%s session = %s with %d players, want %d players", mode, session.GameMode, len(session.Participants), size)
+			}
+		}
+	}
+	if got := ts.queuedIDs(t); !slices.Equal(sortedCopy(got), []string{"2v2-4", "3v3-6", "duel-2"}) {
+		t.Fatalf("queued = %v, want the last player of each mode", got)
+	}
+}
+
+// sortedCopy は ids を並べ替えたコピーを返します。
+func sortedCopy(ids []string) []string {
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	return ids
+}
+
+// quickModes は広いレーティングの範囲・短い待機時間の quick と、狭い範囲・長い待機時間の ranked を読み込みます。
+func quickModes(t *testing.T) queue.Modes {
+	t.Helper()
+	modes, err := queue.LoadGameModes(writeGameModes(t, `{
+		"duel":   {"lobby_size": 2, "teams": 2},
+		"quick":  {"lobby_size": 2, "teams": 2, "rating_window": 500, "timeout_seconds": 1, "poll_priority": 2},
+		"ranked": {"lobby_size": 2, "teams": 2, "rating_window": 100, "timeout_seconds": 3, "poll_priority": 1}
+	}`), time.Second, 120*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return modes
+}
+
+// 相手がいない場合、quick の待機は ranked より先にそのモードの待機時間で打ち切り、GET /modes は各モードの設定を返す
+func TestQuickMatchTimesOutBeforeRanked(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.Queue.GameModes = quickModes(t)
+		cfg.Queue.MinTimeout = time.Second
+		cfg.PlayerRateLimit = ratelimit.Config{}
+	})
+
+	rec := ts.do(t, "GET", "/modes", nil, nil)
+	var resp queue.ModesResponse
+	decodeJSON(t, rec, &resp)
+	got := make(map[string]queue.GameModeStatus)
+	for _, m := range resp.Modes {
+		got[m.Name] = m
+	}
+	if q, r := got["quick"], got["ranked"]; q.RatingWindow != 500 || q.TimeoutSeconds != 1 || r.RatingWindow != 100 || r.TimeoutSeconds != 3 {
+		t.Fatalf("modes = %+v, want quick with 500 and 1s, ranked with 100 and 3s", resp.Modes)
+	}
+
+	start := time.Now()
+	ranked := ts.startEnqueue(t, map[string]interface{}{"id": "alice", "game_mode": "ranked"})
+	quick := ts.startEnqueue(t, map[string]interface{}{"id": "bob", "game_mode": "quick"})
+	rec = receive(t, quick)
+	if rec.Code != http.StatusGatewayTimeout || rec.Header().Get("X-Matchmaking-Timeout") != "1" {
+		t.Fatalf("quick: status %d, timeout header %q, want 504 after 1s: %s", rec.Code, rec.Header().Get("X-Matchmaking-Timeout"), rec.Body)
+	}
+	quickElapsed := time.Since(start)
+	select {
+	case rec := <-ranked:
+		t.Fatalf("ranked returned %d together with quick, want it still waiting", rec.Code)
+	default:
+	}
+	rec = receive(t, ranked)
+	if rec.Code != http.StatusGatewayTimeout || rec.Header().Get("X-Matchmaking-Timeout") != "3" {
+		t.Fatalf("ranked: status %d, timeout header %q, want 504 after 3s: %s", rec.Code, rec.Header().Get("X-Matchmaking-Timeout"), rec.Body)
+	}
+	if rankedElapsed := time.Since(start); rankedElapsed < quickElapsed+time.Second {
+		t.Fatalf("ranked timed out after %v, quick after %v, want ranked well after quick", rankedElapsed, quickElapsed)
+	}
+}
@@ -0,0 +1,303 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/secret"
+	"matchmaking_project/internal/store"
+	pb "matchmaking_project/proto/matchmakingpb"
+)
+
+// grpcMatchmaking は Matchmaking の gRPC サービスです。
+// HTTP のハンドラと同じ待機キュー・マッチングプロセッサーの処理（joinQueue・cancelQueue・reportResult）を使います。
+type grpcMatchmaking struct {
+	pb.UnimplementedMatchmakingServer
+	s *Server
+}
+
+// GRPCServer は Matchmaking サービスとリフレクション（grpcurl 向け）を登録した gRPC サーバを返します。
+// base がキャンセルされると、待機中の Enqueue のストリームもその原因（ErrServerShutdown）でキャンセルし、待機キューから削除します。
+func (s *Server) GRPCServer(base context.Context, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(s.grpcUnaryInterceptor), grpc.ChainStreamInterceptor(s.grpcStreamInterceptor(base)))
+	srv := grpc.NewServer(opts...)
+	pb.RegisterMatchmakingServer(srv, &grpcMatchmaking{s: s})
+	reflection.Register(srv)
+	return srv
+}
+
+// grpcAuthenticate はメタデータの認証情報を HTTP のヘッダーと同じ規則で検証し、認証した主体を格納した context を返します。
+// ReportResult は POST /sessions/{id}/result と同じく共有シークレットまたは admin のトークンで、
+// それ以外は API キー（APIKeys を設定した場合）とプレイヤーのトークン（PlayerTokenKeys を設定した場合）で認証します。
+// リフレクションなど Matchmaking 以外のサービスは認証しません。
+func (s *Server) grpcAuthenticate(ctx context.Context, method string) (context.Context, error) {
+	if !strings.HasPrefix(method, "/"+pb.Matchmaking_ServiceDesc.ServiceName+"/") {
+		return ctx, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	h := make(http.Header, len(md))
+	for k, v := range md {
+		h[http.CanonicalHeaderKey(k)] = v
+	}
+
+	if method == pb.Matchmaking_ReportResult_FullMethodName {
+		actor, ok := s.authenticateAdmin(h)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "missing or invalid admin secret")
+		}
+		return withAuditActor(ctx, actor), nil
+	}
+	if len(s.cfg.APIKeys) > 0 {
+		key := s.requestAPIKey(h)
+		service, ok := secret.LookupSecret(s.cfg.APIKeys, key)
+		if key == "" || !ok {
+			return nil, status.Error(codes.Unauthenticated, "missing or invalid API key")
+		}
+		ctx = context.WithValue(ctx, serviceKey{}, service)
+	}
+	if s.cfg.PlayerTokenKeys != nil {
+		claims, err := verifyJWT(s.cfg.PlayerTokenKeys, bearerToken(h), time.Now())
+		if err != nil || claims.Subject == "" {
+			return nil, status.Error(codes.Unauthenticated, "missing, invalid or expired player token")
+		}
+		ctx = context.WithValue(ctx, playerKey{}, claims.Subject)
+	}
+	return ctx, nil
+}
+
+// grpcUnaryInterceptor は単項の RPC を認証します。
+func (s *Server) grpcUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.grpcAuthenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// grpcStreamInterceptor はストリームの RPC を認証し、base がキャンセルされた場合にストリームの context もその原因でキャンセルします。
+// HTTP サーバの BaseContext と同じく、サーバの停止で待機を終えたことを abandonReason で区別するためです。
+func (s *Server) grpcStreamInterceptor(base context.Context) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := s.grpcAuthenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+		stop := context.AfterFunc(base, func() { cancel(context.Cause(base)) })
+		defer stop()
+		return handler(srv, &grpcServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// grpcServerStream は Context を差し替えた grpc.ServerStream です。
+type grpcServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *grpcServerStream) Context() context.Context {
+	return ss.ctx
+}
+
+// grpcError は HTTP のハンドラがステータスコードに変換するエラーを、gRPC のステータスに変換します。
+// 該当しないエラーは Internal とし、内容は返しません（呼び出し側でログに残してください）。
+func grpcError(err error) error {
+	var modeErr *queue.UnknownGameModeError
+	var closedErr *queue.ModeClosedError
+	var fe *model.FieldError
+	var banned *playerBannedError
+	var cooldown *playerCooldownError
+	var inSession *store.ActiveSessionError
+	switch {
+	case errors.Is(err, model.ErrAlreadyQueued):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, store.ErrQueueFull), errors.Is(err, errEnqueueBusy):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, errPlayerMismatch), errors.As(err, &banned), errors.As(err, &cooldown), errors.As(err, &closedErr):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.As(err, &inSession), errors.Is(err, store.ErrSessionNotActive):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.As(err, &modeErr), errors.As(err, &fe):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, model.ErrSessionNotFound), errors.Is(err, store.ErrNotQueued):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+// Enqueue は待機キューへ登録し、登録の完了（queued）と、マッチングの成立（match）または待機キューからの削除（removed）をストリームで送ります。
+// ストリームがキャンセルされた場合は、HTTP のクライアントの切断と同じく待機キューから削除します。
+func (g *grpcMatchmaking) Enqueue(req *pb.EnqueueRequest, stream pb.Matchmaking_EnqueueServer) error {
+	s := g.s
+	ctx := stream.Context()
+	mreq := matchmakingRequest{ID: req.GetPlayerId(), PartyID: req.GetPartyId(), GameMode: req.GetGameMode(), Region: req.GetRegion(), MaxLifetimeSeconds: int(req.GetMaxLifetimeSeconds())}
+	for _, id := range req.GetPlayers() {
+		mreq.Players = append(mreq.Players, model.Player{ID: id})
+	}
+	if err := authorizeMatchmakingRequest(ctx, &mreq); err != nil {
+		return grpcError(err)
+	}
+	entry, err := s.newQueueEntry(mreq)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	q, err := s.joinQueue(ctx, entry)
+	if err != nil {
+		if ctx.Err() != nil {
+			// 登録中にストリームがキャンセルされた（待機キューからは joinQueue で削除済み）
+			return status.FromContextError(context.Cause(ctx)).Err()
+		}
+		if st := grpcError(err); status.Code(st) != codes.Internal {
+			return st
+		}
+		s.logger.ErrorContext(ctx, "待機登録エラー", "func", "Enqueue", "entry", entry.Key(), "error", err)
+		metrics.HandlerErrors.WithLabelValues("matchmaking").Inc()
+		return status.Error(codes.Internal, "failed to register waiting player")
+	}
+	defer q.close()
+	entry, key := q.Entry, q.Key
+	s.logger.InfoContext(ctx, "registered for matchmaking", "entry", key, "player_ids", model.PlayerIDs(entry.Players), "mode", entry.GameMode, "region", entry.Region, "transport", "grpc")
+
+	// leave はクライアントが待機をやめた場合に待機キューから削除します（購読は defer で解除する）。
+	leave := func(err error) error {
+		label, reason := abandonReason(ctx)
+		q.leave(ctx, "cancelled")
+		metrics.MatchmakingAbandoned.WithLabelValues(label).Inc()
+		s.Events.Cancel(entry, reason, s.now())
+		s.logger.InfoContext(ctx, "matchmaking stream closed", "entry", key, "mode", entry.GameMode, "reason", reason, "error", err, "transport", "grpc")
+		return err
+	}
+	queued := &pb.Queued{WaitingSince: timestamppb.New(entry.WaitingSince), ExpiresAt: timestamppb.New(entry.ExpiresAt)}
+	if err := stream.Send(&pb.MatchEvent{Event: &pb.MatchEvent_Queued{Queued: queued}}); err != nil {
+		return leave(err)
+	}
+
+	// 有効期限を過ぎたエントリはマッチングされないため、期限でストリームを終える
+	expired := time.NewTimer(entry.ExpiresAt.Sub(s.now()))
+	defer expired.Stop()
+	select {
+	case session := <-q.Matches:
+		switch session.Status {
+		case sessionRemovedByAdmin, sessionCancelled, queue.SessionModeClosed:
+			// 待機キューからは削除済み
+			s.logger.InfoContext(ctx, "matchmaking stream closed", "entry", key, "mode", entry.GameMode, "reason", session.Status, "transport", "grpc")
+			return stream.Send(&pb.MatchEvent{Event: &pb.MatchEvent_Removed{Removed: &pb.Removed{Reason: session.Status}}})
+		}
+		if err := stream.Send(&pb.MatchEvent{Event: &pb.MatchEvent_Match{Match: sessionProto(session)}}); err != nil {
+			q.undeliverable(ctx, session, err)
+			return err
+		}
+		return nil
+	case <-expired.C:
+		s.Events.Timeout(entry, s.now())
+		s.Webhook.enqueueEntry(webhookEventTimeout, entry, s.now())
+		q.leave(ctx, "entry expired")
+		metrics.MatchmakingCancellations.Inc()
+		s.logger.InfoContext(ctx, "matchmaking stream closed", "entry", key, "mode", entry.GameMode, "reason", "entry expired", "transport", "grpc")
+		return status.Error(codes.DeadlineExceeded, "queue entry expired before a match was found")
+	case <-ctx.Done():
+		// クライアントのキャンセル、またはサーバの停止。再開用のトークンはないため、いずれの場合も待機キューから削除する
+		return leave(status.FromContextError(context.Cause(ctx)).Err())
+	}
+}
+
+// Cancel は待機をやめて待機キューから削除し、待機しているストリーム・リクエストへ removed（cancelled）を送らせます。
+func (g *grpcMatchmaking) Cancel(ctx context.Context, req *pb.CancelRequest) (*pb.CancelResponse, error) {
+	playerID, err := authorizedPlayerID(ctx, req.GetPlayerId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if err := model.ValidateID("player_id", playerID, "player id"); err != nil {
+		return nil, grpcError(err)
+	}
+	if err := g.s.cancelQueue(ctx, playerID); err != nil {
+		if st := grpcError(err); status.Code(st) != codes.Internal {
+			return nil, st
+		}
+		g.s.logger.ErrorContext(ctx, "待機キュー削除エラー", "func", "Cancel", "player_id", playerID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("matchmaking").Inc()
+		return nil, status.Error(codes.Internal, "failed to cancel matchmaking")
+	}
+	return &pb.CancelResponse{}, nil
+}
+
+// GetSession はセッションと参加者を返します。マッチトークンは参加者にだけ返します（GET /sessions/{id} と同じ）。
+func (g *grpcMatchmaking) GetSession(ctx context.Context, req *pb.GetSessionRequest) (*pb.Session, error) {
+	if err := model.SessionID(req.GetSessionId()).Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid session id")
+	}
+	session, err := g.s.Store.GetSession(ctx, req.GetSessionId())
+	if errors.Is(err, model.ErrSessionNotFound) {
+		return nil, grpcError(err)
+	}
+	if err != nil {
+		g.s.logger.ErrorContext(ctx, "セッション取得エラー", "func", "GetSession", "session_id", req.GetSessionId(), "error", err)
+		metrics.HandlerErrors.WithLabelValues("session").Inc()
+		return nil, status.Error(codes.Internal, "failed to get session")
+	}
+	if id, ok := playerFrom(ctx); !ok || !slices.Contains(session.HumanPlayerIDs(), id) {
+		session.MatchToken = ""
+	}
+	return sessionProto(session), nil
+}
+
+// ReportResult は確定済みのセッションの対戦結果を記録し、レーティングを更新したセッションを返します。
+func (g *grpcMatchmaking) ReportResult(ctx context.Context, req *pb.ReportResultRequest) (*pb.ReportResultResponse, error) {
+	session, err := g.s.reportResult(ctx, req.GetSessionId(), req.GetOutcome(), int(req.GetWinningTeam()))
+	if err != nil {
+		if st := grpcError(err); status.Code(st) != codes.Internal {
+			return nil, st
+		}
+		g.s.logger.ErrorContext(ctx, "対戦結果の記録エラー", "func", "ReportResult", "session_id", req.GetSessionId(), "error", err)
+		metrics.HandlerErrors.WithLabelValues("result").Inc()
+		return nil, status.Error(codes.Internal, "failed to record result")
+	}
+	return &pb.ReportResultResponse{Session: sessionProto(session)}, nil
+}
+
+// sessionProto はセッションを gRPC のメッセージに変換します。
+func sessionProto(session model.SessionResult) *pb.Session {
+	out := &pb.Session{
+		SessionId:   session.SessionID,
+		GameMode:    session.GameMode,
+		Region:      session.Region,
+		Status:      session.Status,
+		Quality:     int32(session.Quality),
+		Bots:        session.Bots,
+		MatchToken:  session.MatchToken,
+		Outcome:     session.Outcome,
+		WinningTeam: int32(session.WinningTeam),
+	}
+	if session.AcceptDeadline != nil {
+		out.AcceptDeadline = timestamppb.New(*session.AcceptDeadline)
+	}
+	for _, p := range session.Participants {
+		out.Participants = append(out.Participants, &pb.Participant{
+			Id:         p.ID,
+			Rating:     int32(p.Rating),
+			Team:       int32(p.Team),
+			PartyId:    p.PartyID,
+			ReadyState: p.ReadyState,
+			IsBot:      p.IsBot,
+			Requeued:   p.Requeued,
+		})
+	}
+	return out
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"matchmaking_project/internal/model"
+	pb "matchmaking_project/proto/matchmakingpb"
+)
+
+// startGRPC は ts の gRPC サーバをメモリ上の接続で起動し、クライアントと、サーバの停止（base のキャンセル）を行う関数を返します。
+func (ts *testServer) startGRPC(t *testing.T) (pb.MatchmakingClient, func()) {
+	t.Helper()
+	base, cancelBase := context.WithCancelCause(context.Background())
+	gs := ts.GRPCServer(base)
+	ln := bufconn.Listen(1 << 20)
+	go gs.Serve(ln)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shutdown := func() {
+		cancelBase(ErrServerShutdown)
+		gs.GracefulStop()
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		cancelBase(ErrServerShutdown)
+		gs.Stop()
+	})
+	return pb.NewMatchmakingClient(conn), shutdown
+}
+
+// enqueueGRPC は Enqueue のストリームを開き、queued を受け取ってからストリームを返します。
+func enqueueGRPC(t *testing.T, ctx context.Context, client pb.MatchmakingClient, req *pb.EnqueueRequest) pb.Matchmaking_EnqueueClient {
+	t.Helper()
+	stream, err := client.Enqueue(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("receive queued: %v", err)
+	}
+	if ev.GetQueued() == nil {
+		t.Fatalf("first event = %v, want queued", ev)
+	}
+	return stream
+}
+
+// recvGRPC は Enqueue のストリームの次のイベントを待ちます。
+func recvGRPC(t *testing.T, stream pb.Matchmaking_EnqueueClient) (*pb.MatchEvent, error) {
+	t.Helper()
+	type result struct {
+		ev  *pb.MatchEvent
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ev, err := stream.Recv()
+		done <- result{ev, err}
+	}()
+	select {
+	case r := <-done:
+		return r.ev, r.err
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not receive an event")
+		return nil, nil
+	}
+}
+
+func TestGRPCEnqueueStreamsMatch(t *testing.T) {
+	ts := newTestServer(t, nil)
+	client, _ := ts.startGRPC(t)
+	ctx := context.Background()
+
+	alice := enqueueGRPC(t, ctx, client, &pb.EnqueueRequest{PlayerId: "alice"})
+	bob := enqueueGRPC(t, ctx, client, &pb.EnqueueRequest{PlayerId: "bob"})
+	ts.waitQueued(t, 2)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+
+	var ids [2]string
+	for i, stream := range []pb.Matchmaking_EnqueueClient{alice, bob} {
+		ev, err := recvGRPC(t, stream)
+		if err != nil {
+			t.Fatalf("stream %d: %v", i, err)
+		}
+		if ev.GetMatch() == nil {
+			t.Fatalf("stream %d event = %v, want match", i, ev)
+		}
+		ids[i] = ev.GetMatch().GetSessionId()
+		if _, err := recvGRPC(t, stream); err != io.EOF {
+			t.Fatalf("stream %d after match: %v, want EOF", i, err)
+		}
+	}
+	if ids[0] == "" || ids[0] != ids[1] {
+		t.Fatalf("session ids = %q, %q, want the same session", ids[0], ids[1])
+	}
+}
+
+// ストリームのキャンセルは HTTP のクライアントの切断と同じく、待機キューから削除する
+func TestGRPCStreamCancellationDequeues(t *testing.T) {
+	ts := newTestServer(t, nil)
+	client, _ := ts.startGRPC(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := enqueueGRPC(t, ctx, client, &pb.EnqueueRequest{PlayerId: "alice"})
+	ts.waitQueued(t, 1)
+
+	cancel()
+	if _, err := recvGRPC(t, stream); status.Code(err) != codes.Canceled {
+		t.Fatalf("recv after cancel: %v, want Canceled", err)
+	}
+	ts.waitQueued(t, 0)
+}
+
+// サーバの停止時は待機中のストリームを終わらせ、待機キューから削除する（再開用のトークンがないため残さない）
+func TestGRPCShutdownDequeuesWaitingStream(t *testing.T) {
+	ts := newTestServer(t, nil)
+	client, shutdown := ts.startGRPC(t)
+
+	stream := enqueueGRPC(t, context.Background(), client, &pb.EnqueueRequest{PlayerId: "alice"})
+	ts.waitQueued(t, 1)
+
+	stopped := make(chan struct{})
+	go func() {
+		shutdown()
+		close(stopped)
+	}()
+	if _, err := recvGRPC(t, stream); err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("recv during shutdown: %v, want the stream to end with an error", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("graceful stop did not finish")
+	}
+	ts.waitQueued(t, 0)
+}
+
+func TestGRPCCancelEndsWaitingRequests(t *testing.T) {
+	ts := newTestServer(t, nil)
+	client, _ := ts.startGRPC(t)
+	ctx := context.Background()
+
+	stream := enqueueGRPC(t, ctx, client, &pb.EnqueueRequest{PlayerId: "alice"})
+	ts.waitQueued(t, 1)
+	if _, err := client.Cancel(ctx, &pb.CancelRequest{PlayerId: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	ev, err := recvGRPC(t, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.GetRemoved().GetReason() != sessionCancelled {
+		t.Fatalf("event = %v, want removed (cancelled)", ev)
+	}
+	ts.waitQueued(t, 0)
+
+	// HTTP の long-poll で待機しているプレイヤーも取り消せる
+	done := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 1)
+	if _, err := client.Cancel(ctx, &pb.CancelRequest{PlayerId: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if rec := receive(t, done); rec.Code != http.StatusConflict {
+		t.Fatalf("long-poll status %d, want 409: %s", rec.Code, rec.Body)
+	}
+
+	if _, err := client.Cancel(ctx, &pb.CancelRequest{PlayerId: "bob"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("cancel when not queued: %v, want NotFound", err)
+	}
+}
+
+func TestGRPCGetSessionAndReportResult(t *testing.T) {
+	ts := newTestServer(t, nil)
+	client, _ := ts.startGRPC(t)
+	ctx := context.Background()
+	session := ts.activeSession(t, "alice", "bob")
+
+	got, err := client.GetSession(ctx, &pb.GetSessionRequest{SessionId: session.SessionID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetStatus() != model.SessionActive || len(got.GetParticipants()) != 2 {
+		t.Fatalf("session = %v, want an active session with 2 participants", got)
+	}
+	if _, err := client.GetSession(ctx, &pb.GetSessionRequest{SessionId: string(model.NewSessionID())}); status.Code(err) != codes.NotFound {
+		t.Fatalf("unknown session: %v, want NotFound", err)
+	}
+
+	winner := session.Participants[0]
+	req := &pb.ReportResultRequest{SessionId: session.SessionID, WinningTeam: int32(winner.Team)}
+	if _, err := client.ReportResult(ctx, req); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("report without admin secret: %v, want Unauthenticated", err)
+	}
+	adminCtx := metadata.AppendToOutgoingContext(ctx, "x-admin-secret", "test-admin-secret")
+	resp, err := client.ReportResult(adminCtx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetSession().GetStatus() != model.SessionCompleted || resp.GetSession().GetWinningTeam() != int32(winner.Team) {
+		t.Fatalf("session = %v, want completed with winning team %d", resp.GetSession(), winner.Team)
+	}
+	profile, err := ts.store.GetPlayerProfile(ctx, winner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Rating <= winner.Rating {
+		t.Errorf("winner rating %d -> %d, want it to increase", winner.Rating, profile.Rating)
+	}
+	if _, err := client.ReportResult(adminCtx, req); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("second report: %v, want FailedPrecondition", err)
+	}
+}
+
+func TestGRPCRequiresAPIKey(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.APIKeys = map[string]string{"test-key": "game"} })
+	client, _ := ts.startGRPC(t)
+
+	if _, err := client.Cancel(context.Background(), &pb.CancelRequest{PlayerId: "alice"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("without API key: %v, want Unauthenticated", err)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "test-key")
+	if _, err := client.Cancel(ctx, &pb.CancelRequest{PlayerId: "alice"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("with API key: %v, want NotFound (not queued)", err)
+	}
+}
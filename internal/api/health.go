@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// readinessTimeout は readiness チェックで DB の応答を待つ最大時間です。
+const readinessTimeout = 2 * time.Second
+
+// processorStallTicks は何回分の処理間隔を過ぎてもマッチングプロセッサーが動かなければ停止しているとみなすかです。
+const processorStallTicks = 3
+
+// processorHeartbeat はマッチングプロセッサーが最後に処理した時刻と、次の処理までの待機時間を記録します。
+type processorHeartbeat struct {
+	last atomic.Int64 // UnixNano
+	wait atomic.Int64 // time.Duration
+}
+
+// beat は処理した時刻と次の処理までの待機時間を記録します。
+func (h *processorHeartbeat) beat(now time.Time, wait time.Duration) {
+	h.wait.Store(int64(wait))
+	h.last.Store(now.UnixNano())
+}
+
+// check はマッチングプロセッサーが停止していればエラーを返します。
+// 再試行の待機中（バックオフ中）に停止とみなさないよう、待機時間に処理間隔（interval）の processorStallTicks 倍を加えた時間まで待ちます。
+func (h *processorHeartbeat) check(now time.Time, interval time.Duration) error {
+	last := h.last.Load()
+	if last == 0 {
+		return fmt.Errorf("processor has not started")
+	}
+	since := now.Sub(time.Unix(0, last))
+	if since > time.Duration(h.wait.Load())+processorStallTicks*interval {
+		return fmt.Errorf("processor stalled: last tick %s ago", since.Round(time.Second))
+	}
+	return nil
+}
+
+// readinessResponse は /readyz のレスポンスボディです。
+type readinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// healthzHandler は liveness probe 用のハンドラです。サーバが起動していれば常に 200 を返します。
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// readyzHandler は readiness probe 用のハンドラです。
+// readinessTimeout 以内に DB へ Ping でき、マッチングプロセッサーが動いている場合のみ 200 を、それ以外は 503 を返します。
+// どちらのチェックが失敗したかはレスポンスボディの checks に記載します。
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	resp := readinessResponse{Status: "ok", Checks: map[string]string{"database": "ok", "processor": "ok"}}
+	if err := s.Store.Ping(ctx); err != nil {
+		// ドライバのエラーには接続先などが含まれるため、レスポンスには返さずログに出力する
+		s.logger.WarnContext(r.Context(), "readiness の DB 確認エラー", "func", "readyzHandler", "error", err)
+		resp.Status = "unavailable"
+		resp.Checks["database"] = "unreachable"
+	}
+	if err := s.heartbeat.check(time.Now(), s.cfg.ProcessorInterval); err != nil {
+		resp.Status = "unavailable"
+		resp.Checks["processor"] = err.Error()
+	}
+	// リーダー選出を行っている場合は役割（leader / standby）を返す。standby でも待機キューの受け付けはできるため ready とする
+	if role := s.Store.MatcherRole(); role != "" {
+		resp.Checks["matcher"] = role
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status != "ok" {
+		s.logger.WarnContext(r.Context(), "readiness check failed", "checks", resp.Checks)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"matchmaking_project/internal/store"
+)
+
+// unreachableStore は DB に接続できない状態を再現する Store です。
+type unreachableStore struct {
+	store.Store
+}
+
+func (unreachableStore) Ping(context.Context) error {
+	return errors.New("dial tcp 10.0.0.1:3306: connect: connection refused")
+}
+
+// readiness は GET /readyz のステータスコードとレスポンスを返します。
+func (ts *testServer) readiness(t *testing.T) (int, readinessResponse) {
+	t.Helper()
+	rec := ts.do(t, "GET", "/readyz", nil, nil)
+	var resp readinessResponse
+	decodeJSON(t, rec, &resp)
+	return rec.Code, resp
+}
+
+func TestReadinessChecksDatabase(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.heartbeat.beat(time.Now(), 0)
+
+	if code, resp := ts.readiness(t); code != http.StatusOK || resp.Checks["database"] != "ok" {
+		t.Fatalf("healthy DB: status %d, %+v, want 200", code, resp)
+	}
+
+	ts.Store = unreachableStore{Store: ts.store}
+	rec := ts.do(t, "GET", "/readyz", nil, nil)
+	// ドライバのエラー（接続先）はレスポンスに含めない
+	if strings.Contains(rec.Body.String(), "10.0.0.1") {
+		t.Fatalf("readiness response leaks the driver error: %s", rec.Body)
+	}
+	var resp readinessResponse
+	decodeJSON(t, rec, &resp)
+	if rec.Code != http.StatusServiceUnavailable || resp.Checks["database"] != "unreachable" || resp.Checks["processor"] != "ok" {
+		t.Fatalf("unreachable DB: status %d, %+v, want 503 and only the database unreachable", rec.Code, resp)
+	}
+	if rec := ts.do(t, "GET", "/healthz", nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("liveness with an unreachable DB: status %d, want 200", rec.Code)
+	}
+}
+
+// closedDBStore は接続プールを閉じた後の DB に Ping する Store です。
+type closedDBStore struct {
+	store.Store
+	db *sql.DB
+}
+
+func (s closedDBStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func TestReadinessClosedDatabase(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.heartbeat.beat(time.Now(), 0)
+	// 接続先には接続しない（sql.Open は接続を確立せず、閉じた後の Ping は接続前に失敗する）
+	db, err := sql.Open("mysql", "user:pass@tcp(127.0.0.1:1)/matchmaking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	ts.Store = closedDBStore{Store: ts.store, db: db}
+
+	if code, resp := ts.readiness(t); code != http.StatusServiceUnavailable || resp.Checks["database"] != "unreachable" {
+		t.Fatalf("closed DB: status %d, %+v, want 503 and the database unreachable", code, resp)
+	}
+}
+
+func TestReadinessDetectsStalledProcessor(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.ProcessorInterval = time.Second })
+
+	if code, resp := ts.readiness(t); code != http.StatusServiceUnavailable || resp.Checks["processor"] == "ok" {
+		t.Fatalf("processor not started: status %d, %+v, want 503", code, resp)
+	}
+
+	// 処理間隔の3倍を過ぎても処理しなければ停止とみなす
+	ts.heartbeat.beat(time.Now().Add(-2*time.Second), 0)
+	if code, resp := ts.readiness(t); code != http.StatusOK {
+		t.Fatalf("processor ticked 2s ago: status %d, %+v, want 200", code, resp)
+	}
+	ts.heartbeat.beat(time.Now().Add(-10*time.Second), 0)
+	code, resp := ts.readiness(t)
+	if code != http.StatusServiceUnavailable || !strings.Contains(resp.Checks["processor"], "stalled") || resp.Checks["database"] != "ok" {
+		t.Fatalf("stalled processor: status %d, %+v, want 503 and only the processor stalled", code, resp)
+	}
+
+	// 再試行の待機中（バックオフ中）は停止とみなさない
+	ts.heartbeat.beat(time.Now().Add(-10*time.Second), 30*time.Second)
+	if code, resp := ts.readiness(t); code != http.StatusOK {
+		t.Fatalf("processor backing off: status %d, %+v, want 200", code, resp)
+	}
+}
+
+// probe 用のエンドポイントは CORS のプリフライトや認証の対象にしない
+func TestProbesBypassCORSAndAuth(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.APIKeys = map[string]string{"secret-key": "lobby"} })
+	ts.heartbeat.beat(time.Now(), 0)
+	for _, path := range []string{"/healthz", "/readyz"} {
+		if rec := ts.do(t, "GET", path, nil, nil); rec.Code != http.StatusOK {
+			t.Errorf("GET %s without an API key: status %d, want 200", path, rec.Code)
+		}
+		header := make(http.Header)
+		header.Set("Origin", "https://evil.example")
+		header.Set("Access-Control-Request-Method", "GET")
+		rec := ts.do(t, "OPTIONS", path, nil, header)
+		if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("OPTIONS %s returned CORS headers", path)
+		}
+	}
+}
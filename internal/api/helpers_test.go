@@ -0,0 +1,319 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/secret"
+	"matchmaking_project/internal/store"
+)
+
+// testEpoch はテストの時計の開始時刻です。
+var testEpoch = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testClock はテストから進められる時計です。Server と MemoryStore に同じ時計を渡します。
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: testEpoch}
+}
+
+// Now は現在の時刻を返します。
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance は時計を d だけ進めます。
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// testServer は MemoryStore とテストの時計で組み立てた Server です。
+type testServer struct {
+	*Server
+	clock *testClock
+	store *store.MemoryStore
+}
+
+// newTestServer は既定の設定を configure で変更して Server を生成します。
+// パッケージの変数には依存しないため、テストごとに独立したサーバになります。
+func newTestServer(t testing.TB, configure func(*Config)) *testServer {
+	t.Helper()
+	clock := newTestClock()
+	cfg := DefaultConfig()
+	cfg.Now = clock.Now
+	cfg.AdminSecret = "test-admin-secret"
+	if configure != nil {
+		configure(&cfg)
+	}
+	storeCfg := store.DefaultConfig()
+	storeCfg.Now = clock.Now
+	storeCfg.RatingSeeds = cfg.RatingSeeds
+	storeCfg.MaxQueueSize = cfg.MaxQueueSize
+	st := store.NewMemoryStore(storeCfg)
+	matcher, err := queue.NewMatcher(queue.MatchStrategyRatingWindow, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return &testServer{Server: NewServer(st, matcher, logger, cfg), clock: clock, store: st}
+}
+
+// sibling は ts と同じ Store と時計を使う別のインスタンスの Server を生成します（複数インスタンスでの運用の確認用）。
+func (ts *testServer) sibling(t *testing.T) *testServer {
+	t.Helper()
+	matcher, err := queue.NewMatcher(queue.MatchStrategyRatingWindow, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return &testServer{Server: NewServer(ts.store, matcher, logger, ts.cfg), clock: ts.clock, store: ts.store}
+}
+
+// logBuffer は複数のゴルーチンから書き込まれるログを保持します。
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs は Server のログを本番と同じ JSON 形式で記録する logBuffer を返します。バックグラウンド処理を開始する前に呼び出します。
+func (ts *testServer) captureLogs(level slog.Level) *logBuffer {
+	b := &logBuffer{}
+	ts.logger = newLogger(b, level, "json")
+	return b
+}
+
+// records は記録したログを1行ずつ JSON として返します。
+func (b *logBuffer) records(t *testing.T) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+// do は Server にリクエストを送り、レスポンスを返します。body が nil でなければ JSON で送ります。
+func (ts *testServer) do(t *testing.T, method, path string, body interface{}, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	return serve(t, ts.Server, method, path, body, header)
+}
+
+// serve は h にリクエストを送り、レスポンスを返します。
+func serve(t *testing.T, h http.Handler, method, path string, body interface{}, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, r)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// startEnqueue は POST /matchmaking を別の goroutine で送り、long-poll の結果を返すチャネルを返します。
+func (ts *testServer) startEnqueue(t *testing.T, body interface{}) <-chan *httptest.ResponseRecorder {
+	t.Helper()
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- serve(t, ts.Server, "POST", "/matchmaking", body, nil)
+	}()
+	return done
+}
+
+// startEnqueueContext は startEnqueue と同じく POST /matchmaking を送りますが、ctx をリクエストの context にします。
+// ctx をキャンセルすると、クライアントが切断した場合と同じくリクエストの context が終わります。
+func (ts *testServer) startEnqueueContext(t *testing.T, ctx context.Context, body interface{}) <-chan *httptest.ResponseRecorder {
+	t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		ts.Server.ServeHTTP(rec, httptest.NewRequestWithContext(ctx, "POST", "/matchmaking", bytes.NewReader(b)))
+		done <- rec
+	}()
+	return done
+}
+
+// waitQueued は待機キューのプレイヤーが n 人になるまで待ちます。
+func (ts *testServer) waitQueued(t *testing.T, n int) {
+	t.Helper()
+	waitFor(t, fmt.Sprintf("%d queued players", n), func() bool { return len(ts.queuedIDs(t)) == n })
+}
+
+// waitFor は cond が true を返すまで待ちます。別の goroutine で処理中のリクエストの結果を待つために使います。
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// tick はマッチングプロセッサーの1回分の確認を実行します。
+func (ts *testServer) tick(t *testing.T) queue.MatchCycle {
+	t.Helper()
+	cycle, err := ts.runMatchmaking(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cycle
+}
+
+// matchPair は a と b を待機キューへ登録して1回マッチングし、2人に届いたセッションを返します。
+func (ts *testServer) matchPair(t *testing.T, a, b string) model.SessionResult {
+	t.Helper()
+	queued := len(ts.queuedIDs(t))
+	first := ts.startEnqueue(t, map[string]interface{}{"id": a})
+	ts.waitQueued(t, queued+1)
+	second := ts.startEnqueue(t, map[string]interface{}{"id": b})
+	ts.waitQueued(t, queued+2)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+	var sessions [2]model.SessionResult
+	for i, done := range []<-chan *httptest.ResponseRecorder{first, second} {
+		rec := receive(t, done)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("enqueue %d: status %d: %s", i, rec.Code, rec.Body)
+		}
+		decodeJSON(t, rec, &sessions[i])
+	}
+	if sessions[0].SessionID == "" || sessions[0].SessionID != sessions[1].SessionID {
+		t.Fatalf("session ids = %q, %q, want the same session", sessions[0].SessionID, sessions[1].SessionID)
+	}
+	return sessions[0]
+}
+
+// queuedPlayers は待機キューのプレイヤーを待機開始の古い順に返します。
+func (ts *testServer) queuedPlayers(t *testing.T) []store.QueuedPlayer {
+	t.Helper()
+	rows, err := ts.store.ListQueuedPlayers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+// queuedIDs は待機キューのプレイヤーIDを返します。
+func (ts *testServer) queuedIDs(t *testing.T) []string {
+	t.Helper()
+	rows := ts.queuedPlayers(t)
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	return ids
+}
+
+// receive は long-poll の結果を待ちます。
+func receive(t *testing.T, done <-chan *httptest.ResponseRecorder) *httptest.ResponseRecorder {
+	t.Helper()
+	select {
+	case rec := <-done:
+		return rec
+	case <-time.After(5 * time.Second):
+		t.Fatal("long-poll did not return")
+		return nil
+	}
+}
+
+// adminHeader は管理用エンドポイントの共有シークレットのヘッダーです。
+func adminHeader() http.Header {
+	return http.Header{adminSecretHeader: {"test-admin-secret"}}
+}
+
+// decodeJSON はレスポンスボディを v に読み込みます。
+func decodeJSON(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+		t.Fatalf("decode response %q: %v", rec.Body.String(), err)
+	}
+}
+
+// errorCode はエラーレスポンスのコード（error.code）を返します。
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var e ErrorResponse
+	decodeJSON(t, rec, &e)
+	return e.Error.Code
+}
+
+// playerToken は keys で署名した、subject のプレイヤーの1時間有効なトークン（Authorization ヘッダー）を返します。
+// トークンの有効期間は壁時計で検証するため、exp はテストの時計ではなく time.Now から決めます。
+func playerToken(t *testing.T, keys *secret.KeyRing, subject string) http.Header {
+	t.Helper()
+	return bearerHeader(signJWT(t, keys, "HS256", map[string]interface{}{"sub": subject, "exp": time.Now().Add(time.Hour).Unix()}))
+}
+
+// signJWT は alg をヘッダーに指定し、claims を keys で署名した JWT を返します。
+func signJWT(t *testing.T, keys *secret.KeyRing, alg string, claims map[string]interface{}) string {
+	t.Helper()
+	enc := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := enc(map[string]string{"alg": alg, "typ": "JWT"}) + "." + enc(claims)
+	return signed + "." + keys.Sign([]byte(signed))
+}
+
+// bearerHeader は token を Authorization: Bearer に設定したヘッダーを返します。
+func bearerHeader(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
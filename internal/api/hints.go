@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultHintLocale は Accept-Language に対応する言語がない場合に使う言語です。
+const defaultHintLocale = "en"
+
+// waitEstimateSmoothing は待機時間の推定値を更新する際の新しい値の重みです。
+const waitEstimateSmoothing = 0.2
+
+// TimeoutHints はキュー（ゲームモード）ごと・言語ごとのタイムアウト時のヒントのテンプレートです。
+// テンプレートでは次のプレースホルダーを使えます。
+//
+//	{queue}     タイムアウトしたキュー
+//	{alt_queue} 推定待ち時間が最も短い他のキュー
+//	{alt_wait}  そのキューの推定待ち時間（秒）
+//
+// 設定がないキューではヒントを返しません。
+type TimeoutHints map[string]map[string]string
+
+// DefaultTimeoutHints は TIMEOUT_HINTS_FILE を指定しない場合のヒントです。
+func DefaultTimeoutHints() TimeoutHints {
+	return TimeoutHints{
+		"ranked": {
+			"en": "{queue} is quiet right now — {alt_queue} has a {alt_wait} second wait",
+			"ja": "現在 {queue} は空いています。{alt_queue} の待ち時間は約 {alt_wait} 秒です",
+		},
+		"2v2": {
+			"en": "{queue} is quiet right now — {alt_queue} has a {alt_wait} second wait",
+			"ja": "現在 {queue} は空いています。{alt_queue} の待ち時間は約 {alt_wait} 秒です",
+		},
+	}
+}
+
+// LoadTimeoutHints は JSON ファイル（{"キュー": {"言語": "テンプレート"}}）からヒントのテンプレートを読み込みます。
+func LoadTimeoutHints(filename string) (TimeoutHints, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ヒント設定ファイル読み込みエラー: %v", err)
+	}
+	var templates TimeoutHints
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("ヒント設定ファイル解析エラー: %v", err)
+	}
+	return templates, nil
+}
+
+// waitEstimator はマッチング成立までの待機時間をキューごとに推定します。
+// マッチングプロセッサーが成立時に更新し、タイムアウト時のヒントは DB を参照せずにこの値を使います。
+type waitEstimator struct {
+	mu        sync.RWMutex
+	estimates map[string]time.Duration
+}
+
+// newWaitEstimator は推定値のない waitEstimator を生成します。
+func newWaitEstimator() *waitEstimator {
+	return &waitEstimator{estimates: make(map[string]time.Duration)}
+}
+
+// Observe はキューでマッチングが成立した際の待機時間を推定値に反映します。
+func (e *waitEstimator) Observe(mode string, wait time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	current, ok := e.estimates[mode]
+	if !ok {
+		e.estimates[mode] = wait
+		return
+	}
+	e.estimates[mode] = current + time.Duration(waitEstimateSmoothing*float64(wait-current))
+}
+
+// estimate はキューの推定待ち時間を返します。まだマッチングが成立していないキューでは ok が false になります。
+func (e *waitEstimator) estimate(mode string) (time.Duration, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	wait, ok := e.estimates[mode]
+	return wait, ok
+}
+
+// shortestOther は queues のうち mode 以外で推定待ち時間が最も短いキューを返します。推定値がない場合は ok が false になります。
+func (e *waitEstimator) shortestOther(mode string, queues []string) (other string, wait time.Duration, ok bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, name := range queues {
+		estimate, known := e.estimates[name]
+		if name == mode || !known {
+			continue
+		}
+		if !ok || estimate < wait {
+			other, wait, ok = name, estimate, true
+		}
+	}
+	return other, wait, ok
+}
+
+// timeoutHints はキューのヒントのテンプレートを Accept-Language に合わせて選び、プレースホルダーを解決します。
+// テンプレートの設定がない場合や、他のキューの推定待ち時間がまだない場合は nil を返します。
+func (s *Server) timeoutHints(mode, acceptLanguage string) []string {
+	templates := s.cfg.TimeoutHints[mode]
+	if len(templates) == 0 {
+		return nil
+	}
+	template, ok := templates[hintLocale(acceptLanguage, templates)]
+	if !ok {
+		return nil
+	}
+	altQueue, altWait, ok := s.waitEstimates.shortestOther(mode, s.cfg.Queue.GameModes.Names())
+	if !ok {
+		return nil
+	}
+	hint := strings.NewReplacer(
+		"{queue}", mode,
+		"{alt_queue}", altQueue,
+		"{alt_wait}", fmt.Sprint(int(math.Ceil(altWait.Seconds()))),
+	).Replace(template)
+	return []string{hint}
+}
+
+// hintLocale は Accept-Language に列挙された言語のうち、テンプレートがある最初の言語を返します。
+// 品質値（q=）による並べ替えは行わず、記載順に優先します。該当がない場合は defaultHintLocale を返します。
+func hintLocale(acceptLanguage string, templates map[string]string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if _, ok := templates[lang]; ok {
+			return lang
+		}
+	}
+	return defaultHintLocale
+}
+
+// writeTimeoutResponse はマッチングのタイムアウトを、エラーコードとキューごとのヒント付きの JSON で返します。
+func (s *Server) writeTimeoutResponse(w http.ResponseWriter, r *http.Request, mode string) {
+	writeErrorResponse(w, http.StatusGatewayTimeout, ErrorDetail{
+		Code:    errCodeMatchmakingTimeout,
+		Message: "No opponent found within timeout",
+		Hints:   s.timeoutHints(mode, r.Header.Get("Accept-Language")),
+	})
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTimeoutHints(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.waitEstimates.Observe("casual", 4200*time.Millisecond)
+	ts.waitEstimates.Observe("duel", 30*time.Second)
+
+	for _, tc := range []struct {
+		name, mode, acceptLanguage string
+		want                       []string
+	}{
+		// 推定待ち時間が最も短い他のキューを、切り上げた秒数で案内する
+		{"english", "ranked", "en-US,en;q=0.9", []string{"ranked is quiet right now — casual has a 5 second wait"}},
+		{"japanese", "ranked", "ja-JP", []string{"現在 ranked は空いています。casual の待ち時間は約 5 秒です"}},
+		// テンプレートのない言語は、対応している次の言語か既定の英語にする
+		{"next listed locale", "ranked", "fr-FR, ja;q=0.5", []string{"現在 ranked は空いています。casual の待ち時間は約 5 秒です"}},
+		{"missing locale", "ranked", "fr-FR", []string{"ranked is quiet right now — casual has a 5 second wait"}},
+		{"no header", "ranked", "", []string{"ranked is quiet right now — casual has a 5 second wait"}},
+		// テンプレートの設定がないキューではヒントを返さない
+		{"queue without hints", "casual", "en", nil},
+		{"unknown queue", "ffa8", "en", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ts.timeoutHints(tc.mode, tc.acceptLanguage); !slices.Equal(got, tc.want) {
+				t.Fatalf("hints = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// 他のキューの推定待ち時間がまだない場合はヒントを返さない
+func TestTimeoutHintsWithoutEstimates(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.waitEstimates.Observe("ranked", 10*time.Second)
+	if got := ts.timeoutHints("ranked", "en"); got != nil {
+		t.Fatalf("hints = %q, want none", got)
+	}
+}
+
+func TestTimeoutResponseCarriesHints(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.TimeoutHints = TimeoutHints{"duel": {"en": "try {alt_queue} ({alt_wait}s) instead of {queue}"}}
+	})
+	ts.waitEstimates.Observe("casual", 3*time.Second)
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/matchmaking", nil)
+	r.Header.Set("Accept-Language", "de")
+	ts.writeTimeoutResponse(rec, r, "duel")
+	var resp ErrorResponse
+	decodeJSON(t, rec, &resp)
+	if resp.Error.Code != errCodeMatchmakingTimeout || !slices.Equal(resp.Error.Hints, []string{"try casual (3s) instead of duel"}) {
+		t.Fatalf("timeout response = %+v, want the timeout code and the resolved hint", resp.Error)
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// httpWriteTimeoutMargin は long-poll の最長の待機時間に加える、結果の書き込みのための余裕です。
+const httpWriteTimeoutMargin = 15 * time.Second
+
+// effectiveWriteTimeout は HTTP サーバに設定する書き込みの期限を返します。
+func (s *Server) effectiveWriteTimeout() time.Duration {
+	if s.cfg.HTTPWriteTimeout > 0 {
+		return s.cfg.HTTPWriteTimeout
+	}
+	return s.cfg.Queue.LongestTimeout() + httpWriteTimeoutMargin
+}
+
+// NewHTTPServer はタイムアウトとヘッダーの上限を設定した HTTP サーバを生成します。
+// tlsConfig が nil でなければ HTTPS で待ち受けます（証明書は TLSConfig.GetCertificate で読み込みます）。
+func (s *Server) NewHTTPServer(addr string, handler http.Handler, tlsConfig *tls.Config, base context.Context) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: s.cfg.HTTPReadHeaderTimeout,
+		ReadTimeout:       s.cfg.HTTPReadTimeout,
+		WriteTimeout:      s.effectiveWriteTimeout(),
+		IdleTimeout:       s.cfg.HTTPIdleTimeout,
+		MaxHeaderBytes:    s.cfg.HTTPMaxHeaderBytes,
+		BaseContext:       func(net.Listener) context.Context { return base },
+	}
+}
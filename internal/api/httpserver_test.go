@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/ratelimit"
+)
+
+// serveHTTP は srv を平文の HTTP で起動し、アドレスを返します。テストの終了時に停止します。
+func serveHTTP(t *testing.T, srv *http.Server) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+// HTTP サーバにはタイムアウトとヘッダーの上限を設定し、書き込みの期限は long-poll の最長の待機時間より長くする
+func TestHTTPServerConfig(t *testing.T) {
+	ts := newTestServer(t, nil)
+	srv := ts.NewHTTPServer(":0", ts.Server, nil, context.Background())
+	if srv.ReadHeaderTimeout != ts.cfg.HTTPReadHeaderTimeout || srv.ReadTimeout != ts.cfg.HTTPReadTimeout || srv.IdleTimeout != ts.cfg.HTTPIdleTimeout || srv.MaxHeaderBytes != ts.cfg.HTTPMaxHeaderBytes {
+		t.Fatalf("server timeouts %v/%v/%v, max header %d, want the configured values", srv.ReadHeaderTimeout, srv.ReadTimeout, srv.IdleTimeout, srv.MaxHeaderBytes)
+	}
+	for name, d := range map[string]time.Duration{"read header": srv.ReadHeaderTimeout, "read": srv.ReadTimeout, "idle": srv.IdleTimeout} {
+		if d <= 0 {
+			t.Errorf("%s timeout = %v, want a bound", name, d)
+		}
+	}
+	if srv.MaxHeaderBytes <= 0 || srv.MaxHeaderBytes >= http.DefaultMaxHeaderBytes {
+		t.Errorf("max header bytes = %d, want a bound below the default %d", srv.MaxHeaderBytes, http.DefaultMaxHeaderBytes)
+	}
+	if longest := ts.cfg.Queue.LongestTimeout(); srv.WriteTimeout != longest+httpWriteTimeoutMargin {
+		t.Errorf("write timeout = %v, want the longest matchmaking timeout %v plus %v", srv.WriteTimeout, longest, httpWriteTimeoutMargin)
+	}
+	if srv.TLSConfig != nil {
+		t.Errorf("TLS config = %+v, want plain HTTP without certificates", srv.TLSConfig)
+	}
+
+	// 明示した書き込みの期限はそのまま使う
+	ts = newTestServer(t, func(cfg *Config) { cfg.HTTPWriteTimeout = 10 * time.Minute })
+	if srv := ts.NewHTTPServer(":0", ts.Server, nil, context.Background()); srv.WriteTimeout != 10*time.Minute {
+		t.Errorf("write timeout = %v, want the configured 10m", srv.WriteTimeout)
+	}
+}
+
+// TLS を設定しなければ平文の HTTP で応答し、ヘッダーを送り終えない接続や大きすぎるヘッダーは打ち切る
+func TestHTTPServerPlain(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.HTTPReadHeaderTimeout = 100 * time.Millisecond
+		cfg.HTTPMaxHeaderBytes = 1 << 10
+	})
+	addr := serveHTTP(t, ts.NewHTTPServer("127.0.0.1:0", ts.Server, nil, context.Background()))
+
+	resp, err := http.Get("http://" + addr + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("plain HTTP: status %d, want 200", resp.StatusCode)
+	}
+
+	req, err := http.NewRequest("GET", "http://"+addr+"/healthz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Padding", strings.Repeat("a", 64<<10))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Fatalf("oversized header: status %d, want 431", resp.StatusCode)
+	}
+
+	// ヘッダーを途中までしか送らない接続（slowloris）は ReadHeaderTimeout で切断する
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "GET /healthz HTTP/1.1\r\nHost: x\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("connection was not closed by the server: %v", err)
+	}
+}
+
+// ヘッダーを送り終えない接続は切断するが、読み込みの期限より長く結果を待つ正当な long-poll は切断しない
+func TestHTTPServerKeepsLongPoll(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.HTTPReadHeaderTimeout = 100 * time.Millisecond
+		cfg.HTTPReadTimeout = 200 * time.Millisecond
+		cfg.PlayerRateLimit = ratelimit.Config{}
+	})
+	addr := serveHTTP(t, ts.NewHTTPServer("127.0.0.1:0", ts.Server, nil, context.Background()))
+
+	slow, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	if _, err := io.WriteString(slow, "POST /matchmaking HTTP/1.1\r\nHost: x\r\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		status int
+		err    error
+	}
+	poll := func(id string) <-chan result {
+		done := make(chan result, 1)
+		go func() {
+			resp, err := http.Post("http://"+addr+"/matchmaking", "application/json", strings.NewReader(`{"id":"`+id+`"}`))
+			if err != nil {
+				done <- result{err: err}
+				return
+			}
+			resp.Body.Close()
+			done <- result{status: resp.StatusCode}
+		}()
+		return done
+	}
+	alice := poll("alice")
+	ts.waitQueued(t, 1)
+	bob := poll("bob")
+	ts.waitQueued(t, 2)
+
+	// 読み込みの期限（200ms）とヘッダーの期限を過ぎてからマッチングする
+	time.Sleep(500 * time.Millisecond)
+	slow.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadAll(slow); err != nil {
+		t.Fatalf("slow-header connection was not closed: %v", err)
+	}
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+	for _, done := range []<-chan result{alice, bob} {
+		select {
+		case r := <-done:
+			if r.err != nil || r.status != http.StatusOK {
+				t.Fatalf("long-poll: status %d, err %v, want 200", r.status, r.err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("long-poll did not return")
+		}
+	}
+}
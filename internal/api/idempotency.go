@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+)
+
+// idempotencyKeyHeader はクライアントが再送を識別するために付けるヘッダーです。
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyReplayedHeader は保存したレスポンスを返したことを表すヘッダーです。
+const idempotencyReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength は Idempotency-Key の最大長です。
+const maxIdempotencyKeyLength = 255
+
+// idempotencyPollInterval は同じ Idempotency-Key のリクエストが処理中の場合に、その完了を Store で確認する間隔です。
+// 元のリクエストは別のインスタンスで処理していることがあるため、完了の通知ではなく Store の状態を確認します。
+const idempotencyPollInterval = 100 * time.Millisecond
+
+// idempotencyStorageKey は Idempotency-Key を Store に保存する際のキーです。
+// キーは API キーの呼び出し元サービスと本人確認したプレイヤーごとに区別し（別のプレイヤーが同じキーを送っても、互いのレスポンスは返しません）、
+// 長さをそろえるため SHA-256 にします。
+func idempotencyStorageKey(r *http.Request, key string) string {
+	player, _ := playerFrom(r.Context())
+	sum := sha256.Sum256([]byte(serviceFrom(r.Context()) + "\x00" + player + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotencyPendingTTL は処理中の Idempotency-Key を保持する時間です。処理したインスタンスが停止して完了も取り消しもされなかった場合に、
+// 再送を改めて処理できるようにするための期限で、最も長い待機時間より長くします。
+func (s *Server) idempotencyPendingTTL() time.Duration {
+	return s.cfg.Queue.LongestTimeout() + time.Minute
+}
+
+// idempotentMiddleware は Idempotency-Key 付きのリクエストを1回だけ処理するミドルウェアです。
+// 同じキーのリクエストが処理中であれば、その完了を待って同じレスポンス（マッチング結果）を返し、完了していれば保存したレスポンスを返します。
+// 待っている間に元のリクエストが保存されずに終わった場合（切断・5xx）は、待っていたリクエストが改めて処理します。
+// 同じキーで異なるボディが送られた場合は 422 を返します。クライアントが切断したリクエストと 5xx のレスポンスは保存しません（再送で処理し直すため）。
+// 状態は Store に保存するため、別のインスタンスへの再送も対象です。IdempotencyTTL が 0 の場合はキーを無視します。
+func (s *Server) idempotentMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if s.cfg.IdempotencyTTL <= 0 || key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeQueueEntryError(w, &model.FieldError{Field: idempotencyKeyHeader, Message: "Idempotency-Key must be at most 255 characters"})
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+		if err != nil {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, errCodeRequestTooLarge, "Request body is too large")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(body)
+		stored := idempotencyStorageKey(r, key)
+		ctx := r.Context()
+
+		for {
+			e, found, err := s.Store.BeginIdempotentRequest(ctx, stored, store.IdempotentRequest{BodyHash: hash[:]}, s.idempotencyPendingTTL())
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				s.logger.ErrorContext(ctx, "Idempotency-Key の登録エラー", "func", "idempotentMiddleware", "error", err)
+				metrics.HandlerErrors.WithLabelValues("matchmaking").Inc()
+				writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to check Idempotency-Key")
+				return
+			}
+			if !found {
+				break
+			}
+			if !bytes.Equal(e.BodyHash, hash[:]) {
+				writeJSONError(w, http.StatusUnprocessableEntity, errCodeIdempotencyKeyReused, "Idempotency-Key was already used with a different request body")
+				return
+			}
+			if e.Done {
+				for k, v := range e.Header {
+					w.Header()[k] = v
+				}
+				w.Header().Set(idempotencyReplayedHeader, "true")
+				w.WriteHeader(e.Status)
+				w.Write(e.Body)
+				return
+			}
+			// 元のリクエストの待機に合流する（タイムアウトまでのため、待ち時間は最長でも LongestTimeout）
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(idempotencyPollInterval):
+			}
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w, before: w.Header().Clone()}
+		next(rec, r)
+		// 切断されたリクエストの後始末もできるよう、リクエストのキャンセルを引き継がない
+		bg := context.WithoutCancel(ctx)
+		if ctx.Err() != nil || rec.status == 0 || rec.status >= 500 {
+			if err := s.Store.AbandonIdempotentRequest(bg, stored); err != nil {
+				s.logger.ErrorContext(ctx, "Idempotency-Key の取り消しエラー", "func", "idempotentMiddleware", "error", err)
+			}
+			return
+		}
+		done := store.IdempotentRequest{BodyHash: hash[:], Done: true, Status: rec.status, Header: rec.header, Body: rec.body.Bytes()}
+		if err := s.Store.FinishIdempotentRequest(bg, stored, done, s.cfg.IdempotencyTTL); err != nil {
+			s.logger.ErrorContext(ctx, "Idempotency-Key のレスポンス保存エラー", "func", "idempotentMiddleware", "error", err)
+		}
+	}
+}
+
+// idempotencyRecorder はハンドラのレスポンスをクライアントへ書き込みながら記録します。
+// long-poll の書き込み期限・Flush を使えるよう、Unwrap で元の ResponseWriter を返します。
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	// before はハンドラを呼び出す前のヘッダーです（CORS・リクエストID などのヘッダーは保存しない）。
+	before http.Header
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (r *idempotencyRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+		r.header = make(http.Header)
+		for k, v := range r.ResponseWriter.Header() {
+			if _, ok := r.before[k]; !ok {
+				r.header[k] = append([]string(nil), v...)
+			}
+		}
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *idempotencyRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
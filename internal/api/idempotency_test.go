@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/secret"
+)
+
+// startEnqueueWithHeader は header を付けて POST /matchmaking を別の goroutine で送ります。
+func (ts *testServer) startEnqueueWithHeader(t *testing.T, body interface{}, header http.Header) <-chan *httptest.ResponseRecorder {
+	t.Helper()
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- serve(t, ts.Server, "POST", "/matchmaking", body, header)
+	}()
+	return done
+}
+
+func TestIdempotencyKeyScopedToPlayer(t *testing.T) {
+	keys, err := secret.NewKeyRing("test-player-token-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServer(t, func(c *Config) { c.PlayerTokenKeys = keys })
+	withKey := func(player string) http.Header {
+		h := playerToken(t, keys, player)
+		h.Set(idempotencyKeyHeader, "shared-key")
+		return h
+	}
+
+	// 同じキーと同じボディでも、別のプレイヤーのリクエストはそれぞれ処理する
+	alice := ts.startEnqueueWithHeader(t, map[string]interface{}{}, withKey("alice"))
+	ts.waitQueued(t, 1)
+	bob := ts.startEnqueueWithHeader(t, map[string]interface{}{}, withKey("bob"))
+	ts.waitQueued(t, 2)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+	for _, done := range []<-chan *httptest.ResponseRecorder{alice, bob} {
+		rec := receive(t, done)
+		if rec.Code != http.StatusOK || rec.Header().Get(idempotencyReplayedHeader) != "" {
+			t.Fatalf("status %d replayed %q, want a fresh 200: %s", rec.Code, rec.Header().Get(idempotencyReplayedHeader), rec.Body)
+		}
+	}
+
+	// 同じプレイヤーの再送は保存したレスポンスを返し、ボディが異なれば 422
+	rec := ts.do(t, "POST", "/matchmaking", map[string]interface{}{}, withKey("alice"))
+	if rec.Code != http.StatusOK || rec.Header().Get(idempotencyReplayedHeader) != "true" {
+		t.Errorf("resend = %d replayed %q, want the stored 200", rec.Code, rec.Header().Get(idempotencyReplayedHeader))
+	}
+	rec = ts.do(t, "POST", "/matchmaking", map[string]interface{}{"game_mode": "ranked"}, withKey("alice"))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("resend with another body = %d, want 422", rec.Code)
+	}
+}
+
+func TestIdempotencyKeySharedAcrossInstances(t *testing.T) {
+	first := newTestServer(t, nil)
+	second := first.sibling(t)
+	header := http.Header{idempotencyKeyHeader: {"retry-1"}}
+
+	// 元のリクエストが処理中の再送は、別のインスタンスでも同じ待機に合流する
+	original := first.startEnqueueWithHeader(t, map[string]interface{}{"id": "alice"}, header)
+	first.waitQueued(t, 1)
+	retry := second.startEnqueueWithHeader(t, map[string]interface{}{"id": "alice"}, header)
+	bob := first.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	first.waitQueued(t, 2)
+	if cycle := first.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+	receive(t, bob)
+
+	var sessions [2]model.SessionResult
+	for i, done := range []<-chan *httptest.ResponseRecorder{original, retry} {
+		rec := receive(t, done)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d: %s", i, rec.Code, rec.Body)
+		}
+		decodeJSON(t, rec, &sessions[i])
+	}
+	if sessions[0].SessionID == "" || sessions[1].SessionID != sessions[0].SessionID {
+		t.Fatalf("session ids = %q, %q, want the retry to return the original session", sessions[0].SessionID, sessions[1].SessionID)
+	}
+
+	// 完了後の再送は、どのインスタンスでも保存したレスポンスを返す
+	rec := second.do(t, "POST", "/matchmaking", map[string]interface{}{"id": "alice"}, header)
+	if rec.Code != http.StatusOK || rec.Header().Get(idempotencyReplayedHeader) != "true" {
+		t.Fatalf("resend = %d replayed %q, want the stored 200", rec.Code, rec.Header().Get(idempotencyReplayedHeader))
+	}
+	if ids := first.queuedIDs(t); len(ids) != 0 {
+		t.Errorf("queued after the replay = %v, want nobody enqueued again", ids)
+	}
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+)
+
+// defaultLeaderboardLimit は GET /leaderboard で limit を省略した場合に返す人数です。
+const defaultLeaderboardLimit = 10
+
+// leaderboardAroundSize は GET /leaderboard/around/{player_id} で返す人数（指定したプレイヤーを含む）です。
+const leaderboardAroundSize = 10
+
+// leaderboardEntry は GET /leaderboard のレスポンスの1件です。
+type leaderboardEntry struct {
+	// Rank はレーティングの高い順の順位（1 始まり）です。同じレーティングの場合は対戦数の多い順、プレイヤーID順に順位を付けます。
+	Rank        int    `json:"rank"`
+	ID          string `json:"id"`
+	Rating      int    `json:"rating"`
+	GamesPlayed int    `json:"games_played"`
+}
+
+// leaderboardAroundResponse は GET /leaderboard/around/{player_id} のレスポンスです。
+type leaderboardAroundResponse struct {
+	PlayerID string `json:"player_id"`
+	// Rank は指定したプレイヤーの順位です。
+	Rank    int                `json:"rank"`
+	Entries []leaderboardEntry `json:"entries"`
+}
+
+// leaderboardCache はランキングのページ（limit と offset の組）ごとの取得結果を ttl の間保存します。
+// インスタンスごとに保存するため、他のインスタンスでの変更は ttl を過ぎるまで反映されません。
+type leaderboardCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	pages map[[2]int]cachedLeaderboardPage
+}
+
+// cachedLeaderboardPage は保存したランキングのページです。
+type cachedLeaderboardPage struct {
+	players []model.PlayerProfile
+	expires time.Time
+}
+
+// newLeaderboardCache は ttl の間ページを保存する leaderboardCache を生成します。
+func newLeaderboardCache(ttl time.Duration, now func() time.Time) *leaderboardCache {
+	return &leaderboardCache{ttl: ttl, now: now, pages: make(map[[2]int]cachedLeaderboardPage)}
+}
+
+// topPlayers は保存したページがあればそれを、なければ store から取得して保存したものを返します。
+func (c *leaderboardCache) topPlayers(ctx context.Context, store store.Store, limit, offset int) ([]model.PlayerProfile, error) {
+	if c.ttl <= 0 {
+		return store.TopPlayers(ctx, limit, offset)
+	}
+	key := [2]int{limit, offset}
+	c.mu.Lock()
+	page, ok := c.pages[key]
+	c.mu.Unlock()
+	if ok && c.now().Before(page.expires) {
+		return page.players, nil
+	}
+
+	players, err := store.TopPlayers(ctx, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, p := range c.pages {
+		if !now.Before(p.expires) {
+			delete(c.pages, k)
+		}
+	}
+	c.pages[key] = cachedLeaderboardPage{players: players, expires: now.Add(c.ttl)}
+	return players, nil
+}
+
+// invalidate は保存したページをすべて削除します。管理用エンドポイントでレーティングを変更した場合に呼び出します。
+func (c *leaderboardCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.pages)
+}
+
+// leaderboardEntries は offset 人目から始まるプレイヤーをランキングのレスポンスにします。
+func leaderboardEntries(players []model.PlayerProfile, offset int) []leaderboardEntry {
+	entries := make([]leaderboardEntry, len(players))
+	for i, p := range players {
+		entries[i] = leaderboardEntry{Rank: offset + i + 1, ID: p.ID, Rating: p.Rating, GamesPlayed: p.GamesPlayed}
+	}
+	return entries
+}
+
+// leaderboardHandler はレーティングの高い順にプレイヤーを返します。
+// limit（既定は defaultLeaderboardLimit、上限は LeaderboardMaxLimit）と offset でページングします。
+func (s *Server) leaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := s.parseLeaderboardPage(r)
+	if err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+
+	players, err := s.leaderboard.topPlayers(r.Context(), s.Store, limit, offset)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "ランキング取得エラー", "func", "leaderboardHandler", "limit", limit, "offset", offset, "error", err)
+		metrics.HandlerErrors.WithLabelValues("leaderboard").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to get leaderboard")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(leaderboardEntries(players, offset)); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "leaderboardHandler", "error", err)
+	}
+}
+
+// leaderboardAroundHandler は指定したプレイヤーの順位と、その前後のプレイヤー（合わせて leaderboardAroundSize 人）を返します。
+// 順位は保存せずに毎回求めますが、前後のプレイヤーは GET /leaderboard と同じく保存したページを使うことがあります。
+func (s *Server) leaderboardAroundHandler(w http.ResponseWriter, r *http.Request) {
+	playerID := r.PathValue("player_id")
+	if err := model.ValidateID("player_id", playerID, "player_id"); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+
+	rank, err := s.Store.PlayerRank(r.Context(), playerID)
+	if errors.Is(err, store.ErrPlayerNotFound) {
+		writeJSONError(w, http.StatusNotFound, errCodePlayerNotFound, "Player not found")
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "順位取得エラー", "func", "leaderboardAroundHandler", "player_id", playerID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("leaderboard").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to get leaderboard")
+		return
+	}
+	offset := max(rank-1-leaderboardAroundSize/2, 0)
+	players, err := s.leaderboard.topPlayers(r.Context(), s.Store, leaderboardAroundSize, offset)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "ランキング取得エラー", "func", "leaderboardAroundHandler", "player_id", playerID, "offset", offset, "error", err)
+		metrics.HandlerErrors.WithLabelValues("leaderboard").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to get leaderboard")
+		return
+	}
+
+	resp := leaderboardAroundResponse{PlayerID: playerID, Rank: rank, Entries: leaderboardEntries(players, offset)}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "leaderboardAroundHandler", "error", err)
+	}
+}
+
+// parseLeaderboardPage はクエリパラメータの limit と offset を返します。
+// limit は 1 以上、offset は 0 以上の整数でなければエラーを返します。limit が上限を超える場合は上限にします。
+func (s *Server) parseLeaderboardPage(r *http.Request) (limit, offset int, err error) {
+	query := r.URL.Query()
+	limit = defaultLeaderboardLimit
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return 0, 0, &model.FieldError{Field: "limit", Message: "limit must be a positive integer"}
+		}
+	}
+	limit = min(limit, s.cfg.LeaderboardMaxLimit)
+	if v := query.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, &model.FieldError{Field: "offset", Message: "offset must be a non-negative integer"}
+		}
+	}
+	return limit, offset, nil
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// seedRatings は ratings のレーティングのプレイヤーを作成します。
+func (ts *testServer) seedRatings(t *testing.T, ratings map[string]int) {
+	t.Helper()
+	for id, rating := range ratings {
+		if _, _, err := ts.store.SetPlayerRating(context.Background(), id, rating); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// leaderboard は GET /leaderboard に query を付けて取得したランキングを返します。
+func (ts *testServer) leaderboard(t *testing.T, query string) []leaderboardEntry {
+	t.Helper()
+	rec := ts.do(t, "GET", "/leaderboard"+query, nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /leaderboard%s: status %d: %s", query, rec.Code, rec.Body)
+	}
+	var entries []leaderboardEntry
+	decodeJSON(t, rec, &entries)
+	return entries
+}
+
+// leaderboardIDs はランキングのプレイヤーIDを順に返し、順位が offset+1 から連続していることを確認します。
+func leaderboardIDs(t *testing.T, entries []leaderboardEntry, offset int) []string {
+	t.Helper()
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		if e.Rank != offset+i+1 {
+			t.Fatalf("entry %d (%s) rank = %d, want %d", i, e.ID, e.Rank, offset+i+1)
+		}
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+func TestLeaderboard(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.seedRatings(t, map[string]int{"alice": 1600, "bob": 1800, "carol": 1400, "dave": 1700, "erin": 1500})
+
+	entries := ts.leaderboard(t, "")
+	if got := leaderboardIDs(t, entries, 0); !slices.Equal(got, []string{"bob", "dave", "alice", "erin", "carol"}) {
+		t.Fatalf("leaderboard = %v, want highest rating first", got)
+	}
+	if entries[0].Rating != 1800 || entries[4].Rating != 1400 {
+		t.Errorf("ratings = %d..%d, want 1800..1400", entries[0].Rating, entries[4].Rating)
+	}
+
+	for _, tc := range []struct {
+		query  string
+		offset int
+		want   []string
+	}{
+		{"?limit=2", 0, []string{"bob", "dave"}},
+		{"?limit=2&offset=2", 2, []string{"alice", "erin"}},
+		{"?limit=2&offset=4", 4, []string{"carol"}},
+		{"?offset=5", 5, []string{}},
+	} {
+		if got := leaderboardIDs(t, ts.leaderboard(t, tc.query), tc.offset); !slices.Equal(got, tc.want) {
+			t.Errorf("%s = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
+
+// limit は LeaderboardMaxLimit に切り詰め、省略した場合は defaultLeaderboardLimit 人を返す
+func TestLeaderboardLimitClamp(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.LeaderboardMaxLimit = 3 })
+	ratings := make(map[string]int)
+	for i := range defaultLeaderboardLimit + 2 {
+		ratings[fmt.Sprintf("p%02d", i)] = 1000 + i
+	}
+	ts.seedRatings(t, ratings)
+
+	if got := len(ts.leaderboard(t, "?limit=50")); got != 3 {
+		t.Errorf("limit=50 returned %d players, want the maximum of 3", got)
+	}
+
+	ts = newTestServer(t, nil)
+	ts.seedRatings(t, ratings)
+	if got := len(ts.leaderboard(t, "")); got != defaultLeaderboardLimit {
+		t.Errorf("default limit returned %d players, want %d", got, defaultLeaderboardLimit)
+	}
+}
+
+func TestLeaderboardRejectsInvalidPage(t *testing.T) {
+	ts := newTestServer(t, nil)
+	for _, tc := range []struct{ query, field string }{
+		{"?limit=0", "limit"},
+		{"?limit=-1", "limit"},
+		{"?limit=ten", "limit"},
+		{"?offset=-1", "offset"},
+		{"?offset=x", "offset"},
+	} {
+		rec := ts.do(t, "GET", "/leaderboard"+tc.query, nil, nil)
+		if code := errorShape(t, rec, http.StatusBadRequest); code != errCodeInvalidRequest {
+			t.Errorf("%s: code = %q, want %q", tc.query, code, errCodeInvalidRequest)
+			continue
+		}
+		var resp struct {
+			Error ErrorDetail `json:"error"`
+		}
+		decodeJSON(t, rec, &resp)
+		if got := resp.Error.Details["field"]; got != tc.field {
+			t.Errorf("%s: details.field = %v, want %q", tc.query, got, tc.field)
+		}
+	}
+}
+
+func TestLeaderboardAround(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ratings := make(map[string]int)
+	for i := range 30 {
+		ratings[fmt.Sprintf("p%02d", i)] = 1000 + i
+	}
+	ts.seedRatings(t, ratings)
+	around := func(id string) leaderboardAroundResponse {
+		t.Helper()
+		rec := ts.do(t, "GET", "/leaderboard/around/"+id, nil, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("around %s: status %d: %s", id, rec.Code, rec.Body)
+		}
+		var resp leaderboardAroundResponse
+		decodeJSON(t, rec, &resp)
+		return resp
+	}
+
+	// p15 は15位で、前後の 10..19 位を返す
+	resp := around("p15")
+	if resp.PlayerID != "p15" || resp.Rank != 15 {
+		t.Fatalf("around p15 = %s at %d, want rank 15", resp.PlayerID, resp.Rank)
+	}
+	if len(resp.Entries) != leaderboardAroundSize || resp.Entries[0].Rank != 10 {
+		t.Fatalf("entries = %+v, want ranks 10 to 19", resp.Entries)
+	}
+	if i := slices.IndexFunc(resp.Entries, func(e leaderboardEntry) bool { return e.ID == "p15" }); i < 0 || resp.Entries[i].Rank != 15 {
+		t.Fatalf("entries = %+v, want p15 at rank 15", resp.Entries)
+	}
+	// 上位のプレイヤーは1位から返す
+	if resp := around("p29"); resp.Rank != 1 || resp.Entries[0].ID != "p29" || len(resp.Entries) != leaderboardAroundSize {
+		t.Fatalf("around p29 = %+v, want the top %d", resp, leaderboardAroundSize)
+	}
+	// 下位のプレイヤーは返せる人数だけ返す
+	if resp := around("p00"); resp.Rank != 30 || resp.Entries[len(resp.Entries)-1].ID != "p00" {
+		t.Fatalf("around p00 = %+v, want the last player at rank 30", resp)
+	}
+
+	if code := errorShape(t, ts.do(t, "GET", "/leaderboard/around/zed", nil, nil), http.StatusNotFound); code != errCodePlayerNotFound {
+		t.Errorf("unknown player: code = %q, want %q", code, errCodePlayerNotFound)
+	}
+}
+
+// ランキングのページは LeaderboardCacheTTL の間保存し、管理用エンドポイントでレーティングを変更したら破棄する
+func TestLeaderboardCache(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.LeaderboardCacheTTL = 5 * time.Second })
+	ts.seedRatings(t, map[string]int{"alice": 1600, "bob": 1500})
+	top := func() string {
+		t.Helper()
+		return ts.leaderboard(t, "?limit=1")[0].ID
+	}
+	if got := top(); got != "alice" {
+		t.Fatalf("top = %s, want alice", got)
+	}
+
+	// 対戦結果などで変わったレーティングは、保存期間を過ぎてから反映する
+	ts.seedRatings(t, map[string]int{"bob": 1700})
+	if got := top(); got != "alice" {
+		t.Fatalf("top within the TTL = %s, want the cached alice", got)
+	}
+	ts.clock.Advance(5 * time.Second)
+	if got := top(); got != "bob" {
+		t.Fatalf("top after the TTL = %s, want bob", got)
+	}
+
+	// 管理用エンドポイントでの変更はすぐに反映する
+	rec := serve(t, ts.AdminHandler(), "PUT", "/players/alice/rating", map[string]int{"rating": 1800}, adminHeader())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("set rating: status %d: %s", rec.Code, rec.Body)
+	}
+	if got := top(); got != "alice" {
+		t.Fatalf("top after an admin change = %s, want alice", got)
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/lifecycle"
+	"matchmaking_project/internal/store"
+)
+
+// closableStore は Close の後に呼び出されると、接続を閉じた DB と同じエラーを返します。
+type closableStore struct {
+	store.Store
+	closed   atomic.Bool
+	misused  atomic.Int32
+	accessed atomic.Int32
+}
+
+func (s *closableStore) check() error {
+	s.accessed.Add(1)
+	if s.closed.Load() {
+		s.misused.Add(1)
+		return errors.New("sql: database is closed")
+	}
+	return nil
+}
+
+func (s *closableStore) ExpireSessions(ctx context.Context, before time.Time) (int64, error) {
+	if err := s.check(); err != nil {
+		return 0, err
+	}
+	return s.Store.ExpireSessions(ctx, before)
+}
+
+func (s *closableStore) DeleteQueueHistory(ctx context.Context, before time.Time) (int64, error) {
+	if err := s.check(); err != nil {
+		return 0, err
+	}
+	return s.Store.DeleteQueueHistory(ctx, before)
+}
+
+// 終了時はバックグラウンド処理を止めてから保存先を閉じるため、閉じた保存先を使ったエラーが記録されない
+func TestLifecycleShutdownClosesStoreLast(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.SessionSweepInterval = time.Millisecond })
+	st := &closableStore{Store: ts.Store}
+	ts.Store = st
+	logs := ts.captureLogs(slog.LevelDebug)
+
+	lc := lifecycle.New()
+	lc.Add(lifecycle.Component{Name: "store", Stop: func(context.Context) error {
+		st.closed.Store(true)
+		// 接続の後始末に時間がかかる間、停止していない処理があれば閉じた保存先を使う
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}})
+	lc.Add(lifecycle.WorkerComponent("session-janitor", []string{"store"}, ts.SessionJanitor))
+	lc.Add(lifecycle.WorkerComponent("matchmaking-processor", []string{"store"}, ts.MatchmakingProcessor))
+	if err := lc.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the janitor to sweep", func() bool { return st.accessed.Load() >= 3 })
+	lc.Stop()
+	if n := st.misused.Load(); n != 0 {
+		t.Fatalf("store used %d times after close", n)
+	}
+	if out := logs.String(); strings.Contains(out, "database is closed") {
+		t.Fatalf("logs report use after close:\n%s", out)
+	}
+}
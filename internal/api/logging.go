@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	"matchmaking_project/internal/metrics"
+)
+
+// requestIDHeader はリクエスト ID を受け渡す HTTP ヘッダーです。
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength は受け付けるリクエスト ID の最大長です。これより長い場合は新しく採番します。
+const maxRequestIDLength = 128
+
+// requestIDKey はリクエスト ID を context に格納するためのキーです。
+type requestIDKey struct{}
+
+// InitLogger は構造化ログの出力先を初期化します。
+// LOG_LEVEL（debug / info / warn / error、既定は info）で出力レベルを、
+// LOG_FORMAT（json / text、既定は json）で出力形式を指定できます。text はローカル開発向けです。
+func InitLogger() {
+	slog.SetDefault(newLogger(os.Stderr, parseLogLevel(os.Getenv("LOG_LEVEL")), os.Getenv("LOG_FORMAT")))
+}
+
+// newLogger は w へ出力するロガーを生成します。format が "text" 以外の場合は JSON で出力します。
+// context にリクエスト ID があれば、各ログに request_id として付与します。
+func newLogger(w io.Writer, level slog.Level, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if strings.EqualFold(format, "text") {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(requestIDHandler{handler})
+}
+
+// requestIDHandler は context のリクエスト ID をログに付与する slog.Handler です。
+type requestIDHandler struct {
+	slog.Handler
+}
+
+// Handle はリクエスト ID（と認証済みクライアントのサービス名）を付与してから元のハンドラへ渡します。
+func (h requestIDHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestIDFrom(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if service := serviceFrom(ctx); service != "" {
+		r.AddAttrs(slog.String("service", service))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs は属性を追加したハンドラを返します。
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup はグループを追加したハンドラを返します。
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
+
+// requestIDFrom は context に格納されたリクエスト ID を返します。ない場合は空文字列を返します。
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID はランダムなリクエスト ID を生成します。
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID はクライアントから受け取ったリクエスト ID をそのままログに出力してよいかを返します。
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDMiddleware はリクエストごとに ID を割り当て、context とレスポンスヘッダーに設定するミドルウェアです。
+// X-Request-ID ヘッダーが付いていればその値を引き継ぎ、なければ新しく採番します。
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RecoverMiddleware はハンドラの panic を回復し、内部のエラーを含めない 500 の JSON を返すミドルウェアです。
+// panic の内容とスタックトレースはリクエスト ID 付きでログに出力します。クライアントの切断（http.ErrAbortHandler）はそのまま伝えます。
+func RecoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			slog.ErrorContext(r.Context(), "ハンドラの panic", "func", "recoverMiddleware", "method", r.Method, "path", r.URL.Path, "panic", v, "stack", string(debug.Stack()))
+			metrics.HandlerErrors.WithLabelValues("panic").Inc()
+			writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseLogLevel は LOG_LEVEL の値をログレベルに変換します。未知の値の場合は info とします。
+func parseLogLevel(s string) slog.Level {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
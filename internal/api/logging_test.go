@@ -0,0 +1,112 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	logs := &logBuffer{}
+	logger := newLogger(logs, slog.LevelInfo, "json")
+	h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.InfoContext(r.Context(), "handled")
+	}))
+
+	for _, tc := range []struct {
+		name, incoming string
+		// keep はクライアントの ID をそのまま使うかどうかです
+		keep bool
+	}{
+		{"incoming", "req-123", true},
+		{"missing", "", false},
+		{"control characters", "bad\tid", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tc.incoming != "" {
+				r.Header.Set(requestIDHeader, tc.incoming)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			id := rec.Header().Get(requestIDHeader)
+			if tc.keep && id != tc.incoming || !tc.keep && (id == "" || id == tc.incoming) {
+				t.Fatalf("response %s = %q (incoming %q)", requestIDHeader, id, tc.incoming)
+			}
+			records := logs.records(t)
+			if got := records[len(records)-1]["request_id"]; got != id {
+				t.Fatalf("logged request_id = %v, want %q", got, id)
+			}
+		})
+	}
+}
+
+func TestServerReturnsRequestID(t *testing.T) {
+	ts := newTestServer(t, nil)
+	header := make(http.Header)
+	header.Set(requestIDHeader, "probe-1")
+	rec := ts.do(t, "GET", "/healthz", nil, header)
+	if got := rec.Header().Get(requestIDHeader); got != "probe-1" {
+		t.Fatalf("%s = %q, want probe-1", requestIDHeader, got)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for in, want := range map[string]slog.Level{
+		"debug": slog.LevelDebug, "DEBUG": slog.LevelDebug, "info": slog.LevelInfo, "": slog.LevelInfo,
+		"warn": slog.LevelWarn, "warning": slog.LevelWarn, "error": slog.LevelError, "verbose": slog.LevelInfo,
+	} {
+		if got := parseLogLevel(in); got != want {
+			t.Errorf("parseLogLevel(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+// マッチングは session_id と参加者ごとのレーティング・待機時間を構造化して記録し、
+// 毎回の確認（debug）は info 以上の出力では記録しない
+func TestMatchLoggedAsStructuredEvent(t *testing.T) {
+	ts := newTestServer(t, nil)
+	logs := ts.captureLogs(slog.LevelInfo)
+	session := ts.matchPair(t, "alice", "bob")
+
+	var matched map[string]interface{}
+	for _, rec := range logs.records(t) {
+		switch rec["msg"] {
+		case "players matched":
+			matched = rec
+		case "matchmaking tick":
+			t.Errorf("debug log %v written at info level", rec)
+		}
+	}
+	if matched == nil {
+		t.Fatalf("no match event in logs:\n%s", logs)
+	}
+	if matched["session_id"] != session.SessionID {
+		t.Errorf("session_id = %v, want %s", matched["session_id"], session.SessionID)
+	}
+	players, _ := matched["players"].([]interface{})
+	if len(players) != 2 {
+		t.Fatalf("players = %v, want alice and bob", matched["players"])
+	}
+	for _, p := range players {
+		p := p.(map[string]interface{})
+		if p["id"] != "alice" && p["id"] != "bob" {
+			t.Errorf("player id = %v", p["id"])
+		}
+		for _, key := range []string{"rating", "wait_seconds"} {
+			if _, ok := p[key].(float64); !ok {
+				t.Errorf("player %v has no numeric %s", p["id"], key)
+			}
+		}
+	}
+
+	debug := ts.captureLogs(slog.LevelDebug)
+	ts.tick(t)
+	if !strings.Contains(debug.String(), `"msg":"matchmaking tick"`) {
+		t.Errorf("debug level did not log the tick:\n%s", debug)
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// longPollWriteTimeout は long-poll のレスポンス書き込みに許容する最大時間です。
+const longPollWriteTimeout = 5 * time.Second
+
+// errSlowConsumer は書き込み期限までにクライアントがレスポンスを受信しなかった場合のエラーです。
+var errSlowConsumer = errors.New("client did not read the response before the write deadline")
+
+// writeLongPollResponse は long-poll で待機した結果を JSON で書き込みます。
+// 受信しないクライアントによって書き込みがブロックされ続けないよう、接続ごとに書き込み期限を設定します。
+// 期限までに書き込めなかった場合は errSlowConsumer を返すため、呼び出し側は切断時と同じ後始末を行ってください。
+func writeLongPollResponse(w http.ResponseWriter, v interface{}) error {
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Now().Add(longPollWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err == nil {
+		err = rc.Flush()
+	}
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("%w: %v", errSlowConsumer, err)
+	}
+	return err
+}
+
+// writeFailureLabel は待機中の書き込みに失敗した理由を matchmaking_waits_abandoned_total のラベルにします。
+// 書き込み期限を過ぎた場合（errSlowConsumer）は、切断とは分けて slow_consumer として数えます。
+func writeFailureLabel(err error) string {
+	if errors.Is(err, errSlowConsumer) {
+		return "slow_consumer"
+	}
+	return "client_disconnected"
+}
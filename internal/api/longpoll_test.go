@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"matchmaking_project/internal/metrics"
+)
+
+// pipeResponseWriter は net.Pipe に書き込む http.ResponseWriter です。相手側を読まなければ、受信しないクライアントと同じく書き込みがブロックします。
+type pipeResponseWriter struct {
+	conn   net.Conn
+	header http.Header
+}
+
+func newPipeResponseWriter(t *testing.T) *pipeResponseWriter {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return &pipeResponseWriter{conn: server, header: make(http.Header)}
+}
+
+func (w *pipeResponseWriter) Header() http.Header         { return w.header }
+func (w *pipeResponseWriter) WriteHeader(int)             {}
+func (w *pipeResponseWriter) Write(b []byte) (int, error) { return w.conn.Write(b) }
+func (w *pipeResponseWriter) FlushError() error           { return nil }
+
+// SetWriteDeadline は http.ResponseController から呼び出されます。
+func (w *pipeResponseWriter) SetWriteDeadline(t time.Time) error {
+	return w.conn.SetWriteDeadline(t)
+}
+
+// 受信しないクライアントへの SSE の書き込みは書き込み期限で打ち切り、切断と同じく待機キューから削除する
+func TestStreamSlowConsumerDisconnected(t *testing.T) {
+	ts := newTestServer(t, nil)
+	slow := metrics.MatchmakingAbandoned.WithLabelValues("slow_consumer")
+	before := testutil.ToFloat64(slow)
+
+	w := newPipeResponseWriter(t)
+	done := make(chan struct{})
+	started := time.Now()
+	go func() {
+		defer close(done)
+		ts.ServeHTTP(w, httptest.NewRequest("GET", "/matchmaking/stream?player_id=alice", nil))
+	}()
+	ts.waitQueued(t, 1)
+
+	select {
+	case <-done:
+	case <-time.After(longPollWriteTimeout + 2*time.Second):
+		t.Fatal("stream handler stayed blocked past the write deadline")
+	}
+	if elapsed := time.Since(started); elapsed < longPollWriteTimeout-time.Second {
+		t.Fatalf("handler returned after %v, before the write deadline", elapsed)
+	}
+	if ids := ts.queuedIDs(t); len(ids) != 0 {
+		t.Fatalf("queued = %v after the slow consumer was dropped, want empty", ids)
+	}
+	if got := testutil.ToFloat64(slow) - before; got != 1 {
+		t.Fatalf("slow_consumer abandonments = %v, want 1", got)
+	}
+}
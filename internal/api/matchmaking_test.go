@@ -0,0 +1,455 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+	"matchmaking_project/internal/store"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// recordingNotifier は Publish した通知を記録する Notifier です。
+type recordingNotifier struct {
+	Notifier
+	mu        sync.Mutex
+	published map[string]string
+}
+
+func (n *recordingNotifier) Publish(key string, session model.SessionResult) error {
+	n.mu.Lock()
+	n.published[key] = session.SessionID
+	n.mu.Unlock()
+	return n.Notifier.Publish(key, session)
+}
+
+func TestQueueMatchNotifyInMemory(t *testing.T) {
+	ts := newTestServer(t, nil)
+	notifier := &recordingNotifier{Notifier: ts.notifier, published: make(map[string]string)}
+	ts.notifier = notifier
+
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+
+	var sessions [2]model.SessionResult
+	for i, done := range []<-chan *httptest.ResponseRecorder{alice, bob} {
+		rec := receive(t, done)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("player %d: status %d: %s", i, rec.Code, rec.Body)
+		}
+		decodeJSON(t, rec, &sessions[i])
+	}
+	id := sessions[0].SessionID
+	if id == "" || sessions[1].SessionID != id {
+		t.Fatalf("session ids = %q, %q, want the same session", id, sessions[1].SessionID)
+	}
+	if got := sessions[0].HumanPlayerIDs(); len(got) != 2 {
+		t.Fatalf("participants = %v, want alice and bob", got)
+	}
+	notifier.mu.Lock()
+	for _, key := range []string{"alice", "bob"} {
+		if notifier.published[key] != id {
+			t.Errorf("notified %q with %q, want %q", key, notifier.published[key], id)
+		}
+	}
+	notifier.mu.Unlock()
+
+	if _, err := ts.store.GetSession(t.Context(), id); err != nil {
+		t.Errorf("session was not stored: %v", err)
+	}
+	rows, err := ts.store.ListQueuedPlayers(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("queue still has %d players after the match", len(rows))
+	}
+}
+
+// レーティングの離れた2人は、待機時間が StarvationThreshold を超えてから1回のマッチングで同じセッションになる
+func TestStarvingPlayersMatchAfterClockAdvances(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) {
+		duel := c.Queue.GameModes["duel"]
+		duel.RatingWindow = 100
+		c.Queue.GameModes["duel"] = duel
+	})
+	ctx := context.Background()
+	for id, rating := range map[string]int{"alice": 1000, "bob": 2000} {
+		if _, _, err := ts.store.SetPlayerRating(ctx, id, rating); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice", "game_mode": "duel", "timeout_seconds": 120})
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob", "game_mode": "duel", "timeout_seconds": 120})
+	ts.waitQueued(t, 2)
+
+	if cycle := ts.tick(t); cycle.Matched != 0 {
+		t.Fatalf("tick before the starvation threshold created %d sessions, want 0", cycle.Matched)
+	}
+	ts.clock.Advance(ts.cfg.Queue.StarvationThreshold + time.Second)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick after the starvation threshold created %d sessions, want 1", cycle.Matched)
+	}
+
+	var got [2]model.SessionResult
+	for i, done := range []<-chan *httptest.ResponseRecorder{alice, bob} {
+		rec := receive(t, done)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("player %d: status %d: %s", i, rec.Code, rec.Body)
+		}
+		decodeJSON(t, rec, &got[i])
+	}
+	if got[0].SessionID == "" || got[0].SessionID != got[1].SessionID {
+		t.Fatalf("session ids = %q, %q, want the same session", got[0].SessionID, got[1].SessionID)
+	}
+}
+
+// 2人のパーティは分割されずに同じチームになり、ソロの2人と対戦する
+func TestPartyMatchedAgainstTwoSolos(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) { c.PlayerRateLimit = ratelimit.Config{} })
+	party := ts.startEnqueue(t, map[string]interface{}{
+		"party_id": "p1", "game_mode": "2v2",
+		"players": []map[string]interface{}{{"id": "alice"}, {"id": "bob"}},
+	})
+	ts.waitQueued(t, 2)
+	carol := ts.startEnqueue(t, map[string]interface{}{"id": "carol", "game_mode": "2v2"})
+	ts.waitQueued(t, 3)
+	dave := ts.startEnqueue(t, map[string]interface{}{"id": "dave", "game_mode": "2v2"})
+	ts.waitQueued(t, 4)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+
+	var sessions [3]model.SessionResult
+	for i, done := range []<-chan *httptest.ResponseRecorder{party, carol, dave} {
+		rec := receive(t, done)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("enqueue %d: status %d: %s", i, rec.Code, rec.Body)
+		}
+		decodeJSON(t, rec, &sessions[i])
+	}
+	session := sessions[0]
+	if sessions[1].SessionID != session.SessionID || sessions[2].SessionID != session.SessionID {
+		t.Fatalf("session ids = %q, %q, %q, want the same session", session.SessionID, sessions[1].SessionID, sessions[2].SessionID)
+	}
+	teams := make(map[string]int)
+	for _, p := range session.Participants {
+		teams[p.ID] = p.Team
+		if wantParty := p.ID == "alice" || p.ID == "bob"; wantParty != (p.PartyID == "p1") {
+			t.Errorf("%s party_id = %q", p.ID, p.PartyID)
+		}
+	}
+	if len(teams) != 4 || teams["alice"] != teams["bob"] || teams["carol"] != teams["dave"] || teams["alice"] == teams["carol"] {
+		t.Fatalf("teams = %v, want the party against the two solos", teams)
+	}
+}
+
+// チームの人数を超えるパーティは受け付けない
+func TestPartyLargerThanTeamRejected(t *testing.T) {
+	ts := newTestServer(t, nil)
+	rec := ts.do(t, "POST", "/matchmaking", map[string]interface{}{
+		"party_id": "p1", "game_mode": "2v2",
+		"players": []map[string]interface{}{{"id": "alice"}, {"id": "bob"}, {"id": "carol"}},
+	}, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("party of 3 in 2v2 = %d, want 400: %s", rec.Code, rec.Body)
+	}
+	var body ErrorResponse
+	decodeJSON(t, rec, &body)
+	if body.Error.Details["field"] != "players" {
+		t.Errorf("details = %v, want field players", body.Error.Details)
+	}
+	if got := ts.queuedIDs(t); len(got) != 0 {
+		t.Errorf("queued = %v, want nobody", got)
+	}
+}
+
+// stallingNotifier は stall 宛ての Publish を release が閉じられるまで止めます（応答しない送信先の代わり）。
+type stallingNotifier struct {
+	Notifier
+	stall   string
+	stalled chan struct{}
+	release chan struct{}
+}
+
+func (n *stallingNotifier) Publish(key string, session model.SessionResult) error {
+	if key == n.stall {
+		close(n.stalled)
+		<-n.release
+	}
+	return n.Notifier.Publish(key, session)
+}
+
+// 1件の送信が止まっても、他のセッションの通知と購読の登録はロックを待たずに進む
+func TestStalledPublishDoesNotBlockOtherNotifications(t *testing.T) {
+	ts := newTestServer(t, nil)
+	chans := make(map[string]<-chan model.SessionResult)
+	for _, id := range []string{"alice", "bob", "carol", "dave"} {
+		ch, err := ts.notifier.Subscribe(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chans[id] = ch
+	}
+	notifier := &stallingNotifier{Notifier: ts.notifier, stall: "alice", stalled: make(chan struct{}), release: make(chan struct{})}
+	ts.notifier = notifier
+
+	participant := func(id string, team int) model.Participant {
+		return model.Participant{Player: model.Player{ID: id}, Team: team}
+	}
+	sessions := []model.SessionResult{
+		{SessionID: "s1", Participants: []model.Participant{participant("alice", 1), participant("bob", 2)}},
+		{SessionID: "s2", Participants: []model.Participant{participant("carol", 1), participant("dave", 2)}},
+	}
+	done := make(chan []bool, 1)
+	go func() { done <- ts.publishSessions(sessions) }()
+
+	<-notifier.stalled
+	for _, id := range []string{"bob", "carol", "dave"} {
+		select {
+		case session := <-chans[id]:
+			if session.SessionID == "" {
+				t.Errorf("%s received an empty session", id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s was not notified while alice's send was stalled", id)
+		}
+	}
+	if _, err := ts.notifier.Subscribe("erin"); err != nil {
+		t.Fatalf("subscribe while a send was stalled: %v", err)
+	}
+
+	close(notifier.release)
+	ok := <-done
+	if !ok[0] || !ok[1] {
+		t.Fatalf("published = %v, want both sessions delivered", ok)
+	}
+	if session := <-chans["alice"]; session.SessionID != "s1" {
+		t.Fatalf("alice received %q, want s1", session.SessionID)
+	}
+}
+
+// matchOnEnqueueStore は待機キューへの登録の直後、登録したリクエストへ戻る前にマッチングを実行します。
+type matchOnEnqueueStore struct {
+	store.Store
+	match func(ctx context.Context)
+}
+
+func (s *matchOnEnqueueStore) EnqueueEntry(ctx context.Context, entry model.QueueEntry) (model.QueueEntry, error) {
+	registered, err := s.Store.EnqueueEntry(ctx, entry)
+	if err == nil {
+		s.match(ctx)
+	}
+	return registered, err
+}
+
+// 登録の直後に成立したマッチングも、登録したリクエストへ必ず届く（通知の購読は登録より前に行う）
+func TestJoinThenImmediateMatchDelivers(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) {
+		c.IPRateLimit = ratelimit.Config{}
+		c.PlayerRateLimit = ratelimit.Config{}
+	})
+	ts.Store = &matchOnEnqueueStore{Store: ts.store, match: func(ctx context.Context) {
+		if _, err := ts.runMatchmaking(ctx); err != nil {
+			t.Error(err)
+		}
+	}}
+
+	const players = 16
+	dones := make([]<-chan *httptest.ResponseRecorder, players)
+	for i := range dones {
+		dones[i] = ts.startEnqueue(t, map[string]interface{}{"id": fmt.Sprintf("player%02d", i)})
+	}
+	delivered := make(map[string]int)
+	for i, done := range dones {
+		rec := receive(t, done)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("player%02d: status %d: %s", i, rec.Code, rec.Body)
+		}
+		var session model.SessionResult
+		decodeJSON(t, rec, &session)
+		delivered[session.SessionID]++
+	}
+	if len(delivered) != players/2 {
+		t.Fatalf("delivered %d sessions, want %d", len(delivered), players/2)
+	}
+	for id, n := range delivered {
+		if n != 2 {
+			t.Errorf("session %s delivered to %d players, want 2", id, n)
+		}
+	}
+}
+
+// 待機中のプレイヤーがもう一度登録しようとすると 409 を返し、待機キューには1件だけ残す
+func TestDoubleJoinRejected(t *testing.T) {
+	ts := newTestServer(t, nil)
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+
+	rec := ts.do(t, "POST", "/matchmaking", map[string]interface{}{"id": "alice"}, nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("second join: status %d, want 409: %s", rec.Code, rec.Body)
+	}
+	if code := errorCode(t, rec); code != errCodeAlreadyQueued {
+		t.Fatalf("second join: code %q, want %q", code, errCodeAlreadyQueued)
+	}
+	if got := ts.queuedIDs(t); len(got) != 1 {
+		t.Fatalf("queued = %v, want alice once", got)
+	}
+
+	// 最初のリクエストは待機を続け、マッチングの結果を受け取る
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	ts.tick(t)
+	for _, done := range []<-chan *httptest.ResponseRecorder{alice, bob} {
+		if rec := receive(t, done); rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+	}
+}
+
+// slowEnqueueStore は待機キューへの登録を保存した後、応答しない DB のように ctx が終わるまで返しません。
+type slowEnqueueStore struct {
+	store.Store
+	inserted chan struct{}
+}
+
+func (s *slowEnqueueStore) EnqueueEntry(ctx context.Context, entry model.QueueEntry) (model.QueueEntry, error) {
+	registered, err := s.Store.EnqueueEntry(ctx, entry)
+	if err != nil {
+		return registered, err
+	}
+	close(s.inserted)
+	<-ctx.Done()
+	return model.QueueEntry{}, ctx.Err()
+}
+
+// 登録の途中でクライアントが切断した場合は、登録を打ち切って待機キューから削除する
+func TestClientCancelDuringEnqueue(t *testing.T) {
+	ts := newTestServer(t, nil)
+	st := &slowEnqueueStore{Store: ts.store, inserted: make(chan struct{})}
+	ts.Store = st
+	ctx, cancel := context.WithCancel(context.Background())
+	done := ts.startEnqueueContext(t, ctx, map[string]interface{}{"id": "alice"})
+	<-st.inserted
+	cancel()
+
+	rec := receive(t, done)
+	if rec.Code != http.StatusServiceUnavailable || errorCode(t, rec) != errCodeCancelled {
+		t.Fatalf("status %d: %s, want 503 cancelled", rec.Code, rec.Body)
+	}
+	if ids := ts.queuedIDs(t); len(ids) != 0 {
+		t.Fatalf("queued = %v after the client cancelled, want empty", ids)
+	}
+	if n := ts.notifier.Len(); n != 0 {
+		t.Fatalf("%d subscriptions left after the client cancelled, want 0", n)
+	}
+}
+
+// 既にキャンセルされたリクエストは登録しない
+func TestCancelledRequestNotEnqueued(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := receive(t, ts.startEnqueueContext(t, ctx, map[string]interface{}{"id": "alice"}))
+	if rec.Code != http.StatusServiceUnavailable || errorCode(t, rec) != errCodeCancelled {
+		t.Fatalf("status %d: %s, want 503 cancelled", rec.Code, rec.Body)
+	}
+	if ids := ts.queuedIDs(t); len(ids) != 0 {
+		t.Fatalf("queued = %v, want empty", ids)
+	}
+}
+
+// 待機中にクライアントが切断した場合は、待機時間を待たずに待機キューから削除し、タイムアウトとは別に数える
+func TestClientCancelWhileWaiting(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := ts.startEnqueueContext(t, ctx, map[string]interface{}{"id": "alice", "timeout_seconds": 30})
+	ts.waitQueued(t, 1)
+	abandoned := testutil.ToFloat64(metrics.MatchmakingAbandoned.WithLabelValues("client_disconnected"))
+	timeouts := testutil.ToFloat64(metrics.MatchmakingTimeouts)
+
+	start := time.Now()
+	cancel()
+	rec := receive(t, done)
+	if rec.Code != http.StatusServiceUnavailable || errorCode(t, rec) != errCodeCancelled {
+		t.Fatalf("status %d: %s, want 503 cancelled", rec.Code, rec.Body)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("cleanup took %v, want it right after the cancellation", elapsed)
+	}
+	if ids := ts.queuedIDs(t); len(ids) != 0 {
+		t.Fatalf("queued = %v after the client cancelled, want empty", ids)
+	}
+	if n := ts.notifier.Len(); n != 0 {
+		t.Fatalf("%d subscriptions left after the client cancelled, want 0", n)
+	}
+	if got := testutil.ToFloat64(metrics.MatchmakingAbandoned.WithLabelValues("client_disconnected")) - abandoned; got != 1 {
+		t.Fatalf("abandoned waits = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.MatchmakingTimeouts) - timeouts; got != 0 {
+		t.Fatalf("timeouts = %v, want the cancellation not counted as a timeout", got)
+	}
+}
+
+// 結果を待っているクライアントがいないエントリとはセッションを作らず、相手は待機キューに残して次の参加者と組ませる
+func TestAbsentPlayerNotMatched(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ctx := context.Background()
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	// タイムアウトの直後などで、購読がないまま待機キューに残っている bob
+	gone := model.QueueEntry{Players: []model.Player{{ID: "bob", Rating: 1500}}, Rating: 1500, GameMode: "duel", WaitingSince: ts.now().Add(-30 * time.Second)}
+	if _, err := ts.store.EnqueueEntry(ctx, gone); err != nil {
+		t.Fatal(err)
+	}
+
+	before := testutil.ToFloat64(metrics.AbsentEntriesSkipped)
+	if cycle := ts.tick(t); cycle.Matched != 0 {
+		t.Fatalf("tick created %d sessions with an absent player, want none", cycle.Matched)
+	}
+	if got := testutil.ToFloat64(metrics.AbsentEntriesSkipped) - before; got != 1 {
+		t.Errorf("absent entries skipped = %v, want 1", got)
+	}
+	if ids := ts.queuedIDs(t); !slices.Equal(sortedCopy(ids), []string{"alice", "bob"}) {
+		t.Fatalf("queued = %v, want alice and bob left in the queue", ids)
+	}
+	select {
+	case rec := <-alice:
+		t.Fatalf("alice got a response without a match: %d %s", rec.Code, rec.Body)
+	default:
+	}
+
+	carol := ts.startEnqueue(t, map[string]interface{}{"id": "carol"})
+	ts.waitQueued(t, 3)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want alice and carol matched", cycle.Matched)
+	}
+	for _, done := range []<-chan *httptest.ResponseRecorder{alice, carol} {
+		rec := receive(t, done)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var session model.SessionResult
+		decodeJSON(t, rec, &session)
+		if ids := []string{session.Player1.ID, session.Player2.ID}; !slices.Equal(sortedCopy(ids), []string{"alice", "carol"}) {
+			t.Fatalf("players = %v, want alice and carol", ids)
+		}
+	}
+}
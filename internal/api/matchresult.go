@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+)
+
+// findMatchedSession は now の時点で、プレイヤーが参加している成立直後（MatchResultWindow 以内）の未終了のセッションを返します。
+// 該当するセッションがない場合は ErrSessionNotFound を返します。
+func (s *Server) findMatchedSession(ctx context.Context, playerID string, now time.Time) (model.SessionResult, error) {
+	return s.Store.RecentSession(ctx, playerID, now.Add(-s.cfg.MatchResultWindow))
+}
+
+// matchResultHandler は、マッチング成立の直後に接続が切れたクライアントが再接続した際に、成立済みのセッションを返します。
+// クライアントは待機キューへ登録し直す前にこれを確認し、既に成立していればそのセッションを承諾します。該当しない場合は 404 を返します。
+func (s *Server) matchResultHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeMatchResult(w, r, r.URL.Query().Get("player_id"))
+}
+
+// currentMatchHandler は matchResultHandler と同じく、パスで指定したプレイヤーの成立済みのセッションを返します（GET /matchmaking/{player_id}/current）。
+func (s *Server) currentMatchHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeMatchResult(w, r, r.PathValue("player_id"))
+}
+
+// writeMatchResult は requestedID のプレイヤーが参加している成立済みのセッションを返して通知済みにします。
+func (s *Server) writeMatchResult(w http.ResponseWriter, r *http.Request, requestedID string) {
+	playerID, err := authorizedPlayerID(r.Context(), requestedID)
+	if err != nil {
+		writePlayerMismatch(w)
+		return
+	}
+	if err := model.ValidateID("player_id", playerID, "player_id"); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+
+	session, err := s.claimPendingSession(r.Context(), playerID)
+	if errors.Is(err, model.ErrSessionNotFound) {
+		writeJSONError(w, http.StatusNotFound, errCodeNotMatched, "Player has no recent matched session")
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "成立済みセッション取得エラー", "func", "writeMatchResult", "player_id", playerID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("match_result").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to get match result")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(versionedSession(r.Context(), session)); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "writeMatchResult", "error", err)
+	}
+}
+
+// ackMatchResultHandler は、クライアントが成立済みのセッションを受け取ったことを記録します（DELETE /matchmaking/{player_id}/current?session_id=...）。
+// 以後そのセッションは MatchResultWindow 以内でも再接続時に返さないため、ゲームへ接続した後に古い結果で再び承諾し直すことがありません。
+// プレイヤーがセッションの参加者でない場合は 404 を返します。
+func (s *Server) ackMatchResultHandler(w http.ResponseWriter, r *http.Request) {
+	playerID, err := authorizedPlayerID(r.Context(), r.PathValue("player_id"))
+	if err != nil {
+		writePlayerMismatch(w)
+		return
+	}
+	if err := model.ValidateID("player_id", playerID, "player_id"); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+	sessionID := r.URL.Query().Get("session_id")
+	if err := model.ValidateID("session_id", sessionID, "session_id"); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+
+	err = s.Store.AckSessionResult(r.Context(), sessionID, playerID, s.now())
+	if errors.Is(err, model.ErrSessionNotFound) {
+		writeJSONError(w, http.StatusNotFound, errCodeSessionNotFound, "Session not found for the player")
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "成立済みセッションの受信記録エラー", "func", "ackMatchResultHandler", "player_id", playerID, "session_id", sessionID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("match_result").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to acknowledge match result")
+		return
+	}
+	s.logger.InfoContext(r.Context(), "match result acknowledged", "player_id", playerID, "session_id", sessionID)
+	w.WriteHeader(http.StatusNoContent)
+}
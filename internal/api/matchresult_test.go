@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// currentMatch は GET /matchmaking/{player_id}/current のステータスコードとセッションを返します。
+func (ts *testServer) currentMatch(t *testing.T, playerID string) (int, model.SessionResult) {
+	t.Helper()
+	rec := ts.do(t, "GET", "/matchmaking/"+playerID+"/current", nil, nil)
+	var session model.SessionResult
+	if rec.Code == http.StatusOK {
+		decodeJSON(t, rec, &session)
+	} else if code := errorShape(t, rec, http.StatusNotFound); code != errCodeNotMatched {
+		t.Fatalf("GET /matchmaking/%s/current: code = %q, want %q", playerID, code, errCodeNotMatched)
+	}
+	return rec.Code, session
+}
+
+// 成立直後に接続が切れたプレイヤーは、MatchResultWindow の間は再接続して成立済みのセッションを受け取れる
+func TestCurrentMatchWithinGraceWindow(t *testing.T) {
+	ts := newTestServer(t, nil)
+	session := ts.matchPair(t, "alice", "bob")
+
+	ts.clock.Advance(ts.cfg.MatchResultWindow - time.Second)
+	if status, got := ts.currentMatch(t, "alice"); status != http.StatusOK || got.SessionID != session.SessionID {
+		t.Fatalf("status %d, session %q, want 200 and %s", status, got.SessionID, session.SessionID)
+	}
+	rec := ts.do(t, "GET", "/matchmaking/result?player_id=bob", nil, nil)
+	var got model.SessionResult
+	decodeJSON(t, rec, &got)
+	if rec.Code != http.StatusOK || got.SessionID != session.SessionID {
+		t.Fatalf("result by query: status %d, session %q, want 200 and %s", rec.Code, got.SessionID, session.SessionID)
+	}
+	if status, _ := ts.currentMatch(t, "carol"); status != http.StatusNotFound {
+		t.Fatalf("player without a match: status %d, want 404", status)
+	}
+
+	ts.clock.Advance(2 * time.Second)
+	if status, _ := ts.currentMatch(t, "alice"); status != http.StatusNotFound {
+		t.Fatalf("after the grace window: status %d, want 404", status)
+	}
+}
+
+// 受信を記録した（ack）プレイヤーにはセッションを返さず、他の参加者には引き続き返す
+func TestCurrentMatchAck(t *testing.T) {
+	ts := newTestServer(t, nil)
+	session := ts.matchPair(t, "alice", "bob")
+
+	for _, tc := range []struct {
+		name, path string
+		status     int
+	}{
+		{"unknown session", "/matchmaking/alice/current?session_id=unknown", http.StatusNotFound},
+		{"not a participant", "/matchmaking/carol/current?session_id=" + session.SessionID, http.StatusNotFound},
+		{"missing session id", "/matchmaking/alice/current", http.StatusBadRequest},
+	} {
+		if rec := ts.do(t, "DELETE", tc.path, nil, nil); rec.Code != tc.status {
+			t.Errorf("%s: status %d, want %d: %s", tc.name, rec.Code, tc.status, rec.Body)
+		}
+	}
+
+	if rec := ts.do(t, "DELETE", "/matchmaking/alice/current?session_id="+session.SessionID, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("ack: status %d, want 204: %s", rec.Code, rec.Body)
+	}
+	if status, _ := ts.currentMatch(t, "alice"); status != http.StatusNotFound {
+		t.Fatalf("after the ack: status %d, want 404", status)
+	}
+	if status, got := ts.currentMatch(t, "bob"); status != http.StatusOK || got.SessionID != session.SessionID {
+		t.Fatalf("other participant: status %d, session %q, want 200 and %s", status, got.SessionID, session.SessionID)
+	}
+}
+
+// 中止されたセッションは猶予期間内でも返さない
+func TestCurrentMatchSkipsAbortedSession(t *testing.T) {
+	ts := newTestServer(t, nil)
+	session := ts.matchPair(t, "alice", "bob")
+	ts.reportNoShow(t, session.SessionID, "bob")
+	if status, _ := ts.currentMatch(t, "bob"); status != http.StatusNotFound {
+		t.Fatalf("aborted session: status %d, want 404", status)
+	}
+}
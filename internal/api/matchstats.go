@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+)
+
+// defaultMatchQualityStatsWindow と maxMatchQualityStatsWindow は GET /admin/stats/match-quality の集計期間の既定値と上限です。
+const (
+	defaultMatchQualityStatsWindow = time.Hour
+	maxMatchQualityStatsWindow     = 30 * 24 * time.Hour
+)
+
+// matchQualityStatsResponse は GET /admin/stats/match-quality のレスポンスです。
+type matchQualityStatsResponse struct {
+	Window string    `json:"window"`
+	Since  time.Time `json:"since"`
+	store.MatchQualityStats
+}
+
+// adminMatchQualityStatsHandler は、直近の期間（クエリの window、既定は1時間）に作成したセッションの対戦の質を集計して返します。
+func (s *Server) adminMatchQualityStatsHandler(w http.ResponseWriter, r *http.Request) {
+	window := defaultMatchQualityStatsWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxMatchQualityStatsWindow {
+			writeQueueEntryError(w, &model.FieldError{Field: "window", Message: fmt.Sprintf("window must be a positive duration up to %s", maxMatchQualityStatsWindow)})
+			return
+		}
+		window = d
+	}
+	since := s.now().Add(-window)
+
+	stats, err := s.Store.MatchQualityStats(r.Context(), since)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "マッチ品質集計エラー", "func", "adminMatchQualityStatsHandler", "error", err)
+		metrics.HandlerErrors.WithLabelValues("admin").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to aggregate match quality")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(matchQualityStatsResponse{Window: window.String(), Since: since, MatchQualityStats: stats}); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "adminMatchQualityStatsHandler", "error", err)
+	}
+}
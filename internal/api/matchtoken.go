@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/secret"
+)
+
+// MatchTokenClaims はマッチトークンに含めるセッションの情報です。
+type MatchTokenClaims struct {
+	SessionID string `json:"session_id"`
+	// PlayerIDs はボットを除く参加者のプレイヤーIDです（チーム順）。
+	PlayerIDs []string `json:"player_ids"`
+	GameMode  string   `json:"game_mode"`
+}
+
+// errMatchTokensDisabled は MATCH_TOKEN_SECRET が設定されていないため、マッチトークンを検証できないことを表します。
+var errMatchTokensDisabled = errors.New("match tokens are not configured")
+
+// matchTokenLifetime はマッチトークンの有効期間です。承諾期限までに確定したセッションが期限切れ（SessionTTL）になるまで使えるようにします。
+func (c Config) matchTokenLifetime() time.Duration {
+	return c.AcceptWindow + c.SessionTTL
+}
+
+// MintMatchToken はセッションのマッチトークンを発行して MatchToken に設定します。MatchTokenKeys が nil の場合は何もしません。
+// セッションIDが変わった場合（保存時の衝突）は発行し直してください（store.Config の ReissueMatchToken）。
+func (c Config) MintMatchToken(session *model.SessionResult, now time.Time) {
+	if c.MatchTokenKeys == nil {
+		return
+	}
+	claims := MatchTokenClaims{SessionID: session.SessionID, PlayerIDs: session.HumanPlayerIDs(), GameMode: session.GameMode}
+	subject, err := json.Marshal(claims)
+	if err != nil {
+		return
+	}
+	session.MatchToken = c.MatchTokenKeys.IssueToken(string(subject), now.Add(c.matchTokenLifetime()))
+}
+
+// VerifyToken は keys でマッチトークンの署名と有効期限を検証し、含まれるセッションの情報を返します。
+// セッションが中止されていないかは確認しないため、ゲームサーバは GET /sessions/verify で現在のセッションも確認してください。
+// 改ざんされたトークンは ErrInvalidSignature、期限切れは ErrTokenExpired、形式が不正なトークンは ErrMalformedToken を返します。
+func VerifyToken(keys *secret.KeyRing, token string, now time.Time) (MatchTokenClaims, error) {
+	if keys == nil {
+		return MatchTokenClaims{}, errMatchTokensDisabled
+	}
+	subject, err := keys.VerifyToken(token, now)
+	if err != nil {
+		return MatchTokenClaims{}, err
+	}
+	var claims MatchTokenClaims
+	if err := json.Unmarshal([]byte(subject), &claims); err != nil || claims.SessionID == "" {
+		return MatchTokenClaims{}, secret.ErrMalformedToken
+	}
+	return claims, nil
+}
+
+// verifyMatchTokenHandler は、ゲームサーバから送られたマッチトークン（クエリの token）を検証し、保存済みのセッションを返します。
+// トークンが不正・期限切れの場合は 401、セッションが中止・期限切れになっている場合は 409 を返します。
+func (s *Server) verifyMatchTokenHandler(w http.ResponseWriter, r *http.Request) {
+	claims, err := VerifyToken(s.cfg.MatchTokenKeys, r.URL.Query().Get("token"), s.now())
+	if errors.Is(err, errMatchTokensDisabled) {
+		writeJSONError(w, http.StatusNotFound, errCodeNotFound, "Match tokens are not enabled")
+		return
+	}
+	if err != nil {
+		message := "Match token is invalid"
+		if errors.Is(err, secret.ErrTokenExpired) {
+			message = "Match token has expired"
+		}
+		writeJSONError(w, http.StatusUnauthorized, errCodeMatchTokenInvalid, message)
+		return
+	}
+
+	session, err := s.Store.GetSession(r.Context(), claims.SessionID)
+	if errors.Is(err, model.ErrSessionNotFound) {
+		writeJSONError(w, http.StatusNotFound, errCodeSessionNotFound, "Session not found")
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "セッション取得エラー", "func", "verifyMatchTokenHandler", "session_id", claims.SessionID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("session").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to get session")
+		return
+	}
+	// トークンの参加者がセッションの参加者と一致することも確認する
+	if !slices.Equal(slices.Sorted(slices.Values(claims.PlayerIDs)), slices.Sorted(slices.Values(session.HumanPlayerIDs()))) {
+		writeJSONError(w, http.StatusUnauthorized, errCodeMatchTokenInvalid, "Match token is invalid")
+		return
+	}
+	if session.Status != model.SessionPendingAccept && session.Status != model.SessionActive {
+		writeErrorResponse(w, http.StatusConflict, ErrorDetail{
+			Code:    errCodeSessionEnded,
+			Message: "Session has already ended",
+			Details: map[string]interface{}{"status": session.Status},
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(versionedSession(r.Context(), session)); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "verifyMatchTokenHandler", "error", err)
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+	"matchmaking_project/internal/secret"
+)
+
+// matchTokenServer は keys（新しい順）でマッチトークンに署名・検証するサーバです。
+func matchTokenServer(t *testing.T, keys ...string) *testServer {
+	t.Helper()
+	ring, err := secret.NewKeyRing(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestServer(t, func(cfg *Config) {
+		cfg.MatchTokenKeys = ring
+		cfg.PlayerRateLimit = ratelimit.Config{}
+	})
+}
+
+// verifyToken は GET /sessions/verify で token を検証したレスポンスを返します。
+func (ts *testServer) verifyToken(t *testing.T, token string) (int, model.SessionResult) {
+	t.Helper()
+	rec := ts.do(t, "GET", "/sessions/verify?token="+url.QueryEscape(token), nil, nil)
+	var session model.SessionResult
+	if rec.Code == http.StatusOK {
+		decodeJSON(t, rec, &session)
+	}
+	return rec.Code, session
+}
+
+// マッチングしたプレイヤーにはマッチトークンを渡し、ゲームサーバはそのトークンでセッションを確認できる
+func TestMatchTokenVerify(t *testing.T) {
+	ts := matchTokenServer(t, "k1")
+	session := ts.matchPair(t, "alice", "bob")
+	if session.MatchToken == "" {
+		t.Fatal("matched session has no match token")
+	}
+	claims, err := VerifyToken(ts.cfg.MatchTokenKeys, session.MatchToken, ts.now())
+	if err != nil || claims.SessionID != session.SessionID || !slices.Equal(claims.PlayerIDs, session.HumanPlayerIDs()) {
+		t.Fatalf("claims = %+v (%v), want session %s with alice and bob", claims, err, session.SessionID)
+	}
+	status, got := ts.verifyToken(t, session.MatchToken)
+	if status != http.StatusOK || got.SessionID != session.SessionID {
+		t.Fatalf("status %d, session %s, want 200 and %s", status, got.SessionID, session.SessionID)
+	}
+}
+
+// 改ざんされたトークン・期限切れのトークンは 401、中止されたセッションのトークンは 409 を返す
+func TestMatchTokenRejected(t *testing.T) {
+	ts := matchTokenServer(t, "k1")
+	session := ts.matchPair(t, "alice", "bob")
+	other := ts.matchPair(t, "carol", "dave")
+
+	// 別のセッションの内容に差し替えた署名・署名の書き換え・形式の不正
+	parts := strings.Split(session.MatchToken, ".")
+	swapped := strings.Join(append([]string{strings.Split(other.MatchToken, ".")[0]}, parts[1:]...), ".")
+	signature := "A" + parts[2][1:]
+	if signature == parts[2] {
+		signature = "B" + parts[2][1:]
+	}
+	flipped := strings.Join([]string{parts[0], parts[1], signature}, ".")
+	for _, tc := range []struct {
+		name, token string
+		err         error
+	}{
+		{"swapped claims", swapped, secret.ErrInvalidSignature},
+		{"flipped signature", flipped, secret.ErrInvalidSignature},
+		{"malformed", "not-a-token", secret.ErrMalformedToken},
+		{"empty", "", secret.ErrMalformedToken},
+	} {
+		if _, err := VerifyToken(ts.cfg.MatchTokenKeys, tc.token, ts.now()); !errors.Is(err, tc.err) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.err)
+		}
+		rec := ts.do(t, "GET", "/sessions/verify?token="+url.QueryEscape(tc.token), nil, nil)
+		if code := errorShape(t, rec, http.StatusUnauthorized); code != errCodeMatchTokenInvalid {
+			t.Errorf("%s: code = %q, want %q", tc.name, code, errCodeMatchTokenInvalid)
+		}
+	}
+
+	// 中止されたセッションのトークンは署名が正しくても使えない
+	ts.reportNoShow(t, other.SessionID, "dave")
+	rec := ts.do(t, "GET", "/sessions/verify?token="+url.QueryEscape(other.MatchToken), nil, nil)
+	if code := errorShape(t, rec, http.StatusConflict); code != errCodeSessionEnded {
+		t.Fatalf("aborted session: code = %q, want %q", code, errCodeSessionEnded)
+	}
+
+	// 有効期間（承諾期限 + SessionTTL）を過ぎたトークン
+	ts.clock.Advance(ts.cfg.matchTokenLifetime() + time.Second)
+	if _, err := VerifyToken(ts.cfg.MatchTokenKeys, session.MatchToken, ts.now()); !errors.Is(err, secret.ErrTokenExpired) {
+		t.Fatalf("expired token: err = %v, want ErrTokenExpired", err)
+	}
+	rec = ts.do(t, "GET", "/sessions/verify?token="+url.QueryEscape(session.MatchToken), nil, nil)
+	if code := errorShape(t, rec, http.StatusUnauthorized); code != errCodeMatchTokenInvalid {
+		t.Fatalf("expired token: code = %q, want %q", code, errCodeMatchTokenInvalid)
+	}
+}
+
+// 鍵を入れ替えた後も、古い鍵で署名したトークンは検証でき、新しいトークンは新しい鍵で署名する
+func TestMatchTokenKeyRotation(t *testing.T) {
+	ts := matchTokenServer(t, "k2", "k1")
+	session := ts.matchPair(t, "alice", "bob")
+
+	oldKeys, err := secret.NewKeyRing("k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyToken(oldKeys, session.MatchToken, ts.now()); !errors.Is(err, secret.ErrInvalidSignature) {
+		t.Fatalf("new token verified with the old key only: err = %v, want ErrInvalidSignature", err)
+	}
+	minted := session
+	Config{MatchTokenKeys: oldKeys, SessionTTL: ts.cfg.SessionTTL}.MintMatchToken(&minted, ts.now())
+	if status, got := ts.verifyToken(t, minted.MatchToken); status != http.StatusOK || got.SessionID != session.SessionID {
+		t.Fatalf("token signed with the old key: status %d, want 200", status)
+	}
+
+	// 一覧から外した鍵のトークンは使えない
+	unknownKeys, err := secret.NewKeyRing("k0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Config{MatchTokenKeys: unknownKeys, SessionTTL: ts.cfg.SessionTTL}.MintMatchToken(&minted, ts.now())
+	if status, _ := ts.verifyToken(t, minted.MatchToken); status != http.StatusUnauthorized {
+		t.Fatalf("token signed with a removed key: status %d, want 401", status)
+	}
+}
+
+// 署名鍵を設定していない場合はトークンを発行せず、検証のエンドポイントは 404 を返す
+func TestMatchTokenDisabled(t *testing.T) {
+	ts := newTestServer(t, nil)
+	if session := ts.matchPair(t, "alice", "bob"); session.MatchToken != "" {
+		t.Fatalf("match token = %q, want none without keys", session.MatchToken)
+	}
+	if status, _ := ts.verifyToken(t, "anything"); status != http.StatusNotFound {
+		t.Fatalf("status %d, want 404", status)
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"matchmaking_project/internal/metrics"
+)
+
+// registerMetrics は main と同じくメトリクスを既定のレジストリへ登録します（テストを繰り返し実行しても1回だけ）。
+var registerMetrics = sync.OnceFunc(func() { metrics.RegisterMetrics(prometheus.DefaultRegisterer) })
+
+// scrapeMetrics は GET /metrics の本文を返します。
+func (ts *testServer) scrapeMetrics(t *testing.T) string {
+	t.Helper()
+	rec := ts.do(t, "GET", "/metrics", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics: status %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestMetricsAfterMatch(t *testing.T) {
+	registerMetrics()
+	ts := newTestServer(t, nil)
+	created := metrics.MatchesCreated.WithLabelValues("duel")
+	before := testutil.ToFloat64(created)
+	ts.matchPair(t, "alice", "bob")
+	if got := testutil.ToFloat64(created) - before; got != 1 {
+		t.Fatalf("matches created = %v, want 1", got)
+	}
+
+	body := ts.scrapeMetrics(t)
+	for _, name := range []string{
+		"matchmaking_queue_depth",
+		"matchmaking_waiting_subscribers",
+		`matchmaking_matches_created_total{mode="duel"}`,
+		"matchmaking_timeouts_total",
+		"matchmaking_cancellations_total",
+		"matchmaking_wait_seconds_count",
+		"matchmaking_match_quality_count",
+	} {
+		if !strings.Contains(body, "\n"+name+" ") && !strings.Contains(body, "\n"+name+"{") {
+			t.Errorf("metric %s is missing from /metrics", name)
+		}
+	}
+}
+
+// gatherValues は reg のメトリクスを名前ごとの値（ラベルのない Gauge・Counter）にします。
+func gatherValues(t *testing.T, reg *prometheus.Registry) map[string]float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			if len(m.GetLabel()) != 0 {
+				continue
+			}
+			switch {
+			case m.GetGauge() != nil:
+				values[f.GetName()] = m.GetGauge().GetValue()
+			case m.GetCounter() != nil:
+				values[f.GetName()] = m.GetCounter().GetValue()
+			}
+		}
+	}
+	return values
+}
+
+// 接続プールとマッチングプロセッサーのメトリクスを登録でき、マッチングの処理の後に値を報告する
+func TestPoolAndProcessorMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics.RegisterMetrics(reg)
+
+	// 接続プールの状態は sql.DB.Stats から読む（sql.Open は接続しない）
+	db, err := sql.Open("mysql", "user:password@tcp(127.0.0.1:1)/matchmaking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(7)
+	metrics.MetricsDB.Store(db)
+	t.Cleanup(func() { metrics.MetricsDB.Store(nil) })
+
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.ProcessorInterval = 5 * time.Millisecond
+		cfg.Queue.ProcessorMaxIdleInterval = 5 * time.Millisecond
+	})
+	metrics.ProcessorLag.Set(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ts.MatchmakingProcessor(ctx)
+	}()
+	waitFor(t, "2 processor cycles", func() bool { return testutil.ToFloat64(metrics.ProcessorLag) > 0 })
+	cancel()
+	<-done
+
+	values := gatherValues(t, reg)
+	for _, name := range []string{
+		"matchmaking_db_open_connections",
+		"matchmaking_db_in_use_connections",
+		"matchmaking_db_idle_connections",
+		"matchmaking_db_wait_count_total",
+		"matchmaking_db_wait_seconds_total",
+		"matchmaking_processor_cycle_failures_total",
+	} {
+		if _, ok := values[name]; !ok {
+			t.Errorf("metric %s is not reported", name)
+		}
+	}
+	if got := values["matchmaking_db_max_open_connections"]; got != 7 {
+		t.Errorf("max open connections = %v, want 7", got)
+	}
+	if got := values["matchmaking_processor_lag_seconds"]; got <= 0 || got > time.Second.Seconds() {
+		t.Errorf("processor lag = %v, want the time between two cycles", got)
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+)
+
+// noShowBanReason はゲームに現れなかったプレイヤーの参加禁止の理由です。
+const noShowBanReason = "no_show"
+
+// noShowRequest は POST /sessions/{id}/noshow のリクエストボディです。
+type noShowRequest struct {
+	// PlayerID はゲームに現れなかった参加者です。
+	PlayerID string `json:"player_id"`
+}
+
+// noShowHandler はゲームサーバからの、参加者がゲームに現れなかったという報告を処理します。
+// 承諾待ち・確定済みのセッションを中止し、現れた参加者を元の待機開始時刻のまま待機キューへ戻して、中止したセッションを返します。
+// 既に中止済みのセッションはそのまま返し、終了したセッションには 409 を返します。
+func (s *Server) noShowHandler(w http.ResponseWriter, r *http.Request) {
+	var req noShowRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+	if err := model.ValidateID("player_id", req.PlayerID, "player_id"); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+	sessionID := r.PathValue("id")
+	if err := model.SessionID(sessionID).Validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, errCodeInvalidSessionID, "Invalid session id")
+		return
+	}
+
+	session, err := s.resolveReadyCheck(r.Context(), sessionID, req.PlayerID, model.ReadyNoShow)
+	if errors.Is(err, model.ErrSessionNotFound) {
+		writeJSONError(w, http.StatusNotFound, errCodeSessionNotFound, "Session not found")
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "不在の記録エラー", "func", "noShowHandler", "session_id", sessionID, "player_id", req.PlayerID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("noshow").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to record no-show")
+		return
+	}
+	if session.Status != model.SessionAborted {
+		writeJSONError(w, http.StatusConflict, errCodeSessionEnded, "Session has already ended")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(versionedSession(r.Context(), session)); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "noShowHandler", "session_id", sessionID, "error", err)
+	}
+}
+
+// penalizeNoShows は中止されたセッションで、ゲームに現れなかった（expired の場合は承諾しなかった）参加者のマッチングへの参加を NoShowPenalty の間禁止し、クールダウンを設定します。
+// より長い参加禁止が既にあるプレイヤーは短くしません。
+func (s *Server) penalizeNoShows(ctx context.Context, session model.SessionResult, expired bool) {
+	now := s.now()
+	for _, p := range session.Participants {
+		absent := p.ReadyState == model.ReadyNoShow || (expired && p.ReadyState == model.ReadyPending)
+		if !absent || p.IsBot {
+			continue
+		}
+		reason, cooldownReason := "reported", cooldownNoShow
+		if p.ReadyState == model.ReadyPending {
+			reason, cooldownReason = "accept_timeout", cooldownAcceptTimeout
+		}
+		metrics.NoShows.WithLabelValues(reason).Inc()
+		s.Events.CancelSession(session, []string{p.ID}, noShowBanReason, now)
+		s.applyCooldown(ctx, session, p.ID, cooldownReason)
+		if s.cfg.NoShowPenalty <= 0 {
+			continue
+		}
+
+		until := now.Add(s.cfg.NoShowPenalty)
+		ban, banned, err := s.Store.ActiveBan(ctx, []string{p.ID}, now)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "参加禁止の確認エラー", "func", "penalizeNoShows", "session_id", session.SessionID, "player_id", p.ID, "error", err)
+			continue
+		}
+		if banned && (ban.Until.IsZero() || !ban.Until.Before(until)) {
+			continue
+		}
+		if _, err := s.Store.BanPlayer(ctx, store.PlayerBan{PlayerID: p.ID, Until: until, Reason: noShowBanReason, CreatedAt: now}); err != nil {
+			s.logger.ErrorContext(ctx, "不在による参加禁止の登録エラー", "func", "penalizeNoShows", "session_id", session.SessionID, "player_id", p.ID, "error", err)
+			continue
+		}
+		s.logger.InfoContext(ctx, "player locked out after no-show", "session_id", session.SessionID, "player_id", p.ID, "until", until)
+	}
+}
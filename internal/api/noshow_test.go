@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// reportNoShow はゲームサーバとして playerID がゲームに現れなかったことを報告します。
+func (ts *testServer) reportNoShow(t *testing.T, sessionID, playerID string) model.SessionResult {
+	t.Helper()
+	rec := serve(t, ts.AdminHandler(), "POST", "/sessions/"+sessionID+"/noshow", map[string]string{"player_id": playerID}, adminHeader())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("no-show of %s: status %d: %s", playerID, rec.Code, rec.Body)
+	}
+	var session model.SessionResult
+	decodeJSON(t, rec, &session)
+	return session
+}
+
+// 現れなかった参加者を報告するとセッションを中止し、現れた参加者を元の待機開始時刻のまま待機キューへ戻して、現れなかった参加者の参加を禁止する
+func TestNoShowRequeuesPresentPlayer(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.NoShowPenalty = 10 * time.Minute
+		cfg.PlayerRateLimit = ratelimit.Config{}
+	})
+	waitingSince := ts.now()
+	session := ts.matchPair(t, "alice", "bob")
+	ts.clock.Advance(30 * time.Second)
+
+	got := ts.reportNoShow(t, session.SessionID, "bob")
+	if got.Status != model.SessionAborted {
+		t.Fatalf("status = %q, want %q", got.Status, model.SessionAborted)
+	}
+	if !requeued(got, "alice") || requeued(got, "bob") {
+		t.Fatalf("participants = %+v, want only alice requeued", got.Participants)
+	}
+	queued := ts.queuedPlayers(t)
+	if len(queued) != 1 || queued[0].ID != "alice" || !queued[0].WaitingSince.Equal(waitingSince) {
+		t.Fatalf("queued = %+v, want alice waiting since %v", queued, waitingSince)
+	}
+
+	bannedDetails(t, ts, map[string]interface{}{"id": "bob"})
+
+	// 同じ報告の再送には中止済みのセッションをそのまま返す
+	if again := ts.reportNoShow(t, session.SessionID, "bob"); again.Status != model.SessionAborted {
+		t.Fatalf("repeated report: status = %q, want %q", again.Status, model.SessionAborted)
+	}
+	if queued := ts.queuedPlayers(t); len(queued) != 1 {
+		t.Fatalf("queued = %+v after the repeated report, want alice once", queued)
+	}
+}
+
+// 参加禁止の時間が 0 なら、現れなかった参加者の参加を禁止しない
+func TestNoShowWithoutPenalty(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.NoShowPenalty = 0 })
+	session := ts.matchPair(t, "alice", "bob")
+	ts.reportNoShow(t, session.SessionID, "bob")
+	if _, banned, err := ts.store.ActiveBan(context.Background(), []string{"bob"}, ts.now()); err != nil || banned {
+		t.Fatalf("bob banned = %v (err %v), want no lockout", banned, err)
+	}
+}
+
+func TestNoShowErrors(t *testing.T) {
+	ts := newTestServer(t, nil)
+	admin := ts.AdminHandler()
+	for _, tc := range []struct {
+		name, path string
+		body       interface{}
+		status     int
+		code       string
+	}{
+		{"unknown session", "/sessions/" + string(model.NewSessionID()) + "/noshow", map[string]string{"player_id": "bob"}, http.StatusNotFound, errCodeSessionNotFound},
+		{"invalid session id", "/sessions/not-a-session/noshow", map[string]string{"player_id": "bob"}, http.StatusBadRequest, errCodeInvalidSessionID},
+		{"missing player", "/sessions/" + string(model.NewSessionID()) + "/noshow", map[string]string{}, http.StatusBadRequest, errCodeInvalidRequest},
+	} {
+		if code := errorShape(t, serve(t, admin, "POST", tc.path, tc.body, adminHeader()), tc.status); code != tc.code {
+			t.Errorf("%s: code = %q, want %q", tc.name, code, tc.code)
+		}
+	}
+
+	// 結果を報告済みのセッションは中止できない
+	session := ts.activeSession(t, "alice", "bob")
+	if rec := serve(t, admin, "POST", "/sessions/"+session.SessionID+"/result", map[string]int{"winning_team": 1}, adminHeader()); rec.Code != http.StatusOK {
+		t.Fatalf("result: status %d: %s", rec.Code, rec.Body)
+	}
+	rec := serve(t, admin, "POST", "/sessions/"+session.SessionID+"/noshow", map[string]string{"player_id": "bob"}, adminHeader())
+	if code := errorShape(t, rec, http.StatusConflict); code != errCodeSessionEnded {
+		t.Fatalf("finished session: code = %q, want %q", code, errCodeSessionEnded)
+	}
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"matchmaking_project/internal/model"
+)
+
+// Notifier はマッチング結果を待機中のリクエストへ届ける仕組みです。
+// キーには QueueEntry.key を使用します。
+type Notifier interface {
+	// Subscribe は key 宛てのマッチング結果を受け取るチャネルを登録します。
+	// 同じ key で既に待機中の場合は ErrAlreadyQueued を返します。
+	Subscribe(key string) (<-chan model.SessionResult, error)
+	// Unsubscribe は Subscribe で登録したチャネルの登録を解除します。
+	// 同じ key で別のチャネルが登録し直されている場合は何もしません。
+	Unsubscribe(key string, ch <-chan model.SessionResult)
+	// Publish は key 宛てにマッチング結果を通知します。
+	Publish(key string, session model.SessionResult) error
+	// Len はこのインスタンスで登録中の購読数を返します。
+	Len() int
+	// Subscribed は key 宛ての通知を待っている購読があるかどうかを返します（複数インスタンスの場合は全インスタンスを対象にします）。
+	Subscribed(ctx context.Context, key string) (bool, error)
+}
+
+// errSubscriberNotReceiving は、購読のチャネルに受け取られていない通知が残っていたため、通知を届けられなかったことを表します。
+var errSubscriberNotReceiving = errors.New("subscriber is not receiving notifications")
+
+// memoryNotifier はプロセス内のチャネルでマッチング結果を通知する Notifier です。
+// 単一インスタンスで動作させる場合に使用します。
+type memoryNotifier struct {
+	mu    sync.Mutex
+	chans map[string]chan model.SessionResult
+}
+
+// NewMemoryNotifier はプロセス内で通知する Notifier を生成します。
+func NewMemoryNotifier() Notifier {
+	return &memoryNotifier{chans: make(map[string]chan model.SessionResult)}
+}
+
+func (n *memoryNotifier) Subscribe(key string) (<-chan model.SessionResult, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, exists := n.chans[key]; exists {
+		return nil, model.ErrAlreadyQueued
+	}
+	ch := make(chan model.SessionResult, 1)
+	n.chans[key] = ch
+	return ch, nil
+}
+
+func (n *memoryNotifier) Unsubscribe(key string, ch <-chan model.SessionResult) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if cur, ok := n.chans[key]; ok && (<-chan model.SessionResult)(cur) == ch {
+		delete(n.chans, key)
+	}
+}
+
+func (n *memoryNotifier) Len() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.chans)
+}
+
+func (n *memoryNotifier) Subscribed(ctx context.Context, key string) (bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, ok := n.chans[key]
+	return ok, nil
+}
+
+// Publish は購読をロック中に取り出し、ロックの外でチャネルへ送ります。登録の解除は送信できた場合のみ行います。
+// 送信はブロックしないため、受け取られていない通知が残っている（読み手がいない）場合は errSubscriberNotReceiving を返します。
+// その場合は登録を残し、読み手が受け取った後に再通知（NotificationOutbox）で届けられるようにします。
+func (n *memoryNotifier) Publish(key string, session model.SessionResult) error {
+	n.mu.Lock()
+	ch, ok := n.chans[key]
+	n.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	select {
+	case ch <- session:
+	default:
+		return errSubscriberNotReceiving
+	}
+	n.mu.Lock()
+	// 送信の間に登録し直された別の購読は残す
+	if cur, ok := n.chans[key]; ok && cur == ch {
+		delete(n.chans, key)
+	}
+	n.mu.Unlock()
+	return nil
+}
+
+// redisNotifier は Redis の pub/sub でマッチング結果を通知する Notifier です。
+// 複数の API インスタンスが同じ MySQL の待機キューを共有する場合に使用します。
+type redisNotifier struct {
+	client *redis.Client
+	logger *slog.Logger
+	// subscribeTimeout は購読の確立を待つ時間の上限です（既定は redisSubscribeTimeout）。
+	subscribeTimeout time.Duration
+
+	mu   sync.Mutex
+	subs map[string]*redisSubscription
+}
+
+// redisSubscribeTimeout は Redis の購読の確立を待つ時間の上限の既定値です。
+const redisSubscribeTimeout = 5 * time.Second
+
+// redisSubscription は1件の待機に対応する Redis の購読です。
+// pubsub は購読を確立するまで nil です（キーの予約中）。redisNotifier.mu を保持して読み書きします。
+type redisSubscription struct {
+	pubsub *redis.PubSub
+	ch     chan model.SessionResult
+}
+
+// newRedisNotifier は redisNotifier を生成します。
+func newRedisNotifier(client *redis.Client, logger *slog.Logger) *redisNotifier {
+	return &redisNotifier{client: client, logger: logger, subscribeTimeout: redisSubscribeTimeout, subs: make(map[string]*redisSubscription)}
+}
+
+// redisNotifierOptions は通知に使う Redis への接続の設定です。
+// 購読の確立を subscribeTimeout で打ち切れるよう、context の期限をソケットの読み書きの期限にも使います。
+func redisNotifierOptions(addr string) *redis.Options {
+	return &redis.Options{Addr: addr, ContextTimeoutEnabled: true}
+}
+
+// redisChannel は key に対応する Redis のチャネル名を返します。
+func redisChannel(key string) string {
+	return "matchmaking:" + key
+}
+
+func (n *redisNotifier) Subscribe(key string) (<-chan model.SessionResult, error) {
+	// Redis とのやり取りの間に他のキーの購読・解除を止めないよう、キーを予約してからロックの外で購読する
+	n.mu.Lock()
+	if _, exists := n.subs[key]; exists {
+		n.mu.Unlock()
+		return nil, model.ErrAlreadyQueued
+	}
+	sub := &redisSubscription{ch: make(chan model.SessionResult, 1)}
+	n.subs[key] = sub
+	n.mu.Unlock()
+
+	// 購読の確立を待ってから返す（待機キュー登録前に購読していないと通知を取りこぼすため）
+	ctx, cancel := context.WithTimeout(context.Background(), n.subscribeTimeout)
+	defer cancel()
+	pubsub := n.client.Subscribe(ctx, redisChannel(key))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		n.mu.Lock()
+		delete(n.subs, key)
+		n.mu.Unlock()
+		return nil, fmt.Errorf("Redis購読エラー: %v", err)
+	}
+
+	n.mu.Lock()
+	sub.pubsub = pubsub
+	n.mu.Unlock()
+	go n.forward(key, sub)
+	return sub.ch, nil
+}
+
+// forward は Redis から受信したマッチング結果を sub のチャネルへ転送します。購読が閉じられると終了します。
+// デコードできない通知は待機中のリクエストに届けられないため、ログに出力して読み捨てます。
+func (n *redisNotifier) forward(key string, sub *redisSubscription) {
+	for msg := range sub.pubsub.Channel() {
+		var session model.SessionResult
+		if err := json.Unmarshal([]byte(msg.Payload), &session); err != nil {
+			n.logger.Error("マッチング結果の通知のデコードエラー", "func", "forward", "entry", key, "payload_bytes", len(msg.Payload), "error", err)
+			continue
+		}
+		select {
+		case sub.ch <- session:
+		default:
+		}
+	}
+}
+
+func (n *redisNotifier) Unsubscribe(key string, ch <-chan model.SessionResult) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if sub, ok := n.subs[key]; ok && (<-chan model.SessionResult)(sub.ch) == ch {
+		sub.pubsub.Close()
+		delete(n.subs, key)
+	}
+}
+
+func (n *redisNotifier) Len() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.subs)
+}
+
+func (n *redisNotifier) Subscribed(ctx context.Context, key string) (bool, error) {
+	n.mu.Lock()
+	_, local := n.subs[key]
+	n.mu.Unlock()
+	if local {
+		return true, nil
+	}
+	counts, err := n.client.PubSubNumSub(ctx, redisChannel(key)).Result()
+	if err != nil {
+		return false, err
+	}
+	return counts[redisChannel(key)] > 0, nil
+}
+
+func (n *redisNotifier) Publish(key string, session model.SessionResult) error {
+	payload, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return n.client.Publish(context.Background(), redisChannel(key), payload).Err()
+}
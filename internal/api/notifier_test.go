@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"matchmaking_project/internal/model"
+)
+
+// useRedisNotifier は ts のマッチング結果の通知を addr の Redis の pub/sub に切り替えます。
+func (ts *testServer) useRedisNotifier(t *testing.T, addr string) {
+	t.Helper()
+	c := ts.NotifierComponent(addr)
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Stop(context.Background()) })
+}
+
+// 別のインスタンスで待機しているプレイヤーにも、Redis の pub/sub でマッチング結果が届く
+func TestRedisNotifierAcrossInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	first := newTestServer(t, nil)
+	second := first.sibling(t)
+	first.useRedisNotifier(t, mr.Addr())
+	second.useRedisNotifier(t, mr.Addr())
+
+	alice := first.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	first.waitQueued(t, 1)
+	bob := second.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	first.waitQueued(t, 2)
+	if subscribed, err := first.notifier.Subscribed(context.Background(), "bob"); err != nil || !subscribed {
+		t.Fatalf("bob subscribed on the other instance = %v, %v, want true", subscribed, err)
+	}
+
+	// 同じキーの購読は、同じインスタンスでは重複できない
+	if _, err := second.notifier.Subscribe("bob"); !errors.Is(err, model.ErrAlreadyQueued) {
+		t.Fatalf("second subscription = %v, want ErrAlreadyQueued", err)
+	}
+
+	if cycle := first.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+	var sessions [2]model.SessionResult
+	for i, done := range []<-chan *httptest.ResponseRecorder{alice, bob} {
+		rec := receive(t, done)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("player %d: status %d: %s", i, rec.Code, rec.Body)
+		}
+		decodeJSON(t, rec, &sessions[i])
+	}
+	if sessions[0].SessionID == "" || sessions[1].SessionID != sessions[0].SessionID {
+		t.Fatalf("session ids = %q, %q, want the same session", sessions[0].SessionID, sessions[1].SessionID)
+	}
+	waitFor(t, "bob's subscription to close", func() bool {
+		subscribed, err := first.notifier.Subscribed(context.Background(), "bob")
+		return err == nil && !subscribed
+	})
+}
+
+// stalledRedis は接続を受け付けるが応答しない Redis の代わりのサーバを起動し、そのアドレスを返します。
+func stalledRedis(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return l.Addr().String()
+}
+
+// Redis が応答しない間も、他のキーの購読の確認・解除と購読数の取得は待たされず、購読は上限の時間で失敗してキーを解放する
+func TestRedisSubscribeDoesNotHoldLockDuringIO(t *testing.T) {
+	client := redis.NewClient(redisNotifierOptions(stalledRedis(t)))
+	t.Cleanup(func() { client.Close() })
+	n := newRedisNotifier(client, slog.New(slog.DiscardHandler))
+	n.subscribeTimeout = 300 * time.Millisecond
+
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		_, err := n.Subscribe("alice")
+		done <- err
+	}()
+	waitFor(t, "alice's key to be reserved", func() bool { return n.Len() == 1 })
+
+	// 予約中のキーは重複して購読できず、他のキーの操作は Redis の応答を待たない
+	quick := make(chan struct{})
+	go func() {
+		defer close(quick)
+		if _, err := n.Subscribe("alice"); !errors.Is(err, model.ErrAlreadyQueued) {
+			t.Errorf("second subscription = %v, want ErrAlreadyQueued", err)
+		}
+		if subscribed, err := n.Subscribed(context.Background(), "alice"); err != nil || !subscribed {
+			t.Errorf("alice subscribed = %v, %v, want true while reserved", subscribed, err)
+		}
+		n.Unsubscribe("bob", make(chan model.SessionResult))
+	}()
+	select {
+	case <-quick:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("operations on the notifier waited for the stalled Redis")
+	}
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("subscription to a stalled Redis succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription did not give up on the stalled Redis")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("subscription gave up after %v, want about the 300ms limit", elapsed)
+	}
+	if got := n.Len(); got != 0 {
+		t.Fatalf("%d subscriptions after the failure, want the reservation released", got)
+	}
+}
+
+// デコードできない通知はログに出力して読み捨て、その後の通知は届ける
+func TestRedisNotifierLogsUndecodablePayload(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ts := newTestServer(t, nil)
+	logs := ts.captureLogs(slog.LevelInfo)
+	ts.useRedisNotifier(t, mr.Addr())
+
+	ch, err := ts.notifier.Subscribe("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.Publish(redisChannel("alice"), "not json")
+	if err := ts.notifier.Publish("alice", model.SessionResult{SessionID: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-ch:
+		if got.SessionID != "s1" {
+			t.Fatalf("received %q, want s1", got.SessionID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification after the undecodable one")
+	}
+	if !strings.Contains(logs.String(), "マッチング結果の通知のデコードエラー") || !strings.Contains(logs.String(), `"entry":"alice"`) {
+		t.Fatalf("logs = %s, want the undecodable payload logged", logs)
+	}
+}
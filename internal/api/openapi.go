@@ -0,0 +1,246 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+)
+
+// openAPIOperation は OpenAPI の文書に載せる API の1操作です。
+// リクエスト・レスポンスのスキーマはハンドラが実際に使う Go の型から生成するため、型と文書が食い違うことはありません。
+type openAPIOperation struct {
+	Method  string
+	Path    string
+	Summary string
+	// Query はクエリパラメータの名前です。
+	Query []string
+	// Request はリクエストボディの型のゼロ値です。nil の場合はボディを受け付けません。
+	Request interface{}
+	// Responses はステータスコードごとのレスポンスボディの型のゼロ値です。nil の値はボディなしです。
+	// ここにないステータスコードのレスポンスは ErrorResponse（default）として記載します。
+	Responses map[int]interface{}
+}
+
+// openAPIOneOf はいずれかの型のボディを返すレスポンスです（keep_waiting を指定した POST /matchmaking の searching など）。
+type openAPIOneOf []interface{}
+
+// openAPIOperations は GET /openapi.json で公開する API の一覧です。ハンドラを追加・変更した場合はここも更新してください。
+var openAPIOperations = []openAPIOperation{
+	{Method: "POST", Path: "/matchmaking", Summary: "Join the matchmaking queue and long-poll for a match",
+		Query: []string{"timeout_seconds"}, Request: matchmakingRequest{},
+		Responses: map[int]interface{}{200: openAPIOneOf{model.SessionResult{}, searchingResponse{}}}},
+	{Method: "GET", Path: "/matchmaking/resume", Summary: "Resume a long-poll interrupted by a server restart",
+		Query: []string{"token"}, Responses: map[int]interface{}{200: model.SessionResult{}}},
+	{Method: "GET", Path: "/matchmaking/status", Summary: "Queue position, estimated wait, or a pending matched session",
+		Query: []string{"player_id"}, Responses: map[int]interface{}{200: queueStatusResponse{}}},
+	{Method: "GET", Path: "/matchmaking/result", Summary: "Most recent matched session of a reconnecting player",
+		Query: []string{"player_id"}, Responses: map[int]interface{}{200: model.SessionResult{}}},
+	{Method: "GET", Path: "/matchmaking/{player_id}/current", Summary: "Matched session the player has not acknowledged yet",
+		Responses: map[int]interface{}{200: model.SessionResult{}}},
+	{Method: "DELETE", Path: "/matchmaking/{player_id}/current", Summary: "Acknowledge a matched session so reconnects no longer return it",
+		Query: []string{"session_id"}, Responses: map[int]interface{}{204: nil}},
+	{Method: "GET", Path: "/modes", Summary: "Game modes with their open/closed status",
+		Responses: map[int]interface{}{200: queue.ModesResponse{}}},
+	{Method: "GET", Path: "/players/{id}", Summary: "Player profile",
+		Responses: map[int]interface{}{200: playerResponse{}}},
+	{Method: "GET", Path: "/players/{id}/head-to-head/{opponent_id}", Summary: "Win/loss record against another player",
+		Responses: map[int]interface{}{200: model.HeadToHead{}}},
+	{Method: "POST", Path: "/players/{id}/blocks", Summary: "Never match the player with another player",
+		Request: blockRequest{}, Responses: map[int]interface{}{200: playerBlock{}, 201: playerBlock{}}},
+	{Method: "DELETE", Path: "/players/{id}/blocks/{other_id}", Summary: "Remove a block",
+		Responses: map[int]interface{}{204: nil}},
+	{Method: "GET", Path: "/leaderboard", Summary: "Players by rating",
+		Query: []string{"limit", "offset"}, Responses: map[int]interface{}{200: []leaderboardEntry{}}},
+	{Method: "GET", Path: "/leaderboard/around/{player_id}", Summary: "Leaderboard page around a player",
+		Responses: map[int]interface{}{200: leaderboardAroundResponse{}}},
+	{Method: "GET", Path: "/sessions/{id}", Summary: "Session lookup",
+		Responses: map[int]interface{}{200: model.SessionResult{}}},
+	{Method: "GET", Path: "/sessions/verify", Summary: "Verify a match token and return the session (for game servers)",
+		Query: []string{"token"}, Responses: map[int]interface{}{200: model.SessionResult{}}},
+	{Method: "POST", Path: "/sessions/{id}/accept", Summary: "Accept a matched session and wait for the ready check to resolve",
+		Request: readyCheckRequest{}, Responses: map[int]interface{}{200: model.SessionResult{}}},
+	{Method: "POST", Path: "/sessions/{id}/decline", Summary: "Decline a matched session",
+		Request: readyCheckRequest{}, Responses: map[int]interface{}{200: model.SessionResult{}}},
+	{Method: "POST", Path: "/sessions/{id}/result", Summary: "Report the result of an active session and update ratings (admin)",
+		Request: sessionResultRequest{}, Responses: map[int]interface{}{200: model.SessionResult{}}},
+}
+
+// openAPIDocument は openAPIOperations から OpenAPI 3 の文書を生成します。生成は最初の1回だけ行います。
+var openAPIDocument = sync.OnceValue(func() []byte {
+	g := &openAPISchemas{schemas: make(map[string]interface{})}
+	errorSchema := g.schemaOf(reflect.TypeOf(ErrorResponse{}))
+	paths := make(map[string]map[string]interface{})
+	for _, op := range openAPIOperations {
+		responses := make(map[string]interface{})
+		for status, body := range op.Responses {
+			resp := map[string]interface{}{"description": http.StatusText(status)}
+			switch body := body.(type) {
+			case nil:
+			case openAPIOneOf:
+				var schemas []interface{}
+				for _, b := range body {
+					schemas = append(schemas, g.schemaOf(reflect.TypeOf(b)))
+				}
+				resp["content"] = jsonContent(map[string]interface{}{"oneOf": schemas})
+			default:
+				resp["content"] = jsonContent(g.schemaOf(reflect.TypeOf(body)))
+			}
+			responses[strconv.Itoa(status)] = resp
+		}
+		responses["default"] = map[string]interface{}{"description": "Error", "content": jsonContent(errorSchema)}
+
+		var params []interface{}
+		for _, m := range pathParamPattern.FindAllStringSubmatch(op.Path, -1) {
+			params = append(params, map[string]interface{}{"name": m[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}})
+		}
+		for _, name := range op.Query {
+			params = append(params, map[string]interface{}{"name": name, "in": "query", "schema": map[string]interface{}{"type": "string"}})
+		}
+		operation := map[string]interface{}{"summary": op.Summary, "responses": responses}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if op.Request != nil {
+			operation["requestBody"] = map[string]interface{}{"required": true, "content": jsonContent(g.schemaOf(reflect.TypeOf(op.Request)))}
+		}
+		if paths[op.Path] == nil {
+			paths[op.Path] = make(map[string]interface{})
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = operation
+	}
+
+	doc := map[string]interface{}{
+		"openapi":    "3.0.3",
+		"info":       map[string]interface{}{"title": "matchmaking", "version": "1"},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": g.schemas},
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return b
+})
+
+// pathParamPattern はパスの {name} 形式のパラメータです。
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// jsonContent は application/json のスキーマを OpenAPI の content の形式で返します。
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// openAPISchemas は Go の型から生成した名前付きスキーマ（components.schemas）です。
+type openAPISchemas struct {
+	schemas map[string]interface{}
+}
+
+// timeType は RFC 3339 の文字列として出力される time.Time の型です。
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf は t を encoding/json で出力した場合の JSON Schema を返します。名前付きの構造体は components.schemas に登録して参照を返します。
+// 文書にないフィールドの出力を検出できるよう、構造体には additionalProperties: false を指定します。
+func (g *openAPISchemas) schemaOf(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		schema := g.schemaOf(t.Elem())
+		if _, ref := schema["$ref"]; ref {
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			g.schemas[t.Name()] = nil // 再帰する型のための予約
+			g.schemas[t.Name()] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	panic("openapi: unsupported type " + t.String())
+}
+
+// structSchema は構造体の JSON Schema を返します。埋め込んだ構造体のフィールドは encoding/json と同じく展開します。
+func (g *openAPISchemas) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+				continue
+			}
+			name, _, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				collect(f.Type)
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = g.schemaOf(f.Type)
+		}
+	}
+	collect(t)
+	return map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+}
+
+// openAPIHandler は API の OpenAPI 3 の文書を返します。
+// BASE_PATH を設定している場合は、クライアントから見た URL（externalURL）を servers に記載します。
+func (s *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	doc := openAPIDocument()
+	if s.cfg.BasePath != "" {
+		doc = withOpenAPIServer(doc, s.externalURL(r))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(doc); err != nil {
+		s.logger.WarnContext(r.Context(), "OpenAPI 文書の送信エラー", "func", "openAPIHandler", "error", err)
+	}
+}
+
+// withOpenAPIServer は OpenAPI の文書の servers を url のみにした文書を返します。
+func withOpenAPIServer(doc []byte, url string) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		panic(err)
+	}
+	servers, err := json.Marshal([]map[string]string{{"url": url}})
+	if err != nil {
+		panic(err)
+	}
+	fields["servers"] = servers
+	b, err := json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/ratelimit"
+)
+
+// openAPISpec は GET /openapi.json で公開している文書です。
+type openAPISpec map[string]interface{}
+
+// fetchOpenAPISpec は GET /openapi.json の文書を返します。
+func fetchOpenAPISpec(t *testing.T, ts *testServer) openAPISpec {
+	t.Helper()
+	rec := ts.do(t, "GET", "/openapi.json", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json: status %d: %s", rec.Code, rec.Body)
+	}
+	var spec openAPISpec
+	decodeJSON(t, rec, &spec)
+	if spec["openapi"] != "3.0.3" {
+		t.Fatalf("openapi = %v, want 3.0.3", spec["openapi"])
+	}
+	return spec
+}
+
+// lookup は文書の keys の位置にある値を返します。
+func (spec openAPISpec) lookup(keys ...string) (map[string]interface{}, bool) {
+	node := map[string]interface{}(spec)
+	for _, k := range keys {
+		next, ok := node[k].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		node = next
+	}
+	return node, true
+}
+
+// responseSchema は method と path の操作の status のレスポンスのスキーマを返します。文書にないステータスコードは default（エラー）のスキーマです。
+func (spec openAPISpec) responseSchema(t *testing.T, method, path string, status int) map[string]interface{} {
+	t.Helper()
+	responses, ok := spec.lookup("paths", path, strings.ToLower(method), "responses")
+	if !ok {
+		t.Fatalf("%s %s is not documented", method, path)
+	}
+	code := strconv.Itoa(status)
+	if _, ok := responses[code]; !ok {
+		code = "default"
+	}
+	schema, ok := spec.lookup("paths", path, strings.ToLower(method), "responses", code, "content", "application/json", "schema")
+	if !ok {
+		t.Fatalf("%s %s %s has no JSON body", method, path, code)
+	}
+	return schema
+}
+
+// validate は JSON を decode した値 v が schema に従っているかを確認し、従っていなければ最初の違反を返します。
+// 文書が使う範囲（$ref・oneOf・allOf・nullable・type・properties・additionalProperties・items・date-time）だけを扱います。
+func (spec openAPISpec) validate(schema map[string]interface{}, v interface{}, at string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, ok := spec.lookup(strings.Split(strings.TrimPrefix(ref, "#/"), "/")...)
+		if !ok {
+			return fmt.Errorf("%s: unresolved %s", at, ref)
+		}
+		return spec.validate(resolved, v, at)
+	}
+	if v == nil && len(schema) > 0 {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return fmt.Errorf("%s: null is not nullable", at)
+	}
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, s := range all {
+			if err := spec.validate(s.(map[string]interface{}), v, at); err != nil {
+				return err
+			}
+		}
+	}
+	if one, ok := schema["oneOf"].([]interface{}); ok {
+		var errs []string
+		for _, s := range one {
+			if err := spec.validate(s.(map[string]interface{}), v, at); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		if len(errs) != len(one)-1 {
+			return fmt.Errorf("%s: matches %d of the oneOf schemas, want exactly 1: %s", at, len(one)-len(errs), strings.Join(errs, "; "))
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: %T is not an object", at, v)
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, value := range obj {
+			if prop, ok := properties[name].(map[string]interface{}); ok {
+				if err := spec.validate(prop, value, at+"."+name); err != nil {
+					return err
+				}
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					return fmt.Errorf("%s: undocumented property %q", at, name)
+				}
+			case map[string]interface{}:
+				if err := spec.validate(extra, value, at+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: %T is not an array", at, v)
+		}
+		for i, item := range items {
+			if err := spec.validate(schema["items"].(map[string]interface{}), item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: %T is not a string", at, v)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", at, s)
+			}
+		}
+	case "integer":
+		if n, ok := v.(float64); !ok || n != math.Trunc(n) {
+			return fmt.Errorf("%s: %v is not an integer", at, v)
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s: %T is not a number", at, v)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: %T is not a boolean", at, v)
+		}
+	}
+	return nil
+}
+
+// checkResponse はレスポンス rec のボディが、文書の method と path の操作のスキーマに従っていることを確認します。
+func (spec openAPISpec) checkResponse(t *testing.T, method, path string, rec *httptest.ResponseRecorder) {
+	t.Helper()
+	var body interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s %s: body %q is not JSON: %v", method, path, rec.Body, err)
+	}
+	if err := spec.validate(spec.responseSchema(t, method, path, rec.Code), body, "body"); err != nil {
+		t.Errorf("%s %s %d does not match the published schema: %v\n%s", method, path, rec.Code, err, rec.Body)
+	}
+}
+
+// ハンドラが実際に返す JSON（成功・エラーとも）が、GET /openapi.json で公開しているスキーマに従う
+func TestOpenAPIMatchesHandlers(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.PlayerRateLimit = ratelimit.Config{} })
+	spec := fetchOpenAPISpec(t, ts)
+
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob", "ping_ms": 40})
+	ts.waitQueued(t, 2)
+	ts.startEnqueue(t, map[string]interface{}{"id": "carol", "game_mode": "2v2"})
+	ts.waitQueued(t, 3)
+	ts.tick(t)
+	var sessionID string
+	for _, done := range []<-chan *httptest.ResponseRecorder{alice, bob} {
+		rec := receive(t, done)
+		spec.checkResponse(t, "POST", "/matchmaking", rec)
+		var session struct {
+			SessionID string `json:"session_id"`
+		}
+		decodeJSON(t, rec, &session)
+		sessionID = session.SessionID
+	}
+
+	for _, tc := range []struct {
+		method, path, doc string
+		body              interface{}
+		status            int
+	}{
+		{"GET", "/matchmaking/status?player_id=carol", "/matchmaking/status", nil, http.StatusOK},
+		{"GET", "/matchmaking/status?player_id=zed", "/matchmaking/status", nil, http.StatusNotFound},
+		{"GET", "/matchmaking/result?player_id=alice", "/matchmaking/result", nil, http.StatusOK},
+		{"GET", "/matchmaking/alice/current", "/matchmaking/{player_id}/current", nil, http.StatusOK},
+		{"GET", "/modes", "/modes", nil, http.StatusOK},
+		{"GET", "/players/alice", "/players/{id}", nil, http.StatusOK},
+		{"GET", "/players/zed", "/players/{id}", nil, http.StatusNotFound},
+		{"GET", "/players/alice/head-to-head/bob", "/players/{id}/head-to-head/{opponent_id}", nil, http.StatusOK},
+		{"POST", "/players/alice/blocks", "/players/{id}/blocks", map[string]string{"player_id": "dave"}, http.StatusCreated},
+		{"GET", "/leaderboard", "/leaderboard", nil, http.StatusOK},
+		{"GET", "/leaderboard?limit=0", "/leaderboard", nil, http.StatusBadRequest},
+		{"GET", "/leaderboard/around/alice", "/leaderboard/around/{player_id}", nil, http.StatusOK},
+		{"GET", "/sessions/" + sessionID, "/sessions/{id}", nil, http.StatusOK},
+		{"GET", "/sessions/not-a-session", "/sessions/{id}", nil, http.StatusBadRequest},
+		{"GET", "/matchmaking/resume?token=bad", "/matchmaking/resume", nil, http.StatusGone},
+	} {
+		rec := ts.do(t, tc.method, tc.path, tc.body, nil)
+		if rec.Code != tc.status {
+			t.Errorf("%s %s: status %d, want %d: %s", tc.method, tc.path, rec.Code, tc.status, rec.Body)
+			continue
+		}
+		spec.checkResponse(t, tc.method, tc.doc, rec)
+	}
+
+	// 結果の報告は管理用エンドポイント
+	path := "/sessions/" + sessionID + "/result"
+	if rec := serve(t, ts.AdminHandler(), "POST", path, map[string]int{"winning_team": 1}, adminHeader()); rec.Code != http.StatusConflict {
+		t.Fatalf("result of a pending session: status %d, want 409: %s", rec.Code, rec.Body)
+	} else {
+		spec.checkResponse(t, "POST", "/sessions/{id}/result", rec)
+	}
+	session := ts.activeSession(t, "erin", "frank")
+	rec := serve(t, ts.AdminHandler(), "POST", "/sessions/"+session.SessionID+"/result", map[string]int{"winning_team": 1}, adminHeader())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("result: status %d: %s", rec.Code, rec.Body)
+	}
+	spec.checkResponse(t, "POST", "/sessions/{id}/result", rec)
+}
+
+// 文書にないフィールドや型の違いを検出できる
+func TestOpenAPIValidationDetectsDrift(t *testing.T) {
+	ts := newTestServer(t, nil)
+	spec := fetchOpenAPISpec(t, ts)
+	schema := spec.responseSchema(t, "GET", "/players/{id}", http.StatusOK)
+	for name, body := range map[string]string{
+		"undocumented field": `{"player_id": "alice", "rating": 1500, "nickname": "al"}`,
+		"wrong type":         `{"player_id": "alice", "rating": "high"}`,
+		"bad date-time":      `{"player_id": "alice", "created_at": "yesterday"}`,
+	} {
+		var v interface{}
+		if err := json.Unmarshal([]byte(body), &v); err != nil {
+			t.Fatal(err)
+		}
+		if err := spec.validate(schema, v, "body"); err == nil {
+			t.Errorf("%s: %s validated", name, body)
+		}
+	}
+
+	// 全ての操作がエラーのレスポンス（ErrorResponse）を記載している
+	paths, _ := spec.lookup("paths")
+	for path := range paths {
+		methods, _ := spec.lookup("paths", path)
+		for method := range methods {
+			if _, ok := spec.lookup("paths", path, method, "responses", "default", "content", "application/json", "schema"); !ok {
+				t.Errorf("%s %s has no error response", strings.ToUpper(method), path)
+			}
+		}
+	}
+	if _, ok := spec.lookup("components", "schemas", "ErrorResponse"); !ok {
+		t.Fatal("ErrorResponse schema is missing")
+	}
+	for _, path := range []string{"/matchmaking", "/matchmaking/status", "/sessions/{id}", "/sessions/{id}/result"} {
+		if _, ok := paths[path]; !ok {
+			t.Errorf("%s is not documented", path)
+		}
+	}
+}
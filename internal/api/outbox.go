@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+)
+
+// notificationRetryDelay は、マッチング処理が通知中の結果を再通知しないよう、作成からこの時間が過ぎた未通知の結果のみを通知し直すための猶予です。
+const notificationRetryDelay = 5 * time.Second
+
+// notificationSweepInterval は未通知のマッチング結果を確認する間隔です。
+const notificationSweepInterval = 5 * time.Second
+
+// NotificationOutbox は別ゴルーチンで動作し、起動時と定期的に redeliverNotifications を実行します。
+// セッションの保存後・通知前にプロセスが停止した場合の通知漏れを補います。
+func (s *Server) NotificationOutbox(ctx context.Context) {
+	ticker := time.NewTicker(notificationSweepInterval)
+	defer ticker.Stop()
+	for {
+		s.redeliverNotifications(ctx, s.now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// redeliverNotifications は now の時点で未通知のマッチング結果を通知し直します。
+// クライアントの最長の待機時間（LongestMatchmakingTimeout）を過ぎたものは、待っているクライアントがいないためセッションを中止します。
+func (s *Server) redeliverNotifications(ctx context.Context, now time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.TickTimeout)
+	defer cancel()
+
+	pending, err := s.Store.UndeliveredNotifications(ctx, now.Add(-notificationRetryDelay))
+	if err != nil {
+		s.logger.Warn("未通知のマッチング結果取得エラー", "func", "redeliverNotifications", "error", err)
+		return
+	}
+	wait := s.cfg.Queue.LongestTimeout()
+	for _, n := range pending {
+		if now.Sub(n.CreatedAt) >= wait {
+			if err := s.Store.AbortUndeliveredSession(ctx, n.SessionID); err != nil {
+				s.logger.Warn("未通知のセッション中止エラー", "func", "redeliverNotifications", "session_id", n.SessionID, "error", err)
+				continue
+			}
+			metrics.NotificationRedeliveries.WithLabelValues("aborted").Inc()
+			s.logger.Warn("match notification was never delivered; session aborted", "session_id", n.SessionID, "created_at", n.CreatedAt)
+			continue
+		}
+
+		session, err := s.Store.GetSession(ctx, n.SessionID)
+		if errors.Is(err, model.ErrSessionNotFound) {
+			// セルフテストの後片付けなどで削除されたセッション
+			s.markNotificationsDelivered(ctx, []string{n.SessionID})
+			continue
+		}
+		if err != nil {
+			s.logger.Warn("未通知のセッション取得エラー", "func", "redeliverNotifications", "session_id", n.SessionID, "error", err)
+			continue
+		}
+		if session.Status != model.SessionPendingAccept && session.Status != model.SessionActive {
+			// 承諾期限切れなどで既に終了している
+			s.markNotificationsDelivered(ctx, []string{n.SessionID})
+			continue
+		}
+		if !s.anyParticipantWaiting(ctx, session) {
+			// 結果を待っているクライアントがいない。通知済みにせず、GET /matchmaking/status などでの受け取りを待つ
+			continue
+		}
+		if s.publishSession(session) {
+			metrics.NotificationRedeliveries.WithLabelValues("delivered").Inc()
+			s.logger.Info("match notification redelivered", "session_id", n.SessionID, "created_at", n.CreatedAt)
+			s.markNotificationsDelivered(ctx, []string{n.SessionID})
+		}
+	}
+}
+
+// anyParticipantWaiting はセッションの参加者（ボットを除く）のいずれかが、このインスタンスまたは他のインスタンスで結果を待っているかどうかを返します。
+// 確認できなかった場合は、通知を止めないよう待っているものとみなします。
+func (s *Server) anyParticipantWaiting(ctx context.Context, session model.SessionResult) bool {
+	for _, p := range session.Participants {
+		if p.IsBot {
+			continue
+		}
+		ok, err := s.notifier.Subscribed(ctx, store.ParticipantEntryKey(p))
+		if err != nil || ok {
+			return true
+		}
+	}
+	return false
+}
+
+// claimPendingSession は、待機キューにいないプレイヤーが結果を確認した際に、成立済みで未終了のセッションがあれば返して通知済みにします。
+// 通知を受け取る前に接続が切れた、または通知したインスタンスが停止したクライアントに、次の確認で結果を届けるためのものです。
+func (s *Server) claimPendingSession(ctx context.Context, playerID string) (model.SessionResult, error) {
+	session, err := s.findMatchedSession(ctx, playerID, s.now())
+	if err != nil {
+		return model.SessionResult{}, err
+	}
+	s.markNotificationsDelivered(ctx, []string{session.SessionID})
+	return session, nil
+}
+
+// publishSession はセッションの参加者（ボットを除く）が待機していたエントリへマッチング結果を通知し、全て通知できたかどうかを返します。
+func (s *Server) publishSession(session model.SessionResult) bool {
+	return s.publishSessions([]model.SessionResult{session})[0]
+}
+
+// notification は1件のエントリ宛てのマッチング結果の通知です（sessions の添字と宛先のキー）。
+type notification struct {
+	Session int
+	Key     string
+}
+
+// publishSessions は複数のセッションの結果を、参加者のエントリ（ボットを除く）ごとに最大 NotifyConcurrency 件ずつ並行して通知します。
+// 1回のマッチングで多数のセッションが成立しても、Redis への送信などを1件ずつ待たないためです。
+// 戻り値の i 番目は sessions[i] の全員へ通知できたかどうかです。
+func (s *Server) publishSessions(sessions []model.SessionResult) []bool {
+	var pending []notification
+	for i, session := range sessions {
+		published := make(map[string]bool)
+		for _, p := range session.Participants {
+			key := store.ParticipantEntryKey(p)
+			if p.IsBot || published[key] {
+				continue
+			}
+			published[key] = true
+			pending = append(pending, notification{Session: i, Key: key})
+		}
+	}
+
+	ok := make([]bool, len(sessions))
+	for i := range ok {
+		ok[i] = true
+	}
+	var mu sync.Mutex
+	queue := make(chan notification)
+	var wg sync.WaitGroup
+	for range min(s.cfg.NotifyConcurrency, len(pending)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range queue {
+				session := sessions[n.Session]
+				if err := s.notifier.Publish(n.Key, session); err != nil {
+					s.logger.Error("マッチング結果通知エラー", "func", "publishSessions", "session_id", session.SessionID, "entry", n.Key, "error", err)
+					mu.Lock()
+					ok[n.Session] = false
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, n := range pending {
+		queue <- n
+	}
+	close(queue)
+	wg.Wait()
+	return ok
+}
+
+// markNotificationsDelivered はマッチング結果を通知済みにします。失敗した場合は次回に再通知されます。
+func (s *Server) markNotificationsDelivered(ctx context.Context, sessionIDs []string) {
+	if err := s.Store.MarkNotificationsDelivered(context.WithoutCancel(ctx), sessionIDs); err != nil {
+		s.logger.Warn("通知済みの記録エラー", "func", "markNotificationsDelivered", "sessions", len(sessionIDs), "error", err)
+	}
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// slowNotifier は Publish に delay かかる Notifier で、同時に実行中の Publish の最大数を記録します。
+type slowNotifier struct {
+	Notifier
+	delay        time.Duration
+	active, peak atomic.Int32
+}
+
+func (n *slowNotifier) Publish(key string, session model.SessionResult) error {
+	active := n.active.Add(1)
+	defer n.active.Add(-1)
+	for {
+		peak := n.peak.Load()
+		if active <= peak || n.peak.CompareAndSwap(peak, active) {
+			break
+		}
+	}
+	time.Sleep(n.delay)
+	return n.Notifier.Publish(key, session)
+}
+
+// duelSessions は "p0" から始まるプレイヤーを2人ずつ組んだ n 件のセッションを返します。
+func duelSessions(n int) []model.SessionResult {
+	sessions := make([]model.SessionResult, n)
+	for i := range sessions {
+		sessions[i] = model.SessionResult{SessionID: fmt.Sprintf("s%d", i), Participants: []model.Participant{
+			{Player: model.Player{ID: fmt.Sprintf("p%d", 2*i)}, Team: 1},
+			{Player: model.Player{ID: fmt.Sprintf("p%d", 2*i+1)}, Team: 2},
+			{Player: model.Player{ID: "bot", IsBot: true}, Team: 2},
+		}}
+	}
+	return sessions
+}
+
+// 通知は NotifyConcurrency 件までの並行で送り、ボットには送らない
+func TestPublishSessionsBoundedConcurrency(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.NotifyConcurrency = 4 })
+	notifier := &slowNotifier{Notifier: ts.notifier, delay: 5 * time.Millisecond}
+	ts.notifier = notifier
+	sessions := duelSessions(20)
+	chans := make(map[string]<-chan model.SessionResult)
+	for _, s := range sessions {
+		for _, id := range s.HumanPlayerIDs() {
+			ch, err := notifier.Subscribe(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chans[id] = ch
+		}
+	}
+
+	for i, ok := range ts.publishSessions(sessions) {
+		if !ok {
+			t.Errorf("session %d was not delivered", i)
+		}
+	}
+	if peak := notifier.peak.Load(); peak < 2 || peak > 4 {
+		t.Errorf("peak concurrent deliveries = %d, want between 2 and the limit 4", peak)
+	}
+	for id, ch := range chans {
+		select {
+		case got := <-ch:
+			if !slices.Contains(got.HumanPlayerIDs(), id) {
+				t.Errorf("%s received %s, want their own session", id, got.SessionID)
+			}
+		default:
+			t.Errorf("%s received nothing", id)
+		}
+	}
+	if n := notifier.Len(); n != 0 {
+		t.Errorf("%d subscriptions left, want all removed on delivery", n)
+	}
+}
+
+// 読み手が前の通知を受け取っていない購読への送信はブロックせずに失敗とし、待っていないエントリへの通知は成功とする
+func TestPublishSessionsNonBlocking(t *testing.T) {
+	ts := newTestServer(t, nil)
+	sessions := duelSessions(2)
+	notifier := ts.notifier.(*memoryNotifier)
+	if _, err := notifier.Subscribe("p0"); err != nil {
+		t.Fatal(err)
+	}
+	stale := notifier.chans["p0"]
+	if err := notifier.Publish("p0", model.SessionResult{SessionID: "earlier"}); err != nil {
+		t.Fatal(err)
+	}
+	// p0 の読み手は earlier を受け取らないまま、同じチャネルでもう一度待機を始めた
+	notifier.chans["p0"] = stale
+
+	done := make(chan []bool, 1)
+	go func() { done <- ts.publishSessions(sessions) }()
+	select {
+	case ok := <-done:
+		if ok[0] || !ok[1] {
+			t.Fatalf("delivered = %v, want only the session without the stuck reader", ok)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("publishSessions blocked on a reader that never receives")
+	}
+	// 届けられなかった購読は登録したまま残す
+	if ok, _ := notifier.Subscribed(context.Background(), "p0"); !ok {
+		t.Fatal("p0 was unsubscribed although the notification was not delivered")
+	}
+	if err := ts.notifier.Publish("nobody", sessions[0]); err != nil {
+		t.Fatalf("publish without a subscriber = %v, want nil", err)
+	}
+}
+
+// 受け取らない読み手がいても他のプレイヤーのマッチングと通知は進み、読み手の登録は残るため、受け取れるようになった後に再通知で届く
+func TestStalledReceiverDoesNotBlockMatching(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) { c.PlayerRateLimit = ratelimit.Config{} })
+	ctx := context.Background()
+	notifier := ts.notifier.(*memoryNotifier)
+	// carol の読み手は前の通知を受け取らないまま止まっている
+	stalled, err := notifier.Subscribe("carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier.chans["carol"] <- model.SessionResult{SessionID: "earlier"}
+	carol := model.QueueEntry{Players: []model.Player{{ID: "carol", Rating: 1500}}, Rating: 1500, GameMode: "duel", WaitingSince: ts.now().Add(-time.Minute)}
+	if _, err := ts.store.EnqueueEntry(ctx, carol); err != nil {
+		t.Fatal(err)
+	}
+	waiting := make(map[string]<-chan *httptest.ResponseRecorder)
+	for i, id := range []string{"alice", "bob", "dave"} {
+		waiting[id] = ts.startEnqueue(t, map[string]interface{}{"id": id})
+		ts.waitQueued(t, i+2)
+	}
+
+	done := make(chan queue.MatchCycle, 1)
+	go func() {
+		cycle, err := ts.runMatchmaking(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- cycle
+	}()
+	select {
+	case cycle := <-done:
+		if cycle.Matched != 2 {
+			t.Fatalf("tick created %d sessions, want 2", cycle.Matched)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("matching blocked on a receiver that never receives")
+	}
+	var carolSession string
+	for id, ch := range waiting {
+		var session model.SessionResult
+		decodeJSON(t, receive(t, ch), &session)
+		if session.SessionID == "" {
+			t.Fatalf("%s was not matched", id)
+		}
+		for _, p := range session.Participants {
+			if p.ID == "carol" {
+				carolSession = session.SessionID
+			}
+		}
+	}
+	if ok, _ := notifier.Subscribed(ctx, "carol"); !ok {
+		t.Fatal("carol was unsubscribed although her notification was not delivered")
+	}
+
+	// carol の読み手が前の通知を受け取った後は、再通知でセッションが届く
+	if got := <-stalled; got.SessionID != "earlier" {
+		t.Fatalf("carol's pending notification = %q, want earlier", got.SessionID)
+	}
+	ts.redeliverNotifications(ctx, ts.now().Add(notificationRetryDelay+time.Second))
+	select {
+	case got := <-stalled:
+		if got.SessionID != carolSession {
+			t.Fatalf("carol received %q, want %q", got.SessionID, carolSession)
+		}
+	default:
+		t.Fatal("carol's session was not redelivered")
+	}
+}
+
+// 通知の送信中に同じキーの購読・解除が並行しても、各購読が受け取る通知は高々1件で、登録が壊れない（go test -race で確認）
+func TestMemoryNotifierSnapshotRace(t *testing.T) {
+	n := NewMemoryNotifier()
+	const keys, rounds = 50, 200
+	var wg sync.WaitGroup
+	var received atomic.Int32
+	for k := range keys {
+		key := fmt.Sprintf("p%d", k)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				ch, err := n.Subscribe(key)
+				if err != nil {
+					continue
+				}
+				select {
+				case <-ch:
+					received.Add(1)
+				default:
+				}
+				select {
+				case <-ch:
+					t.Errorf("%s received a second notification on one subscription", key)
+				default:
+				}
+				n.Unsubscribe(key, ch)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				n.Publish(key, model.SessionResult{SessionID: key})
+				n.Subscribed(t.Context(), key)
+				n.Len()
+			}
+		}()
+	}
+	wg.Wait()
+	if got := n.Len(); got != 0 {
+		t.Fatalf("%d subscriptions left after every reader unsubscribed", got)
+	}
+	t.Logf("%d notifications received", received.Load())
+}
+
+// BenchmarkSubscribeWhileNotifying は 1,000 件の通知を並行して送っている間の、待機の開始（Notifier.Subscribe と Unsubscribe）の所要時間を測ります。
+// 通知の送信は購読を取り出した後ロックの外で行うため、待機の開始は送信の完了を待ちません。
+func BenchmarkSubscribeWhileNotifying(b *testing.B) {
+	ts := newTestServer(b, nil)
+	notifier := &slowNotifier{Notifier: ts.notifier, delay: time.Millisecond}
+	ts.notifier = notifier
+	sessions := duelSessions(500)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for _, s := range sessions {
+				for _, id := range s.HumanPlayerIDs() {
+					notifier.Subscribe(id)
+				}
+			}
+			ts.publishSessions(sessions)
+		}
+	}()
+
+	for i := 0; b.Loop(); i++ {
+		key := fmt.Sprintf("joining-%d", i)
+		ch, err := notifier.Subscribe(key)
+		if err != nil {
+			b.Fatal(err)
+		}
+		notifier.Unsubscribe(key, ch)
+	}
+	close(stop)
+	wg.Wait()
+}
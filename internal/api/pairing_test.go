@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// 別の地域のプレイヤーとは、待機時間が CrossRegionFallback を超えるまでマッチングしない
+func TestCrossRegionFallbackAfterWaiting(t *testing.T) {
+	ts := newTestServer(t, nil)
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice", "region": "asia", "timeout_seconds": 60})
+	ts.waitQueued(t, 1)
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob", "region": "eu", "timeout_seconds": 60})
+	ts.waitQueued(t, 2)
+
+	if cycle := ts.tick(t); cycle.Matched != 0 {
+		t.Fatalf("tick before the fallback created %d sessions, want 0", cycle.Matched)
+	}
+	ts.clock.Advance(ts.cfg.Queue.CrossRegionFallback - time.Second)
+	if cycle := ts.tick(t); cycle.Matched != 0 {
+		t.Fatalf("tick just before the fallback created %d sessions, want 0", cycle.Matched)
+	}
+	ts.clock.Advance(time.Second)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick at the fallback created %d sessions, want 1", cycle.Matched)
+	}
+
+	for _, done := range []<-chan *httptest.ResponseRecorder{alice, bob} {
+		rec := receive(t, done)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var session model.SessionResult
+		decodeJSON(t, rec, &session)
+		// セッションは長く待っている方の地域で実行する（同時に登録した場合は先に登録した alice）
+		if session.Region != "asia" {
+			t.Errorf("session region = %q, want asia", session.Region)
+		}
+	}
+}
+
+// 同じ地域のプレイヤーどうしは待機時間に関係なくすぐにマッチングする
+func TestSameRegionMatchesImmediately(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) { c.PlayerRateLimit = ratelimit.Config{} })
+	session := ts.matchPair(t, "alice", "bob")
+	if session.Region != "" {
+		t.Fatalf("session region = %q, want global for players without a region", session.Region)
+	}
+
+	carol := ts.startEnqueue(t, map[string]interface{}{"id": "carol", "region": "eu"})
+	ts.waitQueued(t, 1)
+	dave := ts.startEnqueue(t, map[string]interface{}{"id": "dave", "region": "eu"})
+	ts.waitQueued(t, 2)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+	receive(t, carol)
+	receive(t, dave)
+}
+
+// waitingEntry は now の wait 前から duel で待機している、レーティング 1500 のソロのエントリです。
+func waitingEntry(now time.Time, id, region string, wait time.Duration) model.QueueEntry {
+	return model.QueueEntry{Players: []model.Player{{ID: id, Rating: 1500}}, Rating: 1500, Region: region, GameMode: "duel", WaitingSince: now.Add(-wait)}
+}
+
+// 直前に対戦した2人だけが待機している場合は、RematchFallback を過ぎるまで再戦させない
+func TestRecentOpponentsWaitForFallback(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) { c.PlayerRateLimit = ratelimit.Config{} })
+	played := ts.activeSession(t, "alice", "bob")
+	if _, err := ts.reportResult(context.Background(), played.SessionID, model.OutcomeWin, played.Participants[0].Team); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice", "timeout_seconds": 60})
+	ts.waitQueued(t, 1)
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob", "timeout_seconds": 60})
+	ts.waitQueued(t, 2)
+	if cycle := ts.tick(t); cycle.Matched != 0 {
+		t.Fatalf("tick right after the previous match created %d sessions, want 0", cycle.Matched)
+	}
+	ts.clock.Advance(ts.cfg.Queue.RematchFallback)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick after the rematch fallback created %d sessions, want 1", cycle.Matched)
+	}
+	receive(t, alice)
+	receive(t, bob)
+}
+
+// ratedEntry は waitingEntry のレーティングを rating にし、プレイヤーの待機開始時刻もエントリに合わせたエントリを返します。
+func ratedEntry(now time.Time, id string, rating int, wait time.Duration) model.QueueEntry {
+	e := waitingEntry(now, id, "asia", wait)
+	e.Rating, e.Players[0].Rating = rating, rating
+	e.Players[0].WaitingSince = e.WaitingSince
+	return e
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// 1,000 人が同時に待機を始めても、1回の確認で全員をマッチングして結果を届ける
+func TestMatchmakingLoad(t *testing.T) {
+	const players = 1000
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.PlayerRateLimit = ratelimit.Config{}
+		cfg.IPRateLimit = ratelimit.Config{}
+	})
+	done := make([]<-chan *httptest.ResponseRecorder, players)
+	for i := range done {
+		done[i] = ts.startEnqueue(t, map[string]interface{}{"id": fmt.Sprintf("p%04d", i)})
+	}
+	ts.waitQueued(t, players)
+
+	start := time.Now()
+	if cycle := ts.tick(t); cycle.Matched != players/2 {
+		t.Fatalf("tick created %d sessions, want %d", cycle.Matched, players/2)
+	}
+	t.Logf("matched %d players in %v", players, time.Since(start))
+	sessions := make(map[string]int)
+	for _, ch := range done {
+		rec := receive(t, ch)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var session model.SessionResult
+		decodeJSON(t, rec, &session)
+		sessions[session.SessionID]++
+	}
+	for id, n := range sessions {
+		if n != 2 {
+			t.Fatalf("session %s delivered to %d players, want 2", id, n)
+		}
+	}
+	if ids := ts.queuedIDs(t); len(ids) != 0 {
+		t.Fatalf("%d players left in the queue, want none", len(ids))
+	}
+}
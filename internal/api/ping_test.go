@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// ping の合計が上限を超える2人は、待機時間が PingFallback を超えてからマッチングする
+func TestHighPingPlayersMatchAfterFallback(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		modes := queue.DefaultModes()
+		duel := modes["duel"]
+		duel.MaxPingMS = 200
+		modes["duel"] = duel
+		cfg.Queue.GameModes = modes
+		cfg.Queue.PingFallback = 3 * time.Second
+		cfg.PlayerRateLimit = ratelimit.Config{}
+	})
+	for _, ping := range []int{-1, 10001} {
+		rec := ts.do(t, "POST", "/matchmaking", map[string]interface{}{"id": "alice", "ping_ms": ping}, nil)
+		if code := errorShape(t, rec, http.StatusBadRequest); code != errCodeInvalidRequest {
+			t.Fatalf("ping_ms %d: code = %q, want %q", ping, code, errCodeInvalidRequest)
+		}
+	}
+
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice", "ping_ms": 150, "timeout_seconds": 60})
+	ts.waitQueued(t, 1)
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob", "ping_ms": 150, "timeout_seconds": 60})
+	ts.waitQueued(t, 2)
+	if cycle := ts.tick(t); cycle.Matched != 0 {
+		t.Fatalf("tick matched %d sessions with a combined ping of 300, want none", cycle.Matched)
+	}
+
+	ts.clock.Advance(3 * time.Second)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick after the fallback matched %d sessions, want 1", cycle.Matched)
+	}
+	for _, done := range []<-chan *httptest.ResponseRecorder{alice, bob} {
+		rec := receive(t, done)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var session model.SessionResult
+		decodeJSON(t, rec, &session)
+		pings := []int{session.Participants[0].PingMS, session.Participants[1].PingMS}
+		if !slices.Equal(pings, []int{150, 150}) {
+			t.Fatalf("participant pings = %v, want the stored 150ms", pings)
+		}
+	}
+}
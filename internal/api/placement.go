@@ -0,0 +1,10 @@
+package api
+
+// clientRating はリクエストで申告されたレーティングのうち、待機キューへの登録時に使う値を返します。
+// TrustClientRating が無効の場合、または申告がない（0）場合は 0 を返し、保存済みのレーティングを使わせます。
+func (s *Server) clientRating(rating int) int {
+	if !s.cfg.TrustClientRating {
+		return 0
+	}
+	return rating
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// プレイヤー情報は残りの配置戦の数を返す
+func TestPlayerPlacementMatchesRemaining(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.activeSession(t, "alice", "bob")
+	rec := ts.do(t, "GET", "/players/alice", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp playerResponse
+	decodeJSON(t, rec, &resp)
+	if resp.GamesPlayed != 1 || resp.PlacementMatchesRemaining != ts.cfg.Queue.PlacementMatches-1 {
+		t.Fatalf("games played %d, placement matches remaining %d, want 1 and %d", resp.GamesPlayed, resp.PlacementMatchesRemaining, ts.cfg.Queue.PlacementMatches-1)
+	}
+}
+
+// 配置戦中の対戦結果は、配置戦を終えた後より大きくレーティングを動かす
+func TestPlacementRatingMovement(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		placements int
+		// want は同じレーティングの2人が対戦し、勝った側のレーティングの変化量です
+		want int
+	}{
+		{"in placement", 5, 32},
+		{"after placement", 0, 16},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t, func(cfg *Config) { cfg.Queue.PlacementMatches = tc.placements })
+			session := ts.activeSession(t, "alice", "bob")
+			winner := session.Participants[0]
+			rec := serve(t, ts.AdminHandler(), "POST", "/sessions/"+session.SessionID+"/result", map[string]int{"winning_team": winner.Team}, adminHeader())
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			var got model.SessionResult
+			decodeJSON(t, rec, &got)
+			for _, p := range got.Participants {
+				want := -tc.want
+				if p.Team == winner.Team {
+					want = tc.want
+				}
+				if change := p.Rating - ratingOf(session, p.ID); change != want {
+					t.Errorf("%s rating change = %d, want %d", p.ID, change, want)
+				}
+			}
+		})
+	}
+}
+
+// 初めて参加するプレイヤーの初期レーティングは申告した腕前で決め、登録済みのプレイヤーのレーティングは変えない
+func TestSelfReportedSkillSeedsRating(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.PlayerRateLimit = ratelimit.Config{} })
+	ts.seedRatings(t, map[string]int{"carol": 1500})
+
+	rec := ts.do(t, "POST", "/matchmaking", map[string]interface{}{"id": "zed", "self_reported_skill": "pro"}, nil)
+	if code := errorShape(t, rec, http.StatusBadRequest); code != errCodeInvalidRequest {
+		t.Fatalf("unknown skill: code = %q, want %q", code, errCodeInvalidRequest)
+	}
+
+	for i, body := range []map[string]interface{}{
+		{"id": "alice", "self_reported_skill": "advanced"},
+		{"id": "bob"},
+		{"id": "carol", "self_reported_skill": "beginner"},
+	} {
+		ts.startEnqueue(t, body)
+		ts.waitQueued(t, i+1)
+	}
+	for id, want := range map[string]int{"alice": 1400, "bob": ts.cfg.RatingSeeds.Default, "carol": 1500} {
+		profile, err := ts.store.GetPlayerProfile(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profile.Rating != want {
+			t.Errorf("%s rating = %d, want %d", id, profile.Rating, want)
+		}
+	}
+}
+
+// TRUST_CLIENT_RATING が無効の場合はリクエストの rating を無視して保存済み（未登録なら DEFAULT_RATING）のレーティングを使い、
+// 有効の場合は申告されたレーティングで上書きする
+func TestTrustClientRating(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		trust       bool
+		alice, zoe  int
+		partyMember int
+	}{
+		{"untrusted", false, 1500, 1350, 1350},
+		{"trusted", true, 2400, 2100, 1900},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t, func(cfg *Config) {
+				cfg.TrustClientRating = tc.trust
+				cfg.RatingSeeds.Default = 1350
+				cfg.PlayerRateLimit = ratelimit.Config{}
+			})
+			ts.seedRatings(t, map[string]int{"alice": 1500})
+			for i, body := range []map[string]interface{}{
+				{"id": "alice", "rating": 2400},
+				{"id": "zoe", "rating": 2100},
+				{"party_id": "p1", "game_mode": "2v2", "players": []map[string]interface{}{{"id": "yuki", "rating": 1900}, {"id": "xavier", "rating": 1900}}},
+			} {
+				ts.startEnqueue(t, body)
+				ts.waitQueued(t, []int{1, 2, 4}[i])
+			}
+			for id, want := range map[string]int{"alice": tc.alice, "zoe": tc.zoe, "yuki": tc.partyMember} {
+				profile, err := ts.store.GetPlayerProfile(context.Background(), id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if profile.Rating != want {
+					t.Errorf("%s rating = %d, want %d", id, profile.Rating, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/secret"
+)
+
+// adminTokenScope は管理用エンドポイントを呼び出せるトークンの scope です。
+const adminTokenScope = "admin"
+
+// errPlayerMismatch は、リクエストで指定したプレイヤー ID がトークンのプレイヤーと異なる場合のエラーです。
+var errPlayerMismatch = errors.New("player id does not match the authenticated player")
+
+// playerKey は本人確認したプレイヤー ID を context に格納するためのキーです。
+type playerKey struct{}
+
+// tokenClaims はトークンのうち、このサービスが使うクレームです。
+type tokenClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+	// Scope は空白区切りの権限の一覧です（RFC 8693）。
+	Scope string `json:"scope"`
+}
+
+// hasScope はトークンに scope が含まれるかどうかを返します。
+func (c tokenClaims) hasScope(scope string) bool {
+	return slices.Contains(strings.Fields(c.Scope), scope)
+}
+
+// verifyJWT は HS256 で署名された JWT の署名と有効期間を検証し、クレームを返します。
+// exp のないトークンは失効させられないため受け付けません。
+func verifyJWT(kr *secret.KeyRing, token string, now time.Time) (tokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return tokenClaims{}, secret.ErrMalformedToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return tokenClaims{}, err
+	}
+	// alg: none や公開鍵方式への差し替えで署名の検証を回避されないよう、HS256 以外は拒否する
+	if header.Alg != "HS256" {
+		return tokenClaims{}, secret.ErrMalformedToken
+	}
+	if err := kr.Verify([]byte(parts[0]+"."+parts[1]), parts[2]); err != nil {
+		return tokenClaims{}, err
+	}
+	var claims tokenClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return tokenClaims{}, err
+	}
+	if claims.ExpiresAt == 0 {
+		return tokenClaims{}, secret.ErrMalformedToken
+	}
+	if !now.Before(time.Unix(claims.ExpiresAt, 0)) || now.Before(time.Unix(claims.NotBefore, 0)) {
+		return tokenClaims{}, secret.ErrTokenExpired
+	}
+	return claims, nil
+}
+
+// decodeJWTPart は base64url でエンコードされた JWT のヘッダーまたはペイロードを v に読み込みます。
+func decodeJWTPart(part string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return secret.ErrMalformedToken
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return secret.ErrMalformedToken
+	}
+	return nil
+}
+
+// bearerToken は Authorization: Bearer ヘッダーからトークンを取り出します。
+func bearerToken(h http.Header) string {
+	token, ok := strings.CutPrefix(h.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// playerFrom は context に格納された本人確認済みのプレイヤー ID を返します。本人確認を行っていない場合は false を返します。
+func playerFrom(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(playerKey{}).(string)
+	return id, ok
+}
+
+// authorizedPlayerID はリクエストで指定されたプレイヤー ID を、本人確認済みのプレイヤー ID と照合して返します。
+// 指定がない場合はトークンのプレイヤー ID を使い、異なる場合は errPlayerMismatch を返します。
+func authorizedPlayerID(ctx context.Context, given string) (string, error) {
+	id, ok := playerFrom(ctx)
+	switch {
+	case !ok:
+		return given, nil
+	case given == "" || given == id:
+		return id, nil
+	default:
+		return "", errPlayerMismatch
+	}
+}
+
+// writePlayerMismatch は、他のプレイヤーとしてのリクエストを 403 で拒否します。
+func writePlayerMismatch(w http.ResponseWriter) {
+	writeJSONError(w, http.StatusForbidden, errCodeForbidden, "Player id does not match the authenticated player")
+}
+
+// playerAuthMiddleware はプレイヤーのトークンを検証し、プレイヤー ID を context に格納するミドルウェアです。
+// トークンがない、不正、または期限切れの場合は 401 を返します。PlayerTokenKeys が nil の場合は何もしません。
+// プレイヤーごとのレート制限でトークンのプレイヤー ID を使うため、s.rateLimitMiddleware の外側に適用してください。
+func (s *Server) playerAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.PlayerTokenKeys == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims, err := verifyJWT(s.cfg.PlayerTokenKeys, bearerToken(r.Header), time.Now())
+		if err != nil || claims.Subject == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="matchmaking", error="invalid_token"`)
+			writeJSONError(w, http.StatusUnauthorized, errCodeUnauthorized, "Missing, invalid or expired player token")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), playerKey{}, claims.Subject)))
+	})
+}
+
+// authorizeMatchmakingRequest は待機の開始リクエストのプレイヤー ID を本人確認済みのプレイヤー ID と照合します。
+// ソロの場合は id を省略でき、パーティの場合は本人がメンバーに含まれていなければなりません。
+func authorizeMatchmakingRequest(ctx context.Context, req *matchmakingRequest) error {
+	if req.PartyID == "" {
+		id, err := authorizedPlayerID(ctx, req.ID)
+		req.ID = id
+		return err
+	}
+	id, ok := playerFrom(ctx)
+	if ok && !slices.ContainsFunc(req.Players, func(p model.Player) bool { return p.ID == id }) {
+		return errPlayerMismatch
+	}
+	return nil
+}
+
+// adminTokenSubject はリクエストに scope が admin の有効なトークンが付いていれば、その sub と true を返します。
+func (s *Server) adminTokenSubject(h http.Header) (string, bool) {
+	if s.cfg.PlayerTokenKeys == nil {
+		return "", false
+	}
+	claims, err := verifyJWT(s.cfg.PlayerTokenKeys, bearerToken(h), time.Now())
+	if err != nil || !claims.hasScope(adminTokenScope) {
+		return "", false
+	}
+	return claims.Subject, true
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/secret"
+)
+
+// playerTokenServer は PlayerTokenKeys に keys を設定したテスト用のサーバを返します。
+func playerTokenServer(t *testing.T) (*testServer, *secret.KeyRing) {
+	t.Helper()
+	keys, err := secret.NewKeyRing("test-player-token-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestServer(t, func(cfg *Config) { cfg.PlayerTokenKeys = keys }), keys
+}
+
+// トークンのない、期限切れ、または偽造されたトークンのリクエストは 401 で拒否する
+func TestPlayerTokenRejected(t *testing.T) {
+	ts, keys := playerTokenServer(t)
+	forger, err := secret.NewKeyRing("not-the-server-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, tc := range []struct {
+		name   string
+		header http.Header
+	}{
+		{"missing", nil},
+		{"expired", bearerHeader(signJWT(t, keys, "HS256", map[string]interface{}{"sub": "alice", "exp": now.Add(-time.Minute).Unix()}))},
+		{"not yet valid", bearerHeader(signJWT(t, keys, "HS256", map[string]interface{}{"sub": "alice", "exp": now.Add(time.Hour).Unix(), "nbf": now.Add(time.Minute).Unix()}))},
+		{"forged", bearerHeader(signJWT(t, forger, "HS256", map[string]interface{}{"sub": "alice", "exp": now.Add(time.Hour).Unix()}))},
+		{"alg none", bearerHeader(signJWT(t, keys, "none", map[string]interface{}{"sub": "alice", "exp": now.Add(time.Hour).Unix()}))},
+		{"no expiry", bearerHeader(signJWT(t, keys, "HS256", map[string]interface{}{"sub": "alice"}))},
+		{"no subject", bearerHeader(signJWT(t, keys, "HS256", map[string]interface{}{"exp": now.Add(time.Hour).Unix()}))},
+		{"malformed", bearerHeader("not-a-jwt")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := ts.do(t, "POST", "/matchmaking", map[string]string{"id": "alice"}, tc.header)
+			if code := errorShape(t, rec, http.StatusUnauthorized); code != errCodeUnauthorized {
+				t.Fatalf("code = %q, want %q", code, errCodeUnauthorized)
+			}
+			if rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+	if ids := ts.queuedIDs(t); len(ids) != 0 {
+		t.Fatalf("queued = %v, want nobody", ids)
+	}
+}
+
+// 有効なトークンではボディの id ではなくトークンのプレイヤーとして登録し、他のプレイヤーとしてのリクエストは 403 で拒否する
+func TestPlayerTokenIdentity(t *testing.T) {
+	ts, keys := playerTokenServer(t)
+	alice := playerToken(t, keys, "alice")
+
+	for _, body := range []map[string]interface{}{
+		{"id": "bob"},
+		{"party_id": "p1", "game_mode": "2v2", "players": []map[string]string{{"id": "bob"}, {"id": "carol"}}},
+	} {
+		rec := ts.do(t, "POST", "/matchmaking", body, alice)
+		if code := errorShape(t, rec, http.StatusForbidden); code != errCodeForbidden {
+			t.Fatalf("%v: code = %q, want %q", body, code, errCodeForbidden)
+		}
+	}
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() { done <- serve(t, ts.Server, "POST", "/matchmaking", map[string]string{}, alice) }()
+	ts.waitQueued(t, 1)
+	if ids := ts.queuedIDs(t); !slices.Equal(ids, []string{"alice"}) {
+		t.Fatalf("queued = %v, want the token's player", ids)
+	}
+	if rec := ts.do(t, "GET", "/matchmaking/status?player_id=alice", nil, playerToken(t, keys, "bob")); rec.Code != http.StatusForbidden {
+		t.Fatalf("bob reading alice's status: %d, want 403", rec.Code)
+	}
+}
+
+// 管理用エンドポイントは scope に admin を含むトークンでも呼び出せる
+func TestAdminTokenScope(t *testing.T) {
+	ts, keys := playerTokenServer(t)
+	admin := ts.AdminHandler()
+	now := time.Now()
+	for _, tc := range []struct {
+		name   string
+		claims map[string]interface{}
+		status int
+	}{
+		{"admin scope", map[string]interface{}{"sub": "ops", "scope": "read admin", "exp": now.Add(time.Hour).Unix()}, http.StatusOK},
+		{"player token", map[string]interface{}{"sub": "alice", "exp": now.Add(time.Hour).Unix()}, http.StatusUnauthorized},
+		{"expired admin token", map[string]interface{}{"sub": "ops", "scope": "admin", "exp": now.Add(-time.Minute).Unix()}, http.StatusUnauthorized},
+	} {
+		rec := serve(t, admin, "GET", "/admin/queue", nil, bearerHeader(signJWT(t, keys, "HS256", tc.claims)))
+		if rec.Code != tc.status {
+			t.Errorf("%s: status %d, want %d: %s", tc.name, rec.Code, tc.status, rec.Body)
+		}
+	}
+}
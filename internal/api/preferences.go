@@ -0,0 +1,56 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+)
+
+// matchPreferences は POST /matchmaking の preferences です。各値の 0 または省略は指定なしです。
+type matchPreferences struct {
+	// MaxRatingGap は自分と相手のレーティング（パーティは平均）の差の上限です（max_delta と同じ）。
+	// 2人とも指定している場合は、より厳しい方が優先されます（canMatchRatingRange）。
+	MaxRatingGap int `json:"max_rating_gap,omitempty"`
+	// MaxWaitSeconds はマッチング結果を待つ時間（秒）です（timeout_seconds と同じく MATCHMAKING_TIMEOUT_MIN〜MAX の範囲）。
+	MaxWaitSeconds int `json:"max_wait_seconds,omitempty"`
+}
+
+// applyPreferences は preferences の指定を max_delta と timeout_seconds に反映します。
+// クエリパラメータの timeout_seconds より優先するため、timeoutQueryParam より前に呼び出してください。
+// 同じ条件を preferences とトップレベルの両方で異なる値に指定した場合はエラーにします。待機時間は q の範囲で検証します。
+func (req *matchmakingRequest) applyPreferences(q queue.Config) error {
+	p := req.Preferences
+	if p == nil {
+		return nil
+	}
+	if p.MaxRatingGap != 0 {
+		if p.MaxRatingGap < model.MinRatingGapPreference || p.MaxRatingGap > model.MaxRating {
+			return &model.FieldError{
+				Field:   "preferences.max_rating_gap",
+				Message: fmt.Sprintf("max_rating_gap must be between %d and %d", model.MinRatingGapPreference, model.MaxRating),
+				Details: map[string]interface{}{"min": model.MinRatingGapPreference, "max": model.MaxRating},
+			}
+		}
+		if req.MaxDelta != 0 && req.MaxDelta != p.MaxRatingGap {
+			return &model.FieldError{Field: "preferences.max_rating_gap", Message: "preferences.max_rating_gap conflicts with max_delta"}
+		}
+		req.MaxDelta = p.MaxRatingGap
+	}
+	if p.MaxWaitSeconds != 0 {
+		lo, hi := int(q.MinTimeout/time.Second), int(q.MaxTimeout/time.Second)
+		if p.MaxWaitSeconds < lo || p.MaxWaitSeconds > hi {
+			return &model.FieldError{
+				Field:   "preferences.max_wait_seconds",
+				Message: fmt.Sprintf("max_wait_seconds must be between %d and %d", lo, hi),
+				Details: map[string]interface{}{"min": lo, "max": hi},
+			}
+		}
+		if req.TimeoutSeconds != 0 && req.TimeoutSeconds != p.MaxWaitSeconds {
+			return &model.FieldError{Field: "preferences.max_wait_seconds", Message: "preferences.max_wait_seconds conflicts with timeout_seconds"}
+		}
+		req.TimeoutSeconds = p.MaxWaitSeconds
+	}
+	return nil
+}
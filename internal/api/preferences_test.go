@@ -0,0 +1,138 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// preferencesServer は alice（1500）・bob（1650）・carol（1550）のレーティングを登録したサーバです。
+func preferencesServer(t *testing.T) *testServer {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.Queue.MinTimeout = time.Second
+		cfg.PlayerRateLimit = ratelimit.Config{}
+	})
+	ts.seedRatings(t, map[string]int{"alice": 1500, "bob": 1650, "carol": 1550})
+	return ts
+}
+
+// 2人の max_rating_gap が異なる場合は厳しい方を守る。どちらの側が厳しくても同じ
+func TestPreferencesAsymmetricRatingGap(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		alice    int
+		bob      int
+		matched  bool
+		waitings []string
+	}{
+		{"alice strict", 100, 300, false, []string{"alice", "bob"}},
+		{"bob strict", 300, 100, false, []string{"alice", "bob"}},
+		{"both permissive", 300, 200, true, nil},
+		{"only alice sets a gap", 100, 0, false, []string{"alice", "bob"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := preferencesServer(t)
+			enqueue := func(id string, gap int) <-chan *httptest.ResponseRecorder {
+				body := map[string]interface{}{"id": id}
+				if gap != 0 {
+					body["preferences"] = map[string]int{"max_rating_gap": gap}
+				}
+				return ts.startEnqueue(t, body)
+			}
+			alice := enqueue("alice", tc.alice)
+			ts.waitQueued(t, 1)
+			bob := enqueue("bob", tc.bob)
+			ts.waitQueued(t, 2)
+			ts.clock.Advance(time.Minute)
+			if cycle := ts.tick(t); (cycle.Matched == 1) != tc.matched {
+				t.Fatalf("tick created %d sessions, want matched = %v for a gap of 150", cycle.Matched, tc.matched)
+			}
+			if ids := ts.queuedIDs(t); !slices.Equal(ids, tc.waitings) {
+				t.Fatalf("queued = %v, want %v", ids, tc.waitings)
+			}
+			if tc.matched {
+				receive(t, alice)
+				receive(t, bob)
+			}
+		})
+	}
+}
+
+// 厳しい max_rating_gap のプレイヤーは範囲外の相手を断り、範囲内の別の相手とマッチングする
+func TestPreferencesStrictPlayerWaitsForCloseOpponent(t *testing.T) {
+	ts := preferencesServer(t)
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice", "preferences": map[string]int{"max_rating_gap": 100}})
+	ts.waitQueued(t, 1)
+	ts.startEnqueue(t, map[string]interface{}{"id": "bob", "preferences": map[string]int{"max_rating_gap": 300}})
+	ts.waitQueued(t, 2)
+	carol := ts.startEnqueue(t, map[string]interface{}{"id": "carol", "preferences": map[string]int{"max_rating_gap": 300}})
+	ts.waitQueued(t, 3)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+	for _, done := range []<-chan *httptest.ResponseRecorder{alice, carol} {
+		rec := receive(t, done)
+		var session model.SessionResult
+		decodeJSON(t, rec, &session)
+		if rec.Code != http.StatusOK || !slices.Equal(session.HumanPlayerIDs(), []string{"alice", "carol"}) {
+			t.Fatalf("status %d, players %v, want alice and carol", rec.Code, session.HumanPlayerIDs())
+		}
+	}
+}
+
+// max_wait_seconds はそのプレイヤーの待機時間になり、管理用の待機キューの一覧に表示する
+func TestPreferencesMaxWait(t *testing.T) {
+	ts := preferencesServer(t)
+	ts.startEnqueue(t, map[string]interface{}{"id": "bob", "preferences": map[string]int{"max_rating_gap": 100, "max_wait_seconds": 60}})
+	ts.waitQueued(t, 1)
+
+	rec := serve(t, ts.AdminHandler(), "GET", "/admin/queue", nil, adminHeader())
+	var resp struct {
+		Players []adminQueuedPlayer `json:"players"`
+	}
+	decodeJSON(t, rec, &resp)
+	if len(resp.Players) != 1 || resp.Players[0].RatingRange.MaxDelta != 100 || resp.Players[0].MaxWaitSeconds != 60 {
+		t.Fatalf("admin queue = %+v, want bob with a gap of 100 and a 60s wait", resp.Players)
+	}
+
+	start := time.Now()
+	rec = receive(t, ts.startEnqueue(t, map[string]interface{}{"id": "alice", "preferences": map[string]int{"max_wait_seconds": 1}}))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status %d, want 504 after alice's 1s wait: %s", rec.Code, rec.Body)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("waited %v, want about 1s", elapsed)
+	}
+}
+
+func TestPreferencesValidation(t *testing.T) {
+	ts := preferencesServer(t)
+	for _, tc := range []struct {
+		name  string
+		body  map[string]interface{}
+		field string
+	}{
+		{"gap below the minimum", map[string]interface{}{"id": "alice", "preferences": map[string]int{"max_rating_gap": model.MinRatingGapPreference - 1}}, "preferences.max_rating_gap"},
+		{"gap conflicts with max_delta", map[string]interface{}{"id": "alice", "max_delta": 200, "preferences": map[string]int{"max_rating_gap": 100}}, "preferences.max_rating_gap"},
+		{"wait above the maximum", map[string]interface{}{"id": "alice", "preferences": map[string]int{"max_wait_seconds": 181}}, "preferences.max_wait_seconds"},
+		{"wait conflicts with timeout_seconds", map[string]interface{}{"id": "alice", "timeout_seconds": 30, "preferences": map[string]int{"max_wait_seconds": 60}}, "preferences.max_wait_seconds"},
+	} {
+		rec := ts.do(t, "POST", "/matchmaking", tc.body, nil)
+		if code := errorShape(t, rec, http.StatusBadRequest); code != errCodeInvalidRequest {
+			t.Errorf("%s: code = %q, want %q", tc.name, code, errCodeInvalidRequest)
+			continue
+		}
+		var resp struct {
+			Error ErrorDetail `json:"error"`
+		}
+		decodeJSON(t, rec, &resp)
+		if resp.Error.Details["field"] != tc.field {
+			t.Errorf("%s: details = %v, want field %s", tc.name, resp.Error.Details, tc.field)
+		}
+	}
+}
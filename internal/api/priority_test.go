@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+	"matchmaking_project/internal/store"
+)
+
+// 指定した優先度は待機状況と管理用の待機キュー一覧に表示し、範囲外の値は拒否する
+func TestEnqueuePriority(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.PlayerRateLimit = ratelimit.Config{} })
+	for _, priority := range []int{-1, model.MaxQueuePriority + 1} {
+		rec := ts.do(t, "POST", "/matchmaking", map[string]interface{}{"id": "alice", "priority": priority}, nil)
+		if code := errorShape(t, rec, http.StatusBadRequest); code != errCodeInvalidRequest {
+			t.Fatalf("priority %d: code = %q, want %q", priority, code, errCodeInvalidRequest)
+		}
+	}
+
+	ts.startEnqueue(t, map[string]interface{}{"id": "alice", "priority": 7})
+	ts.waitQueued(t, 1)
+	ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	if got := ts.queueStatus(t, "alice").Priority; got != 7 {
+		t.Errorf("alice status priority = %d, want 7", got)
+	}
+
+	rec := serve(t, ts.AdminHandler(), "GET", "/admin/queue", nil, adminHeader())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("admin queue: status %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Players []store.QueuedPlayer `json:"players"`
+	}
+	decodeJSON(t, rec, &resp)
+	priorities := make(map[string]int)
+	for _, p := range resp.Players {
+		priorities[p.ID] = p.Priority
+	}
+	if priorities["alice"] != 7 || priorities["bob"] != 0 {
+		t.Fatalf("admin queue priorities = %v, want alice 7 and bob 0", priorities)
+	}
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/queue"
+)
+
+// DB が断続的に失敗する間は確認の間隔を倍々に延ばし（登録の通知でも確認しない）、成功したら元の間隔に戻す
+func TestProcessorBacksOffDuringIntermittentFailures(t *testing.T) {
+	const interval = time.Second
+	sched := queue.NewProcessorScheduler(interval, interval, processorMaxBackoff, time.After)
+	busy := queue.MatchCycle{Waiting: 2}
+
+	for i, want := range []time.Duration{interval, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, processorMaxBackoff, processorMaxBackoff} {
+		sched.Observe(queue.MatchCycle{}, driver.ErrBadConn)
+		wait, wakeable := sched.Next()
+		if wait != want || wakeable {
+			t.Fatalf("after %d failures: wait %v (wakeable %v), want %v and not wakeable", i+1, wait, wakeable, want)
+		}
+	}
+
+	// 一時的に回復して再び失敗した場合は、最初の間隔から延ばし直す
+	sched.Observe(busy, nil)
+	if wait, wakeable := sched.Next(); wait != interval || !wakeable {
+		t.Fatalf("after recovering: wait %v (wakeable %v), want %v and wakeable", wait, wakeable, interval)
+	}
+	sched.Observe(queue.MatchCycle{}, driver.ErrBadConn)
+	if wait, wakeable := sched.Next(); wait != interval || wakeable {
+		t.Fatalf("after failing again: wait %v (wakeable %v), want %v and not wakeable", wait, wakeable, interval)
+	}
+	sched.Observe(busy, nil)
+	if sched.Failures != 0 {
+		t.Fatalf("failures = %d after a successful cycle, want 0", sched.Failures)
+	}
+}
+
+// 待機キューへの登録はマッチングプロセッサーを起こすため、同時に待機を始めた2人は確認の間隔を待たずにマッチングする
+func TestEnqueueWakesProcessor(t *testing.T) {
+	const interval = 10 * time.Second
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.ProcessorInterval = interval
+		cfg.Queue.ProcessorMaxIdleInterval = interval
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ts.MatchmakingProcessor(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	start := time.Now()
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	for _, ch := range []<-chan *httptest.ResponseRecorder{alice, bob} {
+		if rec := receive(t, ch); rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > interval/5 {
+		t.Fatalf("matched after %v, want well under the %v poll interval", elapsed, interval)
+	}
+}
+
+// 通知済みで処理されていない間の wakeMatcher はブロックしない
+func TestWakeMatcherNeverBlocks(t *testing.T) {
+	ts := newTestServer(t, nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			ts.wakeMatcher()
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("wakeMatcher blocked without a running processor")
+	}
+	if n := len(ts.matchWake); n != 1 {
+		t.Fatalf("pending wakeups = %d, want 1", n)
+	}
+}
+
+// fakeTimer は processorScheduler の待機に使う偽のタイマーです。要求された待機時間を waits に送り、fire を送るまで待機を終えません。
+type fakeTimer struct {
+	waits chan time.Duration
+	fire  chan time.Time
+}
+
+func newFakeTimer() *fakeTimer {
+	return &fakeTimer{waits: make(chan time.Duration, 16), fire: make(chan time.Time)}
+}
+
+func (f *fakeTimer) after(d time.Duration) <-chan time.Time {
+	f.waits <- d
+	return f.fire
+}
+
+// 待機キューが空の間は確認の間隔を倍々に maxIdle まで延ばし、待機中のエントリがあるかマッチングが成立したら最短の間隔に戻す
+func TestProcessorBacksOffWhileQueueEmpty(t *testing.T) {
+	const interval, maxIdle = time.Second, 10 * time.Second
+	sched := queue.NewProcessorScheduler(interval, maxIdle, processorMaxBackoff, time.After)
+	if wait, wakeable := sched.Next(); wait != interval || !wakeable {
+		t.Fatalf("initial wait %v (wakeable %v), want %v and wakeable", wait, wakeable, interval)
+	}
+	for i, want := range []time.Duration{interval, 2 * time.Second, 4 * time.Second, 8 * time.Second, maxIdle, maxIdle} {
+		sched.Observe(queue.MatchCycle{}, nil)
+		if wait, wakeable := sched.Next(); wait != want || !wakeable {
+			t.Fatalf("after %d empty cycles: wait %v (wakeable %v), want %v and wakeable", i+1, wait, wakeable, want)
+		}
+	}
+	for _, cycle := range []queue.MatchCycle{{Waiting: 2, Matched: 1}, {Waiting: 1}} {
+		for range 3 {
+			sched.Observe(queue.MatchCycle{}, nil)
+		}
+		sched.Observe(cycle, nil)
+		if wait, _ := sched.Next(); wait != interval {
+			t.Fatalf("after %+v: wait %v, want %v", cycle, wait, interval)
+		}
+	}
+}
+
+// 待機は偽のタイマーか登録の通知で終わり、処理中に通知が何回あっても追加の確認は1回にまとまる
+func TestProcessorSchedulerWakeCoalesces(t *testing.T) {
+	ts := newTestServer(t, nil)
+	timer := newFakeTimer()
+	sched := queue.NewProcessorScheduler(time.Second, 10*time.Second, processorMaxBackoff, timer.after)
+	stop := make(chan struct{})
+	wait := func() <-chan bool {
+		done := make(chan bool, 1)
+		go func() { done <- sched.Wait(stop, ts.matchWake) }()
+		return done
+	}
+	blocked := func(done <-chan bool) {
+		t.Helper()
+		<-timer.waits
+		select {
+		case <-done:
+			t.Fatal("Wait returned before the timer fired")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	// タイマーが発火すれば待機を終える
+	done := wait()
+	blocked(done)
+	timer.fire <- testEpoch
+	if !<-done {
+		t.Fatal("Wait = false after the timer fired")
+	}
+
+	// 処理中の5回の登録は1回の確認にまとまる
+	for range 5 {
+		ts.wakeMatcher()
+	}
+	if !<-wait() {
+		t.Fatal("Wait = false after a wakeup")
+	}
+	<-timer.waits
+	done = wait()
+	blocked(done)
+
+	// 停止すると false を返す
+	close(stop)
+	if <-done {
+		t.Fatal("Wait = true after stop")
+	}
+}
+
+// 処理が失敗している間は登録の通知でも待機を終えない
+func TestProcessorSchedulerIgnoresWakeWhileBackingOff(t *testing.T) {
+	ts := newTestServer(t, nil)
+	timer := newFakeTimer()
+	sched := queue.NewProcessorScheduler(time.Second, 10*time.Second, processorMaxBackoff, timer.after)
+	sched.Observe(queue.MatchCycle{}, driver.ErrBadConn)
+	sched.Observe(queue.MatchCycle{}, driver.ErrBadConn)
+	ts.wakeMatcher()
+
+	done := make(chan bool, 1)
+	go func() { done <- sched.Wait(make(chan struct{}), ts.matchWake) }()
+	if d := <-timer.waits; d != 2*time.Second {
+		t.Fatalf("backoff = %v, want 2s", d)
+	}
+	select {
+	case <-done:
+		t.Fatal("Wait returned on a wakeup while backing off")
+	case <-time.After(20 * time.Millisecond):
+	}
+	timer.fire <- testEpoch
+	<-done
+	if n := len(ts.matchWake); n != 1 {
+		t.Fatalf("pending wakeups = %d, want the wakeup kept for after the backoff", n)
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"matchmaking_project/internal/model"
+)
+
+// ParseBasePath は BASE_PATH の値を "/" で始まり "/" で終わらない形に正規化します。"/" のみの場合は空文字を返します。
+func ParseBasePath(v string) (string, error) {
+	if !strings.HasPrefix(v, "/") {
+		return "", fmt.Errorf("/ で始まるパスを指定してください: %q", v)
+	}
+	if strings.ContainsAny(v, "?#{} ") {
+		return "", fmt.Errorf("パスに使えない文字が含まれています: %q", v)
+	}
+	return strings.TrimRight(v, "/"), nil
+}
+
+// ParseTrustedProxies はカンマ区切りの CIDR（単一のアドレスも可）を解析します。
+func ParseTrustedProxies(v string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range model.SplitCommaList(v) {
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("%q は CIDR でも IP アドレスでもありません", item)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("%q は CIDR ではありません: %v", item, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("アドレス範囲が指定されていません")
+	}
+	return prefixes, nil
+}
+
+// isTrustedProxy は addr が TrustedProxies に含まれるかどうかを返します。
+func (s *Server) isTrustedProxy(addr string) bool {
+	ip, err := netip.ParseAddr(strings.TrimSpace(addr))
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range s.cfg.TrustedProxies {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromTrustedProxy はリクエストの接続元が信頼するプロキシかどうかを返します。
+func (s *Server) fromTrustedProxy(r *http.Request) bool {
+	return len(s.cfg.TrustedProxies) > 0 && s.isTrustedProxy(peerIP(r))
+}
+
+// peerIP は TCP の接続元の IP アドレスを返します。
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientIP はクライアントの IP アドレスを返します（ログとレート制限に使います）。
+// 接続元が信頼するプロキシの場合のみ X-Forwarded-For を右から見て、信頼するプロキシでない最初のアドレスを返します
+// （左側はクライアントが自由に書けるため、信頼するプロキシが追記した部分だけを使います）。X-Forwarded-For がなければ X-Real-IP を使います。
+// それ以外の場合は接続元のアドレスを返し、転送ヘッダーは無視します。
+func (s *Server) clientIP(r *http.Request) string {
+	peer := peerIP(r)
+	if !s.fromTrustedProxy(r) {
+		return peer
+	}
+	if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		var hops []string
+		for _, v := range values {
+			hops = append(hops, strings.Split(v, ",")...)
+		}
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if _, err := netip.ParseAddr(hop); err != nil {
+				// 不正な値より左は信頼できないため、ここまでで最も外側のプロキシを接続元とみなす
+				return peer
+			}
+			if !s.isTrustedProxy(hop) {
+				return hop
+			}
+			peer = hop
+		}
+		return peer
+	}
+	if v := strings.TrimSpace(r.Header.Get("X-Real-IP")); v != "" {
+		if _, err := netip.ParseAddr(v); err == nil {
+			return v
+		}
+	}
+	return peer
+}
+
+// externalURL はクライアントから見たこのサービスの URL（スキーム・ホスト・BasePath）を返します。
+// 信頼するプロキシからのリクエストでは X-Forwarded-Proto・X-Forwarded-Host を使います。
+func (s *Server) externalURL(r *http.Request) string {
+	scheme, host := "http", r.Host
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if s.fromTrustedProxy(r) {
+		// clientIP と同じく、クライアントが書き足せる左側ではなく接続元のプロキシが追記した最後（右端）の値を使う
+		if v := lastForwardedValue(r, "X-Forwarded-Proto"); v == "http" || v == "https" {
+			scheme = v
+		}
+		if v := lastForwardedValue(r, "X-Forwarded-Host"); v != "" {
+			host = v
+		}
+	}
+	return scheme + "://" + host + s.cfg.BasePath
+}
+
+// lastForwardedValue はカンマ区切り（複数行の場合は連結した）転送ヘッダーの最後の値を返します。
+func lastForwardedValue(r *http.Request, name string) string {
+	values := r.Header.Values(name)
+	if len(values) == 0 {
+		return ""
+	}
+	last := values[len(values)-1]
+	if i := strings.LastIndex(last, ","); i >= 0 {
+		last = last[i+1:]
+	}
+	return strings.TrimSpace(last)
+}
+
+// basePathExempt は BasePath を付けずにも受け付けるパスです。ロードバランサー・オーケストレーターのヘルスチェックと
+// Prometheus のスクレイプは、リバースプロキシを通さずにインスタンスへ直接届くためです。
+var basePathExempt = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// BasePathMiddleware は BasePath で始まるリクエストのパスから BasePath を取り除いて次のハンドラへ渡します。
+// BasePath で始まらないリクエストには 404 を返します（basePathExempt のパスはそのまま渡します）。BasePath が空の場合は何もしません。
+func (s *Server) BasePathMiddleware(next http.Handler) http.Handler {
+	if s.cfg.BasePath == "" {
+		return next
+	}
+	stripped := http.StripPrefix(s.cfg.BasePath, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if basePathExempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path != s.cfg.BasePath && !strings.HasPrefix(r.URL.Path, s.cfg.BasePath+"/") {
+			writeJSONError(w, http.StatusNotFound, errCodeNotFound, "No route for "+r.URL.Path)
+			return
+		}
+		stripped.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"matchmaking_project/internal/ratelimit"
+)
+
+// proxyServer は 10.0.0.0/8 を信頼するプロキシとしたサーバです。trusted が false の場合は TRUSTED_PROXIES を設定しません。
+func proxyServer(t *testing.T, trusted bool, configure func(*Config)) *testServer {
+	t.Helper()
+	return newTestServer(t, func(cfg *Config) {
+		if trusted {
+			prefixes, err := ParseTrustedProxies("10.0.0.0/8")
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.TrustedProxies = prefixes
+		}
+		if configure != nil {
+			configure(cfg)
+		}
+	})
+}
+
+// forwardedRequest は接続元が remote で、header の転送ヘッダーを付けたリクエストです。
+func forwardedRequest(method, path, remote string, header map[string]string) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = remote + ":40000"
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	return req
+}
+
+// 転送ヘッダーは信頼するプロキシからの接続の場合のみ使い、クライアントが左側に書き足したアドレスは使わない
+func TestClientIP(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		trusted bool
+		remote  string
+		header  map[string]string
+		want    string
+	}{
+		{"no proxy", false, "203.0.113.7", nil, "203.0.113.7"},
+		{"forwarded header without trusted proxies", false, "203.0.113.7", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		{"real ip without trusted proxies", false, "203.0.113.7", map[string]string{"X-Real-IP": "198.51.100.1"}, "203.0.113.7"},
+		{"forwarded header from an untrusted peer", true, "203.0.113.7", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		{"real ip from an untrusted peer", true, "203.0.113.7", map[string]string{"X-Real-IP": "198.51.100.1"}, "203.0.113.7"},
+		{"through a trusted proxy", true, "10.0.0.2", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"through two trusted proxies", true, "10.0.0.2", map[string]string{"X-Forwarded-For": "198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"spoofed hop left of the client", true, "10.0.0.2", map[string]string{"X-Forwarded-For": "192.0.2.99, 198.51.100.1"}, "198.51.100.1"},
+		{"malformed hop", true, "10.0.0.2", map[string]string{"X-Forwarded-For": "198.51.100.1, garbage, 10.0.0.3"}, "10.0.0.3"},
+		{"real ip through a trusted proxy", true, "10.0.0.2", map[string]string{"X-Real-IP": "198.51.100.1"}, "198.51.100.1"},
+		{"malformed real ip", true, "10.0.0.2", map[string]string{"X-Real-IP": "garbage"}, "10.0.0.2"},
+	} {
+		ts := proxyServer(t, tc.trusted, nil)
+		if got := ts.clientIP(forwardedRequest("GET", "/modes", tc.remote, tc.header)); got != tc.want {
+			t.Errorf("%s: clientIP = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+// 接続元ごとのレート制限は、信頼しない接続元が X-Forwarded-For を変えても回避できない
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		trusted bool
+		remote  string
+		limited bool
+	}{
+		{"without trusted proxies", false, "203.0.113.7", true},
+		{"untrusted peer", true, "203.0.113.7", true},
+		{"trusted proxy", true, "10.0.0.2", false},
+	} {
+		ts := proxyServer(t, tc.trusted, func(cfg *Config) {
+			cfg.IPRateLimit = ratelimit.Config{RPS: 0.001, Burst: 1}
+			cfg.PlayerRateLimit = ratelimit.Config{}
+		})
+		var codes []int
+		for _, forwarded := range []string{"198.51.100.1", "198.51.100.2"} {
+			rec := httptest.NewRecorder()
+			ts.Server.ServeHTTP(rec, forwardedRequest("POST", "/matchmaking", tc.remote, map[string]string{"X-Forwarded-For": forwarded}))
+			codes = append(codes, rec.Code)
+		}
+		if limited := codes[1] == http.StatusTooManyRequests; limited != tc.limited || codes[0] == http.StatusTooManyRequests {
+			t.Errorf("%s: statuses = %v, want the second one limited = %v", tc.name, codes, tc.limited)
+		}
+	}
+}
+
+// OpenAPI の servers は信頼するプロキシの X-Forwarded-Proto・X-Forwarded-Host を使い、それ以外の接続元の値は無視する。
+// クライアントが送った値はプロキシが追記した値の左側に残るため、右端の値だけを使う
+func TestOpenAPIServerBehindProxy(t *testing.T) {
+	spoofed := map[string]string{
+		"X-Forwarded-Proto": "http, https",
+		"X-Forwarded-Host":  "evil.example, games.example.com",
+	}
+	for _, tc := range []struct {
+		name   string
+		remote string
+		header map[string]string
+		want   string
+	}{
+		{"trusted proxy", "10.0.0.2", map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "games.example.com"}, "https://games.example.com/api/matchmaking"},
+		{"spoofed values left of the proxy's", "10.0.0.2", spoofed, "https://games.example.com/api/matchmaking"},
+		{"untrusted peer", "203.0.113.7", spoofed, "http://example.com/api/matchmaking"},
+	} {
+		ts := proxyServer(t, true, func(cfg *Config) { cfg.BasePath = "/api/matchmaking" })
+		if got := ts.openAPIServer(t, forwardedRequest("GET", "/api/matchmaking/openapi.json", tc.remote, tc.header)); got != tc.want {
+			t.Errorf("%s: servers = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+
+	// プロキシが別の行として追記した場合も、クライアントが送った行ではなく最後の行を使う
+	ts := proxyServer(t, true, func(cfg *Config) { cfg.BasePath = "/api/matchmaking" })
+	req := forwardedRequest("GET", "/api/matchmaking/openapi.json", "10.0.0.2", nil)
+	req.Header.Add("X-Forwarded-Host", "evil.example")
+	req.Header.Add("X-Forwarded-Host", "games.example.com")
+	if got, want := ts.openAPIServer(t, req), "http://games.example.com/api/matchmaking"; got != want {
+		t.Errorf("separate header lines: servers = %s, want %s", got, want)
+	}
+}
+
+// openAPIServer は req で取得した OpenAPI ドキュメントの servers の URL を返します。
+func (ts *testServer) openAPIServer(t *testing.T, req *http.Request) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	ts.Server.ServeHTTP(rec, req)
+	var doc struct {
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+	}
+	decodeJSON(t, rec, &doc)
+	if rec.Code != http.StatusOK || len(doc.Servers) != 1 {
+		t.Fatalf("status %d, servers %+v, want one server", rec.Code, doc.Servers)
+	}
+	return doc.Servers[0].URL
+}
+
+func TestParseBasePathAndTrustedProxies(t *testing.T) {
+	for in, want := range map[string]string{"/api/matchmaking/": "/api/matchmaking", "/mm": "/mm", "/": ""} {
+		if got, err := ParseBasePath(in); err != nil || got != want {
+			t.Errorf("ParseBasePath(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"api", "/a b", "/a?b"} {
+		if _, err := ParseBasePath(in); err == nil {
+			t.Errorf("ParseBasePath(%q) accepted", in)
+		}
+	}
+
+	prefixes, err := ParseTrustedProxies("10.1.2.3/8, 192.0.2.1, ::ffff:198.51.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.0.0.0/8", "192.0.2.1/32", "198.51.100.1/32"}
+	if len(prefixes) != len(want) {
+		t.Fatalf("prefixes = %v, want %v", prefixes, want)
+	}
+	for i, p := range prefixes {
+		if p.String() != want[i] {
+			t.Fatalf("prefixes = %v, want %v", prefixes, want)
+		}
+	}
+	for _, in := range []string{"", "10.0.0.0/33", "proxy.internal"} {
+		if _, err := ParseTrustedProxies(in); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) accepted", in)
+		}
+	}
+}
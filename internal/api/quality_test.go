@@ -0,0 +1,65 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// 作成したセッションは対戦の質の指標を返し、GET /admin/stats/match-quality は期間内のセッションを集計する
+func TestMatchQualityStats(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.seedRatings(t, map[string]int{"alice": 1550, "bob": 1500})
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	ts.clock.Advance(10 * time.Second)
+	ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	ts.tick(t)
+	rec := receive(t, alice)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var session model.SessionResult
+	decodeJSON(t, rec, &session)
+	if session.RatingGap != 50 || math.Abs(session.WinProbability-0.5715) > 1e-4 || session.MaxWaitSeconds != 10 || session.MinWaitSeconds != 0 {
+		t.Fatalf("session = gap %d, win probability %v, waits %v..%v, want 50, 0.5715 and 0..10s",
+			session.RatingGap, session.WinProbability, session.MinWaitSeconds, session.MaxWaitSeconds)
+	}
+
+	stats := func(query string) matchQualityStatsResponse {
+		t.Helper()
+		rec := serve(t, ts.AdminHandler(), "GET", "/admin/stats/match-quality"+query, nil, adminHeader())
+		if rec.Code != http.StatusOK {
+			t.Fatalf("stats%s: status %d: %s", query, rec.Code, rec.Body)
+		}
+		var resp matchQualityStatsResponse
+		decodeJSON(t, rec, &resp)
+		return resp
+	}
+	got := stats("")
+	if got.Window != "1h0m0s" || got.Sessions != 1 || got.AverageQuality != float64(session.Quality) || got.AverageRatingGap != 50 {
+		t.Fatalf("stats = %+v, want the one session", got)
+	}
+	// 待機時間 0 秒と 10 秒の最近傍順位法によるパーセンタイル
+	if got.WaitP50Seconds != 0 || got.WaitP95Seconds != 10 {
+		t.Fatalf("wait p50, p95 = %v, %v, want 0 and 10", got.WaitP50Seconds, got.WaitP95Seconds)
+	}
+
+	ts.clock.Advance(2 * time.Hour)
+	if got := stats(""); got.Sessions != 0 || got.AverageQuality != 0 {
+		t.Fatalf("stats after the window = %+v, want no sessions", got)
+	}
+	if got := stats("?window=3h"); got.Sessions != 1 {
+		t.Fatalf("stats with a 3h window = %+v, want the session", got)
+	}
+	for _, window := range []string{"-1h", "soon", "800h"} {
+		rec := serve(t, ts.AdminHandler(), "GET", "/admin/stats/match-quality?window="+window, nil, adminHeader())
+		if code := errorShape(t, rec, http.StatusBadRequest); code != errCodeInvalidRequest {
+			t.Errorf("window=%s: code = %q, want %q", window, code, errCodeInvalidRequest)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/store"
+)
+
+// adminQueryDiagnosticsHandler は保存された遅いクエリの実行計画を新しい順に返します。
+func (s *Server) adminQueryDiagnosticsHandler(w http.ResponseWriter, r *http.Request) {
+	diagnostics, err := s.Store.QueryDiagnostics(r.Context(), store.MaxQueryDiagnostics)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "実行計画取得エラー", "func", "adminQueryDiagnosticsHandler", "error", err)
+		metrics.HandlerErrors.WithLabelValues("admin").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to list query diagnostics")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"queries": diagnostics}); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "adminQueryDiagnosticsHandler", "error", err)
+	}
+}
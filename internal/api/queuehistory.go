@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+)
+
+// defaultWaitStatsWindow と maxWaitStatsWindow は GET /admin/stats/waits の集計期間の既定値と上限です。
+// 上限より古い記録は集計できないため、sweepSessions が削除します。
+const (
+	defaultWaitStatsWindow = 24 * time.Hour
+	maxWaitStatsWindow     = 30 * 24 * time.Hour
+)
+
+// waitStatsResponse は GET /admin/stats/waits のレスポンスです。
+type waitStatsResponse struct {
+	Since time.Time `json:"since"`
+	// Mode は集計したゲームモードです。指定がない場合はすべてのゲームモードを集計し、空文字になります。
+	Mode  string                `json:"mode,omitempty"`
+	Bands []store.WaitBandStats `json:"bands"`
+}
+
+// ParseRatingBands はカンマ区切りのレーティング帯の境界を解析します。境界は MinRating より大きく MaxRating 以下で、昇順に並んでいる必要があります。
+func ParseRatingBands(s string) ([]int, error) {
+	var bands []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("rating band %q is not an integer", part)
+		}
+		if n <= model.MinRating || n > model.MaxRating {
+			return nil, fmt.Errorf("rating band %d is out of range (%d-%d)", n, model.MinRating+1, model.MaxRating)
+		}
+		if len(bands) > 0 && n <= bands[len(bands)-1] {
+			return nil, fmt.Errorf("rating bands must be in ascending order")
+		}
+		bands = append(bands, n)
+	}
+	return bands, nil
+}
+
+// setTimeoutRates は集計した件数から帯ごとのタイムアウト率を設定します。
+func setTimeoutRates(stats []store.WaitBandStats) {
+	for i := range stats {
+		if stats[i].Entries > 0 {
+			stats[i].TimeoutRate = float64(stats[i].TimedOut) / float64(stats[i].Entries)
+		}
+	}
+}
+
+// queueHistoryRecords は待機を終えたエントリのメンバーごとの記録を返します。
+func queueHistoryRecords(e model.QueueEntry, resolvedAt time.Time, outcome store.QueueOutcome) []store.QueueHistoryRecord {
+	records := make([]store.QueueHistoryRecord, 0, len(e.Players))
+	for _, p := range e.Players {
+		records = append(records, store.QueueHistoryRecord{
+			PlayerID:   p.ID,
+			Rating:     p.Rating,
+			GameMode:   e.GameMode,
+			EnqueuedAt: e.WaitingSince,
+			ResolvedAt: resolvedAt,
+			Outcome:    outcome,
+		})
+	}
+	return records
+}
+
+// leaveOutcome は queueWaiter.leave の reason に対応する待機の終わり方を返します。
+// 有効期限切れは相手が見つからないまま待機を終えたため、タイムアウトとして扱います。
+func leaveOutcome(reason string) store.QueueOutcome {
+	switch reason {
+	case "timed out", "entry expired":
+		return store.QueueOutcomeTimedOut
+	default:
+		return store.QueueOutcomeCancelled
+	}
+}
+
+// recordQueueHistory は待機の記録を保存します。監査用のため、保存できなくてもマッチングは続けます。
+func (s *Server) recordQueueHistory(ctx context.Context, records []store.QueueHistoryRecord) {
+	if len(records) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.cfg.TickTimeout)
+	defer cancel()
+	if err := s.Store.RecordQueueHistory(ctx, records); err != nil {
+		s.logger.Warn("待機履歴の記録エラー", "func", "recordQueueHistory", "records", len(records), "error", err)
+	}
+}
+
+// adminWaitStatsHandler は、since（RFC 3339、既定は24時間前）以降に待機を終えたプレイヤーの待機時間とタイムアウト率をレーティング帯ごとに集計して返します。
+// mode でゲームモードを、bands（カンマ区切り）でレーティング帯の境界を指定できます（既定は WAIT_STATS_RATING_BANDS）。
+func (s *Server) adminWaitStatsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	now := s.now()
+	since := now.Add(-defaultWaitStatsWindow)
+	if v := query.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil || t.Before(now.Add(-maxWaitStatsWindow)) {
+			writeQueueEntryError(w, &model.FieldError{Field: "since", Message: fmt.Sprintf("since must be an RFC 3339 time within the last %s", maxWaitStatsWindow)})
+			return
+		}
+		since = t
+	}
+	bands := s.cfg.WaitStatsRatingBands
+	if v := query.Get("bands"); v != "" {
+		b, err := ParseRatingBands(v)
+		if err != nil {
+			writeQueueEntryError(w, &model.FieldError{Field: "bands", Message: err.Error()})
+			return
+		}
+		bands = b
+	}
+	mode := query.Get("mode")
+
+	stats, err := s.Store.WaitStats(r.Context(), since, mode, bands)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "待機時間集計エラー", "func", "adminWaitStatsHandler", "error", err)
+		metrics.HandlerErrors.WithLabelValues("admin").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to aggregate wait times")
+		return
+	}
+	setTimeoutRates(stats)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(waitStatsResponse{Since: since, Mode: mode, Bands: stats}); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "adminWaitStatsHandler", "error", err)
+	}
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/ratelimit"
+)
+
+// waitStats は GET /admin/stats/waits に query を付けて取得した集計を返します。
+func (ts *testServer) waitStats(t *testing.T, query string) waitStatsResponse {
+	t.Helper()
+	rec := serve(t, ts.AdminHandler(), "GET", "/admin/stats/waits"+query, nil, adminHeader())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /admin/stats/waits%s: status %d: %s", query, rec.Code, rec.Body)
+	}
+	var resp waitStatsResponse
+	decodeJSON(t, rec, &resp)
+	return resp
+}
+
+// マッチング・タイムアウト・取り消しで待機を終えたプレイヤーを記録し、レーティング帯ごとに待機時間とタイムアウト率を集計する
+func TestWaitStatsByRatingBand(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.Queue.MinTimeout = time.Second
+		cfg.PlayerRateLimit = ratelimit.Config{}
+	})
+	ts.seedRatings(t, map[string]int{"alice": 900, "bob": 950, "carol": 1700, "dave": 1750})
+
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	ts.clock.Advance(10 * time.Second)
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want alice and bob matched", cycle.Matched)
+	}
+	receive(t, alice)
+	receive(t, bob)
+
+	if rec := receive(t, ts.startEnqueue(t, map[string]interface{}{"id": "carol", "timeout_seconds": 1})); rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("carol: status %d, want 504", rec.Code)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	dave := ts.startEnqueueContext(t, ctx, map[string]interface{}{"id": "dave"})
+	ts.waitQueued(t, 1)
+	cancel()
+	receive(t, dave)
+
+	var stats waitStatsResponse
+	waitFor(t, "4 players recorded", func() bool {
+		stats = ts.waitStats(t, "?bands=1000")
+		entries := 0
+		for _, b := range stats.Bands {
+			entries += b.Entries
+		}
+		return entries == 4
+	})
+	// 境界は上の帯の下限
+	if len(stats.Bands) != 2 {
+		t.Fatalf("bands = %+v, want 2 split at 1000", stats.Bands)
+	}
+	low, high := stats.Bands[0], stats.Bands[1]
+	if low.MaxRating != 999 || low.Matched != 2 || low.TimedOut != 0 || low.TimeoutRate != 0 {
+		t.Errorf("low band = %+v, want alice and bob matched", low)
+	}
+	if low.WaitP50Seconds < 0 || low.WaitP99Seconds != 10 {
+		t.Errorf("low band waits p50 %vs p99 %vs, want up to alice's 10s", low.WaitP50Seconds, low.WaitP99Seconds)
+	}
+	if high.MinRating != 1000 || high.Matched != 0 || high.TimedOut != 1 || high.Cancelled != 1 || high.TimeoutRate != 0.5 {
+		t.Errorf("high band = %+v, want carol timed out and dave cancelled", high)
+	}
+
+	// ゲームモードと集計期間で絞り込む
+	if got := ts.waitStats(t, "?mode=2v2"); got.Mode != "2v2" || len(got.Bands) != len(ts.cfg.WaitStatsRatingBands)+1 || got.Bands[0].Entries != 0 {
+		t.Errorf("2v2 stats = %+v, want empty default bands", got)
+	}
+	if got := ts.waitStats(t, "?since="+url.QueryEscape(ts.now().Add(time.Second).Format(time.RFC3339))); got.Bands[0].Entries != 0 {
+		t.Errorf("stats since the future = %+v, want none", got)
+	}
+
+	for _, query := range []string{
+		"?since=" + url.QueryEscape(ts.now().Add(-31*24*time.Hour).Format(time.RFC3339)),
+		"?since=yesterday",
+		"?bands=1600,1200",
+	} {
+		rec := serve(t, ts.AdminHandler(), "GET", "/admin/stats/waits"+query, nil, adminHeader())
+		if code := errorShape(t, rec, http.StatusBadRequest); code != errCodeInvalidRequest {
+			t.Errorf("%s: code = %q, want %q", query, code, errCodeInvalidRequest)
+		}
+	}
+}
+
+func TestParseRatingBands(t *testing.T) {
+	if bands, err := ParseRatingBands("1000, 1200,1400"); err != nil || len(bands) != 3 || bands[1] != 1200 {
+		t.Fatalf("bands = %v (%v), want 1000, 1200, 1400", bands, err)
+	}
+	// 空の指定は1つの帯
+	if bands, err := ParseRatingBands(""); err != nil || len(bands) != 0 {
+		t.Fatalf("empty bands = %v (%v), want none", bands, err)
+	}
+	for _, s := range []string{"abc", "1200,1000", "1000,1000", "0"} {
+		if _, err := ParseRatingBands(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
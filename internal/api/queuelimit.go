@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"matchmaking_project/internal/metrics"
+)
+
+// queueFullRetryAfter は待機キューが満杯の場合に、クライアントへ再試行までの待ち時間として返す値です。
+const queueFullRetryAfter = 5 * time.Second
+
+// errEnqueueBusy は待機キューへの登録を同時に行うリクエストが上限（MaxConcurrentEnqueues）に達しているため登録できない場合のエラーです。
+var errEnqueueBusy = errors.New("too many concurrent enqueue requests")
+
+// enqueueSlotWait は登録の枠が空くのを待つ最大時間です。過ぎた場合は errEnqueueBusy を返します。
+const enqueueSlotWait = 100 * time.Millisecond
+
+// semaphore は同時に実行する処理の数を制限します。使用中の数は inUse のゲージに反映します。
+type semaphore struct {
+	slots chan struct{}
+	inUse prometheus.Gauge
+}
+
+// newSemaphore は同時に n 個まで実行できる semaphore を生成します。n が 0 以下の場合は nil を返します。
+func newSemaphore(n int, inUse prometheus.Gauge) *semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return &semaphore{slots: make(chan struct{}, n), inUse: inUse}
+}
+
+// acquire は枠が空くのを最大 wait の間待ち、取得できたかどうかを返します。s が nil の場合は常に true を返します。
+func (s *semaphore) acquire(ctx context.Context, wait time.Duration) bool {
+	if s == nil {
+		return true
+	}
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case s.slots <- struct{}{}:
+		case <-timer.C:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+	s.inUse.Inc()
+	return true
+}
+
+// release は acquire で取得した枠を返します。
+func (s *semaphore) release() {
+	if s == nil {
+		return
+	}
+	<-s.slots
+	s.inUse.Dec()
+}
+
+// writeEnqueueBusy は待機キューへの登録が混み合っていることを Retry-After ヘッダー付きの 503 で返します。
+func writeEnqueueBusy(w http.ResponseWriter) {
+	metrics.EnqueueBusyRejections.Inc()
+	w.Header().Set("Retry-After", "1")
+	writeErrorResponse(w, http.StatusServiceUnavailable, ErrorDetail{
+		Code:    errCodeServerBusy,
+		Message: "Too many concurrent matchmaking requests; retry later",
+		Details: map[string]interface{}{"retry_after_seconds": 1},
+	})
+}
+
+// writeQueueFull は待機キューが満杯であることを Retry-After ヘッダー付きの 503 で返します。
+func (s *Server) writeQueueFull(w http.ResponseWriter) {
+	metrics.QueueRejections.Inc()
+	seconds := int(queueFullRetryAfter / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeErrorResponse(w, http.StatusServiceUnavailable, ErrorDetail{
+		Code:    errCodeQueueFull,
+		Message: "Matchmaking queue is full; retry later",
+		Details: map[string]interface{}{"max_queue_size": s.cfg.MaxQueueSize, "retry_after_seconds": seconds},
+	})
+}
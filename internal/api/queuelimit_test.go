@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+	"matchmaking_project/internal/store"
+)
+
+// 待機キューが上限（MaxQueueSize）に達している間の登録は、登録せずに Retry-After 付きの 503 で拒否する
+func TestQueueFullRejectsNextJoin(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.MaxQueueSize = 3
+		cfg.PlayerRateLimit = ratelimit.Config{}
+	})
+	rejected := testutil.ToFloat64(metrics.QueueRejections)
+	rejectQueueFull := func(body interface{}) {
+		t.Helper()
+		rec := ts.do(t, "POST", "/matchmaking", body, nil)
+		if code := errorShape(t, rec, http.StatusServiceUnavailable); code != errCodeQueueFull {
+			t.Fatalf("code = %q, want %q", code, errCodeQueueFull)
+		}
+		if got := rec.Header().Get("Retry-After"); got != "5" {
+			t.Errorf("Retry-After = %q, want 5", got)
+		}
+		var resp struct {
+			Error ErrorDetail `json:"error"`
+		}
+		decodeJSON(t, rec, &resp)
+		if got := resp.Error.Details["max_queue_size"]; got != float64(3) {
+			t.Errorf("details.max_queue_size = %v, want 3", got)
+		}
+	}
+
+	ctx, leave := context.WithCancel(context.Background())
+	defer leave()
+	alice := ts.startEnqueueContext(t, ctx, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	// パーティは全員分の空きがなければ登録しない
+	rejectQueueFull(json.RawMessage(`{"party_id":"p1","game_mode":"2v2","players":[{"id":"carol"},{"id":"dave"}]}`))
+	ts.startEnqueue(t, map[string]interface{}{"id": "carol"})
+	ts.waitQueued(t, 3)
+
+	// 上限の人数（3人）の次の登録を拒否する
+	rejectQueueFull(map[string]interface{}{"id": "dave"})
+	if got := testutil.ToFloat64(metrics.QueueRejections) - rejected; got != 2 {
+		t.Errorf("rejections counted = %v, want 2", got)
+	}
+	if ids := ts.queuedIDs(t); !slices.Equal(ids, []string{"alice", "bob", "carol"}) {
+		t.Fatalf("queued = %v, want alice, bob and carol", ids)
+	}
+
+	// 待機を終えたプレイヤーの分だけ空きができる
+	leave()
+	receive(t, alice)
+	ts.waitQueued(t, 2)
+	ts.startEnqueue(t, map[string]interface{}{"id": "dave"})
+	ts.waitQueued(t, 3)
+}
+
+// 数百のクライアントが同時に待機を始めても、待機キューは上限を超えず、あふれたリクエストはすぐに 503 で拒否する（-race で実行する）
+func TestQueueCapHoldsUnderConcurrentJoins(t *testing.T) {
+	const clients, limit = 300, 50
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.MaxQueueSize = limit
+		cfg.MaxConcurrentEnqueues = 8
+		cfg.PlayerRateLimit = ratelimit.Config{}
+		cfg.IPRateLimit = ratelimit.Config{}
+	})
+	ctx, leave := context.WithCancel(context.Background())
+	defer leave()
+
+	responses := make(chan *httptest.ResponseRecorder, clients)
+	for i := range clients {
+		done := ts.startEnqueueContext(t, ctx, map[string]interface{}{"id": fmt.Sprintf("p%03d", i)})
+		go func() { responses <- <-done }()
+	}
+	// 登録できなかったクライアントは待機せずに応答を受け取る
+	for range clients - limit {
+		rec := receive(t, responses)
+		if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("rejected join: status %d, Retry-After %q, want 503 with Retry-After: %s", rec.Code, rec.Header().Get("Retry-After"), rec.Body)
+		}
+		if code := errorCode(t, rec); code != errCodeQueueFull && code != errCodeServerBusy {
+			t.Fatalf("code = %q, want %q or %q", code, errCodeQueueFull, errCodeServerBusy)
+		}
+	}
+	if ids := ts.queuedIDs(t); len(ids) != limit {
+		t.Fatalf("queued %d players, want the cap of %d", len(ids), limit)
+	}
+	select {
+	case rec := <-responses:
+		t.Fatalf("a queued client got a response before matching: status %d: %s", rec.Code, rec.Body)
+	default:
+	}
+	if got := testutil.ToFloat64(metrics.EnqueuesInFlight); got != 0 {
+		t.Errorf("enqueues in flight = %v after the burst, want 0", got)
+	}
+
+	leave()
+	for range limit {
+		receive(t, responses)
+	}
+	ts.waitQueued(t, 0)
+}
+
+// blockingEnqueueStore は release が閉じられるまで待機キューへの登録を返しません。
+type blockingEnqueueStore struct {
+	store.Store
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingEnqueueStore) EnqueueEntry(ctx context.Context, entry model.QueueEntry) (model.QueueEntry, error) {
+	s.entered <- struct{}{}
+	<-s.release
+	return s.Store.EnqueueEntry(ctx, entry)
+}
+
+// 登録を同時に行うリクエストが上限（MaxConcurrentEnqueues）に達している場合は、DB を待たずに server_busy の 503 で拒否する
+func TestConcurrentEnqueueLimit(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.MaxConcurrentEnqueues = 1
+		cfg.PlayerRateLimit = ratelimit.Config{}
+	})
+	st := &blockingEnqueueStore{Store: ts.store, entered: make(chan struct{}, 1), release: make(chan struct{})}
+	ts.Store = st
+	busy := testutil.ToFloat64(metrics.EnqueueBusyRejections)
+
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	<-st.entered
+	if got := testutil.ToFloat64(metrics.EnqueuesInFlight); got != 1 {
+		t.Errorf("enqueues in flight = %v, want 1", got)
+	}
+	start := time.Now()
+	rec := ts.do(t, "POST", "/matchmaking", map[string]interface{}{"id": "bob"}, nil)
+	if code := errorShape(t, rec, http.StatusServiceUnavailable); code != errCodeServerBusy {
+		t.Fatalf("code = %q, want %q", code, errCodeServerBusy)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("busy rejection took %v, want about %v", elapsed, enqueueSlotWait)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.EnqueueBusyRejections) - busy; got != 1 {
+		t.Errorf("busy rejections counted = %v, want 1", got)
+	}
+
+	close(st.release)
+	ts.waitQueued(t, 1)
+	waitFor(t, "the enqueue slot to be released", func() bool { return testutil.ToFloat64(metrics.EnqueuesInFlight) == 0 })
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	<-st.entered
+	ts.waitQueued(t, 2)
+	ts.tick(t)
+	receive(t, alice)
+	receive(t, bob)
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+)
+
+// queueStatusResponse は GET /matchmaking/status のレスポンスです。
+type queueStatusResponse struct {
+	PlayerID string `json:"player_id"`
+	Queued   bool   `json:"queued"`
+	GameMode string `json:"game_mode"`
+	PartyID  string `json:"party_id,omitempty"`
+	// Position は同じゲームモードで待機しているプレイヤーのうち、何番目に古いか（1 始まり）です。
+	Position int `json:"position"`
+	// QueueSize は同じゲームモードで待機しているプレイヤー数です。
+	QueueSize      int     `json:"queue_size"`
+	WaitingSeconds float64 `json:"waiting_seconds"`
+	Priority       int     `json:"priority"`
+	// EstimatedWaitSeconds は最近のマッチングでの待機開始から成立までの時間の移動平均です。
+	// このインスタンスでまだマッチングが成立していないゲームモードでは省略します。
+	EstimatedWaitSeconds *int `json:"estimated_wait_seconds,omitempty"`
+	// EstimatedRemainingSeconds は推定待ち時間から既に待機した時間を引いた残り時間です（0 未満にはしません）。
+	EstimatedRemainingSeconds *int `json:"estimated_remaining_seconds,omitempty"`
+	// Requeued は中止されたセッションから待機キューへ戻され、POST /matchmaking での再開を待っていることを表します。
+	Requeued bool `json:"requeued,omitempty"`
+	// Session は待機キューにいないプレイヤーの、成立済みで未終了のセッションです（通知を受け取れなかった場合の受け取り用）。
+	Session *model.SessionResult `json:"session,omitempty"`
+}
+
+// queueStatusHandler はプレイヤーの待機キューでの順番と推定待ち時間を返します。
+// 待機キューにいない場合は、成立済みで未終了のセッションがあれば queued: false とそのセッションを返して通知済みにし、なければ 404 を返します。
+func (s *Server) queueStatusHandler(w http.ResponseWriter, r *http.Request) {
+	playerID, err := authorizedPlayerID(r.Context(), r.URL.Query().Get("player_id"))
+	if err != nil {
+		writePlayerMismatch(w)
+		return
+	}
+	if err := model.ValidateID("player_id", playerID, "player_id"); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+
+	pos, err := s.Store.QueuePosition(r.Context(), playerID)
+	if errors.Is(err, store.ErrNotQueued) {
+		session, err := s.claimPendingSession(r.Context(), playerID)
+		if err != nil {
+			if !errors.Is(err, model.ErrSessionNotFound) {
+				s.logger.WarnContext(r.Context(), "成立済みセッション確認エラー", "func", "queueStatusHandler", "player_id", playerID, "error", err)
+			}
+			writeJSONError(w, http.StatusNotFound, errCodeNotQueued, "Player is not in the matchmaking queue")
+			return
+		}
+		s.logger.InfoContext(r.Context(), "delivered pending session on status poll", "player_id", playerID, "session_id", session.SessionID)
+		resp := queueStatusResponse{PlayerID: playerID, GameMode: session.GameMode, Session: &session}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "queueStatusHandler", "error", err)
+		}
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "待機状況取得エラー", "func", "queueStatusHandler", "player_id", playerID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("queue_status").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to get queue status")
+		return
+	}
+
+	waited := max(s.now().Sub(pos.Player.WaitingSince), 0)
+	resp := queueStatusResponse{
+		PlayerID:       playerID,
+		Queued:         true,
+		GameMode:       pos.Player.GameMode,
+		PartyID:        pos.Player.PartyID,
+		Position:       pos.Position,
+		QueueSize:      pos.Waiting,
+		WaitingSeconds: math.Round(waited.Seconds()*10) / 10,
+		Priority:       pos.Player.Priority,
+		Requeued:       pos.Player.Requeued,
+	}
+	if estimate, ok := s.waitEstimates.estimate(pos.Player.GameMode); ok {
+		total := int(math.Ceil(estimate.Seconds()))
+		remaining := int(math.Ceil(max(estimate-waited, 0).Seconds()))
+		resp.EstimatedWaitSeconds = &total
+		resp.EstimatedRemainingSeconds = &remaining
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "queueStatusHandler", "error", err)
+	}
+}
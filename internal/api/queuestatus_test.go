@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+func TestWaitEstimator(t *testing.T) {
+	e := newWaitEstimator()
+	if _, ok := e.estimate("duel"); ok {
+		t.Fatal("estimate before any match, want none")
+	}
+	for _, tc := range []struct {
+		observed, want time.Duration
+	}{
+		// 最初の観測はそのまま推定値にする
+		{10 * time.Second, 10 * time.Second},
+		// 以降は 0.2 の重みで移動平均をとる
+		{20 * time.Second, 12 * time.Second},
+		{20 * time.Second, 13600 * time.Millisecond},
+		{0, 10880 * time.Millisecond},
+	} {
+		e.Observe("duel", tc.observed)
+		if got, _ := e.estimate("duel"); got != tc.want {
+			t.Fatalf("after observing %v: estimate = %v, want %v", tc.observed, got, tc.want)
+		}
+	}
+
+	// ゲームモードごとに独立している
+	e.Observe("casual", time.Minute)
+	if got, _ := e.estimate("casual"); got != time.Minute {
+		t.Errorf("casual estimate = %v, want 1m", got)
+	}
+	if got, _ := e.estimate("duel"); got != 10880*time.Millisecond {
+		t.Errorf("duel estimate = %v after observing casual, want unchanged", got)
+	}
+	if other, wait, ok := e.shortestOther("casual", []string{"duel", "casual", "ranked"}); !ok || other != "duel" || wait != 10880*time.Millisecond {
+		t.Errorf("shortestOther = %s, %v, %v, want duel", other, wait, ok)
+	}
+}
+
+// queueStatus は GET /matchmaking/status の結果を返します。
+func (ts *testServer) queueStatus(t *testing.T, playerID string) queueStatusResponse {
+	t.Helper()
+	rec := ts.do(t, "GET", "/matchmaking/status?player_id="+playerID, nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status of %s: %d: %s", playerID, rec.Code, rec.Body)
+	}
+	var resp queueStatusResponse
+	decodeJSON(t, rec, &resp)
+	return resp
+}
+
+func TestQueueStatus(t *testing.T) {
+	ts := newTestServer(t, nil)
+	if rec := ts.do(t, "GET", "/matchmaking/status?player_id=alice", nil, nil); rec.Code != http.StatusNotFound || errorCode(t, rec) != errCodeNotQueued {
+		t.Fatalf("not queued: status %d: %s, want 404 not_queued", rec.Code, rec.Body)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	alice := ts.startEnqueueContext(t, ctx, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	ts.clock.Advance(5 * time.Second)
+	bob := ts.startEnqueueContext(t, ctx, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	// 別のゲームモードのプレイヤーは順番に数えない
+	carol := ts.startEnqueueContext(t, ctx, map[string]interface{}{"id": "carol", "game_mode": "casual"})
+	ts.waitQueued(t, 3)
+	ts.clock.Advance(3 * time.Second)
+
+	got := ts.queueStatus(t, "bob")
+	if !got.Queued || got.GameMode != "duel" || got.Position != 2 || got.QueueSize != 2 || got.WaitingSeconds != 3 {
+		t.Fatalf("bob = %+v, want position 2 of 2 after waiting 3s", got)
+	}
+	if got.EstimatedWaitSeconds != nil || got.EstimatedRemainingSeconds != nil {
+		t.Errorf("bob = %+v, want no estimate before any duel match", got)
+	}
+	if got := ts.queueStatus(t, "alice"); got.Position != 1 || got.WaitingSeconds != 8 {
+		t.Errorf("alice = %+v, want position 1 after waiting 8s", got)
+	}
+	if got := ts.queueStatus(t, "carol"); got.Position != 1 || got.QueueSize != 1 {
+		t.Errorf("carol = %+v, want position 1 of 1 in casual", got)
+	}
+
+	// 推定待ち時間から待機した時間を引いた残り時間を返す
+	ts.waitEstimates.Observe("duel", 20*time.Second)
+	got = ts.queueStatus(t, "bob")
+	if got.EstimatedWaitSeconds == nil || *got.EstimatedWaitSeconds != 20 || got.EstimatedRemainingSeconds == nil || *got.EstimatedRemainingSeconds != 17 {
+		t.Fatalf("bob estimate = %v, remaining %v, want 20 and 17", got.EstimatedWaitSeconds, got.EstimatedRemainingSeconds)
+	}
+	ts.clock.Advance(time.Minute)
+	if got := ts.queueStatus(t, "bob"); got.EstimatedRemainingSeconds == nil || *got.EstimatedRemainingSeconds != 0 {
+		t.Errorf("remaining after waiting past the estimate = %v, want 0", got.EstimatedRemainingSeconds)
+	}
+
+	cancel()
+	for _, done := range []<-chan *httptest.ResponseRecorder{alice, bob, carol} {
+		receive(t, done)
+	}
+}
+
+// droppingNotifier は通知を届けられない Notifier です（通知先のインスタンスが停止した場合などを再現します）。
+type droppingNotifier struct {
+	Notifier
+}
+
+func (droppingNotifier) Publish(string, model.SessionResult) error {
+	return errors.New("subscriber is gone")
+}
+
+// 通知できなかったセッションは未通知のまま残り、次の GET /matchmaking/status で返して通知済みにする
+func TestQueueStatusDeliversPendingSession(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.notifier = droppingNotifier{Notifier: ts.notifier}
+	undelivered := func() int {
+		t.Helper()
+		pending, err := ts.store.UndeliveredNotifications(context.Background(), ts.now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(pending)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	alice := ts.startEnqueueContext(t, ctx, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	bob := ts.startEnqueueContext(t, ctx, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+	// 通知を受け取れないまま、クライアントの接続が切れる
+	cancel()
+	receive(t, alice)
+	receive(t, bob)
+	if n := undelivered(); n != 1 {
+		t.Fatalf("undelivered notifications = %d, want the session", n)
+	}
+
+	resp := ts.queueStatus(t, "alice")
+	if resp.Queued || resp.Session == nil || resp.Session.SessionID == "" {
+		t.Fatalf("status = %+v, want the pending session", resp)
+	}
+	if ids := resp.Session.HumanPlayerIDs(); !slices.Contains(ids, "bob") {
+		t.Fatalf("session players = %v, want alice and bob", ids)
+	}
+	if n := undelivered(); n != 0 {
+		t.Fatalf("undelivered notifications = %d after the status poll, want 0", n)
+	}
+	// 相手も同じセッションを受け取れる
+	if got := ts.queueStatus(t, "bob").Session; got == nil || got.SessionID != resp.Session.SessionID {
+		t.Fatalf("bob's session = %+v, want %s", got, resp.Session.SessionID)
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// rateLimitPlayerKey はプレイヤーごとの制限のキーです。本人確認済みのプレイヤー ID を使い、本人確認を行っていない場合は
+// クライアントの IP アドレスで代用します。ボディやクエリのプレイヤー ID は誰でも指定できるため、他人の枠を使い切る
+// （パーティーのメンバーに並べて他のプレイヤーを 429 にする）ことができないよう、キーには使いません。
+func (s *Server) rateLimitPlayerKey(r *http.Request) string {
+	if id, ok := playerFrom(r.Context()); ok && id != "" {
+		return "player:" + id
+	}
+	return "ip:" + s.clientIP(r)
+}
+
+// rateLimitMiddleware はクライアントの IP アドレス（clientIP）ごと、プレイヤーごとにリクエストを制限するミドルウェアです。
+// どちらかの制限を超えた場合はどちらのトークンも消費せず、Retry-After ヘッダー付きで 429 を返します。nil の RateLimiter は制限しません。
+func (s *Server) rateLimitMiddleware(byIP, byPlayer *ratelimit.RateLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, rejected, retry := ratelimit.AllowAll(
+			ratelimit.Key{Limiter: byIP, Key: s.clientIP(r)},
+			ratelimit.Key{Limiter: byPlayer, Key: s.rateLimitPlayerKey(r)},
+		)
+		if !ok {
+			writeRateLimited(w, []string{"ip", "player"}[rejected], retry)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeRateLimited は 429 を返します。Retry-After は秒単位に切り上げます。
+func writeRateLimited(w http.ResponseWriter, scope string, retry time.Duration) {
+	metrics.RateLimited.WithLabelValues(scope).Inc()
+	seconds := int(math.Ceil(retry.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeErrorResponse(w, http.StatusTooManyRequests, ErrorDetail{
+		Code:    errCodeRateLimited,
+		Message: "Too many requests",
+		Details: map[string]interface{}{"scope": scope, "retry_after_seconds": seconds},
+	})
+}
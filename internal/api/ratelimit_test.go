@@ -0,0 +1,134 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/ratelimit"
+	"matchmaking_project/internal/secret"
+)
+
+// resumeWithoutToken は制限の確認用に、ハンドラがすぐに返す（トークンがないため 410）待機の再開を送ります。
+func resumeWithoutToken(t *testing.T, ts *testServer, header http.Header) int {
+	t.Helper()
+	return ts.do(t, "GET", "/matchmaking/resume", nil, header).Code
+}
+
+func TestPlayerRateLimitKeyedOnAuthenticatedPlayer(t *testing.T) {
+	keys, err := secret.NewKeyRing("test-player-token-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServer(t, func(c *Config) {
+		c.PlayerTokenKeys = keys
+		c.IPRateLimit = ratelimit.Config{}
+		c.PlayerRateLimit = ratelimit.Config{RPS: 0.001, Burst: 1}
+	})
+
+	if code := resumeWithoutToken(t, ts, playerToken(t, keys, "alice")); code == http.StatusTooManyRequests {
+		t.Fatal("first request from alice was rate limited")
+	}
+	if code := resumeWithoutToken(t, ts, playerToken(t, keys, "alice")); code != http.StatusTooManyRequests {
+		t.Fatalf("second request from alice = %d, want 429", code)
+	}
+	// 同じ IP アドレスからでも、別のプレイヤーの枠は残っている
+	if code := resumeWithoutToken(t, ts, playerToken(t, keys, "bob")); code == http.StatusTooManyRequests {
+		t.Fatal("bob was rate limited by alice's requests")
+	}
+}
+
+func TestPlayerRateLimitIgnoresUnauthenticatedPlayerIDs(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) {
+		c.IPRateLimit = ratelimit.Config{}
+		c.PlayerRateLimit = ratelimit.Config{RPS: 0.001, Burst: 1}
+	})
+
+	// 本人確認を行っていない場合は、クエリの player_id を変えてもクライアントの IP アドレスで数える
+	if rec := ts.do(t, "GET", "/matchmaking/resume?player_id=alice", nil, nil); rec.Code == http.StatusTooManyRequests {
+		t.Fatal("first request was rate limited")
+	}
+	if rec := ts.do(t, "GET", "/matchmaking/resume?player_id=bob", nil, nil); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request with another player_id = %d, want 429", rec.Code)
+	}
+}
+
+func TestRateLimitRejectionConsumesNoTokens(t *testing.T) {
+	keys, err := secret.NewKeyRing("test-player-token-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServer(t, func(c *Config) {
+		c.PlayerTokenKeys = keys
+		c.IPRateLimit = ratelimit.Config{RPS: 0.001, Burst: 2}
+		c.PlayerRateLimit = ratelimit.Config{RPS: 0.001, Burst: 1}
+	})
+
+	for i, want := range []struct {
+		player string
+		scope  string
+	}{
+		{"alice", ""},
+		// プレイヤーの制限で拒否したリクエストは IP アドレスのトークンを消費しない
+		{"alice", "player"},
+		{"bob", ""},
+		{"carol", "ip"},
+	} {
+		rec := ts.do(t, "GET", "/matchmaking/resume", nil, playerToken(t, keys, want.player))
+		if want.scope == "" {
+			if rec.Code == http.StatusTooManyRequests {
+				t.Fatalf("request %d from %s was rate limited: %s", i, want.player, rec.Body)
+			}
+			continue
+		}
+		var body ErrorResponse
+		decodeJSON(t, rec, &body)
+		if rec.Code != http.StatusTooManyRequests || body.Error.Details["scope"] != want.scope {
+			t.Fatalf("request %d from %s = %d %+v, want 429 with scope %s", i, want.player, rec.Code, body.Error, want.scope)
+		}
+	}
+}
+
+// 制限を超えた待機の開始は 429 と Retry-After を返し、待機キューへ登録しない
+func TestMatchmakingBurstBeyondLimit(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) {
+		c.IPRateLimit = ratelimit.Config{RPS: 0.5, Burst: 2}
+		c.PlayerRateLimit = ratelimit.Config{}
+	})
+	ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+
+	rec := ts.do(t, "POST", "/matchmaking", map[string]interface{}{"id": "carol"}, nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request beyond the burst = %d, want 429: %s", rec.Code, rec.Body)
+	}
+	var body ErrorResponse
+	decodeJSON(t, rec, &body)
+	if got := rec.Header().Get("Retry-After"); got == "" || got != fmt.Sprint(body.Error.Details["retry_after_seconds"]) {
+		t.Errorf("Retry-After = %q, want the retry_after_seconds %v", got, body.Error.Details["retry_after_seconds"])
+	}
+	if got := ts.queuedIDs(t); len(got) != 2 {
+		t.Errorf("queued = %v, want only alice and bob", got)
+	}
+}
+
+// サーバのレート制限も注入した時計で補充するため、テストの時計を進めると再び受け付ける
+func TestServerRateLimitUsesInjectedClock(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) {
+		c.IPRateLimit = ratelimit.Config{RPS: 0.001, Burst: 1}
+		c.PlayerRateLimit = ratelimit.Config{}
+	})
+	if code := resumeWithoutToken(t, ts, nil); code == http.StatusTooManyRequests {
+		t.Fatal("first request was rate limited")
+	}
+	if code := resumeWithoutToken(t, ts, nil); code != http.StatusTooManyRequests {
+		t.Fatalf("second request = %d, want 429", code)
+	}
+	ts.clock.Advance(1000 * time.Second)
+	if code := resumeWithoutToken(t, ts, nil); code == http.StatusTooManyRequests {
+		t.Fatal("request after advancing the clock past the refill was rate limited")
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+)
+
+// RatingDecayer は別ゴルーチンで動作し、起動時と RatingDecayInterval ごとに decayRatings を実行します。
+func (s *Server) RatingDecayer(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.RatingDecayInterval)
+	defer ticker.Stop()
+	for {
+		s.decayRatings(ctx, s.now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// decayRatings は now の時点で RatingDecayInactiveDays 日以上対戦していないプレイヤーのレーティングを DefaultRating へ近づけます。
+// 全インスタンスで実行するため、前回の減衰から RatingDecayInterval の半分を過ぎていないプレイヤーは対象にしません（再起動や複数インスタンスでの二重の減衰を防ぐ）。
+func (s *Server) decayRatings(ctx context.Context, now time.Time) {
+	inactiveBefore := now.AddDate(0, 0, -s.cfg.RatingDecayInactiveDays)
+	decayedBefore := now.Add(-s.cfg.RatingDecayInterval / 2)
+	n, err := s.Store.DecayInactiveRatings(ctx, inactiveBefore, decayedBefore, s.cfg.RatingSeeds.Default, s.cfg.RatingDecayFactor)
+	if err != nil {
+		s.logger.Warn("レーティング減衰エラー", "func", "decayRatings", "error", err)
+		return
+	}
+	if n > 0 {
+		metrics.RatingDecays.Add(float64(n))
+		s.logger.Info("ratings decayed for inactive players", "players", n, "inactive_days", s.cfg.RatingDecayInactiveDays, "factor", s.cfg.RatingDecayFactor)
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// 一定の日数対戦していないプレイヤーだけレーティングを初期レーティングへ近づけ、減衰の間隔の中では繰り返さない
+func TestRatingDecayOnlyInactivePlayers(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.RatingDecayInactiveDays = 30
+		cfg.RatingDecayFactor = 0.1
+		cfg.RatingDecayInterval = 24 * time.Hour
+	})
+	mean := ts.cfg.RatingSeeds.Default
+	ts.seedRatings(t, map[string]int{"alice": mean + 300, "bob": mean - 300, "carol": mean + 300, "dave": mean})
+
+	ts.clock.Advance(31 * 24 * time.Hour)
+	ts.activeSession(t, "carol", "erin")
+	ts.clock.Advance(time.Hour)
+	ts.decayRatings(context.Background(), ts.now())
+
+	want := map[string]int{"alice": mean + 270, "bob": mean - 270, "carol": mean + 300, "dave": mean}
+	check := func(when string) {
+		t.Helper()
+		for id, rating := range want {
+			profile, err := ts.store.GetPlayerProfile(context.Background(), id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if profile.Rating != rating {
+				t.Errorf("%s: %s rating = %d, want %d", when, id, profile.Rating, rating)
+			}
+		}
+	}
+	check("after the first decay")
+
+	// 再起動や他のインスタンスで間隔の半分以内にもう一度実行しても減衰しない
+	ts.clock.Advance(time.Hour)
+	ts.decayRatings(context.Background(), ts.now())
+	check("within the interval")
+
+	ts.clock.Advance(24 * time.Hour)
+	ts.decayRatings(context.Background(), ts.now())
+	want["alice"], want["bob"] = mean+243, mean-243
+	check("after the next interval")
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/ratelimit"
+)
+
+// POST /matchmaking の max_delta を指定したプレイヤーは範囲外の相手を断って待ち続け、範囲を指定していないプレイヤーがその相手とマッチングする
+func TestRatingRangeEndToEnd(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.PlayerRateLimit = ratelimit.Config{} })
+	ts.seedRatings(t, map[string]int{"alice": 1500, "bob": 1800, "carol": 1750})
+
+	rec := ts.do(t, "POST", "/matchmaking", map[string]interface{}{"id": "alice", "max_delta": 10}, nil)
+	if code := errorShape(t, rec, http.StatusBadRequest); code != errCodeInvalidRequest {
+		t.Fatalf("max_delta below the minimum: code = %q, want %q", code, errCodeInvalidRequest)
+	}
+
+	ts.startEnqueue(t, map[string]interface{}{"id": "alice", "max_delta": 100})
+	ts.waitQueued(t, 1)
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	ts.clock.Advance(time.Minute)
+	if cycle := ts.tick(t); cycle.Matched != 0 {
+		t.Fatalf("tick created %d sessions, want alice to refuse bob", cycle.Matched)
+	}
+
+	carol := ts.startEnqueue(t, map[string]interface{}{"id": "carol"})
+	ts.waitQueued(t, 3)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want bob and carol matched", cycle.Matched)
+	}
+	for _, done := range []<-chan *httptest.ResponseRecorder{bob, carol} {
+		if rec := receive(t, done); rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+	}
+	if ids := ts.queuedIDs(t); !slices.Equal(ids, []string{"alice"}) {
+		t.Fatalf("queued = %v, want alice still waiting for a close opponent", ids)
+	}
+}
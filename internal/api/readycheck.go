@@ -0,0 +1,263 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+)
+
+// readyCheckRequest は POST /sessions/{id}/accept, /decline のリクエストボディです。
+type readyCheckRequest struct {
+	PlayerID string `json:"player_id"`
+}
+
+// sessionPlayerKey は承諾結果を参加者へ通知する際の Notifier のキーを返します。
+func sessionPlayerKey(sessionID, playerID string) string {
+	return "session:" + sessionID + ":" + playerID
+}
+
+// readyCheckExpiries は承諾期限切れ処理のタイマーを管理します。
+// 終了時に DB を閉じる前に停止できるよう、設定したタイマーと実行中の処理を追跡します。
+type readyCheckExpiries struct {
+	// expire は承諾期限を過ぎたセッションを処理する関数です。
+	expire  func(sessionID string)
+	mu      sync.Mutex
+	timers  map[string]*time.Timer
+	stopped bool
+	running sync.WaitGroup
+}
+
+// newReadyCheckExpiries は承諾期限を過ぎたセッションを expire で処理するタイマーの管理を生成します。
+func newReadyCheckExpiries(expire func(sessionID string)) *readyCheckExpiries {
+	return &readyCheckExpiries{expire: expire, timers: make(map[string]*time.Timer)}
+}
+
+// schedule は d 経過後にセッションの承諾期限切れ処理を実行するタイマーを設定します。停止後は何もしません。
+func (e *readyCheckExpiries) schedule(sessionID string, d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopped {
+		return
+	}
+	e.timers[sessionID] = time.AfterFunc(d, func() {
+		e.mu.Lock()
+		if e.stopped {
+			e.mu.Unlock()
+			return
+		}
+		delete(e.timers, sessionID)
+		e.running.Add(1)
+		e.mu.Unlock()
+		defer e.running.Done()
+		e.expire(sessionID)
+	})
+}
+
+// expireReadyCheck は承諾期限を過ぎたセッションを中止します。
+func (s *Server) expireReadyCheck(sessionID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.TickTimeout)
+	defer cancel()
+	session, err := s.resolveReadyCheck(ctx, sessionID, "", "")
+	if err != nil {
+		s.logger.Error("承諾期限切れ処理エラー", "func", "expireReadyCheck", "session_id", sessionID, "error", err)
+		return
+	}
+	if session.Status == model.SessionAborted {
+		s.logger.Info("ready check expired", "session_id", sessionID, "mode", session.GameMode)
+	}
+}
+
+// Stop は未実行のタイマーを止め、実行中の処理の完了を待ちます。
+// 止めたセッションは次回起動時に ResumeReadyCheckExpiries で処理されます。
+func (e *readyCheckExpiries) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	e.stopped = true
+	for id, t := range e.timers {
+		t.Stop()
+		delete(e.timers, id)
+	}
+	e.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		e.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ResumeReadyCheckExpiries は承諾待ちのまま残っているセッションの期限切れ処理を設定し直します。
+// 前回の終了時に止めたタイマーや、他のインスタンスが異常終了して残ったセッションを処理するために起動時に呼び出します。
+func (s *Server) ResumeReadyCheckExpiries(ctx context.Context) error {
+	sessions, err := s.Store.PendingSessions(ctx)
+	if err != nil {
+		return fmt.Errorf("承諾待ちセッション取得エラー: %v", err)
+	}
+
+	now := s.now()
+	for _, session := range sessions {
+		var d time.Duration
+		if session.AcceptDeadline != nil {
+			d = max(session.AcceptDeadline.Sub(now), 0)
+		}
+		s.Expiries.schedule(session.SessionID, d)
+	}
+	return nil
+}
+
+// resolveReadyCheck は参加者の承諾・辞退を記録し、セッションの状態を更新します。
+// playerID が空の場合は承諾期限切れとして扱い、未承諾の参加者を辞退とみなします。
+// 状態が確定（active または aborted）した場合は参加者全員へ通知します。
+// playerID が空の場合と state が ReadyNoShow の場合は、中止したセッションに現れなかった参加者へ penalizeNoShows を適用します。
+func (s *Server) resolveReadyCheck(ctx context.Context, sessionID, playerID, state string) (model.SessionResult, error) {
+	session, _, err := s.resolveReadyCheckOnce(ctx, sessionID, playerID, state)
+	return session, err
+}
+
+// resolveReadyCheckOnce は resolveReadyCheck と同じ処理を行い、この呼び出しでセッションの状態が確定したかどうか（resolved）も返します。
+func (s *Server) resolveReadyCheckOnce(ctx context.Context, sessionID, playerID, state string) (model.SessionResult, bool, error) {
+	session, resolved, err := s.Store.ResolveReadyCheck(ctx, sessionID, playerID, state)
+	if err != nil || !resolved {
+		return session, false, err
+	}
+
+	s.announceResolvedSession(session)
+	if session.Status == model.SessionAborted {
+		s.penalizeNoShows(ctx, session, playerID == "")
+	}
+	return session, true, nil
+}
+
+// announceResolvedSession は状態が確定したセッションと待機キューへ戻したエントリをログに出力し、承諾の結果を待っている参加者へ通知します。
+func (s *Server) announceResolvedSession(session model.SessionResult) {
+	s.logger.Info("ready check resolved", "session_id", session.SessionID, "mode", session.GameMode, "status", session.Status)
+	logged := make(map[string]bool)
+	for _, p := range session.Participants {
+		if key := store.ParticipantEntryKey(p); p.Requeued && !logged[key] {
+			logged[key] = true
+			s.logger.Info("requeued after aborted session", "entry", key, "session_id", session.SessionID, "mode", session.GameMode)
+		}
+	}
+	for _, p := range session.Participants {
+		if err := s.notifier.Publish(sessionPlayerKey(session.SessionID, p.ID), session); err != nil {
+			s.logger.Error("承諾結果通知エラー", "func", "announceResolvedSession", "session_id", session.SessionID, "player_id", p.ID, "error", err)
+		}
+	}
+}
+
+func init() {
+	// 確定済み（active）のセッションから players.games_played を再計算する。対戦数の記録を始める前のセッションも反映される。
+	registerBackfill("games_played", func(ctx context.Context, st store.Store, cursor string, limit int) (string, int, error) {
+		return st.BackfillGamesPlayed(ctx, cursor, limit)
+	})
+}
+
+// acceptHandler は参加者の承諾を記録し、セッションの状態が確定するまで待機して結果を返します。
+func (s *Server) acceptHandler(w http.ResponseWriter, r *http.Request) {
+	s.readyCheckHandler(w, r, model.ReadyAccepted)
+}
+
+// declineHandler は参加者の辞退を記録し、セッションを中止して結果を返します。
+func (s *Server) declineHandler(w http.ResponseWriter, r *http.Request) {
+	s.readyCheckHandler(w, r, model.ReadyDeclined)
+}
+
+// readyCheckHandler は承諾・辞退リクエストの共通処理です。
+func (s *Server) readyCheckHandler(w http.ResponseWriter, r *http.Request, state string) {
+	var req readyCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, errCodeInvalidRequest, "Invalid request")
+		return
+	}
+	playerID, err := authorizedPlayerID(r.Context(), req.PlayerID)
+	if err != nil {
+		writePlayerMismatch(w)
+		return
+	}
+	if req.PlayerID = playerID; req.PlayerID == "" {
+		writeJSONError(w, http.StatusBadRequest, errCodeInvalidRequest, "Invalid request")
+		return
+	}
+	sessionID := r.PathValue("id")
+	if err := model.SessionID(sessionID).Validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, errCodeInvalidSessionID, "Invalid session id")
+		return
+	}
+
+	// 状態の確定を取りこぼさないよう、記録する前に通知を購読しておく
+	key := sessionPlayerKey(sessionID, req.PlayerID)
+	resultChan, err := s.notifier.Subscribe(key)
+	if errors.Is(err, model.ErrAlreadyQueued) {
+		writeJSONError(w, http.StatusConflict, errCodeReadyCheckInProgress, "Ready check already in progress for this player")
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "通知購読エラー", "func", "readyCheckHandler", "session_id", sessionID, "player_id", req.PlayerID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("readycheck").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to record ready check")
+		return
+	}
+	defer s.notifier.Unsubscribe(key, resultChan)
+
+	session, resolved, err := s.resolveReadyCheckOnce(r.Context(), sessionID, req.PlayerID, state)
+	if err == nil && state == model.ReadyDeclined {
+		metrics.MatchmakingCancellations.Inc()
+		s.Events.CancelSession(session, []string{req.PlayerID}, "declined", s.now())
+		// この辞退でセッションを中止した場合のみクールダウンを設定する（再送や既に中止されていたセッションへの辞退、結果を届けられなかった場合の辞退は対象外）
+		if resolved && session.Status == model.SessionAborted {
+			// 辞退の応答を待たずにクライアントが切断しても記録するよう、リクエストのキャンセルを引き継がない
+			s.applyCooldown(context.WithoutCancel(r.Context()), session, req.PlayerID, cooldownDeclined)
+		}
+	}
+	if errors.Is(err, model.ErrSessionNotFound) {
+		writeJSONError(w, http.StatusNotFound, errCodeSessionNotFound, "Session not found")
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "承諾状態更新エラー", "func", "readyCheckHandler", "session_id", sessionID, "player_id", req.PlayerID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("readycheck").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to record ready check")
+		return
+	}
+
+	// 承諾待ちの場合は、他の参加者の承諾または承諾期限切れまで待機する
+	if session.Status == model.SessionPendingAccept {
+		wait := s.cfg.AcceptWindow
+		if session.AcceptDeadline != nil {
+			wait = session.AcceptDeadline.Sub(s.now()) + time.Second
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case session = <-resultChan:
+		case <-r.Context().Done():
+			// クライアントが切断した場合は期限まで待たずに購読を解除する（承諾・辞退は記録済み）
+			return
+		case <-timer.C:
+			// 期限切れ処理が別インスタンスで行われた場合に備えて、最新の状態を返す
+			if session, err = s.resolveReadyCheck(r.Context(), sessionID, "", ""); err != nil {
+				s.logger.ErrorContext(r.Context(), "セッション取得エラー", "func", "readyCheckHandler", "session_id", sessionID, "player_id", req.PlayerID, "error", err)
+				metrics.HandlerErrors.WithLabelValues("readycheck").Inc()
+				writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to get session")
+				return
+			}
+		}
+	}
+
+	if err := writeLongPollResponse(w, versionedSession(r.Context(), session)); err != nil {
+		s.logger.WarnContext(r.Context(), "承諾結果を配信できませんでした", "func", "readyCheckHandler", "session_id", sessionID, "player_id", req.PlayerID, "error", err)
+	}
+}
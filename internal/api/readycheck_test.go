@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// startReadyCheck は POST /sessions/{id}/{action}（accept または decline）を別の goroutine で送り、結果を返すチャネルを返します。
+func (ts *testServer) startReadyCheck(t *testing.T, sessionID, playerID, action string) <-chan *httptest.ResponseRecorder {
+	t.Helper()
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- serve(t, ts.Server, "POST", "/sessions/"+sessionID+"/"+action, map[string]string{"player_id": playerID}, nil)
+	}()
+	return done
+}
+
+// waitReadyState は参加者 playerID の承諾状態が state になるまで待ちます。
+func (ts *testServer) waitReadyState(t *testing.T, sessionID, playerID, state string) {
+	t.Helper()
+	waitFor(t, playerID+" "+state, func() bool {
+		session, err := ts.store.GetSession(context.Background(), sessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range session.Participants {
+			if p.ID == playerID {
+				return p.ReadyState == state
+			}
+		}
+		return false
+	})
+}
+
+// readyCheckResult は承諾・辞退のレスポンスのセッションを返します。
+func readyCheckResult(t *testing.T, done <-chan *httptest.ResponseRecorder) model.SessionResult {
+	t.Helper()
+	rec := receive(t, done)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var session model.SessionResult
+	decodeJSON(t, rec, &session)
+	return session
+}
+
+// requeued は参加者 playerID が待機キューへ戻されたかどうかを返します。
+func requeued(session model.SessionResult, playerID string) bool {
+	for _, p := range session.Participants {
+		if p.ID == playerID {
+			return p.Requeued
+		}
+	}
+	return false
+}
+
+func TestReadyCheckAcceptAccept(t *testing.T) {
+	ts := newTestServer(t, nil)
+	session := ts.matchPair(t, "alice", "bob")
+
+	alice := ts.startReadyCheck(t, session.SessionID, "alice", "accept")
+	ts.waitReadyState(t, session.SessionID, "alice", model.ReadyAccepted)
+	select {
+	case rec := <-alice:
+		t.Fatalf("alice's accept returned before bob accepted: %d %s", rec.Code, rec.Body)
+	default:
+	}
+	bob := readyCheckResult(t, ts.startReadyCheck(t, session.SessionID, "bob", "accept"))
+	if bob.Status != model.SessionActive {
+		t.Fatalf("bob's result = %q, want %q", bob.Status, model.SessionActive)
+	}
+	if got := readyCheckResult(t, alice); got.Status != model.SessionActive {
+		t.Fatalf("alice's result = %q, want %q", got.Status, model.SessionActive)
+	}
+}
+
+// 承諾期限までに承諾しなかった参加者がいるとセッションを中止し、承諾した参加者だけを待機キューへ戻す
+func TestReadyCheckAcceptTimeout(t *testing.T) {
+	ts := newTestServer(t, nil)
+	session := ts.matchPair(t, "alice", "bob")
+
+	alice := ts.startReadyCheck(t, session.SessionID, "alice", "accept")
+	ts.waitReadyState(t, session.SessionID, "alice", model.ReadyAccepted)
+	ts.clock.Advance(ts.cfg.AcceptWindow + time.Second)
+	ts.expireReadyCheck(session.SessionID)
+
+	got := readyCheckResult(t, alice)
+	if got.Status != model.SessionAborted {
+		t.Fatalf("alice's result = %q, want %q", got.Status, model.SessionAborted)
+	}
+	if !requeued(got, "alice") || requeued(got, "bob") {
+		t.Fatalf("participants = %+v, want only alice requeued", got.Participants)
+	}
+	if ids := ts.queuedIDs(t); len(ids) != 1 || ids[0] != "alice" {
+		t.Fatalf("queued = %v, want alice", ids)
+	}
+}
+
+// 辞退した参加者がいるとセッションを中止し、辞退していない参加者を待機キューへ戻す。後から承諾しても中止されたセッションを返す
+func TestReadyCheckDeclineAccept(t *testing.T) {
+	ts := newTestServer(t, nil)
+	session := ts.matchPair(t, "alice", "bob")
+
+	declined := readyCheckResult(t, ts.startReadyCheck(t, session.SessionID, "alice", "decline"))
+	if declined.Status != model.SessionAborted {
+		t.Fatalf("alice's decline = %q, want %q", declined.Status, model.SessionAborted)
+	}
+	if requeued(declined, "alice") || !requeued(declined, "bob") {
+		t.Fatalf("participants = %+v, want only bob requeued", declined.Participants)
+	}
+	if ids := ts.queuedIDs(t); len(ids) != 1 || ids[0] != "bob" {
+		t.Fatalf("queued = %v, want bob", ids)
+	}
+	if got := readyCheckResult(t, ts.startReadyCheck(t, session.SessionID, "bob", "accept")); got.Status != model.SessionAborted {
+		t.Fatalf("bob's accept = %q, want %q", got.Status, model.SessionAborted)
+	}
+}
+
+// 承諾期限とその期限切れ処理は ACCEPT_WINDOW の設定に従う
+func TestReadyCheckConfiguredAcceptWindow(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.AcceptWindow = 200 * time.Millisecond })
+	session := ts.matchPair(t, "alice", "bob")
+	if session.AcceptDeadline == nil || session.AcceptDeadline.Sub(ts.clock.Now()) != 200*time.Millisecond {
+		t.Fatalf("accept deadline = %v, want 200ms after %v", session.AcceptDeadline, ts.clock.Now())
+	}
+
+	// 既定の 10 秒ではなく設定した期限で期限切れ処理が実行される
+	start := time.Now()
+	alice := ts.startReadyCheck(t, session.SessionID, "alice", "accept")
+	if got := readyCheckResult(t, alice); got.Status != model.SessionAborted {
+		t.Fatalf("alice's result = %q, want %q", got.Status, model.SessionAborted)
+	}
+	// 応答側の待機（期限の 1 秒後）より前に、期限切れ処理のタイマーで中止されている
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("aborted after %v, want the 200ms expiry timer", elapsed)
+	}
+}
+
+// 承諾の結果を待つクライアントが切断すると、承諾期限まで待たずに購読を解除する
+func TestReadyCheckReturnsWhenClientDisconnects(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.AcceptWindow = 5 * time.Minute })
+	session := ts.matchPair(t, "alice", "bob")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("POST", "/sessions/"+session.SessionID+"/accept", strings.NewReader(`{"player_id":"alice"}`)).WithContext(ctx)
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		ts.Server.ServeHTTP(rec, req)
+		done <- rec
+	}()
+	ts.waitReadyState(t, session.SessionID, "alice", model.ReadyAccepted)
+	waitFor(t, "alice subscribed", func() bool { return ts.notifier.Len() == 1 })
+
+	cancel()
+	receive(t, done)
+	if n := ts.notifier.Len(); n != 0 {
+		t.Fatalf("subscriptions after disconnect = %d, want 0", n)
+	}
+}
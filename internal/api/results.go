@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/store"
+)
+
+func init() {
+	// 結果を報告したセッションから勝ち・負け・引き分けの数と相手ごとの対戦成績を再計算する。記録を始める前に報告した結果も反映される。
+	registerBackfill("wins_losses", func(ctx context.Context, st store.Store, cursor string, limit int) (string, int, error) {
+		return st.BackfillWinLoss(ctx, cursor, limit)
+	})
+	registerBackfill("head_to_head", func(ctx context.Context, st store.Store, cursor string, limit int) (string, int, error) {
+		return st.BackfillHeadToHead(ctx, cursor, limit)
+	})
+}
+
+// sessionResultRequest は POST /sessions/{id}/result のリクエストボディです。
+type sessionResultRequest struct {
+	// Outcome は対戦結果の種類（win / draw / cancelled）です。省略した場合は win です。
+	Outcome string `json:"outcome"`
+	// WinningTeam は outcome が win の場合に勝利したチームの番号（1 始まり）です。draw・cancelled では省略します。
+	WinningTeam int `json:"winning_team"`
+}
+
+// reportResult は確定済みのセッションに対戦結果を記録し、参加者のレーティングを Elo の式で更新して、更新後のセッションを返します。
+// 引き分け（draw）は全員のスコアを 0.5 とし、取り消し（cancelled）はレーティングを変更しません。outcome が空文字の場合は win です。
+// HTTP（POST /sessions/{id}/result）と gRPC（ReportResult）で共通の処理です。
+// セッションがない場合は ErrSessionNotFound、確定済みでない場合は store.ErrSessionNotActive、結果の種類やチームの番号が不正な場合は *model.FieldError を返します。
+func (s *Server) reportResult(ctx context.Context, sessionID, outcome string, winningTeam int) (model.SessionResult, error) {
+	if outcome == "" {
+		outcome = model.OutcomeWin
+	}
+	switch outcome {
+	case model.OutcomeWin:
+	case model.OutcomeDraw, model.OutcomeCancelled:
+		if winningTeam != 0 {
+			return model.SessionResult{}, &model.FieldError{Field: "winning_team", Message: fmt.Sprintf("winning_team must be omitted for a %s result", outcome)}
+		}
+	default:
+		return model.SessionResult{}, &model.FieldError{Field: "outcome", Message: fmt.Sprintf("outcome must be one of %s, %s, %s", model.OutcomeWin, model.OutcomeDraw, model.OutcomeCancelled)}
+	}
+	if err := model.SessionID(sessionID).Validate(); err != nil {
+		return model.SessionResult{}, model.ErrSessionNotFound
+	}
+	current, err := s.Store.GetSession(ctx, sessionID)
+	if err != nil {
+		return model.SessionResult{}, err
+	}
+	if outcome == model.OutcomeWin && !hasTeam(current, winningTeam) {
+		return model.SessionResult{}, &model.FieldError{Field: "winning_team", Message: fmt.Sprintf("winning_team %d is not a team of the session", winningTeam)}
+	}
+
+	report := store.SessionReport{SessionID: sessionID, Outcome: outcome, WinningTeam: winningTeam}
+	if outcome != model.OutcomeCancelled {
+		// 引き分けは winningTeam が 0 のため、全員のスコアが 0.5 になる
+		report.RatingChanges = func(session model.SessionResult) map[string]int {
+			return queue.ResultRatingChanges(session, winningTeam, s.cfg.Queue.PlacementMatches)
+		}
+	}
+	session, err := s.Store.RecordSessionResult(ctx, report)
+	if err != nil {
+		return model.SessionResult{}, err
+	}
+	s.leaderboard.invalidate()
+	s.logger.InfoContext(ctx, "session result reported", "session_id", sessionID, "mode", session.GameMode, "outcome", outcome, "winning_team", winningTeam)
+	details := map[string]interface{}{"outcome": outcome}
+	if winningTeam != 0 {
+		details["winning_team"] = winningTeam
+	}
+	s.auditSessions(ctx, auditActorSystem, auditResultReported, []model.SessionResult{session}, nil, details)
+	return session, nil
+}
+
+// hasTeam はセッションの参加者に team 番のチームがあるかどうかを返します。
+func hasTeam(session model.SessionResult, team int) bool {
+	for _, p := range session.Participants {
+		if p.Team == team {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionResultHandler はゲームサーバからの対戦結果の報告を記録し、レーティングを更新したセッションを返します。
+// 確定済みでない（承諾待ち・中止・終了した）セッションには 409 を返します。
+func (s *Server) sessionResultHandler(w http.ResponseWriter, r *http.Request) {
+	var req sessionResultRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+	sessionID := r.PathValue("id")
+	if err := model.SessionID(sessionID).Validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, errCodeInvalidSessionID, "Invalid session id")
+		return
+	}
+
+	session, err := s.reportResult(r.Context(), sessionID, req.Outcome, req.WinningTeam)
+	var fe *model.FieldError
+	switch {
+	case errors.Is(err, model.ErrSessionNotFound):
+		writeJSONError(w, http.StatusNotFound, errCodeSessionNotFound, "Session not found")
+		return
+	case errors.Is(err, store.ErrSessionNotActive):
+		writeJSONError(w, http.StatusConflict, errCodeSessionNotActive, "Results can only be reported for an active session")
+		return
+	case errors.As(err, &fe):
+		writeQueueEntryError(w, err)
+		return
+	case err != nil:
+		s.logger.ErrorContext(r.Context(), "対戦結果の記録エラー", "func", "sessionResultHandler", "session_id", sessionID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("result").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to record result")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(versionedSession(r.Context(), session)); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "sessionResultHandler", "session_id", sessionID, "error", err)
+	}
+}
+
+// headToHeadHandler はプレイヤー（{id}）から見た相手（{opponent_id}）との対戦成績を返します。
+func (s *Server) headToHeadHandler(w http.ResponseWriter, r *http.Request) {
+	playerID, opponentID := r.PathValue("id"), r.PathValue("opponent_id")
+	_, err := s.Store.GetPlayerProfile(r.Context(), playerID)
+	if errors.Is(err, store.ErrPlayerNotFound) {
+		writeJSONError(w, http.StatusNotFound, errCodePlayerNotFound, "Player not found")
+		return
+	}
+	var h model.HeadToHead
+	if err == nil {
+		h, err = s.Store.GetHeadToHead(r.Context(), playerID, opponentID)
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "対戦成績取得エラー", "func", "headToHeadHandler", "player_id", playerID, "opponent_id", opponentID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("head_to_head").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to get head-to-head record")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "headToHeadHandler", "player_id", playerID, "error", err)
+	}
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+)
+
+// activeSession は a と b をマッチングさせ、2人とも承諾した確定済みのセッションを返します。
+func (ts *testServer) activeSession(t *testing.T, a, b string) model.SessionResult {
+	t.Helper()
+	session := ts.matchPair(t, a, b)
+	for _, id := range []string{a, b} {
+		if _, err := ts.resolveReadyCheck(context.Background(), session.SessionID, id, model.ReadyAccepted); err != nil {
+			t.Fatal(err)
+		}
+	}
+	session, err := ts.store.GetSession(context.Background(), session.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Status != model.SessionActive {
+		t.Fatalf("session status = %q, want %q", session.Status, model.SessionActive)
+	}
+	return session
+}
+
+func TestSessionResultUpdatesRatings(t *testing.T) {
+	ts := newTestServer(t, nil)
+	session := ts.activeSession(t, "alice", "bob")
+	winner := session.Participants[0]
+	path := "/sessions/" + session.SessionID + "/result"
+
+	if rec := serve(t, ts.AdminHandler(), "POST", path, map[string]int{"winning_team": winner.Team}, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without admin secret: status %d, want 401", rec.Code)
+	}
+	if rec := serve(t, ts.AdminHandler(), "POST", path, map[string]int{"winning_team": 3}, adminHeader()); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown team: status %d, want 400: %s", rec.Code, rec.Body)
+	}
+
+	rec := serve(t, ts.AdminHandler(), "POST", path, map[string]int{"winning_team": winner.Team}, adminHeader())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var got model.SessionResult
+	decodeJSON(t, rec, &got)
+	if got.Status != model.SessionCompleted || got.WinningTeam != winner.Team {
+		t.Fatalf("status = %q, winning_team = %d, want completed and %d", got.Status, got.WinningTeam, winner.Team)
+	}
+	for _, p := range got.Participants {
+		profile, err := ts.store.GetPlayerProfile(context.Background(), p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := ratingOf(session, p.ID)
+		if p.Team == winner.Team && profile.Rating <= before || p.Team != winner.Team && profile.Rating >= before {
+			t.Errorf("%s (team %d) rating %d -> %d, want the winner up and the loser down", p.ID, p.Team, before, profile.Rating)
+		}
+		if p.Rating != profile.Rating {
+			t.Errorf("%s rating in response = %d, want the stored %d", p.ID, p.Rating, profile.Rating)
+		}
+	}
+
+	// 終了したセッションには報告し直せない
+	if rec := serve(t, ts.AdminHandler(), "POST", path, map[string]int{"winning_team": winner.Team}, adminHeader()); rec.Code != http.StatusConflict {
+		t.Fatalf("second report: status %d, want 409", rec.Code)
+	}
+	if rec := serve(t, ts.AdminHandler(), "POST", "/sessions/"+string(model.NewSessionID())+"/result", map[string]int{"winning_team": 1}, adminHeader()); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown session: status %d, want 404", rec.Code)
+	}
+}
+
+func TestSessionResultRequiresActiveSession(t *testing.T) {
+	ts := newTestServer(t, nil)
+	session := ts.matchPair(t, "alice", "bob")
+
+	rec := serve(t, ts.AdminHandler(), "POST", "/sessions/"+session.SessionID+"/result", map[string]int{"winning_team": 1}, adminHeader())
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("pending session: status %d, want 409: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestSessionResultDrawAndCancel(t *testing.T) {
+	for _, tc := range []struct {
+		outcome string
+		// want は alice（1450）と bob（1550）のレーティングの変化量です
+		wantAlice, wantBob int
+	}{
+		// 引き分けは Elo の式でスコア 0.5 とし、低い方が上がり高い方が下がる（32 × (0.5 − 0.36) ≒ 4）
+		{model.OutcomeDraw, 4, -4},
+		// 取り消しはレーティングを変更しない
+		{model.OutcomeCancelled, 0, 0},
+	} {
+		t.Run(tc.outcome, func(t *testing.T) {
+			ts := newTestServer(t, func(cfg *Config) { cfg.Queue.PlacementMatches = 0 })
+			for id, rating := range map[string]int{"alice": 1450, "bob": 1550} {
+				if _, _, err := ts.store.SetPlayerRating(context.Background(), id, rating); err != nil {
+					t.Fatal(err)
+				}
+			}
+			session := ts.activeSession(t, "alice", "bob")
+			path := "/sessions/" + session.SessionID + "/result"
+
+			if rec := serve(t, ts.AdminHandler(), "POST", path, map[string]interface{}{"outcome": tc.outcome, "winning_team": 1}, adminHeader()); rec.Code != http.StatusBadRequest {
+				t.Fatalf("%s with winning_team: status %d, want 400: %s", tc.outcome, rec.Code, rec.Body)
+			}
+			rec := serve(t, ts.AdminHandler(), "POST", path, map[string]string{"outcome": tc.outcome}, adminHeader())
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			var got model.SessionResult
+			decodeJSON(t, rec, &got)
+			if got.Status != model.SessionCompleted || got.Outcome != tc.outcome || got.WinningTeam != 0 {
+				t.Fatalf("status = %q, outcome = %q, winning_team = %d, want completed, %s and no winning team", got.Status, got.Outcome, got.WinningTeam, tc.outcome)
+			}
+			for id, want := range map[string]int{"alice": 1450 + tc.wantAlice, "bob": 1550 + tc.wantBob} {
+				profile, err := ts.store.GetPlayerProfile(context.Background(), id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if profile.Rating != want {
+					t.Errorf("%s rating = %d, want %d", id, profile.Rating, want)
+				}
+			}
+			stored, err := ts.store.GetSession(context.Background(), session.SessionID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Outcome != tc.outcome {
+				t.Errorf("stored outcome = %q, want %q", stored.Outcome, tc.outcome)
+			}
+		})
+	}
+}
+
+func TestSessionResultRejectsUnknownOutcome(t *testing.T) {
+	ts := newTestServer(t, nil)
+	session := ts.activeSession(t, "alice", "bob")
+	rec := serve(t, ts.AdminHandler(), "POST", "/sessions/"+session.SessionID+"/result", map[string]string{"outcome": "forfeit"}, adminHeader())
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown outcome: status %d, want 400: %s", rec.Code, rec.Body)
+	}
+}
+
+// ratingOf はセッションの参加者 id のレーティングを返します。
+func ratingOf(session model.SessionResult, id string) int {
+	for _, p := range session.Participants {
+		if p.ID == id {
+			return p.Rating
+		}
+	}
+	return 0
+}
+
+// 結果が報告されないまま SessionTTL を過ぎた確定済みのセッションは期限切れにし、保存期間を過ぎたら削除する（時計を進めて確認する）
+func TestSessionJanitorExpiresAndDeletes(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.SessionTTL = 2 * time.Hour
+		cfg.SessionRetention = 24 * time.Hour
+	})
+	ctx := context.Background()
+	session := ts.activeSession(t, "alice", "bob")
+	expired := testutil.ToFloat64(metrics.SessionsExpired)
+	status := func() string {
+		t.Helper()
+		got, err := ts.store.GetSession(ctx, session.SessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.Status
+	}
+
+	ts.sweepSessions(ctx, ts.now().Add(2*time.Hour-time.Second))
+	if got := status(); got != model.SessionActive {
+		t.Fatalf("status before the TTL = %q, want active", got)
+	}
+
+	ts.clock.Advance(2*time.Hour + time.Second)
+	ts.sweepSessions(ctx, ts.now())
+	if got := status(); got != model.SessionExpired {
+		t.Fatalf("status after the TTL = %q, want expired", got)
+	}
+	if got := testutil.ToFloat64(metrics.SessionsExpired) - expired; got != 1 {
+		t.Errorf("expired sessions counted = %v, want 1", got)
+	}
+	// 期限切れのセッションには結果を報告できない
+	rec := serve(t, ts.AdminHandler(), "POST", "/sessions/"+session.SessionID+"/result", map[string]int{"winning_team": 1}, adminHeader())
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("report on an expired session: status %d, want 409: %s", rec.Code, rec.Body)
+	}
+
+	// 保存期間（終了から 24 時間）を過ぎたら削除する
+	ts.sweepSessions(ctx, ts.now().Add(24*time.Hour-time.Second))
+	status()
+	ts.clock.Advance(24*time.Hour + time.Second)
+	ts.sweepSessions(ctx, ts.now())
+	if _, err := ts.store.GetSession(ctx, session.SessionID); !errors.Is(err, model.ErrSessionNotFound) {
+		t.Fatalf("GetSession after the retention = %v, want ErrSessionNotFound", err)
+	}
+}
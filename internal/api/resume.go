@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/secret"
+	"matchmaking_project/internal/store"
+)
+
+// resumeTokenHeader は long-poll の待機を再開するためのトークンを返すヘッダーです。
+const resumeTokenHeader = "X-Resume-Token"
+
+// ErrServerShutdown はサーバの停止によってリクエストの context がキャンセルされたことを表す原因です。
+var ErrServerShutdown = errors.New("server is shutting down")
+
+// resumeState は再開用のトークンに含める待機の状態です。待機キューの行は再起動後も残るため、行を探すためのキーと待機条件だけを持ちます。
+type resumeState struct {
+	PlayerID string `json:"player_id"`
+	// Key は Notifier 上のキー（QueueEntry.key）です。
+	Key      string `json:"key"`
+	GameMode string `json:"game_mode"`
+	// TimeoutSeconds はリクエストで指定された待機時間（秒）です。0 の場合はゲームモードの待機時間を使います。
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+// issueResumeToken は待機中のエントリの再開用のトークンを発行します。有効期限はエントリの有効期限です。
+// ResumeTokenKeys が nil の場合や、エントリに有効期限がない場合は空文字を返します。
+func (s *Server) issueResumeToken(e model.QueueEntry) string {
+	if s.cfg.ResumeTokenKeys == nil || e.ExpiresAt.IsZero() {
+		return ""
+	}
+	subject, err := json.Marshal(resumeState{
+		PlayerID:       e.Players[0].ID,
+		Key:            e.Key(),
+		GameMode:       e.GameMode,
+		TimeoutSeconds: int(e.Timeout / time.Second),
+	})
+	if err != nil {
+		return ""
+	}
+	return s.cfg.ResumeTokenKeys.IssueToken(string(subject), e.ExpiresAt)
+}
+
+// parseResumeToken は再開用のトークンの署名と有効期限を検証し、待機の状態を返します。
+func (s *Server) parseResumeToken(token string, now time.Time) (resumeState, error) {
+	if s.cfg.ResumeTokenKeys == nil {
+		return resumeState{}, secret.ErrInvalidSignature
+	}
+	subject, err := s.cfg.ResumeTokenKeys.VerifyToken(token, now)
+	if err != nil {
+		return resumeState{}, err
+	}
+	var state resumeState
+	if err := json.Unmarshal([]byte(subject), &state); err != nil || state.PlayerID == "" || state.Key == "" {
+		return resumeState{}, secret.ErrMalformedToken
+	}
+	return state, nil
+}
+
+// suspendedByShutdown は、サーバの停止で long-poll を終えたエントリを待機キューに残すかどうかを返します。
+// 再開用のトークンを返していれば、再起動後に GET /matchmaking/resume で待機を再開できるため残します。
+func suspendedByShutdown(ctx context.Context, resumeToken string) bool {
+	return resumeToken != "" && errors.Is(context.Cause(ctx), ErrServerShutdown)
+}
+
+// abandonReason は結果を待っているリクエストの context がキャンセルされた原因を、
+// matchmaking_waits_abandoned_total のラベルとログ・イベントの理由に使う文字列で返します。
+func abandonReason(ctx context.Context) (label, reason string) {
+	if errors.Is(context.Cause(ctx), ErrServerShutdown) {
+		return "server_shutdown", "server shutdown"
+	}
+	return "client_disconnected", "client disconnected"
+}
+
+// matchmakingResumeHandler は、サーバの再起動などで long-poll が中断されたクライアントの待機を、
+// 再開用のトークン（X-Resume-Token）から再開します。待機キューの行は残っているため、待機開始時刻（waiting_since）はそのままです。
+// 中断中にマッチングが成立していればそのセッションを返します。トークンが不正・期限切れの場合は 410 を返します。
+func (s *Server) matchmakingResumeHandler(w http.ResponseWriter, r *http.Request) {
+	state, err := s.parseResumeToken(r.URL.Query().Get("token"), s.now())
+	if err != nil {
+		writeJSONError(w, http.StatusGone, errCodeResumeTokenInvalid, "Resume token is invalid or expired; start a new search")
+		return
+	}
+	if _, err := authorizedPlayerID(r.Context(), state.PlayerID); err != nil {
+		writePlayerMismatch(w)
+		return
+	}
+
+	session, err := s.findMatchedSession(r.Context(), state.PlayerID, s.now())
+	switch {
+	case err == nil:
+		s.logger.InfoContext(r.Context(), "returned session matched while suspended", "entry", state.Key, "session_id", session.SessionID)
+		if err := writeLongPollResponse(w, versionedSession(r.Context(), session)); err != nil {
+			s.logger.WarnContext(r.Context(), "成立済みセッションの送信エラー", "func", "matchmakingResumeHandler", "session_id", session.SessionID, "error", err)
+		}
+		return
+	case !errors.Is(err, model.ErrSessionNotFound):
+		s.logger.WarnContext(r.Context(), "成立済みセッション確認エラー", "func", "matchmakingResumeHandler", "entry", state.Key, "error", err)
+	}
+
+	q, err := s.attachQueue(r.Context(), state.Key)
+	if errors.Is(err, store.ErrNotQueued) {
+		writeJSONError(w, http.StatusNotFound, errCodeNotQueued, "Player is no longer in the matchmaking queue; start a new search")
+		return
+	}
+	if errors.Is(err, model.ErrAlreadyQueued) {
+		// 中断前の接続がまだ残っている、または別のリクエストが既に待機を再開している
+		writeJSONError(w, http.StatusConflict, errCodeAlreadyQueued, model.ErrAlreadyQueued.Error())
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "待機再開エラー", "func", "matchmakingResumeHandler", "entry", state.Key, "error", err)
+		metrics.HandlerErrors.WithLabelValues("matchmaking").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to resume matchmaking")
+		return
+	}
+	defer q.close()
+	if q.Entry.GameMode != state.GameMode {
+		// 同じプレイヤーが別の条件で待機し直している
+		writeJSONError(w, http.StatusGone, errCodeResumeTokenInvalid, "Resume token is invalid or expired; start a new search")
+		return
+	}
+	q.Entry.Timeout = time.Duration(state.TimeoutSeconds) * time.Second
+
+	s.logger.InfoContext(r.Context(), "resumed matchmaking", "entry", q.Key, "mode", q.Entry.GameMode, "waiting_since", q.Entry.WaitingSince)
+	s.awaitMatch(w, r, q, s.matchmakingWait(q.Entry, s.now()))
+}
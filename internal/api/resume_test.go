@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+	"matchmaking_project/internal/secret"
+)
+
+// resumeServer は再開用のトークンを発行するサーバです。
+func resumeServer(t *testing.T) *testServer {
+	keys, err := secret.NewKeyRing("test-resume-token-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestServer(t, func(cfg *Config) {
+		cfg.ResumeTokenKeys = keys
+		cfg.PlayerRateLimit = ratelimit.Config{}
+	})
+}
+
+// suspend は alice の long-poll をサーバの停止で終わらせ、503 とともに返された再開用のトークンを返します。
+func (ts *testServer) suspend(t *testing.T) string {
+	t.Helper()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	done := ts.startEnqueueContext(t, ctx, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	cancel(ErrServerShutdown)
+
+	rec := receive(t, done)
+	if code := errorShape(t, rec, http.StatusServiceUnavailable); code != errCodeCancelled {
+		t.Fatalf("code = %q, want %q", code, errCodeCancelled)
+	}
+	var resp struct {
+		Error ErrorDetail `json:"error"`
+	}
+	decodeJSON(t, rec, &resp)
+	token := rec.Header().Get(resumeTokenHeader)
+	if token == "" || resp.Error.Details["resume_token"] != token {
+		t.Fatalf("resume token header %q, details %v, want the same token in both", token, resp.Error.Details)
+	}
+	return token
+}
+
+// サーバの停止で中断した待機は待機キューに残り、再開用のトークンで待機開始時刻を保ったまま再開できる
+func TestResumeAfterRestart(t *testing.T) {
+	ts := resumeServer(t)
+	token := ts.suspend(t)
+	if ids := ts.queuedIDs(t); !slices.Equal(ids, []string{"alice"}) {
+		t.Fatalf("queued = %v, want alice kept for the resume", ids)
+	}
+
+	ts.clock.Advance(20 * time.Second)
+	alice := make(chan *httptest.ResponseRecorder, 1)
+	go func() { alice <- ts.do(t, "GET", "/matchmaking/resume?token="+token, nil, nil) }()
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	waitFor(t, "alice to resume", func() bool { return ts.tick(t).Matched == 1 })
+
+	var sessions []model.SessionResult
+	for _, done := range []<-chan *httptest.ResponseRecorder{alice, bob} {
+		rec := receive(t, done)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var session model.SessionResult
+		decodeJSON(t, rec, &session)
+		sessions = append(sessions, session)
+	}
+	if sessions[0].SessionID == "" || sessions[0].SessionID != sessions[1].SessionID {
+		t.Fatalf("sessions = %q and %q, want alice and bob in the same session", sessions[0].SessionID, sessions[1].SessionID)
+	}
+	if got := sessions[0].MaxWaitSeconds; got != 20 {
+		t.Fatalf("max wait = %vs, want alice's 20s counted from before the restart", got)
+	}
+}
+
+// 不正・期限切れのトークンは 410 を返す
+func TestResumeRejectsInvalidToken(t *testing.T) {
+	ts := resumeServer(t)
+	token := ts.suspend(t)
+
+	forger, err := secret.NewKeyRing("not-the-server-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := forger.IssueToken(`{"player_id":"alice","key":"alice","game_mode":"duel"}`, ts.now().Add(time.Hour))
+	for name, tok := range map[string]string{"missing": "", "malformed": "not-a-token", "forged": forged} {
+		rec := ts.do(t, "GET", "/matchmaking/resume?token="+tok, nil, nil)
+		if code := errorShape(t, rec, http.StatusGone); code != errCodeResumeTokenInvalid {
+			t.Errorf("%s token: code = %q, want %q", name, code, errCodeResumeTokenInvalid)
+		}
+	}
+
+	// トークンの有効期限はエントリの有効期限
+	ts.clock.Advance(ts.cfg.MaxEntryLifetime)
+	rec := ts.do(t, "GET", "/matchmaking/resume?token="+token, nil, nil)
+	if code := errorShape(t, rec, http.StatusGone); code != errCodeResumeTokenInvalid {
+		t.Fatalf("expired token: code = %q, want %q", code, errCodeResumeTokenInvalid)
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// registerPreflight は API のパスごとに、CORS の preflight（OPTIONS）へ 204 を返すルートを登録します。
+// メソッド付きのパターン（"GET /leaderboard" など）だけを登録したパスでは、OPTIONS が 405 になるためです。
+func (s *Server) registerPreflight(mux *http.ServeMux, paths ...string) {
+	// corsMiddleware は OPTIONS を次のハンドラへ渡さずに返す
+	preflight := s.corsMiddleware(http.NotFoundHandler())
+	for _, path := range paths {
+		mux.Handle(http.MethodOptions+" "+path, preflight)
+	}
+}
+
+// jsonRouteErrors は mux に該当するルートがない場合の 404 と、パスはあるがメソッドが登録されていない場合の 405 を、
+// Go の既定のテキストではなく ErrorResponse の JSON で返します。405 の Allow ヘッダーは mux が登録済みのパターンから求めたものです。
+func jsonRouteErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		// 該当するルートがない場合、mux.Handler はリダイレクト・404・405 のいずれかを返すハンドラを返す
+		rec := &routeErrorRecorder{header: make(http.Header)}
+		h.ServeHTTP(rec, r)
+		switch rec.status {
+		case http.StatusNotFound:
+			writeJSONError(w, http.StatusNotFound, errCodeNotFound, "No route for "+r.URL.Path)
+		case http.StatusMethodNotAllowed:
+			allow := rec.header.Get("Allow")
+			w.Header().Set("Allow", allow)
+			writeErrorResponse(w, http.StatusMethodNotAllowed, ErrorDetail{
+				Code:    errCodeMethodNotAllowed,
+				Message: "Method " + r.Method + " is not allowed for " + r.URL.Path,
+				Details: map[string]interface{}{"allowed_methods": strings.Split(allow, ", ")},
+			})
+		default:
+			// 末尾のスラッシュの補完などのリダイレクトはそのまま返す
+			for k, v := range rec.header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(rec.status)
+		}
+	})
+}
+
+// routeErrorRecorder は mux の既定の 404・405 ハンドラのステータスとヘッダーを記録します（ボディは捨てます）。
+type routeErrorRecorder struct {
+	header http.Header
+	status int
+}
+
+func (r *routeErrorRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *routeErrorRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *routeErrorRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return len(b), nil
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// 登録していないメソッドには、登録済みのメソッドを Allow ヘッダーと details に入れた JSON の 405 を返す
+func TestMethodNotAllowed(t *testing.T) {
+	ts := newTestServer(t, nil)
+	for _, tc := range []struct {
+		name   string
+		h      http.Handler
+		method string
+		path   string
+		allow  string
+	}{
+		{"matchmaking", ts.Server, "GET", "/matchmaking", "OPTIONS, POST"},
+		{"leaderboard", ts.Server, "DELETE", "/leaderboard", "GET, HEAD, OPTIONS"},
+		{"session accept", ts.Server, "GET", "/sessions/s1/accept", "OPTIONS, POST"},
+		{"admin queue", ts.AdminHandler(), "PATCH", "/admin/queue", "GET, HEAD"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(t, tc.h, tc.method, tc.path, nil, adminHeader())
+			if code := errorShape(t, rec, http.StatusMethodNotAllowed); code != errCodeMethodNotAllowed {
+				t.Fatalf("code = %q, want %q", code, errCodeMethodNotAllowed)
+			}
+			if got := rec.Header().Get("Allow"); got != tc.allow {
+				t.Errorf("Allow = %q, want %q", got, tc.allow)
+			}
+			var resp struct {
+				Error ErrorDetail `json:"error"`
+			}
+			decodeJSON(t, rec, &resp)
+			var methods []string
+			for _, m := range resp.Error.Details["allowed_methods"].([]interface{}) {
+				methods = append(methods, m.(string))
+			}
+			if !slices.Equal(methods, strings.Split(tc.allow, ", ")) {
+				t.Errorf("details.allowed_methods = %v, want %s", methods, tc.allow)
+			}
+		})
+	}
+}
+
+// 該当するルートがないパスには、Go の既定のテキストではなく JSON の 404 を返す
+func TestUnknownRouteNotFound(t *testing.T) {
+	ts := newTestServer(t, nil)
+	for _, h := range []http.Handler{ts.Server, ts.AdminHandler()} {
+		rec := serve(t, h, "GET", "/nope", nil, adminHeader())
+		if code := errorShape(t, rec, http.StatusNotFound); code != errCodeNotFound {
+			t.Fatalf("code = %q, want %q", code, errCodeNotFound)
+		}
+	}
+}
+
+// メソッド付きで登録した API のルートも、preflight（OPTIONS）には 405 ではなく 204 を返す
+func TestPreflightOnMethodRoutes(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.CORS.AllowedOrigins = []string{"https://game.example"} })
+	header := http.Header{"Origin": {"https://game.example"}, "Access-Control-Request-Method": {"GET"}}
+	for _, path := range []string{"/leaderboard", "/matchmaking", "/sessions/s1", "/players/alice/head-to-head/bob"} {
+		rec := ts.do(t, "OPTIONS", path, nil, header)
+		if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "https://game.example" {
+			t.Errorf("OPTIONS %s: status %d, Access-Control-Allow-Origin %q, want 204 with CORS headers", path, rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+		}
+	}
+}
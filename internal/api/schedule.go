@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+	_ "time/tzdata"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/store"
+)
+
+// modeClosedDetail は受付時間外のゲームモードのエラーの内容を返します。
+func modeClosedDetail(e *queue.ModeClosedError) ErrorDetail {
+	details := map[string]interface{}{"game_mode": e.Name}
+	if !e.NextOpen.IsZero() {
+		details["next_open_at"] = e.NextOpen.UTC()
+	}
+	return ErrorDetail{Code: errCodeModeClosed, Message: e.Error(), Details: details}
+}
+
+// writeModeClosed は待機中に受付時間が終わり、待機キューから削除されたリクエストへ 409 を返します。
+func (s *Server) writeModeClosed(w http.ResponseWriter, name string, now time.Time) {
+	next, _ := s.cfg.Queue.GameModes[name].Schedule.NextOpen(now)
+	writeErrorResponse(w, http.StatusConflict, modeClosedDetail(&queue.ModeClosedError{Name: name, NextOpen: next}))
+}
+
+// gameModeStatuses は now の時点のすべてのゲームモードの受付状況を名前順に返します。
+func (s *Server) gameModeStatuses(now time.Time) []queue.GameModeStatus {
+	statuses := make([]queue.GameModeStatus, 0, len(s.cfg.Queue.GameModes))
+	for _, name := range s.cfg.Queue.GameModes.Names() {
+		mode := s.cfg.Queue.GameModes[name]
+		st := queue.GameModeStatus{Name: name, LobbySize: mode.LobbySize, Teams: mode.TeamCount(), RatingWindow: mode.RatingWindow,
+			TimeoutSeconds: int(s.matchmakingWait(model.QueueEntry{GameMode: name}, now) / time.Second), Open: mode.Schedule.IsOpen(now), Scheduled: mode.Schedule != nil}
+		if mode.Schedule != nil {
+			st.TimeZone = mode.Schedule.Location.String()
+			if next, ok := mode.Schedule.NextOpen(now); ok && !st.Open {
+				next = next.UTC()
+				st.NextOpenAt = &next
+			}
+			if closes, ok := mode.Schedule.ClosesAt(now); ok {
+				closes = closes.UTC()
+				st.ClosesAt = &closes
+			}
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+// modesHandler はゲームモードの一覧と、受付時間の設定があるモードの受付状況を返します。
+func (s *Server) modesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(queue.ModesResponse{Modes: s.gameModeStatuses(s.now())}); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "modesHandler", "error", err)
+	}
+}
+
+// ModeScheduleCloser は別ゴルーチンで動作し、受付時間が終わったゲームモードのエントリを待機キューから削除します。
+// 受付時間の設定があるモードがない場合は何もしません。
+func (s *Server) ModeScheduleCloser(ctx context.Context) {
+	closedAt := make(map[string]time.Time)
+	ticker := time.NewTicker(queue.ModeScheduleCheckInterval)
+	defer ticker.Stop()
+	for {
+		s.closeScheduledModes(ctx, s.now(), closedAt)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeScheduledModes は now の時点で受付時間外のゲームモードについて、終了（またはこのインスタンスの起動）から
+// ModeCloseSweepWindow の間、待機キューのエントリを削除して結果を待っているリクエストへ mode_closed を通知します。
+// closedAt はモードごとに受付時間外になったことを確認した時刻で、受付時間内に戻ると削除します。
+func (s *Server) closeScheduledModes(ctx context.Context, now time.Time, closedAt map[string]time.Time) {
+	var closing []string
+	for name, mode := range s.cfg.Queue.GameModes {
+		if mode.Schedule.IsOpen(now) {
+			delete(closedAt, name)
+			continue
+		}
+		since, ok := closedAt[name]
+		if !ok {
+			since = now
+			closedAt[name] = now
+			s.logger.InfoContext(ctx, "game mode closed", "mode", name)
+		}
+		if now.Sub(since) <= queue.ModeCloseSweepWindow {
+			closing = append(closing, name)
+		}
+	}
+	if len(closing) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.TickTimeout)
+	defer cancel()
+	players, err := s.Store.ListQueuedPlayers(ctx)
+	if err != nil {
+		s.logger.WarnContext(ctx, "待機キュー取得エラー", "func", "closeScheduledModes", "error", err)
+		return
+	}
+	removed := make(map[string]bool)
+	for _, p := range players {
+		key := store.ParticipantEntryKey(model.Participant{Player: model.Player{ID: p.ID}, PartyID: p.PartyID})
+		if removed[key] || !slices.Contains(closing, p.GameMode) {
+			continue
+		}
+		removed[key] = true
+		if err := s.Store.DequeuePlayer(ctx, p.ID); err != nil {
+			s.logger.WarnContext(ctx, "待機キュー削除エラー", "func", "closeScheduledModes", "player_id", p.ID, "error", err)
+			continue
+		}
+		if err := s.notifier.Publish(key, model.SessionResult{GameMode: p.GameMode, Status: queue.SessionModeClosed}); err != nil {
+			s.logger.ErrorContext(ctx, "削除通知エラー", "func", "closeScheduledModes", "entry", key, "error", err)
+		}
+		metrics.ModeClosedRemovals.WithLabelValues(p.GameMode).Inc()
+		s.logger.InfoContext(ctx, "player removed from queue because the game mode closed", "entry", key, "mode", p.GameMode)
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// scheduledModes は duel と、schedule を設定した event のゲームモードを読み込みます。
+func scheduledModes(t *testing.T, schedule string) queue.Modes {
+	t.Helper()
+	modes, err := queue.LoadGameModes(writeGameModes(t, `{
+		"duel":  {"lobby_size": 2, "teams": 2},
+		"event": {"lobby_size": 2, "teams": 2, "schedule": `+schedule+`}
+	}`), time.Second, 120*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return modes
+}
+
+// 受付時間外のモードへの登録は次の受付開始時刻とともに 403 を返し、待機中に受付時間が終わったプレイヤーには mode_closed を返す
+func TestModeScheduleEnqueue(t *testing.T) {
+	// testEpoch は 2030-01-01 09:00（東京）
+	modes := scheduledModes(t, `{"time_zone": "Asia/Tokyo", "windows": [{"start": "09:00", "end": "10:00"}]}`)
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.Queue.GameModes = modes
+		cfg.PlayerRateLimit = ratelimit.Config{}
+	})
+	modeStatus := func(name string) queue.GameModeStatus {
+		t.Helper()
+		var resp queue.ModesResponse
+		decodeJSON(t, ts.do(t, "GET", "/modes", nil, nil), &resp)
+		for _, st := range resp.Modes {
+			if st.Name == name {
+				return st
+			}
+		}
+		t.Fatalf("mode %s is not listed: %+v", name, resp.Modes)
+		return queue.GameModeStatus{}
+	}
+	if st := modeStatus("event"); !st.Open || !st.Scheduled || st.TimeZone != "Asia/Tokyo" || st.ClosesAt == nil || !st.ClosesAt.Equal(testEpoch.Add(time.Hour)) {
+		t.Fatalf("event = %+v, want open until 10:00 Tokyo", st)
+	}
+
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice", "game_mode": "event"})
+	ts.waitQueued(t, 1)
+	ts.clock.Advance(time.Hour)
+	ts.closeScheduledModes(context.Background(), ts.now(), make(map[string]time.Time))
+	if code := errorShape(t, receive(t, alice), http.StatusConflict); code != errCodeModeClosed {
+		t.Fatalf("queued player: code = %q, want %q", code, errCodeModeClosed)
+	}
+	if ids := ts.queuedIDs(t); len(ids) != 0 {
+		t.Fatalf("queued = %v, want alice removed", ids)
+	}
+
+	nextOpen := testEpoch.Add(24 * time.Hour)
+	rec := ts.do(t, "POST", "/matchmaking", map[string]interface{}{"id": "bob", "game_mode": "event"}, nil)
+	if code := errorShape(t, rec, http.StatusForbidden); code != errCodeModeClosed {
+		t.Fatalf("closed mode: code = %q, want %q", code, errCodeModeClosed)
+	}
+	var resp struct {
+		Error ErrorDetail `json:"error"`
+	}
+	decodeJSON(t, rec, &resp)
+	if resp.Error.Details["next_open_at"] != nextOpen.Format(time.RFC3339) {
+		t.Fatalf("details = %v, want next_open_at %v", resp.Error.Details, nextOpen)
+	}
+	if st := modeStatus("event"); st.Open || st.NextOpenAt == nil || !st.NextOpenAt.Equal(nextOpen) {
+		t.Fatalf("event = %+v, want closed until %v", st, nextOpen)
+	}
+	if st := modeStatus("duel"); !st.Open || st.Scheduled {
+		t.Fatalf("duel = %+v, want always open", st)
+	}
+}
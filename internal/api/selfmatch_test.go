@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+)
+
+// selfMatcher は最初のエントリをそのエントリ自身と組み合わせる、誤った Matcher です。
+type selfMatcher struct{}
+
+func (selfMatcher) Match(entries []model.QueueEntry, _ time.Time, _ queue.MatchPolicy) []queue.Lobby {
+	if len(entries) == 0 {
+		return nil
+	}
+	return []queue.Lobby{{GameMode: entries[0].GameMode, Teams: [][]model.QueueEntry{{entries[0]}, {entries[0]}}}}
+}
+
+// Matcher がプレイヤー自身との組み合わせを返しても、セッションを作成せずにエントリを待機キューに残す
+func TestSelfPairingNeverCreatesSession(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.matcher = selfMatcher{}
+	ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+
+	rejected := testutil.ToFloat64(metrics.SelfMatchesRejected)
+	if cycle := ts.tick(t); cycle.Matched != 0 {
+		t.Fatalf("tick created %d sessions, want none for a self-pairing", cycle.Matched)
+	}
+	if got := testutil.ToFloat64(metrics.SelfMatchesRejected) - rejected; got != 1 {
+		t.Fatalf("self matches rejected = %v, want 1", got)
+	}
+	if ids := ts.queuedIDs(t); !slices.Equal(ids, []string{"alice", "bob"}) {
+		t.Fatalf("queued = %v, want alice and bob kept", ids)
+	}
+}
+
+// 待機キューには同じプレイヤーを2回登録できない（MySQL では player_id の主キー）
+func TestQueueRejectsDuplicatePlayer(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ctx := context.Background()
+	if _, err := ts.store.EnqueueEntry(ctx, waitingEntry(ts.now(), "alice", "", 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.store.EnqueueEntry(ctx, waitingEntry(ts.now(), "alice", "", 0)); !errors.Is(err, model.ErrAlreadyQueued) {
+		t.Fatalf("second entry = %v, want ErrAlreadyQueued", err)
+	}
+	if ids := ts.queuedIDs(t); !slices.Equal(ids, []string{"alice"}) {
+		t.Fatalf("queued = %v, want alice once", ids)
+	}
+}
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/store"
+)
+
+// selftestPendingKey は後片付けを確認できていない合成プレイヤーの ID（カンマ区切り）を記録する service_state のキーです。
+const selftestPendingKey = "selftest:pending"
+
+// SelftestTimeout はセルフテスト全体の制限時間です。
+const SelftestTimeout = 30 * time.Second
+
+// withoutSyntheticEntries は合成プレイヤーを含むエントリを除いたエントリを返します。
+func withoutSyntheticEntries(entries []model.QueueEntry) []model.QueueEntry {
+	var real []model.QueueEntry
+	for _, e := range entries {
+		synthetic := false
+		for _, p := range e.Players {
+			if model.IsSyntheticPlayer(p.ID) {
+				synthetic = true
+				break
+			}
+		}
+		if !synthetic {
+			real = append(real, e)
+		}
+	}
+	return real
+}
+
+// selftestStep はセルフテストの1ステップの結果です。
+type selftestStep struct {
+	Name       string  `json:"name"`
+	OK         bool    `json:"ok"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// selftestReport は --selftest の結果です。JSON で標準出力へ出力します。
+type selftestReport struct {
+	OK         bool           `json:"ok"`
+	Store      string         `json:"store"`
+	DurationMS float64        `json:"duration_ms"`
+	Steps      []selftestStep `json:"steps"`
+}
+
+// selftest は合成プレイヤーでマッチングの一連の流れを確認するシナリオです。
+type selftest struct {
+	srv     *Server
+	store   store.Store
+	report  *selftestReport
+	players []string
+	session string
+}
+
+// step は fn を実行して所要時間と結果を記録し、成功したかどうかを返します。
+func (t *selftest) step(name string, fn func() error) bool {
+	started := time.Now()
+	err := fn()
+	s := selftestStep{Name: name, OK: err == nil, DurationMS: float64(time.Since(started).Microseconds()) / 1000}
+	if err != nil {
+		s.Error = err.Error()
+		t.report.OK = false
+	}
+	t.report.Steps = append(t.report.Steps, s)
+	return err == nil
+}
+
+// RunSelftest は s.Store に対して合成プレイヤーの登録・待機・マッチング・承諾・対戦数の更新を確認し、作成したデータを削除します。
+// 前回のセルフテストの後片付けを確認できていない場合は、その削除を確認できるまで実行しません。
+func (s *Server) RunSelftest(ctx context.Context, storeKind string) (report selftestReport) {
+	started := time.Now()
+	report = selftestReport{OK: true, Store: storeKind}
+	t := &selftest{srv: s, store: s.Store, report: &report}
+	defer func() {
+		report.DurationMS = float64(time.Since(started).Microseconds()) / 1000
+	}()
+
+	if !t.step("preflight", func() error { return t.cleanupPending(ctx) }) {
+		return report
+	}
+
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		t.step("register", func() error { return err })
+		return report
+	}
+	for _, name := range []string{"a", "b"} {
+		t.players = append(t.players, model.SelftestPlayerPrefix+hex.EncodeToString(suffix)+"-"+name)
+	}
+	// データを作成する前に記録しておき、後片付けに失敗しても次回の preflight で削除できるようにする
+	if !t.step("register", func() error {
+		return t.store.SetServiceState(ctx, selftestPendingKey, strings.Join(t.players, ","))
+	}) {
+		return report
+	}
+
+	scenario := []struct {
+		name string
+		fn   func(context.Context) error
+	}{
+		{"enqueue", t.enqueue},
+		{"match", t.match},
+		{"verify_session", t.verifySession},
+		{"accept", t.accept},
+		{"verify_games_played", t.verifyGamesPlayed},
+	}
+	for _, s := range scenario {
+		if !t.step(s.name, func() error { return s.fn(ctx) }) {
+			break
+		}
+	}
+
+	// シナリオの途中で失敗しても後片付けは必ず行う
+	t.step("cleanup", func() error { return t.cleanup(ctx, t.players) })
+	return report
+}
+
+// cleanupPending は前回のセルフテストで後片付けを確認できなかった合成プレイヤーを削除します。
+func (t *selftest) cleanupPending(ctx context.Context) error {
+	pending, err := t.store.GetServiceState(ctx, selftestPendingKey)
+	if err != nil {
+		return err
+	}
+	if pending == "" {
+		return nil
+	}
+	if err := t.cleanup(ctx, strings.Split(pending, ",")); err != nil {
+		return fmt.Errorf("refusing to run: synthetic data from a previous run could not be removed: %v", err)
+	}
+	return nil
+}
+
+// cleanup は合成プレイヤーとその関連データを削除し、残っていないことを確認してから記録を消します。
+func (t *selftest) cleanup(ctx context.Context, players []string) error {
+	for _, id := range players {
+		if !model.IsSyntheticPlayer(id) {
+			return fmt.Errorf("refusing to delete non-synthetic player %q", id)
+		}
+	}
+	if err := t.store.DeletePlayers(ctx, players); err != nil {
+		return err
+	}
+
+	for _, id := range players {
+		if _, err := t.store.GetPlayerProfile(ctx, id); !errors.Is(err, store.ErrPlayerNotFound) {
+			return fmt.Errorf("player %s still exists after cleanup (err=%v)", id, err)
+		}
+	}
+	queued, err := t.store.ListQueuedPlayers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, q := range queued {
+		if model.IsSyntheticPlayer(q.ID) {
+			return fmt.Errorf("player %s is still queued after cleanup", q.ID)
+		}
+	}
+	if t.session != "" {
+		if _, err := t.store.GetSession(ctx, t.session); !errors.Is(err, model.ErrSessionNotFound) {
+			return fmt.Errorf("session %s still exists after cleanup (err=%v)", t.session, err)
+		}
+	}
+	return t.store.SetServiceState(ctx, selftestPendingKey, "")
+}
+
+// enqueue は合成プレイヤーをそれぞれソロで既定のゲームモードの待機キューへ登録します。
+func (t *selftest) enqueue(ctx context.Context) error {
+	for _, id := range t.players {
+		entry := model.QueueEntry{Players: []model.Player{{ID: id}}, GameMode: queue.DefaultGameMode, ExpiresAt: t.srv.now().Add(SelftestTimeout)}
+		if _, err := t.store.EnqueueEntry(ctx, entry); err != nil {
+			return fmt.Errorf("enqueue %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// match は合成プレイヤーのエントリのみを対象にマッチングを1回実行します。
+func (t *selftest) match(ctx context.Context) error {
+	own := make(map[string]bool, len(t.players))
+	for _, id := range t.players {
+		own[id] = true
+	}
+	now := t.srv.now()
+	sessions, err := t.store.CreateSessions(ctx, func(entries []model.QueueEntry, recent, _ model.OpponentSet) []model.SessionResult {
+		var mine []model.QueueEntry
+		for _, e := range entries {
+			if len(e.Players) == 1 && own[e.Players[0].ID] {
+				mine = append(mine, e)
+			}
+		}
+		var sessions []model.SessionResult
+		for _, l := range queue.FindLobbies(mine, now, queue.MatchPolicy{Modes: t.srv.cfg.Queue.GameModes}) {
+			sessions = append(sessions, t.srv.createSession(l, now))
+		}
+		return sessions
+	})
+	if err != nil {
+		return err
+	}
+	if len(sessions) != 1 {
+		return fmt.Errorf("expected 1 session, got %d", len(sessions))
+	}
+	t.session = sessions[0].SessionID
+	return nil
+}
+
+// verifySession は保存されたセッションが承諾待ちで、合成プレイヤーが別々のチームに割り当てられていることを確認します。
+func (t *selftest) verifySession(ctx context.Context) error {
+	session, err := t.store.GetSession(ctx, t.session)
+	if err != nil {
+		return err
+	}
+	if session.Status != model.SessionPendingAccept {
+		return fmt.Errorf("session status is %q, want %q", session.Status, model.SessionPendingAccept)
+	}
+	if len(session.Participants) != len(t.players) {
+		return fmt.Errorf("session has %d participants, want %d", len(session.Participants), len(t.players))
+	}
+	teams := make(map[int]bool)
+	for _, p := range session.Participants {
+		if !model.IsSyntheticPlayer(p.ID) {
+			return fmt.Errorf("session contains non-synthetic player %q", p.ID)
+		}
+		teams[p.Team] = true
+	}
+	if len(teams) != len(t.players) {
+		return fmt.Errorf("participants share a team")
+	}
+	return nil
+}
+
+// accept は合成プレイヤー全員の承諾を記録し、セッションが確定することを確認します。
+func (t *selftest) accept(ctx context.Context) error {
+	var session model.SessionResult
+	for _, id := range t.players {
+		var err error
+		if session, _, err = t.store.ResolveReadyCheck(ctx, t.session, id, model.ReadyAccepted); err != nil {
+			return fmt.Errorf("accept %s: %v", id, err)
+		}
+	}
+	if session.Status != model.SessionActive {
+		return fmt.Errorf("session status is %q after all accepted, want %q", session.Status, model.SessionActive)
+	}
+	return nil
+}
+
+// verifyGamesPlayed は確定したセッションが合成プレイヤーの対戦数に反映されたことを確認します。
+func (t *selftest) verifyGamesPlayed(ctx context.Context) error {
+	for _, id := range t.players {
+		profile, err := t.store.GetPlayerProfile(ctx, id)
+		if err != nil {
+			return err
+		}
+		if profile.GamesPlayed != 1 {
+			return fmt.Errorf("player %s has games_played=%d, want 1", id, profile.GamesPlayed)
+		}
+	}
+	return nil
+}
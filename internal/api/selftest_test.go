@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+)
+
+// selftestSteps は成功したステップの名前を順に返します。失敗したステップがあればテストを失敗させます。
+func selftestSteps(t *testing.T, report selftestReport) []string {
+	t.Helper()
+	var names []string
+	for _, s := range report.Steps {
+		if !s.OK {
+			t.Fatalf("step %s failed: %s", s.Name, s.Error)
+		}
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// checkNoSyntheticData は合成プレイヤーのデータと後片付けの記録が残っていないことを確認します。
+func checkNoSyntheticData(t *testing.T, st store.Store) {
+	t.Helper()
+	ctx := context.Background()
+	queued, err := st.ListQueuedPlayers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range queued {
+		if model.IsSyntheticPlayer(q.ID) {
+			t.Errorf("synthetic player %s is still queued", q.ID)
+		}
+	}
+	if pending, err := st.GetServiceState(ctx, selftestPendingKey); err != nil || pending != "" {
+		t.Errorf("pending cleanup = %q, %v, want none", pending, err)
+	}
+}
+
+func TestSelftestInMemory(t *testing.T) {
+	ts := newTestServer(t, nil)
+	report := ts.RunSelftest(context.Background(), "memory")
+	want := []string{"preflight", "register", "enqueue", "match", "verify_session", "accept", "verify_games_played", "cleanup"}
+	if got := selftestSteps(t, report); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("steps = %v, want %v", got, want)
+	}
+	if !report.OK || report.Store != "memory" {
+		t.Fatalf("report = %+v, want ok for the memory store", report)
+	}
+	checkNoSyntheticData(t, ts.store)
+}
+
+// MYSQL_TEST_DSN を指定した場合は MySQL に対してセルフテストを実行します（マイグレーションを適用します）。
+func TestSelftestMySQL(t *testing.T) {
+	dsn := os.Getenv("MYSQL_TEST_DSN")
+	if dsn == "" {
+		t.Skip("MYSQL_TEST_DSN is not set")
+	}
+	cfg := store.DefaultConfig()
+	cfg.DSN = dsn
+	st, err := store.NewMySQLStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	ts := newTestServer(t, nil)
+	ts.Store = st
+
+	report := ts.RunSelftest(context.Background(), "mysql")
+	selftestSteps(t, report)
+	if !report.OK {
+		t.Fatalf("report = %+v, want ok", report)
+	}
+	checkNoSyntheticData(t, st)
+}
+
+// failingCleanupStore は DeletePlayers を失敗させ、後片付けできない状態を再現します。
+type failingCleanupStore struct {
+	store.Store
+}
+
+func (failingCleanupStore) DeletePlayers(context.Context, []string) error {
+	return errors.New("delete failed")
+}
+
+// 後片付けを確認できなかった場合は、次の実行で削除を確認できるまでシナリオを実行しない
+func TestSelftestRefusesUntilCleanupVerified(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.Store = failingCleanupStore{Store: ts.store}
+
+	report := ts.RunSelftest(context.Background(), "memory")
+	last := report.Steps[len(report.Steps)-1]
+	if report.OK || last.Name != "cleanup" || last.OK {
+		t.Fatalf("report = %+v, want the cleanup step failed", report)
+	}
+	pending, err := ts.store.GetServiceState(context.Background(), selftestPendingKey)
+	if err != nil || pending == "" {
+		t.Fatalf("pending cleanup = %q, %v, want the synthetic players recorded", pending, err)
+	}
+
+	report = ts.RunSelftest(context.Background(), "memory")
+	if report.OK || len(report.Steps) != 1 || report.Steps[0].Name != "preflight" || !strings.Contains(report.Steps[0].Error, "refusing to run") {
+		t.Fatalf("report = %+v, want only the preflight refusing to run", report)
+	}
+
+	// 削除できるようになれば、前回の合成プレイヤーを削除してからシナリオを実行する
+	ts.Store = ts.store
+	report = ts.RunSelftest(context.Background(), "memory")
+	selftestSteps(t, report)
+	checkNoSyntheticData(t, ts.store)
+	for _, id := range strings.Split(pending, ",") {
+		if _, err := ts.store.GetPlayerProfile(context.Background(), id); !errors.Is(err, store.ErrPlayerNotFound) {
+			t.Errorf("leftover player %s = %v, want removed", id, err)
+		}
+	}
+}
+
+// クライアントは合成プレイヤーの ID を使えず、マッチングプロセッサーは合成プレイヤーを実際のプレイヤーとマッチングしない
+func TestSyntheticPlayersIsolated(t *testing.T) {
+	ts := newTestServer(t, nil)
+	rec := ts.do(t, "POST", "/matchmaking", map[string]string{"id": model.SelftestPlayerPrefix + "x"}, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("synthetic id from a client: status %d, want 400", rec.Code)
+	}
+
+	entries := []model.QueueEntry{
+		waitingEntry(testEpoch, "alice", "asia", 0),
+		waitingEntry(testEpoch, model.SelftestPlayerPrefix+"a", "asia", 0),
+	}
+	if got := withoutSyntheticEntries(entries); len(got) != 1 || got[0].Players[0].ID != "alice" {
+		t.Fatalf("entries = %+v, want only alice", got)
+	}
+}
@@ -0,0 +1,842 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+
+	"matchmaking_project/internal/lifecycle"
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/ratelimit"
+	"matchmaking_project/internal/store"
+	"matchmaking_project/internal/tracing"
+)
+
+// maxRequestBodySize は POST /matchmaking のリクエストボディの最大サイズです（パーティの全メンバーを含めても十分な大きさ）。
+const maxRequestBodySize = 16 << 10
+
+// matchmakingRequest は POST /matchmaking のリクエストボディです。
+// ソロの場合は id を、パーティの場合は party_id と players を指定します。
+// game_mode を省略した場合は DefaultGameMode で待機します。
+type matchmakingRequest struct {
+	ID string `json:"id"`
+	// Rating は以前のクライアントとの互換性のために受け付けますが、マッチングには DB のレーティングを使います。
+	// TRUST_CLIENT_RATING を有効にした場合のみ、この値でプレイヤーのレーティングを上書きします（ローカルでの検証用）。
+	Rating   int            `json:"rating"`
+	Region   string         `json:"region"`
+	GameMode string         `json:"game_mode"`
+	PartyID  string         `json:"party_id"`
+	Players  []model.Player `json:"players"`
+	// MaxLifetimeSeconds はクライアントが応答可能であり続ける最大時間（秒）です。省略時はサーバの上限を使います。
+	MaxLifetimeSeconds int `json:"max_lifetime_seconds,omitempty"`
+	// Priority はマッチングでの優先度（0〜MaxQueuePriority）です。省略時は 0 です。
+	Priority int `json:"priority,omitempty"`
+	// PingMS はソロのプレイヤーの ping（ミリ秒）です。パーティの場合は players の各メンバーに指定します。
+	PingMS int `json:"ping_ms,omitempty"`
+	// TimeoutSeconds はマッチング結果を待つ時間（秒）です。省略時はゲームモードの待機時間を使います。
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+	// KeepWaiting を true にすると、待機時間を過ぎても待機キューから削除せずに 200（status: searching）と poll_token を返します。
+	KeepWaiting bool `json:"keep_waiting,omitempty"`
+	// PollToken は前回のレスポンスで返された poll_token です。指定すると、待機開始時刻を保ったまま待機を続けます。
+	PollToken string `json:"poll_token,omitempty"`
+	// SelfReportedSkill はソロのプレイヤーが申告した腕前（SkillSeedRatings のキー）です。初めて参加する場合の初期レーティングに使います。
+	SelfReportedSkill string `json:"self_reported_skill,omitempty"`
+	// MinRating, MaxRating, MaxDelta は相手として受け入れるレーティング（パーティは平均）の範囲です。省略時は制限しません。
+	MinRating int `json:"min_rating,omitempty"`
+	MaxRating int `json:"max_rating,omitempty"`
+	MaxDelta  int `json:"max_delta,omitempty"`
+	// Preferences は相手とのレーティングの差の上限と待機時間の指定です（max_delta・timeout_seconds と同じ条件を preferences としてまとめて指定できます）。
+	Preferences *matchPreferences `json:"preferences,omitempty"`
+	// Attributes はソロのプレイヤーの属性です。パーティの場合は players の各メンバーに指定します。
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Force を true にすると、プレイヤー（パーティの場合はメンバー）が未終了のセッションに参加していても、そのセッションを放棄して登録します。
+	// 省略時は 409（already_in_session）を返します。
+	Force bool `json:"force,omitempty"`
+}
+
+// Server はハンドラとマッチングプロセッサーが共有する依存関係です。
+// http.Handler として API 全体（Config.MountAdmin の場合は管理用エンドポイントを含む）を提供します。
+type Server struct {
+	// Store はプレイヤー・待機キュー・セッションの保存先です。
+	Store store.Store
+	// notifier は待機中のエントリ（QueueEntry.key）へマッチ結果を通知する仕組みです。
+	notifier Notifier
+	// Expiries は承諾期限切れ処理のタイマーです。
+	Expiries *readyCheckExpiries
+	// Webhook はマッチングのイベント（既定は成立時のセッション）を送信する Webhook です。WEBHOOK_URL が未指定の場合は nil です（送信しない）。
+	Webhook *webhookSender
+	// matchWake は待機キューへの登録をマッチングプロセッサーへ知らせるチャネルです（バッファ1、wakeMatcher で送信）。
+	matchWake chan struct{}
+	// leaderboard は GET /leaderboard のページを保存するキャッシュです。
+	leaderboard *leaderboardCache
+	// matcher はマッチングプロセッサーがロビーを組むアルゴリズムです（MATCH_STRATEGY、既定は rating_window）。
+	matcher queue.Matcher
+	// audit は監査イベントの記録先です（既定は store）。
+	audit store.AuditLogger
+	// Events は分析用のイベントログです。EVENT_LOG が未指定の場合は nil です（記録しない）。
+	Events *EventLogger
+	// Allocator はマッチングの成立時にセッションのゲームサーバを割り当てる仕組みです（既定は割り当てない noopAllocator）。
+	Allocator SessionAllocator
+	// now は現在時刻を返す関数です（Config.Now）。マッチング・待機時間・期限の判定はこの時刻で行います（テストで時刻を固定するため）。
+	now func() time.Time
+	// started はサーバの生成時刻です（GET /version の uptime_seconds の起点）。
+	started time.Time
+
+	cfg    Config
+	logger *slog.Logger
+	// flags は機能フラグです（Config.Flags）。
+	flags *featureFlags
+	// enqueueSlots は待機キューへの登録の枠です（Config.MaxConcurrentEnqueues）。nil の場合は制限しません。
+	enqueueSlots *semaphore
+	// heartbeat はマッチングプロセッサーの稼働状況です。
+	heartbeat processorHeartbeat
+	// queueStats は GET /stats/stream などで公開する待機キューとマッチングの統計です。
+	queueStats *liveStats
+	// waitEstimates はキューごとの待機時間の推定値です。
+	waitEstimates *waitEstimator
+
+	// handler は ServeHTTP で使う API 全体の http.Handler です。
+	handler http.Handler
+}
+
+// NewServer は st に状態を保存し、matcher でロビーを組むサーバを生成します。
+// notifier はプロセス内の MemoryNotifier で、REDIS_ADDR が指定された場合は NotifierComponent で差し替えます。
+// NewServer(store.NewMemoryStore(store.DefaultConfig()), queue.RatingWindowMatcher{}, slog.Default(), DefaultConfig()) のように、
+// DB なしで API 全体の http.Handler を組み立てることもできます。
+func NewServer(st store.Store, matcher queue.Matcher, logger *slog.Logger, cfg Config) *Server {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	if cfg.Flags == nil {
+		cfg.Flags = NewFeatureFlags()
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	s := &Server{
+		Store:         st,
+		audit:         st,
+		notifier:      NewMemoryNotifier(),
+		matchWake:     make(chan struct{}, 1),
+		leaderboard:   newLeaderboardCache(cfg.LeaderboardCacheTTL, cfg.Now),
+		matcher:       matcher,
+		Allocator:     noopAllocator{},
+		now:           cfg.Now,
+		started:       cfg.Now(),
+		cfg:           cfg,
+		logger:        logger,
+		flags:         cfg.Flags,
+		enqueueSlots:  newSemaphore(cfg.MaxConcurrentEnqueues, metrics.EnqueuesInFlight),
+		queueStats:    newLiveStats(),
+		waitEstimates: newWaitEstimator(),
+	}
+	s.Expiries = newReadyCheckExpiries(s.expireReadyCheck)
+	var admin http.Handler
+	if cfg.MountAdmin {
+		admin = s.AdminRoutes()
+	}
+	s.handler = s.Routes(admin)
+	return s
+}
+
+// ServeHTTP は API 全体のルートでリクエストを処理します。
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// createSession は新しいセッションIDを生成して、参加者の承諾待ちのセッション結果を返します。
+// now はマッチングを決定した時刻で、マッチ品質スコアの算出と承諾期限の設定に使用します。
+func (s *Server) createSession(l queue.Lobby, now time.Time) model.SessionResult {
+	deadline := now.Add(s.cfg.AcceptWindow)
+	assessment := queue.AssessLobby(l, now)
+	session := model.SessionResult{
+		SessionID:      string(model.NewSessionID()),
+		GameMode:       l.GameMode,
+		Region:         l.Region(),
+		Status:         model.SessionPendingAccept,
+		AcceptDeadline: &deadline,
+		Quality:        queue.ComputeMatchQuality(assessment, queue.DefaultMatchQualityWeights),
+		RatingGap:      assessment.RatingGap,
+		WinProbability: assessment.WinProbability,
+		MaxWaitSeconds: assessment.MaxWait.Seconds(),
+		MinWaitSeconds: assessment.MinWait.Seconds(),
+	}
+	for i, team := range l.Teams {
+		for _, e := range team {
+			for _, p := range e.Players {
+				state := model.ReadyPending
+				if p.IsBot {
+					// ボットは承諾を待たない
+					state = model.ReadyAccepted
+				}
+				session.Participants = append(session.Participants, model.Participant{
+					Player:     p,
+					Team:       i + 1,
+					PartyID:    e.PartyID,
+					ReadyState: state,
+				})
+			}
+		}
+	}
+	session.SetHeadToHead()
+	session.SetBots()
+	s.cfg.MintMatchToken(&session, now)
+	return session
+}
+
+// processorMaxBackoff は DB エラーが続いた場合のマッチングプロセッサーの最大待機間隔です。
+const processorMaxBackoff = 30 * time.Second
+
+// MatchmakingProcessor は別ゴルーチンで動作し、DB上の待機プレイヤーを定期的にチェックしてマッチングを実施します。
+// 確認の間隔は processorScheduler が決めます。待機キューへの登録が通知された場合は、次の確認を待たずにマッチングします。
+// 待機キューが空の間は間隔を ProcessorMaxIdleInterval まで延ばし、DB エラーが続く場合は確認間隔を指数的に延ばします（その間は登録の通知でも確認しません）。
+func (s *Server) MatchmakingProcessor(ctx context.Context) {
+	sched := queue.NewProcessorScheduler(s.cfg.ProcessorInterval, s.cfg.Queue.ProcessorMaxIdleInterval, processorMaxBackoff, time.After)
+	var lastStart time.Time
+	for {
+		wait, _ := sched.Next()
+		s.heartbeat.beat(time.Now(), wait)
+		if !sched.Wait(ctx.Done(), s.matchWake) {
+			return
+		}
+
+		start := time.Now()
+		if !lastStart.IsZero() {
+			metrics.ProcessorLag.Set(start.Sub(lastStart).Seconds())
+		}
+		lastStart = start
+		tickCtx, cancel := context.WithTimeout(ctx, s.cfg.TickTimeout)
+		cycle, err := s.runMatchmaking(tickCtx)
+		timedOut := errors.Is(tickCtx.Err(), context.DeadlineExceeded)
+		cancel()
+		recovered := sched.Failures
+		sched.Observe(cycle, err)
+		if err != nil {
+			metrics.ProcessorCycleFailures.Inc()
+			level := slog.LevelWarn
+			if sched.Failures >= 3 {
+				level = slog.LevelError
+			}
+			// 期限切れの場合もトランザクションはロールバックされているため、次回に再試行する
+			s.logger.Log(context.Background(), level, "マッチング処理エラー", "func", "matchmakingProcessor", "consecutive_failures", sched.Failures, "timed_out", timedOut, "error", err)
+			continue
+		}
+		if recovered > 0 {
+			s.logger.Info("matchmaking processor recovered", "consecutive_failures", recovered)
+		}
+	}
+}
+
+// wakeMatcher はマッチングプロセッサーに待機キューへの登録を知らせます。
+// 既に通知済みで処理されていない場合は何もしないため、呼び出し元がブロックすることはありません。
+func (s *Server) wakeMatcher() {
+	select {
+	case s.matchWake <- struct{}{}:
+	default:
+	}
+}
+
+// newMatchPolicy は環境変数と機能フラグの設定から、マッチングの条件を返します。
+func (s *Server) newMatchPolicy(recent, blocked model.OpponentSet) queue.MatchPolicy {
+	policy := queue.MatchPolicy{RematchFallback: s.cfg.Queue.RematchFallback, ExpiryMargin: s.cfg.AcceptWindow, PriorityAgingCeiling: s.cfg.Queue.PriorityAgingCeiling,
+		RatingTiers: s.cfg.Queue.RatingTiers, TierSpillover: s.cfg.Queue.RatingTierSpillover, PingFallback: s.cfg.Queue.PingFallback, StarvationThreshold: s.cfg.Queue.StarvationThreshold, Blocked: blocked,
+		MatchAttributes: s.cfg.Queue.MatchAttributeKeys, PlacementMatches: s.cfg.Queue.PlacementMatches, Modes: s.cfg.Queue.GameModes}
+	if s.flags.enabled(flagCrossRegionMatching) {
+		policy.CrossRegionFallback = s.cfg.Queue.CrossRegionFallback
+	}
+	if s.flags.enabled(flagAvoidRematch) {
+		policy.RecentOpponents = recent
+	}
+	policy.BestPairing = s.flags.enabled(flagBestPairing)
+	return policy
+}
+
+// runMatchmaking は待機キューを1回確認し、成立したロビーのセッションを作成して待機中のエントリへ通知します。
+// 一時的な DB エラーの場合は TickRetry に従って再試行します（トランザクションはロールバックされているため、待機キューから組み直す）。
+// 確認した待機中のエントリの数と作成したセッションの数を返します（processorScheduler が次の確認までの間隔に使います）。
+func (s *Server) runMatchmaking(ctx context.Context) (queue.MatchCycle, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "matchmaking.tick")
+	defer span.End()
+	now := s.now()
+	var cycle queue.MatchCycle
+	var lobbies []queue.Lobby
+	// allocated は直前の plan でゲームサーバを割り当てたセッションです。保存できなかった場合に解放します。
+	var allocated []model.SessionResult
+	// waiting は直前の plan で確認した待機中のエントリです。保存できた場合に、成立したエントリを除いて queueStats に反映します。
+	// planned は plan を呼び出したかどうかです（別のインスタンスがマッチング中の場合などは呼び出されません）。
+	var waiting []model.QueueEntry
+	planned := false
+	plan := func(entries []model.QueueEntry, recent, blocked model.OpponentSet) []model.SessionResult {
+		// 再試行で組み直す場合、前回のトランザクションはロールバックされているため、割り当てたゲームサーバを解放する
+		s.releaseGameServers(allocated)
+		allocated = nil
+
+		// セルフテストの合成プレイヤーを実際のプレイヤーとマッチングしない
+		entries = withoutSyntheticEntries(entries)
+		cycle.Waiting = len(entries)
+		waiting, planned = entries, true
+		metrics.QueueDepth.Set(float64(len(model.EntriesPlayers(entries))))
+		metrics.WaitingSubscribers.Set(float64(s.notifier.Len()))
+
+		policy := s.newMatchPolicy(recent, blocked)
+		rng := rand.New(rand.NewPCG(uint64(now.UnixNano()), 0))
+		lobbies = s.planLiveLobbies(ctx, entries, func(entries []model.QueueEntry) []queue.Lobby {
+			lobbies := s.matcher.Match(entries, now, policy)
+			lobbies = append(lobbies, queue.FillWithBots(entries, lobbies, now, s.cfg.Queue.BotFillAfter, policy.ExpiryMargin, s.cfg.Queue.GameModes, s.cfg.Queue.BotProfiles, rng)...)
+			return queue.WithoutSelfMatches(lobbies)
+		})
+		s.logger.Debug("matchmaking tick", "waiting_entries", len(entries), "lobbies", len(lobbies))
+
+		sessions := make([]model.SessionResult, len(lobbies))
+		for i, l := range lobbies {
+			sessions[i] = s.createSession(l, now)
+		}
+		// ゲームサーバを割り当てられなかったロビーは作成せず、エントリを待機キューに残す
+		ok := s.allocateGameServers(ctx, sessions)
+		kept := lobbies[:0]
+		allocated = sessions[:0]
+		for i := range sessions {
+			if ok[i] {
+				kept = append(kept, lobbies[i])
+				allocated = append(allocated, sessions[i])
+			}
+		}
+		lobbies = kept
+		return allocated
+	}
+	var sessions []model.SessionResult
+	err := store.TickRetry.Do(ctx, func(ctx context.Context) error {
+		var err error
+		sessions, err = s.Store.CreateSessions(ctx, plan)
+		return err
+	})
+	if err != nil {
+		s.releaseGameServers(allocated)
+		return queue.MatchCycle{}, err
+	}
+	if planned {
+		s.queueStats.setQueue(waiting, lobbies, now)
+	}
+	s.announceLobbies(lobbies, sessions, now)
+	tracing.TraceMatchedLobbies(ctx, lobbies, sessions, now)
+	s.auditSessions(ctx, auditActorMatchmaker, auditMatched, sessions, nil, nil)
+	cycle.Matched = len(sessions)
+	return cycle, nil
+}
+
+// planLiveLobbies は plan で組んだロビーのうち、結果を待っているクライアント（通知の購読）がいないエントリを含むものを採用せず、
+// そのエントリを除いて組み直します。タイムアウト・切断の直後でまだ待機キューに残っているエントリや、中止されたセッションから戻され
+// 再接続を待っているエントリと組ませて、承諾されないセッションを作らないためです。除いたエントリは待機キューに残します。
+// 購読を確認できなかったエントリは、マッチングを止めないよう待っているものとみなします。
+func (s *Server) planLiveLobbies(ctx context.Context, entries []model.QueueEntry, plan func([]model.QueueEntry) []queue.Lobby) []queue.Lobby {
+	for {
+		lobbies := plan(entries)
+		absent := make(map[string]bool)
+		for _, l := range lobbies {
+			for _, e := range l.Entries() {
+				if e.IsBotEntry() {
+					continue
+				}
+				subscribed, err := s.notifier.Subscribed(ctx, e.Key())
+				if err != nil {
+					s.logger.Warn("購読確認エラー", "func", "planLiveLobbies", "entry", e.Key(), "error", err)
+					continue
+				}
+				if !subscribed {
+					absent[e.Key()] = true
+				}
+			}
+		}
+		if len(absent) == 0 {
+			return lobbies
+		}
+		metrics.AbsentEntriesSkipped.Add(float64(len(absent)))
+		s.logger.Debug("skipped queue entries with no waiting client", "entries", len(absent))
+		live := entries[:0:0]
+		for _, e := range entries {
+			if !absent[e.Key()] {
+				live = append(live, e)
+			}
+		}
+		entries = live
+	}
+}
+
+// announceLobbies は作成したセッション（sessions[i] が lobbies[i] に対応）の承諾期限を設定し、
+// 待機中のエントリへマッチング結果（承諾待ちのセッション）を通知します。now はマッチングを決定した時刻です。
+func (s *Server) announceLobbies(lobbies []queue.Lobby, sessions []model.SessionResult, now time.Time) {
+	var delivered []string
+	var history []store.QueueHistoryRecord
+	for i, l := range lobbies {
+		metrics.MatchesCreated.WithLabelValues(l.GameMode).Inc()
+		metrics.MatchQualityScore.WithLabelValues(l.GameMode).Observe(float64(sessions[i].Quality))
+		var waits []time.Duration
+		for _, e := range l.Entries() {
+			if e.IsBotEntry() {
+				continue
+			}
+			waits = append(waits, now.Sub(e.WaitingSince))
+			metrics.MatchWaitSeconds.Observe(now.Sub(e.WaitingSince).Seconds())
+			s.waitEstimates.Observe(l.GameMode, now.Sub(e.WaitingSince))
+			history = append(history, queueHistoryRecords(e, now, store.QueueOutcomeMatched)...)
+		}
+		s.queueStats.observeMatch(waits)
+		s.logger.Info("players matched", "session_id", sessions[i].SessionID, "mode", l.GameMode, "region", sessions[i].Region, "quality", sessions[i].Quality, "players", matchedPlayerLog(sessions[i], now))
+		s.Expiries.schedule(sessions[i].SessionID, s.cfg.AcceptWindow)
+		s.Webhook.enqueue(sessions[i], now)
+		s.Events.Match(sessions[i], now)
+	}
+	for i, ok := range s.publishSessions(sessions) {
+		if ok {
+			delivered = append(delivered, sessions[i].SessionID)
+		}
+	}
+	// 通知できなかった結果は NotificationOutbox が通知し直す
+	if len(delivered) > 0 {
+		s.markNotificationsDelivered(context.Background(), delivered)
+	}
+	s.recordQueueHistory(context.Background(), history)
+}
+
+// matchedPlayer はマッチング成立時のログに出力する参加者の情報です。
+type matchedPlayer struct {
+	ID          string  `json:"id"`
+	Rating      int     `json:"rating"`
+	Team        int     `json:"team"`
+	WaitSeconds float64 `json:"wait_seconds"`
+}
+
+// matchedPlayerLog はセッションの参加者ごとのレーティングと待機時間をログ出力用にまとめます。
+func matchedPlayerLog(s model.SessionResult, now time.Time) []matchedPlayer {
+	players := make([]matchedPlayer, len(s.Participants))
+	for i, p := range s.Participants {
+		players[i] = matchedPlayer{ID: p.ID, Rating: p.Rating, Team: p.Team, WaitSeconds: now.Sub(p.WaitingSince).Seconds()}
+	}
+	return players
+}
+
+// newQueueEntry はリクエストから待機キューに登録するエントリを生成します。
+// リクエストボディのレーティングは信用せず、プレイヤーIDと地域のみを使用します。
+func (s *Server) newQueueEntry(req matchmakingRequest) (model.QueueEntry, error) {
+	modeName, mode, err := s.cfg.Queue.GameModes.Lookup(req.GameMode)
+	if err != nil {
+		return model.QueueEntry{}, err
+	}
+	if err := queue.CheckModeOpen(modeName, mode, s.now()); err != nil {
+		return model.QueueEntry{}, err
+	}
+	lifetime, err := s.entryLifetime(req.MaxLifetimeSeconds)
+	if err != nil {
+		return model.QueueEntry{}, err
+	}
+	if req.Priority < 0 || req.Priority > model.MaxQueuePriority {
+		return model.QueueEntry{}, &model.FieldError{Field: "priority", Message: fmt.Sprintf("priority must be between 0 and %d", model.MaxQueuePriority)}
+	}
+	timeout, err := s.requestTimeout(req.TimeoutSeconds)
+	if err != nil {
+		return model.QueueEntry{}, err
+	}
+	ratingRange := model.RatingRange{Min: req.MinRating, Max: req.MaxRating, MaxDelta: req.MaxDelta}
+	if err := ratingRange.Validate(); err != nil {
+		return model.QueueEntry{}, err
+	}
+	entry := model.QueueEntry{PartyID: req.PartyID, Region: req.Region, GameMode: modeName, Priority: req.Priority, ExpiresAt: s.now().Add(lifetime), Timeout: timeout, KeepWaiting: req.KeepWaiting, RatingRange: ratingRange,
+		ReplaceSession: req.Force}
+	if req.PartyID == "" {
+		p := model.Player{ID: req.ID, Rating: req.Rating, PingMS: req.PingMS, SelfReportedSkill: req.SelfReportedSkill, Attributes: req.Attributes}
+		if err := p.Validate(s.cfg.RatingSeeds); err != nil {
+			return model.QueueEntry{}, err
+		}
+		entry.Players = []model.Player{{ID: p.ID, Rating: s.clientRating(p.Rating), Priority: req.Priority, PingMS: p.PingMS, SelfReportedSkill: p.SelfReportedSkill, RatingRange: ratingRange, Attributes: p.Attributes}}
+		return entry, nil
+	}
+
+	if len(req.Players) == 0 {
+		return model.QueueEntry{}, &model.FieldError{Field: "players", Message: "party must have at least one player"}
+	}
+	// パーティは分割せず同じチームに割り当てるため、チーム人数を超えるパーティは受け付けない
+	if len(req.Players) > mode.TeamSize() {
+		return model.QueueEntry{}, &model.FieldError{Field: "players", Message: fmt.Sprintf("party of %d players does not fit a team of %d in game mode %q", len(req.Players), mode.TeamSize(), modeName)}
+	}
+	if err := model.ValidateID("party_id", req.PartyID, "party id"); err != nil {
+		return model.QueueEntry{}, err
+	}
+	seen := make(map[string]bool, len(req.Players))
+	for i, p := range req.Players {
+		if err := p.Validate(s.cfg.RatingSeeds); err != nil {
+			var fe *model.FieldError
+			if errors.As(err, &fe) {
+				return model.QueueEntry{}, &model.FieldError{Field: fmt.Sprintf("players[%d].%s", i, fe.Field), Message: fe.Message}
+			}
+			return model.QueueEntry{}, err
+		}
+		if seen[p.ID] {
+			return model.QueueEntry{}, &model.FieldError{Field: fmt.Sprintf("players[%d].id", i), Message: fmt.Sprintf("duplicate party member %q", p.ID)}
+		}
+		seen[p.ID] = true
+		entry.Players = append(entry.Players, model.Player{ID: p.ID, Rating: s.clientRating(p.Rating), Priority: req.Priority, PingMS: p.PingMS, SelfReportedSkill: p.SelfReportedSkill, RatingRange: ratingRange, Attributes: p.Attributes})
+	}
+	if err := s.validatePartyAttributes(entry.Players); err != nil {
+		return model.QueueEntry{}, err
+	}
+	return entry, nil
+}
+
+// timeoutQueryParam はクエリパラメータ timeout_seconds を req に反映します。ボディで指定されている場合はそちらを優先します。
+func timeoutQueryParam(r *http.Request, req *matchmakingRequest) error {
+	v := r.URL.Query().Get("timeout_seconds")
+	if v == "" || req.TimeoutSeconds != 0 {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return &model.FieldError{Field: "timeout_seconds", Message: fmt.Sprintf("invalid timeout_seconds: %v", err)}
+	}
+	req.TimeoutSeconds = n
+	return nil
+}
+
+// matchmakingHandler は、プレイヤー（またはパーティ）の対戦開始リクエストを処理し、DBと in-memory の状態を更新します。
+func (s *Server) matchmakingHandler(w http.ResponseWriter, r *http.Request) {
+	var req matchmakingRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, errCodeRequestTooLarge, fmt.Sprintf("Request body must be at most %d bytes", maxRequestBodySize))
+			return
+		}
+		writeQueueEntryError(w, err)
+		return
+	}
+	if err := req.applyPreferences(s.cfg.Queue); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+	if err := timeoutQueryParam(r, &req); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+	if err := authorizeMatchmakingRequest(r.Context(), &req); err != nil {
+		writePlayerMismatch(w)
+		return
+	}
+	entry, err := s.newQueueEntry(req)
+	if err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+	if req.PollToken != "" && s.resumePoll(w, r, &entry, req.PollToken) {
+		return
+	}
+
+	// 成立の直後に接続が切れたクライアントの再送であれば、別の相手を探さずに成立済みのセッションを返す
+	// （force の場合は成立済みのセッションを放棄して別の相手を探す）
+	if s.flags.enabled(flagResumeMatchedSession) && !req.Force {
+		session, err := s.findMatchedSession(r.Context(), entry.Players[0].ID, s.now())
+		switch {
+		case err == nil:
+			s.logger.InfoContext(r.Context(), "returned already matched session", "entry", entry.Key(), "session_id", session.SessionID)
+			if err := writeLongPollResponse(w, versionedSession(r.Context(), session)); err != nil {
+				s.logger.WarnContext(r.Context(), "成立済みセッションの送信エラー", "func", "matchmakingHandler", "session_id", session.SessionID, "error", err)
+			}
+			return
+		case !errors.Is(err, model.ErrSessionNotFound):
+			// 確認できない場合は通常どおり待機キューへ登録する
+			s.logger.WarnContext(r.Context(), "成立済みセッション確認エラー", "func", "matchmakingHandler", "entry", entry.Key(), "error", err)
+		}
+	}
+
+	// マッチング結果の通知を購読して待機キューへ登録する（DB からレーティングを取得する）
+	// 既に待機中の場合は上書きせずに 409 を返す（先に待機している側を孤立させないため）
+	q, err := s.joinQueue(r.Context(), entry)
+	if errors.Is(err, model.ErrAlreadyQueued) {
+		writeJSONError(w, http.StatusConflict, errCodeAlreadyQueued, model.ErrAlreadyQueued.Error())
+		return
+	}
+	if errors.Is(err, store.ErrQueueFull) {
+		s.writeQueueFull(w)
+		return
+	}
+	if errors.Is(err, errEnqueueBusy) {
+		writeEnqueueBusy(w)
+		return
+	}
+	var banned *playerBannedError
+	if errors.As(err, &banned) {
+		writePlayerBanned(w, banned)
+		return
+	}
+	var cooldown *playerCooldownError
+	if errors.As(err, &cooldown) {
+		writePlayerCooldown(w, cooldown, s.now())
+		return
+	}
+	var inSession *store.ActiveSessionError
+	if errors.As(err, &inSession) {
+		writeActiveSession(w, inSession)
+		return
+	}
+	if err != nil {
+		if r.Context().Err() != nil {
+			// 登録中にクライアントが切断した（待機キューからは joinQueue で削除済み）
+			writeJSONError(w, http.StatusServiceUnavailable, errCodeCancelled, "Matchmaking was cancelled; retry")
+			return
+		}
+		s.logger.ErrorContext(r.Context(), "待機登録エラー", "func", "matchmakingHandler", "entry", entry.Key(), "error", err)
+		metrics.HandlerErrors.WithLabelValues("matchmaking").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to register waiting player")
+		return
+	}
+	defer q.close()
+	entry, key := q.Entry, q.Key
+
+	s.logger.InfoContext(r.Context(), "registered for matchmaking", "entry", key, "player_ids", model.PlayerIDs(entry.Players), "party_id", entry.PartyID, "mode", entry.GameMode, "region", entry.Region)
+
+	// 待機時間（既定は 30 秒。エントリの有効期限が先に来る場合はそれまで）、マッチング結果の通知を待つ
+	s.awaitMatch(w, r, q, s.softTimeoutWait(entry, s.matchmakingWait(entry, s.now()), s.now()))
+}
+
+// awaitMatch は long-poll でマッチング結果の通知を wait の間待ち、成立・タイムアウト・キャンセルのレスポンスを返します。
+// 再開用のトークンを発行できる場合は X-Resume-Token ヘッダーで返し、サーバの停止で待機を終えた場合はエントリを待機キューに残します。
+func (s *Server) awaitMatch(w http.ResponseWriter, r *http.Request, q *queueWaiter, wait time.Duration) {
+	entry, key := q.Entry, q.Key
+	setExpiryHeader(w, entry)
+	setTimeoutHeader(w, wait)
+	resumeToken := s.issueResumeToken(entry)
+	if resumeToken != "" {
+		w.Header().Set(resumeTokenHeader, resumeToken)
+	}
+	select {
+	case session := <-q.Matches:
+		if session.Status == sessionRemovedByAdmin {
+			// 待機キューからは削除済み
+			s.logger.InfoContext(r.Context(), "matchmaking removed by admin", "entry", key, "mode", entry.GameMode)
+			writeRemovedByAdmin(w)
+			return
+		}
+		if session.Status == sessionCancelled {
+			// 待機キューからは削除済み
+			s.logger.InfoContext(r.Context(), "matchmaking cancelled by request", "entry", key, "mode", entry.GameMode)
+			writeJSONError(w, http.StatusConflict, errCodeCancelled, "Matchmaking was cancelled by request")
+			return
+		}
+		if session.Status == queue.SessionModeClosed {
+			// 待機キューからは削除済み
+			s.logger.InfoContext(r.Context(), "matchmaking ended because the game mode closed", "entry", key, "mode", entry.GameMode)
+			s.writeModeClosed(w, entry.GameMode, s.now())
+			return
+		}
+		if err := writeLongPollResponse(w, versionedSession(r.Context(), session)); err != nil {
+			q.undeliverable(r.Context(), session, err)
+		}
+	case <-time.After(wait):
+		// keep_waiting の場合は上限まで、待機キューに残したまま再送を待つ
+		if s.keepSearching(r.Context(), w, q) {
+			return
+		}
+		// タイムアウト時、待機キューから削除（パーティ全体）する
+		q.leave(r.Context(), "timed out")
+		metrics.MatchmakingTimeouts.Inc()
+		s.queueStats.observeTimeout()
+		s.Events.Timeout(entry, s.now())
+		s.Webhook.enqueueEntry(webhookEventTimeout, entry, s.now())
+		s.logger.InfoContext(r.Context(), "matchmaking timed out", "entry", key, "mode", entry.GameMode)
+		s.writeTimeoutResponse(w, r, entry.GameMode)
+	case <-r.Context().Done():
+		if suspendedByShutdown(r.Context(), resumeToken) {
+			// 再起動後に GET /matchmaking/resume で待機開始時刻のまま再開できるよう、待機キューに残す
+			s.logger.InfoContext(r.Context(), "matchmaking suspended for restart", "entry", key, "mode", entry.GameMode)
+			writeErrorResponse(w, http.StatusServiceUnavailable, ErrorDetail{
+				Code:    errCodeCancelled,
+				Message: "Server is restarting; resume with the resume token",
+				Details: map[string]interface{}{"resume_token": resumeToken},
+			})
+			return
+		}
+		// クライアントの切断、またはサーバの停止。待機を続けても結果を受け取れないため、待機時間を待たずに待機キューから削除する
+		label, reason := abandonReason(r.Context())
+		q.leave(r.Context(), "cancelled")
+		metrics.MatchmakingAbandoned.WithLabelValues(label).Inc()
+		s.Events.Cancel(entry, reason, s.now())
+		s.logger.InfoContext(r.Context(), "matchmaking cancelled", "entry", key, "mode", entry.GameMode, "reason", reason, "waited_seconds", s.now().Sub(entry.WaitingSince).Seconds(), "cause", context.Cause(r.Context()))
+		// サーバの停止時はクライアントがまだ接続しているため、再試行を促す
+		writeJSONError(w, http.StatusServiceUnavailable, errCodeCancelled, "Matchmaking was cancelled; retry")
+	}
+}
+
+// writeQueueEntryError はリクエストの解析・検証エラーを 400 で返します。
+// 未知のゲームモードの場合は、クライアントが選び直せるよう有効なモードの一覧も返します。
+func writeQueueEntryError(w http.ResponseWriter, err error) {
+	var modeErr *queue.UnknownGameModeError
+	if errors.As(err, &modeErr) {
+		writeErrorResponse(w, http.StatusBadRequest, ErrorDetail{
+			Code:       errCodeUnknownGameMode,
+			Message:    modeErr.Error(),
+			ValidModes: modeErr.ValidModes,
+		})
+		return
+	}
+	var closedErr *queue.ModeClosedError
+	if errors.As(err, &closedErr) {
+		writeErrorResponse(w, http.StatusForbidden, modeClosedDetail(closedErr))
+		return
+	}
+	var fe *model.FieldError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		fe = &model.FieldError{Field: typeErr.Field, Message: err.Error()}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// DisallowUnknownFields のエラーは型を持たないため、メッセージからフィールド名を取り出す
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		fe = &model.FieldError{Field: field, Message: err.Error()}
+	}
+	if fe != nil || errors.As(err, &fe) {
+		details := map[string]interface{}{"field": fe.Field}
+		for k, v := range fe.Details {
+			details[k] = v
+		}
+		writeErrorResponse(w, http.StatusBadRequest, ErrorDetail{
+			Code:    errCodeInvalidRequest,
+			Message: "Invalid request: " + fe.Message,
+			Details: details,
+		})
+		return
+	}
+	writeJSONError(w, http.StatusBadRequest, errCodeInvalidRequest, "Invalid request: "+err.Error())
+}
+
+// playerResponse は GET /players/{id} で返すプレイヤー情報と、残りの配置戦の数です。
+type playerResponse struct {
+	model.PlayerProfile
+	PlacementMatchesRemaining int `json:"placement_matches_remaining"`
+}
+
+// playerHandler は、サーバ側で管理しているプレイヤー情報を返します。
+func (s *Server) playerHandler(w http.ResponseWriter, r *http.Request) {
+	profile, err := s.Store.GetPlayerProfile(r.Context(), r.PathValue("id"))
+	if errors.Is(err, store.ErrPlayerNotFound) {
+		writeJSONError(w, http.StatusNotFound, errCodePlayerNotFound, "Player not found")
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "プレイヤー取得エラー", "func", "playerHandler", "player_id", r.PathValue("id"), "error", err)
+		metrics.HandlerErrors.WithLabelValues("player").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to get player")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	resp := playerResponse{PlayerProfile: profile, PlacementMatchesRemaining: queue.PlacementMatchesRemaining(s.cfg.Queue.PlacementMatches, profile.GamesPlayed)}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "playerHandler", "player_id", profile.ID, "error", err)
+	}
+}
+
+// Routes は HTTP のルーティングを組み立てます。admin が nil でなければ、管理用エンドポイントも同じポートで公開します。
+func (s *Server) Routes(admin http.Handler) http.Handler {
+	mux := http.NewServeMux()
+
+	// ハンドラにCORSミドルウェアと認証を適用（preflight は認証せずに返す）
+	api := func(h http.HandlerFunc) http.Handler {
+		return s.corsMiddleware(s.playerAuthMiddleware(s.authMiddleware(h)))
+	}
+	// 待機の開始はリトライの繰り返しで DB に負荷がかかるため、API キーの認証の前にレート制限する
+	// （プレイヤーごとの制限にトークンのプレイヤー ID を使うため、プレイヤーの本人確認はその前に行う）
+	byIP := ratelimit.New(s.cfg.IPRateLimit, s.now)
+	byPlayer := ratelimit.New(s.cfg.PlayerRateLimit, s.now)
+	limited := func(h http.HandlerFunc) http.Handler {
+		return s.corsMiddleware(s.playerAuthMiddleware(s.rateLimitMiddleware(byIP, byPlayer, s.authMiddleware(h))))
+	}
+	// 再送された待機の開始を二重に登録しないよう、Idempotency-Key ごとに1回だけ処理する
+	mux.Handle("POST /matchmaking", limited(s.idempotentMiddleware(s.matchmakingHandler)))
+	mux.Handle("GET /matchmaking/stream", limited(s.matchmakingStreamHandler))
+	mux.Handle("GET /matchmaking/resume", limited(s.matchmakingResumeHandler))
+	mux.Handle("GET /matchmaking/status", api(s.queueStatusHandler))
+	mux.Handle("GET /matchmaking/result", api(s.matchResultHandler))
+	mux.Handle("GET /matchmaking/{player_id}/current", api(s.currentMatchHandler))
+	mux.Handle("DELETE /matchmaking/{player_id}/current", api(s.ackMatchResultHandler))
+	mux.Handle("GET /modes", api(s.modesHandler))
+	mux.Handle("GET /players/{id}", api(s.playerHandler))
+	mux.Handle("GET /players/{id}/head-to-head/{opponent_id}", api(s.headToHeadHandler))
+	mux.Handle("POST /players/{id}/blocks", api(s.blockPlayerHandler))
+	mux.Handle("DELETE /players/{id}/blocks/{other_id}", api(s.unblockPlayerHandler))
+	mux.Handle("GET /leaderboard", api(s.leaderboardHandler))
+	mux.Handle("GET /leaderboard/around/{player_id}", api(s.leaderboardAroundHandler))
+	mux.Handle("GET /sessions/{id}", api(s.sessionHandler))
+	// ゲームサーバから呼び出すため、プレイヤーの本人確認は行わない（API キーの認証のみ）
+	mux.Handle("GET /sessions/verify", s.authMiddleware(http.HandlerFunc(s.verifyMatchTokenHandler)))
+	mux.Handle("POST /sessions/{id}/accept", api(s.acceptHandler))
+	mux.Handle("POST /sessions/{id}/decline", api(s.declineHandler))
+	// ダッシュボード向けのため、プレイヤーの本人確認は行わない（API キーの認証のみ）
+	mux.Handle("GET /stats/stream", s.corsMiddleware(s.authMiddleware(http.HandlerFunc(s.statsStreamHandler))))
+	s.registerPreflight(mux, "/matchmaking", "/matchmaking/stream", "/matchmaking/resume", "/matchmaking/status", "/matchmaking/result",
+		"/matchmaking/{player_id}/current", "/modes", "/players/{id}", "/players/{id}/head-to-head/{opponent_id}",
+		"/players/{id}/blocks", "/players/{id}/blocks/{other_id}",
+		"/leaderboard", "/leaderboard/around/{player_id}", "/sessions/{id}", "/sessions/{id}/accept", "/sessions/{id}/decline", "/stats/stream")
+
+	// 管理用エンドポイント（共有シークレットで保護する）
+	if admin != nil {
+		mux.Handle("/admin/", admin)
+		mux.Handle("PUT /players/{id}/rating", admin)
+		mux.Handle("POST /sessions/{id}/noshow", admin)
+		mux.Handle("POST /sessions/{id}/result", admin)
+		mux.Handle("POST /sessions/{id}/spectators", admin)
+		mux.Handle("DELETE /sessions/{id}/spectators/{player_id}", admin)
+	}
+
+	// Prometheus のメトリクス（登録は main で行う）
+	mux.Handle("/metrics", promhttp.Handler())
+
+	// API の OpenAPI 3 の文書（認証の対象外にする）
+	mux.Handle("GET /openapi.json", s.corsMiddleware(http.HandlerFunc(s.openAPIHandler)))
+
+	// Kubernetes の probe 用エンドポイント（CORS・認証の対象外にする）
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", s.readyzHandler)
+
+	// デプロイされているビルドの確認用（認証の対象外にする）
+	mux.HandleFunc("GET /version", s.versionHandler)
+	return RequestIDMiddleware(RecoverMiddleware(s.BasePathMiddleware(apiVersionMiddleware(TracingMiddleware(jsonRouteErrors(mux))))))
+}
+
+// NotifierComponent はマッチ成立の通知方法を設定するコンポーネントを返します。
+// addr が指定されていれば Redis pub/sub で通知します（複数インスタンスでの運用向け）。
+func (s *Server) NotifierComponent(addr string) lifecycle.Component {
+	var client *redis.Client
+	return lifecycle.Component{
+		Name: "notifier",
+		Start: func(ctx context.Context) error {
+			if addr == "" {
+				return nil
+			}
+			client = redis.NewClient(redisNotifierOptions(addr))
+			if err := client.Ping(ctx).Err(); err != nil {
+				client.Close()
+				return fmt.Errorf("Redis接続エラー（%s）: %v", addr, err)
+			}
+			s.notifier = newRedisNotifier(client, s.logger)
+			return nil
+		},
+		Stop: func(context.Context) error {
+			if client == nil {
+				return nil
+			}
+			return client.Close()
+		},
+	}
+}
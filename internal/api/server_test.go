@@ -0,0 +1,109 @@
+package api
+
+import (
+	"net/http"
+	"runtime"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/queue"
+)
+
+func TestServerIsHandler(t *testing.T) {
+	var h http.Handler = newTestServer(t, nil)
+	rec := serve(t, h, "GET", "/healthz", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /healthz = %d, want 200", rec.Code)
+	}
+}
+
+func TestServersDoNotShareConfig(t *testing.T) {
+	duel := newTestServer(t, func(c *Config) {
+		modes, err := c.Queue.GameModes.Restrict([]string{"duel"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Queue.GameModes = modes
+	})
+	all := newTestServer(t, nil)
+
+	var got queue.ModesResponse
+	decodeJSON(t, duel.do(t, "GET", "/modes", nil, nil), &got)
+	if len(got.Modes) != 1 || got.Modes[0].Name != "duel" {
+		t.Fatalf("restricted server modes = %+v, want only duel", got.Modes)
+	}
+	decodeJSON(t, all.do(t, "GET", "/modes", nil, nil), &got)
+	if len(got.Modes) != len(queue.DefaultModes()) {
+		t.Fatalf("default server has %d modes, want %d", len(got.Modes), len(queue.DefaultModes()))
+	}
+}
+
+func TestVersionUsesBuildAndClock(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) {
+		c.Build = Build{Version: "v1.2.3", Commit: "abc", Time: "2030-01-01T00:00:00Z"}
+	})
+	ts.clock.Advance(90 * time.Second)
+
+	var got versionResponse
+	decodeJSON(t, ts.do(t, "GET", "/version", nil, nil), &got)
+	if got.Version != "v1.2.3" || got.Commit != "abc" || got.BuildTime != "2030-01-01T00:00:00Z" {
+		t.Errorf("version = %q commit = %q build time = %q, want v1.2.3 abc 2030-01-01T00:00:00Z", got.Version, got.Commit, got.BuildTime)
+	}
+	if got.GoVersion != runtime.Version() {
+		t.Errorf("go version = %q, want %q", got.GoVersion, runtime.Version())
+	}
+	if !got.StartedAt.Equal(testEpoch) || got.UptimeSeconds != 90 {
+		t.Errorf("started at %v, uptime = %d, want %v and 90", got.StartedAt, got.UptimeSeconds, testEpoch)
+	}
+}
+
+// -ldflags で埋め込まなかった値は "unknown" を返す（テストのバイナリには VCS の情報がない）
+func TestVersionDefaultsToUnknown(t *testing.T) {
+	ts := newTestServer(t, nil)
+	var got versionResponse
+	decodeJSON(t, ts.do(t, "GET", "/version", nil, nil), &got)
+	if got.Version != "unknown" || got.Commit != "unknown" || got.BuildTime != "unknown" || got.GoVersion == "" {
+		t.Errorf("version = %+v, want unknown build fields and the Go version", got)
+	}
+}
+
+func TestAdminRoutesMounting(t *testing.T) {
+	ts := newTestServer(t, nil)
+	if rec := ts.do(t, "GET", "/admin/queue", nil, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("without secret = %d, want 401", rec.Code)
+	}
+	if rec := ts.do(t, "GET", "/admin/queue", nil, adminHeader()); rec.Code != http.StatusOK {
+		t.Errorf("with secret = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	separate := newTestServer(t, func(c *Config) { c.MountAdmin = false })
+	if rec := separate.do(t, "GET", "/admin/queue", nil, adminHeader()); rec.Code != http.StatusNotFound {
+		t.Errorf("unmounted admin on API handler = %d, want 404", rec.Code)
+	}
+	if rec := serve(t, separate.AdminHandler(), "GET", "/admin/queue", nil, adminHeader()); rec.Code != http.StatusOK {
+		t.Errorf("AdminHandler = %d, want 200: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestBasePathFromConfig(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) { c.BasePath = "/mm" })
+	if rec := ts.do(t, "GET", "/mm/modes", nil, nil); rec.Code != http.StatusOK {
+		t.Errorf("GET /mm/modes = %d, want 200", rec.Code)
+	}
+	if rec := newTestServer(t, nil).do(t, "GET", "/mm/modes", nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /mm/modes without BASE_PATH = %d, want 404", rec.Code)
+	}
+}
+
+func TestBasePathExemptsProbesAndMetrics(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) { c.BasePath = "/mm" })
+	for _, path := range []string{"/healthz", "/readyz", "/metrics", "/mm/healthz", "/mm/metrics"} {
+		// /readyz はプロセッサーが起動していないため 503 を返すが、404 でなければルーティングは通っている
+		if rec := ts.do(t, "GET", path, nil, nil); rec.Code == http.StatusNotFound {
+			t.Errorf("GET %s = 404, want it to bypass BASE_PATH", path)
+		}
+	}
+	if rec := ts.do(t, "GET", "/modes", nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /modes without BASE_PATH = %d, want 404", rec.Code)
+	}
+}
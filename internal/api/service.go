@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+	"matchmaking_project/internal/tracing"
+)
+
+// queueWaiter は待機キューに登録したエントリと、そのエントリ宛てのマッチング結果を受け取るチャネルです。
+// long-poll・SSE など待機の方法（トランスポート）によらず、登録・待機・離脱の処理を共通にするために使います。
+// 使い終わったら close で購読を解除してください。
+type queueWaiter struct {
+	s *Server
+	// Entry は待機キューに登録したエントリです（レーティングは DB の値）。
+	Entry model.QueueEntry
+	// Key は Notifier 上のキー（QueueEntry.key）です。
+	Key string
+	// Matches はマッチング結果（または管理者による削除の通知）を受け取るチャネルです。
+	Matches <-chan model.SessionResult
+}
+
+// joinQueue はエントリ宛ての通知を購読してから、エントリを待機キューへ登録します。
+// 同じキーで待機中の場合、またはメンバーのいずれかが登録済みの場合は ErrAlreadyQueued を、
+// メンバーのいずれかが参加禁止中の場合は playerBannedError を、クールダウン中の場合は playerCooldownError を、未終了のセッションに参加している場合は ActiveSessionError を返します（entry.ReplaceSession の場合はそのセッションを放棄します）。
+// 登録中に ctx がキャンセルされた場合は、登録が完了していても待機キューから削除してからエラーを返すため、
+// 呼び出し側は ctx.Err() を確認してクライアントの切断として扱ってください。
+func (s *Server) joinQueue(ctx context.Context, entry model.QueueEntry) (*queueWaiter, error) {
+	// DB の操作（参加禁止の確認と登録）の間だけ枠を使う。結果を待つ間は枠を返す
+	if !s.enqueueSlots.acquire(ctx, enqueueSlotWait) {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("登録中にキャンセルされました: %w", context.Cause(ctx))
+		}
+		return nil, errEnqueueBusy
+	}
+	defer s.enqueueSlots.release()
+	if err := s.checkBans(ctx, entry, s.now()); err != nil {
+		return nil, err
+	}
+	if err := s.checkCooldowns(ctx, entry, s.now()); err != nil {
+		return nil, err
+	}
+	key := entry.Key()
+	// 先に購読しておき、登録直後に成立したマッチングの通知も受け取れるようにする
+	matchChan, err := s.notifier.Subscribe(key)
+	if err != nil {
+		return nil, err
+	}
+	// マッチングのスパンから登録リクエストのトレースをたどれるよう、スパンの文脈を待機キューに保存する
+	entry.TraceParent = tracing.InjectTraceParent(ctx)
+	// 待機時間の計算（推定待ち時間・長時間待機の救済・レーティングの範囲の拡大など）を全てアプリの時計で行うよう、待機開始時刻は DB の NOW() ではなくここで決める
+	// （poll_token の再送では、待機キューに残っている待機開始時刻を引き継ぐ）
+	if entry.WaitingSince.IsZero() {
+		entry.WaitingSince = s.now()
+	}
+	registered, err := s.Store.EnqueueEntry(ctx, entry)
+	if err != nil {
+		s.notifier.Unsubscribe(key, matchChan)
+		if ctx.Err() != nil {
+			// MySQL の登録はロールバックされるが、Redis の待機キューへの登録はキャンセルが届く前に完了していることがあるため、念のため削除する
+			if err := s.Store.DequeuePlayer(context.WithoutCancel(ctx), entry.Players[0].ID); err != nil {
+				s.logger.ErrorContext(ctx, "キャンセル時のDB削除エラー", "func", "joinQueue", "entry", key, "error", err)
+			}
+			metrics.MatchmakingCancellations.Inc()
+			s.logger.InfoContext(ctx, "matchmaking cancelled during enqueue", "entry", key, "reason", context.Cause(ctx))
+			return nil, fmt.Errorf("登録中にキャンセルされました: %w", context.Cause(ctx))
+		}
+		return nil, err
+	}
+	for _, session := range registered.Abandoned {
+		metrics.SessionsAbandoned.Inc()
+		s.logger.InfoContext(ctx, "session abandoned by re-enqueue", "entry", key, "session_id", session.SessionID, "mode", session.GameMode)
+		s.announceResolvedSession(session)
+		// force で登録し直してセッションを放棄したメンバーは、辞退と同じくクールダウンの対象にする
+		for _, p := range session.Participants {
+			if p.ReadyState == model.ReadyAbandoned {
+				s.applyCooldown(context.WithoutCancel(ctx), session, p.ID, cooldownAbandoned)
+			}
+		}
+	}
+	s.wakeMatcher()
+	now := s.now()
+	if registered.WaitingSince.IsZero() {
+		// 登録したエントリには待機開始時刻が含まれないため、登録を終えた時刻を待機開始とみなす（待機時間の記録用）
+		registered.WaitingSince = now
+	}
+	s.Events.Join(registered, now)
+	s.auditEntry(ctx, auditQueued, registered, nil)
+	s.Webhook.enqueueEntry(webhookEventEnqueue, registered, now)
+	return &queueWaiter{s: s, Entry: registered, Key: key, Matches: matchChan}, nil
+}
+
+// attachQueue は待機キューに残っているエントリ（key）宛ての通知を購読し直します。待機キューには登録しません。
+// サーバの再起動などで中断された待機を再開する場合に使います。待機キューにいない場合は ErrNotQueued を返します。
+func (s *Server) attachQueue(ctx context.Context, key string) (*queueWaiter, error) {
+	rows, err := s.Store.ListQueuedPlayers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("待機プレイヤー取得エラー: %v", err)
+	}
+	for _, e := range store.GroupQueueEntries(rows) {
+		if e.Key() != key {
+			continue
+		}
+		matchChan, err := s.notifier.Subscribe(key)
+		if err != nil {
+			return nil, err
+		}
+		// 購読していない間はマッチングされないため、購読した時点で起きた結果はすべて受け取れる
+		s.wakeMatcher()
+		return &queueWaiter{s: s, Entry: e, Key: key, Matches: matchChan}, nil
+	}
+	return nil, store.ErrNotQueued
+}
+
+// close は通知の購読を解除します。待機キューからは削除しません（マッチング済み・削除済みの場合に使います）。
+func (q *queueWaiter) close() {
+	q.s.notifier.Unsubscribe(q.Key, q.Matches)
+}
+
+// leave はクライアントが待機をやめた（切断・タイムアウト・有効期限切れ）場合に、
+// エントリ（パーティの場合はパーティ全体）を待機キューから削除し、待機履歴に記録します。購読の解除は close で行います。
+func (q *queueWaiter) leave(ctx context.Context, reason string) {
+	if err := q.s.Store.DequeuePlayer(context.WithoutCancel(ctx), q.Entry.Players[0].ID); err != nil {
+		slog.ErrorContext(ctx, "待機キュー削除エラー", "func", "leave", "entry", q.Key, "reason", reason, "error", err)
+	}
+	outcome := leaveOutcome(reason)
+	q.s.recordQueueHistory(ctx, queueHistoryRecords(q.Entry, q.s.now(), outcome))
+	if outcome == store.QueueOutcomeCancelled {
+		q.s.auditEntry(ctx, auditCancelled, q.Entry, map[string]interface{}{"reason": reason})
+	}
+}
+
+// undeliverable はマッチング結果をクライアントへ届けられなかった場合に呼び出します。
+// 受け取れなかったクライアントは承諾できないため、辞退として扱い相手を待機キューへ戻します。
+func (q *queueWaiter) undeliverable(ctx context.Context, session model.SessionResult, err error) {
+	metrics.MatchmakingCancellations.Inc()
+	q.s.Events.CancelSession(session, model.PlayerIDs(q.Entry.Players), "undeliverable", q.s.now())
+	slog.WarnContext(ctx, "マッチング結果を配信できませんでした", "func", "undeliverable", "entry", q.Key, "session_id", session.SessionID, "error", err)
+	if _, err := q.s.resolveReadyCheck(context.WithoutCancel(ctx), session.SessionID, q.Entry.Players[0].ID, model.ReadyDeclined); err != nil {
+		slog.ErrorContext(ctx, "配信失敗時の辞退処理エラー", "func", "undeliverable", "entry", q.Key, "session_id", session.SessionID, "error", err)
+	}
+}
+
+// sessionCancelled はプレイヤーが待機の取り消しを要求した（gRPC の Cancel）ことを、待機中のリクエストへ通知する際の SessionResult.Status です。
+// セッションの状態としては保存しません。
+const sessionCancelled = "cancelled"
+
+// cancelQueue はプレイヤー（パーティの場合はパーティ全体）を待機キューから削除し、結果を待っているリクエスト・ストリームへ取り消しを通知します。
+// 待機している接続とは別の経路から待機をやめる場合に使います。待機キューにいない場合は ErrNotQueued を返します。
+func (s *Server) cancelQueue(ctx context.Context, playerID string) error {
+	cancelled, err := s.dequeueAndNotify(ctx, playerID, sessionCancelled)
+	if err != nil {
+		return err
+	}
+	metrics.MatchmakingCancellations.Inc()
+	s.logger.InfoContext(ctx, "matchmaking cancelled by request", "player_id", playerID, "mode", cancelled.GameMode)
+	s.auditPlayer(ctx, "player:"+playerID, auditCancelled, playerID, dequeuedDetails(cancelled))
+	return nil
+}
@@ -0,0 +1,17 @@
+package api
+
+import (
+	"net/http"
+
+	"matchmaking_project/internal/store"
+)
+
+// writeActiveSession は未終了のセッションに参加しているプレイヤーのリクエストへ 409 を返します。
+// クライアントは details.session_id のセッションへ接続し直すか、force を指定してそのセッションを放棄してから登録し直します。
+func writeActiveSession(w http.ResponseWriter, e *store.ActiveSessionError) {
+	writeErrorResponse(w, http.StatusConflict, ErrorDetail{
+		Code:    errCodeAlreadyInSession,
+		Message: "Player is already in an unfinished session",
+		Details: map[string]interface{}{"player_id": e.PlayerID, "session_id": e.SessionID},
+	})
+}
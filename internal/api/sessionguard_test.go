@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// 未終了のセッションに参加しているプレイヤー（パーティのメンバーを含む）の登録は、そのセッションIDとともに 409 を返す
+func TestEnqueueRejectedWhileInSession(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.PlayerRateLimit = ratelimit.Config{} })
+	session := ts.matchPair(t, "alice", "bob")
+
+	for _, body := range []map[string]interface{}{
+		{"id": "alice"},
+		{"party_id": "p1", "game_mode": "2v2", "players": []map[string]string{{"id": "carol"}, {"id": "bob"}}},
+	} {
+		rec := ts.do(t, "POST", "/matchmaking", body, nil)
+		if code := errorShape(t, rec, http.StatusConflict); code != errCodeAlreadyInSession {
+			t.Fatalf("%v: code = %q, want %q", body, code, errCodeAlreadyInSession)
+		}
+		var resp struct {
+			Error ErrorDetail `json:"error"`
+		}
+		decodeJSON(t, rec, &resp)
+		if resp.Error.Details["session_id"] != session.SessionID {
+			t.Fatalf("%v: details = %v, want session %s", body, resp.Error.Details, session.SessionID)
+		}
+	}
+	if ids := ts.queuedIDs(t); len(ids) != 0 {
+		t.Fatalf("queued = %v, want nobody", ids)
+	}
+}
+
+// force を指定すると未終了のセッションを放棄して登録し、相手は待機キューへ戻る
+func TestEnqueueForceAbandonsSession(t *testing.T) {
+	ts := newTestServer(t, nil)
+	session := ts.matchPair(t, "alice", "bob")
+	abandoned := testutil.ToFloat64(metrics.SessionsAbandoned)
+
+	ts.startEnqueue(t, map[string]interface{}{"id": "alice", "force": true})
+	ts.waitQueued(t, 2)
+	if ids := ts.queuedIDs(t); !slices.Contains(ids, "alice") || !slices.Contains(ids, "bob") {
+		t.Fatalf("queued = %v, want alice and bob", ids)
+	}
+	got, err := ts.store.GetSession(t.Context(), session.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != model.SessionAborted {
+		t.Fatalf("status = %s, want aborted", got.Status)
+	}
+	for _, p := range got.Participants {
+		if p.ID == "alice" && p.ReadyState != model.ReadyAbandoned {
+			t.Fatalf("alice's ready state = %s, want abandoned", p.ReadyState)
+		}
+	}
+	if n := testutil.ToFloat64(metrics.SessionsAbandoned) - abandoned; n != 1 {
+		t.Fatalf("sessions abandoned = %v, want 1", n)
+	}
+}
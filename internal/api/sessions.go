@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+)
+
+// sessionHandler は保存済みのセッションを、成立時刻と参加者（現在のレーティングを含む）とともに返します。
+func (s *Server) sessionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("id")
+	if err := model.SessionID(sessionID).Validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, errCodeInvalidSessionID, "Invalid session id")
+		return
+	}
+
+	session, err := s.Store.GetSession(r.Context(), sessionID)
+	if errors.Is(err, model.ErrSessionNotFound) {
+		writeJSONError(w, http.StatusNotFound, errCodeSessionNotFound, "Session not found")
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "セッション取得エラー", "func", "sessionHandler", "session_id", sessionID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("session").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to get session")
+		return
+	}
+
+	// セッションIDを知っているだけの第三者にマッチトークンを渡さない
+	if id, ok := playerFrom(r.Context()); !ok || !slices.Contains(session.HumanPlayerIDs(), id) {
+		session.MatchToken = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(versionedSession(r.Context(), session)); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "sessionHandler", "error", err)
+	}
+}
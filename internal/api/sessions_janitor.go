@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+)
+
+// SessionJanitor は別ゴルーチンで動作し、定期的に sweepSessions を実行します。
+func (s *Server) SessionJanitor(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.SessionSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.sweepSessions(ctx, s.now())
+	}
+}
+
+// sweepSessions は now の時点で SessionTTL を過ぎた確定済みのセッションを期限切れにし、maxWaitStatsWindow より古い待機履歴を削除し、
+// SessionRetention が正であれば保存期間を過ぎた終了済みのセッションを削除します。
+func (s *Server) sweepSessions(ctx context.Context, now time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.TickTimeout)
+	defer cancel()
+
+	n, err := s.Store.ExpireSessions(ctx, now.Add(-s.cfg.SessionTTL))
+	if err != nil {
+		s.logger.Warn("セッション期限切れ処理エラー", "func", "sweepSessions", "error", err)
+		return
+	}
+	if n > 0 {
+		metrics.SessionsExpired.Add(float64(n))
+		s.logger.Info("sessions expired without a result", "sessions", n, "ttl", s.cfg.SessionTTL.String())
+	}
+
+	// 待機履歴は GET /admin/stats/waits で集計できる期間だけ残す
+	n, err = s.Store.DeleteQueueHistory(ctx, now.Add(-maxWaitStatsWindow))
+	if err != nil {
+		s.logger.Warn("待機履歴削除エラー", "func", "sweepSessions", "error", err)
+	} else if n > 0 {
+		s.logger.Info("queue history deleted", "records", n, "retention", maxWaitStatsWindow.String())
+	}
+
+	if s.cfg.SessionRetention <= 0 {
+		return
+	}
+	n, err = s.Store.DeleteEndedSessions(ctx, now.Add(-s.cfg.SessionRetention))
+	if err != nil {
+		s.logger.Warn("終了済みセッション削除エラー", "func", "sweepSessions", "error", err)
+		return
+	}
+	if n > 0 {
+		s.logger.Info("ended sessions deleted", "sessions", n, "retention", s.cfg.SessionRetention.String())
+	}
+}
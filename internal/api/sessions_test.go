@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"matchmaking_project/internal/model"
+)
+
+// 通知を受け取り損ねたクライアントは、保存済みのセッションを参加者のレーティングと成立時刻付きで取得し直せる
+func TestGetSession(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.seedRatings(t, map[string]int{"alice": 1540, "bob": 1500})
+	session := ts.activeSession(t, "alice", "bob")
+
+	rec := ts.do(t, "GET", "/sessions/"+session.SessionID, nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var got model.SessionResult
+	decodeJSON(t, rec, &got)
+	if got.SessionID != session.SessionID || got.Status != model.SessionActive || got.StartedAt == nil {
+		t.Fatalf("session = %+v, want the active session with its start time", got)
+	}
+	ratings := make(map[string]int)
+	for _, p := range got.Participants {
+		ratings[p.ID] = p.Rating
+	}
+	if len(ratings) != 2 || ratings["alice"] != 1540 || ratings["bob"] != 1500 {
+		t.Fatalf("participant ratings = %v, want alice 1540 and bob 1500", ratings)
+	}
+	if got.Player1 == nil || got.Player2 == nil {
+		t.Fatalf("player1, player2 = %v, %v, want both players", got.Player1, got.Player2)
+	}
+}
+
+func TestGetSessionNotFound(t *testing.T) {
+	ts := newTestServer(t, nil)
+	for _, tc := range []struct {
+		id     string
+		status int
+		code   string
+	}{
+		{string(model.NewSessionID()), http.StatusNotFound, errCodeSessionNotFound},
+		{"session-42", http.StatusNotFound, errCodeSessionNotFound},
+		{"not-a-session", http.StatusBadRequest, errCodeInvalidSessionID},
+	} {
+		if code := errorShape(t, ts.do(t, "GET", "/sessions/"+tc.id, nil, nil), tc.status); code != tc.code {
+			t.Errorf("%s: code = %q, want %q", tc.id, code, tc.code)
+		}
+	}
+}
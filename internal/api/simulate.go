@@ -0,0 +1,472 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/store"
+)
+
+// simArrival はシミュレーションで待機キューに登録するプレイヤー1人です。
+type simArrival struct {
+	// AtSeconds はシミュレーションの開始から待機キューに登録するまでの時間（秒）です。
+	AtSeconds float64 `json:"at_seconds"`
+	ID        string  `json:"id"`
+	Rating    int     `json:"rating"`
+	// GameMode を省略した場合は DefaultGameMode で待機します。
+	GameMode string `json:"game_mode,omitempty"`
+	Region   string `json:"region,omitempty"`
+	PingMS   int    `json:"ping_ms,omitempty"`
+}
+
+// simulationConfig はシミュレーションの条件です。
+type simulationConfig struct {
+	Matcher queue.Matcher
+	// Interval はマッチングプロセッサーが待機キューを確認する間隔です（PROCESSOR_INTERVAL にあたる）。登録のたびにも確認します。
+	Interval time.Duration
+	// Timeout はプレイヤーが結果を待つ時間です。0 の場合はゲームモードの待機時間を使います（timeout_seconds にあたる）。
+	Timeout time.Duration
+	// Bands は集計でレーティング帯を区切る境界です。
+	Bands []int
+}
+
+// simulationReport はシミュレーションの結果です。帯ごとの集計は GET /admin/stats/waits と同じ形式です。
+type simulationReport struct {
+	Strategy string `json:"strategy"`
+	Options  string `json:"options,omitempty"`
+	Players  int    `json:"players"`
+	Matches  int    `json:"matches"`
+	Matched  int    `json:"matched"`
+	TimedOut int    `json:"timed_out"`
+	// TimeoutRate は全プレイヤーのうちタイムアウトした割合です。
+	TimeoutRate float64 `json:"timeout_rate"`
+	// AvgRatingGap はセッションのチーム平均レーティングの最大差（rating_gap）の平均です。
+	AvgRatingGap float64 `json:"avg_rating_gap"`
+	// AvgWaitSeconds はマッチングが成立したプレイヤーの待機時間の平均です。
+	AvgWaitSeconds float64 `json:"avg_wait_seconds"`
+	// SimulatedSeconds は最初の登録から最後のプレイヤーが待機を終えるまでのシミュレーション上の時間です。
+	SimulatedSeconds float64 `json:"simulated_seconds"`
+	// MatchedPerSecond はシミュレーション上の1秒あたりにマッチングが成立したプレイヤー数（スループット）です。
+	MatchedPerSecond float64               `json:"matched_per_second"`
+	Bands            []store.WaitBandStats `json:"bands"`
+}
+
+// simulationEpoch はシミュレーションの時計の開始時刻です。同じ入力に対して同じ結果になるよう固定します。
+var simulationEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// simulation は MemoryStore と偽の時計で、到着するプレイヤーを本番と同じマッチング処理に通します。
+type simulation struct {
+	cfg   simulationConfig
+	clock time.Time
+	store *store.MemoryStore
+	// srv は sim.store と偽の時計で作った Server です。マッチングの条件（newMatchPolicy）とセッションの作成に使います。
+	srv *Server
+	// matches と gapSum は作成したセッションの数と rating_gap の合計です。
+	matches int
+	gapSum  int
+	// waitSum はマッチングが成立したプレイヤーの待機時間の合計です。
+	waitSum time.Duration
+}
+
+// runSimulation は arrivals を登録時刻の順に待機キューへ登録し、全員が待機を終えるまでマッチングを繰り返して結果を集計します。
+// 待機時間を過ぎたプレイヤーは long-poll と同じくその時刻に待機キューから削除します。ボットでの補充（BOT_FILL_AFTER）は行いません。
+// ゲームモード・機能フラグなどのマッチングの条件は serverCfg を使います。
+func runSimulation(ctx context.Context, arrivals []simArrival, cfg simulationConfig, serverCfg Config) (simulationReport, error) {
+	if cfg.Interval <= 0 {
+		return simulationReport{}, errors.New("interval must be positive")
+	}
+	arrivals = append([]simArrival(nil), arrivals...)
+	sort.SliceStable(arrivals, func(i, j int) bool { return arrivals[i].AtSeconds < arrivals[j].AtSeconds })
+
+	sim := &simulation{cfg: cfg, clock: simulationEpoch}
+	clock := func() time.Time { return sim.clock }
+	storeCfg := store.DefaultConfig()
+	storeCfg.Now, storeCfg.RatingSeeds = clock, serverCfg.RatingSeeds
+	sim.store = store.NewMemoryStore(storeCfg)
+	serverCfg.Now = clock
+	sim.srv = NewServer(sim.store, cfg.Matcher, slog.New(slog.DiscardHandler), serverCfg)
+	nextTick := simulationEpoch.Add(cfg.Interval)
+	i := 0
+	for {
+		rows, err := sim.store.ListQueuedPlayers(ctx)
+		if err != nil {
+			return simulationReport{}, err
+		}
+		entries := store.GroupQueueEntries(rows)
+		if i == len(arrivals) && len(entries) == 0 {
+			break
+		}
+		next := nextTick
+		if i < len(arrivals) {
+			if at := arrivalTime(arrivals[i]); at.Before(next) {
+				next = at
+			}
+		}
+		if err := sim.expire(ctx, entries, next); err != nil {
+			return simulationReport{}, err
+		}
+
+		sim.clock = next
+		for ; i < len(arrivals) && !arrivalTime(arrivals[i]).After(sim.clock); i++ {
+			if err := sim.enqueue(ctx, arrivals[i]); err != nil {
+				return simulationReport{}, err
+			}
+		}
+		if !sim.clock.Before(nextTick) {
+			nextTick = nextTick.Add(cfg.Interval)
+		}
+		// 本番でも登録のたびにマッチングプロセッサーを起こす（wakeMatcher）
+		if err := sim.match(ctx); err != nil {
+			return simulationReport{}, err
+		}
+	}
+	return sim.report(ctx, len(arrivals))
+}
+
+// arrivalTime はプレイヤーを待機キューに登録するシミュレーション上の時刻を返します。
+func arrivalTime(a simArrival) time.Time {
+	return simulationEpoch.Add(time.Duration(a.AtSeconds * float64(time.Second)))
+}
+
+// enqueue はプレイヤーのレーティングを設定して待機キューに登録します。
+func (sim *simulation) enqueue(ctx context.Context, a simArrival) error {
+	if _, _, err := sim.store.SetPlayerRating(ctx, a.ID, a.Rating); err != nil {
+		return err
+	}
+	entry := model.QueueEntry{Players: []model.Player{{ID: a.ID, PingMS: a.PingMS}}, Region: a.Region, GameMode: a.GameMode, Timeout: sim.cfg.Timeout}
+	if _, err := sim.store.EnqueueEntry(ctx, entry); err != nil {
+		return fmt.Errorf("プレイヤー %q の登録エラー（%.3f 秒）: %v", a.ID, a.AtSeconds, err)
+	}
+	return nil
+}
+
+// expire は before までに待機時間を過ぎるエントリを、待機時間を過ぎた時刻の順に待機キューから削除してタイムアウトとして記録します。
+func (sim *simulation) expire(ctx context.Context, entries []model.QueueEntry, before time.Time) error {
+	type deadline struct {
+		entry model.QueueEntry
+		at    time.Time
+	}
+	var expired []deadline
+	for _, e := range entries {
+		e.Timeout = sim.cfg.Timeout
+		if at := e.WaitingSince.Add(sim.srv.matchmakingWait(e, e.WaitingSince)); !at.After(before) {
+			expired = append(expired, deadline{entry: e, at: at})
+		}
+	}
+	sort.SliceStable(expired, func(i, j int) bool { return expired[i].at.Before(expired[j].at) })
+	for _, d := range expired {
+		sim.clock = d.at
+		if err := sim.store.DequeuePlayer(ctx, d.entry.Players[0].ID); err != nil {
+			return err
+		}
+		if err := sim.store.RecordQueueHistory(ctx, queueHistoryRecords(d.entry, sim.clock, store.QueueOutcomeTimedOut)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// match は runMatchmaking と同じ条件（newMatchPolicy）で1回マッチングし、成立したエントリを記録します。
+func (sim *simulation) match(ctx context.Context) error {
+	now := sim.clock
+	var matched []model.QueueEntry
+	sessions, err := sim.store.CreateSessions(ctx, func(entries []model.QueueEntry, recent, blocked model.OpponentSet) []model.SessionResult {
+		lobbies := queue.WithoutSelfMatches(sim.cfg.Matcher.Match(entries, now, sim.srv.newMatchPolicy(recent, blocked)))
+		sessions := make([]model.SessionResult, len(lobbies))
+		matched = matched[:0]
+		for i, l := range lobbies {
+			sessions[i] = sim.srv.createSession(l, now)
+			matched = append(matched, l.Entries()...)
+		}
+		return sessions
+	})
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		sim.matches++
+		sim.gapSum += session.RatingGap
+	}
+	var records []store.QueueHistoryRecord
+	for _, e := range matched {
+		records = append(records, queueHistoryRecords(e, now, store.QueueOutcomeMatched)...)
+		for _, p := range e.Players {
+			sim.waitSum += now.Sub(p.WaitingSince)
+		}
+	}
+	return sim.store.RecordQueueHistory(ctx, records)
+}
+
+// report は記録した待機の結果をレーティング帯ごとに集計します。
+func (sim *simulation) report(ctx context.Context, players int) (simulationReport, error) {
+	bands, err := sim.store.WaitStats(ctx, time.Time{}, "", sim.cfg.Bands)
+	if err != nil {
+		return simulationReport{}, err
+	}
+	setTimeoutRates(bands)
+	r := simulationReport{Players: players, Matches: sim.matches, SimulatedSeconds: sim.clock.Sub(simulationEpoch).Seconds(), Bands: bands}
+	for _, b := range bands {
+		r.Matched += b.Matched
+		r.TimedOut += b.TimedOut
+	}
+	if players > 0 {
+		r.TimeoutRate = float64(r.TimedOut) / float64(players)
+	}
+	if sim.matches > 0 {
+		r.AvgRatingGap = float64(sim.gapSum) / float64(sim.matches)
+	}
+	if r.Matched > 0 {
+		r.AvgWaitSeconds = sim.waitSum.Seconds() / float64(r.Matched)
+	}
+	if r.SimulatedSeconds > 0 {
+		r.MatchedPerSecond = float64(r.Matched) / r.SimulatedSeconds
+	}
+	return r, nil
+}
+
+// validateArrivals は読み込んだプレイヤーの値を確認し、省略されたゲームモードを DefaultGameMode にします。
+func validateArrivals(arrivals []simArrival, modes queue.Modes) error {
+	for i := range arrivals {
+		a := &arrivals[i]
+		if a.GameMode == "" {
+			a.GameMode = queue.DefaultGameMode
+		}
+		if _, ok := modes[a.GameMode]; !ok {
+			return fmt.Errorf("%d 件目: 未知のゲームモードです: %q", i+1, a.GameMode)
+		}
+		if err := model.ValidateID("id", a.ID, "player id"); err != nil {
+			return fmt.Errorf("%d 件目: %v", i+1, err)
+		}
+		if a.Rating < model.MinRating || a.Rating > model.MaxRating {
+			return fmt.Errorf("%d 件目: レーティングが範囲外です（%d〜%d）: %d", i+1, model.MinRating, model.MaxRating, a.Rating)
+		}
+		if a.AtSeconds < 0 {
+			return fmt.Errorf("%d 件目: at_seconds は 0 以上で指定してください: %v", i+1, a.AtSeconds)
+		}
+	}
+	return nil
+}
+
+// loadArrivals はプレイヤーの到着を JSON（simArrival の配列）または CSV（拡張子が .csv、1行目は列名）から読み込みます。
+// CSV の列は at_seconds・id・rating が必須で、game_mode・region・ping_ms は省略できます。
+func loadArrivals(path string) ([]simArrival, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var arrivals []simArrival
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		arrivals, err = parseArrivalsCSV(f)
+	} else {
+		err = json.NewDecoder(f).Decode(&arrivals)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s の読み込みエラー: %v", path, err)
+	}
+	return arrivals, nil
+}
+
+// parseArrivalsCSV は CSV のプレイヤーの到着を解析します。
+func parseArrivalsCSV(r io.Reader) ([]simArrival, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("列名の行がありません")
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"at_seconds", "id", "rating"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("列 %q がありません", name)
+		}
+	}
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	arrivals := make([]simArrival, 0, len(records)-1)
+	for n, row := range records[1:] {
+		a := simArrival{ID: field(row, "id"), GameMode: field(row, "game_mode"), Region: field(row, "region")}
+		if a.AtSeconds, err = strconv.ParseFloat(field(row, "at_seconds"), 64); err != nil {
+			return nil, fmt.Errorf("%d 行目の at_seconds が不正です: %v", n+2, err)
+		}
+		if a.Rating, err = strconv.Atoi(field(row, "rating")); err != nil {
+			return nil, fmt.Errorf("%d 行目の rating が不正です: %v", n+2, err)
+		}
+		if v := field(row, "ping_ms"); v != "" {
+			if a.PingMS, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("%d 行目の ping_ms が不正です: %v", n+2, err)
+			}
+		}
+		arrivals = append(arrivals, a)
+	}
+	return arrivals, nil
+}
+
+// generateArrivals は分布の指定（"players=1000,rate=2,mean=1500,stddev=300,mode=duel" の形式）からプレイヤーの到着を生成します。
+// 到着はポアソン過程（1秒あたり rate 人）、レーティングは平均 mean・標準偏差 stddev の正規分布（範囲内に丸める）に従います。
+// 同じ指定と seed に対しては常に同じ到着を返します。
+func generateArrivals(spec string, seed uint64) ([]simArrival, error) {
+	players, rate, mean, stddev, mode := 1000, 1.0, 1500.0, 300.0, queue.DefaultGameMode
+	for _, item := range model.SplitCommaList(spec) {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("分布の指定は key=value の形式で指定してください: %q", item)
+		}
+		var err error
+		switch key {
+		case "players":
+			players, err = strconv.Atoi(value)
+			if err == nil && players <= 0 {
+				err = errors.New("must be positive")
+			}
+		case "rate":
+			rate, err = strconv.ParseFloat(value, 64)
+			if err == nil && rate <= 0 {
+				err = errors.New("must be positive")
+			}
+		case "mean":
+			mean, err = strconv.ParseFloat(value, 64)
+		case "stddev":
+			stddev, err = strconv.ParseFloat(value, 64)
+			if err == nil && stddev < 0 {
+				err = errors.New("must not be negative")
+			}
+		case "mode":
+			mode = value
+		default:
+			return nil, fmt.Errorf("未知の分布の指定です（players / rate / mean / stddev / mode）: %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s が不正です: %v", key, err)
+		}
+	}
+
+	rng := rand.New(rand.NewPCG(seed, 0))
+	arrivals := make([]simArrival, players)
+	at := 0.0
+	for i := range arrivals {
+		at += rng.ExpFloat64() / rate
+		rating := int(rng.NormFloat64()*stddev + mean)
+		arrivals[i] = simArrival{AtSeconds: at, ID: fmt.Sprintf("sim-%06d", i+1), Rating: min(max(rating, model.MinRating), model.MaxRating), GameMode: mode}
+	}
+	return arrivals, nil
+}
+
+// writeSimulationText はシミュレーションの結果を表形式で書き出します。
+func writeSimulationText(w io.Writer, r simulationReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	strategy := r.Strategy
+	if r.Options != "" {
+		strategy += " (" + r.Options + ")"
+	}
+	fmt.Fprintf(tw, "strategy\t%s\n", strategy)
+	fmt.Fprintf(tw, "players\t%d\n", r.Players)
+	fmt.Fprintf(tw, "matches\t%d\n", r.Matches)
+	fmt.Fprintf(tw, "matched\t%d\n", r.Matched)
+	fmt.Fprintf(tw, "timed_out\t%d (%.1f%%)\n", r.TimedOut, r.TimeoutRate*100)
+	fmt.Fprintf(tw, "avg_rating_gap\t%.1f\n", r.AvgRatingGap)
+	fmt.Fprintf(tw, "avg_wait\t%.1fs\n", r.AvgWaitSeconds)
+	fmt.Fprintf(tw, "simulated\t%.0fs\n", r.SimulatedSeconds)
+	fmt.Fprintf(tw, "throughput\t%.2f matched/s\n", r.MatchedPerSecond)
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "rating\tentries\tmatched\ttimed_out\ttimeout_rate\twait_p50\twait_p90\twait_p99")
+	for _, b := range r.Bands {
+		fmt.Fprintf(tw, "%d-%d\t%d\t%d\t%d\t%.1f%%\t%.1fs\t%.1fs\t%.1fs\n", b.MinRating, b.MaxRating, b.Entries, b.Matched, b.TimedOut, b.TimeoutRate*100,
+			b.WaitP50Seconds, b.WaitP90Seconds, b.WaitP99Seconds)
+	}
+	return tw.Flush()
+}
+
+// RunSimulateCommand は simulate サブコマンドを実行し、結果を w に書き出します。
+// ゲームモード・レーティング帯・機能フラグなどのマッチングの条件は、サーバと同じ設定（cfg）を使います。
+func RunSimulateCommand(args []string, w io.Writer, cfg Config) error {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	input := fs.String("input", "", "プレイヤーの到着の JSON（at_seconds・id・rating・game_mode・region・ping_ms の配列）または CSV（拡張子 .csv、1行目は列名）")
+	generate := fs.String("generate", "", "到着を生成する分布（例: players=1000,rate=2,mean=1500,stddev=300,mode=duel）。--input の代わりに指定する")
+	seed := fs.Uint64("seed", 1, "--generate の乱数の種")
+	strategy := fs.String("strategy", queue.MatchStrategyRatingWindow, "マッチングのアルゴリズム（MATCH_STRATEGY と同じ）")
+	options := fs.String("options", "", "アルゴリズムのオプション（MATCH_STRATEGY_OPTIONS と同じ形式）")
+	window := fs.Int("window", 0, "rating_window のレーティングの差の上限（--options の window=N と同じ）")
+	interval := fs.Duration("interval", cfg.ProcessorInterval, "待機キューを確認する間隔（PROCESSOR_INTERVAL と同じ）")
+	timeout := fs.Duration("timeout", 0, "プレイヤーが結果を待つ時間（既定はゲームモードの待機時間）")
+	bands := fs.String("bands", "", "集計でレーティング帯を区切る境界（カンマ区切り、既定は WAIT_STATS_RATING_BANDS）")
+	format := fs.String("format", "text", "出力の形式（text / json）")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || (*input == "") == (*generate == "") {
+		return errors.New("usage: simulate (--input <file> | --generate <spec>) [flags]")
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("未知の出力の形式です（text / json）: %q", *format)
+	}
+	if *timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+
+	opts := *options
+	if *window > 0 {
+		opts = strings.Join(append(model.SplitCommaList(opts), "window="+strconv.Itoa(*window)), ",")
+	}
+	matcher, err := queue.NewMatcher(*strategy, opts)
+	if err != nil {
+		return err
+	}
+	simCfg := simulationConfig{Matcher: matcher, Interval: *interval, Timeout: *timeout, Bands: cfg.WaitStatsRatingBands}
+	if *bands != "" {
+		if simCfg.Bands, err = ParseRatingBands(*bands); err != nil {
+			return err
+		}
+	}
+
+	var arrivals []simArrival
+	if *input != "" {
+		arrivals, err = loadArrivals(*input)
+	} else {
+		arrivals, err = generateArrivals(*generate, *seed)
+	}
+	if err != nil {
+		return err
+	}
+	if err := validateArrivals(arrivals, cfg.Queue.GameModes); err != nil {
+		return err
+	}
+
+	report, err := runSimulation(context.Background(), arrivals, simCfg, cfg)
+	if err != nil {
+		return err
+	}
+	report.Strategy, report.Options = *strategy, opts
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return writeSimulationText(w, report)
+}
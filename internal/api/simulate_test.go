@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/queue"
+)
+
+var updateGolden = flag.Bool("update", false, "testdata のゴールデンファイルを現在の出力で書き換える")
+
+// checkGolden は got を testdata/simulate/name と比較します。-update を指定した場合はファイルを書き換えます。
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", "simulate", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s (go test -run %s -update で更新):\n%s", path, t.Name(), got)
+	}
+}
+
+// 同じ到着に対して常に同じ結果を出力する。レーティングの差の上限を狭めると平均の差が縮み、待機時間が延びる
+func TestSimulateGolden(t *testing.T) {
+	for _, tc := range []struct {
+		golden string
+		args   []string
+	}{
+		{"window75.golden", []string{"--input", "testdata/simulate/arrivals.json", "--strategy", "rating_window", "--window", "75", "--interval", "1s", "--timeout", "10s", "--bands", "1400,1600"}},
+		{"window400.golden", []string{"--input", "testdata/simulate/arrivals.json", "--window", "400", "--interval", "1s", "--timeout", "10s", "--bands", "1400,1600"}},
+		{"csv.golden.json", []string{"--input", "testdata/simulate/arrivals.csv", "--window", "75", "--interval", "1s", "--timeout", "10s", "--bands", "1400,1600", "--format", "json"}},
+		{"generated.golden", []string{"--generate", "players=200,rate=2,mean=1500,stddev=200", "--seed", "7", "--window", "100", "--interval", "1s", "--timeout", "20s"}},
+	} {
+		t.Run(tc.golden, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := RunSimulateCommand(tc.args, &out, DefaultConfig()); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tc.golden, out.Bytes())
+		})
+	}
+}
+
+// 待機時間・レーティングの差・スループットを、結果が手で計算できる到着から集計する
+func TestSimulationReportStatistics(t *testing.T) {
+	// alice は2秒待って bob と（差 40）、carol と dave は到着と同時に（差 20）マッチングし、範囲外の erin は10秒でタイムアウトする
+	arrivals := []simArrival{
+		{AtSeconds: 0, ID: "alice", Rating: 1500},
+		{AtSeconds: 2, ID: "bob", Rating: 1540},
+		{AtSeconds: 3, ID: "carol", Rating: 1600},
+		{AtSeconds: 3, ID: "dave", Rating: 1620},
+		{AtSeconds: 4, ID: "erin", Rating: 2400},
+	}
+	cfg := DefaultConfig()
+	if err := validateArrivals(arrivals, cfg.Queue.GameModes); err != nil {
+		t.Fatal(err)
+	}
+	matcher, err := queue.NewMatcher(queue.MatchStrategyRatingWindow, "window=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := runSimulation(context.Background(), arrivals, simulationConfig{Matcher: matcher, Interval: time.Second, Timeout: 10 * time.Second, Bands: []int{2000}}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := simulationReport{Players: 5, Matches: 2, Matched: 4, TimedOut: 1, TimeoutRate: 0.2, AvgRatingGap: 30, AvgWaitSeconds: 0.5, SimulatedSeconds: 14, MatchedPerSecond: 4.0 / 14}
+	bands := r.Bands
+	r.Bands = nil
+	if got := fmt.Sprintf("%+v", r); got != fmt.Sprintf("%+v", want) {
+		t.Fatalf("report = %s\nwant     %+v", got, want)
+	}
+	// 2000 未満の帯は4人ともマッチングし、2000 以上の帯は erin がタイムアウトした
+	if len(bands) != 2 || bands[0].Matched != 4 || bands[0].TimedOut != 0 || bands[1].Matched != 0 || bands[1].TimedOut != 1 {
+		t.Fatalf("bands = %+v, want 4 matched below 2000 and 1 timed out above", bands)
+	}
+}
+
+func TestSimulateCommandErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"no input", nil, "usage"},
+		{"input and generate", []string{"--input", "testdata/simulate/arrivals.json", "--generate", "players=10"}, "usage"},
+		{"unknown format", []string{"--generate", "players=10", "--format", "xml"}, "xml"},
+		{"unknown strategy", []string{"--generate", "players=10", "--strategy", "magic"}, "magic"},
+		{"bad spec", []string{"--generate", "players=0"}, "players"},
+		{"missing file", []string{"--input", "testdata/simulate/missing.json"}, "missing.json"},
+	} {
+		if err := RunSimulateCommand(tc.args, &bytes.Buffer{}, DefaultConfig()); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want it to mention %q", tc.name, err, tc.want)
+		}
+	}
+
+	for _, tc := range []struct{ name, csv string }{
+		{"missing column", "at_seconds,id\n0,p01\n"},
+		{"bad rating", "at_seconds,id,rating\n0,p01,high\n"},
+		{"empty", ""},
+	} {
+		if _, err := parseArrivalsCSV(strings.NewReader(tc.csv)); err == nil {
+			t.Errorf("%s: parsed without an error", tc.name)
+		}
+	}
+	if err := validateArrivals([]simArrival{{ID: "p01", Rating: 1500, GameMode: "unknown"}}, DefaultConfig().Queue.GameModes); err == nil {
+		t.Error("unknown game mode accepted")
+	}
+}
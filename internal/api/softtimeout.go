@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+)
+
+// softTimeoutRepollWindow は待機を続ける（searching を返した）エントリが、次のリクエストを待つ時間です。
+// この間に poll_token を付けたリクエストがなければ、有効期限切れとして待機キューから削除されます。
+const softTimeoutRepollWindow = 30 * time.Second
+
+// searchingResponse は keep_waiting を指定したリクエストが相手を見つけられないまま待機時間を過ぎた場合に返すボディです。
+// クライアントは同じリクエストに poll_token を付けて再送することで、待機開始時刻を保ったまま待機を続けます。
+type searchingResponse struct {
+	Status       string    `json:"status"`
+	PollToken    string    `json:"poll_token"`
+	WaitingSince time.Time `json:"waiting_since"`
+	// PollBefore はこの時刻までに再送しなければ待機キューから削除されることを表します。
+	PollBefore time.Time `json:"poll_before"`
+	// GiveUpAt は待機を続けられる上限（待機開始から SoftTimeoutMaxWait）です。
+	GiveUpAt time.Time `json:"give_up_at"`
+}
+
+// errInvalidPollToken は poll_token の形式が不正、または別のエントリのものである場合のエラーです。
+var errInvalidPollToken = &model.FieldError{Field: "poll_token", Message: "poll_token is malformed or belongs to another entry"}
+
+// issuePollToken はエントリのキーと発行時刻から poll_token を作ります。
+// 本人確認は通常のリクエストと同じく行うため、トークンは待機を続けるエントリを指すだけで、署名はしません。
+func issuePollToken(key string, now time.Time) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key)) + "." + strconv.FormatInt(now.UnixMilli(), 10)
+}
+
+// verifyPollToken は poll_token がエントリ key のものであることを確かめます。
+func verifyPollToken(token, key string) error {
+	encoded, issued, ok := strings.Cut(token, ".")
+	if !ok {
+		return errInvalidPollToken
+	}
+	k, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || string(k) != key {
+		return errInvalidPollToken
+	}
+	if _, err := strconv.ParseInt(issued, 10, 64); err != nil {
+		return errInvalidPollToken
+	}
+	return nil
+}
+
+// softTimeoutWait は keep_waiting を指定したエントリの待機時間を、待機を続けられる上限までに縮めます。
+func (s *Server) softTimeoutWait(e model.QueueEntry, wait time.Duration, now time.Time) time.Duration {
+	if !e.KeepWaiting || s.cfg.SoftTimeoutMaxWait <= 0 || e.WaitingSince.IsZero() {
+		return wait
+	}
+	return max(min(wait, e.WaitingSince.Add(s.cfg.SoftTimeoutMaxWait).Sub(now)), 0)
+}
+
+// resumePoll は poll_token を付けた再送を処理します。
+// 待機中にマッチングが成立していればそのセッションを返し、待機を続けられない場合はエラーのレスポンスを返して true を返します。
+// 待機を続けられる場合は entry の待機開始時刻を待機キュー上の値に合わせて false を返すため、呼び出し側はそのまま joinQueue で待機を再開してください。
+func (s *Server) resumePoll(w http.ResponseWriter, r *http.Request, entry *model.QueueEntry, token string) bool {
+	playerID := entry.Players[0].ID
+	if err := verifyPollToken(token, entry.Key()); err != nil {
+		writeQueueEntryError(w, err)
+		return true
+	}
+
+	// searching を返す直前に成立して通知を受け取れなかったマッチングは、ここで返す
+	// （再送までの間は結果を待つクライアントがいないため、planLiveLobbies によりマッチングされない）
+	session, err := s.findMatchedSession(r.Context(), playerID, s.now())
+	switch {
+	case err == nil:
+		s.logger.InfoContext(r.Context(), "returned session matched between polls", "entry", entry.Key(), "session_id", session.SessionID)
+		if err := writeLongPollResponse(w, versionedSession(r.Context(), session)); err != nil {
+			s.logger.WarnContext(r.Context(), "成立済みセッションの送信エラー", "func", "resumePoll", "session_id", session.SessionID, "error", err)
+		}
+		return true
+	case !errors.Is(err, model.ErrSessionNotFound):
+		s.logger.ErrorContext(r.Context(), "成立済みセッション確認エラー", "func", "resumePoll", "entry", entry.Key(), "error", err)
+		metrics.HandlerErrors.WithLabelValues("matchmaking").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to resume matchmaking")
+		return true
+	}
+
+	pos, err := s.Store.QueuePosition(r.Context(), playerID)
+	if errors.Is(err, store.ErrNotQueued) {
+		// 再送が遅れて有効期限切れで削除された、または待機を続けられる上限を過ぎた
+		writeJSONError(w, http.StatusNotFound, errCodeNotQueued, "Player is no longer in the matchmaking queue; start a new search")
+		return true
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "待機状況取得エラー", "func", "resumePoll", "entry", entry.Key(), "error", err)
+		metrics.HandlerErrors.WithLabelValues("matchmaking").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to resume matchmaking")
+		return true
+	}
+	if !pos.Player.Requeued {
+		// 別のリクエストが既に待機を再開している
+		writeJSONError(w, http.StatusConflict, errCodeAlreadyQueued, model.ErrAlreadyQueued.Error())
+		return true
+	}
+	entry.WaitingSince = pos.Player.WaitingSince
+	entry.KeepWaiting = true
+	return false
+}
+
+// keepSearching は keep_waiting を指定したエントリの待機時間が過ぎた場合に、待機キューから削除せずに
+// 再送を待つ状態にして 200（searching）を返します。待機を続けられる上限を過ぎている場合や、
+// 待機キューにいない場合は false を返すため、呼び出し側は通常のタイムアウトとして扱ってください。
+func (s *Server) keepSearching(ctx context.Context, w http.ResponseWriter, q *queueWaiter) bool {
+	entry, now := q.Entry, s.now()
+	if !entry.KeepWaiting || s.cfg.SoftTimeoutMaxWait <= 0 {
+		return false
+	}
+	giveUpAt := entry.WaitingSince.Add(s.cfg.SoftTimeoutMaxWait)
+	if !now.Before(giveUpAt) {
+		return false
+	}
+	pollBefore := now.Add(softTimeoutRepollWindow)
+	if err := s.Store.SuspendEntry(ctx, entry.Players[0].ID, pollBefore); err != nil {
+		if !errors.Is(err, store.ErrNotQueued) {
+			s.logger.ErrorContext(ctx, "待機継続の登録エラー", "func", "keepSearching", "entry", q.Key, "error", err)
+		}
+		return false
+	}
+	metrics.MatchmakingSoftTimeouts.Inc()
+	s.logger.InfoContext(ctx, "matchmaking still searching", "entry", q.Key, "mode", entry.GameMode, "give_up_at", giveUpAt)
+	resp := searchingResponse{
+		Status:       "searching",
+		PollToken:    issuePollToken(q.Key, now),
+		WaitingSince: entry.WaitingSince.UTC(),
+		PollBefore:   pollBefore.UTC(),
+		GiveUpAt:     giveUpAt.UTC(),
+	}
+	if err := writeLongPollResponse(w, resp); err != nil {
+		// 再送がなければ有効期限切れで削除されるため、ここでは削除しない
+		s.logger.WarnContext(ctx, "待機継続レスポンスの送信エラー", "func", "keepSearching", "entry", q.Key, "error", err)
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// softTimeoutServer は keep_waiting の待機を上限 maxWait まで続けられ、1秒の待機時間を指定できるサーバです。
+func softTimeoutServer(t *testing.T, maxWait time.Duration) *testServer {
+	return newTestServer(t, func(cfg *Config) {
+		cfg.Queue.MinTimeout = time.Second
+		cfg.SoftTimeoutMaxWait = maxWait
+		cfg.PlayerRateLimit = ratelimit.Config{}
+	})
+}
+
+// searching は keep_waiting を指定した alice の待機時間が過ぎ、200（searching）が返ることを確認してそのボディを返します。
+func (ts *testServer) searching(t *testing.T, body map[string]interface{}) searchingResponse {
+	t.Helper()
+	rec := receive(t, ts.startEnqueue(t, body))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200 searching: %s", rec.Code, rec.Body)
+	}
+	var resp searchingResponse
+	decodeJSON(t, rec, &resp)
+	if resp.Status != "searching" || resp.PollToken == "" {
+		t.Fatalf("response = %+v, want searching with a poll token", resp)
+	}
+	return resp
+}
+
+// keep_waiting の待機は待機時間を過ぎても待機キューに残り、poll_token を付けた再送で待機開始時刻を保ったまま待機を続ける
+func TestSoftTimeoutRequeue(t *testing.T) {
+	ts := softTimeoutServer(t, 5*time.Minute)
+	body := map[string]interface{}{"id": "alice", "keep_waiting": true, "timeout_seconds": 1}
+	resp := ts.searching(t, body)
+	if !resp.WaitingSince.Equal(ts.now()) || !resp.PollBefore.Equal(ts.now().Add(softTimeoutRepollWindow)) || !resp.GiveUpAt.Equal(ts.now().Add(5*time.Minute)) {
+		t.Fatalf("response = %+v, want the original waiting_since, a repoll window and the hard cap", resp)
+	}
+	if ids := ts.queuedIDs(t); !slices.Equal(ids, []string{"alice"}) {
+		t.Fatalf("queued = %v, want alice kept in the queue", ids)
+	}
+
+	// 再送を待っている間は結果を受け取るクライアントがいないため、マッチングしない
+	ts.clock.Advance(10 * time.Second)
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	if cycle := ts.tick(t); cycle.Matched != 0 {
+		t.Fatalf("tick between polls created %d sessions, want 0", cycle.Matched)
+	}
+
+	// 他のエントリの poll_token は受け付けない
+	wrong := map[string]interface{}{"id": "alice", "timeout_seconds": 1, "poll_token": issuePollToken("carol", ts.now())}
+	if code := errorShape(t, ts.do(t, "POST", "/matchmaking", wrong, nil), http.StatusBadRequest); code != errCodeInvalidRequest {
+		t.Fatalf("foreign poll token: code = %q, want %q", code, errCodeInvalidRequest)
+	}
+
+	body["poll_token"] = resp.PollToken
+	body["timeout_seconds"] = 5
+	alice := ts.startEnqueue(t, body)
+	waitFor(t, "alice to resume", func() bool { return ts.tick(t).Matched == 1 })
+	var sessions []model.SessionResult
+	for _, done := range []<-chan *httptest.ResponseRecorder{alice, bob} {
+		rec := receive(t, done)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var session model.SessionResult
+		decodeJSON(t, rec, &session)
+		sessions = append(sessions, session)
+	}
+	if sessions[0].SessionID == "" || sessions[0].SessionID != sessions[1].SessionID {
+		t.Fatalf("sessions = %q and %q, want alice and bob in the same session", sessions[0].SessionID, sessions[1].SessionID)
+	}
+	if got := sessions[0].MaxWaitSeconds; got != 10 {
+		t.Fatalf("max wait = %vs, want alice's 10s counted from the first request", got)
+	}
+}
+
+// 待機開始から SoftTimeoutMaxWait を過ぎた再送は、通常のタイムアウトとして待機キューから削除する
+func TestSoftTimeoutHardCap(t *testing.T) {
+	ts := softTimeoutServer(t, 2*time.Second)
+	body := map[string]interface{}{"id": "alice", "keep_waiting": true, "timeout_seconds": 1}
+	resp := ts.searching(t, body)
+
+	ts.clock.Advance(2 * time.Second)
+	body["poll_token"] = resp.PollToken
+	rec := receive(t, ts.startEnqueue(t, body))
+	if code := errorShape(t, rec, http.StatusGatewayTimeout); code != errCodeMatchmakingTimeout {
+		t.Fatalf("code = %q, want %q", code, errCodeMatchmakingTimeout)
+	}
+	if ids := ts.queuedIDs(t); len(ids) != 0 {
+		t.Fatalf("queued = %v after the hard cap, want empty", ids)
+	}
+
+	// 削除された後の再送は、新しく待機を始めるよう 404 を返す
+	rec = ts.do(t, "POST", "/matchmaking", body, nil)
+	if code := errorShape(t, rec, http.StatusNotFound); code != errCodeNotQueued {
+		t.Fatalf("poll after eviction: code = %q, want %q", code, errCodeNotQueued)
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/store"
+)
+
+// spectatorRequest は POST /sessions/{id}/spectators のリクエストボディです。
+type spectatorRequest struct {
+	// PlayerID は観戦者として追加するプレイヤーIDです。
+	PlayerID string `json:"player_id"`
+}
+
+// addSpectatorHandler は確定済みのセッションにボディの player_id を観戦者として追加し、セッションを返します。
+// 新しく追加した場合は 201、既に観戦者の場合は 200 を返します。
+// 参加者は観戦者にできず（400）、確定済みでないセッションと観戦者が上限に達しているセッションには 409 を返します。
+func (s *Server) addSpectatorHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("id")
+	if err := model.SessionID(sessionID).Validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, errCodeInvalidSessionID, "Invalid session id")
+		return
+	}
+	var req spectatorRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+	if err := model.ValidateID("player_id", req.PlayerID, "player_id"); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+
+	created, err := s.Store.AddSpectator(r.Context(), sessionID, req.PlayerID, s.cfg.MaxSpectatorsPerSession)
+	switch {
+	case errors.Is(err, model.ErrSessionNotFound):
+		writeJSONError(w, http.StatusNotFound, errCodeSessionNotFound, "Session not found")
+		return
+	case errors.Is(err, store.ErrSpectatorIsParticipant):
+		writeQueueEntryError(w, &model.FieldError{Field: "player_id", Message: "a participant of the session cannot be a spectator"})
+		return
+	case errors.Is(err, store.ErrSessionNotActive):
+		writeJSONError(w, http.StatusConflict, errCodeSessionNotActive, "Spectators can only be added to an active session")
+		return
+	case errors.Is(err, store.ErrSpectatorLimitReached):
+		writeErrorResponse(w, http.StatusConflict, ErrorDetail{
+			Code:    errCodeSpectatorLimitReached,
+			Message: "Session has reached the maximum number of spectators",
+			Details: map[string]interface{}{"max": s.cfg.MaxSpectatorsPerSession},
+		})
+		return
+	case err != nil:
+		s.logger.ErrorContext(r.Context(), "観戦者登録エラー", "func", "addSpectatorHandler", "session_id", sessionID, "player_id", req.PlayerID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("spectators").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to add spectator")
+		return
+	}
+	if created {
+		s.logger.InfoContext(r.Context(), "spectator added", "session_id", sessionID, "player_id", req.PlayerID)
+	}
+
+	session, err := s.Store.GetSession(r.Context(), sessionID)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "セッション取得エラー", "func", "addSpectatorHandler", "session_id", sessionID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("spectators").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to get session")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	if err := json.NewEncoder(w).Encode(versionedSession(r.Context(), session)); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "addSpectatorHandler", "session_id", sessionID, "error", err)
+	}
+}
+
+// removeSpectatorHandler はセッションの観戦者を削除します。セッションの状態によらず削除でき、登録されていない場合は 404 を返します。
+func (s *Server) removeSpectatorHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("id")
+	if err := model.SessionID(sessionID).Validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, errCodeInvalidSessionID, "Invalid session id")
+		return
+	}
+	playerID := r.PathValue("player_id")
+	err := s.Store.RemoveSpectator(r.Context(), sessionID, playerID)
+	if errors.Is(err, store.ErrNotSpectating) {
+		writeJSONError(w, http.StatusNotFound, errCodeNotSpectating, store.ErrNotSpectating.Error())
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "観戦者削除エラー", "func", "removeSpectatorHandler", "session_id", sessionID, "player_id", playerID, "error", err)
+		metrics.HandlerErrors.WithLabelValues("spectators").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to remove spectator")
+		return
+	}
+	s.logger.InfoContext(r.Context(), "spectator removed", "session_id", sessionID, "player_id", playerID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// addSpectator は管理用エンドポイントで playerID をセッションの観戦者に追加し、ステータスコードを確認します。
+func (ts *testServer) addSpectator(t *testing.T, sessionID, playerID string, status int) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := serve(t, ts.AdminHandler(), "POST", "/sessions/"+sessionID+"/spectators", map[string]string{"player_id": playerID}, adminHeader())
+	if rec.Code != status {
+		t.Fatalf("add spectator %s: status %d, want %d: %s", playerID, rec.Code, status, rec.Body)
+	}
+	return rec
+}
+
+func TestSpectatorEndpoints(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) {
+		cfg.MaxSpectatorsPerSession = 2
+		cfg.PlayerRateLimit = ratelimit.Config{}
+	})
+	session := ts.activeSession(t, "alice", "bob")
+
+	var got model.SessionResult
+	decodeJSON(t, ts.addSpectator(t, session.SessionID, "carol", http.StatusCreated), &got)
+	if !slices.Equal(got.Spectators, []string{"carol"}) {
+		t.Fatalf("spectators = %v, want carol", got.Spectators)
+	}
+	ts.addSpectator(t, session.SessionID, "carol", http.StatusOK)
+
+	// 参加者は観戦者にできない
+	rec := ts.addSpectator(t, session.SessionID, "alice", http.StatusBadRequest)
+	if code := errorShape(t, rec, http.StatusBadRequest); code != errCodeInvalidRequest {
+		t.Fatalf("participant: code = %q, want %q", code, errCodeInvalidRequest)
+	}
+
+	// 観戦者は MaxSpectatorsPerSession まで
+	ts.addSpectator(t, session.SessionID, "dave", http.StatusCreated)
+	rec = ts.addSpectator(t, session.SessionID, "erin", http.StatusConflict)
+	if code := errorShape(t, rec, http.StatusConflict); code != errCodeSpectatorLimitReached {
+		t.Fatalf("over the cap: code = %q, want %q", code, errCodeSpectatorLimitReached)
+	}
+	var resp struct {
+		Error ErrorDetail `json:"error"`
+	}
+	decodeJSON(t, rec, &resp)
+	if resp.Error.Details["max"] != float64(2) {
+		t.Fatalf("details = %v, want max 2", resp.Error.Details)
+	}
+
+	rec = ts.do(t, "GET", "/sessions/"+session.SessionID, nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET session: status %d: %s", rec.Code, rec.Body)
+	}
+	decodeJSON(t, rec, &got)
+	if !slices.Equal(got.Spectators, []string{"carol", "dave"}) {
+		t.Fatalf("spectators = %v, want carol and dave in the order added", got.Spectators)
+	}
+
+	// 削除した分だけ新しく追加できる
+	admin := ts.AdminHandler()
+	if rec := serve(t, admin, "DELETE", "/sessions/"+session.SessionID+"/spectators/carol", nil, adminHeader()); rec.Code != http.StatusNoContent {
+		t.Fatalf("remove: status %d: %s", rec.Code, rec.Body)
+	}
+	if code := errorShape(t, serve(t, admin, "DELETE", "/sessions/"+session.SessionID+"/spectators/carol", nil, adminHeader()), http.StatusNotFound); code != errCodeNotSpectating {
+		t.Fatalf("remove twice: code = %q, want %q", code, errCodeNotSpectating)
+	}
+	ts.addSpectator(t, session.SessionID, "erin", http.StatusCreated)
+
+	if code := errorShape(t, serve(t, admin, "POST", "/sessions/"+string(model.NewSessionID())+"/spectators", map[string]string{"player_id": "carol"}, adminHeader()), http.StatusNotFound); code != errCodeSessionNotFound {
+		t.Fatalf("unknown session: code = %q, want %q", code, errCodeSessionNotFound)
+	}
+}
+
+// 観戦者を追加できるのは確定済み（active）のセッションだけで、承諾待ち・中止・終了・期限切れのセッションには 409 を返す
+func TestSpectatorRequiresActiveSession(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.PlayerRateLimit = ratelimit.Config{} })
+
+	pending := ts.matchPair(t, "alice", "bob")
+	rec := ts.addSpectator(t, pending.SessionID, "zed", http.StatusConflict)
+	if code := errorShape(t, rec, http.StatusConflict); code != errCodeSessionNotActive {
+		t.Fatalf("pending session: code = %q, want %q", code, errCodeSessionNotActive)
+	}
+
+	ts.reportNoShow(t, pending.SessionID, "bob")
+	ts.addSpectator(t, pending.SessionID, "zed", http.StatusConflict)
+
+	finished := ts.activeSession(t, "carol", "dave")
+	ts.addSpectator(t, finished.SessionID, "zed", http.StatusCreated)
+	if rec := serve(t, ts.AdminHandler(), "POST", "/sessions/"+finished.SessionID+"/result", map[string]int{"winning_team": 1}, adminHeader()); rec.Code != http.StatusOK {
+		t.Fatalf("result: status %d: %s", rec.Code, rec.Body)
+	}
+	ts.addSpectator(t, finished.SessionID, "yuri", http.StatusConflict)
+
+	expired := ts.activeSession(t, "erin", "frank")
+	ts.clock.Advance(2*time.Hour + time.Second)
+	ts.sweepSessions(context.Background(), ts.now())
+	ts.addSpectator(t, expired.SessionID, "zed", http.StatusConflict)
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/store"
+)
+
+// sseKeepAliveInterval はマッチング待機中に keep-alive コメントを送る間隔です。
+// プロキシがアイドル接続を切断しないよう、一般的なタイムアウトより短くします。
+const sseKeepAliveInterval = 5 * time.Second
+
+// sseQueued は待機キューへ登録したときに送る queued イベントのデータです。
+type sseQueued struct {
+	// TimeoutSeconds は相手が見つからない場合に接続を閉じるまでの秒数です。timeout_seconds の指定がなければ有効期限までです。
+	TimeoutSeconds int       `json:"timeout_seconds"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	// ResumeToken はサーバの再起動で接続が切れた場合に GET /matchmaking/resume で待機を再開するためのトークンです。
+	ResumeToken string `json:"resume_token,omitempty"`
+}
+
+// matchmakingStreamHandler は Server-Sent Events でマッチング結果を返します。
+// WebSocket を使えない環境向けに、待機中は keep-alive コメントを送り続け、マッチングが成立したら
+// match イベントで SessionResult を送って接続を閉じます。クライアントが切断した場合は待機キューから削除します。
+// 登録時には queued イベントで待機時間を知らせ、timeout_seconds の待機時間を過ぎた場合は timeout イベントを送ります。
+func (s *Server) matchmakingStreamHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	// rating はサーバ側で管理しているため、クエリで指定されても使わない
+	req := matchmakingRequest{
+		ID:       query.Get("player_id"),
+		Region:   query.Get("region"),
+		GameMode: query.Get("mode"),
+	}
+	if v := query.Get("max_lifetime_seconds"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeQueueEntryError(w, fmt.Errorf("invalid max_lifetime_seconds: %v", err))
+			return
+		}
+		req.MaxLifetimeSeconds = n
+	}
+	if v := query.Get("force"); v != "" {
+		force, err := strconv.ParseBool(v)
+		if err != nil {
+			writeQueueEntryError(w, &model.FieldError{Field: "force", Message: fmt.Sprintf("invalid force: %v", err)})
+			return
+		}
+		req.Force = force
+	}
+	if err := timeoutQueryParam(r, &req); err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+	if err := authorizeMatchmakingRequest(r.Context(), &req); err != nil {
+		writePlayerMismatch(w)
+		return
+	}
+	entry, err := s.newQueueEntry(req)
+	if err != nil {
+		writeQueueEntryError(w, err)
+		return
+	}
+
+	q, err := s.joinQueue(r.Context(), entry)
+	if errors.Is(err, model.ErrAlreadyQueued) {
+		writeJSONError(w, http.StatusConflict, errCodeAlreadyQueued, model.ErrAlreadyQueued.Error())
+		return
+	}
+	if errors.Is(err, store.ErrQueueFull) {
+		s.writeQueueFull(w)
+		return
+	}
+	if errors.Is(err, errEnqueueBusy) {
+		writeEnqueueBusy(w)
+		return
+	}
+	var banned *playerBannedError
+	if errors.As(err, &banned) {
+		writePlayerBanned(w, banned)
+		return
+	}
+	var cooldown *playerCooldownError
+	if errors.As(err, &cooldown) {
+		writePlayerCooldown(w, cooldown, s.now())
+		return
+	}
+	var inSession *store.ActiveSessionError
+	if errors.As(err, &inSession) {
+		writeActiveSession(w, inSession)
+		return
+	}
+	if err != nil {
+		if r.Context().Err() != nil {
+			// 登録中にクライアントが切断した（待機キューからは joinQueue で削除済み）
+			writeJSONError(w, http.StatusServiceUnavailable, errCodeCancelled, "Matchmaking was cancelled; retry")
+			return
+		}
+		s.logger.ErrorContext(r.Context(), "待機登録エラー", "func", "matchmakingStreamHandler", "entry", entry.Key(), "error", err)
+		metrics.HandlerErrors.WithLabelValues("matchmaking").Inc()
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, "Failed to register waiting player")
+		return
+	}
+	defer q.close()
+	entry, key := q.Entry, q.Key
+
+	s.logger.InfoContext(r.Context(), "registered for matchmaking", "entry", key, "player_ids", model.PlayerIDs(entry.Players), "mode", entry.GameMode, "region", entry.Region, "transport", "sse")
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// timeout_seconds の指定がない場合は、従来どおり有効期限まで待機を続ける
+	wait := entry.ExpiresAt.Sub(s.now())
+	if entry.Timeout > 0 {
+		wait = s.matchmakingWait(entry, s.now())
+	}
+	setExpiryHeader(w, entry)
+	setTimeoutHeader(w, wait)
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+
+	// leave はクライアントが待機をやめた場合に待機キューから削除します（購読は defer で解除する）。
+	// label は matchmaking_waits_abandoned_total のラベルです（abandonReason）。
+	leave := func(label, reason string, err error) {
+		q.leave(r.Context(), reason)
+		metrics.MatchmakingAbandoned.WithLabelValues(label).Inc()
+		s.Events.Cancel(entry, reason, s.now())
+		s.logger.InfoContext(r.Context(), "matchmaking stream closed", "entry", key, "mode", entry.GameMode, "reason", reason, "error", err)
+	}
+
+	// 待機キューへ登録したことと待機時間を queued イベントで知らせる
+	resumeToken := s.issueResumeToken(entry)
+	ack, _ := json.Marshal(sseQueued{TimeoutSeconds: int(wait.Round(time.Second) / time.Second), ExpiresAt: entry.ExpiresAt.UTC(), ResumeToken: resumeToken})
+	if err := writeSSE(rc, w, "event: queued\ndata: "+string(ack)+"\n\n"); err != nil {
+		leave(writeFailureLabel(err), "write failed", err)
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+	// 有効期限を過ぎたエントリはマッチングされないため、期限（または指定された待機時間）で接続を閉じる
+	expired := time.NewTimer(wait)
+	defer expired.Stop()
+	for {
+		select {
+		case session := <-q.Matches:
+			if session.Status == sessionRemovedByAdmin {
+				// 待機キューからは削除済み
+				s.logger.InfoContext(r.Context(), "matchmaking stream closed", "entry", key, "mode", entry.GameMode, "reason", "removed by admin")
+				data, _ := json.Marshal(ErrorResponse{Error: ErrorDetail{Code: errCodeRemovedByAdmin, Message: "Removed from the matchmaking queue by an administrator"}})
+				writeSSE(rc, w, "event: removed\ndata: "+string(data)+"\n\n")
+				return
+			}
+			if session.Status == sessionCancelled {
+				// 待機キューからは削除済み
+				s.logger.InfoContext(r.Context(), "matchmaking stream closed", "entry", key, "mode", entry.GameMode, "reason", "cancelled by request")
+				data, _ := json.Marshal(ErrorResponse{Error: ErrorDetail{Code: errCodeCancelled, Message: "Matchmaking was cancelled by request"}})
+				writeSSE(rc, w, "event: cancelled\ndata: "+string(data)+"\n\n")
+				return
+			}
+			if session.Status == queue.SessionModeClosed {
+				// 待機キューからは削除済み
+				s.logger.InfoContext(r.Context(), "matchmaking stream closed", "entry", key, "mode", entry.GameMode, "reason", "mode closed")
+				next, _ := s.cfg.Queue.GameModes[entry.GameMode].Schedule.NextOpen(s.now())
+				data, _ := json.Marshal(ErrorResponse{Error: modeClosedDetail(&queue.ModeClosedError{Name: entry.GameMode, NextOpen: next})})
+				writeSSE(rc, w, "event: mode_closed\ndata: "+string(data)+"\n\n")
+				return
+			}
+			data, err := json.Marshal(versionedSession(r.Context(), session))
+			if err == nil {
+				err = writeSSE(rc, w, "event: match\ndata: "+string(data)+"\n\n")
+			}
+			if err != nil {
+				q.undeliverable(r.Context(), session, err)
+			}
+			return
+		case <-keepAlive.C:
+			if err := writeSSE(rc, w, ": keep-alive\n\n"); err != nil {
+				leave(writeFailureLabel(err), "write failed", err)
+				return
+			}
+		case <-expired.C:
+			// 相手が見つからないまま待機を終えたため、イベントログにはタイムアウトとして記録する
+			s.Events.Timeout(entry, s.now())
+			s.Webhook.enqueueEntry(webhookEventTimeout, entry, s.now())
+			if entry.Timeout > 0 && s.now().Before(entry.ExpiresAt) {
+				q.leave(r.Context(), "timed out")
+				metrics.MatchmakingTimeouts.Inc()
+				s.queueStats.observeTimeout()
+				s.logger.InfoContext(r.Context(), "matchmaking stream closed", "entry", key, "mode", entry.GameMode, "reason", "timed out")
+				data, _ := json.Marshal(ErrorResponse{Error: ErrorDetail{Code: errCodeMatchmakingTimeout, Message: "No opponent found within timeout", Hints: s.timeoutHints(entry.GameMode, r.Header.Get("Accept-Language"))}})
+				writeSSE(rc, w, "event: timeout\ndata: "+string(data)+"\n\n")
+				return
+			}
+			q.leave(r.Context(), "entry expired")
+			metrics.MatchmakingCancellations.Inc()
+			s.logger.InfoContext(r.Context(), "matchmaking stream closed", "entry", key, "mode", entry.GameMode, "reason", "entry expired")
+			return
+		case <-r.Context().Done():
+			if suspendedByShutdown(r.Context(), resumeToken) {
+				// 再起動後に GET /matchmaking/resume で再開できるよう、待機キューに残す
+				s.logger.InfoContext(r.Context(), "matchmaking stream closed", "entry", key, "mode", entry.GameMode, "reason", "server restarting")
+				return
+			}
+			label, reason := abandonReason(r.Context())
+			leave(label, reason, context.Cause(r.Context()))
+			return
+		}
+	}
+}
+
+// writeSSE は SSE のイベント（またはコメント）を書き込んで送信します。
+// 受信しないクライアントによってブロックされ続けないよう、書き込みごとに期限を設定します。
+func writeSSE(rc *http.ResponseController, w http.ResponseWriter, s string) error {
+	if err := rc.SetWriteDeadline(time.Now().Add(longPollWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	_, err := fmt.Fprint(w, s)
+	if err == nil {
+		err = rc.Flush()
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("%w: %v", errSlowConsumer, err)
+	}
+	return err
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// sseEvent は SSE のイベントの種類とデータです。
+type sseEvent struct {
+	name, data string
+}
+
+// readSSE は body から SSE のイベントを順に読み込みます。コメント（keep-alive）は読み飛ばし、ストリームが終わるとチャネルを閉じます。
+func readSSE(body io.Reader) <-chan sseEvent {
+	events := make(chan sseEvent, 8)
+	go func() {
+		defer close(events)
+		sc := bufio.NewScanner(body)
+		var ev sseEvent
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case line == "":
+				if ev.name != "" || ev.data != "" {
+					events <- ev
+				}
+				ev = sseEvent{}
+			case strings.HasPrefix(line, "event: "):
+				ev.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return events
+}
+
+// nextSSE は次のイベントを返します。ストリームが閉じた場合は ok が false です。
+func nextSSE(t *testing.T, events <-chan sseEvent) (sseEvent, bool) {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		return ev, ok
+	case <-time.After(5 * time.Second):
+		t.Fatal("no SSE event")
+		return sseEvent{}, false
+	}
+}
+
+// openStream は GET /matchmaking/stream を開き、queued イベントまで読み込んだイベントのチャネルを返します。
+func openStream(t *testing.T, ctx context.Context, url, query string) <-chan sseEvent {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, "GET", url+"/matchmaking/stream?"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", res.StatusCode)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+	events := readSSE(res.Body)
+	if ev, ok := nextSSE(t, events); !ok || ev.name != "queued" {
+		t.Fatalf("first event = %+v, want queued", ev)
+	}
+	return events
+}
+
+func TestMatchmakingStreamDeliversMatch(t *testing.T) {
+	ts := newTestServer(t, nil)
+	srv := httptest.NewServer(ts.Server)
+	t.Cleanup(srv.Close)
+
+	events := openStream(t, context.Background(), srv.URL, "player_id=alice&rating=9999")
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	ts.clock.Advance(10 * time.Second)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+	receive(t, bob)
+
+	ev, ok := nextSSE(t, events)
+	if !ok || ev.name != "match" {
+		t.Fatalf("event = %+v, want match", ev)
+	}
+	var session model.SessionResult
+	if err := json.Unmarshal([]byte(ev.data), &session); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, p := range session.Participants {
+		ids = append(ids, p.ID)
+		// rating はクエリで指定されても使わない
+		if p.Rating == 9999 {
+			t.Errorf("%s rating = %d, want the stored rating", p.ID, p.Rating)
+		}
+	}
+	if slices.Sort(ids); !slices.Equal(ids, []string{"alice", "bob"}) {
+		t.Fatalf("session participants = %v, want alice and bob", ids)
+	}
+	// match イベントの後にストリームを閉じる
+	if ev, ok := nextSSE(t, events); ok {
+		t.Fatalf("event after match = %+v, want the stream closed", ev)
+	}
+}
+
+// クライアントが切断すると待機キューと通知の購読から削除する
+func TestMatchmakingStreamDisconnectDequeues(t *testing.T) {
+	ts := newTestServer(t, nil)
+	srv := httptest.NewServer(ts.Server)
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	openStream(t, ctx, srv.URL, "player_id=alice")
+	if ids := ts.queuedIDs(t); len(ids) != 1 {
+		t.Fatalf("queued = %v, want alice", ids)
+	}
+	cancel()
+	waitFor(t, "alice to leave the queue", func() bool { return len(ts.queuedIDs(t)) == 0 && ts.notifier.Len() == 0 })
+}
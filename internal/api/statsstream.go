@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+)
+
+// liveStats はダッシュボード向けのストリーム（GET /stats/stream）に使う、このインスタンスの待機キューとマッチングの集計です。
+// マッチングプロセッサーがセッションの保存後に待機キューの人数と成立を、待機のハンドラ（long-poll・SSE）がタイムアウトを更新します。
+// 件数は累計で、ストリームは前回のスナップショットとの差からレートを求めます。
+type liveStats struct {
+	mu sync.Mutex
+	// queueSizes はマッチングプロセッサーが最後に確認したゲームモードごとの待機プレイヤー数（成立したエントリを除く）で、
+	// queueAt はその時刻です。このインスタンスがマッチングを行っていない場合は更新されません。
+	queueSizes map[string]int
+	queueAt    time.Time
+	counters   liveStatsCounters
+}
+
+// newLiveStats は空の liveStats を生成します。
+func newLiveStats() *liveStats {
+	return &liveStats{queueSizes: make(map[string]int)}
+}
+
+// liveStatsCounters は liveStats の累計の件数です。
+type liveStatsCounters struct {
+	// Matches は作成したセッション数です。
+	Matches int64
+	// MatchedEntries はマッチングが成立したエントリ（ボットを除く）の数、WaitSeconds はその待機時間の合計です。
+	MatchedEntries int64
+	WaitSeconds    float64
+	// Timeouts は相手が見つからないまま待機時間を過ぎたエントリの数です。
+	Timeouts int64
+}
+
+// setQueue はマッチングプロセッサーが確認した待機中のエントリのうち、保存したロビーに含まれないものから
+// ゲームモードごとの待機プレイヤー数を更新します。now はマッチングを決定した時刻です。
+func (s *liveStats) setQueue(entries []model.QueueEntry, lobbies []queue.Lobby, now time.Time) {
+	matched := make(map[string]bool)
+	for _, l := range lobbies {
+		for _, e := range l.Entries() {
+			matched[e.Key()] = true
+		}
+	}
+	sizes := make(map[string]int)
+	for _, e := range entries {
+		if !matched[e.Key()] {
+			sizes[e.GameMode] += len(e.Players)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queueSizes = sizes
+	s.queueAt = now
+}
+
+// observeMatch はセッションの作成と、参加したエントリ（ボットを除く）の待機時間を記録します。
+func (s *liveStats) observeMatch(waits []time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters.Matches++
+	for _, w := range waits {
+		s.counters.MatchedEntries++
+		s.counters.WaitSeconds += w.Seconds()
+	}
+}
+
+// observeTimeout は待機のタイムアウトを記録します。
+func (s *liveStats) observeTimeout() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters.Timeouts++
+}
+
+// read は待機プレイヤー数（modes の全てのゲームモードを含む）とその時刻、累計の件数を返します。
+// マッチングプロセッサーが待機キューを確認していない場合、時刻はゼロ値です。
+func (s *liveStats) read(modes []string) (map[string]int, time.Time, liveStatsCounters) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sizes := make(map[string]int, len(modes))
+	for _, name := range modes {
+		sizes[name] = 0
+	}
+	for mode, n := range s.queueSizes {
+		sizes[mode] = n
+	}
+	return sizes, s.queueAt, s.counters
+}
+
+// readStats は liveStats の集計を返します。このインスタンスのマッチングプロセッサーが ProcessorMaxIdleInterval の2倍の間
+// 待機キューを確認していない場合（別のインスタンスがマッチングを行っている場合など）は、待機プレイヤー数を Store から読み込みます。
+func (s *Server) readStats(ctx context.Context, now time.Time) (map[string]int, liveStatsCounters) {
+	modes := s.cfg.Queue.GameModes.Names()
+	sizes, at, counters := s.queueStats.read(modes)
+	if !at.IsZero() && now.Sub(at) <= 2*s.cfg.Queue.ProcessorMaxIdleInterval {
+		return sizes, counters
+	}
+	rows, err := s.Store.ListQueuedPlayers(ctx)
+	if err != nil {
+		s.logger.WarnContext(ctx, "待機キューの取得エラー", "func", "readStats", "error", err)
+		return sizes, counters
+	}
+	sizes = make(map[string]int, len(modes))
+	for _, name := range modes {
+		sizes[name] = 0
+	}
+	for _, row := range rows {
+		sizes[row.GameMode]++
+	}
+	return sizes, counters
+}
+
+// statsSnapshot は GET /stats/stream で送るスナップショットです。
+// レート・平均は前回のスナップショットから（最初のスナップショットは接続してから）の間の値です。
+type statsSnapshot struct {
+	Time time.Time `json:"time"`
+	// QueueSize はゲームモードごとの待機プレイヤー数です。
+	QueueSize map[string]int `json:"queue_size"`
+	// MatchesPerSecond は1秒あたりに作成したセッション数です。
+	MatchesPerSecond float64 `json:"matches_per_second"`
+	// AverageWaitSeconds はマッチングが成立したエントリの平均待機時間です。成立がなかった場合は 0 です。
+	AverageWaitSeconds float64 `json:"average_wait_seconds"`
+	// TimeoutRate は待機を終えたエントリ（成立またはタイムアウト）のうちタイムアウトした割合です。どちらもなかった場合は 0 です。
+	TimeoutRate float64 `json:"timeout_rate"`
+	// Totals は累計の件数です。
+	Totals statsTotals `json:"totals"`
+}
+
+// statsTotals はスナップショットに含める累計の件数です。
+type statsTotals struct {
+	Matches        int64 `json:"matches"`
+	MatchedEntries int64 `json:"matched_entries"`
+	Timeouts       int64 `json:"timeouts"`
+}
+
+// newStatsSnapshot は前回（prev、elapsed 前）と今回（cur）の累計の差からスナップショットを作成します。
+func newStatsSnapshot(now time.Time, sizes map[string]int, prev, cur liveStatsCounters, elapsed time.Duration) statsSnapshot {
+	snap := statsSnapshot{
+		Time:      now.UTC(),
+		QueueSize: sizes,
+		Totals:    statsTotals{Matches: cur.Matches, MatchedEntries: cur.MatchedEntries, Timeouts: cur.Timeouts},
+	}
+	if elapsed > 0 {
+		snap.MatchesPerSecond = float64(cur.Matches-prev.Matches) / elapsed.Seconds()
+	}
+	matched := cur.MatchedEntries - prev.MatchedEntries
+	if matched > 0 {
+		snap.AverageWaitSeconds = (cur.WaitSeconds - prev.WaitSeconds) / float64(matched)
+	}
+	if finished := matched + cur.Timeouts - prev.Timeouts; finished > 0 {
+		snap.TimeoutRate = float64(cur.Timeouts-prev.Timeouts) / float64(finished)
+	}
+	return snap
+}
+
+// statsStreamHandler は待機キューとマッチングの集計を SSE（stats イベント）で StatsStreamInterval ごとに送ります（GET /stats/stream）。
+// 接続した直後に待機プレイヤー数のみのスナップショットを送り、以後は前回からの間のレート・平均を送ります。
+// 集計はこのインスタンスのもので、クライアントが切断すると送信をやめます。
+func (s *Server) statsStreamHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+
+	last := s.now()
+	sizes, prev := s.readStats(r.Context(), last)
+	send := func(snap statsSnapshot) bool {
+		data, _ := json.Marshal(snap)
+		if err := writeSSE(rc, w, "event: stats\ndata: "+string(data)+"\n\n"); err != nil {
+			s.logger.InfoContext(r.Context(), "stats stream closed", "reason", "write failed", "error", err)
+			return false
+		}
+		return true
+	}
+	if !send(newStatsSnapshot(last, sizes, prev, prev, 0)) {
+		return
+	}
+
+	ticker := time.NewTicker(s.cfg.StatsStreamInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			now := s.now()
+			sizes, cur := s.readStats(r.Context(), now)
+			if !send(newStatsSnapshot(now, sizes, prev, cur, now.Sub(last))) {
+				return
+			}
+			prev, last = cur, now
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
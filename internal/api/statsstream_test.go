@@ -0,0 +1,100 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/queue"
+)
+
+// statsEvents は GET /stats/stream の stats イベントを順に読み込みます。
+func statsEvents(t *testing.T, url string) <-chan statsSnapshot {
+	t.Helper()
+	res, err := http.Get(url + "/stats/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		res.Body.Close()
+	})
+	events := make(chan statsSnapshot)
+	go func() {
+		defer close(events)
+		sc := bufio.NewScanner(res.Body)
+		for sc.Scan() {
+			data, ok := strings.CutPrefix(sc.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var snap statsSnapshot
+			if err := json.Unmarshal([]byte(data), &snap); err != nil {
+				return
+			}
+			select {
+			case events <- snap:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return events
+}
+
+func nextSnapshot(t *testing.T, events <-chan statsSnapshot, cond func(statsSnapshot) bool) statsSnapshot {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case snap, ok := <-events:
+			if !ok {
+				t.Fatal("stats stream closed")
+			}
+			if cond(snap) {
+				return snap
+			}
+		case <-deadline:
+			t.Fatal("no matching stats snapshot")
+		}
+	}
+}
+
+func TestStatsStreamSnapshots(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) { c.StatsStreamInterval = 10 * time.Millisecond })
+	srv := httptest.NewServer(ts.Server)
+	t.Cleanup(srv.Close)
+
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+
+	// マッチングプロセッサーが待機キューを確認する前は、待機プレイヤー数を Store から読み込む
+	events := statsEvents(t, srv.URL)
+	first := nextSnapshot(t, events, func(statsSnapshot) bool { return true })
+	if first.QueueSize[queue.DefaultGameMode] != 1 || first.Totals.Matches != 0 {
+		t.Fatalf("first snapshot = %+v, want alice waiting and no matches", first)
+	}
+
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	ts.clock.Advance(10 * time.Second)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+	receive(t, alice)
+	receive(t, bob)
+
+	// 保存したセッションの参加者は待機プレイヤー数に含めない
+	second := nextSnapshot(t, events, func(s statsSnapshot) bool { return s.Totals.Matches == 1 })
+	if n := second.QueueSize[queue.DefaultGameMode]; n != 0 {
+		t.Errorf("queue size after the match = %d, want 0", n)
+	}
+	if second.Totals.MatchedEntries != 2 {
+		t.Errorf("matched entries = %d, want 2", second.Totals.MatchedEntries)
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+)
+
+// firstTwoMatcher はレーティングに関わらず先頭の2つのエントリを組み、呼び出された回数を数える Matcher です。
+type firstTwoMatcher struct {
+	calls int
+}
+
+func (m *firstTwoMatcher) Match(entries []model.QueueEntry, _ time.Time, _ queue.MatchPolicy) []queue.Lobby {
+	m.calls++
+	if len(entries) < 2 {
+		return nil
+	}
+	return []queue.Lobby{{GameMode: entries[0].GameMode, Teams: [][]model.QueueEntry{entries[:1], entries[1:2]}}}
+}
+
+// マッチングプロセッサーは Matcher のインターフェースだけを使い、渡したアルゴリズムで組む
+func TestProcessorUsesConfiguredMatcher(t *testing.T) {
+	ts := newTestServer(t, nil)
+	m := &firstTwoMatcher{}
+	ts.Server = NewServer(ts.store, m, slog.New(slog.NewTextHandler(io.Discard, nil)), ts.cfg)
+	ts.seedRatings(t, map[string]int{"alice": 1000, "bob": 2500})
+
+	session := ts.matchPair(t, "alice", "bob")
+	if m.calls == 0 || session.RatingGap != 1500 {
+		t.Fatalf("matcher called %d times, session gap %d, want alice and bob matched by the configured matcher", m.calls, session.RatingGap)
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval は証明書ファイルの更新を確認する最短の間隔です。
+// ハンドシェイクごとにファイルを確認しないよう、この間隔より短い間は読み込み済みの証明書を使います。
+const certCheckInterval = 10 * time.Second
+
+// tlsVersions は TLS_MIN_VERSION に指定できる値です。
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsCipherSuites は TLS 1.2 で使う暗号スイートです（前方秘匿性のある AEAD のみ）。TLS 1.3 の暗号スイートは Go が選びます。
+var tlsCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// certReloader は証明書と秘密鍵のファイルを読み込み、ファイルが更新されていれば読み込み直します。
+// 証明書の更新（cert-manager などによるファイルの置き換え）のたびにサービスを再起動しなくてよいようにするためのものです。
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// newCertReloader は証明書を読み込みます。読み込めない場合はエラーを返します（起動時に設定の誤りに気付けるようにする）。
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(time.Now()); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload は証明書と秘密鍵を読み込みます。呼び出し元で mu をロックしておくか、生成時に呼び出します。
+func (r *certReloader) reload(now time.Time) error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("証明書読み込みエラー: %v", err)
+	}
+	r.cert, r.modTime, r.checked = &cert, modTime, now
+	return nil
+}
+
+// latestModTime は証明書と秘密鍵のファイルのうち、新しい方の更新時刻を返します。
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("証明書ファイル確認エラー: %v", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// getCertificate は tls.Config.GetCertificate に設定する関数です。
+// ファイルが更新されていれば読み込み直します。読み込みに失敗した場合（置き換えの途中など）は、読み込み済みの証明書を使い続けます。
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if now.Sub(r.checked) < certCheckInterval {
+		return r.cert, nil
+	}
+	r.checked = now
+	modTime, err := r.latestModTime()
+	if err != nil || !modTime.After(r.modTime) {
+		if err != nil {
+			slog.Warn("証明書ファイル確認エラー", "func", "getCertificate", "error", err)
+		}
+		return r.cert, nil
+	}
+	if err := r.reload(now); err != nil {
+		slog.Warn("証明書の再読み込みに失敗しました。読み込み済みの証明書を使います", "func", "getCertificate", "error", err)
+		return r.cert, nil
+	}
+	slog.Info("TLS certificate reloaded", "cert_file", r.certFile)
+	return r.cert, nil
+}
+
+// NewServerTLSConfig は証明書と秘密鍵のファイルから HTTPS サーバの設定を生成します。
+// minVersion は TLS_MIN_VERSION の値（"1.2" または "1.3"、空の場合は 1.2）です。
+func NewServerTLSConfig(certFile, keyFile, minVersion string) (*tls.Config, error) {
+	if minVersion == "" {
+		minVersion = "1.2"
+	}
+	version, ok := tlsVersions[minVersion]
+	if !ok {
+		return nil, fmt.Errorf("TLS の最小バージョンが不正です（1.2 / 1.3）: %q", minVersion)
+	}
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:     version,
+		CipherSuites:   tlsCipherSuites,
+		GetCertificate: reloader.getCertificate,
+	}, nil
+}
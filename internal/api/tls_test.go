@@ -0,0 +1,181 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert は 127.0.0.1 向けの自己署名証明書と秘密鍵を dir に書き出し、ファイル名と証明書を返します。
+func writeSelfSignedCert(t *testing.T, dir, name string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+// serveTLS は cfg で HTTPS の Server を起動し、アドレスを返します。テストの終了時に停止します。
+func serveTLS(t *testing.T, h http.Handler, cfg *tls.Config) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: h, TLSConfig: cfg}
+	go srv.ServeTLS(ln, "", "")
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+// tlsClient は cert を信頼し、maxVersion までの TLS で接続するクライアントを返します。
+func tlsClient(cert *x509.Certificate, maxVersion uint16) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MaxVersion: maxVersion}}}
+}
+
+func TestServerTLSHandshake(t *testing.T) {
+	ts := newTestServer(t, nil)
+	certFile, keyFile, cert := writeSelfSignedCert(t, t.TempDir(), "matchmaking")
+	cfg, err := NewServerTLSConfig(certFile, keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTLS(t, ts.Server, cfg)
+
+	resp, err := tlsClient(cert, 0).Get("https://" + addr + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil || resp.TLS.Version < tls.VersionTLS12 {
+		t.Fatalf("status %d, TLS %+v, want 200 over TLS 1.2 or later", resp.StatusCode, resp.TLS)
+	}
+	// 既定の最小バージョンは 1.2
+	if _, err := tlsClient(cert, tls.VersionTLS11).Get("https://" + addr + "/healthz"); err == nil {
+		t.Fatal("TLS 1.1 handshake succeeded")
+	}
+	// 平文の HTTP では応答しない
+	if resp, err := http.Get("http://" + addr + "/healthz"); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Fatal("plain HTTP request succeeded")
+		}
+	}
+
+	cfg13, err := NewServerTLSConfig(certFile, keyFile, "1.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr13 := serveTLS(t, ts.Server, cfg13)
+	if _, err := tlsClient(cert, tls.VersionTLS12).Get("https://" + addr13 + "/healthz"); err == nil {
+		t.Fatal("TLS 1.2 handshake succeeded with TLS_MIN_VERSION=1.3")
+	}
+}
+
+func TestServerTLSConfigErrors(t *testing.T) {
+	certFile, keyFile, _ := writeSelfSignedCert(t, t.TempDir(), "matchmaking")
+	if _, err := NewServerTLSConfig(certFile, keyFile, "1.1"); err == nil {
+		t.Error("TLS_MIN_VERSION=1.1 accepted")
+	}
+	if _, err := NewServerTLSConfig(filepath.Join(t.TempDir(), "missing.crt"), keyFile, ""); err == nil {
+		t.Error("missing certificate file accepted")
+	}
+	if _, err := NewServerTLSConfig(keyFile, certFile, ""); err == nil {
+		t.Error("swapped certificate and key accepted")
+	}
+}
+
+// 証明書ファイルが置き換えられたら、再起動せずに新しい証明書を使う。読み込めない場合は読み込み済みの証明書を使い続ける
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, first := writeSelfSignedCert(t, dir, "first")
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := func() string {
+		t.Helper()
+		c, err := r.getCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := x509.ParseCertificate(c.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.Subject.CommonName
+	}
+	if got := leaf(); got != first.Subject.CommonName {
+		t.Fatalf("certificate = %s, want first", got)
+	}
+
+	writeSelfSignedCert(t, dir, "second")
+	later := time.Now().Add(time.Minute)
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// certCheckInterval の間はファイルを確認しない
+	if got := leaf(); got != "first" {
+		t.Fatalf("certificate within the check interval = %s, want first", got)
+	}
+	r.checked = time.Time{}
+	if got := leaf(); got != "second" {
+		t.Fatalf("certificate after the files changed = %s, want second", got)
+	}
+
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	latest := later.Add(time.Minute)
+	if err := os.Chtimes(certFile, latest, latest); err != nil {
+		t.Fatal(err)
+	}
+	r.checked = time.Time{}
+	if got := leaf(); got != "second" {
+		t.Fatalf("certificate after a broken replacement = %s, want the last good one", got)
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanExporter はテストで記録したスパンの出力先です。
+// tracing.Tracer はグローバルの TracerProvider に最初に設定したものへ委譲し続けるため、パッケージで1回だけ設定します。
+var spanExporter = sync.OnceValue(func() *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	return exporter
+})
+
+// recordSpans はテストの間に終了したスパンを記録し、記録したスパンを返す関数を返します。
+func recordSpans(t *testing.T) func() tracetest.SpanStubs {
+	exporter := spanExporter()
+	exporter.Reset()
+	t.Cleanup(exporter.Reset)
+	return exporter.GetSpans
+}
+
+// spansNamed は spans のうち name という名前のスパンを返します。
+func spansNamed(spans tracetest.SpanStubs, name string) tracetest.SpanStubs {
+	var out tracetest.SpanStubs
+	for _, s := range spans {
+		if s.Name == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// spanAttribute は span の key の属性を返します。
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// 待機キューへの登録リクエスト・マッチング・待機時間のスパンを記録し、登録リクエストのトレースから待機開始からマッチングまでをたどれる
+func TestMatchLifecycleSpans(t *testing.T) {
+	spans := recordSpans(t)
+	ts := newTestServer(t, nil)
+	alice := ts.startEnqueue(t, map[string]interface{}{"id": "alice"})
+	ts.waitQueued(t, 1)
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	ts.clock.Advance(7 * time.Second)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+	receive(t, alice)
+	receive(t, bob)
+
+	got := spans()
+	requests := spansNamed(got, "POST /matchmaking")
+	matches := spansNamed(got, "matchmaking.match")
+	waits := spansNamed(got, "matchmaking.queue_wait")
+	if len(requests) != 2 || len(matches) != 1 || len(waits) != 2 || len(spansNamed(got, "matchmaking.tick")) != 1 {
+		t.Fatalf("got %d requests, %d matches, %d queue waits and %d ticks, want 2, 1, 2 and 1", len(requests), len(matches), len(waits), len(spansNamed(got, "matchmaking.tick")))
+	}
+
+	// マッチングのスパンは2人の登録リクエストのスパンにリンクし、マッチングの処理の子になる
+	match := matches[0]
+	if match.Parent.SpanID() != spansNamed(got, "matchmaking.tick")[0].SpanContext.SpanID() {
+		t.Error("matchmaking.match is not a child of matchmaking.tick")
+	}
+	linked := make(map[trace.SpanID]bool)
+	for _, l := range match.Links {
+		linked[l.SpanContext.SpanID()] = true
+	}
+	for _, r := range requests {
+		if !linked[r.SpanContext.SpanID()] {
+			t.Errorf("matchmaking.match has no link to request span %s", r.SpanContext.SpanID())
+		}
+		if code := spanAttribute(r, "http.response.status_code").AsInt64(); code != http.StatusOK {
+			t.Errorf("request span status code = %d, want 200", code)
+		}
+	}
+
+	// 待機時間のスパンは登録リクエストのトレースに入り、待機開始からマッチングまでの時間を表す
+	session := spanAttribute(match, "matchmaking.session_id").AsString()
+	for _, w := range waits {
+		var parent *tracetest.SpanStub
+		for i, r := range requests {
+			if r.SpanContext.SpanID() == w.Parent.SpanID() && r.SpanContext.TraceID() == w.SpanContext.TraceID() {
+				parent = &requests[i]
+			}
+		}
+		if parent == nil {
+			t.Errorf("queue wait span %s is not in a request's trace", w.SpanContext.SpanID())
+		}
+		if d := w.EndTime.Sub(w.StartTime); d != 7*time.Second {
+			t.Errorf("queue wait lasted %v, want the 7s between joining and the match", d)
+		}
+		if s := spanAttribute(w, "matchmaking.session_id").AsString(); s != session || session == "" {
+			t.Errorf("queue wait session = %q, want %q", s, session)
+		}
+	}
+}
+
+// 呼び出し元が traceparent ヘッダーを付けた場合は、そのトレースの子としてリクエストのスパンを記録する
+func TestTracingMiddlewareContinuesCallerTrace(t *testing.T) {
+	spans := recordSpans(t)
+	ts := newTestServer(t, nil)
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	ts.do(t, "GET", "/modes", nil, http.Header{"Traceparent": {"00-" + traceID + "-" + parentID + "-01"}})
+	ts.do(t, "GET", "/modes", nil, nil)
+
+	requests := spansNamed(spans(), "GET /modes")
+	if len(requests) != 2 {
+		t.Fatalf("got %d request spans, want 2", len(requests))
+	}
+	if got := requests[0]; got.SpanContext.TraceID().String() != traceID || got.Parent.SpanID().String() != parentID || got.SpanKind != trace.SpanKindServer {
+		t.Errorf("span with traceparent: trace %s, parent %s, kind %v, want trace %s under %s", got.SpanContext.TraceID(), got.Parent.SpanID(), got.SpanKind, traceID, parentID)
+	}
+	if got := requests[1]; got.SpanContext.TraceID().String() == traceID || got.Parent.IsValid() {
+		t.Errorf("span without traceparent joined trace %s, want a new root span", got.SpanContext.TraceID())
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchmakingRequestValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name, body string
+		// field は details.field で返すフィールドです
+		field string
+	}{
+		{"empty id", `{"id":""}`, "id"},
+		{"missing id", `{"region":"asia"}`, "id"},
+		{"id too long", `{"id":"` + strings.Repeat("a", 65) + `"}`, "id"},
+		{"id with spaces", `{"id":"alice bob"}`, "id"},
+		{"id with a separator", `{"id":"alice:1"}`, "id"},
+		{"negative rating", `{"id":"alice","rating":-1}`, "rating"},
+		{"rating above the maximum", `{"id":"alice","rating":5001}`, "rating"},
+		{"unknown field", `{"id":"alice","is_admin":true}`, "is_admin"},
+		{"wrong type", `{"id":123}`, "id"},
+		{"party member id", `{"party_id":"p1","game_mode":"2v2","players":[{"id":"alice"},{"id":""}]}`, "players[1].id"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t, nil)
+			rec := ts.do(t, "POST", "/matchmaking", json.RawMessage(tc.body), nil)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400: %s", rec.Code, rec.Body)
+			}
+			var resp ErrorResponse
+			decodeJSON(t, rec, &resp)
+			if resp.Error.Code != errCodeInvalidRequest || resp.Error.Details["field"] != tc.field {
+				t.Fatalf("error = %+v, want %s for field %s", resp.Error, errCodeInvalidRequest, tc.field)
+			}
+			if ids := ts.queuedIDs(t); len(ids) != 0 {
+				t.Fatalf("queued = %v after a rejected request", ids)
+			}
+		})
+	}
+}
+
+func TestMatchmakingRequestLimits(t *testing.T) {
+	ts := newTestServer(t, nil)
+	large := `{"id":"alice","region":"` + strings.Repeat("a", maxRequestBodySize) + `"}`
+	if rec := ts.do(t, "POST", "/matchmaking", json.RawMessage(large), nil); rec.Code != http.StatusRequestEntityTooLarge || errorCode(t, rec) != errCodeRequestTooLarge {
+		t.Fatalf("oversized body: status %d: %s", rec.Code, rec.Body)
+	}
+	rec := ts.do(t, "GET", "/matchmaking", nil, nil)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET /matchmaking: status %d, want 405", rec.Code)
+	}
+	if allow := rec.Header().Get("Allow"); !strings.Contains(allow, "POST") {
+		t.Errorf("Allow = %q, want POST", allow)
+	}
+
+	// 上限ちょうどの ID とレーティングは受け付ける
+	id := strings.Repeat("a", 64)
+	longest := ts.startEnqueue(t, map[string]interface{}{"id": id, "rating": 5000})
+	ts.waitQueued(t, 1)
+	bob := ts.startEnqueue(t, map[string]interface{}{"id": "bob"})
+	ts.waitQueued(t, 2)
+	ts.clock.Advance(10 * time.Second)
+	if cycle := ts.tick(t); cycle.Matched != 1 {
+		t.Fatalf("tick created %d sessions, want 1", cycle.Matched)
+	}
+	for _, done := range []<-chan *httptest.ResponseRecorder{longest, bob} {
+		if rec := receive(t, done); rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+	}
+}
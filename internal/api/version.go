@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Build はビルドの情報です。main がビルド時に -ldflags で埋め込んだ値を渡します（README の build info を参照）。
+// 埋め込まなかった値は "unknown" のままですが、Commit と Time は Go が記録した VCS の情報があればそれを使います。
+type Build struct {
+	// Version はリリースのバージョンです（例: v1.4.0）。
+	Version string
+	// Commit はビルドした git のコミットです。
+	Commit string
+	// Time はビルドした時刻です（RFC 3339）。
+	Time string
+}
+
+// versionResponse は GET /version のレスポンスボディです。
+type versionResponse struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	// GoVersion はビルドに使った Go のバージョンです。
+	GoVersion string `json:"go_version"`
+	// StartedAt はプロセスの起動時刻、UptimeSeconds は起動からの経過時間（秒）です。
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+}
+
+// Info は started に起動したプロセスの、now の時点のビルドの情報と稼働時間を返します。
+func (b Build) Info(started, now time.Time) versionResponse {
+	info := versionResponse{
+		Version:       b.Version,
+		Commit:        b.Commit,
+		BuildTime:     b.Time,
+		GoVersion:     runtime.Version(),
+		StartedAt:     started.UTC(),
+		UptimeSeconds: int64(now.Sub(started) / time.Second),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "unknown":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildTime == "unknown":
+				info.BuildTime = s.Value
+			}
+		}
+	}
+	return info
+}
+
+// versionHandler はデプロイされているビルドのバージョン・コミット・ビルド時刻と、Go のバージョン、稼働時間を返します。
+func (s *Server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(s.cfg.Build.Info(s.started, s.now())); err != nil {
+		s.logger.ErrorContext(r.Context(), "レスポンスエンコードエラー", "func", "versionHandler", "error", err)
+	}
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/secret"
+	"matchmaking_project/internal/store"
+)
+
+// Webhook の署名ヘッダー。受信側は "<タイムスタンプ>.<ボディ>" の HMAC-SHA256（base64url）を WEBHOOK_SECRET で計算して比較し、
+// 古いタイムスタンプのリクエストを拒否することで再送（リプレイ）を防げます。
+const (
+	webhookTimestampHeader = "X-Matchmaking-Timestamp"
+	webhookSignatureHeader = "X-Matchmaking-Signature"
+)
+
+// webhookQueueSize は送信待ちのイベントの上限です。超えた分は送信せずに破棄します（遅い Webhook でマッチングを止めないため）。
+const webhookQueueSize = 256
+
+// webhookWorkers は Webhook へ同時に送信するゴルーチンの数の既定値です（環境変数 WEBHOOK_WORKERS）。
+const webhookWorkers = 4
+
+// webhookMaxAttempts は1つのイベントの送信を試みる最大回数です。
+const webhookMaxAttempts = 5
+
+// webhookRequestTimeout は Webhook への1回のリクエストの待ち時間の上限です。
+const webhookRequestTimeout = 5 * time.Second
+
+// webhookRetryBase, webhookRetryMax は送信失敗時の再試行までの待ち時間（指数的に延ばす）の初期値と上限です。
+const (
+	webhookRetryBase = 500 * time.Millisecond
+	webhookRetryMax  = 30 * time.Second
+)
+
+// Webhook で送信するイベントの種類（環境変数 WEBHOOK_EVENTS）です。
+const (
+	webhookEventMatch   = "match"
+	webhookEventEnqueue = "enqueue"
+	webhookEventTimeout = "timeout"
+)
+
+// webhookMatchEvent はマッチング成立時に送信するイベントです。従来の受信側と互換性を保つため、SessionResult の全フィールドを含めます。
+type webhookMatchEvent struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	model.SessionResult
+}
+
+// webhookEntryEvent は待機キューへの登録（enqueue）と、相手が見つからずに待機を終えたこと（timeout）を送信するイベントです。
+type webhookEntryEvent struct {
+	Type      string         `json:"type"`
+	Timestamp time.Time      `json:"timestamp"`
+	GameMode  string         `json:"game_mode"`
+	Region    string         `json:"region,omitempty"`
+	PartyID   string         `json:"party_id,omitempty"`
+	Players   []model.Player `json:"players"`
+}
+
+// webhookDelivery は1つの送信先へ送信するイベントです。
+type webhookDelivery struct {
+	URL  string
+	Type string
+	// ID はログに出力するイベントの識別子です（セッション ID またはエントリのキー）。
+	ID   string
+	Body []byte
+}
+
+// webhookDeadLetter は送信をあきらめたイベントとしてデッドレターログに書き込む1行です。
+type webhookDeadLetter struct {
+	Time     time.Time       `json:"time"`
+	URL      string          `json:"url"`
+	Type     string          `json:"type"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Event    json.RawMessage `json:"event"`
+}
+
+// webhookSender はマッチングのイベントを Webhook の送信先へ非同期に送信します。nil の webhookSender は何もしません。
+// 送信は workers 個のゴルーチンで行い、送信先ごとに独立して再試行します（遅い送信先があってもマッチングや他の送信先を止めない）。
+type webhookSender struct {
+	urls    []string
+	keys    *secret.KeyRing
+	events  map[string]bool
+	Workers int
+	client  *http.Client
+	queue   chan webhookDelivery
+	// DeadLetter は送信をあきらめたイベントを改行区切りの JSON で書き込む先です（環境変数 WEBHOOK_DEAD_LETTER）。nil の場合はログにのみ出力します。
+	DeadLetter   io.Writer
+	deadLetterMu sync.Mutex
+	// sleep は再試行までの待機です（停止時は待たずに false を返す）。
+	sleep func(ctx context.Context, d time.Duration) bool
+}
+
+// NewWebhookSender は urls の各送信先へ keys の最新の鍵で署名して events の種類のイベントを送信する webhookSender を生成します。
+func NewWebhookSender(urls []string, keys *secret.KeyRing, events []string) *webhookSender {
+	w := &webhookSender{
+		urls:    urls,
+		keys:    keys,
+		events:  make(map[string]bool, len(events)),
+		Workers: webhookWorkers,
+		client:  &http.Client{Timeout: webhookRequestTimeout},
+		queue:   make(chan webhookDelivery, webhookQueueSize),
+		sleep:   store.SleepContext,
+	}
+	for _, e := range events {
+		w.events[e] = true
+	}
+	return w
+}
+
+// ParseWebhookEvents は WEBHOOK_EVENTS（カンマ区切り）を解析します。空の場合は match のみです。
+func ParseWebhookEvents(v string) ([]string, error) {
+	events := model.SplitCommaList(v)
+	if len(events) == 0 {
+		return []string{webhookEventMatch}, nil
+	}
+	for _, e := range events {
+		switch e {
+		case webhookEventMatch, webhookEventEnqueue, webhookEventTimeout:
+		default:
+			return nil, fmt.Errorf("未知の Webhook イベントです（%s, %s, %s）: %q", webhookEventMatch, webhookEventEnqueue, webhookEventTimeout, e)
+		}
+	}
+	return events, nil
+}
+
+// enqueue はマッチングの成立を送信待ちに追加します。now はマッチングを決定した時刻です。
+func (w *webhookSender) enqueue(session model.SessionResult, now time.Time) {
+	if w == nil || !w.events[webhookEventMatch] {
+		return
+	}
+	w.publish(webhookEventMatch, session.SessionID, webhookMatchEvent{Type: webhookEventMatch, Timestamp: now, SessionResult: session})
+}
+
+// enqueueEntry は待機キューのエントリのイベント（enqueue / timeout）を送信待ちに追加します。
+func (w *webhookSender) enqueueEntry(typ string, entry model.QueueEntry, now time.Time) {
+	if w == nil || !w.events[typ] {
+		return
+	}
+	w.publish(typ, entry.Key(), webhookEntryEvent{Type: typ, Timestamp: now, GameMode: entry.GameMode, Region: entry.Region, PartyID: entry.PartyID, Players: entry.Players})
+}
+
+// publish はイベントを送信先ごとに送信待ちへ追加します。送信待ちが上限に達している場合は破棄します（ブロックしない）。
+func (w *webhookSender) publish(typ, id string, event any) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Webhook のボディ生成エラー", "func", "publish", "type", typ, "id", id, "error", err)
+		return
+	}
+	for _, url := range w.urls {
+		select {
+		case w.queue <- webhookDelivery{URL: url, Type: typ, ID: id, Body: body}:
+		default:
+			metrics.WebhookDeliveries.WithLabelValues("dropped").Inc()
+			slog.Warn("Webhook の送信待ちが上限に達したため破棄しました", "func", "publish", "type", typ, "id", id, "url", url, "queue_size", webhookQueueSize)
+		}
+	}
+}
+
+// Run は別ゴルーチンで動作し、workers 個のゴルーチンで送信待ちのイベントを送信します。
+func (w *webhookSender) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range w.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case d := <-w.queue:
+					w.deliver(ctx, d)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(w.queue); n > 0 {
+		slog.Warn("Webhook を送信せずに停止します", "func", "run", "pending", n)
+	}
+}
+
+// deliver はイベントを送信し、5xx・429 の応答や通信エラー（タイムアウトを含む）の場合は待ち時間を延ばしながら webhookMaxAttempts 回まで再試行します。
+// その他の 4xx は再試行しても成功しないため、すぐにあきらめます。あきらめたイベントはデッドレターログに書き込みます。
+func (w *webhookSender) deliver(ctx context.Context, d webhookDelivery) {
+	for attempt := 1; ; attempt++ {
+		err := w.post(ctx, d.URL, d.Body, time.Now())
+		if err == nil {
+			metrics.WebhookDeliveries.WithLabelValues("delivered").Inc()
+			return
+		}
+		var status *webhookStatusError
+		if attempt >= webhookMaxAttempts || (errors.As(err, &status) && !status.retryable()) {
+			metrics.WebhookDeliveries.WithLabelValues("failed").Inc()
+			slog.Error("Webhook 送信エラー", "func", "deliver", "type", d.Type, "id", d.ID, "url", d.URL, "attempts", attempt, "error", err)
+			w.writeDeadLetter(d, attempt, err)
+			return
+		}
+		delay := model.BackoffDelay(attempt, webhookRetryBase, webhookRetryMax)
+		slog.Warn("Webhook 送信エラー（再試行します）", "func", "deliver", "type", d.Type, "id", d.ID, "url", d.URL, "attempt", attempt, "retry_in", delay.String(), "error", err)
+		if !w.sleep(ctx, delay) {
+			metrics.WebhookDeliveries.WithLabelValues("failed").Inc()
+			return
+		}
+	}
+}
+
+// writeDeadLetter は送信をあきらめたイベントをデッドレターログに書き込みます。
+func (w *webhookSender) writeDeadLetter(d webhookDelivery, attempts int, cause error) {
+	if w.DeadLetter == nil {
+		return
+	}
+	line, err := json.Marshal(webhookDeadLetter{Time: time.Now(), URL: d.URL, Type: d.Type, Attempts: attempts, Error: cause.Error(), Event: d.Body})
+	if err != nil {
+		slog.Error("デッドレター生成エラー", "func", "writeDeadLetter", "id", d.ID, "error", err)
+		return
+	}
+	w.deadLetterMu.Lock()
+	defer w.deadLetterMu.Unlock()
+	if _, err := w.DeadLetter.Write(append(line, '\n')); err != nil {
+		slog.Error("デッドレター書き込みエラー", "func", "writeDeadLetter", "id", d.ID, "error", err)
+	}
+}
+
+// webhookStatusError は Webhook が 2xx 以外の応答を返したことを表すエラーです。
+type webhookStatusError struct {
+	Status     string
+	StatusCode int
+}
+
+func (e *webhookStatusError) Error() string {
+	return "unexpected status " + e.Status
+}
+
+// retryable は再試行すれば成功する可能性のある応答（5xx と 429）かどうかを返します。
+func (e *webhookStatusError) retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// post は署名付きで body を url へ1回送信します。2xx 以外の応答は *webhookStatusError として返します。
+func (w *webhookSender) post(ctx context.Context, url string, body []byte, now time.Time) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp, signature := webhookSignature(w.keys, body, now)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, signature)
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	// 接続を再利用できるよう、ボディを読み切ってから閉じる
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &webhookStatusError{Status: resp.Status, StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// webhookSignature は送信時刻のタイムスタンプ（Unix 秒）と、"<タイムスタンプ>.<ボディ>" に対する署名を返します。
+func webhookSignature(keys *secret.KeyRing, body []byte, now time.Time) (timestamp, signature string) {
+	timestamp = strconv.FormatInt(now.Unix(), 10)
+	msg := make([]byte, 0, len(timestamp)+1+len(body))
+	msg = append(append(append(msg, timestamp...), '.'), body...)
+	return timestamp, keys.Sign(msg)
+}
@@ -0,0 +1,349 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/secret"
+)
+
+// webhookRequest は受信側が受け取った1回分のリクエストです。
+type webhookRequest struct {
+	Header http.Header
+	Body   []byte
+}
+
+// webhookReceiver は受け取ったリクエストを記録し、statuses の順に応答する（尽きたら 200）httptest のサーバです。
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []webhookRequest
+	received chan webhookRequest
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	t.Helper()
+	r := &webhookReceiver{statuses: statuses, received: make(chan webhookRequest, 16)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		got := webhookRequest{Header: req.Header.Clone(), Body: body}
+		r.mu.Lock()
+		r.requests = append(r.requests, got)
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		r.mu.Unlock()
+		w.WriteHeader(status)
+		r.received <- got
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// Requests は受け取ったリクエストを順に返します。
+func (r *webhookReceiver) Requests() []webhookRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.requests)
+}
+
+// newTestWebhookSender は鍵 "webhook-secret" で署名し、再試行までの待ち時間を記録して待たずに進める webhookSender を返します。
+func newTestWebhookSender(t *testing.T, url string, events ...string) (*webhookSender, *[]time.Duration) {
+	t.Helper()
+	keys, err := secret.NewKeyRing("webhook-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) == 0 {
+		events = []string{webhookEventMatch}
+	}
+	w := NewWebhookSender([]string{url}, keys, events)
+	var delays []time.Duration
+	w.sleep = func(ctx context.Context, d time.Duration) bool {
+		delays = append(delays, d)
+		return ctx.Err() == nil
+	}
+	return w, &delays
+}
+
+// runWebhookSender は w の送信を開始し、テストの終了時に停止して送信中のイベントの終了を待ちます。
+func runWebhookSender(t *testing.T, w *webhookSender) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// verifyWebhookSignature は受信側と同じ手順（"<タイムスタンプ>.<ボディ>" の HMAC-SHA256）で署名を検証します。
+func verifyWebhookSignature(t *testing.T, key string, req webhookRequest) {
+	t.Helper()
+	timestamp := req.Header.Get(webhookTimestampHeader)
+	if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+		t.Fatalf("timestamp header = %q, want Unix seconds", timestamp)
+	}
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(timestamp + "." + string(req.Body)))
+	if want := base64.RawURLEncoding.EncodeToString(h.Sum(nil)); req.Header.Get(webhookSignatureHeader) != want {
+		t.Fatalf("signature = %q, want %q", req.Header.Get(webhookSignatureHeader), want)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	keys, err := secret.NewKeyRing("new-secret", "old-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"type":"match","session_id":"s1"}`)
+	now := time.Unix(1700000000, 0)
+
+	timestamp, signature := webhookSignature(keys, body, now)
+	if timestamp != "1700000000" {
+		t.Fatalf("timestamp = %q, want 1700000000", timestamp)
+	}
+	// 最新の鍵で署名する
+	verifyWebhookSignature(t, "new-secret", webhookRequest{
+		Header: http.Header{webhookTimestampHeader: {timestamp}, webhookSignatureHeader: {signature}},
+		Body:   body,
+	})
+	// タイムスタンプは署名の対象に含まれるため、書き換えると検証に失敗する
+	if err := keys.Verify([]byte("1700000001."+string(body)), signature); err == nil {
+		t.Fatal("signature verified with a different timestamp")
+	}
+	if _, other := webhookSignature(keys, []byte(`{"type":"match","session_id":"s2"}`), now); other == signature {
+		t.Fatal("different bodies produced the same signature")
+	}
+}
+
+// 5xx の応答は待ち時間を延ばしながら再試行し、同じボディを署名し直して送信する
+func TestWebhookRetriesWithBackoff(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusServiceUnavailable, http.StatusBadGateway)
+	w, delays := newTestWebhookSender(t, receiver.URL)
+	body := []byte(`{"type":"match","session_id":"s1"}`)
+
+	w.deliver(context.Background(), webhookDelivery{URL: receiver.URL, Type: webhookEventMatch, ID: "s1", Body: body})
+
+	requests := receiver.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("requests = %d, want 3 (two failures and a success)", len(requests))
+	}
+	for _, req := range requests {
+		if string(req.Body) != string(body) {
+			t.Errorf("body = %s, want %s", req.Body, body)
+		}
+		verifyWebhookSignature(t, "webhook-secret", req)
+	}
+	if want := []time.Duration{webhookRetryBase, 2 * webhookRetryBase}; !slices.Equal(*delays, want) {
+		t.Fatalf("retry delays = %v, want %v", *delays, want)
+	}
+}
+
+// マッチングが成立すると、SessionResult を含むイベントを署名付きで送信する
+func TestWebhookOnMatch(t *testing.T) {
+	receiver := newWebhookReceiver(t)
+	ts := newTestServer(t, nil)
+	ts.Webhook, _ = newTestWebhookSender(t, receiver.URL)
+	runWebhookSender(t, ts.Webhook)
+
+	session := ts.matchPair(t, "alice", "bob")
+	req := receiveWebhook(t, receiver)
+	verifyWebhookSignature(t, "webhook-secret", req)
+	if got := req.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	var event struct {
+		Type      string    `json:"type"`
+		Timestamp time.Time `json:"timestamp"`
+		model.SessionResult
+	}
+	if err := json.Unmarshal(req.Body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != webhookEventMatch || event.SessionID != session.SessionID || !event.Timestamp.Equal(testEpoch) {
+		t.Fatalf("event = %q %q at %v, want match %q at %v", event.Type, event.SessionID, event.Timestamp, session.SessionID, testEpoch)
+	}
+	if len(event.Participants) != 2 {
+		t.Fatalf("participants = %+v, want alice and bob", event.Participants)
+	}
+}
+
+// receiveWebhook は受信側が次のリクエストを受け取るまで待ちます。
+func receiveWebhook(t *testing.T, r *webhookReceiver) webhookRequest {
+	t.Helper()
+	select {
+	case req := <-r.received:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the webhook")
+		return webhookRequest{}
+	}
+}
+
+// 再試行をあきらめたイベントはデッドレターログに書き込む。再試行しても成功しない 4xx はすぐにあきらめる
+func TestWebhookDeadLetter(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		status       int
+		wantAttempts int
+	}{
+		{"server error", http.StatusInternalServerError, webhookMaxAttempts},
+		{"too many requests", http.StatusTooManyRequests, webhookMaxAttempts},
+		{"client error", http.StatusBadRequest, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			statuses := make([]int, webhookMaxAttempts)
+			for i := range statuses {
+				statuses[i] = tc.status
+			}
+			receiver := newWebhookReceiver(t, statuses...)
+			w, delays := newTestWebhookSender(t, receiver.URL)
+			var deadLetter bytes.Buffer
+			w.DeadLetter = &deadLetter
+			failed := testutil.ToFloat64(metrics.WebhookDeliveries.WithLabelValues("failed"))
+			body := []byte(`{"type":"match","session_id":"s1"}`)
+
+			w.deliver(context.Background(), webhookDelivery{URL: receiver.URL, Type: webhookEventMatch, ID: "s1", Body: body})
+
+			if got := len(receiver.Requests()); got != tc.wantAttempts {
+				t.Fatalf("requests = %d, want %d", got, tc.wantAttempts)
+			}
+			if len(*delays) != tc.wantAttempts-1 {
+				t.Fatalf("retry delays = %v, want %d", *delays, tc.wantAttempts-1)
+			}
+			if got := testutil.ToFloat64(metrics.WebhookDeliveries.WithLabelValues("failed")) - failed; got != 1 {
+				t.Errorf("failed deliveries counted = %v, want 1", got)
+			}
+			var line webhookDeadLetter
+			if err := json.Unmarshal(deadLetter.Bytes(), &line); err != nil {
+				t.Fatalf("dead letter %q: %v", deadLetter.String(), err)
+			}
+			if line.URL != receiver.URL || line.Type != webhookEventMatch || line.Attempts != tc.wantAttempts || line.Error == "" || string(line.Event) != string(body) {
+				t.Fatalf("dead letter = %+v, want the event after %d attempts", line, tc.wantAttempts)
+			}
+		})
+	}
+}
+
+// 応答が返らない（タイムアウトした）送信も再試行する
+func TestWebhookRetriesTimeouts(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+		if first {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	// 応答を止めたハンドラーを、サーバを閉じる前に終了させる
+	t.Cleanup(func() { close(release) })
+	w, delays := newTestWebhookSender(t, srv.URL)
+	w.client.Timeout = 50 * time.Millisecond
+	delivered := testutil.ToFloat64(metrics.WebhookDeliveries.WithLabelValues("delivered"))
+
+	w.deliver(context.Background(), webhookDelivery{URL: srv.URL, Type: webhookEventMatch, ID: "s1", Body: []byte(`{}`)})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 2 || len(*delays) != 1 {
+		t.Fatalf("requests = %d, retries = %v, want a retry after the timeout", calls, *delays)
+	}
+	if got := testutil.ToFloat64(metrics.WebhookDeliveries.WithLabelValues("delivered")) - delivered; got != 1 {
+		t.Errorf("delivered = %v, want 1", got)
+	}
+}
+
+// WEBHOOK_EVENTS で指定すると、待機キューへの登録とタイムアウトも {type, timestamp, game_mode, players} の形で送信する
+func TestWebhookEntryEvents(t *testing.T) {
+	receiver := newWebhookReceiver(t)
+	ts := newTestServer(t, func(cfg *Config) { cfg.Queue.MinTimeout = time.Second })
+	ts.Webhook, _ = newTestWebhookSender(t, receiver.URL, webhookEventEnqueue, webhookEventTimeout)
+	runWebhookSender(t, ts.Webhook)
+
+	rec := receive(t, ts.startEnqueue(t, map[string]interface{}{"id": "alice", "timeout_seconds": 1}))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status %d, want 504: %s", rec.Code, rec.Body)
+	}
+	var types []string
+	for range 2 {
+		req := receiveWebhook(t, receiver)
+		verifyWebhookSignature(t, "webhook-secret", req)
+		var event webhookEntryEvent
+		if err := json.Unmarshal(req.Body, &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.GameMode == "" || len(event.Players) != 1 || event.Players[0].ID != "alice" || event.Timestamp.IsZero() {
+			t.Fatalf("%s event = %+v, want alice's entry", event.Type, event)
+		}
+		types = append(types, event.Type)
+	}
+	// 送信は複数のゴルーチンで行うため、順序は問わない
+	slices.Sort(types)
+	if want := []string{webhookEventEnqueue, webhookEventTimeout}; !slices.Equal(types, want) {
+		t.Fatalf("event types = %v, want %v", types, want)
+	}
+}
+
+// 送信待ちが上限に達しても publish はブロックせず、あふれたイベントを破棄する
+func TestWebhookQueueNeverBlocks(t *testing.T) {
+	w, _ := newTestWebhookSender(t, "http://127.0.0.1:0")
+	dropped := testutil.ToFloat64(metrics.WebhookDeliveries.WithLabelValues("dropped"))
+	session := model.SessionResult{SessionID: "s1"}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range webhookQueueSize + 3 {
+			w.enqueue(session, testEpoch)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("enqueue blocked on a full send queue")
+	}
+	if got := len(w.queue); got != webhookQueueSize {
+		t.Fatalf("pending = %d, want %d", got, webhookQueueSize)
+	}
+	if got := testutil.ToFloat64(metrics.WebhookDeliveries.WithLabelValues("dropped")) - dropped; got != 3 {
+		t.Fatalf("dropped = %v, want 3", got)
+	}
+	// 指定されていない種類のイベントは送信しない
+	w.enqueueEntry(webhookEventEnqueue, model.QueueEntry{}, testEpoch)
+	if got := testutil.ToFloat64(metrics.WebhookDeliveries.WithLabelValues("dropped")) - dropped; got != 3 {
+		t.Fatalf("dropped = %v after an unsubscribed event, want 3", got)
+	}
+}
@@ -0,0 +1,185 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultStopTimeout はコンポーネントに停止期限が指定されていない場合の既定値です。
+const defaultStopTimeout = 5 * time.Second
+
+// Component はプロセスの起動・終了時に開始・停止する部品を表します。
+type Component struct {
+	Name string
+	// DependsOn は先に開始し、このコンポーネントより後に停止するコンポーネントの名前です。
+	DependsOn []string
+	Start     func(ctx context.Context) error
+	Stop      func(ctx context.Context) error
+	// StopTimeout は Stop の完了を待つ期限です。
+	StopTimeout time.Duration
+}
+
+// lifecycle は依存関係に従ってコンポーネントを開始し、逆順に停止します。
+type lifecycle struct {
+	components map[string]*Component
+	order      []string
+	started    []*Component
+}
+
+// New は空の lifecycle を生成します。
+func New() *lifecycle {
+	return &lifecycle{components: make(map[string]*Component)}
+}
+
+// Add はコンポーネントを登録します。
+func (l *lifecycle) Add(c Component) {
+	if _, dup := l.components[c.Name]; dup {
+		panic("lifecycle: duplicate component " + c.Name)
+	}
+	l.components[c.Name] = &c
+	l.order = append(l.order, c.Name)
+}
+
+// startOrder は依存先が必ず先に来る開始順を返します。
+func (l *lifecycle) startOrder() ([]*Component, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(l.components))
+	var order []*Component
+	var visit func(name string, from string) error
+	visit = func(name, from string) error {
+		c, ok := l.components[name]
+		if !ok {
+			return fmt.Errorf("%s が未登録のコンポーネント %s に依存しています", from, name)
+		}
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("コンポーネントの依存関係が循環しています: %s", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range c.DependsOn {
+			if err := visit(dep, name); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		order = append(order, c)
+		return nil
+	}
+	// 登録順に辿ることで、依存関係のないコンポーネント同士の順序を安定させる
+	for _, name := range l.order {
+		if err := visit(name, ""); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Start はコンポーネントを依存関係の順に開始します。既に開始したコンポーネントは開始し直しません。
+// 先に開始したコンポーネント（保存先など）を使って残りのコンポーネントを組み立てる場合は、Add の後に再度 Start を呼び出します。
+// 途中で失敗した場合は、それまでに開始したコンポーネントを停止してからエラーを返します。
+func (l *lifecycle) Start(ctx context.Context) error {
+	order, err := l.startOrder()
+	if err != nil {
+		return err
+	}
+	for _, c := range order {
+		if slices.Contains(l.started, c) {
+			continue
+		}
+		if c.Start != nil {
+			if err := c.Start(ctx); err != nil {
+				l.Stop()
+				return fmt.Errorf("%s の開始エラー: %v", c.Name, err)
+			}
+		}
+		l.started = append(l.started, c)
+		slog.Debug("component started", "component", c.Name)
+	}
+	return nil
+}
+
+// Stop は開始したコンポーネントを開始と逆の順に停止します。
+// 各コンポーネントは StopTimeout を過ぎると待つのをやめ、次のコンポーネントの停止に進みます。
+func (l *lifecycle) Stop() {
+	for i := len(l.started) - 1; i >= 0; i-- {
+		c := l.started[i]
+		if c.Stop == nil {
+			continue
+		}
+		timeout := c.StopTimeout
+		if timeout <= 0 {
+			timeout = defaultStopTimeout
+		}
+		begin := time.Now()
+		if err := stopWithTimeout(c, timeout); err != nil {
+			slog.Error("コンポーネント停止エラー", "component", c.Name, "duration", time.Since(begin), "error", err)
+			continue
+		}
+		slog.Info("component stopped", "component", c.Name, "duration", time.Since(begin))
+	}
+	l.started = nil
+}
+
+// stopWithTimeout は期限付きでコンポーネントの Stop を呼び出します。
+func stopWithTimeout(c *Component, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- c.Stop(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("停止期限（%s）を過ぎました", timeout)
+	}
+}
+
+// worker はキャンセルされるまで動き続けるバックグラウンド処理をコンポーネントとして扱うための補助です。
+type worker struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// WorkerComponent は run をゴルーチンで実行し、停止時に ctx をキャンセルして終了を待つコンポーネントを返します。
+func WorkerComponent(name string, dependsOn []string, run func(ctx context.Context)) Component {
+	w := &worker{}
+	return Component{
+		Name:      name,
+		DependsOn: dependsOn,
+		Start: func(context.Context) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			w.cancel = cancel
+			w.wg.Add(1)
+			go func() {
+				defer w.wg.Done()
+				run(ctx)
+			}()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			w.cancel()
+			done := make(chan struct{})
+			go func() {
+				w.wg.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
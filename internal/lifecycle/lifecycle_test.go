@@ -0,0 +1,121 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// componentLog は偽のコンポーネントの開始・停止の順序を記録します。
+type componentLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *componentLog) record(event string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+// fake は開始・停止を記録するコンポーネントを返します。
+func (l *componentLog) fake(name string, dependsOn ...string) Component {
+	return Component{
+		Name:      name,
+		DependsOn: dependsOn,
+		Start:     func(context.Context) error { l.record("start " + name); return nil },
+		Stop:      func(context.Context) error { l.record("stop " + name); return nil },
+	}
+}
+
+func TestLifecycleStopsInReverseDependencyOrder(t *testing.T) {
+	var log componentLog
+	lc := New()
+	// 依存先より先に登録しても、依存先から開始する
+	lc.Add(log.fake("processor", "store", "notifier"))
+	lc.Add(log.fake("outbox", "notifier"))
+	lc.Add(log.fake("notifier", "store"))
+	lc.Add(log.fake("store"))
+	if err := lc.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	lc.Stop()
+
+	want := []string{
+		"start store", "start notifier", "start processor", "start outbox",
+		"stop outbox", "stop processor", "stop notifier", "stop store",
+	}
+	if !slices.Equal(log.events, want) {
+		t.Fatalf("events = %q, want %q", log.events, want)
+	}
+}
+
+func TestLifecycleStartRejectsBadGraph(t *testing.T) {
+	var log componentLog
+	lc := New()
+	lc.Add(log.fake("a", "b"))
+	lc.Add(log.fake("b", "a"))
+	if err := lc.Start(context.Background()); err == nil {
+		t.Fatal("cyclic dependencies started")
+	}
+
+	lc = New()
+	lc.Add(log.fake("processor", "store"))
+	if err := lc.Start(context.Background()); err == nil {
+		t.Fatal("dependency on an unregistered component started")
+	}
+	if len(log.events) != 0 {
+		t.Fatalf("events = %q, want nothing started", log.events)
+	}
+}
+
+// 開始に失敗した場合は、それまでに開始したコンポーネントを逆順に停止する
+func TestLifecycleStartFailureStopsStarted(t *testing.T) {
+	var log componentLog
+	lc := New()
+	lc.Add(log.fake("store"))
+	lc.Add(log.fake("notifier", "store"))
+	broken := log.fake("processor", "notifier")
+	broken.Start = func(context.Context) error { return errors.New("boom") }
+	lc.Add(broken)
+	if err := lc.Start(context.Background()); err == nil {
+		t.Fatal("start succeeded")
+	}
+	want := []string{"start store", "start notifier", "stop notifier", "stop store"}
+	if !slices.Equal(log.events, want) {
+		t.Fatalf("events = %q, want %q", log.events, want)
+	}
+}
+
+// 停止期限を過ぎたコンポーネントは待たずに、依存先の停止に進む
+func TestLifecycleStopDeadline(t *testing.T) {
+	var log componentLog
+	release := make(chan struct{})
+	defer close(release)
+
+	lc := New()
+	lc.Add(log.fake("store"))
+	stuck := log.fake("writer", "store")
+	stuck.StopTimeout = 50 * time.Millisecond
+	stuck.Stop = func(context.Context) error {
+		// 停止期限を無視して止まらない
+		<-release
+		return nil
+	}
+	lc.Add(stuck)
+	if err := lc.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	begin := time.Now()
+	lc.Stop()
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Fatalf("stop took %v, want the 50ms deadline enforced", elapsed)
+	}
+	if want := []string{"start store", "start writer", "stop store"}; !slices.Equal(log.events, want) {
+		t.Fatalf("events = %q, want %q", log.events, want)
+	}
+}
@@ -0,0 +1,278 @@
+package metrics
+
+import (
+	"database/sql"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prometheus のメトリクス
+var (
+	// QueueDepth は待機キューに登録されているプレイヤー数です。マッチングプロセッサーが毎回更新します。
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "matchmaking_queue_depth",
+		Help: "Number of players in the matchmaking queue.",
+	})
+	// MatcherLeader はこのインスタンスがマッチングのロック（MATCHER_LEADER_ELECTION）を保持しているかどうかです。
+	MatcherLeader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "matchmaking_matcher_leader",
+		Help: "1 if this instance holds the matcher leader lock (MATCHER_LEADER_ELECTION), 0 otherwise.",
+	})
+	// QueueCapacity は待機キューに登録できるプレイヤー数の上限（MAX_QUEUE_SIZE）です。0 は無制限です。
+	QueueCapacity = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "matchmaking_queue_capacity",
+		Help: "Maximum number of players in the matchmaking queue (MAX_QUEUE_SIZE); 0 means unlimited.",
+	})
+	// EnqueuesInFlight はこのインスタンスで待機キューへの登録を実行中のリクエスト数です（MAX_CONCURRENT_ENQUEUES が上限）。
+	EnqueuesInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "matchmaking_enqueues_in_flight",
+		Help: "Number of enqueue requests on this instance currently performing database operations.",
+	})
+	// WaitingSubscribers はこのインスタンスでマッチング結果を待機している購読数です。
+	WaitingSubscribers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "matchmaking_waiting_subscribers",
+		Help: "Number of requests on this instance waiting for a match notification.",
+	})
+	MatchesCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "matchmaking_matches_created_total",
+		Help: "Number of sessions created by the matchmaking processor.",
+	}, []string{"mode"})
+	MatchmakingTimeouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "matchmaking_timeouts_total",
+		Help: "Number of matchmaking requests that timed out without an opponent.",
+	})
+	// MatchmakingSoftTimeouts は keep_waiting のリクエストが待機時間を過ぎ、待機キューに残したまま searching を返した回数です。
+	MatchmakingSoftTimeouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "matchmaking_soft_timeouts_total",
+		Help: "Number of keep_waiting requests answered with a poll token instead of a timeout.",
+	})
+	MatchmakingCancellations = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "matchmaking_cancellations_total",
+		Help: "Number of matches declined or not delivered during the ready check.",
+	})
+	// MatchmakingAbandoned は結果を待っているリクエスト（long-poll・SSE）のクライアントがいなくなり、待機キューから削除した回数です。
+	// reason はクライアントの切断（client_disconnected）、書き込み期限までに受信しなかったクライアント（slow_consumer）またはサーバの停止（server_shutdown）で、
+	// タイムアウト（MatchmakingTimeouts）とは別に数えます。
+	MatchmakingAbandoned = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "matchmaking_waits_abandoned_total",
+		Help: "Number of waiting requests removed from the queue because the client went away, by cause.",
+	}, []string{"reason"})
+	// NoShows は中止されたセッションに現れなかった参加者の数です（reason は承諾しなかった accept_timeout、またはゲームサーバが報告した reported）。
+	NoShows = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "matchmaking_no_shows_total",
+		Help: "Number of participants who never showed up for a session, by how it was detected.",
+	}, []string{"reason"})
+	// MatchCooldowns はマッチング成立後に辞退した、またはゲームに現れなかったため設定したクールダウンの数です（reason は declined・no_show・accept_timeout・abandoned）。
+	MatchCooldowns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "matchmaking_cooldowns_total",
+		Help: "Number of matchmaking cooldowns applied to players who declined, abandoned or never showed up, by reason.",
+	}, []string{"reason"})
+	HandlerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "matchmaking_handler_errors_total",
+		Help: "Number of internal errors returned by HTTP handlers.",
+	}, []string{"handler"})
+	// RateLimited はレート制限で拒否したリクエスト数です（scope は ip または player）。
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "matchmaking_rate_limited_total",
+		Help: "Number of requests rejected by the rate limiter.",
+	}, []string{"scope"})
+	// MatchWaitSeconds は待機キューへの登録からマッチング成立までの時間です（waiting_since から算出）。
+	MatchWaitSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "matchmaking_wait_seconds",
+		Help:    "Time from enqueue to match, computed from waiting_since.",
+		Buckets: []float64{1, 2, 5, 10, 15, 20, 30, 45, 60, 120},
+	})
+	// MatchQualityScore は作成したセッションのマッチ品質スコア（0〜100）です。
+	MatchQualityScore = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "matchmaking_match_quality",
+		Help:    "Match quality score (0-100) of created sessions.",
+		Buckets: prometheus.LinearBuckets(10, 10, 10),
+	}, []string{"mode"})
+	// SessionAllocations はゲームサーバの割り当ての結果です（result は allocated、failed、保存できなかったセッションの released）。
+	SessionAllocations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "matchmaking_session_allocations_total",
+		Help: "Number of game server allocations for new sessions, by mode and result.",
+	}, []string{"mode", "result"})
+	// AllocationSeconds はゲームサーバの割り当て1回にかかった時間です。
+	AllocationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "matchmaking_session_allocation_seconds",
+		Help:    "Time spent allocating a game server for a new session.",
+		Buckets: prometheus.DefBuckets,
+	})
+	// SessionsExpired は結果が報告されないまま SessionTTL を過ぎ、期限切れにしたセッション数です。
+	SessionsExpired = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "matchmaking_sessions_expired_total",
+		Help: "Number of active sessions expired because no result was reported within the TTL.",
+	})
+	// AuditWriteFailures は記録できなかった監査イベントの数です。
+	AuditWriteFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "matchmaking_audit_write_failures_total",
+		Help: "Number of audit events that could not be written.",
+	})
+	// SessionsAbandoned は参加者が force を指定して待機キューへ登録し直したため中止したセッション数です。
+	SessionsAbandoned = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "matchmaking_sessions_abandoned_total",
+		Help: "Number of unfinished sessions aborted because a participant re-enqueued with force.",
+	})
+	// ModeClosedRemovals は受付時間の終了で待機キューから削除したプレイヤー数です。
+	ModeClosedRemovals = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "matchmaking_mode_closed_removals_total",
+		Help: "Number of queued players removed because their game mode closed.",
+	}, []string{"mode"})
+	// RatingDecays は対戦していない期間が続き、レーティングを DefaultRating へ近づけたプレイヤー数です。
+	RatingDecays = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "matchmaking_rating_decays_total",
+		Help: "Number of rating decays applied to inactive players.",
+	})
+	// WebhookDeliveries は Webhook の送信結果（delivered / failed / dropped）ごとのセッション数です。
+	WebhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "matchmaking_webhook_deliveries_total",
+		Help: "Number of match webhooks by outcome (delivered, failed after retries, dropped because the queue was full).",
+	}, []string{"result"})
+	// NotificationRedeliveries はアウトボックスから通知し直したマッチング結果の数です（result は delivered または aborted）。
+	NotificationRedeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "matchmaking_notification_redeliveries_total",
+		Help: "Number of match notifications recovered from the outbox, by outcome (delivered, or aborted because the client had given up).",
+	}, []string{"result"})
+	// QueueRejections は待機キューが上限（MAX_QUEUE_SIZE）に達していたため拒否した登録の数です。
+	QueueRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "matchmaking_queue_rejections_total",
+		Help: "Number of joins rejected because the matchmaking queue was full.",
+	})
+	// EnqueueBusyRejections は待機キューへの登録を同時に行うリクエストが上限（MAX_CONCURRENT_ENQUEUES）に達していたため拒否した数です。
+	EnqueueBusyRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "matchmaking_enqueue_busy_rejections_total",
+		Help: "Number of joins rejected because too many enqueue requests were in flight.",
+	})
+	// AbsentEntriesSkipped は、ロビーに選ばれたが結果を待っているクライアントがいなかったため、マッチングから外したエントリの数です（マッチングのたびに数えます）。
+	AbsentEntriesSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "matchmaking_absent_entries_skipped_total",
+		Help: "Number of queue entries left out of a match because no client was waiting for the result.",
+	})
+	// SelfMatchesRejected は、同じプレイヤーを2回含んでいたためセッションを作成しなかったロビーの数です。
+	SelfMatchesRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "matchmaking_self_matches_rejected_total",
+		Help: "Number of lobbies dropped because they contained the same player more than once.",
+	})
+	// EventsDropped は書き込み待ちが上限に達したため破棄した分析用イベントの数です。
+	EventsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "matchmaking_events_dropped_total",
+		Help: "Number of analytics events dropped because the event log queue was full.",
+	})
+	// DBRetries はマッチングプロセッサーが一時的な DB エラー（切断・デッドロック・ロック待ちのタイムアウト）で再試行した回数です。
+	DBRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "matchmaking_db_retries_total",
+		Help: "Number of matchmaking transactions retried after a transient database error.",
+	})
+	// DBClockSkew は起動時に確認した DB の NOW() とアプリの時刻の差です（DB が進んでいる場合は正）。
+	DBClockSkew = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "matchmaking_db_clock_skew_seconds",
+		Help: "Difference between the database NOW() and the application clock measured at startup.",
+	})
+	// ProcessorLag はマッチングプロセッサーの直前の処理の開始から今回の処理の開始までの時間です。
+	// 通常は PROCESSOR_INTERVAL 以下で（登録の通知で早まる）、大きく超える場合は処理が詰まっているか DB エラーでバックオフしています。
+	ProcessorLag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "matchmaking_processor_lag_seconds",
+		Help: "Time between the start of the previous and the latest matchmaking processor cycle.",
+	})
+	// ProcessorCycleFailures はマッチングプロセッサーの処理が（再試行の後も）失敗した回数です。
+	ProcessorCycleFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "matchmaking_processor_cycle_failures_total",
+		Help: "Number of matchmaking processor cycles that failed.",
+	})
+)
+
+// MetricsDB はメトリクスで接続プールの状態を報告する DB です。storeComponent が MySQL に接続した後に設定します（memory では nil のまま）。
+var MetricsDB atomic.Pointer[sql.DB]
+
+// dbPoolStats は MetricsDB の接続プールの状態を返します。DB に接続していない場合はゼロ値です。
+func dbPoolStats() sql.DBStats {
+	if db := MetricsDB.Load(); db != nil {
+		return db.Stats()
+	}
+	return sql.DBStats{}
+}
+
+// 接続プールのメトリクスは収集のたびに sql.DB.Stats から読み取ります。
+var (
+	dbOpenConnections = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "matchmaking_db_open_connections",
+		Help: "Number of established connections to the database, both in use and idle.",
+	}, func() float64 { return float64(dbPoolStats().OpenConnections) })
+	dbInUseConnections = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "matchmaking_db_in_use_connections",
+		Help: "Number of database connections currently in use.",
+	}, func() float64 { return float64(dbPoolStats().InUse) })
+	dbIdleConnections = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "matchmaking_db_idle_connections",
+		Help: "Number of idle database connections.",
+	}, func() float64 { return float64(dbPoolStats().Idle) })
+	dbMaxOpenConnectionsGauge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "matchmaking_db_max_open_connections",
+		Help: "Maximum number of open connections to the database (DB_MAX_OPEN_CONNS).",
+	}, func() float64 { return float64(dbPoolStats().MaxOpenConnections) })
+	// dbWaitCount, dbWaitSeconds は接続プールが上限に達していて、空きの接続を待った回数と合計時間です。増え続ける場合は DB_MAX_OPEN_CONNS が不足しています。
+	dbWaitCount = prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "matchmaking_db_wait_count_total",
+		Help: "Number of times a query waited for a free database connection.",
+	}, func() float64 { return float64(dbPoolStats().WaitCount) })
+	dbWaitSeconds = prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "matchmaking_db_wait_seconds_total",
+		Help: "Total time spent waiting for a free database connection.",
+	}, func() float64 { return dbPoolStats().WaitDuration.Seconds() })
+)
+
+// RegisterMetrics はメトリクスを reg に登録します。
+func RegisterMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		QueueDepth,
+		WaitingSubscribers,
+		QueueCapacity,
+		EnqueuesInFlight,
+		MatcherLeader,
+		MatchesCreated,
+		MatchmakingTimeouts,
+		MatchmakingSoftTimeouts,
+		MatchmakingCancellations,
+		MatchmakingAbandoned,
+		NoShows,
+		MatchCooldowns,
+		DBClockSkew,
+		HandlerErrors,
+		RateLimited,
+		MatchWaitSeconds,
+		MatchQualityScore,
+		SessionAllocations,
+		AllocationSeconds,
+		SessionsExpired,
+		SessionsAbandoned,
+		AuditWriteFailures,
+		RatingDecays,
+		ModeClosedRemovals,
+		WebhookDeliveries,
+		QueueRejections,
+		EnqueueBusyRejections,
+		NotificationRedeliveries,
+		AbsentEntriesSkipped,
+		SelfMatchesRejected,
+		DBRetries,
+		ProcessorLag,
+		ProcessorCycleFailures,
+		dbOpenConnections,
+		dbInUseConnections,
+		dbIdleConnections,
+		dbMaxOpenConnectionsGauge,
+		dbWaitCount,
+		dbWaitSeconds,
+		EventsDropped,
+		StoreQuerySeconds,
+	)
+}
+
+// StoreQuerySeconds はクエリ名ごとの実行時間です。
+var StoreQuerySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "matchmaking_store_query_seconds",
+	Help:    "Latency of store queries by query name.",
+	Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+}, []string{"query"})
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// プレイヤーの属性の入力値の制限
+const (
+	maxPlayerAttributes      = 16
+	MaxAttributeKeyLength    = 32
+	maxAttributeValueLength  = 64
+	AttributeKeyAllowedChars = "letters, digits, '_' and '-'"
+)
+
+// validateAttributes はクライアントから受け取った属性を検証します。field はエラーで返すフィールド名です。
+func validateAttributes(field string, attrs map[string]string) error {
+	if len(attrs) > maxPlayerAttributes {
+		return &FieldError{Field: field, Message: fmt.Sprintf("at most %d attributes are allowed", maxPlayerAttributes)}
+	}
+	for key, value := range attrs {
+		if len(key) > MaxAttributeKeyLength || !IDPattern.MatchString(key) {
+			return &FieldError{Field: field, Message: fmt.Sprintf("attribute key %q must be 1-%d characters of %s", key, MaxAttributeKeyLength, AttributeKeyAllowedChars)}
+		}
+		if utf8.RuneCountInString(value) > maxAttributeValueLength || !utf8.ValidString(value) {
+			return &FieldError{Field: field + "." + key, Message: fmt.Sprintf("attribute value must be valid UTF-8 of at most %d characters", maxAttributeValueLength)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"fmt"
+)
+
+// maxPingMS は POST /matchmaking の ping_ms に指定できる最大値（ミリ秒）です。
+const maxPingMS = 10000
+
+// validatePing はクライアントが申告した ping（ミリ秒）が範囲内であることを確認します。0 は未計測として扱います。
+func validatePing(field string, ping int) error {
+	if ping < 0 || ping > maxPingMS {
+		return &FieldError{Field: field, Message: fmt.Sprintf("ping_ms must be between 0 and %d", maxPingMS)}
+	}
+	return nil
+}
+
+// PingMS はエントリの ping（ミリ秒）を返します。パーティはメンバーのうち最も大きい ping です。0 は未計測です。
+func (e QueueEntry) PingMS() int {
+	ping := 0
+	for _, p := range e.Players {
+		ping = max(ping, p.PingMS)
+	}
+	return ping
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// FewestGamesPlayed はエントリのメンバーの対戦数のうち最も少ないものを返します（ボットは配置戦を終えたものとして扱います）。
+func (e QueueEntry) FewestGamesPlayed() int {
+	fewest := math.MaxInt
+	for _, p := range e.Players {
+		if !p.IsBot {
+			fewest = min(fewest, p.GamesPlayed)
+		}
+	}
+	return fewest
+}
+
+// RatingSeeds は初めてマッチングに参加するプレイヤーの初期レーティングです。
+// 申告が外れていても配置戦の大きな K 係数で補正されます。
+type RatingSeeds struct {
+	// Default は腕前を申告していないプレイヤーの初期レーティングです（環境変数 DEFAULT_RATING）。
+	Default int
+	// Skills は申告された腕前（self_reported_skill）ごとの初期レーティングです（環境変数 SKILL_SEED_RATINGS）。
+	Skills map[string]int
+}
+
+// DefaultRatingSeeds は既定の初期レーティングを返します。
+func DefaultRatingSeeds() RatingSeeds {
+	return RatingSeeds{Default: 1200, Skills: map[string]int{"beginner": 1000, "intermediate": 1200, "advanced": 1400}}
+}
+
+// validateSkill は申告された腕前が Skills に含まれることを確認します。空文字（申告なし）は受け付けます。
+func (r RatingSeeds) validateSkill(field, skill string) error {
+	if _, ok := r.Skills[skill]; skill == "" || ok {
+		return nil
+	}
+	skills := make([]string, 0, len(r.Skills))
+	for s := range r.Skills {
+		skills = append(skills, s)
+	}
+	sort.Strings(skills)
+	return &FieldError{Field: field, Message: fmt.Sprintf("unknown skill %q (valid: %s)", skill, strings.Join(skills, ", ")), Details: map[string]interface{}{"valid": skills}}
+}
+
+// Seed は申告された腕前に応じた、新しく作成するプレイヤーの初期レーティングを返します。
+func (r RatingSeeds) Seed(skill string) int {
+	if rating, ok := r.Skills[skill]; ok {
+		return rating
+	}
+	return r.Default
+}
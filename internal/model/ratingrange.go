@@ -0,0 +1,48 @@
+package model
+
+import (
+	"fmt"
+)
+
+// RatingRange はクライアントが指定した、相手として受け入れるレーティングの範囲です（POST /matchmaking の min_rating / max_rating / max_delta）。
+// 各値の 0 は制限なしです。待機時間が長くなっても緩めないため、条件を満たす相手がいなければ通常どおりタイムアウトします。
+type RatingRange struct {
+	// Min は相手のレーティング（パーティは平均）の下限です。
+	Min int `json:"min_rating,omitempty"`
+	// Max は相手のレーティング（パーティは平均）の上限です。
+	Max int `json:"max_rating,omitempty"`
+	// MaxDelta は自分と相手のレーティング（パーティは平均）の差の上限です。
+	MaxDelta int `json:"max_delta,omitempty"`
+}
+
+// Validate はレーティングの範囲の指定が正しいことを確認します。
+func (r RatingRange) Validate() error {
+	if r.Min < 0 || r.Min > MaxRating {
+		return &FieldError{Field: "min_rating", Message: fmt.Sprintf("min_rating must be between %d and %d", MinRating, MaxRating)}
+	}
+	if r.Max < 0 || r.Max > MaxRating {
+		return &FieldError{Field: "max_rating", Message: fmt.Sprintf("max_rating must be between %d and %d", MinRating, MaxRating)}
+	}
+	if r.Max > 0 && r.Min > r.Max {
+		return &FieldError{Field: "max_rating", Message: fmt.Sprintf("max_rating %d is less than min_rating %d", r.Max, r.Min)}
+	}
+	if r.MaxDelta < 0 || r.MaxDelta > MaxRating || (r.MaxDelta > 0 && r.MaxDelta < MinRatingGapPreference) {
+		return &FieldError{Field: "max_delta", Message: fmt.Sprintf("max_delta must be 0 (no limit) or between %d and %d", MinRatingGapPreference, MaxRating)}
+	}
+	return nil
+}
+
+// Accepts は自分のレーティングが rating の場合に、レーティングが opponent の相手を受け入れるかどうかを返します。
+func (r RatingRange) Accepts(rating, opponent int) bool {
+	if opponent < r.Min {
+		return false
+	}
+	if r.Max > 0 && opponent > r.Max {
+		return false
+	}
+	return r.MaxDelta <= 0 || RatingDistance(rating, opponent) <= r.MaxDelta
+}
+
+// MinRatingGapPreference はクライアントが指定できる相手とのレーティングの差の上限（preferences.max_rating_gap・max_delta）の最小値です。
+// 同じレーティングの相手しか受け入れないような指定では、いつまでもマッチングしないためです。
+const MinRatingGapPreference = 50
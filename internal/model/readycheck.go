@@ -0,0 +1,43 @@
+package model
+
+import (
+	"errors"
+)
+
+// セッションの状態
+const (
+	// SessionPendingAccept は参加者全員の承諾待ちの状態です。
+	SessionPendingAccept = "pending_accept"
+	// SessionActive は参加者全員が承諾し、確定した状態です。
+	SessionActive = "active"
+	// SessionAborted は承諾されずに（または参加者がゲームに現れずに）中止された状態です。
+	SessionAborted = "aborted"
+	// SessionExpired は確定後、結果が報告されないまま SessionTTL を過ぎたため終了したものとみなした状態です。
+	SessionExpired = "expired"
+	// SessionCompleted はゲームサーバから対戦結果が報告され、終了した状態です。
+	SessionCompleted = "completed"
+)
+
+// 報告された対戦結果の種類（SessionResult.Outcome）
+const (
+	// OutcomeWin は WinningTeam のチームが勝利した結果です。
+	OutcomeWin = "win"
+	// OutcomeDraw は引き分けです。参加者のレーティングは Elo の引き分けの式（スコア 0.5）で更新します。
+	OutcomeDraw = "draw"
+	// OutcomeCancelled はゲームが成立せずに取り消された結果です。レーティングは変更しません。
+	OutcomeCancelled = "cancelled"
+)
+
+// 参加者ごとの承諾状態
+const (
+	ReadyPending  = "pending"
+	ReadyAccepted = "accepted"
+	ReadyDeclined = "declined"
+	// ReadyNoShow はゲームサーバが、参加者がゲームに現れなかったと報告した状態です（POST /sessions/{id}/noshow）。
+	ReadyNoShow = "no_show"
+	// ReadyAbandoned は参加者が force を指定して待機キューへ登録し直したため、セッションを放棄した状態です。
+	ReadyAbandoned = "abandoned"
+)
+
+// ErrSessionNotFound は指定したセッション（または参加者）が存在しない場合のエラーです。
+var ErrSessionNotFound = errors.New("session not found")
@@ -0,0 +1,22 @@
+package model
+
+// OpponentSet は最近対戦したプレイヤーの組み合わせの集合です。
+type OpponentSet map[[2]string]bool
+
+// Add はプレイヤー a と b の組み合わせを追加します。
+func (s OpponentSet) Add(a, b string) {
+	s[OpponentPair(a, b)] = true
+}
+
+// Has はプレイヤー a と b が最近対戦したかどうかを返します。
+func (s OpponentSet) Has(a, b string) bool {
+	return s[OpponentPair(a, b)]
+}
+
+// OpponentPair は順序によらない組み合わせのキーを返します。
+func OpponentPair(a, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
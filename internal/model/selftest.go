@@ -0,0 +1,14 @@
+package model
+
+import (
+	"strings"
+)
+
+// SelftestPlayerPrefix は --selftest で作成する合成プレイヤーの ID の接頭辞です。
+// マッチングプロセッサーは合成プレイヤーを実際のプレイヤーとマッチングせず、クライアントはこの接頭辞の ID を使えません。
+const SelftestPlayerPrefix = "__selftest-"
+
+// IsSyntheticPlayer はプレイヤー ID がセルフテストの合成プレイヤーのものかどうかを返します。
+func IsSyntheticPlayer(id string) bool {
+	return strings.HasPrefix(id, SelftestPlayerPrefix)
+}
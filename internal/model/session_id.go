@@ -0,0 +1,49 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"regexp"
+)
+
+// SessionID はセッションの ID です。推測されないよう、暗号論的乱数による UUID（バージョン 4）を使用します。
+type SessionID string
+
+// sessionIDPattern は UUID バージョン 4 の小文字表記です。
+var sessionIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// legacySessionIDPattern は UUID に切り替える前の時刻ベースの ID です。移行前に作成されたセッションを扱えるよう受け付けます。
+var legacySessionIDPattern = regexp.MustCompile(`^session-[0-9]{1,20}$`)
+
+// errInvalidSessionID はセッション ID の形式が不正であることを表します。
+var errInvalidSessionID = errors.New("invalid session id")
+
+// NewSessionID は新しいセッション ID を生成します。
+func NewSessionID() SessionID {
+	var b [16]byte
+	// crypto/rand.Read は失敗しない（失敗した場合はプロセスを終了する）
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // バージョン 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 のバリアント
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:36], b[10:16])
+	return SessionID(buf[:])
+}
+
+// Validate は ID がセッション ID の形式かどうかを確認します。DB に問い合わせる前に不正な ID を拒否するために使います。
+func (id SessionID) Validate() error {
+	if sessionIDPattern.MatchString(string(id)) || legacySessionIDPattern.MatchString(string(id)) {
+		return nil
+	}
+	return errInvalidSessionID
+}
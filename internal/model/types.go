@@ -0,0 +1,349 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Player はユーザ情報を表します。
+type Player struct {
+	ID     string `json:"id"`
+	Rating int    `json:"rating"`
+	// Region はプレイヤーの接続地域です（例: "ap-northeast"）。同じ地域のプレイヤー同士を優先してマッチングします。
+	Region string `json:"region,omitempty"`
+	// PingMS はクライアントが計測したゲームサーバまでの往復時間（ミリ秒）です。0 は未計測です。
+	PingMS int `json:"ping_ms,omitempty"`
+	// WaitingSince は待機キューに登録された時刻です（レスポンスには含めません）。
+	WaitingSince time.Time `json:"-"`
+	// ExpiresAt は待機キューのエントリの有効期限です（レスポンスには含めません）。
+	ExpiresAt time.Time `json:"-"`
+	// Priority は待機キューでの優先度です（レスポンスには含めません）。
+	Priority int `json:"-"`
+	// GamesPlayed はマッチング時点の対戦数です（レスポンスには含めません）。配置戦中かどうかの判定に使います。
+	GamesPlayed int `json:"-"`
+	// RatingRange は待機キューのエントリで指定された相手のレーティングの範囲です（レスポンスには含めません）。
+	// 中止されたセッションから待機キューへ戻す際に引き継ぎます。
+	RatingRange RatingRange `json:"-"`
+	// IsBot は待機時間が長いプレイヤーの相手として生成したボットかどうかです（BOT_FILL_AFTER）。
+	IsBot bool `json:"is_bot,omitempty"`
+	// SelfReportedSkill はパーティのメンバーが申告した腕前です（リクエストのみ）。未登録のプレイヤーの初期レーティングに使います。
+	SelfReportedSkill string `json:"self_reported_skill,omitempty"`
+	// Attributes はゲーム固有の条件（例: "crossplay": "off", "language": "ja"）です。
+	// MatchAttributeKeys に含まれるキーは、値が一致するプレイヤー同士でのみマッチングします。
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// プレイヤー情報の入力値の制限
+const (
+	// maxPlayerIDLength は players.player_id の列長に合わせたプレイヤー ID の最大長です。
+	maxPlayerIDLength = 64
+	MinRating         = 0
+	MaxRating         = 5000
+)
+
+// Validate はクライアントから受け取ったプレイヤー情報を検証します。申告された腕前は seeds に含まれている必要があります。
+func (p Player) Validate(seeds RatingSeeds) error {
+	if err := ValidateID("id", p.ID, "player id"); err != nil {
+		return err
+	}
+	if IsSyntheticPlayer(p.ID) {
+		return &FieldError{Field: "id", Message: fmt.Sprintf("player id must not start with %q", SelftestPlayerPrefix)}
+	}
+	if p.Rating < MinRating || p.Rating > MaxRating {
+		return &FieldError{Field: "rating", Message: fmt.Sprintf("rating %d of player %q is out of range (%d-%d)", p.Rating, p.ID, MinRating, MaxRating)}
+	}
+	if err := seeds.validateSkill("self_reported_skill", p.SelfReportedSkill); err != nil {
+		return err
+	}
+	if err := validateAttributes("attributes", p.Attributes); err != nil {
+		return err
+	}
+	return validatePing("ping_ms", p.PingMS)
+}
+
+// IDPattern はプレイヤー ID とパーティ ID に使える文字です。ログやキーの区切り文字と衝突しないよう、英数字と _ - に限ります。
+var IDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidateID は ID が空でなく、maxPlayerIDLength 以下で IDPattern の文字のみからなることを確認します。
+func ValidateID(field, id, what string) error {
+	if id == "" {
+		return &FieldError{Field: field, Message: what + " is required"}
+	}
+	if len(id) > maxPlayerIDLength {
+		return &FieldError{Field: field, Message: fmt.Sprintf("%s must be at most %d characters", what, maxPlayerIDLength)}
+	}
+	if !IDPattern.MatchString(id) {
+		return &FieldError{Field: field, Message: what + " may only contain letters, digits, '_' and '-'"}
+	}
+	return nil
+}
+
+// FieldError はリクエストの特定のフィールドの検証エラーです。Field はレスポンスの details.field で返します。
+type FieldError struct {
+	Field   string
+	Message string
+	// Details は許可される範囲など、details.field と合わせて返す値です。
+	Details map[string]interface{}
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+// PlayerProfile はサーバ側で管理しているプレイヤー情報を表します。
+type PlayerProfile struct {
+	ID          string    `json:"id"`
+	Rating      int       `json:"rating"`
+	GamesPlayed int       `json:"games_played"`
+	CreatedAt   time.Time `json:"created_at"`
+	// WinLossRecord は報告された対戦結果の勝ち・負け・引き分けの数です（取り消された結果は数えない）。
+	WinLossRecord
+}
+
+// WinLossRecord は報告された対戦結果の勝ち・負け・引き分けの数です。
+type WinLossRecord struct {
+	Wins   int `json:"wins"`
+	Losses int `json:"losses"`
+	Draws  int `json:"draws"`
+}
+
+// Add は r に other を加えた成績を返します。
+func (r WinLossRecord) Add(other WinLossRecord) WinLossRecord {
+	return WinLossRecord{Wins: r.Wins + other.Wins, Losses: r.Losses + other.Losses, Draws: r.Draws + other.Draws}
+}
+
+// HeadToHead はプレイヤー（PlayerID）から見た、相手（OpponentID）との対戦成績です。
+type HeadToHead struct {
+	PlayerID   string `json:"player_id"`
+	OpponentID string `json:"opponent_id"`
+	WinLossRecord
+}
+
+// QueueEntry は待機キュー上のマッチング単位（ソロのプレイヤー、またはパーティ）を表します。
+type QueueEntry struct {
+	// PartyID はパーティで参加している場合のパーティIDです。ソロの場合は空文字です。
+	PartyID string
+	Players []Player
+	// Rating はメンバーの平均レーティングです。
+	Rating       int
+	Region       string
+	GameMode     string
+	WaitingSince time.Time
+	// Priority はマッチングでの優先度です（0〜MaxQueuePriority）。値が大きいエントリから先に相手を探します。
+	Priority int
+	// ExpiresAt はエントリの有効期限です。この時刻以降はクライアントが応答できないものとして扱います。
+	ExpiresAt time.Time
+	// Timeout はリクエストで指定された待機時間です。0 の場合はゲームモードの待機時間を使います。
+	// 待機しているリクエストだけのもので、待機キューには保存しません。
+	Timeout time.Duration
+	// KeepWaiting は待機時間を過ぎても 504 を返さず、SoftTimeoutMaxWait まで待機を続けるかどうかです（Timeout と同じくリクエストだけのもの）。
+	KeepWaiting bool
+	// RatingRange はクライアントが指定した、相手として受け入れるレーティングの範囲です。
+	RatingRange RatingRange
+	// ReplaceSession は、メンバーが未終了のセッションに参加している場合にそのセッションを放棄して登録するかどうかです（リクエストの force。Timeout と同じくリクエストだけのもの）。
+	ReplaceSession bool
+	// Abandoned は ReplaceSession により登録の際に放棄（中止）したセッションです。EnqueueEntry が設定します。
+	Abandoned []SessionResult
+	// TraceParent は待機キューへ登録したリクエストのスパンの文脈（W3C traceparent）です。空文字の場合はトレースしていません。
+	// マッチングは別のゴルーチン（または別のインスタンス）で行うため、待機キューに保存してマッチングのスパンから登録リクエストをたどれるようにします。
+	TraceParent string
+}
+
+// Key は Notifier 上でこのエントリを識別するキーを返します。
+func (e QueueEntry) Key() string {
+	if e.PartyID != "" {
+		return "party:" + e.PartyID
+	}
+	return e.Players[0].ID
+}
+
+// Participant はセッションの参加者と所属チームを表します。
+type Participant struct {
+	Player
+	// Team は 1 始まりのチーム番号です。
+	Team    int    `json:"team"`
+	PartyID string `json:"party_id,omitempty"`
+	// ReadyState はマッチング成立後の承諾状態（pending / accepted / declined / no_show / abandoned）です。
+	ReadyState string `json:"ready_state,omitempty"`
+	// Requeued はセッションが中止された際に、元の待機開始時刻のまま待機キューへ戻されたかどうかです。
+	// 戻された場合は再度 POST /matchmaking を呼び出すことで待機を再開できます。
+	Requeued bool `json:"requeued,omitempty"`
+}
+
+// SessionResult は対戦セッションの結果を表します。
+type SessionResult struct {
+	SessionID string `json:"session_id"`
+	GameMode  string `json:"game_mode"`
+	// Region はゲームサーバのデータセンター選択に使う地域です。空文字の場合は地域の指定なし（global）です。
+	Region string `json:"region,omitempty"`
+	// GameServer はセッションに割り当てたゲームサーバの接続先です。SessionAllocator で割り当てた場合のみ設定されます。
+	GameServer *GameServer `json:"game_server,omitempty"`
+	// Status はセッションの状態（pending_accept / active / aborted / expired / completed）です。
+	Status string `json:"status"`
+	// Outcome は報告された対戦結果の種類（win / draw / cancelled）です。結果が報告されていない場合は空文字です。
+	Outcome string `json:"outcome,omitempty"`
+	// WinningTeam は報告された対戦結果で勝利したチームの番号です。勝敗のついた結果が報告されていない場合は 0 です。
+	WinningTeam int `json:"winning_team,omitempty"`
+	// AcceptDeadline は承諾待ちのセッションで、参加者全員が承諾しなければならない期限です。
+	AcceptDeadline *time.Time `json:"accept_deadline,omitempty"`
+	// StartedAt はセッションの成立時刻です。保存済みのセッションを取得した場合にだけ設定されます。
+	StartedAt    *time.Time    `json:"started_at,omitempty"`
+	Participants []Participant `json:"participants"`
+	// Player1, Player2 は2チーム制のモードにおける各チームの先頭プレイヤーです（1対1 の従来のレスポンス形式との互換のため）。
+	Player1 *Player `json:"player1,omitempty"`
+	Player2 *Player `json:"player2,omitempty"`
+	// Quality はマッチング時点で算出した 0〜100 のマッチ品質スコアです。
+	Quality int `json:"quality"`
+	// RatingGap はチーム平均レーティングの最大差、WinProbability は平均レーティングが最も高いチームの Elo の式による期待勝率です。
+	RatingGap      int     `json:"rating_gap"`
+	WinProbability float64 `json:"win_probability"`
+	// MaxWaitSeconds, MinWaitSeconds はマッチング時点のボットを除く参加者の待機時間の最大・最小（秒）です。
+	MaxWaitSeconds float64 `json:"max_wait_seconds"`
+	MinWaitSeconds float64 `json:"min_wait_seconds"`
+	// Bots は参加者にボットが含まれるかどうかです。
+	Bots bool `json:"bots,omitempty"`
+	// Spectators は観戦者のプレイヤーIDです（追加した順）。
+	Spectators []string `json:"spectators,omitempty"`
+	// MatchToken はゲームサーバがセッションへの参加を確認するための署名付きトークンです（MATCH_TOKEN_SECRET が未設定の場合は空）。
+	MatchToken string `json:"match_token,omitempty"`
+}
+
+// ErrAlreadyQueued は既に待機キューに登録済みのプレイヤー（パーティメンバーを含む）が再度登録しようとした場合のエラーです。
+var ErrAlreadyQueued = errors.New("player is already in the matchmaking queue")
+
+// PlayerIDs はプレイヤーのIDの一覧を返します。
+func PlayerIDs(players []Player) []string {
+	ids := make([]string, len(players))
+	for i, p := range players {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+// EntriesPlayers はエントリに含まれる全プレイヤーを返します。
+func EntriesPlayers(entries []QueueEntry) []Player {
+	var players []Player
+	for _, e := range entries {
+		players = append(players, e.Players...)
+	}
+	return players
+}
+
+// AverageRating はプレイヤーの平均レーティングを返します。
+func AverageRating(players []Player) int {
+	if len(players) == 0 {
+		return 0
+	}
+	sum := 0
+	for _, p := range players {
+		sum += p.Rating
+	}
+	return sum / len(players)
+}
+
+// SetBots は参加者にボットが含まれるかどうかを Bots に設定します。
+func (s *SessionResult) SetBots() {
+	s.Bots = false
+	for _, p := range s.Participants {
+		if p.IsBot {
+			s.Bots = true
+			return
+		}
+	}
+}
+
+// SetHeadToHead は2チーム制のセッション（参加者のチームが 1 と 2 のみ）の場合に、各チームの先頭プレイヤーを Player1, Player2 に設定します。
+func (s *SessionResult) SetHeadToHead() {
+	for _, p := range s.Participants {
+		if p.Team > 2 {
+			return
+		}
+	}
+	for i := range s.Participants {
+		p := s.Participants[i].Player
+		switch {
+		case s.Participants[i].Team == 1 && s.Player1 == nil:
+			s.Player1 = &p
+		case s.Participants[i].Team == 2 && s.Player2 == nil:
+			s.Player2 = &p
+		}
+	}
+}
+
+// BackoffDelay は attempt 回目（1 始まり）の再試行までの待機時間を返します。base から倍々に延ばし、max を上限とします。
+func BackoffDelay(attempt int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= max {
+			return max
+		}
+	}
+	return d
+}
+
+// GameServer はセッションのために割り当てた専用のゲームサーバの接続先です。
+type GameServer struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+// IsBotEntry はエントリがボットのものかどうかを返します。
+func (e QueueEntry) IsBotEntry() bool {
+	return len(e.Players) > 0 && e.Players[0].IsBot
+}
+
+// RatingDistance はレーティングの差の絶対値を返します。
+func RatingDistance(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// SplitCommaList はカンマ区切りの値を空白を除いて分割します。空の要素は無視します。
+func SplitCommaList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ExpiresSoon はエントリの有効期限が now から margin 以内（または期限切れ）かどうかを返します。
+// 有効期限がないエントリ（ExpiresAt がゼロ値）は期限切れになりません。
+func (e QueueEntry) ExpiresSoon(now time.Time, margin time.Duration) bool {
+	return !e.ExpiresAt.IsZero() && !now.Add(margin).Before(e.ExpiresAt)
+}
+
+// HumanPlayerIDs はボットを除く参加者のプレイヤーIDを返します（チーム順）。
+func (s SessionResult) HumanPlayerIDs() []string {
+	var ids []string
+	for _, p := range s.Participants {
+		if !p.IsBot {
+			ids = append(ids, p.ID)
+		}
+	}
+	return ids
+}
+
+// IsStarving はエントリの待機時間が threshold を超えているかどうかを返します。threshold が 0 以下の場合は常に false です。
+func (e QueueEntry) IsStarving(now time.Time, threshold time.Duration) bool {
+	return threshold > 0 && now.Sub(e.WaitingSince) >= threshold
+}
+
+// MaxQueuePriority は POST /matchmaking の priority に指定できる最大値です（プレミアム会員向けの優先枠など）。
+const MaxQueuePriority = 10
+
+// EffectivePriority は now の時点でのエントリの優先度を返します。待機時間が ceiling を超えた場合は MaxQueuePriority です。
+func (e QueueEntry) EffectivePriority(now time.Time, ceiling time.Duration) int {
+	if ceiling > 0 && now.Sub(e.WaitingSince) >= ceiling {
+		return MaxQueuePriority
+	}
+	return e.Priority
+}
@@ -0,0 +1,40 @@
+package queue
+
+import (
+	"fmt"
+
+	"matchmaking_project/internal/model"
+)
+
+// ParseMatchAttributeKeys はカンマ区切りの属性のキーを解析します。
+func ParseMatchAttributeKeys(v string) ([]string, error) {
+	var keys []string
+	for _, key := range model.SplitCommaList(v) {
+		if len(key) > model.MaxAttributeKeyLength || !model.IDPattern.MatchString(key) {
+			return nil, fmt.Errorf("属性のキーが不正です（%s のみ、%d 文字以内）: %q", model.AttributeKeyAllowedChars, model.MaxAttributeKeyLength, key)
+		}
+		for _, k := range keys {
+			if k == key {
+				return nil, fmt.Errorf("属性のキーが重複しています: %q", key)
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// canMatchAttributes は2つのエントリの全プレイヤーが keys の属性で同じ値を持つかどうかを判定します。
+// 属性を指定していないプレイヤーは空文字として比較するため、指定したプレイヤーとは組みません。keys が空の場合は常に true です。
+func canMatchAttributes(e1, e2 model.QueueEntry, keys []string) bool {
+	for _, key := range keys {
+		want := e1.Players[0].Attributes[key]
+		for _, e := range [2]model.QueueEntry{e1, e2} {
+			for _, p := range e.Players {
+				if p.Attributes[key] != want {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
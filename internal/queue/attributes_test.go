@@ -0,0 +1,44 @@
+package queue
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// attributedEntry は attrs の属性を持つプレイヤーの待機エントリを返します。
+func attributedEntry(now time.Time, id string, wait time.Duration, attrs map[string]string) model.QueueEntry {
+	e := waitingEntry(now, id, "asia", wait)
+	e.Players[0].Attributes = attrs
+	return e
+}
+
+// 設定したキーの属性が異なるプレイヤーは組まず、設定していないキーの属性は比較しない
+func TestFindLobbiesMatchAttributes(t *testing.T) {
+	now := testEpoch
+	policy := MatchPolicy{Modes: DefaultModes(), MatchAttributes: []string{"crossplay"}}
+	for _, tc := range []struct {
+		name  string
+		alice map[string]string
+		bob   map[string]string
+		want  []string
+	}{
+		{"required attribute differs", map[string]string{"crossplay": "off"}, map[string]string{"crossplay": "on"}, []string{}},
+		{"required attribute missing on one side", map[string]string{"crossplay": "off"}, nil, []string{}},
+		{"ignored attribute differs", map[string]string{"crossplay": "off", "language": "ja"}, map[string]string{"crossplay": "off", "language": "en"}, []string{"alice-bob"}},
+		{"no attributes", nil, nil, []string{"alice-bob"}},
+	} {
+		entries := []model.QueueEntry{attributedEntry(now, "alice", time.Hour, tc.alice), attributedEntry(now, "bob", time.Hour, tc.bob)}
+		if got := lobbyPairs(FindLobbies(entries, now, policy)); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: lobbies = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// キーを設定しなければ属性が異なっても組む
+	entries := []model.QueueEntry{attributedEntry(now, "alice", 0, map[string]string{"crossplay": "off"}), attributedEntry(now, "bob", 0, map[string]string{"crossplay": "on"})}
+	if got := lobbyPairs(FindLobbies(entries, now, MatchPolicy{Modes: DefaultModes()})); !slices.Equal(got, []string{"alice-bob"}) {
+		t.Errorf("without keys: lobbies = %v, want alice-bob", got)
+	}
+}
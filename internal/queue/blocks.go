@@ -0,0 +1,21 @@
+package queue
+
+import (
+	"matchmaking_project/internal/model"
+)
+
+// blocksEither は2つのエントリのメンバーのいずれかが、もう一方のメンバーをブロックしているかどうかを返します。
+// 再戦の回避（avoidsRematch）と異なり、待機時間によらず組み合わせません。
+func blocksEither(e1, e2 model.QueueEntry, blocked model.OpponentSet) bool {
+	if len(blocked) == 0 {
+		return false
+	}
+	for _, p1 := range e1.Players {
+		for _, p2 := range e2.Players {
+			if blocked.Has(p1.ID, p2.ID) {
+				return true
+			}
+		}
+	}
+	return false
+}
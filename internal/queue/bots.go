@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// botRatingSpread はボットのレーティングを相手のエントリのレーティングからずらす最大幅です。
+const botRatingSpread = 50
+
+// botIDPrefix はボットのプレイヤー ID の接頭辞です。
+const botIDPrefix = "bot-"
+
+// BotProfile は設定で用意したボットの ID とレーティングです。
+type BotProfile struct {
+	ID     string
+	Rating int
+}
+
+// ParseBotProfiles は "bot-easy:900,bot-hard:1600" 形式のボットのプロフィールを解析します。
+// ID は botIDPrefix で始まり、レーティングは MinRating〜MaxRating の範囲である必要があります。
+func ParseBotProfiles(v string) ([]BotProfile, error) {
+	var profiles []BotProfile
+	seen := make(map[string]bool)
+	for _, item := range model.SplitCommaList(v) {
+		id, ratingStr, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("ボットのプロフィールは id:rating の形式で指定してください: %q", item)
+		}
+		if err := model.ValidateID("id", id, "bot id"); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(id, botIDPrefix) {
+			return nil, fmt.Errorf("ボットの ID は %q で始まる必要があります: %q", botIDPrefix, id)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("ボットの ID が重複しています: %q", id)
+		}
+		seen[id] = true
+		rating, err := strconv.Atoi(ratingStr)
+		if err != nil || rating < model.MinRating || rating > model.MaxRating {
+			return nil, fmt.Errorf("ボット %q のレーティングが不正です（%d〜%d）: %q", id, model.MinRating, model.MaxRating, ratingStr)
+		}
+		profiles = append(profiles, BotProfile{ID: id, Rating: rating})
+	}
+	return profiles, nil
+}
+
+// pickBotProfile は pool のうち used に含まれないプロフィールから、レーティングが rating に最も近いものを返します。
+// 差が同じ場合は pool で先にあるものを選びます。使えるプロフィールがない場合は false を返します。
+func pickBotProfile(pool []BotProfile, rating int, used map[string]bool) (BotProfile, bool) {
+	best, found := BotProfile{}, false
+	for _, p := range pool {
+		if used[p.ID] {
+			continue
+		}
+		if !found || model.RatingDistance(p.Rating, rating) < model.RatingDistance(best.Rating, rating) {
+			best, found = p, true
+		}
+	}
+	return best, found
+}
+
+// newBotEntry はレーティングが rating に近いボット1体のエントリを生成します。
+// pool にロビー内でまだ使っていない（used に含まれない）プロフィールがあれば最も近いものを使い、なければ乱数で生成します。
+// 使ったボットの ID は used に追加します。
+func newBotEntry(rating int, region string, now time.Time, pool []BotProfile, used map[string]bool, rng *rand.Rand) model.QueueEntry {
+	profile, ok := pickBotProfile(pool, rating, used)
+	if !ok {
+		r := rating + rng.IntN(2*botRatingSpread+1) - botRatingSpread
+		profile = BotProfile{ID: fmt.Sprintf("%s%016x", botIDPrefix, rng.Uint64()), Rating: min(max(r, model.MinRating), model.MaxRating)}
+	}
+	used[profile.ID] = true
+	bot := model.Player{
+		ID:           profile.ID,
+		Rating:       profile.Rating,
+		Region:       region,
+		WaitingSince: now,
+		IsBot:        true,
+	}
+	return model.QueueEntry{Players: []model.Player{bot}, Rating: profile.Rating, Region: region, WaitingSince: now}
+}
+
+// FillWithBots は、ロビーに入らなかったエントリのうち待機時間が after を超えたものを、空きをボットで埋めたロビーにします。
+// ロビーの大きさは modes のゲームモードの設定に従い、ボットは pool のプロフィールから選びます（同じロビーには同じボットを入れない）。
+// 同じ乱数列に対しては常に同じ結果を返します。after が 0 以下の場合は何もしません。
+func FillWithBots(entries []model.QueueEntry, lobbies []Lobby, now time.Time, after, expiryMargin time.Duration, modes Modes, pool []BotProfile, rng *rand.Rand) []Lobby {
+	if after <= 0 {
+		return nil
+	}
+	matched := make(map[string]bool)
+	for _, l := range lobbies {
+		for _, e := range l.Entries() {
+			matched[e.Key()] = true
+		}
+	}
+
+	var filled []Lobby
+	for _, e := range entries {
+		if matched[e.Key()] || now.Sub(e.WaitingSince) < after || e.ExpiresSoon(now, expiryMargin) {
+			continue
+		}
+		mode, ok := modes[e.GameMode]
+		if !ok || len(e.Players) > mode.TeamSize() {
+			continue
+		}
+		used := make(map[string]bool)
+		teams := make([][]model.QueueEntry, mode.TeamCount())
+		teams[0] = []model.QueueEntry{e}
+		inRange := true
+		for t := range teams {
+			size := 0
+			for _, member := range teams[t] {
+				size += len(member.Players)
+			}
+			for ; size < mode.TeamSize(); size++ {
+				bot := newBotEntry(e.Rating, e.Region, now, pool, used, rng)
+				inRange = inRange && canMatchRatingRange(e, bot)
+				teams[t] = append(teams[t], bot)
+			}
+		}
+		// クライアントが指定したレーティングの範囲外のボットとは組ませない（範囲内の相手が来なければタイムアウトする）
+		if !inRange {
+			continue
+		}
+		filled = append(filled, Lobby{GameMode: e.GameMode, Teams: teams})
+	}
+	return filled
+}
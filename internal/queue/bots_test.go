@@ -0,0 +1,102 @@
+package queue
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+func TestFillWithBotsThreshold(t *testing.T) {
+	now := time.Now()
+	const after = 20 * time.Second
+	for _, tc := range []struct {
+		name  string
+		wait  time.Duration
+		after time.Duration
+		want  int
+	}{
+		{"just under the threshold", after - time.Nanosecond, after, 0},
+		{"at the threshold", after, after, 1},
+		{"past the threshold", time.Minute, after, 1},
+		{"off", time.Hour, 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			entries := []model.QueueEntry{waitingEntry(now, "alice", "asia", tc.wait)}
+			rng := rand.New(rand.NewPCG(1, 2))
+			filled := FillWithBots(entries, nil, now, tc.after, 0, DefaultModes(), nil, rng)
+			if len(filled) != tc.want {
+				t.Fatalf("filled %d lobbies, want %d", len(filled), tc.want)
+			}
+		})
+	}
+
+	// ロビーに入ったエントリと、有効期限が近いエントリはボットで埋めない
+	matched := waitingEntry(now, "alice", "asia", time.Minute)
+	expiring := waitingEntry(now, "bob", "asia", time.Minute)
+	expiring.ExpiresAt = now.Add(time.Second)
+	lobbies := []Lobby{{GameMode: "duel", Teams: [][]model.QueueEntry{{matched}, {waitingEntry(now, "carol", "asia", 0)}}}}
+	filled := FillWithBots([]model.QueueEntry{matched, expiring}, lobbies, now, after, 5*time.Second, DefaultModes(), nil, rand.New(rand.NewPCG(1, 2)))
+	if len(filled) != 0 {
+		t.Fatalf("filled %v, want none", lobbyPairs(filled))
+	}
+}
+
+func TestFillWithBotsPicksClosestProfiles(t *testing.T) {
+	now := time.Now()
+	pool := []BotProfile{{ID: "bot-easy", Rating: 900}, {ID: "bot-mid", Rating: 1450}, {ID: "bot-hard", Rating: 1600}, {ID: "bot-near", Rating: 1540}}
+	entry := waitingEntry(now, "alice", "asia", time.Minute)
+	entry.GameMode = "2v2"
+	filled := FillWithBots([]model.QueueEntry{entry}, nil, now, 20*time.Second, 0, DefaultModes(), pool, rand.New(rand.NewPCG(1, 2)))
+	if len(filled) != 1 {
+		t.Fatalf("filled %d lobbies, want 1", len(filled))
+	}
+	// 近い順に選び、同じロビーには同じボットを入れない
+	if got, want := lobbyPairs(filled)[0], "alice-bot-near-bot-mid-bot-hard"; got != want {
+		t.Errorf("lobby = %s, want %s", got, want)
+	}
+
+	// プロフィールを使い切った場合は、相手の近くのレーティングでボットを生成する
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 100 {
+		filled := FillWithBots([]model.QueueEntry{entry}, nil, now, 20*time.Second, 0, DefaultModes(), pool[:1], rng)
+		var ids []string
+		for _, e := range filled[0].Entries()[1:] {
+			bot := e.Players[0]
+			if !bot.IsBot || !strings.HasPrefix(bot.ID, "bot-") {
+				t.Fatalf("filler %+v, want a bot", bot)
+			}
+			if bot.ID != "bot-easy" && model.RatingDistance(bot.Rating, entry.Rating) > 50 {
+				t.Fatalf("generated bot rating %d, want within 50 of %d", bot.Rating, entry.Rating)
+			}
+			ids = append(ids, bot.ID)
+		}
+		if distinct := slices.Compact(slices.Sorted(slices.Values(ids))); len(distinct) != 3 {
+			t.Fatalf("bots %v, want 3 distinct bots", ids)
+		}
+	}
+}
+
+func TestParseBotProfiles(t *testing.T) {
+	got, err := ParseBotProfiles("bot-easy:900, bot-hard:1600")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []BotProfile{{ID: "bot-easy", Rating: 900}, {ID: "bot-hard", Rating: 1600}}; !slices.Equal(got, want) {
+		t.Fatalf("profiles = %v, want %v", got, want)
+	}
+	for _, v := range []string{
+		"bot-easy",                   // レーティングがない
+		"easy:900",                   // 接頭辞がない
+		"bot-easy:900,bot-easy:1000", // 重複
+		"bot-easy:abc",
+		"bot-easy:99999",
+	} {
+		if _, err := ParseBotProfiles(v); err == nil {
+			t.Errorf("ParseBotProfiles(%q) succeeded, want an error", v)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"time"
+)
+
+// Config はマッチングの条件と待機時間の設定です。main が環境変数から組み立て、サーバの設定（api.Config.Queue）として渡します。
+type Config struct {
+	// GameModes は受け付けるゲームモードです（環境変数 GAME_MODES_FILE・GAME_MODES）。
+	GameModes Modes
+	// MinTimeout と MaxTimeout は、リクエストやゲームモードで指定できる待機時間の範囲です（環境変数 MATCHMAKING_TIMEOUT_MIN・MATCHMAKING_TIMEOUT_MAX）。
+	MinTimeout, MaxTimeout time.Duration
+	// CrossRegionFallback は、待機時間がこの値を超えたプレイヤーを他地域のプレイヤーともマッチング可能にするしきい値です（環境変数 CROSS_REGION_FALLBACK）。
+	// 0 以下の場合は地域をまたいだマッチングを行いません。
+	CrossRegionFallback time.Duration
+	// RematchFallback は、両方のエントリの待機時間がこの値を超えた場合に直前の対戦相手との再戦を許可するしきい値です（環境変数 REMATCH_FALLBACK）。
+	// 他に対戦相手がいない場合にいつまでも待たされることを防ぎます。0 以下の場合は常に再戦を避けます。
+	RematchFallback time.Duration
+	// PriorityAgingCeiling は、待機時間がこの値を超えたエントリを優先度に関わらず最大の優先度として扱うしきい値です（環境変数 PRIORITY_AGING_CEILING）。
+	// 優先度の高いエントリが多い場合に、優先度の低いエントリがいつまでもマッチングされないことを防ぎます。0 以下の場合は引き上げません。
+	PriorityAgingCeiling time.Duration
+	// RatingTiers はレーティング帯の境界です（環境変数 RATING_TIERS）。空の場合は帯に分けずに待機キュー全体から相手を探します。
+	// 各境界はその値以上を上の帯とします。例えば [1000 1200] の場合、帯は 〜999、1000〜1199、1200〜 の3つです。
+	RatingTiers []int
+	// RatingTierSpillover は、待機時間がこの値を超えたエントリを隣の帯のエントリとも組み合わせるしきい値です（環境変数 RATING_TIER_SPILLOVER）。
+	// 0 以下の場合は帯をまたいだマッチングを行いません。
+	RatingTierSpillover time.Duration
+	// PingFallback は、待機時間がこの値を超えたエントリをゲームモードの ping の上限（max_ping_ms）を超える相手とも組み合わせるしきい値です（環境変数 PING_FALLBACK）。
+	// 0 以下の場合は上限を緩めません。
+	PingFallback time.Duration
+	// StarvationThreshold は、待機時間がこの値を超えたエントリをレーティングの差の上限とレーティング帯に関わらず組み合わせるしきい値です（環境変数 STARVATION_THRESHOLD）。
+	// レーティングが極端なプレイヤーが、レーティングの差の上限の中に相手がいないためにいつまでも待たされることを防ぎます。0 以下の場合は緩めません。
+	StarvationThreshold time.Duration
+	// MatchAttributeKeys は、同じロビーに入れるプレイヤー同士で値が一致しなければならない属性のキーです（環境変数 MATCH_ATTRIBUTE_KEYS）。
+	// ここに含まれないキーの属性は保存するだけでマッチングには使いません。空の場合は属性を比較しません。
+	MatchAttributeKeys []string
+	// BotFillAfter は、待機時間がこの値を超えたエントリをボットで埋めたロビーでマッチングするしきい値です（環境変数 BOT_FILL_AFTER）。
+	// 0 以下の場合はボットを使いません（既定）。ロングポーリングの待機時間（30秒）より短くしないとタイムアウトが先に来ます。
+	BotFillAfter time.Duration
+	// BotProfiles はボットとして使うプロフィールの一覧です（環境変数 BOT_PROFILES）。
+	// 空の場合、またはロビー内で使える（まだ使っていない）プロフィールがない場合は、ID とレーティングを乱数で生成します。
+	BotProfiles []BotProfile
+	// PlacementMatches は新しいプレイヤーの配置戦（レーティングが定まっていない最初の対戦）の数です（環境変数 PLACEMENT_MATCHES）。
+	// 配置戦の間はレーティングの差の上限を広げ、Elo の K 係数を大きくします。0 の場合は配置戦を設けません。
+	PlacementMatches int
+	// ProcessorMaxIdleInterval は待機キューが空の間にマッチングプロセッサーが確認の間隔を延ばす上限です（環境変数 PROCESSOR_MAX_IDLE_INTERVAL）。
+	// PROCESSOR_INTERVAL と同じ値にすると、待機キューが空でも間隔を延ばしません。
+	ProcessorMaxIdleInterval time.Duration
+}
+
+// DefaultConfig は既定の設定を返します。
+func DefaultConfig() Config {
+	return Config{
+		GameModes:                DefaultModes(),
+		MinTimeout:               5 * time.Second,
+		MaxTimeout:               3 * time.Minute,
+		CrossRegionFallback:      15 * time.Second,
+		RematchFallback:          20 * time.Second,
+		PriorityAgingCeiling:     20 * time.Second,
+		RatingTierSpillover:      15 * time.Second,
+		PingFallback:             20 * time.Second,
+		StarvationThreshold:      60 * time.Second,
+		PlacementMatches:         5,
+		ProcessorMaxIdleInterval: 10 * time.Second,
+	}
+}
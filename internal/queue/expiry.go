@@ -0,0 +1,19 @@
+package queue
+
+import (
+	"time"
+)
+
+// MatchmakingTimeout はロングポーリングでマッチング結果を待つ既定の時間です。
+// ゲームモードの timeout_seconds やリクエストの timeout_seconds で変更できます。
+const MatchmakingTimeout = 30 * time.Second
+
+// LongestTimeout は、既定・ゲームモード・リクエストで指定できる待機時間のうち最も長いものを返します。
+// 待機しているクライアントがいるエントリを掃除や通知のやり直しで中止しないよう、これを基準にします。
+func (c Config) LongestTimeout() time.Duration {
+	longest := max(MatchmakingTimeout, c.MaxTimeout)
+	for _, mode := range c.GameModes {
+		longest = max(longest, mode.Timeout)
+	}
+	return longest
+}
@@ -0,0 +1,37 @@
+package queue
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// 有効期限までの残り時間が余裕（ExpiryMargin）以下のエントリはマッチングしない
+func TestFindLobbiesSkipsEntriesNearExpiry(t *testing.T) {
+	now := testEpoch
+	margin := 10 * time.Second
+	for _, tc := range []struct {
+		name      string
+		expiresIn time.Duration
+		want      []string
+	}{
+		{"no expiry", 0, []string{"alice-bob"}},
+		{"well before expiry", margin + time.Second, []string{"alice-bob"}},
+		{"at the margin", margin, nil},
+		{"inside the margin", time.Second, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			alice := waitingEntry(now, "alice", "asia", 10*time.Second)
+			if tc.expiresIn > 0 {
+				alice.ExpiresAt = now.Add(tc.expiresIn)
+			}
+			bob := waitingEntry(now, "bob", "asia", 10*time.Second)
+			lobbies := FindLobbies([]model.QueueEntry{alice, bob}, now, MatchPolicy{ExpiryMargin: margin, Modes: DefaultModes()})
+			if got := lobbyPairs(lobbies); !slices.Equal(got, tc.want) {
+				t.Fatalf("lobbies = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,439 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+)
+
+// GameMode はゲームモードごとのロビー構成を表します。
+type GameMode struct {
+	// LobbySize は1セッションに参加するプレイヤー数です。
+	LobbySize int
+	// Teams はチーム数です。0 の場合は全員が個別のチームとなる（バトルロイヤル形式）とみなします。
+	Teams int
+	// RatingWindow は同じロビーに入れるエントリのレーティング（パーティは平均）の差の上限です。0 の場合は制限しません。
+	RatingWindow int
+	// MaxPingMS は同じロビーに入れる2つのエントリの ping の合計の上限（ミリ秒）です。待機時間が PingFallback を超えると緩めます。0 の場合は制限しません。
+	MaxPingMS int
+	// Timeout はロングポーリングでマッチング結果を待つ時間です。0 の場合は MatchmakingTimeout です。リクエストの timeout_seconds が優先されます。
+	Timeout time.Duration
+	// AllocatorURL はこのモードのセッションのゲームサーバを割り当てる HTTP のアロケーターです。空の場合は SESSION_ALLOCATOR_URL を使います。
+	AllocatorURL string
+	// Schedule は待機キューへの登録を受け付ける時間です。nil の場合は常に受け付けます。
+	Schedule *modeSchedule
+	// PollPriority はマッチングプロセッサーが1回の処理でゲームモードを処理する順の優先度です。大きいモードから先にロビーを組み、通知します。
+	// 同じ優先度のモードは待機キューに最初にエントリが現れた順です。
+	PollPriority int
+}
+
+// TeamCount はロビー内のチーム数を返します。
+func (m GameMode) TeamCount() int {
+	if m.Teams <= 0 {
+		return m.LobbySize
+	}
+	return m.Teams
+}
+
+// TeamSize は1チームあたりのプレイヤー数を返します。
+func (m GameMode) TeamSize() int {
+	return m.LobbySize / m.TeamCount()
+}
+
+// DefaultGameMode は game_mode が指定されなかった場合に使用するゲームモードです。
+const DefaultGameMode = "duel"
+
+// maxGameModeLength は matchmaking_queue.game_mode の列長に合わせたゲームモード名の最大長です。
+const maxGameModeLength = 32
+
+// Modes は受け付けるゲームモードの名前ごとの設定です。
+// モードごとに待機キューは独立しており、異なるモードのプレイヤー同士はマッチングしません。
+type Modes map[string]GameMode
+
+// DefaultModes は組み込みのゲームモードを返します。GAME_MODES_FILE で置き換え、環境変数 GAME_MODES（カンマ区切り）で受け付けるモードを制限できます。
+func DefaultModes() Modes {
+	return Modes{
+		"duel":   {LobbySize: 2, Teams: 2},
+		"ranked": {LobbySize: 2, Teams: 2},
+		"casual": {LobbySize: 2, Teams: 2},
+		"2v2":    {LobbySize: 4, Teams: 2},
+		"ffa4":   {LobbySize: 4},
+	}
+}
+
+// UnknownGameModeError は受け付けていないゲームモードが指定された場合のエラーです。
+type UnknownGameModeError struct {
+	Name       string
+	ValidModes []string
+}
+
+func (e *UnknownGameModeError) Error() string {
+	return fmt.Sprintf("unknown game mode %q (valid modes: %s)", e.Name, strings.Join(e.ValidModes, ", "))
+}
+
+// Lookup は名前に対応するゲームモードを返します。空文字の場合は DefaultGameMode を使用します。
+// 受け付けていないモードの場合は *UnknownGameModeError を返します。
+func (m Modes) Lookup(name string) (string, GameMode, error) {
+	if name == "" {
+		name = DefaultGameMode
+	}
+	mode, ok := m[name]
+	if !ok {
+		return "", GameMode{}, &UnknownGameModeError{Name: name, ValidModes: m.Names()}
+	}
+	return name, mode, nil
+}
+
+// Names は受け付けるゲームモードの名前を返します。
+func (m Modes) Names() []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// gameModeConfig は GAME_MODES_FILE の1モード分の設定です。
+type gameModeConfig struct {
+	LobbySize      int                 `json:"lobby_size"`
+	Teams          int                 `json:"teams"`
+	RatingWindow   int                 `json:"rating_window"`
+	MaxPingMS      int                 `json:"max_ping_ms"`
+	TimeoutSeconds int                 `json:"timeout_seconds"`
+	AllocatorURL   string              `json:"allocator_url"`
+	Schedule       *modeScheduleConfig `json:"schedule"`
+	PollPriority   int                 `json:"poll_priority"`
+}
+
+// LoadGameModes は JSON ファイル（{"モード名": {"lobby_size": 4, "teams": 2, "rating_window": 300, "max_ping_ms": 250, "timeout_seconds": 20, "poll_priority": 1}}）から
+// ゲームモードの設定を読み込みます（組み込みの設定の代わりに使います）。DefaultGameMode は必ず含める必要があります。
+// schedule（parseModeSchedule）を指定したモードは受付時間内だけ待機キューへの登録を受け付けます。
+// 待機時間は、リクエストで指定できる範囲（minTimeout〜maxTimeout）に収める必要があります。
+func LoadGameModes(filename string, minTimeout, maxTimeout time.Duration) (Modes, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ゲームモード設定ファイル読み込みエラー: %v", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var configs map[string]gameModeConfig
+	if err := dec.Decode(&configs); err != nil {
+		return nil, fmt.Errorf("ゲームモード設定ファイル解析エラー: %v", err)
+	}
+
+	modes := make(Modes, len(configs))
+	for name, c := range configs {
+		mode := GameMode{LobbySize: c.LobbySize, Teams: c.Teams, RatingWindow: c.RatingWindow, MaxPingMS: c.MaxPingMS, Timeout: time.Duration(c.TimeoutSeconds) * time.Second, AllocatorURL: c.AllocatorURL,
+			PollPriority: c.PollPriority}
+		switch {
+		case name == "" || len(name) > maxGameModeLength:
+			return nil, fmt.Errorf("game mode name must be 1 to %d characters: %q", maxGameModeLength, name)
+		case c.LobbySize < 2:
+			return nil, fmt.Errorf("game mode %q: lobby_size must be at least 2", name)
+		case c.Teams < 0 || c.Teams > c.LobbySize || c.LobbySize%mode.TeamCount() != 0:
+			return nil, fmt.Errorf("game mode %q: lobby_size %d cannot be split into %d teams", name, c.LobbySize, c.Teams)
+		case c.RatingWindow < 0:
+			return nil, fmt.Errorf("game mode %q: rating_window must not be negative", name)
+		case c.MaxPingMS < 0:
+			return nil, fmt.Errorf("game mode %q: max_ping_ms must not be negative", name)
+		case c.TimeoutSeconds < 0 || mode.Timeout > maxTimeout || (mode.Timeout > 0 && mode.Timeout < minTimeout):
+			return nil, fmt.Errorf("game mode %q: timeout_seconds must be 0 or between %d and %d", name, int(minTimeout/time.Second), int(maxTimeout/time.Second))
+		case c.PollPriority < 0:
+			return nil, fmt.Errorf("game mode %q: poll_priority must not be negative", name)
+		}
+		if c.Schedule != nil {
+			sc, err := parseModeSchedule(*c.Schedule)
+			if err != nil {
+				return nil, fmt.Errorf("game mode %q: %v", name, err)
+			}
+			mode.Schedule = sc
+		}
+		modes[name] = mode
+	}
+	if _, ok := modes[DefaultGameMode]; !ok {
+		return nil, fmt.Errorf("default game mode %q must be configured", DefaultGameMode)
+	}
+	return modes, nil
+}
+
+// Restrict は受け付けるゲームモードを names に制限したものを返します。
+// 設定に存在しないモードが含まれる場合、または DefaultGameMode が含まれない場合はエラーを返します。
+func (m Modes) Restrict(names []string) (Modes, error) {
+	allowed := make(Modes, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		mode, ok := m[name]
+		if !ok {
+			return nil, &UnknownGameModeError{Name: name, ValidModes: m.Names()}
+		}
+		allowed[name] = mode
+	}
+	if _, ok := allowed[DefaultGameMode]; !ok {
+		return nil, fmt.Errorf("default game mode %q must be allowed", DefaultGameMode)
+	}
+	return allowed, nil
+}
+
+// Lobby はマッチングが成立したセッション参加者の組み合わせです。
+type Lobby struct {
+	GameMode string
+	// Teams はチームごとのエントリです。パーティは分割せず同じチームに割り当てます。
+	Teams [][]model.QueueEntry
+}
+
+// Entries はロビーに含まれる全エントリを返します。
+func (l Lobby) Entries() []model.QueueEntry {
+	var entries []model.QueueEntry
+	for _, team := range l.Teams {
+		entries = append(entries, team...)
+	}
+	return entries
+}
+
+// MatchPolicy はロビーを組む際の条件です。
+type MatchPolicy struct {
+	// CrossRegionFallback は、待機時間がこの値を超えたエントリを他地域のエントリとも組み合わせるしきい値です。
+	// 0 以下の場合は地域をまたいだマッチングを行いません。
+	CrossRegionFallback time.Duration
+	// RecentOpponents は最近対戦したプレイヤーの組み合わせです。これらの組み合わせは可能な限り避けます。
+	RecentOpponents model.OpponentSet
+	// RematchFallback は、両方のエントリの待機時間がこの値を超えた場合に最近の対戦相手との再戦を許可するしきい値です。
+	RematchFallback time.Duration
+	// Blocked はどちらかがもう一方をブロックしているプレイヤーの組み合わせです。これらの組み合わせは待機時間によらず避けます。
+	Blocked model.OpponentSet
+	// ExpiryMargin は、有効期限までの残り時間がこの値以下のエントリをマッチングしないための余裕です。
+	ExpiryMargin time.Duration
+	// BestPairing は1対1のモードで、待機開始順ではなく matchQuality の合計が大きくなる組み合わせを選ぶかどうかです。
+	BestPairing bool
+	// PriorityAgingCeiling は、待機時間がこの値を超えたエントリを最大の優先度として扱うしきい値です。0 以下の場合は引き上げません。
+	PriorityAgingCeiling time.Duration
+	// RatingWindow は同じロビーに入れるエントリのレーティングの差の上限です。FindLobbies がゲームモードの設定から設定します。
+	RatingWindow int
+	// RatingTiers はレーティング帯の境界です。空でなければ帯ごとに先に組み、隣の帯とは待機時間が TierSpillover を超えたエントリだけ組ませます。
+	RatingTiers []int
+	// TierSpillover は、待機時間がこの値を超えたエントリを隣のレーティング帯のエントリとも組み合わせるしきい値です。
+	TierSpillover time.Duration
+	// MaxPing は同じロビーに入れる2つのエントリの ping の合計の上限です。matchByMode がゲームモードの設定から設定します。
+	MaxPing int
+	// PingFallback は、待機時間がこの値を超えたエントリを MaxPing を超える相手とも組み合わせるしきい値です。
+	PingFallback time.Duration
+	// StarvationThreshold は、待機時間がこの値を超えたエントリを RatingWindow と RatingTiers に関わらず組み合わせるしきい値です。
+	StarvationThreshold time.Duration
+	// MatchAttributes は値が一致しなければ同じロビーに入れないプレイヤーの属性のキーです（Config.MatchAttributeKeys）。待機時間によらず守ります。
+	MatchAttributes []string
+	// PlacementMatches は配置戦の数です。配置戦中のメンバーがいるエントリはレーティングの差の上限を広げます（placementRatingWindow）。
+	PlacementMatches int
+	// Modes はゲームモードの設定です。設定にないモードのエントリは組みません。
+	Modes Modes
+}
+
+// Region はロビーのセッションを実行する地域を返します。
+// 地域を指定しているエントリのうち、最も長く待機しているエントリの地域を使用します。全員が未指定の場合は空文字（global）です。
+func (l Lobby) Region() string {
+	region := ""
+	var oldest time.Time
+	for _, e := range l.Entries() {
+		if e.Region == "" {
+			continue
+		}
+		if region == "" || e.WaitingSince.Before(oldest) {
+			region, oldest = e.Region, e.WaitingSince
+		}
+	}
+	return region
+}
+
+// FindLobbies は待機中エントリ（待機開始順）から成立するロビーをすべて選びます（MATCH_STRATEGY の既定の rating_window）。
+// ゲームモードごとに独立してマッチングし、1つのエントリが複数のロビーに含まれることはありません。
+// 各ゲームモードのエントリは優先度の高い順（同じ優先度では待機開始順）に相手を探します。
+// レーティング帯（policy.RatingTiers）を設定している場合は、帯ごとに先に組みます（findTieredLobbies）。
+// 外部の状態に依存しない純粋な関数で、同じ入力に対しては常に同じ結果を返します。
+func FindLobbies(entries []model.QueueEntry, now time.Time, policy MatchPolicy) []Lobby {
+	return RatingWindowMatcher{}.Match(entries, now, policy)
+}
+
+// modeMatcher は1つのゲームモードのエントリ（探す順に並んだもの）からロビーを組む関数です。
+type modeMatcher func(name string, mode GameMode, entries []model.QueueEntry, policy MatchPolicy) []Lobby
+
+// matchByMode は有効期限の迫ったエントリを除いてゲームモードごとに分け、優先度順に並べて match でロビーを組みます。
+// ゲームモードは PollPriority の大きい順、同じ優先度では最初にエントリが現れた順に処理します。ping の上限（policy.MaxPing）はどのアルゴリズムでもゲームモードの設定を使います。
+func matchByMode(entries []model.QueueEntry, now time.Time, policy MatchPolicy, match modeMatcher) []Lobby {
+	byMode := make(map[string][]model.QueueEntry)
+	var modeOrder []string
+	for _, e := range entries {
+		if e.ExpiresSoon(now, policy.ExpiryMargin) {
+			continue
+		}
+		if _, ok := byMode[e.GameMode]; !ok {
+			modeOrder = append(modeOrder, e.GameMode)
+		}
+		byMode[e.GameMode] = append(byMode[e.GameMode], e)
+	}
+
+	sort.SliceStable(modeOrder, func(i, j int) bool {
+		return policy.Modes[modeOrder[i]].PollPriority > policy.Modes[modeOrder[j]].PollPriority
+	})
+
+	var lobbies []Lobby
+	for _, name := range modeOrder {
+		mode, ok := policy.Modes[name]
+		if !ok {
+			continue
+		}
+		sortByPriority(byMode[name], now, policy.PriorityAgingCeiling)
+		policy.MaxPing = mode.MaxPingMS
+		lobbies = append(lobbies, match(name, mode, byMode[name], policy)...)
+	}
+	return lobbies
+}
+
+// findModeLobbies は同じゲームモードのエントリから、成立しなくなるまでロビーを組みます。
+// 成立したロビーと、どのロビーにも含まれなかったエントリ（元の順）を返します。
+// 1対1のモードは、同じ結果を1回の走査で組める findPairLobbies で組みます（待機キューが数万件になっても遅くならないように）。
+func findModeLobbies(name string, mode GameMode, entries []model.QueueEntry, now time.Time, policy MatchPolicy) ([]Lobby, []model.QueueEntry) {
+	if mode.isHeadToHead() {
+		return findPairLobbies(name, entries, now, policy)
+	}
+	var lobbies []Lobby
+	for {
+		l, rest, ok := findLobby(name, mode, entries, now, policy)
+		if !ok {
+			return lobbies, entries
+		}
+		lobbies = append(lobbies, l)
+		entries = rest
+	}
+}
+
+// findLobby は同じゲームモードのエントリから1つのロビーを組みます。
+// 待機時間の長いエントリを起点に、地域の条件を満たすエントリを先着順に空きのあるチームへ割り当てます。
+// 成立したロビーと、ロビーに含まれなかった残りのエントリを返します。
+func findLobby(name string, mode GameMode, entries []model.QueueEntry, now time.Time, policy MatchPolicy) (Lobby, []model.QueueEntry, bool) {
+	teamCount, teamSize := mode.TeamCount(), mode.TeamSize()
+
+	for anchor := range entries {
+		teams := make([][]model.QueueEntry, teamCount)
+		filled := make([]int, teamCount)
+		used := make(map[int]bool)
+		total := 0
+
+		for i := anchor; i < len(entries) && total < mode.LobbySize; i++ {
+			e := entries[i]
+			if !canJoinLobby(e, teams, now, policy) {
+				continue
+			}
+			for t := range teams {
+				if filled[t]+len(e.Players) <= teamSize {
+					teams[t] = append(teams[t], e)
+					filled[t] += len(e.Players)
+					total += len(e.Players)
+					used[i] = true
+					break
+				}
+			}
+		}
+
+		if total == mode.LobbySize {
+			var rest []model.QueueEntry
+			for i, e := range entries {
+				if !used[i] {
+					rest = append(rest, e)
+				}
+			}
+			return Lobby{GameMode: name, Teams: teams}, rest, true
+		}
+	}
+	return Lobby{}, entries, false
+}
+
+// canJoinLobby はエントリが既にロビーに割り当てられた全エントリとマッチング可能かどうかを判定します。
+// 同じプレイヤーを含むエントリ同士（プレイヤー自身との対戦）は組み合わせません。
+// 地域の条件、レーティングの差（policy.RatingWindow）、レーティング帯（policy.RatingTiers）と ping（policy.MaxPing）に加えて、最近対戦したプレイヤー同士と
+// ブロックしているプレイヤー同士、policy.MatchAttributes の属性が異なるプレイヤー同士は（チームに関係なく）同じロビーに入れません。
+// どちらかの待機時間が policy.StarvationThreshold を超えている場合は、レーティングの差とレーティング帯の条件を問いません。
+// クライアントが指定したレーティングの範囲（QueueEntry.RatingRange）は待機時間に関係なく守ります。
+func canJoinLobby(e model.QueueEntry, teams [][]model.QueueEntry, now time.Time, policy MatchPolicy) bool {
+	starving := e.IsStarving(now, policy.StarvationThreshold)
+	for _, team := range teams {
+		for _, other := range team {
+			if sharesPlayer(e, other) {
+				return false
+			}
+			if !canMatchRegion(e, other, now, policy.CrossRegionFallback) {
+				return false
+			}
+			anyRating := starving || other.IsStarving(now, policy.StarvationThreshold)
+			if !anyRating && policy.RatingWindow > 0 && model.RatingDistance(e.Rating, other.Rating) > pairRatingWindow(e, other, policy.RatingWindow, policy.PlacementMatches) {
+				return false
+			}
+			if !canMatchRatingRange(e, other) {
+				return false
+			}
+			if !anyRating && !canMatchTier(e, other, now, policy.RatingTiers, policy.TierSpillover) {
+				return false
+			}
+			if !canMatchPing(e, other, now, policy.MaxPing, policy.PingFallback) {
+				return false
+			}
+			if avoidsRematch(e, other, now, policy.RecentOpponents, policy.RematchFallback) {
+				return false
+			}
+			if blocksEither(e, other, policy.Blocked) {
+				return false
+			}
+			if !canMatchAttributes(e, other, policy.MatchAttributes) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// sharesPlayer は2つのエントリに同じプレイヤーが含まれるかどうかを判定します。
+// 待機キューはプレイヤーごとに1行（matchmaking_queue の主キー）のため通常は起きませんが、
+// 同じプレイヤーが候補に2回現れてもプレイヤー自身と組み合わせないための確認です。
+func sharesPlayer(e1, e2 model.QueueEntry) bool {
+	for _, p1 := range e1.Players {
+		for _, p2 := range e2.Players {
+			if p1.ID == p2.ID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WithoutSelfMatches は同じプレイヤーを2回以上含むロビーを除いて返します。
+// Matcher は canJoinLobby でプレイヤー自身との対戦を避けますが、同じプレイヤーを2回含むセッションを作成すると
+// 待機キューからの削除と参加者の記録が食い違うため、セッションを作成する前にもう一度確認します。
+func WithoutSelfMatches(lobbies []Lobby) []Lobby {
+	kept := lobbies[:0]
+	for _, l := range lobbies {
+		seen := make(map[string]bool)
+		duplicate := ""
+		for _, e := range l.Entries() {
+			for _, p := range e.Players {
+				if seen[p.ID] {
+					duplicate = p.ID
+				}
+				seen[p.ID] = true
+			}
+		}
+		if duplicate != "" {
+			metrics.SelfMatchesRejected.Inc()
+			slog.Error("同じプレイヤーを含むロビーを除外しました", "func", "withoutSelfMatches", "mode", l.GameMode, "player_id", duplicate)
+			continue
+		}
+		kept = append(kept, l)
+	}
+	return kept
+}
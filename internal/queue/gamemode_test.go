@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// quickModes は広いレーティングの範囲・短い待機時間の quick と、狭い範囲・長い待機時間の ranked を読み込みます。
+func quickModes(t *testing.T) Modes {
+	t.Helper()
+	modes, err := LoadGameModes(writeGameModes(t, `{
+		"duel":   {"lobby_size": 2, "teams": 2},
+		"quick":  {"lobby_size": 2, "teams": 2, "rating_window": 500, "timeout_seconds": 1, "poll_priority": 2},
+		"ranked": {"lobby_size": 2, "teams": 2, "rating_window": 100, "timeout_seconds": 3, "poll_priority": 1}
+	}`), time.Second, 120*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return modes
+}
+
+const multiQueueModes = `{
+	"duel": {"lobby_size": 2, "teams": 2, "rating_window": 100, "timeout_seconds": 30},
+	"2v2":  {"lobby_size": 4, "teams": 2, "rating_window": 200, "timeout_seconds": 45},
+	"3v3":  {"lobby_size": 6, "teams": 2, "rating_window": 300, "timeout_seconds": 60}
+}`
+
+// writeGameModes は GAME_MODES_FILE の形式の JSON を一時ファイルに書き込み、そのパスを返します。
+func writeGameModes(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "modes.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadGameModes(t *testing.T) {
+	modes, err := LoadGameModes(writeGameModes(t, multiQueueModes), time.Second, 120*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := modes.Names(); !slices.Equal(got, []string{"2v2", "3v3", "duel"}) {
+		t.Fatalf("modes = %v, want 2v2, 3v3 and duel", got)
+	}
+	if m := modes["3v3"]; m.LobbySize != 6 || m.TeamCount() != 2 || m.RatingWindow != 300 || m.Timeout != time.Minute {
+		t.Fatalf("3v3 = %+v, want 6 players in 2 teams, window 300 and a 60s timeout", m)
+	}
+
+	for _, tc := range []struct{ name, content string }{
+		{"no default mode", `{"2v2": {"lobby_size": 4, "teams": 2}}`},
+		{"lobby too small", `{"duel": {"lobby_size": 1}}`},
+		{"uneven teams", `{"duel": {"lobby_size": 2, "teams": 2}, "odd": {"lobby_size": 5, "teams": 2}}`},
+		{"timeout out of range", `{"duel": {"lobby_size": 2, "teams": 2, "timeout_seconds": 600}}`},
+		{"unknown field", `{"duel": {"lobby_size": 2, "teams": 2, "size": 2}}`},
+	} {
+		if _, err := LoadGameModes(writeGameModes(t, tc.content), time.Second, 120*time.Second); err == nil {
+			t.Errorf("%s: loaded without an error", tc.name)
+		}
+	}
+}
+
+// poll_priority の大きいモードのロビーを先に組み、レーティングの範囲はモードごとの設定を使う
+func TestModePollPriorityAndRatingWindow(t *testing.T) {
+	modes := quickModes(t)
+	now := testEpoch
+	entries := []model.QueueEntry{
+		ratedEntry(now, "r1", 1500, 40*time.Second), ratedEntry(now, "r2", 1580, 30*time.Second),
+		ratedEntry(now, "r3", 1750, 20*time.Second), ratedEntry(now, "r4", 1950, 10*time.Second),
+		ratedEntry(now, "q1", 1500, 5*time.Second), ratedEntry(now, "q2", 1900, 5*time.Second),
+	}
+	for i := range entries {
+		entries[i].GameMode = "ranked"
+		if entries[i].Players[0].ID[0] == 'q' {
+			entries[i].GameMode = "quick"
+		}
+	}
+	got := lobbyPairs(FindLobbies(entries, now, MatchPolicy{Modes: modes}))
+	if want := []string{"q1-q2", "r1-r2"}; !slices.Equal(got, want) {
+		t.Fatalf("lobbies = %q, want %q (quick first, r3 and r4 beyond ranked's window)", got, want)
+	}
+}
@@ -0,0 +1,37 @@
+package queue
+
+import (
+	"strings"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// testEpoch はテストで基準にする現在時刻です。
+var testEpoch = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// waitingEntry は now の wait 前から duel で待機している、レーティング 1500 のソロのエントリです。
+func waitingEntry(now time.Time, id, region string, wait time.Duration) model.QueueEntry {
+	return model.QueueEntry{Players: []model.Player{{ID: id, Rating: 1500}}, Rating: 1500, Region: region, GameMode: "duel", WaitingSince: now.Add(-wait)}
+}
+
+// lobbyPairs はロビーの参加者のIDを "a-b" の形式で返します。
+func lobbyPairs(lobbies []Lobby) []string {
+	pairs := make([]string, len(lobbies))
+	for i, l := range lobbies {
+		ids := make([]string, 0, 2)
+		for _, e := range l.Entries() {
+			ids = append(ids, model.PlayerIDs(e.Players)...)
+		}
+		pairs[i] = strings.Join(ids, "-")
+	}
+	return pairs
+}
+
+// ratedEntry は waitingEntry のレーティングを rating にし、プレイヤーの待機開始時刻もエントリに合わせたエントリを返します。
+func ratedEntry(now time.Time, id string, rating int, wait time.Duration) model.QueueEntry {
+	e := waitingEntry(now, id, "asia", wait)
+	e.Rating, e.Players[0].Rating = rating, rating
+	e.Players[0].WaitingSince = e.WaitingSince
+	return e
+}
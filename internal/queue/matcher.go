@@ -0,0 +1,149 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// Matcher は待機中のエントリからロビーを組むアルゴリズムです（環境変数 MATCH_STRATEGY で選びます）。
+// マッチングプロセッサーはこのインターフェースだけを使います。実装は外部の状態に依存しない純粋な処理にし、
+// 同じ入力に対しては常に同じ結果を返してください（待機キューをロックしたトランザクションの中で呼び出されます）。
+// 地域・再戦の回避・有効期限の条件（policy）はどの実装でも守り、1つのエントリを複数のロビーに含めてはいけません。
+type Matcher interface {
+	Match(entries []model.QueueEntry, now time.Time, policy MatchPolicy) []Lobby
+}
+
+// マッチングのアルゴリズムの名前です。
+const (
+	matchStrategyFIFO         = "fifo"
+	MatchStrategyRatingWindow = "rating_window"
+	matchStrategyGreedyGap    = "greedy_gap"
+)
+
+// fifoMatcher は待機開始順（優先度順）に、レーティングを考慮せずにロビーを組みます。
+type fifoMatcher struct{}
+
+// Match はレーティングの差の上限とレーティング帯を使わずにロビーを組みます。
+func (fifoMatcher) Match(entries []model.QueueEntry, now time.Time, policy MatchPolicy) []Lobby {
+	policy.RatingTiers = nil
+	return matchByMode(entries, now, policy, func(name string, mode GameMode, entries []model.QueueEntry, policy MatchPolicy) []Lobby {
+		lobbies, _ := findModeLobbies(name, mode, entries, now, policy)
+		return lobbies
+	})
+}
+
+// RatingWindowMatcher は待機開始順（優先度順）に、レーティングの差が上限以内のエントリでロビーを組みます（既定のアルゴリズム）。
+// 機能フラグ best_pairing が有効な場合、1対1のモードでは matchQuality の合計が大きくなる組み合わせを選びます。
+type RatingWindowMatcher struct {
+	// Window はレーティングの差の上限です。0 の場合はゲームモードごとの設定（GameMode.RatingWindow）を使います。
+	Window int
+}
+
+// Match はゲームモードごとのレーティングの差の上限とレーティング帯を使ってロビーを組みます。
+func (m RatingWindowMatcher) Match(entries []model.QueueEntry, now time.Time, policy MatchPolicy) []Lobby {
+	return matchByMode(entries, now, policy, func(name string, mode GameMode, entries []model.QueueEntry, policy MatchPolicy) []Lobby {
+		policy.RatingWindow = mode.RatingWindow
+		if m.Window > 0 {
+			policy.RatingWindow = m.Window
+		}
+		if policy.BestPairing && mode.isHeadToHead() {
+			return findBestPairings(name, entries, now, policy, DefaultMatchQualityWeights)
+		}
+		return findTieredLobbies(name, mode, entries, now, policy)
+	})
+}
+
+// greedyGapMatcher は1対1のモードで、レーティングの差の合計が小さくなるように貪欲法で2人ずつ組み合わせます。
+// 待機時間の重み（wait_weight）を 0 より大きくすると、長く待っているプレイヤーを含む組を優先します。
+// 人数が奇数の場合など、どの組にも採用されなかったプレイヤー（最も組みにくいプレイヤー）は待機キューに残します。
+// 1対1以外のモードは RatingWindowMatcher と同じく組みます。
+type greedyGapMatcher struct {
+	// Weights は組み合わせの優先度（matchQuality）の重みです。
+	Weights matchQualityWeights
+}
+
+// Match は1対1のモードでは findBestPairings で、それ以外のモードはゲームモードごとのレーティングの差の上限でロビーを組みます。
+func (m greedyGapMatcher) Match(entries []model.QueueEntry, now time.Time, policy MatchPolicy) []Lobby {
+	return matchByMode(entries, now, policy, func(name string, mode GameMode, entries []model.QueueEntry, policy MatchPolicy) []Lobby {
+		policy.RatingWindow = mode.RatingWindow
+		if mode.isHeadToHead() {
+			return findBestPairings(name, entries, now, policy, m.Weights)
+		}
+		return findTieredLobbies(name, mode, entries, now, policy)
+	})
+}
+
+// NewMatcher は MATCH_STRATEGY の名前と MATCH_STRATEGY_OPTIONS（"key=value" のカンマ区切り）から Matcher を生成します。
+// 未知の名前やオプション、不正な値はエラーにします。
+//   - fifo: オプションなし
+//   - rating_window: window（レーティングの差の上限。既定はゲームモードごとの設定）
+//   - greedy_gap: rating_weight（レーティングの差の重み、既定は 1）、wait_weight（待機時間の重み、既定は 0）、max_gap（優先度が 0 になるレーティングの差、既定は 400）
+func NewMatcher(name, options string) (Matcher, error) {
+	opts := make(map[string]string)
+	for _, item := range model.SplitCommaList(options) {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("オプションは key=value の形式で指定してください: %q", item)
+		}
+		opts[key] = value
+	}
+	// take は指定されたオプションを取り出し、最後に未知のオプションが残っていないか確認できるよう削除します。
+	take := func(key string) (string, bool) {
+		v, ok := opts[key]
+		delete(opts, key)
+		return v, ok
+	}
+
+	var m Matcher
+	switch name {
+	case matchStrategyFIFO:
+		m = fifoMatcher{}
+	case MatchStrategyRatingWindow:
+		rw := RatingWindowMatcher{}
+		if v, ok := take("window"); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("window は正の整数で指定してください: %q", v)
+			}
+			rw.Window = n
+		}
+		m = rw
+	case matchStrategyGreedyGap:
+		gg := greedyGapMatcher{Weights: matchQualityWeights{Rating: 1, RatingGapScale: DefaultMatchQualityWeights.RatingGapScale, WaitScale: DefaultMatchQualityWeights.WaitScale}}
+		if v, ok := take("rating_weight"); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 {
+				return nil, fmt.Errorf("rating_weight は 0 以上の数で指定してください: %q", v)
+			}
+			gg.Weights.Rating = f
+		}
+		if v, ok := take("wait_weight"); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 {
+				return nil, fmt.Errorf("wait_weight は 0 以上の数で指定してください: %q", v)
+			}
+			gg.Weights.Wait = f
+		}
+		if v, ok := take("max_gap"); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("max_gap は正の整数で指定してください: %q", v)
+			}
+			gg.Weights.RatingGapScale = n
+		}
+		if gg.Weights.Rating+gg.Weights.Wait <= 0 {
+			return nil, fmt.Errorf("rating_weight と wait_weight のいずれかは 0 より大きくしてください")
+		}
+		m = gg
+	default:
+		return nil, fmt.Errorf("未知のマッチングのアルゴリズムです（%s / %s / %s）: %q", matchStrategyFIFO, MatchStrategyRatingWindow, matchStrategyGreedyGap, name)
+	}
+	for key := range opts {
+		return nil, fmt.Errorf("%s では使えないオプションです: %q", name, key)
+	}
+	return m, nil
+}
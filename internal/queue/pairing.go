@@ -0,0 +1,206 @@
+package queue
+
+import (
+	"sort"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// matchQuality は2人のプレイヤーを組み合わせる優先度を 0〜1 で返します。
+// レーティング差が小さいほど、また長く待っているプレイヤーを含むほど高くなります。
+// ComputeMatchQuality（対戦の質の評価）とは異なり、待機時間は加点として扱います（待たされているプレイヤーを先に組ませるため）。
+// 同じ入力に対しては常に同じ値を返すよう、現在時刻も引数で受け取ります。
+func matchQuality(p1, p2 model.Player, now time.Time, w matchQualityWeights) float64 {
+	total := w.Rating + w.Wait
+	if total <= 0 {
+		return 0
+	}
+	ratingScore := 1.0
+	if w.RatingGapScale > 0 {
+		ratingScore = clamp01(1 - float64(model.RatingDistance(p1.Rating, p2.Rating))/float64(w.RatingGapScale))
+	}
+	waitScore := 0.0
+	if w.WaitScale > 0 {
+		wait := max(now.Sub(p1.WaitingSince), now.Sub(p2.WaitingSince))
+		waitScore = clamp01(float64(wait) / float64(w.WaitScale))
+	}
+	return (w.Rating*ratingScore + w.Wait*waitScore) / total
+}
+
+// pairCandidate は組み合わせ可能な2つのエントリ（entries の添字）とその優先度です。
+type pairCandidate struct {
+	I, J    int
+	Quality float64
+}
+
+// findBestPairings は1対1のゲームモードのエントリ（待機開始順）から、優先度の合計が大きくなるように2人ずつ組み合わせます。
+// 組み合わせ可能な全ての組を優先度の高い順に見て、どちらもまだ組んでいなければ採用します（貪欲法のため最適とは限りません）。
+// 待機開始順に先頭から組む findLobby と異なり、先頭のプレイヤーよりレーティングの近い組があればそちらを優先します。
+// 外部の状態に依存しない純粋な関数で、同じ入力に対しては常に同じ結果を返します。
+func findBestPairings(name string, entries []model.QueueEntry, now time.Time, policy MatchPolicy, w matchQualityWeights) []Lobby {
+	var candidates []pairCandidate
+	addCandidate := func(i, j int) {
+		if !canJoinLobby(entries[j], [][]model.QueueEntry{{entries[i]}}, now, policy) {
+			return
+		}
+		q := matchQuality(entries[i].Players[0], entries[j].Players[0], now, w)
+		candidates = append(candidates, pairCandidate{I: i, J: j, Quality: q})
+	}
+	if policy.RatingWindow > 0 {
+		// レーティングの差の上限を超える組は組み合わせられないため、レーティング順に並べて上限以内の組だけを候補にする
+		// （配置戦中のプレイヤーの上限は広いため、最も広い上限で絞り込み、canJoinLobby で判定する）
+		window := widestRatingWindow(policy.RatingWindow, policy.PlacementMatches)
+		byRating := indicesByRating(entries)
+		for p, i := range byRating {
+			for _, j := range byRating[p+1:] {
+				if entries[j].Rating-entries[i].Rating > window {
+					break
+				}
+				addCandidate(min(i, j), max(i, j))
+			}
+		}
+		// 待機時間が StarvationThreshold を超えたエントリは、上限を超える相手も候補にする
+		for i := range entries {
+			if !entries[i].IsStarving(now, policy.StarvationThreshold) {
+				continue
+			}
+			for j := range entries {
+				if model.RatingDistance(entries[i].Rating, entries[j].Rating) <= window || (j < i && entries[j].IsStarving(now, policy.StarvationThreshold)) {
+					continue
+				}
+				addCandidate(min(i, j), max(i, j))
+			}
+		}
+	} else {
+		for i := range entries {
+			for j := i + 1; j < len(entries); j++ {
+				addCandidate(i, j)
+			}
+		}
+	}
+	// 優先度が同じ場合は待機開始の古い組を先にする
+	sort.Slice(candidates, func(a, b int) bool {
+		ca, cb := candidates[a], candidates[b]
+		if ca.Quality != cb.Quality {
+			return ca.Quality > cb.Quality
+		}
+		if ca.I != cb.I {
+			return ca.I < cb.I
+		}
+		return ca.J < cb.J
+	})
+
+	paired := make([]bool, len(entries))
+	var picked []pairCandidate
+	for _, c := range candidates {
+		if paired[c.I] || paired[c.J] {
+			continue
+		}
+		paired[c.I], paired[c.J] = true, true
+		picked = append(picked, c)
+	}
+	// ロビーは待機開始の古いプレイヤーを含む順に返す
+	sort.Slice(picked, func(a, b int) bool { return picked[a].I < picked[b].I })
+
+	lobbies := make([]Lobby, len(picked))
+	for k, c := range picked {
+		lobbies[k] = Lobby{GameMode: name, Teams: [][]model.QueueEntry{{entries[c.I]}, {entries[c.J]}}}
+	}
+	return lobbies
+}
+
+// findPairLobbies は1対1のゲームモードのエントリ（探す順に並んだもの）から、findLobby を繰り返した場合と同じロビーを1回の走査で組みます。
+// 2人のロビーでは、相手が見つからなかったエントリは他のエントリが抜けても相手が見つからないため、先頭から探し直す必要がありません。
+// レーティングの差の上限（policy.RatingWindow。配置戦中のプレイヤーは広げる）がある場合は、レーティング順に並べた添字を二分探索し、上限以内のエントリだけを相手の候補にします。
+// ただし待機時間が policy.StarvationThreshold を超えたエントリは先に、組める相手のうちレーティングの最も近い相手と組みます。
+// 成立したロビーと、どのロビーにも含まれなかったエントリ（元の順）を返します。
+func findPairLobbies(name string, entries []model.QueueEntry, now time.Time, policy MatchPolicy) ([]Lobby, []model.QueueEntry) {
+	used := make([]bool, len(entries))
+	var byRating []int
+	if policy.RatingWindow > 0 {
+		byRating = indicesByRating(entries)
+	}
+	// canJoin は anchor のいるロビーに j が入れるかどうかを findLobby と同じ条件で判定する
+	canJoin := func(anchor []model.QueueEntry, j int) bool {
+		return !used[j] && len(entries[j].Players) == 1 && canJoinLobby(entries[j], [][]model.QueueEntry{anchor}, now, policy)
+	}
+
+	var lobbies []Lobby
+	for a := range entries {
+		if used[a] || len(entries[a].Players) != 1 || !entries[a].IsStarving(now, policy.StarvationThreshold) {
+			continue
+		}
+		anchor := []model.QueueEntry{entries[a]}
+		partner := -1
+		for j := range entries {
+			if j == a || !canJoin(anchor, j) {
+				continue
+			}
+			if partner < 0 || model.RatingDistance(entries[a].Rating, entries[j].Rating) < model.RatingDistance(entries[a].Rating, entries[partner].Rating) {
+				partner = j
+			}
+		}
+		if partner < 0 {
+			continue
+		}
+		used[a], used[partner] = true, true
+		lobbies = append(lobbies, Lobby{GameMode: name, Teams: [][]model.QueueEntry{{entries[a]}, {entries[partner]}}})
+	}
+
+	for a := range entries {
+		if used[a] || len(entries[a].Players) != 1 {
+			continue
+		}
+		anchor := []model.QueueEntry{entries[a]}
+		// 相手は a より後ろで最初に組めるエントリ（findLobby と同じ）
+		partner := -1
+		if byRating == nil {
+			for j := a + 1; j < len(entries); j++ {
+				if canJoin(anchor, j) {
+					partner = j
+					break
+				}
+			}
+		} else {
+			rating, window := entries[a].Rating, widestRatingWindow(policy.RatingWindow, policy.PlacementMatches)
+			lo := sort.Search(len(byRating), func(k int) bool { return entries[byRating[k]].Rating >= rating-window })
+			for _, j := range byRating[lo:] {
+				if entries[j].Rating > rating+window {
+					break
+				}
+				if j > a && (partner < 0 || j < partner) && canJoin(anchor, j) {
+					partner = j
+				}
+			}
+		}
+		if partner < 0 {
+			continue
+		}
+		used[a], used[partner] = true, true
+		lobbies = append(lobbies, Lobby{GameMode: name, Teams: [][]model.QueueEntry{{entries[a]}, {entries[partner]}}})
+	}
+
+	var rest []model.QueueEntry
+	for i, e := range entries {
+		if !used[i] {
+			rest = append(rest, e)
+		}
+	}
+	return lobbies, rest
+}
+
+// indicesByRating はエントリの添字をレーティングの低い順（同じレーティングでは元の順）に並べて返します。
+func indicesByRating(entries []model.QueueEntry) []int {
+	idx := make([]int, len(entries))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return entries[idx[a]].Rating < entries[idx[b]].Rating })
+	return idx
+}
+
+// isHeadToHead はゲームモードが1人対1人のモードかどうかを返します。
+func (m GameMode) isHeadToHead() bool {
+	return m.LobbySize == 2 && m.TeamCount() == 2
+}
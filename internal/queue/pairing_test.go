@@ -0,0 +1,171 @@
+package queue
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+func TestFindLobbiesRegion(t *testing.T) {
+	now := testEpoch
+	const fallback = 15 * time.Second
+	for _, tc := range []struct {
+		name     string
+		entries  []model.QueueEntry
+		fallback time.Duration
+		want     []string
+	}{
+		{
+			name:     "same region",
+			entries:  []model.QueueEntry{waitingEntry(now, "a", "asia", 0), waitingEntry(now, "b", "asia", 0)},
+			fallback: fallback,
+			want:     []string{"a-b"},
+		},
+		{
+			name:     "other region before the fallback",
+			entries:  []model.QueueEntry{waitingEntry(now, "a", "asia", fallback-time.Second), waitingEntry(now, "b", "eu", 0)},
+			fallback: fallback,
+			want:     []string{},
+		},
+		{
+			// どちらか一方の待機時間が fallback を超えれば地域をまたぐ
+			name:     "other region after the fallback",
+			entries:  []model.QueueEntry{waitingEntry(now, "a", "asia", fallback), waitingEntry(now, "b", "eu", 0)},
+			fallback: fallback,
+			want:     []string{"a-b"},
+		},
+		{
+			name:    "fallback disabled",
+			entries: []model.QueueEntry{waitingEntry(now, "a", "asia", time.Hour), waitingEntry(now, "b", "eu", time.Hour)},
+			want:    []string{},
+		},
+		{
+			name:     "no region matches any region",
+			entries:  []model.QueueEntry{waitingEntry(now, "a", "asia", 0), waitingEntry(now, "b", "", 0)},
+			fallback: fallback,
+			want:     []string{"a-b"},
+		},
+		{
+			// 先に待っている a は、後ろにいる同じ地域の c と組み、別の地域の b は残る
+			name:     "same region preferred over an earlier other region",
+			entries:  []model.QueueEntry{waitingEntry(now, "a", "asia", 3*time.Second), waitingEntry(now, "b", "eu", 2*time.Second), waitingEntry(now, "c", "asia", time.Second)},
+			fallback: fallback,
+			want:     []string{"a-c"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := MatchPolicy{CrossRegionFallback: tc.fallback, Modes: DefaultModes()}
+			if got := lobbyPairs(FindLobbies(tc.entries, now, policy)); !slices.Equal(got, tc.want) {
+				t.Fatalf("lobbies = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFindLobbiesAvoidsRecentOpponents(t *testing.T) {
+	now := testEpoch
+	const fallback = 20 * time.Second
+	recent := model.OpponentSet{}
+	recent.Add("a", "b")
+	for _, tc := range []struct {
+		name     string
+		entries  []model.QueueEntry
+		fallback time.Duration
+		want     []string
+	}{
+		{
+			// 組める相手が直前の対戦相手しかいない場合は、しきい値までは組ませない
+			name:     "only candidates are recent opponents",
+			entries:  []model.QueueEntry{waitingEntry(now, "a", "asia", fallback-time.Second), waitingEntry(now, "b", "asia", fallback-time.Second)},
+			fallback: fallback,
+			want:     []string{},
+		},
+		{
+			// 片方だけがしきい値を過ぎても組ませない（登録し直した直後のプレイヤーは別の相手を待つ）
+			name:     "only one past the override",
+			entries:  []model.QueueEntry{waitingEntry(now, "a", "asia", time.Hour), waitingEntry(now, "b", "asia", fallback-time.Second)},
+			fallback: fallback,
+			want:     []string{},
+		},
+		{
+			name:     "both past the override",
+			entries:  []model.QueueEntry{waitingEntry(now, "a", "asia", fallback), waitingEntry(now, "b", "asia", fallback)},
+			fallback: fallback,
+			want:     []string{"a-b"},
+		},
+		{
+			// 他の相手がいればそちらと組む
+			name:     "another candidate",
+			entries:  []model.QueueEntry{waitingEntry(now, "a", "asia", 3*time.Second), waitingEntry(now, "b", "asia", 2*time.Second), waitingEntry(now, "c", "asia", time.Second)},
+			fallback: fallback,
+			want:     []string{"a-c"},
+		},
+		{
+			name:    "override disabled",
+			entries: []model.QueueEntry{waitingEntry(now, "a", "asia", time.Hour), waitingEntry(now, "b", "asia", time.Hour)},
+			want:    []string{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := MatchPolicy{RecentOpponents: recent, RematchFallback: tc.fallback, Modes: DefaultModes()}
+			if got := lobbyPairs(FindLobbies(tc.entries, now, policy)); !slices.Equal(got, tc.want) {
+				t.Fatalf("lobbies = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// totalRatingGap はロビーごとのレーティングの差の合計を返します。
+func totalRatingGap(lobbies []Lobby) int {
+	total := 0
+	for _, l := range lobbies {
+		entries := l.Entries()
+		total += model.RatingDistance(entries[0].Rating, entries[1].Rating)
+	}
+	return total
+}
+
+// best_pairing は待機開始順に先頭から組む場合より、レーティングの近い組み合わせを選ぶ
+func TestBestPairingBeatsHeadOfQueue(t *testing.T) {
+	now := testEpoch
+	entries := []model.QueueEntry{
+		ratedEntry(now, "a", 1000, 4*time.Second),
+		ratedEntry(now, "b", 1400, 3*time.Second),
+		ratedEntry(now, "c", 1420, 2*time.Second),
+		ratedEntry(now, "d", 1010, time.Second),
+	}
+	matcher := RatingWindowMatcher{Window: 500}
+	policy := MatchPolicy{Modes: DefaultModes()}
+
+	naive := matcher.Match(entries, now, policy)
+	if got, want := lobbyPairs(naive), []string{"a-b", "c-d"}; !slices.Equal(got, want) {
+		t.Fatalf("head-of-queue lobbies = %q, want %q", got, want)
+	}
+	policy.BestPairing = true
+	best := matcher.Match(entries, now, policy)
+	got := lobbyPairs(best)
+	slices.Sort(got)
+	if want := []string{"a-d", "b-c"}; !slices.Equal(got, want) {
+		t.Fatalf("best pairing lobbies = %q, want %q", got, want)
+	}
+	if naiveGap, bestGap := totalRatingGap(naive), totalRatingGap(best); bestGap != 30 || naiveGap != 810 {
+		t.Errorf("total rating gap = %d (best) vs %d (head of queue), want 30 vs 810", bestGap, naiveGap)
+	}
+	// 同じ入力に対しては常に同じ結果を返す
+	if again := lobbyPairs(matcher.Match(entries, now, policy)); !slices.Equal(again, lobbyPairs(best)) {
+		t.Errorf("second run = %q, want %q", again, lobbyPairs(best))
+	}
+
+	// レーティングが同じなら、長く待っているプレイヤーを含む組を優先する
+	entries = []model.QueueEntry{
+		ratedEntry(now, "x", 1500, time.Second),
+		ratedEntry(now, "y", 1500, time.Second),
+		ratedEntry(now, "z", 1500, 25*time.Second),
+	}
+	if got := lobbyPairs(matcher.Match(entries, now, policy)); len(got) != 1 || !strings.Contains(got[0], "z") {
+		t.Errorf("lobbies = %q, want the long waiter z paired", got)
+	}
+}
@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// syntheticQueue は n 人の1対1の待機キュー（レーティングは 2000 の幅に散らばり、地域は3つ、先頭ほど長く待っている）を返します。
+func syntheticQueue(now time.Time, n int) []model.QueueEntry {
+	rng := rand.New(rand.NewSource(int64(n)))
+	regions := []string{"asia", "eu", "na"}
+	entries := make([]model.QueueEntry, n)
+	for i := range entries {
+		entries[i] = ratedEntry(now, fmt.Sprintf("p%06d", i), 1000+rng.Intn(2000), time.Duration(n-i)*10*time.Millisecond)
+		entries[i].Region = regions[rng.Intn(len(regions))]
+		entries[i].Players[0].Region = entries[i].Region
+	}
+	return entries
+}
+
+// 1万人の待機キューでも1回の確認で組み終え、同じプレイヤーを2回使わず、組める2人を残さない
+func TestFindLobbiesLargeQueue(t *testing.T) {
+	now := testEpoch
+	entries := syntheticQueue(now, 10000)
+	policy := MatchPolicy{Modes: strategyModes(100)}
+
+	start := time.Now()
+	lobbies := FindLobbies(entries, now, policy)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("pairing 10k players took %v, want well under a second", elapsed)
+	}
+
+	byID := make(map[string]model.QueueEntry)
+	for _, e := range entries {
+		byID[e.Players[0].ID] = e
+	}
+	for _, l := range lobbies {
+		members := l.Entries()
+		if len(members) != 2 {
+			t.Fatalf("lobby with %d entries, want 2", len(members))
+		}
+		a, b := members[0], members[1]
+		if a.Region != b.Region || max(a.Rating-b.Rating, b.Rating-a.Rating) > 100 {
+			t.Fatalf("lobby %s (%s %d) - %s (%s %d) breaks the region or rating window", a.Players[0].ID, a.Region, a.Rating, b.Players[0].ID, b.Region, b.Rating)
+		}
+		for _, e := range members {
+			if _, ok := byID[e.Players[0].ID]; !ok {
+				t.Fatalf("%s is in more than one lobby", e.Players[0].ID)
+			}
+			delete(byID, e.Players[0].ID)
+		}
+	}
+	if len(lobbies) < len(entries)/4 {
+		t.Fatalf("only %d lobbies for %d players", len(lobbies), len(entries))
+	}
+
+	// 残ったプレイヤーの中に、同じ地域でレーティングの差が上限以内の2人はいない
+	left := make(map[string][]int)
+	for _, e := range byID {
+		left[e.Region] = append(left[e.Region], e.Rating)
+	}
+	for region, ratings := range left {
+		slices.Sort(ratings)
+		for i := 1; i < len(ratings); i++ {
+			if ratings[i]-ratings[i-1] <= 100 {
+				t.Fatalf("%s: %d and %d were left unmatched", region, ratings[i-1], ratings[i])
+			}
+		}
+	}
+}
+
+// BenchmarkPairPlayers は1対1の待機キューを1回組み終えるまでの時間を、待機人数ごとに測ります（DB の入出力を除く）。
+func BenchmarkPairPlayers(b *testing.B) {
+	now := testEpoch
+	policy := MatchPolicy{Modes: strategyModes(100)}
+	for _, n := range []int{1000, 10000, 100000} {
+		entries := syntheticQueue(now, n)
+		b.Run(fmt.Sprintf("players=%d", n), func(b *testing.B) {
+			for range b.N {
+				FindLobbies(entries, now, policy)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package queue
+
+import (
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// canMatchPing は2つのエントリが ping の条件上マッチング可能かどうかを判定します。
+// 2つのエントリの ping の合計が maxPing を超える組み合わせは、いずれかのエントリの待機時間が fallback 以上になるまで組ませません。
+// maxPing が 0 以下の場合と、どちらかの ping が未計測の場合は制限しません。
+func canMatchPing(e1, e2 model.QueueEntry, now time.Time, maxPing int, fallback time.Duration) bool {
+	p1, p2 := e1.PingMS(), e2.PingMS()
+	if maxPing <= 0 || p1 == 0 || p2 == 0 || p1+p2 <= maxPing {
+		return true
+	}
+	if fallback <= 0 {
+		return false
+	}
+	return now.Sub(e1.WaitingSince) >= fallback || now.Sub(e2.WaitingSince) >= fallback
+}
@@ -0,0 +1,62 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// pingEntry は ping が pings（パーティの場合はメンバーごと）のエントリです。
+func pingEntry(now time.Time, id string, wait time.Duration, pings ...int) model.QueueEntry {
+	e := waitingEntry(now, id, "asia", wait)
+	e.Players = nil
+	for i, ping := range pings {
+		e.Players = append(e.Players, model.Player{ID: id + string(rune('a'+i)), Rating: 1500, PingMS: ping})
+	}
+	return e
+}
+
+// 2つのエントリの ping の合計が max_ping_ms を超える組み合わせは、どちらかの待機時間が PingFallback を超えるまで組まない。
+// パーティの ping はメンバーの最大値で、ping が未計測のエントリは制限しない
+func TestFindLobbiesPing(t *testing.T) {
+	now := testEpoch
+	const fallback = 20 * time.Second
+	modes := DefaultModes()
+	duel, twos := modes["duel"], modes["2v2"]
+	duel.MaxPingMS, twos.MaxPingMS = 200, 200
+	modes["duel"], modes["2v2"] = duel, twos
+	party := func(e model.QueueEntry) model.QueueEntry {
+		e.PartyID, e.GameMode = "party-"+e.Players[0].ID, "2v2"
+		return e
+	}
+	solo2v2 := func(e model.QueueEntry) model.QueueEntry {
+		e.GameMode = "2v2"
+		return e
+	}
+	for _, tc := range []struct {
+		name     string
+		fallback time.Duration
+		entries  []model.QueueEntry
+		want     int
+	}{
+		{"within the cap", fallback, []model.QueueEntry{pingEntry(now, "a", time.Second, 90), pingEntry(now, "b", 0, 110)}, 1},
+		{"over the cap", fallback, []model.QueueEntry{pingEntry(now, "a", time.Second, 150), pingEntry(now, "b", 0, 150)}, 0},
+		{"over the cap after the fallback", fallback, []model.QueueEntry{pingEntry(now, "a", fallback, 150), pingEntry(now, "b", 0, 150)}, 1},
+		{"fallback disabled", 0, []model.QueueEntry{pingEntry(now, "a", time.Hour, 150), pingEntry(now, "b", 0, 150)}, 0},
+		{"not measured", fallback, []model.QueueEntry{pingEntry(now, "a", time.Second, 0), pingEntry(now, "b", 0, 400)}, 1},
+		{"party uses its highest ping", fallback, []model.QueueEntry{
+			party(pingEntry(now, "a", time.Second, 20, 190)), party(pingEntry(now, "b", 0, 20, 20)),
+		}, 0},
+		{"party within the cap", fallback, []model.QueueEntry{
+			party(pingEntry(now, "a", time.Second, 20, 90)), solo2v2(pingEntry(now, "b", 0, 100)), solo2v2(pingEntry(now, "c", 0, 100)),
+		}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := MatchPolicy{Modes: modes, PingFallback: tc.fallback}
+			if got := FindLobbies(tc.entries, now, policy); len(got) != tc.want {
+				t.Fatalf("lobbies = %q, want %d", lobbyPairs(got), tc.want)
+			}
+		})
+	}
+}
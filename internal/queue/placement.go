@@ -0,0 +1,116 @@
+package queue
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"matchmaking_project/internal/model"
+)
+
+const (
+	// placementWindowScale は配置戦の最初の対戦でのレーティングの差の上限の倍率です。配置戦が進むにつれて 1 倍まで縮めます。
+	placementWindowScale = 2
+	// eloKFactor は配置戦を終えたプレイヤーの Elo の K 係数です。
+	eloKFactor = 32
+	// placementKFactor は配置戦の最初の対戦での K 係数です。配置戦が進むにつれて eloKFactor まで縮めます。
+	placementKFactor = 64
+)
+
+// PlacementMatchesRemaining は配置戦の数が placementMatches（Config.PlacementMatches）の場合に、対戦数 gamesPlayed のプレイヤーに残っている配置戦の数を返します。
+func PlacementMatchesRemaining(placementMatches, gamesPlayed int) int {
+	return max(placementMatches-max(gamesPlayed, 0), 0)
+}
+
+// placementRatingWindow は対戦数 gamesPlayed のプレイヤーに適用するレーティングの差の上限を返します。
+// 配置戦の最初の対戦では window の placementWindowScale 倍で、残りの配置戦（全部で placementMatches）の数に比例して window まで縮めます。
+func placementRatingWindow(window, gamesPlayed, placementMatches int) int {
+	if window <= 0 || placementMatches <= 0 {
+		return window
+	}
+	return window + window*(placementWindowScale-1)*PlacementMatchesRemaining(placementMatches, gamesPlayed)/placementMatches
+}
+
+// widestRatingWindow は配置戦を考慮したレーティングの差の上限のうち、最も広いもの（対戦数 0 のプレイヤーのもの）を返します。
+// レーティング順に並べて相手の候補を絞り込む場合に使い、実際に組めるかどうかは canJoinLobby で判定します。
+func widestRatingWindow(window, placementMatches int) int {
+	return placementRatingWindow(window, 0, placementMatches)
+}
+
+// pairRatingWindow は2つのエントリを組み合わせる場合のレーティングの差の上限を返します。
+// どちらかに配置戦中のメンバーがいれば、そのレーティングは不確かなため上限を広げます。
+func pairRatingWindow(e1, e2 model.QueueEntry, window, placementMatches int) int {
+	return placementRatingWindow(window, min(e1.FewestGamesPlayed(), e2.FewestGamesPlayed()), placementMatches)
+}
+
+// placementEloKFactor は対戦数 gamesPlayed のプレイヤーの Elo の K 係数を返します。
+// 配置戦の最初の対戦では placementKFactor で、残りの配置戦（全部で placementMatches）の数に比例して eloKFactor まで縮めます。
+func placementEloKFactor(gamesPlayed, placementMatches int) float64 {
+	if placementMatches <= 0 {
+		return eloKFactor
+	}
+	remaining := float64(PlacementMatchesRemaining(placementMatches, gamesPlayed)) / float64(placementMatches)
+	return eloKFactor + (placementKFactor-eloKFactor)*remaining
+}
+
+// eloRatingChange は対戦数 gamesPlayed、レーティング rating のプレイヤーが opponent と対戦し、
+// score（勝ち 1、引き分け 0.5、負け 0）だった場合のレーティングの変化量を返します。
+func eloRatingChange(rating, opponent int, score float64, gamesPlayed, placementMatches int) int {
+	return int(math.Round(placementEloKFactor(gamesPlayed, placementMatches) * (score - eloWinProbability(rating, opponent))))
+}
+
+// ParseSkillSeedRatings は "beginner=1000,advanced=1400" 形式の腕前ごとの初期レーティングを解析します。
+func ParseSkillSeedRatings(v string) (map[string]int, error) {
+	seeds := make(map[string]int)
+	for _, item := range model.SplitCommaList(v) {
+		skill, rating, ok := strings.Cut(item, "=")
+		skill = strings.TrimSpace(skill)
+		if !ok || skill == "" {
+			return nil, fmt.Errorf("%q は <腕前>=<レーティング> の形式ではありません", item)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(rating))
+		if err != nil || n < model.MinRating || n > model.MaxRating {
+			return nil, fmt.Errorf("%s のレーティング %q が不正です（%d〜%d）", skill, rating, model.MinRating, model.MaxRating)
+		}
+		seeds[skill] = n
+	}
+	if len(seeds) == 0 {
+		return nil, fmt.Errorf("腕前が指定されていません")
+	}
+	return seeds, nil
+}
+
+// ResultRatingChanges は winningTeam（1 始まり）が勝利したセッションの、参加者ごとのレーティングの変化量を返します。
+// ボットを含むセッションの結果はレーティングに反映しないため、空の map を返します。
+// winningTeam が 0 の場合は引き分けとして、全員のスコアを 0.5 にします（相手より低いレーティングの参加者は上がり、高い参加者は下がる）。
+// 相手のレーティングは他のチームの参加者の平均とし、配置戦の数が placementMatches の場合の K 係数で Elo の式から求めます。
+// 参加者の GamesPlayed はこのセッションを含む対戦数のため、K 係数にはこのセッションより前の対戦数を使います。
+func ResultRatingChanges(session model.SessionResult, winningTeam, placementMatches int) map[string]int {
+	changes := make(map[string]int)
+	for _, p := range session.Participants {
+		if p.IsBot {
+			return map[string]int{}
+		}
+	}
+	for _, p := range session.Participants {
+		var opponents []model.Player
+		for _, o := range session.Participants {
+			if o.Team != p.Team {
+				opponents = append(opponents, o.Player)
+			}
+		}
+		if len(opponents) == 0 {
+			continue
+		}
+		score := 0.0
+		switch {
+		case winningTeam == 0:
+			score = 0.5
+		case p.Team == winningTeam:
+			score = 1
+		}
+		changes[p.ID] = eloRatingChange(p.Rating, model.AverageRating(opponents), score, max(p.GamesPlayed-1, 0), placementMatches)
+	}
+	return changes
+}
@@ -0,0 +1,82 @@
+package queue
+
+import (
+	"testing"
+
+	"matchmaking_project/internal/model"
+)
+
+// 配置戦中のプレイヤーはレーティングの差の上限が広く、対戦数が増えるにつれて通常の上限まで縮む
+func TestPlacementRatingWindowShrinks(t *testing.T) {
+	now := testEpoch
+	policy := MatchPolicy{Modes: strategyModes(100), PlacementMatches: 5}
+	// 対戦数 0〜6 のプレイヤーの上限（100 の2倍から、残りの配置戦の数に比例して 100 まで）
+	for games, window := range []int{200, 180, 160, 140, 120, 100, 100} {
+		for _, gap := range []int{window, window + 1} {
+			rookie := ratedEntry(now, "rookie", 1000, 0)
+			rookie.Players[0].GamesPlayed = games
+			veteran := ratedEntry(now, "veteran", 1000+gap, 0)
+			veteran.Players[0].GamesPlayed = 50
+
+			matched := len(FindLobbies([]model.QueueEntry{rookie, veteran}, now, policy)) == 1
+			if want := gap <= window; matched != want {
+				t.Errorf("%d games played, gap %d: matched = %v, want %v", games, gap, matched, want)
+			}
+		}
+	}
+}
+
+// 配置戦中のプレイヤーは K 係数が大きく、対戦数が増えるにつれて通常の K 係数まで縮む
+func TestPlacementKFactorShrinks(t *testing.T) {
+	session := func(games int) model.SessionResult {
+		// GamesPlayed はこのセッションを含む対戦数
+		return model.SessionResult{Participants: []model.Participant{
+			{Player: model.Player{ID: "rookie", Rating: 1500, GamesPlayed: games + 1}, Team: 1},
+			{Player: model.Player{ID: "veteran", Rating: 1500, GamesPlayed: 50}, Team: 2},
+		}}
+	}
+	// 同じレーティングの相手に勝った場合の変化量は K/2（64 から 32 まで縮む）
+	for games, want := range []int{32, 29, 26, 22, 19, 16, 16} {
+		changes := ResultRatingChanges(session(games), 1, 5)
+		if changes["rookie"] != want {
+			t.Errorf("%d games played: rookie change = %d, want %d", games, changes["rookie"], want)
+		}
+		if changes["veteran"] != -16 {
+			t.Errorf("%d games played: veteran change = %d, want -16", games, changes["veteran"])
+		}
+	}
+	if changes := ResultRatingChanges(session(0), 1, 0); changes["rookie"] != 16 {
+		t.Errorf("without placements: rookie change = %d, want 16", changes["rookie"])
+	}
+}
+
+func TestResultRatingChangesDraw(t *testing.T) {
+	session := model.SessionResult{Participants: []model.Participant{
+		{Player: model.Player{ID: "low", Rating: 1400, GamesPlayed: 50}, Team: 1},
+		{Player: model.Player{ID: "high", Rating: 1600, GamesPlayed: 50}, Team: 2},
+	}}
+	// 32 × (0.5 − 1/(1+10^(200/400))) ≒ 8.3
+	changes := ResultRatingChanges(session, 0, 0)
+	if changes["low"] != 8 || changes["high"] != -8 {
+		t.Fatalf("draw changes = %v, want low +8 and high -8", changes)
+	}
+
+	// 同じレーティングどうしの引き分けは変化しない
+	session.Participants[1].Rating = 1400
+	if changes := ResultRatingChanges(session, 0, 0); changes["low"] != 0 || changes["high"] != 0 {
+		t.Fatalf("equal-rating draw changes = %v, want none", changes)
+	}
+}
+
+// ボットを含むセッションの結果は、ボット以外の参加者のレーティングにも反映しない
+func TestResultRatingChangesSkipsBotSessions(t *testing.T) {
+	session := model.SessionResult{Participants: []model.Participant{
+		{Player: model.Player{ID: "alice", Rating: 1500, GamesPlayed: 50}, Team: 1},
+		{Player: model.Player{ID: "bot-1", Rating: 1500, IsBot: true}, Team: 2},
+	}}
+	for _, winningTeam := range []int{0, 1, 2} {
+		if changes := ResultRatingChanges(session, winningTeam, 0); len(changes) != 0 {
+			t.Errorf("winning team %d: changes = %v, want none", winningTeam, changes)
+		}
+	}
+}
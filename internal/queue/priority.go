@@ -0,0 +1,15 @@
+package queue
+
+import (
+	"sort"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// sortByPriority は待機開始順に並んだエントリを、優先度の高い順に並べ替えます。同じ優先度の間では待機開始順を保ちます。
+func sortByPriority(entries []model.QueueEntry, now time.Time, ceiling time.Duration) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].EffectivePriority(now, ceiling) > entries[j].EffectivePriority(now, ceiling)
+	})
+}
@@ -0,0 +1,61 @@
+package queue
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// priorityEntry は優先度 priority で wait の間待機しているエントリです。
+func priorityEntry(now time.Time, id string, priority int, wait time.Duration) model.QueueEntry {
+	e := waitingEntry(now, id, "asia", wait)
+	e.Priority, e.Players[0].Priority = priority, priority
+	return e
+}
+
+// 優先度の高いエントリから相手を探し、同じ優先度では長く待っている方を先にする。
+// 待機時間が PriorityAgingCeiling を超えたエントリは優先度に関わらず最大の優先度として扱う
+func TestFindLobbiesPriority(t *testing.T) {
+	now := testEpoch
+	const ceiling = 20 * time.Second
+	for _, tc := range []struct {
+		name    string
+		ceiling time.Duration
+		// entries は待機開始順に並べる
+		entries []model.QueueEntry
+		want    []string
+	}{
+		{
+			name:    "higher priority first",
+			ceiling: ceiling,
+			entries: []model.QueueEntry{priorityEntry(now, "a", 0, 10*time.Second), priorityEntry(now, "b", 0, 5*time.Second), priorityEntry(now, "c", 5, time.Second)},
+			want:    []string{"c-a"},
+		},
+		{
+			name:    "same priority by wait",
+			ceiling: ceiling,
+			entries: []model.QueueEntry{priorityEntry(now, "a", 0, 15*time.Second), priorityEntry(now, "b", 3, 8*time.Second), priorityEntry(now, "c", 3, 2*time.Second)},
+			want:    []string{"b-c"},
+		},
+		{
+			name:    "long waiter beats fresh high priority",
+			ceiling: ceiling,
+			entries: []model.QueueEntry{priorityEntry(now, "a", 0, 60*time.Second), priorityEntry(now, "b", model.MaxQueuePriority, 0), priorityEntry(now, "c", model.MaxQueuePriority, 0)},
+			want:    []string{"a-b"},
+		},
+		{
+			name:    "aging disabled",
+			entries: []model.QueueEntry{priorityEntry(now, "a", 0, 60*time.Second), priorityEntry(now, "b", model.MaxQueuePriority, 0), priorityEntry(now, "c", model.MaxQueuePriority, 0)},
+			want:    []string{"b-c"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := MatchPolicy{Modes: DefaultModes(), PriorityAgingCeiling: tc.ceiling}
+			if got := lobbyPairs(FindLobbies(tc.entries, now, policy)); !slices.Equal(got, tc.want) {
+				t.Fatalf("lobbies = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// MatchCycle はマッチングプロセッサーの1回の処理の結果です。
+type MatchCycle struct {
+	// Waiting はマッチングの対象にした待機中のエントリの数です。リーダーでないため待機キューを確認しなかった場合は 0 です。
+	Waiting int
+	// Matched は作成したセッションの数です。
+	Matched int
+}
+
+// processorScheduler はマッチングプロセッサーの次の処理までの待機時間を、直前の処理の結果から決めます。
+//   - 待機中のエントリがあれば interval ごとに確認する（待機時間が延びると条件が緩むため、成立しなくても間隔は延ばさない）
+//   - 待機キューが空の間は、確認するたびに間隔を倍にして maxIdle まで延ばす（登録の通知ですぐ確認するため、遅れるのは他のインスタンスへの登録のみ）
+//   - 処理が失敗した場合は、DB に負荷をかけ続けないよう maxBackoff まで倍々に延ばし、その間は登録の通知でも確認しない
+//
+// 登録の通知（server.matchWake）はバッファ1のチャネルのため、処理中の登録が何件あっても追加の確認は1回にまとまります。
+type processorScheduler struct {
+	interval, maxIdle, maxBackoff time.Duration
+	// after は待機に使うタイマーです（time.After。テストで時刻を進めるため差し替えられます）。
+	after func(time.Duration) <-chan time.Time
+	// idle は待機キューが空だった連続回数、failures は失敗した連続回数です。
+	idle, Failures int
+}
+
+// NewProcessorScheduler は interval（PROCESSOR_INTERVAL）から始まるスケジューラを返します。maxIdle が interval より短い場合は interval を使います。
+func NewProcessorScheduler(interval, maxIdle, maxBackoff time.Duration, after func(time.Duration) <-chan time.Time) *processorScheduler {
+	return &processorScheduler{interval: interval, maxIdle: max(maxIdle, interval), maxBackoff: maxBackoff, after: after}
+}
+
+// Next は次の処理までの待機時間と、その間に登録の通知で待機を打ち切ってよいかどうかを返します。
+func (p *processorScheduler) Next() (wait time.Duration, wakeable bool) {
+	switch {
+	case p.Failures > 0:
+		return model.BackoffDelay(p.Failures, p.interval, p.maxBackoff), false
+	case p.idle > 0:
+		return model.BackoffDelay(p.idle, p.interval, p.maxIdle), true
+	default:
+		return p.interval, true
+	}
+}
+
+// Wait は next の待機時間が過ぎるか、wakeable の間に wake が通知されるまで待ちます。stop が閉じられた場合は false を返します。
+func (p *processorScheduler) Wait(stop <-chan struct{}, wake <-chan struct{}) bool {
+	d, wakeable := p.Next()
+	if !wakeable {
+		wake = nil
+	}
+	select {
+	case <-stop:
+		return false
+	case <-p.after(d):
+	case <-wake:
+	}
+	return true
+}
+
+// Observe は処理の結果を記録します。成功した処理でセッションを作成した場合や待機中のエントリがある場合は、最短の間隔に戻します。
+func (p *processorScheduler) Observe(cycle MatchCycle, err error) {
+	if err != nil {
+		p.Failures++
+		return
+	}
+	p.Failures = 0
+	if cycle.Matched > 0 || cycle.Waiting > 0 {
+		p.idle = 0
+		return
+	}
+	p.idle++
+}
@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"math"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// matchQualityWeights はマッチ品質スコアの算出に用いる重みと基準値です。
+type matchQualityWeights struct {
+	// Rating はレーティング差による評価の重みです。
+	Rating float64
+	// Wait は待機時間による評価の重みです。
+	Wait float64
+	// RatingGapScale はスコアが 0 になるレーティング差です。
+	RatingGapScale int
+	// WaitScale はスコアが 0 になる待機時間です。
+	WaitScale time.Duration
+}
+
+// DefaultMatchQualityWeights は標準のマッチ品質スコアの重みです。
+var DefaultMatchQualityWeights = matchQualityWeights{
+	Rating:         0.8,
+	Wait:           0.2,
+	RatingGapScale: 400,
+	WaitScale:      30 * time.Second,
+}
+
+// matchAssessment はロビーの対戦の質の指標です。マッチ品質スコアの算出と、セッションへの記録（チューニング用）に使います。
+type matchAssessment struct {
+	// RatingGap はチーム平均レーティングの最大差です。
+	RatingGap int
+	// WinProbability は平均レーティングが最も高いチームが最も低いチームに勝つ、Elo の式による期待勝率です（0.5 で互角）。
+	WinProbability float64
+	// MaxWait, MinWait はボットを除く参加者の待機時間の最大・最小です。
+	MaxWait, MinWait time.Duration
+}
+
+// eloWinProbability は Elo の式で、レーティング rating のプレイヤーが opponent に勝つ期待勝率を返します。
+func eloWinProbability(rating, opponent int) float64 {
+	return 1 / (1 + math.Pow(10, float64(opponent-rating)/400))
+}
+
+// AssessLobby はマッチング決定時点のロビー情報（チームごとの平均レーティング・待機開始時刻）から対戦の質の指標を求めます。
+// 同じ入力に対しては常に同じ値を返すよう、現在時刻も引数で受け取ります。
+func AssessLobby(l Lobby, now time.Time) matchAssessment {
+	// チーム平均レーティングの最大差で評価する
+	minRating, maxRating := 0, 0
+	for i, team := range l.Teams {
+		var players []model.Player
+		for _, e := range team {
+			players = append(players, e.Players...)
+		}
+		r := model.AverageRating(players)
+		if i == 0 || r < minRating {
+			minRating = r
+		}
+		if i == 0 || r > maxRating {
+			maxRating = r
+		}
+	}
+	a := matchAssessment{RatingGap: maxRating - minRating, WinProbability: eloWinProbability(maxRating, minRating)}
+
+	// ボットは待機していないため待機時間に含めない
+	first := true
+	for _, e := range l.Entries() {
+		if e.IsBotEntry() {
+			continue
+		}
+		wait := now.Sub(e.WaitingSince)
+		if first || wait > a.MaxWait {
+			a.MaxWait = wait
+		}
+		if first || wait < a.MinWait {
+			a.MinWait = wait
+		}
+		first = false
+	}
+	return a
+}
+
+// ComputeMatchQuality はロビーの対戦の質の指標（AssessLobby）から 0〜100 のマッチ品質スコアを算出します。
+func ComputeMatchQuality(a matchAssessment, w matchQualityWeights) int {
+	total := w.Rating + w.Wait
+	if total <= 0 {
+		return 0
+	}
+	ratingScore := 1.0
+	if w.RatingGapScale > 0 {
+		ratingScore = clamp01(1 - float64(a.RatingGap)/float64(w.RatingGapScale))
+	}
+	// 長く待たされたプレイヤーがいるほど品質は低いとみなす
+	waitScore := 1.0
+	if w.WaitScale > 0 {
+		waitScore = clamp01(1 - float64(a.MaxWait)/float64(w.WaitScale))
+	}
+
+	score := (w.Rating*ratingScore + w.Wait*waitScore) / total
+	return int(math.Round(score * 100))
+}
+
+// clamp01 は v を 0〜1 の範囲に丸めます。
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
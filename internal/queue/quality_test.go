@@ -0,0 +1,99 @@
+package queue
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// duelLobby は rating の2人（待機開始は now から wait 前）のロビーを返します。
+func duelLobby(now time.Time, a, b int, waitA, waitB time.Duration) Lobby {
+	entry := func(id string, rating int, wait time.Duration) []model.QueueEntry {
+		return []model.QueueEntry{{Players: []model.Player{{ID: id, Rating: rating}}, WaitingSince: now.Add(-wait)}}
+	}
+	return Lobby{GameMode: "duel", Teams: [][]model.QueueEntry{entry("a", a, waitA), entry("b", b, waitB)}}
+}
+
+func TestComputeMatchQuality(t *testing.T) {
+	now := testEpoch
+	for _, tc := range []struct {
+		name  string
+		lobby Lobby
+		// weights が true の場合は既定の重みの代わりに rating, wait を使う
+		weights      bool
+		rating, wait float64
+		want         int
+	}{
+		{name: "equal ratings, no wait", lobby: duelLobby(now, 1500, 1500, 0, 0), want: 100},
+		{name: "half the gap scale", lobby: duelLobby(now, 1400, 1600, 0, 0), want: 60},
+		{name: "gap beyond the scale", lobby: duelLobby(now, 1000, 1600, 0, 0), want: 20},
+		// 長く待った方の待機時間で評価する
+		{name: "half the wait scale", lobby: duelLobby(now, 1500, 1500, 15*time.Second, time.Second), want: 90},
+		{name: "wait beyond the scale", lobby: duelLobby(now, 1500, 1500, time.Minute, 0), want: 80},
+		{name: "rating only", lobby: duelLobby(now, 1400, 1600, time.Minute, 0), weights: true, rating: 1, want: 50},
+		{name: "wait only", lobby: duelLobby(now, 1000, 1600, 15*time.Second, 0), weights: true, wait: 1, want: 50},
+		{name: "no weights", lobby: duelLobby(now, 1500, 1500, 0, 0), weights: true, want: 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := DefaultMatchQualityWeights
+			if tc.weights {
+				w.Rating, w.Wait = tc.rating, tc.wait
+			}
+			if got := ComputeMatchQuality(AssessLobby(tc.lobby, now), w); got != tc.want {
+				t.Fatalf("quality = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+// ボットは待機していないため、待機時間の評価に含めない
+func TestAssessLobbyIgnoresBots(t *testing.T) {
+	now := testEpoch
+	lobby := duelLobby(now, 1500, 1600, 10*time.Second, 0)
+	lobby.Teams[1][0].Players[0].IsBot = true
+	a := AssessLobby(lobby, now)
+	if a.MaxWait != 10*time.Second || a.MinWait != 10*time.Second {
+		t.Fatalf("waits = %v..%v, want only the human's 10s", a.MinWait, a.MaxWait)
+	}
+	if a.RatingGap != 100 {
+		t.Fatalf("rating gap = %d, want 100", a.RatingGap)
+	}
+	if a.WinProbability <= 0.5 || a.WinProbability >= 0.7 {
+		t.Fatalf("win probability = %v, want the Elo expectation for 100 points (about 0.64)", a.WinProbability)
+	}
+}
+
+// 勝率は Elo の式による、平均レーティングが最も高いチームの期待勝率で、チーム戦ではチームの平均レーティングで比べる
+func TestAssessLobbyEloExpectations(t *testing.T) {
+	now := testEpoch
+	team := func(ratings ...int) []model.QueueEntry {
+		var entries []model.QueueEntry
+		for _, r := range ratings {
+			entries = append(entries, model.QueueEntry{Players: []model.Player{{Rating: r}}, WaitingSince: now})
+		}
+		return entries
+	}
+	for _, tc := range []struct {
+		name    string
+		lobby   Lobby
+		gap     int
+		winProb float64
+	}{
+		{"even", duelLobby(now, 1500, 1500, 0, 0), 0, 0.5},
+		{"100 points", duelLobby(now, 1600, 1500, 0, 0), 100, 0.6401},
+		{"200 points", duelLobby(now, 1300, 1500, 0, 0), 200, 0.7597},
+		{"400 points", duelLobby(now, 1900, 1500, 0, 0), 400, 0.9091},
+		{"800 points", duelLobby(now, 1000, 1800, 0, 0), 800, 0.9901},
+		{"team averages", Lobby{GameMode: "2v2", Teams: [][]model.QueueEntry{team(1400, 1600), team(1500, 1700)}}, 100, 0.6401},
+		{"largest of three teams", Lobby{GameMode: "ffa3", Teams: [][]model.QueueEntry{team(1500), team(1700), team(1600)}}, 200, 0.7597},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := AssessLobby(tc.lobby, now)
+			if a.RatingGap != tc.gap || math.Abs(a.WinProbability-tc.winProb) > 1e-4 {
+				t.Fatalf("gap %d, win probability %.4f, want %d and %.4f", a.RatingGap, a.WinProbability, tc.gap, tc.winProb)
+			}
+		})
+	}
+}
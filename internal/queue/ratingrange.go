@@ -0,0 +1,11 @@
+package queue
+
+import (
+	"matchmaking_project/internal/model"
+)
+
+// canMatchRatingRange は2つのエントリが互いに指定したレーティングの範囲に収まるかどうかを判定します。
+// 両方の条件を満たす必要があるため、より厳しい方の指定が優先されます。待機時間やスタベーションによる緩和は行いません。
+func canMatchRatingRange(e1, e2 model.QueueEntry) bool {
+	return e1.RatingRange.Accepts(e1.Rating, e2.Rating) && e2.RatingRange.Accepts(e2.Rating, e1.Rating)
+}
@@ -0,0 +1,41 @@
+package queue
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// 範囲を指定したプレイヤーは範囲外の相手を待機時間によらず断り、同じ相手でも範囲を指定していないプレイヤーとはマッチングする
+func TestRatingRangeRestrictsOpponents(t *testing.T) {
+	now := testEpoch
+	policy := MatchPolicy{Modes: strategyModes(0)}
+	restricted := func(id string, rating int, r model.RatingRange) model.QueueEntry {
+		e := ratedEntry(now, id, rating, time.Hour)
+		e.RatingRange, e.Players[0].RatingRange = r, r
+		return e
+	}
+	for _, tc := range []struct {
+		name    string
+		entries []model.QueueEntry
+		want    []string
+	}{
+		{"permissive", []model.QueueEntry{ratedEntry(now, "a", 1500, time.Hour), ratedEntry(now, "b", 1800, 0)}, []string{"a-b"}},
+		{"max delta", []model.QueueEntry{restricted("a", 1500, model.RatingRange{MaxDelta: 100}), ratedEntry(now, "b", 1800, 0)}, nil},
+		{"within max delta", []model.QueueEntry{restricted("a", 1500, model.RatingRange{MaxDelta: 100}), ratedEntry(now, "b", 1600, 0)}, []string{"a-b"}},
+		// 相手の側の指定でも断る
+		{"opponent's max delta", []model.QueueEntry{ratedEntry(now, "a", 1500, time.Hour), restricted("b", 1800, model.RatingRange{MaxDelta: 100})}, nil},
+		{"min rating", []model.QueueEntry{restricted("a", 1500, model.RatingRange{Min: 1600}), ratedEntry(now, "b", 1550, 0)}, nil},
+		{"max rating", []model.QueueEntry{restricted("a", 1500, model.RatingRange{Max: 1500}), ratedEntry(now, "b", 1550, 0)}, nil},
+		// 2人の指定のうち厳しい方を満たさなければ断る
+		{"tightest of both", []model.QueueEntry{restricted("a", 1500, model.RatingRange{MaxDelta: 300}), restricted("b", 1700, model.RatingRange{MaxDelta: 150})}, nil},
+		// 範囲外の相手を断り、範囲内の次の候補と組む
+		{"next candidate", []model.QueueEntry{restricted("a", 1500, model.RatingRange{MaxDelta: 100}), ratedEntry(now, "b", 1800, 0), ratedEntry(now, "c", 1450, 0)}, []string{"a-c"}},
+	} {
+		if got := lobbyPairs(FindLobbies(tc.entries, now, policy)); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: lobbies = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
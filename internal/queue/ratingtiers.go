@@ -0,0 +1,103 @@
+package queue
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// ParseRatingTiers はカンマ区切りのレーティング帯の境界を解析します。境界は昇順で、レーティングの範囲内でなければなりません。
+func ParseRatingTiers(v string) ([]int, error) {
+	var tiers []int
+	for _, item := range model.SplitCommaList(v) {
+		b, err := strconv.Atoi(item)
+		if err != nil || b <= model.MinRating || b > model.MaxRating {
+			return nil, fmt.Errorf("レーティング帯の境界が不正です（%d より大きく %d 以下）: %q", model.MinRating, model.MaxRating, item)
+		}
+		if len(tiers) > 0 && b <= tiers[len(tiers)-1] {
+			return nil, fmt.Errorf("レーティング帯の境界は昇順に指定してください: %q", item)
+		}
+		tiers = append(tiers, b)
+	}
+	return tiers, nil
+}
+
+// ratingTier はレーティングが属する帯の番号（0 始まり）を返します。
+func ratingTier(rating int, tiers []int) int {
+	return sort.SearchInts(tiers, rating+1)
+}
+
+// canMatchTier は2つのエントリが、レーティング帯の条件の上で同じロビーに入れるかどうかを判定します。
+// 同じ帯であれば常に、隣の帯であればどちらかの待機時間が spillover を超えている場合に入れます。2つ以上離れた帯とは組ませません。
+func canMatchTier(e1, e2 model.QueueEntry, now time.Time, tiers []int, spillover time.Duration) bool {
+	if len(tiers) == 0 {
+		return true
+	}
+	switch ratingTier(e1.Rating, tiers) - ratingTier(e2.Rating, tiers) {
+	case 0:
+		return true
+	case -1, 1:
+		return spillover > 0 && (now.Sub(e1.WaitingSince) >= spillover || now.Sub(e2.WaitingSince) >= spillover)
+	default:
+		return false
+	}
+}
+
+// findTieredLobbies は同じゲームモードのエントリ（探す順に並んだもの）を帯ごとに分けてロビーを組みます。
+// まず帯ごとにその帯のエントリだけで組み、残ったエントリを隣り合う2つの帯ごとに合わせて組み直します（帯をまたげるのは待機時間が
+// policy.TierSpillover を超えたエントリだけ）。1回に見るエントリが帯2つ分に限られるため、待機キュー全体を見るより速く組めます。
+// 最後に、待機時間が policy.StarvationThreshold を超えたエントリが残っていれば、全ての帯の残りから相手を探します。
+func findTieredLobbies(name string, mode GameMode, entries []model.QueueEntry, now time.Time, policy MatchPolicy) []Lobby {
+	if len(policy.RatingTiers) == 0 {
+		lobbies, _ := findModeLobbies(name, mode, entries, now, policy)
+		return lobbies
+	}
+	// 帯をまたいで組み直す際に元の順を保つため、エントリの順番を覚えておく
+	order := make(map[string]int, len(entries))
+	byTier := make([][]model.QueueEntry, len(policy.RatingTiers)+1)
+	for i, e := range entries {
+		order[e.Key()] = i
+		t := ratingTier(e.Rating, policy.RatingTiers)
+		byTier[t] = append(byTier[t], e)
+	}
+
+	var lobbies []Lobby
+	for t := range byTier {
+		found, rest := findModeLobbies(name, mode, byTier[t], now, policy)
+		lobbies = append(lobbies, found...)
+		byTier[t] = rest
+	}
+	for t := 0; t+1 < len(byTier); t++ {
+		if len(byTier[t]) == 0 || len(byTier[t+1]) == 0 {
+			continue
+		}
+		pool := append(append([]model.QueueEntry(nil), byTier[t]...), byTier[t+1]...)
+		sort.SliceStable(pool, func(i, j int) bool { return order[pool[i].Key()] < order[pool[j].Key()] })
+		found, rest := findModeLobbies(name, mode, pool, now, policy)
+		lobbies = append(lobbies, found...)
+		byTier[t], byTier[t+1] = nil, nil
+		for _, e := range rest {
+			tier := ratingTier(e.Rating, policy.RatingTiers)
+			byTier[tier] = append(byTier[tier], e)
+		}
+	}
+
+	// 待機時間が StarvationThreshold を超えたエントリが残っていれば、帯に関わらず残り全体から相手を探す
+	var pool []model.QueueEntry
+	starving := false
+	for _, tier := range byTier {
+		for _, e := range tier {
+			pool = append(pool, e)
+			starving = starving || e.IsStarving(now, policy.StarvationThreshold)
+		}
+	}
+	if starving {
+		sort.SliceStable(pool, func(i, j int) bool { return order[pool[i].Key()] < order[pool[j].Key()] })
+		found, _ := findModeLobbies(name, mode, pool, now, policy)
+		lobbies = append(lobbies, found...)
+	}
+	return lobbies
+}
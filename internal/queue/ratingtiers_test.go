@@ -0,0 +1,77 @@
+package queue
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+func TestParseRatingTiers(t *testing.T) {
+	got, err := ParseRatingTiers("1000, 1200,1400")
+	if err != nil || !slices.Equal(got, []int{1000, 1200, 1400}) {
+		t.Fatalf("tiers = %v, %v, want 1000, 1200 and 1400", got, err)
+	}
+	for _, v := range []string{"1200,1000", "1000,1000", "abc", "0"} {
+		if _, err := ParseRatingTiers(v); err == nil {
+			t.Errorf("ParseRatingTiers(%q) succeeded, want an error", v)
+		}
+	}
+}
+
+// 同じレーティング帯のエントリ同士を先に組み、隣の帯とは待機時間が TierSpillover を超えてから組む。2つ以上離れた帯とは組まない
+func TestFindLobbiesRatingTiers(t *testing.T) {
+	now := testEpoch
+	const spillover = 15 * time.Second
+	for _, tc := range []struct {
+		name      string
+		spillover time.Duration
+		// entries は待機開始順に並べる
+		entries []model.QueueEntry
+		want    []string
+	}{
+		{
+			name:      "same tier first",
+			spillover: spillover,
+			entries:   []model.QueueEntry{ratedEntry(now, "a", 900, 10*time.Second), ratedEntry(now, "b", 1100, 5*time.Second), ratedEntry(now, "c", 1150, time.Second)},
+			want:      []string{"b-c"},
+		},
+		{
+			name:      "adjacent tier before the spillover",
+			spillover: spillover,
+			entries:   []model.QueueEntry{ratedEntry(now, "a", 900, 10*time.Second), ratedEntry(now, "b", 1050, time.Second)},
+			want:      []string{},
+		},
+		{
+			name:      "adjacent tier after the spillover",
+			spillover: spillover,
+			entries:   []model.QueueEntry{ratedEntry(now, "a", 900, spillover), ratedEntry(now, "b", 1050, time.Second)},
+			want:      []string{"a-b"},
+		},
+		{
+			name:      "boundary starts the upper tier",
+			spillover: spillover,
+			entries:   []model.QueueEntry{ratedEntry(now, "a", 999, 3*time.Second), ratedEntry(now, "b", 1000, 2*time.Second), ratedEntry(now, "c", 1199, time.Second)},
+			want:      []string{"b-c"},
+		},
+		{
+			name:      "two tiers apart",
+			spillover: spillover,
+			entries:   []model.QueueEntry{ratedEntry(now, "a", 950, time.Minute), ratedEntry(now, "b", 1250, time.Minute)},
+			want:      []string{},
+		},
+		{
+			name:    "spillover disabled",
+			entries: []model.QueueEntry{ratedEntry(now, "a", 900, time.Minute), ratedEntry(now, "b", 1050, time.Minute)},
+			want:    []string{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := MatchPolicy{Modes: DefaultModes(), RatingTiers: []int{1000, 1200}, TierSpillover: tc.spillover}
+			if got := lobbyPairs(FindLobbies(tc.entries, now, policy)); !slices.Equal(got, tc.want) {
+				t.Fatalf("lobbies = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package queue
+
+import (
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// canMatchRegion は2つのエントリが地域の条件上マッチング可能かどうかを判定します。
+// 地域を指定していないエントリ（global）はどの地域のエントリともマッチングできます。
+// fallback が正の場合、いずれかのエントリの待機時間が fallback 以上であれば地域をまたいでマッチングできます。
+func canMatchRegion(e1, e2 model.QueueEntry, now time.Time, fallback time.Duration) bool {
+	if e1.Region == e2.Region || e1.Region == "" || e2.Region == "" {
+		return true
+	}
+	if fallback <= 0 {
+		return false
+	}
+	return now.Sub(e1.WaitingSince) >= fallback || now.Sub(e2.WaitingSince) >= fallback
+}
@@ -0,0 +1,26 @@
+package queue
+
+import (
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// avoidsRematch は2つのエントリが直前の対戦相手同士のため組み合わせを避けるべきかどうかを判定します。
+// 両方のエントリの待機時間が fallback 以上であれば再戦を許可します（片方が再び待機し始めたばかりの場合は、他の相手が来るのを待つ）。
+func avoidsRematch(e1, e2 model.QueueEntry, now time.Time, recent model.OpponentSet, fallback time.Duration) bool {
+	if len(recent) == 0 {
+		return false
+	}
+	if fallback > 0 && now.Sub(e1.WaitingSince) >= fallback && now.Sub(e2.WaitingSince) >= fallback {
+		return false
+	}
+	for _, p1 := range e1.Players {
+		for _, p2 := range e2.Players {
+			if recent.Has(p1.ID, p2.ID) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package queue
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+// SessionModeClosed はゲームモードの受付時間が終わり待機キューから削除したことを、待機中のリクエストへ通知する際の SessionResult.Status です。
+// セッションの状態としては保存しません。
+const SessionModeClosed = "mode_closed"
+
+// ModeScheduleCheckInterval はゲームモードの受付時間の終了を確認する間隔です。
+const ModeScheduleCheckInterval = time.Second
+
+// ModeCloseSweepWindow は受付時間の終了後、待機キューに残ったエントリを削除し続ける時間です。
+// 終了の直前に受け付けた登録が、最初の削除の後に待機キューへ入る場合に備えます。
+const ModeCloseSweepWindow = 10 * time.Second
+
+// modeSchedule はゲームモードの受付時間です。Windows のいずれかに含まれる時刻だけ待機キューへの登録を受け付けます。
+// 曜日と時刻は Location（設定の time_zone）で評価するため、夏時間の切り替えもそのタイムゾーンの規則に従います。
+type modeSchedule struct {
+	Location *time.Location
+	Windows  []scheduleWindow
+}
+
+// scheduleWindow は受付時間の1つの枠です。End が Start 以前の場合は翌日の End までです（End と Start が同じ場合は24時間）。
+type scheduleWindow struct {
+	// Days は枠が始まる曜日です。空の場合は毎日です。
+	Days []time.Weekday
+	// Start, End は 0 時からの分数です。
+	Start, End int
+}
+
+// modeScheduleConfig は GAME_MODES_FILE の schedule の設定です。
+type modeScheduleConfig struct {
+	TimeZone string                 `json:"time_zone"`
+	Windows  []scheduleWindowConfig `json:"windows"`
+}
+
+// scheduleWindowConfig は schedule の1つの枠の設定です（{"days": ["sat", "sun"], "start": "18:00", "end": "23:00"}）。
+type scheduleWindowConfig struct {
+	Days  []string `json:"days"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// scheduleWeekdays は days に指定できる曜日の名前です。
+var scheduleWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseModeSchedule は schedule の設定を検証して modeSchedule に変換します。タイムゾーンの省略は受け付けません。
+func parseModeSchedule(c modeScheduleConfig) (*modeSchedule, error) {
+	if c.TimeZone == "" {
+		return nil, fmt.Errorf("schedule.time_zone is required (e.g. \"Asia/Tokyo\" or \"UTC\")")
+	}
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("schedule.time_zone %q: %v", c.TimeZone, err)
+	}
+	if len(c.Windows) == 0 {
+		return nil, fmt.Errorf("schedule.windows must not be empty")
+	}
+	sc := &modeSchedule{Location: loc}
+	for i, wc := range c.Windows {
+		var w scheduleWindow
+		for _, d := range wc.Days {
+			day, ok := scheduleWeekdays[strings.ToLower(d)]
+			if !ok {
+				return nil, fmt.Errorf("schedule.windows[%d].days: unknown day %q (use sun, mon, tue, wed, thu, fri, sat)", i, d)
+			}
+			w.Days = append(w.Days, day)
+		}
+		if w.Start, err = parseClock(wc.Start); err != nil {
+			return nil, fmt.Errorf("schedule.windows[%d].start: %v", i, err)
+		}
+		if w.End, err = parseClock(wc.End); err != nil {
+			return nil, fmt.Errorf("schedule.windows[%d].end: %v", i, err)
+		}
+		sc.Windows = append(sc.Windows, w)
+	}
+	return sc, nil
+}
+
+// parseClock は "HH:MM" 形式の時刻を 0 時からの分数に変換します。
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("time must be HH:MM between 00:00 and 23:59: %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// scheduleOccurrence は受付時間の枠が実際に開いている期間 [Start, End) です。
+type scheduleOccurrence struct {
+	Start, End time.Time
+}
+
+// occurrences は t の前日から8日後までに始まる枠を開始時刻の順に返します。
+func (sc *modeSchedule) occurrences(t time.Time) []scheduleOccurrence {
+	local := t.In(sc.Location)
+	var occs []scheduleOccurrence
+	for offset := -1; offset <= 8; offset++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, sc.Location)
+		for _, w := range sc.Windows {
+			if !w.onDay(day.Weekday()) {
+				continue
+			}
+			start := time.Date(day.Year(), day.Month(), day.Day(), 0, w.Start, 0, 0, sc.Location)
+			end := time.Date(day.Year(), day.Month(), day.Day(), 0, w.End, 0, 0, sc.Location)
+			if w.End <= w.Start {
+				end = time.Date(day.Year(), day.Month(), day.Day()+1, 0, w.End, 0, 0, sc.Location)
+			}
+			occs = append(occs, scheduleOccurrence{Start: start, End: end})
+		}
+	}
+	sort.Slice(occs, func(i, j int) bool { return occs[i].Start.Before(occs[j].Start) })
+	return occs
+}
+
+// onDay は枠が曜日 d に始まるかどうかを返します。
+func (w scheduleWindow) onDay(d time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, day := range w.Days {
+		if day == d {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOpen は t の時点で受付時間内かどうかを返します。sc が nil（受付時間の設定なし）の場合は常に true です。
+// 外部の状態に依存しない純粋な関数です。
+func (sc *modeSchedule) IsOpen(t time.Time) bool {
+	if sc == nil {
+		return true
+	}
+	for _, o := range sc.occurrences(t) {
+		if !t.Before(o.Start) && t.Before(o.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextOpen は t より後で最初に受付を始める時刻を返します。1週間以内に開く枠がない場合は false を返します。
+func (sc *modeSchedule) NextOpen(t time.Time) (time.Time, bool) {
+	if sc == nil {
+		return time.Time{}, false
+	}
+	for _, o := range sc.occurrences(t) {
+		if o.Start.After(t) && !sc.IsOpen(o.Start.Add(-time.Nanosecond)) {
+			return o.Start, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ClosesAt は t の時点で受付時間内の場合に、受付を終える時刻を返します（連続する枠はつなげます）。
+// 受付時間外の場合、または1週間以上閉じない場合は false を返します。
+func (sc *modeSchedule) ClosesAt(t time.Time) (time.Time, bool) {
+	if sc == nil || !sc.IsOpen(t) {
+		return time.Time{}, false
+	}
+	occs := sc.occurrences(t)
+	end := t
+	for extended := true; extended; {
+		extended = false
+		for _, o := range occs {
+			if !end.Before(o.Start) && end.Before(o.End) {
+				end, extended = o.End, true
+			}
+		}
+	}
+	if end.After(occs[len(occs)-1].Start) {
+		return time.Time{}, false
+	}
+	return end, true
+}
+
+// ModeClosedError は受付時間外のゲームモードへの登録を拒否する場合のエラーです。
+type ModeClosedError struct {
+	Name string
+	// NextOpen は次に受付を始める時刻です。ゼロ値の場合は1週間以内に開きません。
+	NextOpen time.Time
+}
+
+func (e *ModeClosedError) Error() string {
+	return fmt.Sprintf("game mode %q is closed", e.Name)
+}
+
+// CheckModeOpen は now の時点でゲームモードが受付時間外であれば *ModeClosedError を返します。
+func CheckModeOpen(name string, mode GameMode, now time.Time) error {
+	if mode.Schedule.IsOpen(now) {
+		return nil
+	}
+	next, _ := mode.Schedule.NextOpen(now)
+	return &ModeClosedError{Name: name, NextOpen: next}
+}
+
+// GameModeStatus は GET /modes で返すゲームモードの構成と受付状況です。
+type GameModeStatus struct {
+	Name      string `json:"name"`
+	LobbySize int    `json:"lobby_size"`
+	Teams     int    `json:"teams"`
+	// RatingWindow は同じロビーに入れるレーティングの差の上限です。0 の場合は制限しません。
+	RatingWindow int `json:"rating_window"`
+	// TimeoutSeconds はリクエストで timeout_seconds を指定しなかった場合に結果を待つ時間（秒）です。
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// Open は現在受付時間内かどうかです。受付時間の設定がないモードは常に true です。
+	Open bool `json:"open"`
+	// Scheduled は受付時間の設定があるかどうかです。
+	Scheduled bool `json:"scheduled"`
+	// TimeZone は受付時間を評価するタイムゾーンです。
+	TimeZone string `json:"time_zone,omitempty"`
+	// NextOpenAt は受付時間外の場合に、次に受付を始める時刻です。
+	NextOpenAt *time.Time `json:"next_open_at,omitempty"`
+	// ClosesAt は受付時間内の場合に、受付を終える時刻です。
+	ClosesAt *time.Time `json:"closes_at,omitempty"`
+}
+
+// ModesResponse は GET /modes のレスポンスボディです。
+type ModesResponse struct {
+	Modes []GameModeStatus `json:"modes"`
+}
@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+// scheduledModes は duel と、schedule を設定した event のゲームモードを読み込みます。
+func scheduledModes(t *testing.T, schedule string) Modes {
+	t.Helper()
+	modes, err := LoadGameModes(writeGameModes(t, `{
+		"duel":  {"lobby_size": 2, "teams": 2},
+		"event": {"lobby_size": 2, "teams": 2, "schedule": `+schedule+`}
+	}`), time.Second, 120*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return modes
+}
+
+// 受付時間の判定は設定したタイムゾーンの曜日と時刻で行い、日付をまたぐ枠は翌日まで続く
+func TestModeScheduleFixedTimes(t *testing.T) {
+	// 2030-01-04 は金曜日
+	schedule := scheduledModes(t, `{"time_zone": "Asia/Tokyo", "windows": [
+		{"days": ["sat", "sun"], "start": "18:00", "end": "23:00"},
+		{"days": ["fri"], "start": "22:00", "end": "02:00"}
+	]}`)["event"].Schedule
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour, minute int) time.Time { return time.Date(2030, 1, day, hour, minute, 0, 0, tokyo) }
+	for _, tc := range []struct {
+		name     string
+		now      time.Time
+		open     bool
+		next     time.Time
+		closesAt time.Time
+	}{
+		{"tuesday noon", at(1, 12, 0), false, at(4, 22, 0), time.Time{}},
+		{"friday night", at(4, 22, 0), true, time.Time{}, at(5, 2, 0)},
+		{"past midnight", at(5, 1, 59), true, time.Time{}, at(5, 2, 0)},
+		{"end of the overnight window", at(5, 2, 0), false, at(5, 18, 0), time.Time{}},
+		{"saturday before opening", at(5, 17, 59), false, at(5, 18, 0), time.Time{}},
+		{"saturday evening", at(5, 18, 30), true, time.Time{}, at(5, 23, 0)},
+		{"sunday after closing", at(6, 23, 0), false, at(11, 22, 0), time.Time{}},
+	} {
+		if open := schedule.IsOpen(tc.now); open != tc.open {
+			t.Errorf("%s: open = %v, want %v", tc.name, open, tc.open)
+		}
+		if next, ok := schedule.NextOpen(tc.now); !tc.open && (!ok || !next.Equal(tc.next)) {
+			t.Errorf("%s: next open = %v (%v), want %v", tc.name, next, ok, tc.next)
+		}
+		if closes, ok := schedule.ClosesAt(tc.now); ok != tc.open || !closes.Equal(tc.closesAt) {
+			t.Errorf("%s: closes at = %v (%v), want %v", tc.name, closes, ok, tc.closesAt)
+		}
+	}
+
+	// 同じ時刻でもタイムゾーンが違えば判定が変わる
+	utc := scheduledModes(t, `{"time_zone": "UTC", "windows": [{"start": "18:00", "end": "23:00"}]}`)["event"].Schedule
+	if now := at(5, 18, 30); utc.IsOpen(now) {
+		t.Errorf("UTC schedule open at %v", now.UTC())
+	}
+	// 受付時間の設定がないモードは常に受け付ける
+	if !DefaultModes()["duel"].Schedule.IsOpen(at(1, 3, 0)) {
+		t.Error("mode without a schedule is closed")
+	}
+
+	for _, tc := range []struct{ name, schedule string }{
+		{"no time zone", `{"windows": [{"start": "18:00", "end": "23:00"}]}`},
+		{"unknown time zone", `{"time_zone": "Mars/Olympus", "windows": [{"start": "18:00", "end": "23:00"}]}`},
+		{"no windows", `{"time_zone": "UTC", "windows": []}`},
+		{"unknown day", `{"time_zone": "UTC", "windows": [{"days": ["someday"], "start": "18:00", "end": "23:00"}]}`},
+		{"bad time", `{"time_zone": "UTC", "windows": [{"start": "25:00", "end": "23:00"}]}`},
+	} {
+		if _, err := LoadGameModes(writeGameModes(t, `{"duel": {"lobby_size": 2, "teams": 2}, "event": {"lobby_size": 2, "teams": 2, "schedule": `+tc.schedule+`}}`), time.Second, 120*time.Second); err == nil {
+			t.Errorf("%s: loaded without an error", tc.name)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package queue
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// 同じプレイヤーが候補に2回現れても、そのプレイヤー同士は組み合わせない
+func TestFindLobbiesNeverPairsSamePlayer(t *testing.T) {
+	now := testEpoch
+	duplicate := []model.QueueEntry{waitingEntry(now, "alice", "asia", time.Minute), waitingEntry(now, "alice", "asia", 0)}
+	if lobbies := FindLobbies(duplicate, now, MatchPolicy{Modes: DefaultModes()}); len(lobbies) != 0 {
+		t.Fatalf("lobbies = %v, want none for alice against alice", lobbyPairs(lobbies))
+	}
+	withBob := append(duplicate, waitingEntry(now, "bob", "asia", 0))
+	if got := lobbyPairs(FindLobbies(withBob, now, MatchPolicy{Modes: DefaultModes()})); !slices.Equal(got, []string{"alice-bob"}) {
+		t.Fatalf("lobbies = %v, want alice-bob", got)
+	}
+}
@@ -0,0 +1,44 @@
+package queue
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// 待機時間が StarvationThreshold を超えたエントリは、レーティングの差の上限とレーティング帯に関わらず、
+// 組める相手のうち最もレーティングの近い相手と組む。しきい値が 0 の場合は緩めない
+func TestFindLobbiesStarvation(t *testing.T) {
+	now := testEpoch
+	const threshold = time.Minute
+	// outlier（1000）は最も長く待っており、2000 の far が 1300 の near より先に待機を始めている
+	starving := []model.QueueEntry{ratedEntry(now, "outlier", 1000, threshold), ratedEntry(now, "far", 2000, 20*time.Second), ratedEntry(now, "near", 1300, 10*time.Second)}
+	fresh := []model.QueueEntry{ratedEntry(now, "outlier", 1000, threshold-time.Second), ratedEntry(now, "far", 2000, 20*time.Second), ratedEntry(now, "near", 1300, 10*time.Second)}
+	for _, tc := range []struct {
+		name      string
+		strategy  string
+		tiers     []int
+		threshold time.Duration
+		entries   []model.QueueEntry
+		want      []string
+	}{
+		{"before the threshold", MatchStrategyRatingWindow, nil, threshold, fresh, []string{}},
+		{"closest opponent", MatchStrategyRatingWindow, nil, threshold, starving, []string{"outlier-near"}},
+		{"best pairing", "greedy_gap", nil, threshold, starving, []string{"outlier-near"}},
+		{"across rating tiers", MatchStrategyRatingWindow, []int{1200, 1600}, threshold, starving, []string{"outlier-near"}},
+		{"disabled", MatchStrategyRatingWindow, nil, 0, starving, []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := NewMatcher(tc.strategy, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			policy := MatchPolicy{Modes: strategyModes(100), RatingTiers: tc.tiers, StarvationThreshold: tc.threshold}
+			if got := lobbyPairs(m.Match(tc.entries, now, policy)); !slices.Equal(got, tc.want) {
+				t.Fatalf("lobbies = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
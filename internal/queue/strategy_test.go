@@ -0,0 +1,139 @@
+package queue
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// strategyModes は duel のレーティングの差の上限を window にしたゲームモードです。
+func strategyModes(window int) Modes {
+	modes := DefaultModes()
+	duel := modes["duel"]
+	duel.RatingWindow = window
+	modes["duel"] = duel
+	return modes
+}
+
+func TestMatchStrategies(t *testing.T) {
+	now := testEpoch
+	// spread は待機の長い順に 1000, 1800, 1010、near は 1500, 1600, 1590, 1490 のプレイヤーです
+	spread := []model.QueueEntry{ratedEntry(now, "a", 1000, 30*time.Second), ratedEntry(now, "b", 1800, 20*time.Second), ratedEntry(now, "c", 1010, 10*time.Second)}
+	near := []model.QueueEntry{ratedEntry(now, "a", 1500, 30*time.Second), ratedEntry(now, "b", 1600, 20*time.Second), ratedEntry(now, "c", 1590, 10*time.Second), ratedEntry(now, "d", 1490, 5*time.Second)}
+	for _, tc := range []struct {
+		strategy, options string
+		entries           []model.QueueEntry
+		want              []string
+	}{
+		// fifo はレーティングに関わらず待機開始順に組む
+		{"fifo", "", spread, []string{"a-b"}},
+		{"fifo", "", near, []string{"a-b", "c-d"}},
+		// rating_window は先頭から、レーティングの差が上限以内の相手と組む
+		{"rating_window", "", spread, []string{"a-c"}},
+		{"rating_window", "", near, []string{"a-b", "c-d"}},
+		{"rating_window", "window=1000", spread, []string{"a-b"}},
+		// greedy_gap はレーティングの差の合計が小さくなる組を選ぶ
+		{"greedy_gap", "", spread, []string{"a-c"}},
+		{"greedy_gap", "", near, []string{"a-d", "b-c"}},
+	} {
+		t.Run(tc.strategy+" "+tc.options, func(t *testing.T) {
+			m, err := NewMatcher(tc.strategy, tc.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := lobbyPairs(m.Match(tc.entries, now, MatchPolicy{Modes: strategyModes(150)})); !slices.Equal(got, tc.want) {
+				t.Fatalf("lobbies = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// greedy_gap は待機キュー全体でコストの小さい組から選び、奇数の場合は最も組みにくいプレイヤーを残す。重みで待機時間を優先できる
+func TestGreedyGapPairing(t *testing.T) {
+	now := testEpoch
+	// 隣同士で組むと 1000-1300 と 1310-1600 になる待機キュー
+	adjacent := []model.QueueEntry{ratedEntry(now, "a", 1000, 40*time.Second), ratedEntry(now, "b", 1300, 30*time.Second), ratedEntry(now, "c", 1310, 20*time.Second), ratedEntry(now, "d", 1600, 10*time.Second)}
+	odd := []model.QueueEntry{ratedEntry(now, "a", 1900, 40*time.Second), ratedEntry(now, "b", 1500, 30*time.Second), ratedEntry(now, "c", 1510, 20*time.Second)}
+	for _, tc := range []struct {
+		name, options string
+		entries       []model.QueueEntry
+		window        int
+		want          []string
+	}{
+		{"closest pair first", "", adjacent, 1000, []string{"a-d", "b-c"}},
+		{"outer pair beyond the window", "", adjacent, 300, []string{"b-c"}},
+		{"odd count leaves the outlier", "", odd, 1000, []string{"b-c"}},
+		{"wait time only", "rating_weight=0,wait_weight=1", adjacent, 1000, []string{"a-b", "c-d"}},
+		{"wait time only with an odd count", "rating_weight=0,wait_weight=1", odd, 1000, []string{"a-b"}},
+	} {
+		m, err := NewMatcher("greedy_gap", tc.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := lobbyPairs(m.Match(tc.entries, now, MatchPolicy{Modes: strategyModes(tc.window)})); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: lobbies = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// 未知のアルゴリズム、未知のオプション、不正な値は起動時にエラーにする
+func TestNewMatcherRejectsInvalidConfig(t *testing.T) {
+	for _, tc := range []struct{ strategy, options string }{
+		{"closest", ""},
+		{"", ""},
+		{"fifo", "window=100"},
+		{"rating_window", "window=0"},
+		{"rating_window", "window"},
+		{"greedy_gap", "wait_weight=-1"},
+		{"greedy_gap", "max_gap=wide"},
+		{"greedy_gap", "rating_weight=0,wait_weight=0"},
+	} {
+		if _, err := NewMatcher(tc.strategy, tc.options); err == nil {
+			t.Errorf("NewMatcher(%q, %q) succeeded, want an error", tc.strategy, tc.options)
+		}
+	}
+}
+
+// BenchmarkMatchStrategies は 1,000 人の待機キューで各アルゴリズムの1回のマッチングにかかる時間を比べます。
+func BenchmarkMatchStrategies(b *testing.B) {
+	now := testEpoch
+	rng := rand.New(rand.NewSource(1))
+	entries := make([]model.QueueEntry, 1000)
+	for i := range entries {
+		entries[i] = ratedEntry(now, fmt.Sprintf("p%04d", i), 1000+rng.Intn(1000), time.Duration(len(entries)-i)*100*time.Millisecond)
+	}
+	policy := MatchPolicy{Modes: strategyModes(200)}
+	for _, strategy := range []string{"fifo", MatchStrategyRatingWindow, "greedy_gap"} {
+		m, err := NewMatcher(strategy, "")
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(strategy, func(b *testing.B) {
+			for range b.N {
+				m.Match(entries, now, policy)
+			}
+		})
+	}
+}
+
+// BenchmarkGreedyGap5k は 5,000 人の待機キューでの greedy_gap の1回のマッチングにかかる時間を測ります。
+func BenchmarkGreedyGap5k(b *testing.B) {
+	now := testEpoch
+	rng := rand.New(rand.NewSource(1))
+	entries := make([]model.QueueEntry, 5000)
+	for i := range entries {
+		entries[i] = ratedEntry(now, fmt.Sprintf("p%04d", i), 1000+rng.Intn(1000), time.Duration(len(entries)-i)*20*time.Millisecond)
+	}
+	m, err := NewMatcher("greedy_gap", "wait_weight=0.5")
+	if err != nil {
+		b.Fatal(err)
+	}
+	policy := MatchPolicy{Modes: strategyModes(200)}
+	for b.Loop() {
+		m.Match(entries, now, policy)
+	}
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Config はレート制限の設定です。RPS が 0 以下の場合は制限しません。
+type Config struct {
+	RPS   float64
+	Burst int
+}
+
+// tokenBucket はキーごとのトークンバケットです。
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter はキーごとのトークンバケットでリクエストを制限します。状態はメモリ上にのみ保持します。
+// しばらく使われていない（バケットが満杯に戻った）キーは定期的に削除し、マップが際限なく大きくならないようにします。
+type RateLimiter struct {
+	rate  float64
+	burst float64
+	// now は現在時刻を返します。テストでは時刻を進める関数に置き換えられます。
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// New は設定から RateLimiter を生成します。制限しない設定の場合は nil を返します。
+func New(cfg Config, now func() time.Time) *RateLimiter {
+	if cfg.RPS <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		rate:      cfg.RPS,
+		burst:     float64(max(cfg.Burst, 1)),
+		now:       now,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: now(),
+	}
+}
+
+// idleTTL は空のバケットが満杯に戻るまでの時間です。これ以上使われていないキーは削除しても結果が変わりません。
+func (l *RateLimiter) idleTTL() time.Duration {
+	return time.Duration(l.burst / l.rate * float64(time.Second))
+}
+
+// Allow はキーのリクエストを許可するかどうかを返します。許可しない場合は次に許可されるまでの時間も返します。
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	ok, _, retry := AllowAll(Key{Limiter: l, Key: key})
+	return ok, retry
+}
+
+// Key は制限に使う RateLimiter とキーの組です。
+type Key struct {
+	Limiter *RateLimiter
+	Key     string
+}
+
+// AllowAll は全てのキーにトークンが残っている場合にだけ、それぞれのトークンを1つずつ消費してリクエストを許可します。
+// 1つでも足りなければどのトークンも消費せず、最初に制限したキーの位置と次に許可されるまでの時間を返します。
+// Limiter が nil のキーは制限しません。RateLimiter のロックは引数の順に取るため、呼び出し側で順序を揃えます。
+func AllowAll(keys ...Key) (bool, int, time.Duration) {
+	var locked []*RateLimiter
+	defer func() {
+		for _, l := range locked {
+			l.mu.Unlock()
+		}
+	}()
+	buckets := make([]*tokenBucket, len(keys))
+	for i, k := range keys {
+		l := k.Limiter
+		if l == nil {
+			continue
+		}
+		if !slices.Contains(locked, l) {
+			l.mu.Lock()
+			locked = append(locked, l)
+		}
+		b := l.refill(k.Key)
+		if b.tokens < 1 {
+			return false, i, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		}
+		buckets[i] = b
+	}
+	for _, b := range buckets {
+		if b != nil {
+			b.tokens--
+		}
+	}
+	return true, 0, 0
+}
+
+// refill はキーのバケットを現在時刻まで補充して返します。mu を保持して呼び出します。
+func (l *RateLimiter) refill(key string) *tokenBucket {
+	now := l.now()
+	if now.Sub(l.lastSweep) >= l.idleTTL() {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	return b
+}
+
+// sweep は満杯に戻ったバケットを削除します。mu を保持して呼び出します。
+func (l *RateLimiter) sweep(now time.Time) {
+	ttl := l.idleTTL()
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= ttl {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// testClock はテストから進められる時計です。
+type testClock struct {
+	now time.Time
+}
+
+// Now は現在の時刻を返します。
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+// Advance は時計を d だけ進めます。
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// 制限はテストの時計を進めて確認し、実際には待たない
+func TestRateLimiterRefillsWithClock(t *testing.T) {
+	clock := &testClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := New(Config{RPS: 2, Burst: 3}, clock.Now)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("alice"); !ok {
+			t.Fatalf("request %d within the burst was rejected", i)
+		}
+	}
+	ok, retry := l.Allow("alice")
+	if ok || retry != 500*time.Millisecond {
+		t.Fatalf("request beyond the burst = %v, retry %v, want rejected with 500ms", ok, retry)
+	}
+	// キーごとに独立して数える
+	if ok, _ := l.Allow("bob"); !ok {
+		t.Fatal("bob was limited by alice's requests")
+	}
+
+	clock.Advance(250 * time.Millisecond)
+	if ok, retry := l.Allow("alice"); ok || retry != 250*time.Millisecond {
+		t.Fatalf("after 250ms = %v, retry %v, want rejected with 250ms", ok, retry)
+	}
+	clock.Advance(250 * time.Millisecond)
+	if ok, _ := l.Allow("alice"); !ok {
+		t.Fatal("request after the refill was rejected")
+	}
+
+	// しばらく使われなかったキーは満杯（burst）まで戻り、それ以上は貯まらない
+	clock.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("alice"); !ok {
+			t.Fatalf("request %d after idling was rejected", i)
+		}
+	}
+	if ok, _ := l.Allow("alice"); ok {
+		t.Fatal("tokens accumulated beyond the burst while idle")
+	}
+}
+
+func TestRateLimiterAllowAll(t *testing.T) {
+	clock := &testClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	byIP := New(Config{RPS: 1, Burst: 2}, clock.Now)
+	byPlayer := New(Config{RPS: 1, Burst: 1}, clock.Now)
+	keys := func(player string) []Key {
+		return []Key{{Limiter: byIP, Key: "10.0.0.1"}, {Limiter: byPlayer, Key: player}}
+	}
+
+	if ok, _, _ := AllowAll(keys("alice")...); !ok {
+		t.Fatal("first request was rejected")
+	}
+	// プレイヤーの制限で拒否した場合は、IP アドレスのトークンを消費しない
+	if ok, i, _ := AllowAll(keys("alice")...); ok || i != 1 {
+		t.Fatalf("second request from alice = %v at key %d, want rejected by the player limit", ok, i)
+	}
+	if ok, _, _ := AllowAll(keys("bob")...); !ok {
+		t.Fatal("bob's request was rejected; the IP token was consumed by a rejected request")
+	}
+	if ok, i, retry := AllowAll(keys("carol")...); ok || i != 0 || retry != time.Second {
+		t.Fatalf("carol's request = %v at key %d, retry %v, want rejected by the IP limit with 1s", ok, i, retry)
+	}
+
+	// 制限しない設定では nil を返し、nil のキーは常に許可する
+	if l := New(Config{}, clock.Now); l != nil {
+		t.Fatal("limiter created for an unlimited config")
+	}
+	if ok, _, _ := AllowAll(Key{Key: "alice"}); !ok {
+		t.Fatal("key without a limiter was rejected")
+	}
+}
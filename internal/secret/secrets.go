@@ -0,0 +1,120 @@
+package secret
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMalformedToken はトークンの形式が不正な場合のエラーです。
+	ErrMalformedToken = errors.New("malformed token")
+	// ErrInvalidSignature は署名がどの鍵とも一致しない場合のエラーです。
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrTokenExpired はトークンの有効期限が切れている場合のエラーです。
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// SecretEqual は2つの秘密情報が等しいかを、内容によらず一定の時間で比較します。
+func SecretEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// LookupSecret は given と一致する秘密情報を secrets から探し、対応する値を返します。
+// 一致するかどうかで処理時間が変わらないよう、見つかった後も全件を比較します。
+func LookupSecret[V any](secrets map[string]V, given string) (V, bool) {
+	var found V
+	ok := false
+	for secret, v := range secrets {
+		if SecretEqual(secret, given) {
+			found, ok = v, true
+		}
+	}
+	return found, ok
+}
+
+// KeyRing は HMAC 署名用の鍵の一覧です。先頭（最新）の鍵で署名し、すべての鍵で検証します。
+// 鍵を入れ替える場合は新しい鍵を先頭に追加し、古い鍵で署名されたものが失効してから削除します。
+type KeyRing struct {
+	keys [][]byte
+}
+
+// NewKeyRing は新しい順に並べた鍵から KeyRing を生成します。
+func NewKeyRing(keys ...string) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("key ring requires at least one key")
+	}
+	kr := &KeyRing{}
+	for _, k := range keys {
+		if k == "" {
+			return nil, errors.New("key ring key must not be empty")
+		}
+		kr.keys = append(kr.keys, []byte(k))
+	}
+	return kr, nil
+}
+
+// mac は鍵で msg の HMAC-SHA256 を計算します。
+func mac(key, msg []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// Sign は最新の鍵で msg に署名し、base64url でエンコードした署名を返します（Webhook の署名ヘッダーなどに使います）。
+func (kr *KeyRing) Sign(msg []byte) string {
+	return base64.RawURLEncoding.EncodeToString(mac(kr.keys[0], msg))
+}
+
+// Verify は署名がいずれかの鍵による msg の署名と一致するかを検証します。
+func (kr *KeyRing) Verify(msg []byte, signature string) error {
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrMalformedToken
+	}
+	valid := false
+	for _, key := range kr.keys {
+		if hmac.Equal(mac(key, msg), sig) {
+			valid = true
+		}
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// IssueToken は subject と有効期限を含む署名付きトークン（セッション参加・観戦用）を発行します。
+// 形式は "<base64url(subject)>.<有効期限の Unix 秒>.<署名>" です。
+func (kr *KeyRing) IssueToken(subject string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(subject)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + kr.Sign([]byte(payload))
+}
+
+// VerifyToken はトークンの署名と有効期限を検証し、subject を返します。
+func (kr *KeyRing) VerifyToken(token string, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrMalformedToken
+	}
+	subject, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrMalformedToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", ErrMalformedToken
+	}
+	if err := kr.Verify([]byte(parts[0]+"."+parts[1]), parts[2]); err != nil {
+		return "", err
+	}
+	if !now.Before(time.Unix(expires, 0)) {
+		return "", ErrTokenExpired
+	}
+	return string(subject), nil
+}
@@ -0,0 +1,152 @@
+package secret
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEpoch はトークンの発行・検証に使う固定の時刻です。
+var testEpoch = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestKeyRingRotation(t *testing.T) {
+	old, err := NewKeyRing("old-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 新しい鍵を先頭に追加した鍵の一覧
+	rotated, err := NewKeyRing("new-key", "old-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newOnly, err := NewKeyRing("new-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := testEpoch.Add(time.Hour)
+
+	// 入れ替え前に古い鍵で発行したトークンは、入れ替え後も検証できる
+	if subject, err := rotated.VerifyToken(old.IssueToken("alice", expires), testEpoch); err != nil || subject != "alice" {
+		t.Fatalf("old token = %q, %v, want alice", subject, err)
+	}
+	// 入れ替え後は新しい鍵で署名する
+	msg := []byte(`{"event":"match"}`)
+	if got, want := rotated.Sign(msg), newOnly.Sign(msg); got != want {
+		t.Fatalf("signature = %q, want the new key's %q", got, want)
+	}
+	if err := old.Verify(msg, rotated.Sign(msg)); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("old key verifying a new signature = %v, want %v", err, ErrInvalidSignature)
+	}
+	// 古い鍵を削除した後は、古い鍵のトークンを受け付けない
+	if _, err := newOnly.VerifyToken(old.IssueToken("alice", expires), testEpoch); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("old token after removing the old key = %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestKeyRingMalformedTokens(t *testing.T) {
+	kr, err := NewKeyRing("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := kr.IssueToken("alice", testEpoch.Add(time.Minute))
+	parts := strings.Split(valid, ".")
+
+	for _, tc := range []struct {
+		name, token string
+		want        error
+	}{
+		{"empty", "", ErrMalformedToken},
+		{"two parts", parts[0] + "." + parts[1], ErrMalformedToken},
+		{"four parts", valid + ".x", ErrMalformedToken},
+		{"subject not base64", "!!." + parts[1] + "." + parts[2], ErrMalformedToken},
+		{"expiry not a number", parts[0] + ".soon." + parts[2], ErrMalformedToken},
+		{"signature not base64", parts[0] + "." + parts[1] + ".%%", ErrMalformedToken},
+		{"truncated signature", parts[0] + "." + parts[1] + "." + parts[2][:10], ErrInvalidSignature},
+		{"other subject", "Ym9i." + parts[1] + "." + parts[2], ErrInvalidSignature},
+		{"extended expiry", parts[0] + ".9999999999." + parts[2], ErrInvalidSignature},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := kr.VerifyToken(tc.token, testEpoch); !errors.Is(err, tc.want) {
+				t.Fatalf("VerifyToken = %v, want %v", err, tc.want)
+			}
+		})
+	}
+	if _, err := kr.VerifyToken(valid, testEpoch.Add(time.Minute)); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("expired token = %v, want %v", err, ErrTokenExpired)
+	}
+
+	if _, err := NewKeyRing(); err == nil {
+		t.Error("key ring without keys was created")
+	}
+	if _, err := NewKeyRing("new", ""); err == nil {
+		t.Error("key ring with an empty key was created")
+	}
+}
+
+func TestLookupSecret(t *testing.T) {
+	keys := map[string]string{"key-1": "lobby", "key-2": "dashboard"}
+	if service, ok := LookupSecret(keys, "key-2"); !ok || service != "dashboard" {
+		t.Fatalf("lookup key-2 = %q, %v, want dashboard", service, ok)
+	}
+	for _, given := range []string{"", "key", "key-10", "KEY-1"} {
+		if service, ok := LookupSecret(keys, given); ok {
+			t.Errorf("lookup %q = %q, want no match", given, service)
+		}
+	}
+}
+
+// secretComparisonAllowed は secret パッケージ以外で bytes.Equal などを使ってよいファイルと、その理由です。
+var secretComparisonAllowed = map[string]string{
+	// 冪等キーで保存したリクエストボディのハッシュの比較で、秘密情報ではない
+	"internal/api/idempotency.go": "request body hash",
+}
+
+// 秘密情報の比較と署名の検証は secret パッケージにまとめ、他のパッケージで直接比較しない
+func TestNoDirectSecretComparisons(t *testing.T) {
+	patterns := []*regexp.Regexp{
+		regexp.MustCompile(`bytes\.Equal\(|hmac\.|subtle\.`),
+		regexp.MustCompile(`(?i)(secret|signature|apikey|token|mac)\w*(\)|\])?\s*[!=]=\s*[^"\sn0]`),
+		regexp.MustCompile(`(?i)[!=]=\s*[\w.]*(secret|signature|apikey|token)`),
+	}
+	root := filepath.Join("..", "..")
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel == "internal/secret" || rel == "proto" || strings.HasPrefix(d.Name(), ".") && rel != "." {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		if _, ok := secretComparisonAllowed[rel]; ok {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for i, line := range strings.Split(string(data), "\n") {
+			code, _, _ := strings.Cut(line, "//")
+			for _, p := range patterns {
+				if p.MatchString(code) {
+					t.Errorf("%s:%d compares secret material directly; use the secret package: %s", rel, i+1, strings.TrimSpace(line))
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,31 @@
+package store
+
+import (
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// QueuedPlayer は GET /admin/queue で返す待機中のプレイヤーです。
+type QueuedPlayer struct {
+	ID           string    `json:"id"`
+	Rating       int       `json:"rating"`
+	PartyID      string    `json:"party_id,omitempty"`
+	GameMode     string    `json:"game_mode"`
+	Region       string    `json:"region,omitempty"`
+	PingMS       int       `json:"ping_ms,omitempty"`
+	WaitingSince time.Time `json:"waiting_since"`
+	ExpiresAt    time.Time `json:"expires_at,omitzero"`
+	Priority     int       `json:"priority"`
+	GamesPlayed  int       `json:"games_played"`
+	// RatingRange はクライアントが指定した相手のレーティングの範囲です。
+	RatingRange model.RatingRange `json:"rating_range,omitzero"`
+	// MaxWaitSeconds はクライアントが指定した待機時間（timeout_seconds・preferences.max_wait_seconds）です。0 はゲームモードの待機時間です。
+	MaxWaitSeconds int `json:"max_wait_seconds,omitempty"`
+	// Attributes はクライアントが指定したプレイヤーの属性です。
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Requeued は中止されたセッションから待機キューへ戻され、クライアントの再接続を待っていることを表します。
+	Requeued bool `json:"requeued"`
+	// TraceParent は待機キューへ登録したリクエストのスパンの文脈です（QueueEntry.TraceParent）。
+	TraceParent string `json:"-"`
+}
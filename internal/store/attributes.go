@@ -0,0 +1,38 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// encodeAttributes は属性を保存用の JSON に変換します。属性がない場合は空文字です。
+func encodeAttributes(attrs map[string]string) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(attrs)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// nullAttributes は属性を DB の JSON 列に保存する値へ変換します。属性がない場合は NULL です。
+func nullAttributes(attrs map[string]string) sql.NullString {
+	v := encodeAttributes(attrs)
+	return sql.NullString{String: v, Valid: v != ""}
+}
+
+// decodeAttributes は保存された JSON の属性を復元します。空文字は属性なしとして扱います。
+func decodeAttributes(v string) (map[string]string, error) {
+	if strings.TrimSpace(v) == "" {
+		return nil, nil
+	}
+	var attrs map[string]string
+	if err := json.Unmarshal([]byte(v), &attrs); err != nil {
+		return nil, fmt.Errorf("属性の JSON が不正です: %v", err)
+	}
+	return attrs, nil
+}
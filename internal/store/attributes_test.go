@@ -0,0 +1,28 @@
+package store
+
+import (
+	"maps"
+	"testing"
+)
+
+// 属性は JSON 列に保存し、属性がない場合は NULL とする
+func TestAttributesRoundTrip(t *testing.T) {
+	attrs := map[string]string{"crossplay": "off", "language": "ja"}
+	stored := nullAttributes(attrs)
+	if !stored.Valid {
+		t.Fatal("attributes stored as NULL")
+	}
+	got, err := decodeAttributes(stored.String)
+	if err != nil || !maps.Equal(got, attrs) {
+		t.Fatalf("decoded = %v (%v), want %v", got, err, attrs)
+	}
+	if stored := nullAttributes(nil); stored.Valid {
+		t.Fatalf("no attributes stored as %q, want NULL", stored.String)
+	}
+	if got, err := decodeAttributes(""); err != nil || got != nil {
+		t.Fatalf("empty column = %v (%v), want no attributes", got, err)
+	}
+	if _, err := decodeAttributes("{broken"); err == nil {
+		t.Fatal("broken JSON decoded without an error")
+	}
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditEvent はコンプライアンス向けの監査イベントです。audit_events テーブルに追記するだけで、更新・削除しません。
+type AuditEvent struct {
+	// EventID は追記した順に増える ID です（ページングのカーソルに使います）。
+	EventID    int64     `json:"event_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// Actor は操作を行った主体です（service:<API キーのサービス名>、player:<ID>、admin:secret、admin:token:<sub>、matchmaker、system）。
+	Actor           string                 `json:"actor"`
+	Action          string                 `json:"action"`
+	SubjectPlayerID string                 `json:"subject_player_id,omitempty"`
+	SessionID       string                 `json:"session_id,omitempty"`
+	Details         map[string]interface{} `json:"details,omitempty"`
+}
+
+// AuditQuery は監査イベントの検索条件です。
+type AuditQuery struct {
+	// Since 以降、Until より前に起きたイベントを返します。ゼロ値は制限しません。
+	Since, Until time.Time
+	// After はカーソルです。EventID がこれより大きいイベントを返します。
+	After int64
+	Limit int
+}
+
+// AuditLogger は監査イベントを追記します。Store が実装し、テストでは MemoryStore に記録されたイベントを確認できます。
+type AuditLogger interface {
+	// AppendAuditEvents は監査イベントをまとめて追記します。
+	AppendAuditEvents(ctx context.Context, events []AuditEvent) error
+}
+
+// AppendAuditEvents は監査イベントを audit_events テーブルにまとめて追記します。
+func (s *mysqlStore) AppendAuditEvents(ctx context.Context, events []AuditEvent) error {
+	args := make([]interface{}, 0, len(events)*6)
+	values := make([]string, 0, len(events))
+	for _, e := range events {
+		values = append(values, "(?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?)")
+		args = append(args, e.OccurredAt, e.Actor, e.Action, e.SubjectPlayerID, e.SessionID, nullDetails(e.Details))
+	}
+	query := "INSERT INTO audit_events (occurred_at, actor, action, subject_player_id, session_id, details) VALUES " + strings.Join(values, ", ")
+	if _, err := s.exec(ctx, s.DB, "audit.insert", query, args...); err != nil {
+		return fmt.Errorf("監査イベント保存エラー: %v", err)
+	}
+	return nil
+}
+
+// ListAuditEvents は条件に合う監査イベントを event_id の順に最大 q.Limit 件返します。
+func (s *mysqlStore) ListAuditEvents(ctx context.Context, q AuditQuery) ([]AuditEvent, error) {
+	where := []string{"event_id > ?"}
+	args := []interface{}{q.After}
+	if !q.Since.IsZero() {
+		where = append(where, "occurred_at >= ?")
+		args = append(args, q.Since)
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "occurred_at < ?")
+		args = append(args, q.Until)
+	}
+	query := `SELECT event_id, occurred_at, actor, action, COALESCE(subject_player_id, ''), COALESCE(session_id, ''), details
+		FROM audit_events WHERE ` + strings.Join(where, " AND ") + ` ORDER BY event_id LIMIT ?`
+	rows, err := s.query(ctx, s.DB, "audit.list", query, append(args, q.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []AuditEvent
+	for rows.Next() {
+		var e AuditEvent
+		var details sql.NullString
+		if err := rows.Scan(&e.EventID, &e.OccurredAt, &e.Actor, &e.Action, &e.SubjectPlayerID, &e.SessionID, &details); err != nil {
+			return nil, err
+		}
+		if details.Valid {
+			if err := json.Unmarshal([]byte(details.String), &e.Details); err != nil {
+				return nil, fmt.Errorf("監査イベントの詳細の JSON が不正です（event_id %d）: %v", e.EventID, err)
+			}
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// nullDetails は監査イベントの詳細を DB の JSON 列に保存する値へ変換します。詳細がない場合は NULL です。
+func nullDetails(details map[string]interface{}) sql.NullString {
+	if len(details) == 0 {
+		return sql.NullString{}
+	}
+	b, err := json.Marshal(details)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(b), Valid: true}
+}
+
+// AppendAuditEvents は監査イベントを追記します。
+func (s *MemoryStore) AppendAuditEvents(ctx context.Context, events []AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range events {
+		e.EventID = int64(len(s.auditEvents)) + 1
+		s.auditEvents = append(s.auditEvents, e)
+	}
+	return nil
+}
+
+// ListAuditEvents は条件に合う監査イベントを event_id の順に最大 q.Limit 件返します。
+func (s *MemoryStore) ListAuditEvents(ctx context.Context, q AuditQuery) ([]AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []AuditEvent
+	for _, e := range s.auditEvents {
+		if e.EventID <= q.After || (!q.Since.IsZero() && e.OccurredAt.Before(q.Since)) || (!q.Until.IsZero() && !e.OccurredAt.Before(q.Until)) {
+			continue
+		}
+		events = append(events, e)
+		if len(events) == q.Limit {
+			break
+		}
+	}
+	return events, nil
+}
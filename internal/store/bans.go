@@ -0,0 +1,23 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotBanned は指定したプレイヤーの参加禁止が登録されていない場合のエラーです。
+var ErrNotBanned = errors.New("player is not banned")
+
+// PlayerBan はマッチングへの参加を禁止したプレイヤーです。
+type PlayerBan struct {
+	PlayerID string `json:"player_id"`
+	// Until は禁止の期限です。ゼロ値の場合は無期限です。
+	Until     time.Time `json:"until,omitzero"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// activeAt は now の時点で参加禁止が有効かどうかを返します。
+func (b PlayerBan) activeAt(now time.Time) bool {
+	return b.Until.IsZero() || now.Before(b.Until)
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// MySQL では主キー（player_id）で参加禁止を引き、期限を過ぎた禁止は削除しなくても除外する
+func TestMySQLActiveBanQuery(t *testing.T) {
+	f := &fakeDB{query: func(q string, _ []driver.Value) ([]string, [][]driver.Value, error) {
+		return []string{"player_id", "until", "reason", "created_at"}, [][]driver.Value{{"bob", nil, "cheating", appEpoch}}, nil
+	}}
+	s := newFakeMySQLStore(t, f)
+
+	ban, banned, err := s.ActiveBan(context.Background(), []string{"alice", "bob"}, appEpoch)
+	if err != nil || !banned {
+		t.Fatalf("ActiveBan = %v, %v, want banned", banned, err)
+	}
+	if ban.PlayerID != "bob" || !ban.Until.IsZero() || ban.Reason != "cheating" {
+		t.Fatalf("ban = %+v, want bob's permanent ban", ban)
+	}
+	st := f.find(t, "FROM banned_players")
+	if !strings.Contains(st.Query, "WHERE player_id IN (?, ?) AND (until IS NULL OR until > ?)") {
+		t.Errorf("query = %q, want a primary key lookup that skips expired bans", st.Query)
+	}
+	if want := []driver.Value{"alice", "bob", appEpoch}; !slices.Equal(st.Args, want) {
+		t.Errorf("args = %v, want %v", st.Args, want)
+	}
+}
+
+func TestMemoryActiveBanExpiry(t *testing.T) {
+	s := NewMemoryStore(DefaultConfig())
+	ctx := context.Background()
+	for _, ban := range []PlayerBan{
+		{PlayerID: "alice", Until: appEpoch.Add(time.Hour)},
+		{PlayerID: "bob"},
+	} {
+		if _, err := s.BanPlayer(ctx, ban); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		id   string
+		at   time.Time
+		want bool
+	}{
+		{"alice", appEpoch, true},
+		{"alice", appEpoch.Add(time.Hour), false},
+		{"bob", appEpoch.Add(100 * 24 * time.Hour), true},
+		{"carol", appEpoch, false},
+	} {
+		if _, banned, err := s.ActiveBan(ctx, []string{tc.id}, tc.at); err != nil || banned != tc.want {
+			t.Errorf("%s at %v: banned = %v, %v, want %v", tc.id, tc.at, banned, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package store
+
+import (
+	"errors"
+)
+
+var (
+	// ErrNotBlocked は指定した組み合わせのブロックが登録されていない場合のエラーです。
+	ErrNotBlocked = errors.New("player is not blocked")
+	// ErrBlockLimitReached はプレイヤーのブロックの登録数が MaxBlocksPerPlayer に達している場合のエラーです。
+	ErrBlockLimitReached = errors.New("block limit reached")
+)
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"matchmaking_project/internal/model"
+)
+
+// 待機中のプレイヤー同士のブロックは、組み合わせごとではなく1回の IN 句のクエリでまとめて取得する
+func TestMySQLBlockedPairsOneQuery(t *testing.T) {
+	f := &fakeDB{query: func(q string, _ []driver.Value) ([]string, [][]driver.Value, error) {
+		return []string{"player_id", "blocked_id"}, [][]driver.Value{{"bob", "alice"}}, nil
+	}}
+	s := newFakeMySQLStore(t, f)
+	entries := []model.QueueEntry{
+		{Players: []model.Player{{ID: "alice"}}},
+		{Players: []model.Player{{ID: "bob"}, {ID: "carol"}}},
+	}
+	blocked, err := s.getBlockedPairs(context.Background(), s.DB, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !blocked.Has("alice", "bob") || blocked.Has("alice", "carol") {
+		t.Fatalf("blocked = %v, want only alice and bob in either direction", blocked)
+	}
+	if got := len(f.queries()); got != 1 {
+		t.Fatalf("ran %d queries, want 1: %v", got, f.queries())
+	}
+	st := f.find(t, "FROM blocked_pairs")
+	if !strings.Contains(st.Query, "WHERE player_id IN (?, ?, ?) AND blocked_id IN (?, ?, ?)") {
+		t.Errorf("query = %q, want both columns matched against the queued players", st.Query)
+	}
+	if want := []driver.Value{"alice", "bob", "carol", "alice", "bob", "carol"}; !slices.Equal(st.Args, want) {
+		t.Errorf("args = %v, want %v", st.Args, want)
+	}
+}
+
+func TestMemoryBlockLimit(t *testing.T) {
+	s := NewMemoryStore(DefaultConfig())
+	ctx := context.Background()
+	for _, other := range []string{"bob", "carol"} {
+		if created, err := s.BlockPlayer(ctx, "alice", other, 2); err != nil || !created {
+			t.Fatalf("block %s = %v, %v, want created", other, created, err)
+		}
+	}
+	if created, err := s.BlockPlayer(ctx, "alice", "bob", 2); err != nil || created {
+		t.Fatalf("block bob again = %v, %v, want an existing block", created, err)
+	}
+	if _, err := s.BlockPlayer(ctx, "alice", "dave", 2); !errors.Is(err, ErrBlockLimitReached) {
+		t.Fatalf("block over the cap: err = %v, want ErrBlockLimitReached", err)
+	}
+	// 他のプレイヤーのブロックは上限に数えない
+	if _, err := s.BlockPlayer(ctx, "bob", "alice", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UnblockPlayer(ctx, "alice", "dave"); !errors.Is(err, ErrNotBlocked) {
+		t.Fatalf("unblock dave: err = %v, want ErrNotBlocked", err)
+	}
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+)
+
+// entryWaitingSince はエントリの待機開始時刻を返します。joinQueue が設定していない場合（設定する前の呼び出し元）はアプリの時計の現在時刻です。
+// 待機時間の計算をアプリの時計にそろえるため、待機キューへの登録では DB の NOW() の代わりにこれを保存します。
+func (c Config) entryWaitingSince(e model.QueueEntry) time.Time {
+	if e.WaitingSince.IsZero() {
+		return c.now()
+	}
+	return e.WaitingSince
+}
+
+// clockSkew は DB の NOW() からアプリの時刻を引いた差を返します。アプリの時刻はクエリの前後の中間の時刻です。
+// DB のセッションのタイムゾーン（time_zone）が UTC でない場合も、その時差が差として表れます（接続は UTC として時刻を解釈するため）。
+func (s *mysqlStore) clockSkew(ctx context.Context) (time.Duration, error) {
+	before := s.cfg.now()
+	var dbNow time.Time
+	if err := s.queryRow(ctx, s.DB, "clock.now", "SELECT NOW(6)").Scan(&dbNow); err != nil {
+		return 0, err
+	}
+	after := s.cfg.now()
+	return dbNow.Sub(before.Add(after.Sub(before) / 2)), nil
+}
+
+// warnClockSkew は DB の時刻とアプリの時刻の差を確認し、Config.ClockSkewThreshold を超えていれば警告をログに出力します。
+// 時刻の列はすべてアプリの時計で保存しますが、DB の時刻が大きくずれていると手作業の調査で時刻を比べる際に誤解のもとになるため、運用者が気付けるようにします。
+func (s *mysqlStore) warnClockSkew(ctx context.Context) {
+	if s.cfg.ClockSkewThreshold <= 0 {
+		return
+	}
+	skew, err := s.clockSkew(ctx)
+	if err != nil {
+		slog.Warn("DB の時刻の確認エラー", "func", "warnClockSkew", "error", err)
+		return
+	}
+	metrics.DBClockSkew.Set(skew.Seconds())
+	if skew.Abs() > s.cfg.ClockSkewThreshold {
+		slog.Warn("DB の時刻がアプリの時刻とずれています（NTP の同期と MySQL の time_zone を確認してください）", "skew", skew.String(), "threshold", s.cfg.ClockSkewThreshold.String())
+		return
+	}
+	slog.Info("db clock checked", "skew", skew.String())
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// appEpoch は壁時計から大きく離したアプリの時計の時刻です。
+var appEpoch = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newFakeMySQLStore(t *testing.T, f *fakeDB) *mysqlStore {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.Now = func() time.Time { return appEpoch }
+	return &mysqlStore{DB: f.open(t), cfg: cfg}
+}
+
+func TestClockSkewUsesAppClock(t *testing.T) {
+	f := &fakeDB{query: func(string, []driver.Value) ([]string, [][]driver.Value, error) {
+		return []string{"NOW(6)"}, [][]driver.Value{{appEpoch.Add(5 * time.Second)}}, nil
+	}}
+	s := newFakeMySQLStore(t, f)
+
+	skew, err := s.clockSkew(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skew != 5*time.Second {
+		t.Fatalf("skew = %v, want 5s (DB NOW() minus the app clock)", skew)
+	}
+}
+
+func TestStoredTimestampsUseAppClock(t *testing.T) {
+	f := &fakeDB{}
+	s := newFakeMySQLStore(t, f)
+	ctx := context.Background()
+
+	if err := s.SetServiceState(ctx, "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ExpireSessions(ctx, appEpoch.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DecayInactiveRatings(ctx, appEpoch, appEpoch, 1500, 0.1); err != nil {
+		t.Fatal(err)
+	}
+	// fakeDB は行を返さないため、更新後のプロフィールの読み込みは失敗する（ここでは保存する文だけを確認する）
+	s.SetPlayerRating(ctx, "alice", 1600)
+
+	for _, substr := range []string{"INSERT INTO service_state", "ended_at = ?", "rating_decayed_at = ?", "INSERT INTO players"} {
+		st := f.find(t, substr)
+		if !hasTime(st.Args, appEpoch) {
+			t.Errorf("%q args = %v, want the app clock %v", substr, st.Args, appEpoch)
+		}
+	}
+	for _, q := range f.queries() {
+		if strings.Contains(q, "NOW()") {
+			t.Errorf("statement uses the DB clock: %s", q)
+		}
+	}
+}
+
+func TestEntryWaitingSinceDefaultsToAppClock(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Now = func() time.Time { return appEpoch }
+	if got := cfg.entryWaitingSince(model.QueueEntry{}); !got.Equal(appEpoch) {
+		t.Errorf("zero WaitingSince = %v, want %v", got, appEpoch)
+	}
+	set := appEpoch.Add(-time.Minute)
+	if got := cfg.entryWaitingSince(model.QueueEntry{WaitingSince: set}); !got.Equal(set) {
+		t.Errorf("WaitingSince = %v, want %v", got, set)
+	}
+}
+
+func hasTime(args []driver.Value, want time.Time) bool {
+	for _, a := range args {
+		if tm, ok := a.(time.Time); ok && tm.Equal(want) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"time"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// defaultDSN は Config.DSN を指定しない場合の MySQL の接続先です。
+// 例: "user:password@tcp(127.0.0.1:3306)/dbname?parseTime=true&multiStatements=true"
+const defaultDSN = "yusuke:password@tcp(127.0.0.1:3306)/matchmaking?parseTime=true"
+
+// Config は Store の設定です。main で環境変数から組み立て、NewMySQLStore・NewMemoryStore に渡します。
+type Config struct {
+	// DSN は MySQL の接続先です（環境変数 DB_DSN）。
+	DSN string
+
+	// DB の接続プールの設定（環境変数 DB_MAX_OPEN_CONNS / DB_MAX_IDLE_CONNS / DB_CONN_MAX_LIFETIME）
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+
+	// SlowQueryThreshold はこの時間以上かかったクエリをログに出力するしきい値です（環境変数 SLOW_QUERY_THRESHOLD）。
+	// 0 以下の場合は出力しません。
+	SlowQueryThreshold time.Duration
+	// QueryParams は遅いクエリのログにパラメータを出力する方法です（QueryParamsNone など）。
+	QueryParams string
+	// ExplainCaptureBudget は遅いクエリの EXPLAIN を取得する回数の上限です（環境変数 EXPLAIN_CAPTURE_PER_HOUR）。
+	// 遅いクエリが続いた場合に EXPLAIN で DB の負荷をさらに上げないよう、1時間あたりの回数に制限します。
+	ExplainCaptureBudget ratelimit.Config
+	// ExplainCapture は遅いクエリの EXPLAIN を取得するかどうかを返します（機能フラグ explain_capture）。nil の場合は取得しません。
+	ExplainCapture func() bool
+	// ReissueMatchToken はセッションIDを変えた場合にマッチトークンを発行し直します。nil の場合はトークンを取り除きます。
+	ReissueMatchToken func(session *model.SessionResult, now time.Time)
+
+	// MatchBatchSize は1回のマッチングで待機キューから FOR UPDATE で取得するプレイヤー数の上限です（環境変数 MATCH_BATCH_SIZE）。
+	// 待機キューが数万人になっても、マッチングの間に待機キュー全体をロックしないようにするためのものです。
+	// 待機開始の古いプレイヤーから取得し、残りは次回以降のマッチングで扱います。0 以下の場合は待機キュー全体を取得します。
+	MatchBatchSize int
+	// MaxQueueSize は待機キューに登録できるプレイヤー数の上限です（環境変数 MAX_QUEUE_SIZE）。0 以下の場合は制限しません。
+	// アクセスが集中した場合に、待機キューと DB の負荷が際限なく増えないようにするためのものです。
+	MaxQueueSize int
+	// RecentOpponentWindow は直前の対戦相手との再戦を避ける期間です（環境変数 RECENT_OPPONENT_WINDOW）。
+	RecentOpponentWindow time.Duration
+
+	// LeaderElection は --store=mysql で、MySQL のアドバイザリーロック（GET_LOCK）を保持する1インスタンスだけが
+	// マッチングを行うかどうかです（環境変数 MATCHER_LEADER_ELECTION）。false の場合は全インスタンスが
+	// FOR UPDATE SKIP LOCKED で待機キューを分け合ってマッチングします。
+	LeaderElection bool
+	// MatcherLockTTL は --store=redis のマッチングのロックの有効期間です（環境変数 MATCHER_LOCK_TTL）。
+	// ロックを持つインスタンスが停止した場合、この時間が過ぎると別のインスタンスがマッチングを引き継ぎます。
+	// 1回のマッチング処理より十分長く、引き継ぎを待てる程度に短くします。
+	MatcherLockTTL time.Duration
+
+	// ClockSkewThreshold は起動時に確認する DB の NOW() とアプリの時刻の差の許容範囲です（環境変数 DB_CLOCK_SKEW_THRESHOLD）。
+	// 超えた場合は警告をログに出力します。0 の場合は確認しません。
+	ClockSkewThreshold time.Duration
+	// Now はアプリの時計です。時刻を記録する列はすべてこの時計で保存します（DB の NOW() を使うのはマイグレーションの適用時刻だけです）。
+	Now func() time.Time
+
+	// RatingSeeds は新規プレイヤーのレーティングの初期値です。
+	RatingSeeds model.RatingSeeds
+	// Cooldown は辞退・不在のプレイヤーのクールダウンの設定です。
+	Cooldown CooldownPolicy
+}
+
+// DefaultConfig は環境変数を指定しない場合の Config を返します。
+func DefaultConfig() Config {
+	return Config{
+		DSN:                  defaultDSN,
+		MaxOpenConns:         25,
+		MaxIdleConns:         10,
+		ConnMaxLifetime:      5 * time.Minute,
+		SlowQueryThreshold:   200 * time.Millisecond,
+		QueryParams:          QueryParamsRedacted,
+		ExplainCaptureBudget: ratelimit.Config{RPS: 20.0 / 3600, Burst: 20},
+		MatchBatchSize:       5000,
+		RecentOpponentWindow: 10 * time.Minute,
+		MatcherLockTTL:       10 * time.Second,
+		ClockSkewThreshold:   2 * time.Second,
+		Now:                  time.Now,
+		RatingSeeds:          model.DefaultRatingSeeds(),
+		Cooldown:             DefaultCooldownPolicy(),
+	}
+}
+
+// now はアプリの時計の現在時刻を返します。Now を設定していない場合は time.Now です。
+func (c Config) now() time.Time {
+	if c.Now == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+// queueHasRoom は待機キューの人数が current のときに、さらに n 人を登録できるかどうかを返します。
+func (c Config) queueHasRoom(current, n int) bool {
+	return c.MaxQueueSize <= 0 || current+n <= c.MaxQueueSize
+}
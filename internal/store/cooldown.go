@@ -0,0 +1,66 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrCooldownDisabled はクールダウンを設けない設定（CooldownPolicy.Base が 0）のため、違反を記録しなかった場合のエラーです。
+var ErrCooldownDisabled = errors.New("matchmaking cooldown is disabled")
+
+// CooldownPolicy は、マッチング成立後に辞退した、またはゲームに現れなかった（承諾しなかった場合を含む）プレイヤーの
+// マッチングへの参加を止める時間の設定です。
+type CooldownPolicy struct {
+	// Base は最初の違反のクールダウンの時間です（環境変数 MATCH_COOLDOWN）。
+	// 0 の場合はクールダウンを設けません。繰り返すたびに倍にし、Max を上限とします。
+	Base time.Duration
+	// Max はクールダウンの上限です（環境変数 MATCH_COOLDOWN_MAX、Base 以上）。
+	Max time.Duration
+	// Reset は違反の回数を数え直すまでの時間です（環境変数 MATCH_COOLDOWN_RESET）。
+	// 前回の違反からこの時間を過ぎた違反は1回目として扱います。
+	Reset time.Duration
+}
+
+// DefaultCooldownPolicy は環境変数を指定しない場合の CooldownPolicy を返します。
+func DefaultCooldownPolicy() CooldownPolicy {
+	return CooldownPolicy{Base: time.Minute, Max: 30 * time.Minute, Reset: 24 * time.Hour}
+}
+
+// Enabled はクールダウンを設けるかどうかを返します。
+func (p CooldownPolicy) Enabled() bool {
+	return p.Base > 0
+}
+
+// PlayerCooldown はマッチングへの参加を一時的に止めているプレイヤーです（mysqlStore の players.cooldown_until・cooldown_offenses）。
+type PlayerCooldown struct {
+	PlayerID string    `json:"player_id"`
+	Until    time.Time `json:"until"`
+	// Offenses は CooldownPolicy.Reset 以内に続いた違反の回数です。
+	Offenses int `json:"offenses"`
+}
+
+// duration は offenses 回目の違反のクールダウンの時間を返します（Base を倍にしていき、Max を上限とします）。
+func (p CooldownPolicy) duration(offenses int) time.Duration {
+	if p.Base <= 0 || offenses <= 0 {
+		return 0
+	}
+	d := p.Base
+	for i := 1; i < offenses && d < p.Max; i++ {
+		d *= 2
+	}
+	return min(d, p.Max)
+}
+
+// next は前回の違反（lastOffense、ない場合はゼロ値）と現在のクールダウンの期限から、now の違反を記録した後のクールダウンを返します。
+// mysqlStore と MemoryStore で同じ計算をするために使います。
+func (p CooldownPolicy) next(playerID string, offenses int, lastOffense, until, now time.Time) PlayerCooldown {
+	if lastOffense.IsZero() || now.Sub(lastOffense) >= p.Reset {
+		offenses = 0
+	}
+	offenses++
+	next := now.Add(p.duration(offenses))
+	if until.After(next) {
+		next = until
+	}
+	return PlayerCooldown{PlayerID: playerID, Until: next, Offenses: offenses}
+}
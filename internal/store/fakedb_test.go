@@ -0,0 +1,170 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeStatement は fakeDB が受け取った文とパラメータです。
+type fakeStatement struct {
+	Query string
+	Args  []driver.Value
+}
+
+// fakeDB は database/sql のドライバーを置き換える、MySQL を使わないテスト用の DB です。
+// 受け取った文を記録し、query が返す行を結果にします。exec が error を返した文は失敗します。
+type fakeDB struct {
+	mu         sync.Mutex
+	statements []fakeStatement
+
+	// query は SELECT などの結果の列と行を返します。nil の場合は結果のない行を返します。
+	query func(q string, args []driver.Value) ([]string, [][]driver.Value, error)
+	// exec は INSERT・UPDATE・DDL の結果を返します。nil の場合はすべて成功します。
+	exec func(q string, args []driver.Value) error
+	// hang が true を返した文は、応答しない DB のように context が終わるまで返さず、context のエラーで失敗します。
+	hang func(q string) bool
+}
+
+// wait は q が hang の対象であれば ctx が終わるまで待ち、ctx のエラーを返します。
+func (f *fakeDB) wait(ctx context.Context, q string) error {
+	if f.hang == nil || !f.hang(q) {
+		return nil
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// open は fakeDB に接続する *sql.DB を返します。テストの終了時に閉じます。
+func (f *fakeDB) open(t *testing.T) *sql.DB {
+	t.Helper()
+	db := sql.OpenDB(fakeConnector{f})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// record は受け取った文を記録します。
+func (f *fakeDB) record(q string, args []driver.Value) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statements = append(f.statements, fakeStatement{Query: q, Args: args})
+}
+
+// find は query に substr を含む最初の文を返します。
+func (f *fakeDB) find(t *testing.T, substr string) fakeStatement {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, st := range f.statements {
+		if strings.Contains(st.Query, substr) {
+			return st
+		}
+	}
+	t.Fatalf("no statement contains %q", substr)
+	return fakeStatement{}
+}
+
+// queries は受け取った文を順に返します。
+func (f *fakeDB) queries() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]string, len(f.statements))
+	for i, st := range f.statements {
+		out[i] = st.Query
+	}
+	return out
+}
+
+type fakeConnector struct{ db *fakeDB }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: c.db}, nil }
+func (c fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fakeDriver: use fakeDB.open")
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fakeConn: prepared statements are not supported")
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.record("BEGIN", nil)
+	return fakeTx{db: c.db}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, q string, named []driver.NamedValue) (driver.Result, error) {
+	args := namedValues(named)
+	c.db.record(q, args)
+	if err := c.db.wait(ctx, q); err != nil {
+		return nil, err
+	}
+	if c.db.exec != nil {
+		if err := c.db.exec(q, args); err != nil {
+			return nil, err
+		}
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, q string, named []driver.NamedValue) (driver.Rows, error) {
+	args := namedValues(named)
+	c.db.record(q, args)
+	if err := c.db.wait(ctx, q); err != nil {
+		return nil, err
+	}
+	if c.db.query == nil {
+		return &fakeRows{}, nil
+	}
+	cols, rows, err := c.db.query(q, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{cols: cols, rows: rows}, nil
+}
+
+func namedValues(named []driver.NamedValue) []driver.Value {
+	args := make([]driver.Value, len(named))
+	for i, v := range named {
+		args[i] = v.Value
+	}
+	return args
+}
+
+type fakeTx struct{ db *fakeDB }
+
+func (tx fakeTx) Commit() error {
+	tx.db.record("COMMIT", nil)
+	return nil
+}
+
+func (tx fakeTx) Rollback() error {
+	tx.db.record("ROLLBACK", nil)
+	return nil
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+	next int
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
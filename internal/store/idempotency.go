@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// IdempotentRequest は Idempotency-Key に対応するリクエストの状態です。Done になるまでは処理中です。
+// インスタンスをまたいだ再送にも同じレスポンスを返せるよう、Store に保存します。
+type IdempotentRequest struct {
+	// BodyHash はリクエストボディの SHA-256 です（同じキーで異なるボディが送られたことの確認に使います）。
+	BodyHash []byte              `json:"body_hash"`
+	Done     bool                `json:"done"`
+	Status   int                 `json:"status,omitempty"`
+	Header   map[string][]string `json:"header,omitempty"`
+	Body     []byte              `json:"body,omitempty"`
+}
+
+// idempotencyPruneLimit は FinishIdempotentRequest のたびに削除する、期限を過ぎたキーの数の上限です。
+const idempotencyPruneLimit = 100
+
+// redisIdempotencyPrefix は Idempotency-Key の状態を保存する Redis のキーの接頭辞です。
+const redisIdempotencyPrefix = "matchmaking:idempotency:"
+
+// BeginIdempotentRequest は key のリクエストを処理中として ttl の間 idempotency_keys テーブルに登録します。
+// 期限内の登録が既にある場合は登録せず、その状態を返します（found が true）。
+func (s *mysqlStore) BeginIdempotentRequest(ctx context.Context, key string, req IdempotentRequest, ttl time.Duration) (IdempotentRequest, bool, error) {
+	state, err := json.Marshal(req)
+	if err != nil {
+		return IdempotentRequest{}, false, err
+	}
+	now := s.cfg.now()
+	if _, err := s.exec(ctx, s.DB, "idempotency.delete_expired", "DELETE FROM idempotency_keys WHERE idempotency_key = ? AND expires_at <= ?", key, now); err != nil {
+		return IdempotentRequest{}, false, err
+	}
+	res, err := s.exec(ctx, s.DB, "idempotency.insert", "INSERT IGNORE INTO idempotency_keys (idempotency_key, state, expires_at) VALUES (?, ?, ?)", key, state, now.Add(ttl))
+	if err != nil {
+		return IdempotentRequest{}, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return IdempotentRequest{}, false, err
+	}
+	var stored []byte
+	err = s.queryRow(ctx, s.DB, "idempotency.get", "SELECT state FROM idempotency_keys WHERE idempotency_key = ?", key).Scan(&stored)
+	if errors.Is(err, sql.ErrNoRows) {
+		// 確認の間に取り消された場合は、改めて登録する
+		return s.BeginIdempotentRequest(ctx, key, req, ttl)
+	}
+	if err != nil {
+		return IdempotentRequest{}, false, err
+	}
+	var existing IdempotentRequest
+	if err := json.Unmarshal(stored, &existing); err != nil {
+		return IdempotentRequest{}, false, fmt.Errorf("Idempotency-Key の状態の読み込みエラー: %v", err)
+	}
+	return existing, true, nil
+}
+
+// FinishIdempotentRequest は key のリクエストのレスポンスを保存し、ttl の間保持します。期限を過ぎた他のキーもここで削除します。
+func (s *mysqlStore) FinishIdempotentRequest(ctx context.Context, key string, req IdempotentRequest, ttl time.Duration) error {
+	state, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	now := s.cfg.now()
+	if _, err := s.exec(ctx, s.DB, "idempotency.finish", "UPDATE idempotency_keys SET state = ?, expires_at = ? WHERE idempotency_key = ?", state, now.Add(ttl), key); err != nil {
+		return err
+	}
+	_, err = s.exec(ctx, s.DB, "idempotency.prune", "DELETE FROM idempotency_keys WHERE expires_at <= ? ORDER BY expires_at LIMIT ?", now, idempotencyPruneLimit)
+	return err
+}
+
+// AbandonIdempotentRequest は key の登録を取り消します（同じキーで再送されたリクエストを改めて処理する）。
+func (s *mysqlStore) AbandonIdempotentRequest(ctx context.Context, key string) error {
+	_, err := s.exec(ctx, s.DB, "idempotency.delete", "DELETE FROM idempotency_keys WHERE idempotency_key = ?", key)
+	return err
+}
+
+// BeginIdempotentRequest は key のリクエストを処理中として ttl の間 Redis に登録します（SET NX）。
+// 登録が既にある場合は登録せず、その状態を返します（found が true）。
+func (s *redisStore) BeginIdempotentRequest(ctx context.Context, key string, req IdempotentRequest, ttl time.Duration) (IdempotentRequest, bool, error) {
+	state, err := json.Marshal(req)
+	if err != nil {
+		return IdempotentRequest{}, false, err
+	}
+	for {
+		ok, err := s.client.SetNX(ctx, redisIdempotencyPrefix+key, state, ttl).Result()
+		if err != nil || ok {
+			return IdempotentRequest{}, false, err
+		}
+		stored, err := s.client.Get(ctx, redisIdempotencyPrefix+key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			// 確認の間に期限切れ・取り消しになった場合は、改めて登録する
+			continue
+		}
+		if err != nil {
+			return IdempotentRequest{}, false, err
+		}
+		var existing IdempotentRequest
+		if err := json.Unmarshal(stored, &existing); err != nil {
+			return IdempotentRequest{}, false, fmt.Errorf("Idempotency-Key の状態の読み込みエラー: %v", err)
+		}
+		return existing, true, nil
+	}
+}
+
+// FinishIdempotentRequest は key のリクエストのレスポンスを保存し、ttl の間保持します。
+func (s *redisStore) FinishIdempotentRequest(ctx context.Context, key string, req IdempotentRequest, ttl time.Duration) error {
+	state, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, redisIdempotencyPrefix+key, state, ttl).Err()
+}
+
+// AbandonIdempotentRequest は key の登録を取り消します。
+func (s *redisStore) AbandonIdempotentRequest(ctx context.Context, key string) error {
+	return s.client.Del(ctx, redisIdempotencyPrefix+key).Err()
+}
+
+// memoryIdempotentRequest は MemoryStore に保存した Idempotency-Key の状態と期限です。
+type memoryIdempotentRequest struct {
+	req     IdempotentRequest
+	expires time.Time
+}
+
+// BeginIdempotentRequest は key のリクエストを処理中として ttl の間登録します。
+// 期限内の登録が既にある場合は登録せず、その状態を返します（found が true）。期限を過ぎた他のキーもここで削除します。
+func (s *MemoryStore) BeginIdempotentRequest(ctx context.Context, key string, req IdempotentRequest, ttl time.Duration) (IdempotentRequest, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for k, e := range s.idempotency {
+		if !now.Before(e.expires) {
+			delete(s.idempotency, k)
+		}
+	}
+	if e, ok := s.idempotency[key]; ok {
+		return e.req, true, nil
+	}
+	s.idempotency[key] = memoryIdempotentRequest{req: req, expires: now.Add(ttl)}
+	return IdempotentRequest{}, false, nil
+}
+
+// FinishIdempotentRequest は key のリクエストのレスポンスを保存し、ttl の間保持します。
+func (s *MemoryStore) FinishIdempotentRequest(ctx context.Context, key string, req IdempotentRequest, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idempotency[key] = memoryIdempotentRequest{req: req, expires: s.now().Add(ttl)}
+	return nil
+}
+
+// AbandonIdempotentRequest は key の登録を取り消します。
+func (s *MemoryStore) AbandonIdempotentRequest(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.idempotency, key)
+	return nil
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newMiniRedisStore は miniredis に接続した、既定の設定の redisStore を返します。MySQL を使うメソッドは呼び出せません。
+func newMiniRedisStore(t *testing.T) (*redisStore, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return &redisStore{mysqlStore: &mysqlStore{cfg: DefaultConfig()}, client: client}, mr
+}
+
+// idempotencyStores は Idempotency-Key の状態を共有する Store の実装です。
+func idempotencyStores(t *testing.T) map[string]Store {
+	t.Helper()
+	clock := func() time.Time { return appEpoch }
+	cfg := DefaultConfig()
+	cfg.Now = clock
+	rs, _ := newMiniRedisStore(t)
+	return map[string]Store{"memory": NewMemoryStore(cfg), "redis": rs}
+}
+
+func TestIdempotentRequestLifecycle(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range idempotencyStores(t) {
+		t.Run(name, func(t *testing.T) {
+			pending := IdempotentRequest{BodyHash: []byte("hash")}
+			if _, found, err := s.BeginIdempotentRequest(ctx, "k", pending, time.Minute); err != nil || found {
+				t.Fatalf("first begin found=%v err=%v, want a new registration", found, err)
+			}
+			got, found, err := s.BeginIdempotentRequest(ctx, "k", IdempotentRequest{BodyHash: []byte("other")}, time.Minute)
+			if err != nil || !found || string(got.BodyHash) != "hash" || got.Done {
+				t.Fatalf("second begin = %+v found=%v err=%v, want the pending request", got, found, err)
+			}
+
+			done := IdempotentRequest{BodyHash: []byte("hash"), Done: true, Status: 200, Header: map[string][]string{"X-Test": {"1"}}, Body: []byte("{}")}
+			if err := s.FinishIdempotentRequest(ctx, "k", done, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			got, found, err = s.BeginIdempotentRequest(ctx, "k", pending, time.Minute)
+			if err != nil || !found || !got.Done || got.Status != 200 || string(got.Body) != "{}" || got.Header["X-Test"][0] != "1" {
+				t.Fatalf("begin after finish = %+v found=%v err=%v, want the stored response", got, found, err)
+			}
+
+			if err := s.AbandonIdempotentRequest(ctx, "k"); err != nil {
+				t.Fatal(err)
+			}
+			if _, found, err := s.BeginIdempotentRequest(ctx, "k", pending, time.Minute); err != nil || found {
+				t.Fatalf("begin after abandon found=%v err=%v, want a new registration", found, err)
+			}
+		})
+	}
+}
+
+func TestIdempotentRequestExpires(t *testing.T) {
+	ctx := context.Background()
+	now := appEpoch
+	cfg := DefaultConfig()
+	cfg.Now = func() time.Time { return now }
+	mem := NewMemoryStore(cfg)
+	rs, mr := newMiniRedisStore(t)
+
+	for name, tc := range map[string]struct {
+		s       Store
+		advance func(time.Duration)
+	}{
+		"memory": {mem, func(d time.Duration) { now = now.Add(d) }},
+		"redis":  {rs, mr.FastForward},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := IdempotentRequest{BodyHash: []byte("hash")}
+			if _, _, err := tc.s.BeginIdempotentRequest(ctx, "k", req, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			tc.advance(time.Minute)
+			if _, found, err := tc.s.BeginIdempotentRequest(ctx, "k", req, time.Minute); err != nil || found {
+				t.Fatalf("begin after the TTL found=%v err=%v, want a new registration", found, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+)
+
+// mysqlMatcherLockName はマッチングを行うインスタンスを決める MySQL のアドバイザリーロックの名前です。
+const mysqlMatcherLockName = "matchmaking_matcher"
+
+// setLeader はこのインスタンスがマッチングのロックを保持しているかどうかを記録します（/readyz と matchmaking_matcher_leader で公開します）。
+func (l *mysqlLeaderLock) setLeader(leader bool) {
+	if l.leader.Swap(leader) != leader {
+		if leader {
+			slog.Info("acquired matcher leadership")
+		} else {
+			slog.Warn("マッチングのロックを失いました", "func", "setLeader")
+		}
+	}
+	if leader {
+		metrics.MatcherLeader.Set(1)
+	} else {
+		metrics.MatcherLeader.Set(0)
+	}
+}
+
+// MatcherRole は /readyz に出力するこのインスタンスの役割を返します。リーダー選出を行っていない場合は空文字です。
+func (s *mysqlStore) MatcherRole() string {
+	switch {
+	case s.leader == nil:
+		return ""
+	case s.leader.leader.Load():
+		return "leader"
+	default:
+		return "standby"
+	}
+}
+
+// mysqlLeaderLock は MySQL のアドバイザリーロックでマッチングを行うインスタンスを1つに決めます。
+// GET_LOCK は接続に紐づくため、取得した接続をプールに返さずに保持します。プロセスが停止して接続が切れると
+// MySQL がロックを解放し、待機していた別のインスタンスが次の確認で取得します。
+type mysqlLeaderLock struct {
+	db *sql.DB
+
+	mu   sync.Mutex
+	conn *sql.Conn
+	// leader はロックを保持しているかどうかです。
+	leader atomic.Bool
+}
+
+// newMySQLLeaderLock は db の接続でマッチングのロックを取得する mysqlLeaderLock を生成します。
+func newMySQLLeaderLock(db *sql.DB) *mysqlLeaderLock {
+	metrics.MatcherLeader.Set(0)
+	return &mysqlLeaderLock{db: db}
+}
+
+// acquire はマッチングのロックを保持しているかどうかを返します。保持していない場合は待たずに取得を試みます。
+// 保持している接続が切れていた場合はロックを失ったものとして接続を捨て、取得し直します。
+func (l *mysqlLeaderLock) acquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn != nil {
+		var held sql.NullBool
+		err := l.conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?) = CONNECTION_ID()", mysqlMatcherLockName).Scan(&held)
+		if err == nil && held.Bool {
+			l.setLeader(true)
+			return true, nil
+		}
+		if err != nil && ctx.Err() != nil {
+			// 確認が間に合わなかっただけで、ロックは保持したままの可能性がある。今回はマッチングしない
+			return false, err
+		}
+		l.conn.Close()
+		l.conn = nil
+	}
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		l.setLeader(false)
+		return false, fmt.Errorf("マッチングのロック用の接続エラー: %v", err)
+	}
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", mysqlMatcherLockName).Scan(&got); err != nil {
+		conn.Close()
+		l.setLeader(false)
+		return false, fmt.Errorf("マッチングのロック取得エラー: %v", err)
+	}
+	if got.Int64 != 1 {
+		// 他のインスタンスが保持している
+		conn.Close()
+		l.setLeader(false)
+		return false, nil
+	}
+	l.conn = conn
+	l.setLeader(true)
+	return true, nil
+}
+
+// release はマッチングのロックを解放し、保持している接続を閉じます。停止時に呼び出すと、他のインスタンスがすぐに引き継げます。
+func (l *mysqlLeaderLock) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := l.conn.ExecContext(ctx, "DO RELEASE_LOCK(?)", mysqlMatcherLockName); err != nil {
+		slog.Warn("マッチングのロック解放エラー", "func", "release", "error", err)
+	}
+	l.conn.Close()
+	l.conn = nil
+	l.leader.Store(false)
+	metrics.MatcherLeader.Set(0)
+}
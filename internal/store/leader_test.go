@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"testing"
+
+	"matchmaking_project/internal/model"
+)
+
+// fakeAdvisoryLock は複数のインスタンスで共有する MySQL のアドバイザリーロック（GET_LOCK）です。
+type fakeAdvisoryLock struct {
+	mu sync.Mutex
+	// holder はロックを保持しているインスタンスの番号です。0 は誰も保持していないことを表します。
+	holder int
+}
+
+// instance は番号 n のインスタンスの接続先として、ロックを共有する fakeDB を返します。
+func (l *fakeAdvisoryLock) instance(n int) *fakeDB {
+	return &fakeDB{
+		query: func(q string, _ []driver.Value) ([]string, [][]driver.Value, error) {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			switch {
+			case strings.Contains(q, "GET_LOCK"):
+				if l.holder == 0 {
+					l.holder = n
+				}
+				return []string{"GET_LOCK"}, [][]driver.Value{{boolInt(l.holder == n)}}, nil
+			case strings.Contains(q, "IS_USED_LOCK"):
+				return []string{"held"}, [][]driver.Value{{boolInt(l.holder == n)}}, nil
+			}
+			return nil, nil, nil
+		},
+		exec: func(q string, _ []driver.Value) error {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if strings.Contains(q, "RELEASE_LOCK") && l.holder == n {
+				l.holder = 0
+			}
+			return nil
+		},
+	}
+}
+
+// crash はロックを保持しているインスタンスが停止し、接続が切れて MySQL がロックを解放した状態にします。
+func (l *fakeAdvisoryLock) crash() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.holder = 0
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// 2つのインスタンスのうちロックを取得した一方だけがマッチングし、停止すればもう一方が引き継ぐ
+func TestLeaderElectionOneInstanceMatches(t *testing.T) {
+	lock := &fakeAdvisoryLock{}
+	var instances [2]*mysqlStore
+	planned := [2]int{}
+	for i := range instances {
+		s := newFakeMySQLStore(t, lock.instance(i+1))
+		s.leader = newMySQLLeaderLock(s.DB)
+		instances[i] = s
+	}
+	// tick は alive のインスタンスでマッチングを1回ずつ行います
+	tick := func(alive ...int) {
+		t.Helper()
+		for _, i := range alive {
+			s := instances[i]
+			plan := func([]model.QueueEntry, model.OpponentSet, model.OpponentSet) []model.SessionResult {
+				planned[i]++
+				return nil
+			}
+			if _, err := s.CreateSessions(context.Background(), plan); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	roles := func() [2]string {
+		return [2]string{instances[0].MatcherRole(), instances[1].MatcherRole()}
+	}
+
+	tick(0, 1)
+	tick(0, 1)
+	if planned != [2]int{2, 0} || roles() != [2]string{"leader", "standby"} {
+		t.Fatalf("planned %v with roles %v, want only the first instance matching as the leader", planned, roles())
+	}
+
+	// リーダーが停止すると、次の確認で待機していたインスタンスが引き継ぐ
+	lock.crash()
+	tick(1)
+	if planned != [2]int{2, 1} || instances[1].MatcherRole() != "leader" {
+		t.Fatalf("planned %v with roles %v after the crash, want the second instance to take over", planned, roles())
+	}
+
+	// 停止時にロックを解放すれば、再起動したインスタンスがすぐに引き継げる
+	instances[1].Close()
+	instances[0] = newFakeMySQLStore(t, lock.instance(1))
+	instances[0].leader = newMySQLLeaderLock(instances[0].DB)
+	tick(0)
+	if planned != [2]int{3, 1} || instances[0].MatcherRole() != "leader" {
+		t.Fatalf("planned %v with role %q after the release, want the restarted first instance leading", planned, instances[0].MatcherRole())
+	}
+}
+
+// リーダー選出を行わない場合は常にマッチングし、役割を出力しない
+func TestWithoutLeaderElection(t *testing.T) {
+	s := newFakeMySQLStore(t, &fakeDB{})
+	planned := 0
+	if _, err := s.CreateSessions(context.Background(), func([]model.QueueEntry, model.OpponentSet, model.OpponentSet) []model.SessionResult {
+		planned++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if planned != 1 || s.MatcherRole() != "" {
+		t.Fatalf("planned %d with role %q, want 1 and no role", planned, s.MatcherRole())
+	}
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"matchmaking_project/internal/model"
+)
+
+// 同じレーティングのプレイヤーは対戦数の多い順、プレイヤーID順に並べ、ページをまたいでも順位が変わらない
+func TestLeaderboardTieBreaks(t *testing.T) {
+	s := NewMemoryStore(DefaultConfig())
+	for _, p := range []model.PlayerProfile{
+		{ID: "carol", Rating: 1500, GamesPlayed: 10},
+		{ID: "alice", Rating: 1500, GamesPlayed: 10},
+		{ID: "bob", Rating: 1500, GamesPlayed: 30},
+		{ID: "dave", Rating: 1600, GamesPlayed: 1},
+		{ID: "erin", Rating: 1400, GamesPlayed: 99},
+		{ID: model.SelftestPlayerPrefix + "a", Rating: 3000},
+	} {
+		s.players[p.ID] = p
+	}
+	want := []string{"dave", "bob", "alice", "carol", "erin"}
+	ctx := context.Background()
+
+	var got []string
+	for offset := 0; offset < len(want)+2; offset += 2 {
+		page, err := s.TopPlayers(ctx, 2, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range page {
+			got = append(got, p.ID)
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("pages = %v, want %v", got, want)
+	}
+	for i, id := range want {
+		if rank, err := s.PlayerRank(ctx, id); err != nil || rank != i+1 {
+			t.Errorf("%s rank = %d, %v, want %d", id, rank, err, i+1)
+		}
+	}
+	// セルフテストの合成プレイヤーはランキングに含めない
+	if _, err := s.PlayerRank(ctx, model.SelftestPlayerPrefix+"a"); !errors.Is(err, ErrPlayerNotFound) {
+		t.Errorf("synthetic player rank err = %v, want ErrPlayerNotFound", err)
+	}
+}
+
+// MySQL の順位は、ランキングの順（レーティング・対戦数・プレイヤーID）で先にいるプレイヤー数から求める
+func TestMySQLLeaderboardQueries(t *testing.T) {
+	f := &fakeDB{query: func(q string, _ []driver.Value) ([]string, [][]driver.Value, error) {
+		switch {
+		case strings.Contains(q, "WHERE player_id = ?"):
+			return []string{"player_id", "rating", "games_played", "wins", "losses", "draws", "created_at"},
+				[][]driver.Value{{"bob", int64(1500), int64(30), int64(0), int64(0), int64(0), appEpoch}}, nil
+		case strings.HasPrefix(q, "SELECT COUNT(*) FROM players"):
+			return []string{"COUNT(*)"}, [][]driver.Value{{int64(1)}}, nil
+		}
+		return nil, nil, nil
+	}}
+	s := newFakeMySQLStore(t, f)
+	ctx := context.Background()
+
+	rank, err := s.PlayerRank(ctx, "bob")
+	if err != nil || rank != 2 {
+		t.Fatalf("rank = %d, %v, want 2", rank, err)
+	}
+	args := f.find(t, "SELECT COUNT(*) FROM players").Args
+	if want := []driver.Value{selftestPlayerPattern, int64(1500), int64(1500), int64(30), int64(30), "bob"}; !slices.Equal(args, want) {
+		t.Errorf("rank args = %v, want %v", args, want)
+	}
+
+	if _, err := s.TopPlayers(ctx, 20, 40); err != nil {
+		t.Fatal(err)
+	}
+	top := f.find(t, "LIMIT ? OFFSET ?")
+	if !strings.Contains(top.Query, "ORDER BY rating DESC, games_played DESC, player_id ASC") {
+		t.Errorf("top players query = %q, want the tie-breaking order", top.Query)
+	}
+	if want := []driver.Value{selftestPlayerPattern, int64(20), int64(40)}; !slices.Equal(top.Args, want) {
+		t.Errorf("top players args = %v, want %v", top.Args, want)
+	}
+}
+
+// ランキングの並び順と同じ列のインデックスをマイグレーションで作成する
+func TestLeaderboardIndexMigration(t *testing.T) {
+	migrations, err := loadMigrations(embeddedMigrations, migrationsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		for _, stmt := range m.Statements {
+			if strings.Contains(stmt.SQL, "(rating DESC, games_played DESC, player_id ASC)") {
+				return
+			}
+		}
+	}
+	t.Fatal("no migration creates an index on (rating DESC, games_played DESC, player_id ASC)")
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"slices"
+	"strings"
+	"testing"
+
+	"matchmaking_project/internal/model"
+)
+
+// MySQL では待機開始の古い順に MatchBatchSize 人だけを、インデックス（waiting_since, player_id）の順にロックして取得する
+func TestCreateSessionsLocksOneBatch(t *testing.T) {
+	for _, tc := range []struct {
+		batch int
+		limit bool
+	}{
+		{5000, true},
+		{0, false},
+	} {
+		f := &fakeDB{}
+		s := newFakeMySQLStore(t, f)
+		s.cfg.MatchBatchSize = tc.batch
+		if _, err := s.CreateSessions(context.Background(), func([]model.QueueEntry, model.OpponentSet, model.OpponentSet) []model.SessionResult { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		st := f.find(t, "FROM matchmaking_queue q")
+		if !strings.Contains(st.Query, "ORDER BY q.waiting_since ASC, q.player_id ASC") || !strings.HasSuffix(st.Query, "FOR UPDATE SKIP LOCKED") {
+			t.Errorf("batch %d: query = %q, want the oldest players locked in index order", tc.batch, st.Query)
+		}
+		if got := strings.Contains(st.Query, "LIMIT ?"); got != tc.limit || (tc.limit && !slices.Equal(st.Args, []driver.Value{int64(tc.batch)})) {
+			t.Errorf("batch %d: LIMIT %v with args %v, want LIMIT %v", tc.batch, got, st.Args, tc.limit)
+		}
+	}
+}
+
+func TestWaitingSinceIndexMigration(t *testing.T) {
+	migrations, err := loadMigrations(embeddedMigrations, migrationsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		for _, stmt := range m.Statements {
+			if strings.Contains(stmt.SQL, "ON matchmaking_queue (waiting_since, player_id)") {
+				return
+			}
+		}
+	}
+	t.Fatal("no migration creates an index on matchmaking_queue (waiting_since, player_id)")
+}
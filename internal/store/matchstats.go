@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// MatchQualityStats は期間内に作成したセッションの対戦の質の集計です。
+type MatchQualityStats struct {
+	Sessions              int     `json:"sessions"`
+	AverageQuality        float64 `json:"average_quality"`
+	AverageRatingGap      float64 `json:"average_rating_gap"`
+	AverageWinProbability float64 `json:"average_win_probability"`
+	// WaitP50Seconds, WaitP95Seconds はボットを除く参加者の、待機開始からセッション成立までの時間の中央値と 95 パーセンタイルです。
+	WaitP50Seconds float64 `json:"wait_p50_seconds"`
+	WaitP95Seconds float64 `json:"wait_p95_seconds"`
+}
+
+// nearestRankPercentile は昇順に並んだ values の p（0〜1）パーセンタイルを最近傍順位法で返します。空の場合は 0 を返します。
+// MySQL での集計（MatchQualityStats）と同じ方法です。
+func nearestRankPercentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p * float64(len(values))))
+	return values[max(rank, 1)-1]
+}
+
+// MatchQualityStats は since 以降に作成したセッションの対戦の質を集計します。
+// 待機時間のパーセンタイルは、MySQL に集計関数がないため ROW_NUMBER で最近傍順位法により求めます。
+func (s *mysqlStore) MatchQualityStats(ctx context.Context, since time.Time) (MatchQualityStats, error) {
+	var stats MatchQualityStats
+	query := `SELECT COUNT(*), COALESCE(AVG(match_quality), 0), COALESCE(AVG(rating_gap), 0), COALESCE(AVG(win_probability), 0)
+		FROM sessions WHERE start_time >= ?`
+	err := s.queryRow(ctx, s.DB, "stats.match_quality", query, since).Scan(&stats.Sessions, &stats.AverageQuality, &stats.AverageRatingGap, &stats.AverageWinProbability)
+	if err != nil {
+		return MatchQualityStats{}, fmt.Errorf("セッション集計エラー: %v", err)
+	}
+
+	waitQuery := `SELECT COALESCE(MAX(CASE WHEN rn <= CEIL(0.5 * total) THEN wait END), 0), COALESCE(MAX(CASE WHEN rn <= CEIL(0.95 * total) THEN wait END), 0)
+		FROM (
+			SELECT TIMESTAMPDIFF(MICROSECOND, sp.waiting_since, s.start_time) / 1000000 AS wait,
+				ROW_NUMBER() OVER (ORDER BY TIMESTAMPDIFF(MICROSECOND, sp.waiting_since, s.start_time)) AS rn,
+				COUNT(*) OVER () AS total
+			FROM sessions s
+			JOIN session_players sp ON sp.session_id = s.session_id
+			WHERE s.start_time >= ? AND sp.is_bot = FALSE
+		) w`
+	err = s.queryRow(ctx, s.DB, "stats.match_wait", waitQuery, since).Scan(&stats.WaitP50Seconds, &stats.WaitP95Seconds)
+	if err != nil {
+		return MatchQualityStats{}, fmt.Errorf("待機時間集計エラー: %v", err)
+	}
+	return stats, nil
+}
+
+// MatchQualityStats は since 以降に開始したセッションの対戦の質を集計します。
+func (s *MemoryStore) MatchQualityStats(ctx context.Context, since time.Time) (MatchQualityStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var stats MatchQualityStats
+	var waits []float64
+	for id, session := range s.sessions {
+		started := s.sessionTimes[id].Started
+		if started.Before(since) {
+			continue
+		}
+		stats.Sessions++
+		stats.AverageQuality += float64(session.Quality)
+		stats.AverageRatingGap += float64(session.RatingGap)
+		stats.AverageWinProbability += session.WinProbability
+		for _, p := range session.Participants {
+			if !p.IsBot {
+				waits = append(waits, started.Sub(p.WaitingSince).Seconds())
+			}
+		}
+	}
+	if stats.Sessions > 0 {
+		n := float64(stats.Sessions)
+		stats.AverageQuality /= n
+		stats.AverageRatingGap /= n
+		stats.AverageWinProbability /= n
+	}
+	sort.Float64s(waits)
+	stats.WaitP50Seconds = nearestRankPercentile(waits, 0.5)
+	stats.WaitP95Seconds = nearestRankPercentile(waits, 0.95)
+	return stats, nil
+}
@@ -0,0 +1,1021 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// MemoryStore はプロセス内のメモリに状態を保存する Store です。
+// テストや MySQL のないローカル開発（--store=memory）向けで、mysqlStore と同じ振る舞いをします。
+// 状態はプロセスの終了とともに失われ、複数インスタンスでは共有できません。
+type MemoryStore struct {
+	// now は現在時刻を返す関数です（Config.Now。テストで時刻を固定するため）。
+	now func() time.Time
+	cfg Config
+
+	mu       sync.Mutex
+	players  map[string]model.PlayerProfile
+	queue    map[string]QueuedPlayer
+	sessions map[string]model.SessionResult
+	// sessionTimes はセッションの開始・終了時刻です（mysqlStore の start_time・ended_at にあたる）。
+	sessionTimes map[string]sessionTimes
+	// recent は最近対戦したプレイヤーの組み合わせ（OpponentPair）と対戦した時刻です。
+	recent map[[2]string]time.Time
+	state  map[string]string
+	// bans はプレイヤーごとの参加禁止です。
+	bans map[string]PlayerBan
+	// blocks はプレイヤー（[0]）がブロックした相手（[1]）の組み合わせです（mysqlStore の blocked_pairs にあたる）。
+	blocks map[[2]string]time.Time
+	// notifications は通知していないマッチング結果の作成時刻です（mysqlStore の match_notifications にあたる）。
+	notifications map[string]time.Time
+	// resultAcks はセッション（[0]）の結果をプレイヤー（[1]）が受け取った時刻です（mysqlStore の session_players.result_acked_at にあたる）。
+	resultAcks map[[2]string]time.Time
+	// lastPlayed, decayed はプレイヤーのセッションが最後に確定した時刻とレーティングを最後に減衰した時刻です（mysqlStore の last_played_at・rating_decayed_at にあたる）。
+	lastPlayed map[string]time.Time
+	decayed    map[string]time.Time
+	// cooldowns, lastOffense はプレイヤーのクールダウンと最後の違反の時刻です（mysqlStore の cooldown_until・cooldown_offenses・last_offense_at にあたる）。
+	cooldowns   map[string]PlayerCooldown
+	lastOffense map[string]time.Time
+	// queueHistory は待機を終えたプレイヤーの記録です（mysqlStore の queue_history にあたる）。
+	queueHistory []QueueHistoryRecord
+	// auditEvents は追記した順の監査イベントです（mysqlStore の audit_events にあたる）。
+	auditEvents []AuditEvent
+	// headToHead はプレイヤー（[0]）から見た相手（[1]）との対戦成績です（mysqlStore の head_to_head にあたる）。
+	headToHead map[[2]string]model.WinLossRecord
+	// idempotency は Idempotency-Key ごとのリクエストの状態です（mysqlStore の idempotency_keys にあたる）。
+	idempotency map[string]memoryIdempotentRequest
+}
+
+// sessionTimes はセッションの開始時刻と終了時刻です。終了していない場合 Ended はゼロ値です。
+type sessionTimes struct {
+	Started time.Time
+	Ended   time.Time
+}
+
+// NewMemoryStore は空の MemoryStore を生成します。
+func NewMemoryStore(cfg Config) *MemoryStore {
+	return &MemoryStore{
+		now:          cfg.now,
+		cfg:          cfg,
+		players:      make(map[string]model.PlayerProfile),
+		queue:        make(map[string]QueuedPlayer),
+		sessions:     make(map[string]model.SessionResult),
+		sessionTimes: make(map[string]sessionTimes),
+		recent:       make(map[[2]string]time.Time),
+		state:        make(map[string]string),
+
+		bans:          make(map[string]PlayerBan),
+		blocks:        make(map[[2]string]time.Time),
+		notifications: make(map[string]time.Time),
+		resultAcks:    make(map[[2]string]time.Time),
+		lastPlayed:    make(map[string]time.Time),
+		decayed:       make(map[string]time.Time),
+		cooldowns:     make(map[string]PlayerCooldown),
+		lastOffense:   make(map[string]time.Time),
+		headToHead:    make(map[[2]string]model.WinLossRecord),
+		idempotency:   make(map[string]memoryIdempotentRequest),
+	}
+}
+
+// Ping は常に成功します。
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close は何もしません。
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// MatcherRole は常に空文字を返します（1プロセスのみのため、リーダー選出を行いません）。
+func (s *MemoryStore) MatcherRole() string {
+	return ""
+}
+
+// GetPlayerProfile はプレイヤー情報を返します。
+func (s *MemoryStore) GetPlayerProfile(ctx context.Context, playerID string) (model.PlayerProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.players[playerID]
+	if !ok {
+		return model.PlayerProfile{}, ErrPlayerNotFound
+	}
+	return p, nil
+}
+
+// SetPlayerRating はプレイヤーのレーティングを更新します。未登録のプレイヤーであれば作成します。
+func (s *MemoryStore) SetPlayerRating(ctx context.Context, playerID string, rating int) (model.PlayerProfile, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.players[playerID]
+	if !ok {
+		p = model.PlayerProfile{ID: playerID, CreatedAt: s.now()}
+	}
+	p.Rating = rating
+	s.players[playerID] = p
+	return p, !ok, nil
+}
+
+// BanPlayer はプレイヤーの参加禁止を登録します。
+func (s *MemoryStore) BanPlayer(ctx context.Context, ban PlayerBan) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, exists := s.bans[ban.PlayerID]
+	s.bans[ban.PlayerID] = ban
+	return !exists, nil
+}
+
+// UnbanPlayer はプレイヤーの参加禁止を削除します。
+func (s *MemoryStore) UnbanPlayer(ctx context.Context, playerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.bans[playerID]; !ok {
+		return ErrNotBanned
+	}
+	delete(s.bans, playerID)
+	return nil
+}
+
+// BlockPlayer はプレイヤーが blockedID のプレイヤーとマッチングされないよう登録します。
+func (s *MemoryStore) BlockPlayer(ctx context.Context, playerID, blockedID string, limit int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]string{playerID, blockedID}
+	if _, exists := s.blocks[key]; exists {
+		return false, nil
+	}
+	n := 0
+	for pair := range s.blocks {
+		if pair[0] == playerID {
+			n++
+		}
+	}
+	if n >= limit {
+		return false, ErrBlockLimitReached
+	}
+	s.blocks[key] = s.now()
+	return true, nil
+}
+
+// UnblockPlayer はプレイヤーのブロックを解除します。
+func (s *MemoryStore) UnblockPlayer(ctx context.Context, playerID, blockedID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]string{playerID, blockedID}
+	if _, ok := s.blocks[key]; !ok {
+		return ErrNotBlocked
+	}
+	delete(s.blocks, key)
+	return nil
+}
+
+// ActiveBan は PlayerIDs のうち now の時点で参加禁止のプレイヤーを返します。
+func (s *MemoryStore) ActiveBan(ctx context.Context, playerIDs []string, now time.Time) (PlayerBan, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range playerIDs {
+		if ban, ok := s.bans[id]; ok && ban.activeAt(now) {
+			return ban, true, nil
+		}
+	}
+	return PlayerBan{}, false, nil
+}
+
+// RecordCooldownOffense はプレイヤーの違反を記録し、クールダウンを設定します。
+func (s *MemoryStore) RecordCooldownOffense(ctx context.Context, playerID string, now time.Time) (PlayerCooldown, error) {
+	if !s.cfg.Cooldown.Enabled() {
+		return PlayerCooldown{}, ErrCooldownDisabled
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.players[playerID]; !ok {
+		return PlayerCooldown{}, ErrPlayerNotFound
+	}
+	prev := s.cooldowns[playerID]
+	cooldown := s.cfg.Cooldown.next(playerID, prev.Offenses, s.lastOffense[playerID], prev.Until, now)
+	s.cooldowns[playerID] = cooldown
+	s.lastOffense[playerID] = now
+	return cooldown, nil
+}
+
+// ActiveCooldown は PlayerIDs のうち now の時点でクールダウン中のプレイヤーを返します（複数の場合は期限の最も遅いもの）。
+func (s *MemoryStore) ActiveCooldown(ctx context.Context, playerIDs []string, now time.Time) (PlayerCooldown, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var latest PlayerCooldown
+	for _, id := range playerIDs {
+		if c, ok := s.cooldowns[id]; ok && c.Until.After(now) && c.Until.After(latest.Until) {
+			latest = c
+		}
+	}
+	return latest, !latest.Until.IsZero(), nil
+}
+
+// TopPlayers はランキングの順（レーティング・対戦数の多い順、同じ場合はプレイヤーID順）にプレイヤーを返します。
+func (s *MemoryStore) TopPlayers(ctx context.Context, limit, offset int) ([]model.PlayerProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	players := s.rankedPlayers()
+	if offset >= len(players) {
+		return []model.PlayerProfile{}, nil
+	}
+	players = players[offset:]
+	if len(players) > limit {
+		players = players[:limit]
+	}
+	return players, nil
+}
+
+// PlayerRank はプレイヤーのランキングでの順位を返します。
+func (s *MemoryStore) PlayerRank(ctx context.Context, playerID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, p := range s.rankedPlayers() {
+		if p.ID == playerID {
+			return i + 1, nil
+		}
+	}
+	return 0, ErrPlayerNotFound
+}
+
+// rankedPlayers はセルフテストの合成プレイヤーを除くプレイヤーをランキングの順に返します。
+// 呼び出し元で s.mu をロックしておく必要があります。
+func (s *MemoryStore) rankedPlayers() []model.PlayerProfile {
+	players := []model.PlayerProfile{}
+	for _, p := range s.players {
+		if !model.IsSyntheticPlayer(p.ID) {
+			players = append(players, p)
+		}
+	}
+	sort.Slice(players, func(i, j int) bool {
+		a, b := players[i], players[j]
+		if a.Rating != b.Rating {
+			return a.Rating > b.Rating
+		}
+		if a.GamesPlayed != b.GamesPlayed {
+			return a.GamesPlayed > b.GamesPlayed
+		}
+		return a.ID < b.ID
+	})
+	return players
+}
+
+// EnqueueEntry はエントリを待機キューへ登録します。メンバーのいずれかが登録済みの場合は誰も登録しません。
+func (s *MemoryStore) EnqueueEntry(ctx context.Context, entry model.QueueEntry) (model.QueueEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.resumeRequeuedEntry(entry) {
+		return entry, nil
+	}
+	for _, member := range entry.Players {
+		if _, queued := s.queue[member.ID]; queued {
+			return model.QueueEntry{}, model.ErrAlreadyQueued
+		}
+	}
+	if !s.cfg.queueHasRoom(len(s.queue), len(entry.Players)) {
+		return model.QueueEntry{}, ErrQueueFull
+	}
+	if members := s.unfinishedSessions(entry.Players); len(members) > 0 {
+		if !entry.ReplaceSession {
+			return model.QueueEntry{}, &ActiveSessionError{members[0]}
+		}
+		entry.Abandoned = s.abandonSessions(members)
+	}
+
+	now := s.now()
+	waitingSince := now
+	if !entry.WaitingSince.IsZero() {
+		waitingSince = entry.WaitingSince
+	}
+	players := make([]model.Player, 0, len(entry.Players))
+	for _, member := range entry.Players {
+		profile, ok := s.players[member.ID]
+		if !ok {
+			profile = model.PlayerProfile{ID: member.ID, Rating: s.cfg.RatingSeeds.Seed(member.SelfReportedSkill), CreatedAt: now}
+		}
+		if member.Rating > 0 {
+			// TRUST_CLIENT_RATING で申告されたレーティングを使う
+			profile.Rating = member.Rating
+		}
+		s.players[member.ID] = profile
+		s.queue[member.ID] = QueuedPlayer{
+			ID:             member.ID,
+			PartyID:        entry.PartyID,
+			GameMode:       entry.GameMode,
+			Region:         entry.Region,
+			PingMS:         member.PingMS,
+			WaitingSince:   waitingSince,
+			ExpiresAt:      entry.ExpiresAt,
+			Priority:       entry.Priority,
+			RatingRange:    entry.RatingRange,
+			MaxWaitSeconds: int(entry.Timeout / time.Second),
+			Attributes:     member.Attributes,
+			TraceParent:    entry.TraceParent,
+		}
+		players = append(players, model.Player{ID: member.ID, Rating: profile.Rating, Region: entry.Region, PingMS: member.PingMS, Priority: entry.Priority, GamesPlayed: profile.GamesPlayed, RatingRange: entry.RatingRange,
+			Attributes: member.Attributes})
+	}
+	entry.Players = players
+	entry.Rating = model.AverageRating(players)
+	return entry, nil
+}
+
+// unfinishedSessions は players が参加している未終了（承諾待ち・確定）のセッションを、成立の古い順に返します。
+// 呼び出し元で s.mu をロックしておく必要があります。
+func (s *MemoryStore) unfinishedSessions(players []model.Player) []playerSession {
+	var members []playerSession
+	for id, session := range s.sessions {
+		if session.Status != model.SessionPendingAccept && session.Status != model.SessionActive {
+			continue
+		}
+		for _, p := range session.Participants {
+			for _, member := range players {
+				if p.ID == member.ID {
+					members = append(members, playerSession{PlayerID: p.ID, SessionID: id})
+				}
+			}
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		a, b := members[i], members[j]
+		if ta, tb := s.sessionTimes[a.SessionID].Started, s.sessionTimes[b.SessionID].Started; !ta.Equal(tb) {
+			return ta.Before(tb)
+		}
+		if a.SessionID != b.SessionID {
+			return a.SessionID < b.SessionID
+		}
+		return a.PlayerID < b.PlayerID
+	})
+	return members
+}
+
+// abandonSessions は members のプレイヤーの承諾状態を放棄（ReadyAbandoned）にしてセッションを中止し、中止したセッションを返します。
+// 呼び出し元で s.mu をロックしておく必要があります。
+func (s *MemoryStore) abandonSessions(members []playerSession) []model.SessionResult {
+	sessionIDs, players := sessionMembers(members)
+	abandoned := make([]model.SessionResult, 0, len(sessionIDs))
+	for _, id := range sessionIDs {
+		stored := s.sessions[id]
+		for i := range stored.Participants {
+			for _, playerID := range players[id] {
+				if stored.Participants[i].ID == playerID {
+					stored.Participants[i].ReadyState = model.ReadyAbandoned
+				}
+			}
+		}
+		s.sessions[id] = stored
+		session, _, err := s.resolveReadyCheck(id, players[id][0], model.ReadyAbandoned)
+		if err != nil {
+			// ロックしたまま存在を確認したセッションのため起こらない
+			continue
+		}
+		abandoned = append(abandoned, session)
+	}
+	return abandoned
+}
+
+// resumeRequeuedEntry は、エントリの全メンバーが中止されたセッションから待機キューへ戻された状態であれば、
+// 待機を再開して true を返します。呼び出し元で s.mu をロックしておく必要があります。
+func (s *MemoryStore) resumeRequeuedEntry(entry model.QueueEntry) bool {
+	for _, member := range entry.Players {
+		row, ok := s.queue[member.ID]
+		if !ok || !row.Requeued || row.PartyID != entry.PartyID {
+			return false
+		}
+	}
+	for _, member := range entry.Players {
+		row := s.queue[member.ID]
+		row.Requeued = false
+		row.ExpiresAt = entry.ExpiresAt
+		s.queue[member.ID] = row
+	}
+	return true
+}
+
+// QueuePosition はプレイヤーの待機キューでの順番を返します。
+func (s *MemoryStore) QueuePosition(ctx context.Context, playerID string) (queuePosition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return findQueuePosition(s.queuedPlayers(), playerID)
+}
+
+// DequeuePlayer はプレイヤー（パーティで参加している場合はパーティ全体）を待機キューから削除します。
+func (s *MemoryStore) DequeuePlayer(ctx context.Context, playerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dequeue(playerID, false)
+	return nil
+}
+
+// SuspendEntry はプレイヤー（パーティの場合はパーティ全体）をクライアントの再接続を待つ状態にします。
+func (s *MemoryStore) SuspendEntry(ctx context.Context, playerID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.queue[playerID]
+	if !ok {
+		return ErrNotQueued
+	}
+	for id, other := range s.queue {
+		if id != playerID && (row.PartyID == "" || other.PartyID != row.PartyID) {
+			continue
+		}
+		other.Requeued = true
+		if other.ExpiresAt.IsZero() || expiresAt.Before(other.ExpiresAt) {
+			other.ExpiresAt = expiresAt
+		}
+		s.queue[id] = other
+	}
+	return nil
+}
+
+// dequeue はプレイヤー（パーティの場合はパーティ全体）を待機キューから削除します。
+// requeuedOnly が true の場合は、待機キューへ戻された行のみを対象にします。呼び出し元で s.mu をロックしておく必要があります。
+func (s *MemoryStore) dequeue(playerID string, requeuedOnly bool) {
+	row, ok := s.queue[playerID]
+	if !ok || (requeuedOnly && !row.Requeued) {
+		return
+	}
+	if row.PartyID == "" {
+		delete(s.queue, playerID)
+		return
+	}
+	for id, other := range s.queue {
+		if other.PartyID == row.PartyID && (!requeuedOnly || other.Requeued) {
+			delete(s.queue, id)
+		}
+	}
+}
+
+// ListQueuedPlayers は待機キューのプレイヤーを待機開始の古い順に返します。
+func (s *MemoryStore) ListQueuedPlayers(ctx context.Context) ([]QueuedPlayer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queuedPlayers(), nil
+}
+
+// queuedPlayers は待機キューのプレイヤーを現在のレーティングとともに待機開始順で返します。
+// 呼び出し元で s.mu をロックしておく必要があります。
+func (s *MemoryStore) queuedPlayers() []QueuedPlayer {
+	rows := make([]QueuedPlayer, 0, len(s.queue))
+	for _, row := range s.queue {
+		row.Rating = s.players[row.ID].Rating
+		row.GamesPlayed = s.players[row.ID].GamesPlayed
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].WaitingSince.Equal(rows[j].WaitingSince) {
+			return rows[i].WaitingSince.Before(rows[j].WaitingSince)
+		}
+		return rows[i].ID < rows[j].ID
+	})
+	return rows
+}
+
+// SweepExpiredEntries は有効期限を過ぎたエントリを待機キューから削除します。
+func (s *MemoryStore) SweepExpiredEntries(ctx context.Context, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, row := range s.queue {
+		if !row.ExpiresAt.IsZero() && !row.ExpiresAt.After(now) {
+			delete(s.queue, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// CreateSessions は待機キューをロックしたまま plan にロビーを組ませ、返されたセッションを保存します。
+func (s *MemoryStore) CreateSessions(ctx context.Context, plan matchPlanner) ([]model.SessionResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := GroupQueueEntries(s.queuedPlayers())
+	var players []model.Player
+	for _, e := range entries {
+		players = append(players, e.Players...)
+	}
+	entries = withoutPlayersInSession(entries, s.unfinishedSessions(players))
+	recent := make(model.OpponentSet)
+	cutoff := s.now().Add(-s.cfg.RecentOpponentWindow)
+	for pair, matchedAt := range s.recent {
+		_, queued0 := s.queue[pair[0]]
+		_, queued1 := s.queue[pair[1]]
+		if queued0 && queued1 && !matchedAt.Before(cutoff) {
+			recent.Add(pair[0], pair[1])
+		}
+	}
+
+	blocked := make(model.OpponentSet)
+	for pair := range s.blocks {
+		_, queued0 := s.queue[pair[0]]
+		_, queued1 := s.queue[pair[1]]
+		if queued0 && queued1 {
+			blocked.Add(pair[0], pair[1])
+		}
+	}
+
+	sessions := plan(entries, recent, blocked)
+	for i := range sessions {
+		if _, exists := s.sessions[sessions[i].SessionID]; exists {
+			sessions[i].SessionID = string(model.NewSessionID())
+		}
+		for _, p := range sessions[i].Participants {
+			delete(s.queue, p.ID)
+		}
+		s.sessions[sessions[i].SessionID] = copySession(sessions[i])
+		s.sessionTimes[sessions[i].SessionID] = sessionTimes{Started: s.now()}
+		s.notifications[sessions[i].SessionID] = s.now()
+	}
+	return sessions, nil
+}
+
+// copySession は参加者と承諾期限を共有しないセッションのコピーを返します。
+func copySession(session model.SessionResult) model.SessionResult {
+	session.Participants = append([]model.Participant(nil), session.Participants...)
+	session.Spectators = append([]string(nil), session.Spectators...)
+	if session.AcceptDeadline != nil {
+		deadline := *session.AcceptDeadline
+		session.AcceptDeadline = &deadline
+	}
+	session.Player1, session.Player2 = nil, nil
+	return session
+}
+
+// GetSession はセッションと参加者を返します。
+func (s *MemoryStore) GetSession(ctx context.Context, sessionID string) (model.SessionResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadSession(sessionID)
+}
+
+// RecentSession はプレイヤーが参加している成立直後の未終了のセッションを返します。
+func (s *MemoryStore) RecentSession(ctx context.Context, playerID string, startedAfter time.Time) (model.SessionResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var latestID string
+	var latest time.Time
+	for id, session := range s.sessions {
+		if session.Status != model.SessionPendingAccept && session.Status != model.SessionActive {
+			continue
+		}
+		started := s.sessionTimes[id].Started
+		if started.Before(startedAfter) || (latestID != "" && (started.Before(latest) || (started.Equal(latest) && id < latestID))) {
+			continue
+		}
+		for _, p := range session.Participants {
+			if p.ID == playerID {
+				if _, acked := s.resultAcks[[2]string{id, playerID}]; !acked {
+					latestID, latest = id, started
+				}
+				break
+			}
+		}
+	}
+	if latestID == "" {
+		return model.SessionResult{}, model.ErrSessionNotFound
+	}
+	return s.loadSession(latestID)
+}
+
+// AckSessionResult はプレイヤーがセッションの結果を受け取った時刻を記録します。
+func (s *MemoryStore) AckSessionResult(ctx context.Context, sessionID, playerID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return model.ErrSessionNotFound
+	}
+	for _, p := range session.Participants {
+		if p.ID == playerID {
+			key := [2]string{sessionID, playerID}
+			if _, acked := s.resultAcks[key]; !acked {
+				s.resultAcks[key] = at
+			}
+			return nil
+		}
+	}
+	return model.ErrSessionNotFound
+}
+
+// forgetSession はセッションと、セッションに関する記録を削除します。呼び出し元で s.mu をロックしておく必要があります。
+func (s *MemoryStore) forgetSession(id string) {
+	for _, p := range s.sessions[id].Participants {
+		delete(s.resultAcks, [2]string{id, p.ID})
+	}
+	delete(s.sessions, id)
+	delete(s.sessionTimes, id)
+	delete(s.notifications, id)
+}
+
+// loadSession は mysqlStore と同じく、参加者をチーム・プレイヤーID順に並べ、現在のレーティングを設定したセッションを返します。
+// 呼び出し元で s.mu をロックしておく必要があります。
+func (s *MemoryStore) loadSession(sessionID string) (model.SessionResult, error) {
+	stored, ok := s.sessions[sessionID]
+	if !ok {
+		return model.SessionResult{}, model.ErrSessionNotFound
+	}
+	session := copySession(stored)
+	if started := s.sessionTimes[sessionID].Started; !started.IsZero() {
+		session.StartedAt = &started
+	}
+	for i := range session.Participants {
+		p := &session.Participants[i]
+		if !p.IsBot {
+			p.Rating = s.players[p.ID].Rating
+		}
+		p.Requeued = false
+	}
+	sort.Slice(session.Participants, func(i, j int) bool {
+		a, b := session.Participants[i], session.Participants[j]
+		if a.Team != b.Team {
+			return a.Team < b.Team
+		}
+		return a.ID < b.ID
+	})
+	session.SetHeadToHead()
+	session.SetBots()
+	return session, nil
+}
+
+// AddSpectator は確定済みのセッションに観戦者を追加します。
+func (s *MemoryStore) AddSpectator(ctx context.Context, sessionID, playerID string, limit int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return false, model.ErrSessionNotFound
+	}
+	for _, p := range session.Participants {
+		if p.ID == playerID {
+			return false, ErrSpectatorIsParticipant
+		}
+	}
+	if session.Status != model.SessionActive {
+		return false, ErrSessionNotActive
+	}
+	for _, id := range session.Spectators {
+		if id == playerID {
+			return false, nil
+		}
+	}
+	if len(session.Spectators) >= limit {
+		return false, ErrSpectatorLimitReached
+	}
+	session.Spectators = append(session.Spectators, playerID)
+	s.sessions[sessionID] = session
+	return true, nil
+}
+
+// RemoveSpectator はセッションの観戦者を削除します。
+func (s *MemoryStore) RemoveSpectator(ctx context.Context, sessionID, playerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return ErrNotSpectating
+	}
+	for i, id := range session.Spectators {
+		if id == playerID {
+			session.Spectators = append(session.Spectators[:i:i], session.Spectators[i+1:]...)
+			s.sessions[sessionID] = session
+			return nil
+		}
+	}
+	return ErrNotSpectating
+}
+
+// PendingSessions は承諾待ちのセッションを返します。
+func (s *MemoryStore) PendingSessions(ctx context.Context) ([]model.SessionResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sessions []model.SessionResult
+	for _, session := range s.sessions {
+		if session.Status == model.SessionPendingAccept {
+			sessions = append(sessions, model.SessionResult{SessionID: session.SessionID, Status: session.Status, AcceptDeadline: copySession(session).AcceptDeadline})
+		}
+	}
+	return sessions, nil
+}
+
+// ResolveReadyCheck は参加者の承諾状態を記録し、状態が確定すればセッションを更新します。
+func (s *MemoryStore) ResolveReadyCheck(ctx context.Context, sessionID, playerID, state string) (model.SessionResult, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resolveReadyCheck(sessionID, playerID, state)
+}
+
+// resolveReadyCheck は ResolveReadyCheck の処理です。呼び出し元で s.mu をロックしておく必要があります。
+func (s *MemoryStore) resolveReadyCheck(sessionID, playerID, state string) (model.SessionResult, bool, error) {
+	stored, ok := s.sessions[sessionID]
+	if !ok {
+		return model.SessionResult{}, false, model.ErrSessionNotFound
+	}
+	if playerID != "" {
+		found := false
+		for i := range stored.Participants {
+			p := &stored.Participants[i]
+			if p.ID != playerID {
+				continue
+			}
+			found = true
+			// ゲームに現れなかった報告は承諾済みの参加者にも記録する
+			if p.ReadyState == model.ReadyPending || (state == model.ReadyNoShow && p.ReadyState == model.ReadyAccepted) {
+				p.ReadyState = state
+			}
+		}
+		if !found {
+			return model.SessionResult{}, false, model.ErrSessionNotFound
+		}
+		// 既に中止済みのセッションを辞退した場合は、待機キューへ戻されていても取り除く（同時に辞退した場合）
+		if stored.Status == model.SessionAborted && (state == model.ReadyDeclined || state == model.ReadyNoShow) {
+			s.dequeue(playerID, true)
+		}
+	}
+
+	session, err := s.loadSession(sessionID)
+	if err != nil {
+		return model.SessionResult{}, false, err
+	}
+	if !settleReadyCheck(&session, playerID == "") {
+		return session, false, nil
+	}
+
+	now := s.now()
+	switch session.Status {
+	case model.SessionActive:
+		for _, p := range session.Participants {
+			if p.IsBot {
+				continue
+			}
+			profile := s.players[p.ID]
+			profile.GamesPlayed++
+			s.players[p.ID] = profile
+			s.lastPlayed[p.ID] = now
+		}
+		for pair, matchedAt := range s.recent {
+			if matchedAt.Before(now.Add(-s.cfg.RecentOpponentWindow)) {
+				delete(s.recent, pair)
+			}
+		}
+		for _, p := range session.Participants {
+			for _, o := range session.Participants {
+				if p.Team != o.Team && !p.IsBot && !o.IsBot {
+					s.recent[model.OpponentPair(p.ID, o.ID)] = now
+				}
+			}
+		}
+	case model.SessionAborted:
+		// 有効期限は元のエントリのものを引き継ぐ。既に待機キューにいるプレイヤーは上書きしない（INSERT IGNORE と同じ）
+		for _, p := range session.Participants {
+			if _, queued := s.queue[p.ID]; !p.Requeued || queued {
+				continue
+			}
+			s.queue[p.ID] = QueuedPlayer{
+				ID:           p.ID,
+				PartyID:      p.PartyID,
+				GameMode:     session.GameMode,
+				Region:       p.Region,
+				PingMS:       p.PingMS,
+				WaitingSince: p.WaitingSince,
+				ExpiresAt:    p.ExpiresAt,
+				Priority:     p.Priority,
+				RatingRange:  p.RatingRange,
+				Attributes:   p.Attributes,
+				Requeued:     true,
+			}
+		}
+	}
+	stored.Status = session.Status
+	s.sessions[sessionID] = stored
+	if session.Status == model.SessionAborted {
+		times := s.sessionTimes[sessionID]
+		times.Ended = now
+		s.sessionTimes[sessionID] = times
+	}
+	return session, true, nil
+}
+
+// ExpireSessions は startedBefore より前に開始した確定済みのセッションを期限切れにします。
+func (s *MemoryStore) ExpireSessions(ctx context.Context, startedBefore time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, session := range s.sessions {
+		times := s.sessionTimes[id]
+		if session.Status != model.SessionActive || !times.Started.Before(startedBefore) {
+			continue
+		}
+		session.Status = model.SessionExpired
+		s.sessions[id] = session
+		times.Ended = s.now()
+		s.sessionTimes[id] = times
+		n++
+	}
+	return n, nil
+}
+
+// UndeliveredNotifications は createdBefore より前に作成した未通知のマッチング結果を返します。
+func (s *MemoryStore) UndeliveredNotifications(ctx context.Context, createdBefore time.Time) ([]matchNotification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var notifications []matchNotification
+	for id, created := range s.notifications {
+		if created.Before(createdBefore) {
+			notifications = append(notifications, matchNotification{SessionID: id, CreatedAt: created})
+		}
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].CreatedAt.Before(notifications[j].CreatedAt) })
+	return notifications, nil
+}
+
+// MarkNotificationsDelivered はマッチング結果を通知済みにします。
+func (s *MemoryStore) MarkNotificationsDelivered(ctx context.Context, sessionIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range sessionIDs {
+		delete(s.notifications, id)
+	}
+	return nil
+}
+
+// AbortUndeliveredSession は承諾待ち・確定済みのセッションを中止にし、マッチング結果を通知済みにします。
+func (s *MemoryStore) AbortUndeliveredSession(ctx context.Context, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.notifications, sessionID)
+	session, ok := s.sessions[sessionID]
+	if !ok || (session.Status != model.SessionPendingAccept && session.Status != model.SessionActive) {
+		return nil
+	}
+	session.Status = model.SessionAborted
+	s.sessions[sessionID] = session
+	times := s.sessionTimes[sessionID]
+	times.Ended = s.now()
+	s.sessionTimes[sessionID] = times
+	return nil
+}
+
+// DeleteEndedSessions は endedBefore より前に終了したセッションを削除します。
+func (s *MemoryStore) DeleteEndedSessions(ctx context.Context, endedBefore time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, session := range s.sessions {
+		ended := s.sessionTimes[id].Ended
+		if session.Status != model.SessionExpired && session.Status != model.SessionAborted && session.Status != model.SessionCompleted || ended.IsZero() || !ended.Before(endedBefore) {
+			continue
+		}
+		s.forgetSession(id)
+		n++
+	}
+	return n, nil
+}
+
+// DecayInactiveRatings は対戦していないプレイヤーのレーティングを mean へ近づけます。
+func (s *MemoryStore) DecayInactiveRatings(ctx context.Context, inactiveBefore, decayedBefore time.Time, mean int, factor float64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var n int64
+	for id, p := range s.players {
+		played, ok := s.lastPlayed[id]
+		if !ok {
+			played = p.CreatedAt
+		}
+		if !played.Before(inactiveBefore) || p.Rating == mean {
+			continue
+		}
+		if decayed, ok := s.decayed[id]; ok && !decayed.Before(decayedBefore) {
+			continue
+		}
+		p.Rating = decayedRating(p.Rating, mean, factor)
+		s.players[id] = p
+		s.decayed[id] = now
+		n++
+	}
+	return n, nil
+}
+
+// GetServiceState はサービス全体の状態を返します。
+func (s *MemoryStore) GetServiceState(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state[key], nil
+}
+
+// SetServiceState はサービス全体の状態を保存します。
+func (s *MemoryStore) SetServiceState(ctx context.Context, key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state[key] = value
+	return nil
+}
+
+// CompareAndSwapServiceState は key の値が old の場合のみ new に置き換えます。new が空文字の場合はキーを削除します。
+func (s *MemoryStore) CompareAndSwapServiceState(ctx context.Context, key, old, new string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state[key] != old {
+		return false, nil
+	}
+	if new == "" {
+		delete(s.state, key)
+	} else {
+		s.state[key] = new
+	}
+	return true, nil
+}
+
+// BackfillGamesPlayed は確定した（active・expired・completed の）セッションから、プレイヤーID順に対戦数を再計算します。
+func (s *MemoryStore) BackfillGamesPlayed(ctx context.Context, cursor string, limit int) (string, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := s.backfillPlayerIDs(cursor, limit)
+	if len(ids) == 0 {
+		return cursor, 0, nil
+	}
+
+	played := make(map[string]int)
+	for _, session := range s.sessions {
+		if session.Status != model.SessionActive && session.Status != model.SessionExpired && session.Status != model.SessionCompleted {
+			continue
+		}
+		for _, p := range session.Participants {
+			played[p.ID]++
+		}
+	}
+	for _, id := range ids {
+		profile := s.players[id]
+		profile.GamesPlayed = played[id]
+		s.players[id] = profile
+	}
+	return ids[len(ids)-1], len(ids), nil
+}
+
+// DeletePlayers はプレイヤーと、そのプレイヤーに関係する状態を削除します。
+func (s *MemoryStore) DeletePlayers(ctx context.Context, playerIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := make(map[string]bool, len(playerIDs))
+	for _, id := range playerIDs {
+		deleted[id] = true
+		delete(s.players, id)
+		delete(s.queue, id)
+		delete(s.lastPlayed, id)
+		delete(s.decayed, id)
+	}
+	history := s.queueHistory[:0]
+	for _, r := range s.queueHistory {
+		if !deleted[r.PlayerID] {
+			history = append(history, r)
+		}
+	}
+	s.queueHistory = history
+	for id, session := range s.sessions {
+		for _, p := range session.Participants {
+			if deleted[p.ID] {
+				s.forgetSession(id)
+				break
+			}
+		}
+	}
+	for id, session := range s.sessions {
+		spectators := session.Spectators[:0:0]
+		for _, spectator := range session.Spectators {
+			if !deleted[spectator] {
+				spectators = append(spectators, spectator)
+			}
+		}
+		session.Spectators = spectators
+		s.sessions[id] = session
+	}
+	for pair := range s.recent {
+		if deleted[pair[0]] || deleted[pair[1]] {
+			delete(s.recent, pair)
+		}
+	}
+	for pair := range s.blocks {
+		if deleted[pair[0]] || deleted[pair[1]] {
+			delete(s.blocks, pair)
+		}
+	}
+	for pair := range s.headToHead {
+		if deleted[pair[0]] || deleted[pair[1]] {
+			delete(s.headToHead, pair)
+		}
+	}
+	return nil
+}
+
+// QueryDiagnostics は常に空の一覧を返します（SQL を実行しないため実行計画がない）。
+func (s *MemoryStore) QueryDiagnostics(ctx context.Context, limit int) ([]queryDiagnostic, error) {
+	return []queryDiagnostic{}, nil
+}
@@ -0,0 +1,369 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// embeddedMigrations はバイナリに埋め込んだマイグレーションファイルです。実行時にバイナリの横へ migrations/ を置く必要はありません。
+//
+//go:embed migrations/*.sql
+var embeddedMigrations embed.FS
+
+// migrationsDir は embeddedMigrations の中でマイグレーションファイルを置くディレクトリです。
+const migrationsDir = "migrations"
+
+// migrationLockName は複数のインスタンスが同時に起動した場合に、マイグレーションを1つずつ適用するための MySQL のロック名です。
+const migrationLockName = "matchmaking_schema_migrations"
+
+// migrationLockTimeoutSeconds はマイグレーションのロックを待つ最大秒数です。
+const migrationLockTimeoutSeconds = 60
+
+// migrationFilePattern はマイグレーションファイル名の形式（例: 0002_add_bot_columns.sql）です。
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([A-Za-z0-9_]+)\.sql$`)
+
+// migrationDownPattern は直前のステートメントを取り消すステートメントを指定する行（例: -- down: ALTER TABLE t DROP COLUMN c）です。
+var migrationDownPattern = regexp.MustCompile(`(?m)^[ \t]*-- down:[ \t]*(.*?)[ \t;]*\r?$`)
+
+// migration はバージョン番号の付いた1つのマイグレーションファイルです。
+type migration struct {
+	Version    int
+	Name       string
+	Path       string
+	Statements []migrationStatement
+}
+
+// migrationStatement はマイグレーションの1つのステートメントと、それを取り消すステートメント（-- down: で指定）です。
+type migrationStatement struct {
+	SQL  string
+	Down string
+}
+
+// loadMigrations は fsys の dir にあるマイグレーションファイルをバージョン順に返します。
+// 形式に合わない .sql ファイルや重複したバージョン、取り消し方のない DDL はエラーにします（適用漏れを起動時に気付けるようにする）。
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	files, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("マイグレーションディレクトリ読み込みエラー: %v", err)
+	}
+	var migrations []migration
+	seen := make(map[int]string)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".sql") {
+			continue
+		}
+		m := migrationFilePattern.FindStringSubmatch(f.Name())
+		if m == nil {
+			return nil, fmt.Errorf("マイグレーションファイル名が不正です: %s", f.Name())
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("マイグレーションのバージョンが不正です: %s", f.Name())
+		}
+		if prev, ok := seen[version]; ok {
+			return nil, fmt.Errorf("マイグレーションのバージョン %d が重複しています: %s, %s", version, prev, f.Name())
+		}
+		seen[version] = f.Name()
+		p := path.Join(dir, f.Name())
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, fmt.Errorf("マイグレーションファイル読み込みエラー: %v", err)
+		}
+		stmts, err := parseMigration(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("マイグレーション %s: %v", f.Name(), err)
+		}
+		migrations = append(migrations, migration{Version: version, Name: m[2], Path: p, Statements: stmts})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// parseMigration はマイグレーションファイルをステートメントに分割し、-- down: の行をその直前のステートメントに対応付けます。
+// MySQL の DDL は暗黙的にコミットされ、後のステートメントが失敗してもロールバックできないため、複数のステートメントを含む
+// マイグレーションでは、最後のステートメントを除く DDL に -- down: を求めます。ただし CREATE TABLE IF NOT EXISTS は
+// 再実行しても同じ状態になるため（スキーマが一部だけ作成された DB の再起動でそのまま続きを適用できる）、不要です。
+func parseMigration(src string) ([]migrationStatement, error) {
+	var stmts []migrationStatement
+	prev := 0
+	for _, loc := range migrationDownPattern.FindAllStringSubmatchIndex(src, -1) {
+		segment := splitSQLStatements(src[prev:loc[0]])
+		if len(segment) == 0 {
+			return nil, fmt.Errorf("-- down: の前に取り消すステートメントがありません")
+		}
+		for _, stmt := range segment {
+			stmts = append(stmts, migrationStatement{SQL: stmt})
+		}
+		stmts[len(stmts)-1].Down = src[loc[2]:loc[3]]
+		prev = loc[1]
+	}
+	for _, stmt := range splitSQLStatements(src[prev:]) {
+		stmts = append(stmts, migrationStatement{SQL: stmt})
+	}
+
+	for i, stmt := range stmts[:max(len(stmts)-1, 0)] {
+		if stmt.Down == "" && isDDL(stmt.SQL) && !isIdempotentDDL(stmt.SQL) {
+			return nil, fmt.Errorf("ステートメント %d/%d は DDL のため、後のステートメントが失敗した場合に取り消す -- down: が必要です（または DDL ごとにマイグレーションを分けます）: %s", i+1, len(stmts), stmt.SQL)
+		}
+	}
+	return stmts, nil
+}
+
+// isDDL は stmt が暗黙的にコミットされる DDL かどうかを返します。
+func isDDL(stmt string) bool {
+	fields := strings.Fields(stmt)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "CREATE", "ALTER", "DROP", "RENAME", "TRUNCATE":
+		return true
+	}
+	return false
+}
+
+// isIdempotentDDL は stmt が再実行しても同じ状態になる DDL（CREATE TABLE IF NOT EXISTS）かどうかを返します。
+func isIdempotentDDL(stmt string) bool {
+	fields := strings.Fields(strings.ToUpper(stmt))
+	return len(fields) >= 5 && strings.Join(fields[:5], " ") == "CREATE TABLE IF NOT EXISTS"
+}
+
+// migrate は fsys の dir にあるマイグレーションのうち未適用のものをバージョン順に適用し、適用した件数を返します。
+// 適用済みのバージョンは schema_migrations テーブルに記録するため、2回目以降の起動では何も実行しません。
+// DB に、このバイナリが知っている最新のバージョンより新しいマイグレーションが適用されている場合は、
+// 新しいバージョンのバイナリからのロールバックなどで古いスキーマを前提に動作しないよう、エラーにします。
+// マイグレーションのステートメントはトランザクションの中で実行しますが、MySQL の DDL（CREATE / ALTER など）は実行した時点で
+// 暗黙的にコミットされるため、ロールバックできるのは DML だけです。途中で失敗した場合は、実行済みの DDL を -- down: で取り消します。
+func (s *mysqlStore) migrate(ctx context.Context, fsys fs.FS, dir string) (int, error) {
+	migrations, err := loadMigrations(fsys, dir)
+	if err != nil {
+		return 0, err
+	}
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+
+	// ロックは接続ごとに保持されるため、同じ接続で適用する
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrationLockName, migrationLockTimeoutSeconds).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("マイグレーションのロック取得エラー: %v", err)
+	}
+	if locked.Int64 != 1 {
+		return 0, fmt.Errorf("マイグレーションのロックを %d 秒以内に取得できませんでした", migrationLockTimeoutSeconds)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT RELEASE_LOCK(?)", migrationLockName)
+
+	create := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at DATETIME NOT NULL
+	)`
+	if _, err := conn.ExecContext(ctx, create); err != nil {
+		return 0, fmt.Errorf("schema_migrations 作成エラー: %v", err)
+	}
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	current := 0
+	for v := range applied {
+		current = max(current, v)
+	}
+	if current > latest {
+		return 0, fmt.Errorf("DB のスキーマのバージョン %d がこのバイナリの最新のマイグレーション %d より新しいため起動できません", current, latest)
+	}
+
+	n := 0
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		if err := applyMigration(ctx, conn, m); err != nil {
+			return n, err
+		}
+		slog.Info("migration applied", "version", m.Version, "name", m.Name)
+		n++
+	}
+	slog.Info("schema version", "version", latest, "previous_version", current, "applied", n)
+	return n, nil
+}
+
+// appliedMigrations は適用済みのバージョンを返します。
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("適用済みマイグレーション取得エラー: %v", err)
+	}
+	defer rows.Close()
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
+
+// applyMigration は1つのマイグレーションの全ステートメントを実行し、schema_migrations に記録します。
+// ステートメントが失敗した場合は残りを実行せずにロールバックし、実行済みのステートメントを逆順に -- down: で取り消してから、
+// 何番目のステートメントで失敗したかを含むエラーを返します（ログは呼び出し元でエラーとして1回だけ出力します）。
+func applyMigration(ctx context.Context, conn *sql.Conn, m migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for i, stmt := range m.Statements {
+		if _, err := tx.ExecContext(ctx, stmt.SQL); err != nil {
+			tx.Rollback()
+			return revertMigration(ctx, conn, m, i, fmt.Errorf("マイグレーション %d_%s のステートメント %d/%d の実行エラー [%s]: %v", m.Version, m.Name, i+1, len(m.Statements), stmt.SQL, err))
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, NOW())", m.Version, m.Name); err != nil {
+		tx.Rollback()
+		return revertMigration(ctx, conn, m, len(m.Statements), fmt.Errorf("マイグレーション %d_%s の記録エラー: %v", m.Version, m.Name, err))
+	}
+	if err := tx.Commit(); err != nil {
+		return revertMigration(ctx, conn, m, len(m.Statements), fmt.Errorf("マイグレーション %d_%s のコミットエラー: %v", m.Version, m.Name, err))
+	}
+	return nil
+}
+
+// revertMigration は m の先頭から executed 個の実行済みのステートメントを、逆順に -- down: で取り消します。
+// cause に取り消しの結果を加えたエラーを返します。取り消しに失敗した場合は、手作業で戻す必要のあるステートメントを含めます。
+func revertMigration(ctx context.Context, conn *sql.Conn, m migration, executed int, cause error) error {
+	ctx = context.WithoutCancel(ctx)
+	reverted := 0
+	for i := executed - 1; i >= 0; i-- {
+		down := m.Statements[i].Down
+		if down == "" {
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, down); err != nil {
+			return fmt.Errorf("%v（ステートメント 1〜%d の変更が残っています。ステートメント %d の取り消し [%s] の実行エラー: %v）", cause, i+1, i+1, down, err)
+		}
+		reverted++
+	}
+	if reverted == 0 {
+		return cause
+	}
+	return fmt.Errorf("%v（実行済みのステートメント %d 件のうち %d 件を -- down: で取り消しました）", cause, executed, reverted)
+}
+
+// splitSQLStatements は SQL をステートメントごとに分割します。
+// 文字列リテラル・識別子の引用符の中と、コメント（-- / # / /* */）の中の区切り文字では分割しません。
+// mysql クライアントと同じく、行頭の DELIMITER で区切り文字を変更できます（トリガーやストアドプロシージャの本体に ; を含める場合）。
+// コメントのみのステートメントは返しません。
+func splitSQLStatements(src string) []string {
+	var stmts []string
+	var cur strings.Builder
+	hasCode := false
+	delimiter := ";"
+	flush := func() {
+		if stmt := strings.TrimSpace(cur.String()); hasCode && stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+		cur.Reset()
+		hasCode = false
+	}
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		// ステートメントの先頭の DELIMITER 行（サーバには送らない）
+		if !hasCode && (i == 0 || src[i-1] == '\n') {
+			if d, next, ok := parseDelimiterLine(src[i:]); ok {
+				delimiter = d
+				i += next - 1
+				continue
+			}
+		}
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// 引用符の終わりまで（バックスラッシュによるエスケープと引用符の重ね書きを考慮）
+			j := i + 1
+			for j < len(src) {
+				if src[j] == '\\' && c != '`' {
+					j += 2
+					continue
+				}
+				if src[j] == c {
+					if j+1 < len(src) && src[j+1] == c {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			end := min(j+1, len(src))
+			cur.WriteString(src[i:end])
+			hasCode = true
+			i = end - 1
+		case c == '#' || isDashComment(src[i:]):
+			// 行末までのコメント
+			j := strings.IndexByte(src[i:], '\n')
+			if j < 0 {
+				i = len(src)
+			} else {
+				cur.WriteByte('\n')
+				i += j
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			j := strings.Index(src[i+2:], "*/")
+			if j < 0 {
+				i = len(src)
+			} else {
+				cur.WriteByte(' ')
+				i += j + 3
+			}
+		case strings.HasPrefix(src[i:], delimiter):
+			flush()
+			i += len(delimiter) - 1
+		default:
+			cur.WriteByte(c)
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				hasCode = true
+			}
+		}
+	}
+	flush()
+	return stmts
+}
+
+// isDashComment は s が -- で始まるコメントかどうかを返します。MySQL では -- の後に空白か改行が必要です。
+func isDashComment(s string) bool {
+	if !strings.HasPrefix(s, "--") {
+		return false
+	}
+	return len(s) == 2 || strings.ContainsRune(" \t\r\n", rune(s[2]))
+}
+
+// parseDelimiterLine は s の先頭（空白を除く）が DELIMITER 行であれば、新しい区切り文字と行末までの長さを返します。
+func parseDelimiterLine(s string) (string, int, bool) {
+	end := strings.IndexByte(s, '\n')
+	if end < 0 {
+		end = len(s)
+	}
+	fields := strings.Fields(s[:end])
+	if len(fields) != 2 || !strings.EqualFold(fields[0], "DELIMITER") {
+		return "", 0, false
+	}
+	return fields[1], end, true
+}
@@ -0,0 +1,271 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// migrationDB は schema_migrations に記録したバージョンと、DDL で作成・変更したテーブルの列を保持する fakeDB です。
+type migrationDB struct {
+	*fakeDB
+	mu      sync.Mutex
+	applied []int64
+	// tables はテーブルごとの列です。MySQL の DDL と同じく、実行した時点で反映します（ROLLBACK では戻りません）。
+	tables map[string]map[string]bool
+}
+
+// schemaStatementPattern は migrationDB がテーブルの列に反映する DDL の形式です。
+var schemaStatementPattern = regexp.MustCompile(`^(CREATE|DROP) TABLE (?:IF (?:NOT )?EXISTS )?(\w+)|^ALTER TABLE (\w+) (ADD|DROP) COLUMN (\w+)`)
+
+// applyDDL は q が CREATE TABLE・DROP TABLE・ALTER TABLE の ADD COLUMN・DROP COLUMN の場合にテーブルの列に反映します。
+func (m *migrationDB) applyDDL(q string) {
+	match := schemaStatementPattern.FindStringSubmatch(q)
+	if match == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case match[1] == "CREATE":
+		m.tables[match[2]] = map[string]bool{}
+	case match[1] == "DROP":
+		delete(m.tables, match[2])
+	case match[4] == "ADD":
+		if m.tables[match[3]] == nil {
+			m.tables[match[3]] = map[string]bool{}
+		}
+		m.tables[match[3]][match[5]] = true
+	default:
+		delete(m.tables[match[3]], match[5])
+	}
+}
+
+// newMigrationDB は migrationDB を返します。failOn を含むステートメントは失敗します（空文字の場合は失敗しません）。
+func newMigrationDB(failOn string) *migrationDB {
+	m := &migrationDB{tables: map[string]map[string]bool{"players": {"id": true}}}
+	m.fakeDB = &fakeDB{
+		query: func(q string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			switch {
+			case strings.Contains(q, "GET_LOCK"):
+				return []string{"locked"}, [][]driver.Value{{int64(1)}}, nil
+			case strings.Contains(q, "FROM schema_migrations"):
+				m.mu.Lock()
+				defer m.mu.Unlock()
+				rows := make([][]driver.Value, len(m.applied))
+				for i, v := range m.applied {
+					rows[i] = []driver.Value{v}
+				}
+				return []string{"version"}, rows, nil
+			}
+			return nil, nil, nil
+		},
+		exec: func(q string, args []driver.Value) error {
+			if failOn != "" && strings.Contains(q, failOn) {
+				return errors.New("syntax error near " + failOn)
+			}
+			if strings.Contains(q, "INSERT INTO schema_migrations") {
+				m.mu.Lock()
+				defer m.mu.Unlock()
+				m.applied = append(m.applied, args[0].(int64))
+			}
+			m.applyDDL(q)
+			return nil
+		},
+	}
+	return m
+}
+
+var testMigrations = fstest.MapFS{
+	"migrations/0001_initial.sql":    {Data: []byte("CREATE TABLE IF NOT EXISTS a (id INT);\n")},
+	"migrations/0002_add_column.sql": {Data: []byte("-- ; を含むコメント\nALTER TABLE a ADD COLUMN note VARCHAR(8) DEFAULT 'x;y';\n")},
+}
+
+func TestMigrateTwiceIsNoOp(t *testing.T) {
+	db := newMigrationDB("")
+	s := newFakeMySQLStore(t, db.fakeDB)
+	ctx := context.Background()
+
+	n, err := s.migrate(ctx, testMigrations, "migrations")
+	if err != nil || n != 2 {
+		t.Fatalf("first migrate = %d, %v, want 2 migrations applied", n, err)
+	}
+	if !slices.Equal(db.applied, []int64{1, 2}) {
+		t.Fatalf("recorded versions = %v, want [1 2]", db.applied)
+	}
+	first := len(db.queries())
+
+	n, err = s.migrate(ctx, testMigrations, "migrations")
+	if err != nil || n != 0 {
+		t.Fatalf("second migrate = %d, %v, want nothing applied", n, err)
+	}
+	for _, q := range db.queries()[first:] {
+		if strings.Contains(q, "TABLE a") || strings.Contains(q, "INSERT INTO schema_migrations") {
+			t.Errorf("second migrate ran %q", q)
+		}
+	}
+}
+
+func TestMigrateRejectsNewerSchema(t *testing.T) {
+	db := newMigrationDB("")
+	db.applied = []int64{1, 2, 3}
+	s := newFakeMySQLStore(t, db.fakeDB)
+	if _, err := s.migrate(context.Background(), testMigrations, "migrations"); err == nil {
+		t.Fatal("migrate succeeded against a schema newer than the binary")
+	}
+}
+
+// 3つのステートメントのうち2つ目が失敗した場合は、3つ目を実行せず、実行済みの1つ目を -- down: で取り消して、失敗した位置をエラーに含める
+func TestMigrationFailureRevertsExecutedStatements(t *testing.T) {
+	db := newMigrationDB("BROKEN")
+	s := newFakeMySQLStore(t, db.fakeDB)
+	migrations := fstest.MapFS{
+		"migrations/0001_match_history.sql": {Data: []byte(`CREATE TABLE match_history (id INT);
+-- down: DROP TABLE match_history;
+
+ALTER TABLE match_history ADD COLUMN BROKEN;
+-- down: ALTER TABLE match_history DROP COLUMN BROKEN;
+
+ALTER TABLE players ADD COLUMN note INT;
+`)},
+	}
+
+	n, err := s.migrate(context.Background(), migrations, "migrations")
+	if err == nil || n != 0 {
+		t.Fatalf("migrate = %d, %v, want an error", n, err)
+	}
+	if !strings.Contains(err.Error(), "2/3") {
+		t.Errorf("error %q does not name the failing statement", err)
+	}
+	if len(db.applied) != 0 {
+		t.Errorf("recorded versions = %v, want none", db.applied)
+	}
+
+	// 1つ目で作成したテーブルは取り消され、3つ目の列は追加されていない
+	if _, ok := db.tables["match_history"]; ok {
+		t.Errorf("match_history still exists after the failed migration")
+	}
+	if db.tables["players"]["note"] {
+		t.Errorf("players.note was added by the statement after the failing one")
+	}
+
+	queries := db.queries()
+	if slices.ContainsFunc(queries, func(q string) bool { return strings.Contains(q, "note") }) {
+		t.Errorf("statements = %q, want the third statement never run", queries)
+	}
+	broken := slices.Index(queries, "ALTER TABLE match_history ADD COLUMN BROKEN")
+	down := slices.Index(queries, "DROP TABLE match_history")
+	if broken < 0 || down < broken {
+		t.Fatalf("statements = %q, want the down statement after the failing one", queries)
+	}
+	if !slices.Contains(queries[broken:down], "ROLLBACK") {
+		t.Errorf("statements = %q, want ROLLBACK before reverting", queries)
+	}
+	// 失敗したステートメントは実行されていないため、その -- down: は実行しない
+	if slices.Contains(queries, "ALTER TABLE match_history DROP COLUMN BROKEN") {
+		t.Errorf("statements = %q, want no down statement for the failing one", queries)
+	}
+}
+
+func TestParseMigrationRequiresDownForEarlierDDL(t *testing.T) {
+	for _, tc := range []struct {
+		name, src string
+		ok        bool
+	}{
+		{"single DDL", "ALTER TABLE a ADD COLUMN b INT;", true},
+		{"DDL without down", "ALTER TABLE a ADD COLUMN b INT;\nALTER TABLE a ADD COLUMN c INT;", false},
+		{"DDL with down", "ALTER TABLE a ADD COLUMN b INT;\n-- down: ALTER TABLE a DROP COLUMN b\nALTER TABLE a ADD COLUMN c INT;", true},
+		{"idempotent create", "CREATE TABLE IF NOT EXISTS a (id INT);\nCREATE TABLE IF NOT EXISTS b (id INT);", true},
+		{"DML before DDL", "UPDATE a SET b = 1;\nALTER TABLE a ADD COLUMN c INT;", true},
+		{"down without statement", "-- down: DROP TABLE a;\nCREATE TABLE a (id INT);", false},
+	} {
+		stmts, err := parseMigration(tc.src)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: parseMigration = %+v, %v, want ok=%v", tc.name, stmts, err, tc.ok)
+		}
+	}
+}
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	migrations, err := loadMigrations(embeddedMigrations, migrationsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		for i, stmt := range m.Statements {
+			if stmt.Down != "" && !isDDL(stmt.Down) {
+				t.Errorf("%d_%s statement %d: down %q is not DDL", m.Version, m.Name, i+1, stmt.Down)
+			}
+		}
+	}
+}
+
+func TestSplitSQLStatements(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"semicolon in a default value", "CREATE TABLE a (note VARCHAR(8) DEFAULT 'a;b');\nSELECT 1;",
+			[]string{"CREATE TABLE a (note VARCHAR(8) DEFAULT 'a;b')", "SELECT 1"}},
+		{"escaped quotes", `INSERT INTO a VALUES ('it''s;', "x\";y");`,
+			[]string{`INSERT INTO a VALUES ('it''s;', "x\";y")`}},
+		{"inline comment", "CREATE TABLE a (id INT); -- trailing; comment\nSELECT 1; # another; one",
+			[]string{"CREATE TABLE a (id INT)", "SELECT 1"}},
+		{"block comment", "CREATE /* ; */ TABLE a (id INT);",
+			[]string{"CREATE   TABLE a (id INT)"}},
+		// MySQL では -- の後に空白がなければコメントではない
+		{"minus minus without space", "SELECT 1--1;",
+			[]string{"SELECT 1--1"}},
+		{"comment-only statement", "-- nothing here;\n;SELECT 1;",
+			[]string{"SELECT 1"}},
+		{"delimiter block", "DELIMITER $$\nCREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN SET NEW.id = 1; SET NEW.note = 'x'; END$$\nDELIMITER ;\nSELECT 1;",
+			[]string{"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN SET NEW.id = 1; SET NEW.note = 'x'; END", "SELECT 1"}},
+	} {
+		if got := splitSQLStatements(tc.src); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// マイグレーションの ; を含む文字列リテラルとトリガーの本体は、1つのステートメントとして DB に送る
+func TestMigrateKeepsQuotedSemicolonsAndTriggers(t *testing.T) {
+	logs := captureDefaultLogs(t)
+	db := newMigrationDB("")
+	s := newFakeMySQLStore(t, db.fakeDB)
+	migrations := fstest.MapFS{
+		"migrations/0001_initial.sql":    testMigrations["migrations/0001_initial.sql"],
+		"migrations/0002_add_column.sql": testMigrations["migrations/0002_add_column.sql"],
+		"migrations/0003_trigger.sql":    {Data: []byte("DELIMITER $$\nCREATE TRIGGER a_note BEFORE INSERT ON a FOR EACH ROW BEGIN SET NEW.note = 'a;b'; END$$\nDELIMITER ;\n")},
+	}
+	if _, err := s.migrate(context.Background(), migrations, "migrations"); err != nil {
+		t.Fatal(err)
+	}
+	queries := db.queries()
+	for _, want := range []string{
+		"ALTER TABLE a ADD COLUMN note VARCHAR(8) DEFAULT 'x;y'",
+		"CREATE TRIGGER a_note BEFORE INSERT ON a FOR EACH ROW BEGIN SET NEW.note = 'a;b'; END",
+	} {
+		if !slices.Contains(queries, want) {
+			t.Errorf("statements = %q, want %q", queries, want)
+		}
+	}
+	for _, q := range queries {
+		if strings.Contains(q, "DELIMITER") {
+			t.Errorf("sent %q to the server", q)
+		}
+	}
+	if !slices.Equal(db.applied, []int64{1, 2, 3}) {
+		t.Fatalf("recorded versions = %v, want [1 2 3]", db.applied)
+	}
+	// 起動時にスキーマのバージョンをログに出力する
+	if !strings.Contains(logs.String(), `"msg":"schema version","version":3,"previous_version":0,"applied":3`) {
+		t.Errorf("logs = %s, want the schema version", logs.String())
+	}
+}
@@ -0,0 +1,73 @@
+-- 初期スキーマ。schema_migrations の導入前に schema.sql で作成した DB にもそのまま適用できるよう、IF NOT EXISTS を付けている
+
+-- プレイヤー情報用テーブル（レーティングはサーバ側で管理する）
+CREATE TABLE IF NOT EXISTS players (
+    player_id VARCHAR(64) PRIMARY KEY,
+    rating INT NOT NULL,
+    games_played INT NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL
+);
+
+-- 待機プレイヤー用テーブル
+CREATE TABLE IF NOT EXISTS matchmaking_queue (
+    player_id VARCHAR(64) PRIMARY KEY, -- 同一プレイヤーの二重登録を防ぐ
+    party_id VARCHAR(64) NULL, -- パーティで参加している場合のパーティID（ソロの場合は NULL）
+    region VARCHAR(32) NOT NULL DEFAULT '', -- 空文字は global（どの地域ともマッチング可能）
+    game_mode VARCHAR(32) NOT NULL DEFAULT 'duel',
+    waiting_since DATETIME,
+    expires_at DATETIME NULL, -- クライアントが応答可能な期限（申告された有効期間とサーバの上限の短い方）。過ぎたエントリは削除する
+    requeued BOOLEAN NOT NULL DEFAULT FALSE, -- 中止されたセッションから戻されたエントリ（POST /matchmaking で待機を再開できる）
+    INDEX idx_party_id (party_id)
+);
+
+-- セッション情報用テーブル
+CREATE TABLE IF NOT EXISTS sessions (
+    session_id VARCHAR(64) PRIMARY KEY,
+    game_mode VARCHAR(32) NOT NULL DEFAULT 'duel',
+    region VARCHAR(32) NOT NULL DEFAULT '', -- セッションを実行する地域（空文字は global）
+    match_quality INT, -- マッチング時点の品質スコア (0〜100)
+    status VARCHAR(32) NOT NULL DEFAULT 'pending_accept', -- pending_accept / active / aborted
+    accept_deadline DATETIME NULL, -- 参加者全員が承諾しなければならない期限
+    start_time DATETIME
+);
+
+-- セッションの参加プレイヤー用テーブル（team は 1 始まりのチーム番号）
+CREATE TABLE IF NOT EXISTS session_players (
+    session_id VARCHAR(64),
+    player_id VARCHAR(64),
+    team INT,
+    party_id VARCHAR(64) NULL,
+    region VARCHAR(32) NOT NULL DEFAULT '',
+    waiting_since DATETIME, -- 中止時に待機キューへ戻す際の元の待機開始時刻
+    expires_at DATETIME NULL, -- 中止時に待機キューへ戻す際の元の有効期限
+    ready_state VARCHAR(16) NOT NULL DEFAULT 'pending', -- pending / accepted / declined
+    is_bot BOOLEAN NOT NULL DEFAULT FALSE, -- 待機時間が長いプレイヤーの相手として生成したボット（players には登録しない）
+    bot_rating INT NULL, -- ボットのレーティング
+    PRIMARY KEY (session_id, player_id)
+);
+
+-- 最近の対戦相手用テーブル（直後の再戦を避けるため）
+CREATE TABLE IF NOT EXISTS recent_matches (
+    player_id VARCHAR(64),
+    opponent_id VARCHAR(64),
+    matched_at DATETIME NOT NULL,
+    PRIMARY KEY (player_id, opponent_id)
+);
+
+-- サービス全体の状態を保存する KV テーブル（バックフィルのチェックポイントなど）
+CREATE TABLE IF NOT EXISTS service_state (
+    state_key VARCHAR(128) PRIMARY KEY,
+    state_value TEXT NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+-- 遅いクエリの実行計画（EXPLAIN FORMAT=JSON）。機能フラグ explain_capture が有効な間のみ保存する
+CREATE TABLE IF NOT EXISTS query_diagnostics (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    query_name VARCHAR(64) NOT NULL,
+    statement TEXT NOT NULL,
+    duration_ms DOUBLE NOT NULL,
+    plan TEXT NOT NULL,
+    captured_at DATETIME NOT NULL,
+    INDEX idx_captured_at (captured_at)
+);
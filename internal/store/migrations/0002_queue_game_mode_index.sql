@@ -0,0 +1,2 @@
+-- 待機キューでの順番（GET /matchmaking/status）をゲームモードごとに数えるためのインデックス
+CREATE INDEX idx_game_mode_waiting_since ON matchmaking_queue (game_mode, waiting_since);
@@ -0,0 +1,9 @@
+-- セッションの終了時刻。期限切れ（expired）・中止（aborted）になった時刻を記録し、保存期間を過ぎたセッションの削除に使う
+ALTER TABLE sessions ADD COLUMN ended_at DATETIME NULL;
+-- down: ALTER TABLE sessions DROP COLUMN ended_at;
+
+-- 既存の中止済みセッションは終了時刻が分からないため、開始時刻を終了時刻とみなす
+UPDATE sessions SET ended_at = start_time WHERE status = 'aborted' AND ended_at IS NULL;
+
+-- 期限切れにする確定済みセッションの検索用
+CREATE INDEX idx_status_start_time ON sessions (status, start_time);
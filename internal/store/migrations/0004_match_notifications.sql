@@ -0,0 +1,8 @@
+-- マッチング結果の通知のアウトボックス。セッションと同じトランザクションで登録し、待機中のクライアントへ通知できたら delivered_at を記録する。
+-- コミット後・通知前にプロセスが停止した場合は、起動後に未通知の行から通知し直す（古すぎる場合はセッションを中止する）
+CREATE TABLE IF NOT EXISTS match_notifications (
+    session_id VARCHAR(64) PRIMARY KEY,
+    created_at DATETIME NOT NULL,
+    delivered_at DATETIME NULL,
+    INDEX idx_delivered_at_created_at (delivered_at, created_at)
+);
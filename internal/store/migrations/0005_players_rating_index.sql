@@ -0,0 +1,2 @@
+-- GET /leaderboard（レーティングの高い順）用
+CREATE INDEX idx_rating_player_id ON players (rating DESC, player_id ASC);
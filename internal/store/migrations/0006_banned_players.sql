@@ -0,0 +1,7 @@
+-- マッチングへの参加を禁止したプレイヤー。until が NULL の場合は無期限。待機キューへの登録時に主キーで確認する
+CREATE TABLE IF NOT EXISTS banned_players (
+    player_id VARCHAR(64) PRIMARY KEY,
+    until DATETIME NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL
+);
@@ -0,0 +1,6 @@
+-- マッチングの優先度（0〜10）。値が大きいエントリから先に相手を探す
+ALTER TABLE matchmaking_queue ADD COLUMN priority INT NOT NULL DEFAULT 0;
+-- down: ALTER TABLE matchmaking_queue DROP COLUMN priority;
+
+-- 中止されたセッションから待機キューへ戻す際に優先度を引き継ぐ
+ALTER TABLE session_players ADD COLUMN priority INT NOT NULL DEFAULT 0;
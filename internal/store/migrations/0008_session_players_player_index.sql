@@ -0,0 +1,2 @@
+-- 再接続したプレイヤーの成立済みセッションの検索用（GET /matchmaking/result）
+CREATE INDEX idx_player_id ON session_players (player_id);
@@ -0,0 +1,5 @@
+-- ランキングの同順位を対戦数の多い順・プレイヤーID順に並べるため、0005 のインデックスを置き換える
+-- （1つの ALTER TABLE で行い、途中で失敗しても再実行できるようにする）
+ALTER TABLE players
+    DROP INDEX idx_rating_player_id,
+    ADD INDEX idx_rating_games_played_player_id (rating DESC, games_played DESC, player_id ASC);
@@ -0,0 +1,7 @@
+-- マッチング時点の対戦の質の指標（マッチングのチューニング用。GET /admin/stats/match-quality で集計する）
+ALTER TABLE sessions
+    ADD COLUMN rating_gap INT NULL, -- チーム平均レーティングの最大差
+    ADD COLUMN win_probability DOUBLE NULL, -- 平均レーティングが最も高いチームの Elo の式による期待勝率
+    ADD COLUMN max_wait_seconds DOUBLE NULL, -- ボットを除く参加者の待機時間の最大
+    ADD COLUMN min_wait_seconds DOUBLE NULL, -- ボットを除く参加者の待機時間の最小
+    ADD INDEX idx_start_time (start_time);
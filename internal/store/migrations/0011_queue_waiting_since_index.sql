@@ -0,0 +1,2 @@
+-- マッチングで待機開始の古い順に MATCH_BATCH_SIZE 人だけをロックして取得する（LIMIT ... FOR UPDATE）ためのインデックス
+CREATE INDEX idx_waiting_since_player_id ON matchmaking_queue (waiting_since, player_id);
@@ -0,0 +1,6 @@
+-- クライアントが申告したゲームサーバまでの ping（ミリ秒、0 は未計測）。ゲームモードの max_ping_ms を超える組み合わせを避ける
+ALTER TABLE matchmaking_queue ADD COLUMN ping_ms INT NOT NULL DEFAULT 0;
+-- down: ALTER TABLE matchmaking_queue DROP COLUMN ping_ms;
+
+-- 中止されたセッションから待機キューへ戻す際に ping を引き継ぐ
+ALTER TABLE session_players ADD COLUMN ping_ms INT NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+-- プレイヤーがマッチングを拒否した相手。どちらか一方が登録していれば、その2人は同じロビーに入れない
+-- マッチングのたびに待機中のプレイヤーについて player_id と blocked_id の両方の IN で取得する
+CREATE TABLE IF NOT EXISTS blocked_pairs (
+    player_id VARCHAR(64) NOT NULL,
+    blocked_id VARCHAR(64) NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (player_id, blocked_id),
+    INDEX idx_blocked_pairs_blocked (blocked_id)
+);
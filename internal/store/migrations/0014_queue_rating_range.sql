@@ -0,0 +1,12 @@
+-- クライアントが指定した相手のレーティングの範囲（0 は制限なし）。待機時間に関係なく、範囲外の相手とは組ませない
+ALTER TABLE matchmaking_queue
+    ADD COLUMN min_rating INT NOT NULL DEFAULT 0,
+    ADD COLUMN max_rating INT NOT NULL DEFAULT 0,
+    ADD COLUMN max_rating_delta INT NOT NULL DEFAULT 0;
+-- down: ALTER TABLE matchmaking_queue DROP COLUMN min_rating, DROP COLUMN max_rating, DROP COLUMN max_rating_delta;
+
+-- 中止されたセッションから待機キューへ戻す際にレーティングの範囲を引き継ぐ
+ALTER TABLE session_players
+    ADD COLUMN min_rating INT NOT NULL DEFAULT 0,
+    ADD COLUMN max_rating INT NOT NULL DEFAULT 0,
+    ADD COLUMN max_rating_delta INT NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- SessionAllocator が割り当てたゲームサーバの接続先（割り当てなしの場合は NULL）
+ALTER TABLE sessions
+    ADD COLUMN game_server_host VARCHAR(255) NULL,
+    ADD COLUMN game_server_port INT NULL;
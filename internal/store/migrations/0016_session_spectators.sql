@@ -0,0 +1,8 @@
+-- 確定済みのセッションの観戦者（大会の配信画面などから接続する。参加者は登録しない）
+CREATE TABLE IF NOT EXISTS session_spectators (
+    session_id VARCHAR(64) NOT NULL,
+    player_id VARCHAR(64) NOT NULL,
+    added_at DATETIME NOT NULL,
+    PRIMARY KEY (session_id, player_id),
+    INDEX idx_session_spectators_player (player_id)
+);
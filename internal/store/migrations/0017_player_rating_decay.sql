@@ -0,0 +1,12 @@
+-- 非アクティブなプレイヤーのレーティングの減衰用。last_played_at はセッションが確定した時刻、rating_decayed_at は最後に減衰した時刻
+ALTER TABLE players
+    ADD COLUMN last_played_at DATETIME NULL,
+    ADD COLUMN rating_decayed_at DATETIME NULL;
+-- down: ALTER TABLE players DROP COLUMN last_played_at, DROP COLUMN rating_decayed_at;
+
+-- 既存のプレイヤーは確定済み・期限切れのセッションのうち最も新しい開始時刻から始める（セッションがなければ created_at を使う）
+UPDATE players SET last_played_at = (
+    SELECT MAX(s.start_time) FROM session_players sp
+    JOIN sessions s ON s.session_id = sp.session_id
+    WHERE sp.player_id = players.player_id AND s.status IN ('active', 'expired')
+);
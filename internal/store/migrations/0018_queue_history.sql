@@ -0,0 +1,13 @@
+-- 待機の公平性の監査用。待機キューに登録したプレイヤーごとに、待機が終わった（マッチング成立・タイムアウト・キャンセル）時点で1行記録する
+CREATE TABLE IF NOT EXISTS queue_history (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    player_id VARCHAR(64) NOT NULL,
+    rating INT NOT NULL,
+    game_mode VARCHAR(64) NOT NULL,
+    enqueued_at DATETIME(3) NOT NULL,
+    resolved_at DATETIME(3) NOT NULL,
+    outcome ENUM('matched', 'timed_out', 'cancelled') NOT NULL,
+    INDEX idx_queue_history_resolved_at (resolved_at),
+    INDEX idx_queue_history_rating (rating),
+    INDEX idx_queue_history_player (player_id)
+);
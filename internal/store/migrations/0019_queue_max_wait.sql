@@ -0,0 +1,3 @@
+-- クライアントが指定した待機時間（秒、0 はゲームモードの待機時間）。GET /admin/queue で確認するためだけに保存する
+ALTER TABLE matchmaking_queue
+    ADD COLUMN max_wait_seconds INT NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- ゲームサーバがセッションへの参加を確認するための署名付きトークン（MATCH_TOKEN_SECRET が未設定の場合は NULL）
+ALTER TABLE sessions
+    ADD COLUMN match_token VARCHAR(1024) NULL;
@@ -0,0 +1,8 @@
+-- クライアントが指定したプレイヤーの属性（JSON、MATCH_ATTRIBUTE_KEYS のキーは値が一致するプレイヤー同士でのみマッチングする）
+-- 中止されたセッションから待機キューへ戻す際に引き継ぐため、session_players にも保存する
+ALTER TABLE matchmaking_queue
+    ADD COLUMN attributes JSON NULL;
+-- down: ALTER TABLE matchmaking_queue DROP COLUMN attributes;
+
+ALTER TABLE session_players
+    ADD COLUMN attributes JSON NULL;
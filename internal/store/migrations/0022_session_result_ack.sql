@@ -0,0 +1,4 @@
+-- プレイヤーが成立済みのセッションの結果を受け取った時刻（DELETE /matchmaking/{player_id}/current）
+-- 記録したセッションは MATCH_RESULT_WINDOW 以内でも再接続したプレイヤーに返さない
+ALTER TABLE session_players
+    ADD COLUMN result_acked_at DATETIME NULL;
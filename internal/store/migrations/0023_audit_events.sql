@@ -0,0 +1,12 @@
+-- コンプライアンス向けの監査イベント。追記のみで、更新・削除しない
+-- 待機キューへの登録・マッチング成立・キャンセル・参加禁止・管理者による強制マッチングなどを、操作した主体とともに記録する
+CREATE TABLE IF NOT EXISTS audit_events (
+    event_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    occurred_at DATETIME(3) NOT NULL,
+    actor VARCHAR(128) NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    subject_player_id VARCHAR(64) NULL,
+    session_id VARCHAR(64) NULL,
+    details JSON NULL,
+    INDEX idx_audit_events_occurred_at (occurred_at)
+);
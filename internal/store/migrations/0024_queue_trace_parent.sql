@@ -0,0 +1,4 @@
+-- 待機キューへ登録したリクエストのスパンの文脈（W3C traceparent）。マッチングのスパンから登録リクエストのトレースをたどるために保存する
+-- トレースしていないリクエストと、中止されたセッションから戻されたエントリは NULL
+ALTER TABLE matchmaking_queue
+    ADD COLUMN trace_parent VARCHAR(64) NULL;
@@ -0,0 +1,6 @@
+-- マッチング成立後に辞退した、またはゲームに現れなかったプレイヤーのクールダウン。
+-- cooldown_until までは待機キューへ登録できない。cooldown_offenses は last_offense_at から MATCH_COOLDOWN_RESET 以内に続いた違反の回数
+ALTER TABLE players
+    ADD COLUMN cooldown_until DATETIME NULL,
+    ADD COLUMN cooldown_offenses INT NOT NULL DEFAULT 0,
+    ADD COLUMN last_offense_at DATETIME NULL;
@@ -0,0 +1,8 @@
+-- POST /matchmaking の Idempotency-Key ごとのリクエストの状態（処理中・保存したレスポンス）。
+-- インスタンスをまたいだ再送にも同じレスポンスを返すため、プロセスではなく DB に保存する。expires_at を過ぎた行はレスポンスを保存するたびに削除する
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    idempotency_key CHAR(64) PRIMARY KEY,
+    state MEDIUMTEXT NOT NULL,
+    expires_at DATETIME(3) NOT NULL,
+    INDEX idx_idempotency_keys_expires_at (expires_at)
+);
@@ -0,0 +1,2 @@
+-- ゲームサーバから報告された対戦結果。勝利したチームの番号（1 始まり）で、結果が報告されていないセッションは NULL
+ALTER TABLE sessions ADD COLUMN winning_team INT NULL;
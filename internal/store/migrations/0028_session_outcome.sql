@@ -0,0 +1,2 @@
+-- 報告された対戦結果の種類（win・draw・cancelled）。結果が報告されていないセッションは NULL
+ALTER TABLE sessions ADD COLUMN outcome VARCHAR(16) NULL;
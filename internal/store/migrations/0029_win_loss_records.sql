@@ -0,0 +1,17 @@
+-- 報告された対戦結果から集計したプレイヤーの勝ち・負け・引き分けの数。結果の報告を始める前のセッションは backfill wins_losses で反映する
+ALTER TABLE players
+    ADD COLUMN wins INT NOT NULL DEFAULT 0,
+    ADD COLUMN losses INT NOT NULL DEFAULT 0,
+    ADD COLUMN draws INT NOT NULL DEFAULT 0;
+-- down: ALTER TABLE players DROP COLUMN wins, DROP COLUMN losses, DROP COLUMN draws;
+
+-- プレイヤー（player_id）から見た相手（opponent_id）ごとの対戦成績。2人の組み合わせごとに両方向の行を保存する。
+-- 過去のセッションは backfill head_to_head で反映する
+CREATE TABLE IF NOT EXISTS head_to_head (
+    player_id VARCHAR(64) NOT NULL,
+    opponent_id VARCHAR(64) NOT NULL,
+    wins INT NOT NULL DEFAULT 0,
+    losses INT NOT NULL DEFAULT 0,
+    draws INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (player_id, opponent_id)
+);
@@ -0,0 +1,1571 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/ratelimit"
+)
+
+// mysqlErrDuplicateEntry は一意制約違反を表す MySQL のエラー番号です。
+const mysqlErrDuplicateEntry = 1062
+
+// 再試行すれば成功しうる MySQL のエラー番号です。いずれもトランザクションはロールバックされています。
+const (
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrDeadlock        = 1213
+)
+
+// DB 接続の設定
+const (
+	// dbConnectAttempts は起動時に DB へ接続を試みる最大回数です。
+	dbConnectAttempts = 10
+	// dbConnectMaxBackoff は起動時の接続再試行の最大待機間隔です。
+	dbConnectMaxBackoff = 30 * time.Second
+	// dbPingTimeout は起動時の1回の接続確認にかける時間の上限です（応答しない MySQL で起動が止まらないようにする）。
+	dbPingTimeout = 5 * time.Second
+)
+
+// mysqlStore は MySQL に状態を保存する Store です。
+type mysqlStore struct {
+	DB  *sql.DB
+	cfg Config
+	// explainBudget は遅いクエリの EXPLAIN を取得する回数の上限です。nil の場合は取得しません。
+	explainBudget *ratelimit.RateLimiter
+	// externalQueue は待機キューを MySQL 以外（redisStore）で管理していることを表します。
+	// true の場合、承諾の確定時に matchmaking_queue へ戻す・取り除く処理を行いません。
+	externalQueue bool
+	// leader はマッチングを行うインスタンスを決めるロックです（Config.LeaderElection）。nil の場合は常にマッチングします。
+	leader *mysqlLeaderLock
+}
+
+// sqlQueryer は *sql.DB と *sql.Tx に共通するメソッドです。
+type sqlQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// NewMySQLStore は MySQL への接続を初期化し、埋め込んだマイグレーション（embeddedMigrations）のうち未適用のものを適用します。
+// 起動直後は MySQL の準備ができていないことがあるため、指数バックオフで接続を再試行します。
+func NewMySQLStore(cfg Config) (*mysqlStore, error) {
+	db, err := sql.Open("mysql", cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("DB接続エラー: %v", err)
+	}
+	// 接続プールの設定（MySQL 側で切断された古い接続を使い続けないよう寿命を設定する）
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), dbPingTimeout)
+		err = db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			break
+		}
+		if attempt >= dbConnectAttempts {
+			db.Close()
+			return nil, fmt.Errorf("DB Pingエラー（%d回試行）: %v", attempt, err)
+		}
+		wait := model.BackoffDelay(attempt, 500*time.Millisecond, dbConnectMaxBackoff)
+		slog.Warn("DB接続を再試行します", "attempt", attempt, "wait", wait.String(), "error", err)
+		time.Sleep(wait)
+	}
+
+	s := &mysqlStore{DB: db, cfg: cfg, explainBudget: ratelimit.New(cfg.ExplainCaptureBudget, time.Now)}
+	if cfg.LeaderElection {
+		s.leader = newMySQLLeaderLock(db)
+	}
+	if _, err := s.migrate(context.Background(), embeddedMigrations, migrationsDir); err != nil {
+		db.Close()
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dbPingTimeout)
+	s.warnClockSkew(ctx)
+	cancel()
+	return s, nil
+}
+
+// Ping は DB に接続できるかを確認します。
+func (s *mysqlStore) Ping(ctx context.Context) error {
+	return s.DB.PingContext(ctx)
+}
+
+// Close は DB 接続プールを閉じます。
+func (s *mysqlStore) Close() error {
+	if s.leader != nil {
+		s.leader.release()
+	}
+	return s.DB.Close()
+}
+
+// isDuplicateEntry は err が MySQL の一意制約違反かどうかを判定します。
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry
+}
+
+// isTransientDBError は err が再試行すれば成功しうる DB のエラー（切断された接続、デッドロック、ロック待ちのタイムアウト）かどうかを判定します。
+// driver.ErrBadConn はクエリを送信する前に接続が切れていた場合だけ返されるため、再試行しても二重に実行されません。
+func isTransientDBError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && (mysqlErr.Number == mysqlErrDeadlock || mysqlErr.Number == mysqlErrLockWaitTimeout)
+}
+
+// placeholders は n 個の IN 句用のプレースホルダーを返します。
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// GetPlayerProfile はプレイヤー情報を DB から取得します。
+func (s *mysqlStore) GetPlayerProfile(ctx context.Context, playerID string) (model.PlayerProfile, error) {
+	query := "SELECT player_id, rating, games_played, wins, losses, draws, created_at FROM players WHERE player_id = ?"
+	var p model.PlayerProfile
+	err := s.queryRow(ctx, s.DB, "player.get_profile", query, playerID).Scan(&p.ID, &p.Rating, &p.GamesPlayed, &p.Wins, &p.Losses, &p.Draws, &p.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.PlayerProfile{}, ErrPlayerNotFound
+	}
+	return p, err
+}
+
+// selftestPlayerPattern はセルフテストの合成プレイヤーを除外するための LIKE のパターンです。
+var selftestPlayerPattern = strings.ReplaceAll(model.SelftestPlayerPrefix, "_", `\_`) + "%"
+
+// TopPlayers はランキングの順（レーティング・対戦数の多い順、同じ場合はプレイヤーID順）にプレイヤーを返します。
+func (s *mysqlStore) TopPlayers(ctx context.Context, limit, offset int) ([]model.PlayerProfile, error) {
+	query := `SELECT player_id, rating, games_played, wins, losses, draws, created_at FROM players
+		WHERE player_id NOT LIKE ?
+		ORDER BY rating DESC, games_played DESC, player_id ASC
+		LIMIT ? OFFSET ?`
+	rows, err := s.query(ctx, s.DB, "player.top", query, selftestPlayerPattern, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	players := []model.PlayerProfile{}
+	for rows.Next() {
+		var p model.PlayerProfile
+		if err := rows.Scan(&p.ID, &p.Rating, &p.GamesPlayed, &p.Wins, &p.Losses, &p.Draws, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		players = append(players, p)
+	}
+	return players, rows.Err()
+}
+
+// PlayerRank はプレイヤーのランキングでの順位を、ランキングの順で先にいるプレイヤー数から求めます。
+func (s *mysqlStore) PlayerRank(ctx context.Context, playerID string) (int, error) {
+	if model.IsSyntheticPlayer(playerID) {
+		return 0, ErrPlayerNotFound
+	}
+	p, err := s.GetPlayerProfile(ctx, playerID)
+	if err != nil {
+		return 0, err
+	}
+	var ahead int
+	query := `SELECT COUNT(*) FROM players
+		WHERE player_id NOT LIKE ?
+		AND (rating > ? OR (rating = ? AND (games_played > ? OR (games_played = ? AND player_id < ?))))`
+	err = s.queryRow(ctx, s.DB, "player.rank", query, selftestPlayerPattern, p.Rating, p.Rating, p.GamesPlayed, p.GamesPlayed, p.ID).Scan(&ahead)
+	if err != nil {
+		return 0, err
+	}
+	return ahead + 1, nil
+}
+
+// BanPlayer はプレイヤーの参加禁止を登録します。期限がない場合は until を NULL にします。
+func (s *mysqlStore) BanPlayer(ctx context.Context, ban PlayerBan) (bool, error) {
+	query := `INSERT INTO banned_players (player_id, until, reason, created_at) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE until = VALUES(until), reason = VALUES(reason), created_at = VALUES(created_at)`
+	res, err := s.exec(ctx, s.DB, "ban.upsert", query, ban.PlayerID, nullTime(ban.Until), ban.Reason, ban.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	// ON DUPLICATE KEY UPDATE の影響行数は、挿入が 1、更新が 2 になる
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// UnbanPlayer はプレイヤーの参加禁止を削除します。
+func (s *mysqlStore) UnbanPlayer(ctx context.Context, playerID string) error {
+	res, err := s.exec(ctx, s.DB, "ban.delete", "DELETE FROM banned_players WHERE player_id = ?", playerID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotBanned
+	}
+	return nil
+}
+
+// BlockPlayer はプレイヤーが blockedID のプレイヤーとマッチングされないよう登録します。
+// 同じプレイヤーの同時の登録で上限を超えないよう、登録数はロックして数えます。
+func (s *mysqlStore) BlockPlayer(ctx context.Context, playerID, blockedID string, limit int) (bool, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	res, err := s.exec(ctx, tx, "blocks.insert", "INSERT IGNORE INTO blocked_pairs (player_id, blocked_id, created_at) VALUES (?, ?, ?)", playerID, blockedID, s.cfg.now())
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		// 既に登録されている
+		tx.Rollback()
+		return false, err
+	}
+	var n int
+	if err := s.queryRow(ctx, tx, "blocks.count", "SELECT COUNT(*) FROM blocked_pairs WHERE player_id = ? FOR UPDATE", playerID).Scan(&n); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if n > limit {
+		tx.Rollback()
+		return false, ErrBlockLimitReached
+	}
+	return true, tx.Commit()
+}
+
+// UnblockPlayer はプレイヤーのブロックを解除します。
+func (s *mysqlStore) UnblockPlayer(ctx context.Context, playerID, blockedID string) error {
+	res, err := s.exec(ctx, s.DB, "blocks.delete", "DELETE FROM blocked_pairs WHERE player_id = ? AND blocked_id = ?", playerID, blockedID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotBlocked
+	}
+	return nil
+}
+
+// ActiveBan は PlayerIDs のうち now の時点で参加禁止のプレイヤーを主キーで検索します。
+func (s *mysqlStore) ActiveBan(ctx context.Context, playerIDs []string, now time.Time) (PlayerBan, bool, error) {
+	if len(playerIDs) == 0 {
+		return PlayerBan{}, false, nil
+	}
+	args := make([]interface{}, 0, len(playerIDs)+1)
+	for _, id := range playerIDs {
+		args = append(args, id)
+	}
+	args = append(args, now)
+	query := `SELECT player_id, until, reason, created_at FROM banned_players
+		WHERE player_id IN (` + placeholders(len(playerIDs)) + `) AND (until IS NULL OR until > ?)
+		LIMIT 1`
+	var ban PlayerBan
+	var until sql.NullTime
+	err := s.queryRow(ctx, s.DB, "ban.get_active", query, args...).Scan(&ban.PlayerID, &until, &ban.Reason, &ban.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return PlayerBan{}, false, nil
+	}
+	if err != nil {
+		return PlayerBan{}, false, err
+	}
+	ban.Until = until.Time
+	return ban, true, nil
+}
+
+// RecordCooldownOffense はプレイヤーの行をロックして違反の回数を数え、クールダウンの期限を更新します。
+func (s *mysqlStore) RecordCooldownOffense(ctx context.Context, playerID string, now time.Time) (PlayerCooldown, error) {
+	if !s.cfg.Cooldown.Enabled() {
+		return PlayerCooldown{}, ErrCooldownDisabled
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return PlayerCooldown{}, err
+	}
+	var offenses int
+	var lastOffense, until sql.NullTime
+	query := "SELECT cooldown_offenses, last_offense_at, cooldown_until FROM players WHERE player_id = ? FOR UPDATE"
+	err = s.queryRow(ctx, tx, "cooldown.get_for_update", query, playerID).Scan(&offenses, &lastOffense, &until)
+	if errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		return PlayerCooldown{}, ErrPlayerNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return PlayerCooldown{}, err
+	}
+	cooldown := s.cfg.Cooldown.next(playerID, offenses, lastOffense.Time, until.Time, now)
+	query = "UPDATE players SET cooldown_until = ?, cooldown_offenses = ?, last_offense_at = ? WHERE player_id = ?"
+	if _, err := s.exec(ctx, tx, "cooldown.update", query, cooldown.Until, cooldown.Offenses, now, playerID); err != nil {
+		tx.Rollback()
+		return PlayerCooldown{}, err
+	}
+	return cooldown, tx.Commit()
+}
+
+// ActiveCooldown は PlayerIDs のうち now の時点でクールダウン中のプレイヤーを主キーで検索し、期限の最も遅いものを返します。
+func (s *mysqlStore) ActiveCooldown(ctx context.Context, playerIDs []string, now time.Time) (PlayerCooldown, bool, error) {
+	if len(playerIDs) == 0 {
+		return PlayerCooldown{}, false, nil
+	}
+	args := make([]interface{}, 0, len(playerIDs)+1)
+	for _, id := range playerIDs {
+		args = append(args, id)
+	}
+	args = append(args, now)
+	query := `SELECT player_id, cooldown_until, cooldown_offenses FROM players
+		WHERE player_id IN (` + placeholders(len(playerIDs)) + `) AND cooldown_until > ?
+		ORDER BY cooldown_until DESC LIMIT 1`
+	var c PlayerCooldown
+	err := s.queryRow(ctx, s.DB, "cooldown.get_active", query, args...).Scan(&c.PlayerID, &c.Until, &c.Offenses)
+	if errors.Is(err, sql.ErrNoRows) {
+		return PlayerCooldown{}, false, nil
+	}
+	if err != nil {
+		return PlayerCooldown{}, false, err
+	}
+	return c, true, nil
+}
+
+// SetPlayerRating はプレイヤーのレーティングを更新します。未登録のプレイヤーであれば作成します。
+func (s *mysqlStore) SetPlayerRating(ctx context.Context, playerID string, rating int) (model.PlayerProfile, bool, error) {
+	query := `INSERT INTO players (player_id, rating, games_played, created_at) VALUES (?, ?, 0, ?)
+		ON DUPLICATE KEY UPDATE rating = VALUES(rating)`
+	res, err := s.exec(ctx, s.DB, "player.set_rating", query, playerID, rating, s.cfg.now())
+	if err != nil {
+		return model.PlayerProfile{}, false, err
+	}
+	// ON DUPLICATE KEY UPDATE の影響行数は、挿入した場合に 1、更新した場合に 2、値が同じだった場合に 0
+	n, err := res.RowsAffected()
+	if err != nil {
+		return model.PlayerProfile{}, false, err
+	}
+	profile, err := s.GetPlayerProfile(ctx, playerID)
+	return profile, n == 1, err
+}
+
+// getOrCreatePlayer はプレイヤー情報を DB から取得します。
+// 未登録のプレイヤーであれば、申告された腕前に応じた初期レーティング（SeedRating）で新規作成します。
+// member.Rating が指定されている場合（TRUST_CLIENT_RATING）は、そのレーティングで作成・上書きします。
+func (s *mysqlStore) getOrCreatePlayer(ctx context.Context, tx *sql.Tx, member model.Player) (model.Player, error) {
+	playerID := member.ID
+	if member.Rating > 0 {
+		query := `INSERT INTO players (player_id, rating, games_played, created_at) VALUES (?, ?, 0, ?)
+			ON DUPLICATE KEY UPDATE rating = VALUES(rating)`
+		if _, err := s.exec(ctx, tx, "player.upsert_client_rating", query, playerID, member.Rating, s.cfg.now()); err != nil {
+			return model.Player{}, err
+		}
+	} else {
+		insQuery := "INSERT IGNORE INTO players (player_id, rating, games_played, created_at) VALUES (?, ?, 0, ?)"
+		if _, err := s.exec(ctx, tx, "player.insert_default", insQuery, playerID, s.cfg.RatingSeeds.Seed(member.SelfReportedSkill), s.cfg.now()); err != nil {
+			return model.Player{}, err
+		}
+	}
+
+	p := model.Player{ID: playerID}
+	query := "SELECT rating FROM players WHERE player_id = ?"
+	if err := s.queryRow(ctx, tx, "player.get_rating", query, playerID).Scan(&p.Rating); err != nil {
+		return model.Player{}, err
+	}
+	return p, nil
+}
+
+// EnqueueEntry はエントリを待機キューへ登録します。パーティの場合は全メンバーを1つのトランザクションで登録します。
+func (s *mysqlStore) EnqueueEntry(ctx context.Context, entry model.QueueEntry) (model.QueueEntry, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return model.QueueEntry{}, err
+	}
+	resumed, err := s.resumeRequeuedEntry(ctx, tx, entry)
+	if err != nil {
+		tx.Rollback()
+		return model.QueueEntry{}, err
+	}
+	if resumed {
+		if err := tx.Commit(); err != nil {
+			return model.QueueEntry{}, err
+		}
+		return entry, nil
+	}
+	if err := s.checkQueueCapacity(ctx, tx, len(entry.Players)); err != nil {
+		tx.Rollback()
+		return model.QueueEntry{}, err
+	}
+
+	players := make([]model.Player, 0, len(entry.Players))
+	for _, member := range entry.Players {
+		player, err := s.getOrCreatePlayer(ctx, tx, member)
+		if err != nil {
+			tx.Rollback()
+			return model.QueueEntry{}, err
+		}
+		player.Region = entry.Region
+		player.Priority = entry.Priority
+		player.PingMS = member.PingMS
+		player.RatingRange = entry.RatingRange
+		player.Attributes = member.Attributes
+		if err := s.insertWaitingPlayer(ctx, tx, player, entry); err != nil {
+			tx.Rollback()
+			return model.QueueEntry{}, err
+		}
+		players = append(players, player)
+	}
+	// 登録した後にロックして確認する。確認と登録の間に、待機キューに残っていた同じプレイヤーの行でセッションが成立していても見落とさないため
+	members, err := s.unfinishedSessions(ctx, tx, entryPlayerIDs([]model.QueueEntry{entry}), "FOR UPDATE")
+	if err != nil {
+		tx.Rollback()
+		return model.QueueEntry{}, err
+	}
+	if len(members) > 0 {
+		if !entry.ReplaceSession {
+			tx.Rollback()
+			return model.QueueEntry{}, &ActiveSessionError{members[0]}
+		}
+		if entry.Abandoned, err = s.abandonSessions(ctx, tx, members); err != nil {
+			tx.Rollback()
+			return model.QueueEntry{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return model.QueueEntry{}, err
+	}
+	entry.Players = players
+	entry.Rating = model.AverageRating(players)
+	return entry, nil
+}
+
+// insertWaitingPlayer は待機プレイヤーを DB に登録します。
+// レーティングは players テーブルで管理するため、待機キューにはプレイヤーIDと待機条件（パーティ・地域・ゲームモード・ping・相手のレーティングの範囲・属性）、待機開始時刻のみを保存します。
+// 待機開始時刻は DB の NOW() ではなくアプリの時計（entryWaitingSince）を使います。
+// 既に同じプレイヤーが登録済みの場合は ErrAlreadyQueued を返します。
+func (s *mysqlStore) insertWaitingPlayer(ctx context.Context, tx *sql.Tx, p model.Player, e model.QueueEntry) error {
+	query := `INSERT INTO matchmaking_queue (player_id, party_id, region, game_mode, priority, ping_ms, waiting_since, expires_at, min_rating, max_rating, max_rating_delta, max_wait_seconds, attributes, trace_parent)
+		VALUES (?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''))`
+	_, err := s.exec(ctx, tx, "queue.insert", query, p.ID, e.PartyID, e.Region, e.GameMode, e.Priority, p.PingMS, s.cfg.entryWaitingSince(e), nullTime(e.ExpiresAt), e.RatingRange.Min, e.RatingRange.Max, e.RatingRange.MaxDelta,
+		int(e.Timeout/time.Second), nullAttributes(p.Attributes), e.TraceParent)
+	if isDuplicateEntry(err) {
+		return model.ErrAlreadyQueued
+	}
+	return err
+}
+
+// resumeRequeuedEntry は、エントリの全メンバーが中止されたセッションから待機キューへ戻された状態であれば、
+// 待機の再開として扱い true を返します。
+func (s *mysqlStore) resumeRequeuedEntry(ctx context.Context, tx *sql.Tx, entry model.QueueEntry) (bool, error) {
+	ids := make([]interface{}, 0, len(entry.Players)+1)
+	for _, p := range entry.Players {
+		ids = append(ids, p.ID)
+	}
+	query := `SELECT COUNT(*) FROM matchmaking_queue
+		WHERE player_id IN (` + placeholders(len(entry.Players)) + `) AND requeued = TRUE AND COALESCE(party_id, '') = ?
+		FOR UPDATE`
+	var n int
+	if err := s.queryRow(ctx, tx, "queue.count_requeued", query, append(ids, entry.PartyID)...).Scan(&n); err != nil {
+		return false, err
+	}
+	if n != len(entry.Players) {
+		return false, nil
+	}
+
+	// 再開のリクエストでクライアントが応答可能であることを確認できたため、有効期限も新しい申告に合わせる
+	update := "UPDATE matchmaking_queue SET requeued = FALSE, expires_at = ? WHERE player_id IN (" + placeholders(len(entry.Players)) + ")"
+	if _, err := s.exec(ctx, tx, "queue.resume_requeued", update, append([]interface{}{nullTime(entry.ExpiresAt)}, ids[:len(entry.Players)]...)...); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DequeuePlayer は指定プレイヤーを DB の待機キューから削除します。
+// パーティで参加している場合は、パーティ全体を待機キューから削除します。
+func (s *mysqlStore) DequeuePlayer(ctx context.Context, playerID string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	var partyID sql.NullString
+	query := "SELECT party_id FROM matchmaking_queue WHERE player_id = ? FOR UPDATE"
+	err = s.queryRow(ctx, tx, "queue.lock_player", query, playerID).Scan(&partyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// 既にマッチング済み、または削除済み
+		return tx.Commit()
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if partyID.Valid {
+		_, err = s.exec(ctx, tx, "queue.delete_party", "DELETE FROM matchmaking_queue WHERE party_id = ?", partyID.String)
+	} else {
+		_, err = s.exec(ctx, tx, "queue.delete_player", "DELETE FROM matchmaking_queue WHERE player_id = ?", playerID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// SuspendEntry はプレイヤー（パーティの場合はパーティ全体）をクライアントの再接続を待つ状態にします。
+func (s *mysqlStore) SuspendEntry(ctx context.Context, playerID string, expiresAt time.Time) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	var partyID sql.NullString
+	query := "SELECT party_id FROM matchmaking_queue WHERE player_id = ? FOR UPDATE"
+	err = s.queryRow(ctx, tx, "queue.lock_player", query, playerID).Scan(&partyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		return ErrNotQueued
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	const set = "UPDATE matchmaking_queue SET requeued = TRUE, expires_at = IF(expires_at IS NULL OR expires_at > ?, ?, expires_at)"
+	if partyID.Valid {
+		_, err = s.exec(ctx, tx, "queue.suspend_party", set+" WHERE party_id = ?", expiresAt, expiresAt, partyID.String)
+	} else {
+		_, err = s.exec(ctx, tx, "queue.suspend_player", set+" WHERE player_id = ?", expiresAt, expiresAt, playerID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListQueuedPlayers は待機キューのプレイヤーを待機開始の古い順に返します。
+// マッチング処理を妨げないよう、行ロックは取得しません。
+func (s *mysqlStore) ListQueuedPlayers(ctx context.Context) ([]QueuedPlayer, error) {
+	return s.listQueuedPlayers(ctx, s.DB, "", 0)
+}
+
+// listQueuedPlayers は待機キューのプレイヤーを players テーブルと結合して待機開始順に取得します。
+// lock には "FOR UPDATE" などの行ロックの指定を渡します。limit が 0 より大きい場合は待機開始の古い順に最大 limit 人を取得します。
+func (s *mysqlStore) listQueuedPlayers(ctx context.Context, q sqlQueryer, lock string, limit int) ([]QueuedPlayer, error) {
+	query := `SELECT q.player_id, p.rating, COALESCE(q.party_id, ''), q.game_mode, q.region, q.ping_ms, q.waiting_since, q.expires_at, q.priority, q.requeued, p.games_played,
+			q.min_rating, q.max_rating, q.max_rating_delta, q.max_wait_seconds, COALESCE(q.attributes, ''), COALESCE(q.trace_parent, '')
+		FROM matchmaking_queue q
+		JOIN players p ON p.player_id = q.player_id
+		ORDER BY q.waiting_since ASC, q.player_id ASC `
+	var args []interface{}
+	if limit > 0 {
+		query += "LIMIT ? "
+		args = append(args, limit)
+	}
+	rows, err := s.query(ctx, q, "queue.list", query+lock, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	players := []QueuedPlayer{}
+	for rows.Next() {
+		var p QueuedPlayer
+		var expiresAt sql.NullTime
+		var attrs string
+		if err := rows.Scan(&p.ID, &p.Rating, &p.PartyID, &p.GameMode, &p.Region, &p.PingMS, &p.WaitingSince, &expiresAt, &p.Priority, &p.Requeued, &p.GamesPlayed,
+			&p.RatingRange.Min, &p.RatingRange.Max, &p.RatingRange.MaxDelta, &p.MaxWaitSeconds, &attrs, &p.TraceParent); err != nil {
+			return nil, err
+		}
+		p.ExpiresAt = expiresAt.Time
+		if p.Attributes, err = decodeAttributes(attrs); err != nil {
+			return nil, err
+		}
+		players = append(players, p)
+	}
+	return players, rows.Err()
+}
+
+// QueuePosition はプレイヤーの待機キューでの順番を、同じゲームモードで先に待機しているプレイヤー数から求めます。
+func (s *mysqlStore) QueuePosition(ctx context.Context, playerID string) (queuePosition, error) {
+	var pos queuePosition
+	var expiresAt sql.NullTime
+	query := `SELECT q.player_id, p.rating, COALESCE(q.party_id, ''), q.game_mode, q.region, q.ping_ms, q.waiting_since, q.expires_at, q.priority, q.requeued, p.games_played,
+			q.min_rating, q.max_rating, q.max_rating_delta, q.max_wait_seconds, COALESCE(q.attributes, ''), COALESCE(q.trace_parent, '')
+		FROM matchmaking_queue q
+		JOIN players p ON p.player_id = q.player_id
+		WHERE q.player_id = ?`
+	p := &pos.Player
+	var attrs string
+	err := s.queryRow(ctx, s.DB, "queue.get_player", query, playerID).Scan(&p.ID, &p.Rating, &p.PartyID, &p.GameMode, &p.Region, &p.PingMS, &p.WaitingSince, &expiresAt, &p.Priority, &p.Requeued, &p.GamesPlayed,
+		&p.RatingRange.Min, &p.RatingRange.Max, &p.RatingRange.MaxDelta, &p.MaxWaitSeconds, &attrs, &p.TraceParent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return queuePosition{}, ErrNotQueued
+	}
+	if err != nil {
+		return queuePosition{}, err
+	}
+	p.ExpiresAt = expiresAt.Time
+	if p.Attributes, err = decodeAttributes(attrs); err != nil {
+		return queuePosition{}, err
+	}
+
+	// 待機開始時刻が同じ場合は listQueuedPlayers と同じくプレイヤー ID 順に並べる
+	count := `SELECT COUNT(*), COALESCE(SUM(waiting_since < ? OR (waiting_since = ? AND player_id <= ?)), 0)
+		FROM matchmaking_queue WHERE game_mode = ?`
+	if err := s.queryRow(ctx, s.DB, "queue.count_position", count, p.WaitingSince, p.WaitingSince, playerID, p.GameMode).Scan(&pos.Waiting, &pos.Position); err != nil {
+		return queuePosition{}, err
+	}
+	return pos, nil
+}
+
+// SweepExpiredEntries は有効期限を過ぎたエントリを待機キューから削除します。
+func (s *mysqlStore) SweepExpiredEntries(ctx context.Context, now time.Time) (int64, error) {
+	res, err := s.exec(ctx, s.DB, "queue.sweep_expired", "DELETE FROM matchmaking_queue WHERE expires_at IS NOT NULL AND expires_at <= ?", now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CreateSessions は待機プレイヤー（待機開始の古い順に最大 Config.MatchBatchSize 人）を FOR UPDATE SKIP LOCKED で排他的に取得してロビーを組み、セッションを保存します。
+// 他のインスタンスのマッチング処理がロックしている行は待たずに飛ばすため、複数のインスタンスが互いを待たずに別々のプレイヤーを処理できます。
+// 呼び出し元が一時的なエラー（isTransientDBError）を判定して再試行できるよう、DB のエラーはラップして返します。
+func (s *mysqlStore) CreateSessions(ctx context.Context, plan matchPlanner) ([]model.SessionResult, error) {
+	if s.leader != nil {
+		// リーダー選出を行う場合は、マッチングのロックを保持していなければ何もしない
+		leader, err := s.leader.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !leader {
+			return nil, nil
+		}
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("トランザクション開始エラー: %w", err)
+	}
+
+	rows, err := s.listQueuedPlayers(ctx, tx, "FOR UPDATE SKIP LOCKED", s.cfg.MatchBatchSize)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("待機プレイヤー取得エラー: %w", err)
+	}
+	rows, err = s.withoutPartialParties(ctx, tx, rows)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("パーティ人数取得エラー: %w", err)
+	}
+	entries := GroupQueueEntries(rows)
+	members, err := s.unfinishedSessions(ctx, tx, entryPlayerIDs(entries), "")
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("未終了のセッション取得エラー: %w", err)
+	}
+	entries = withoutPlayersInSession(entries, members)
+
+	recent, err := s.getRecentOpponents(ctx, tx, entries)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("最近の対戦相手取得エラー: %w", err)
+	}
+
+	blocked, err := s.getBlockedPairs(ctx, tx, entries)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ブロック取得エラー: %w", err)
+	}
+
+	sessions := plan(entries, recent, blocked)
+	for i := range sessions {
+		if err := s.saveSession(ctx, tx, &sessions[i]); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("コミットエラー: %w", err)
+	}
+	return sessions, nil
+}
+
+// withoutPartialParties は、メンバーの一部しか取得できなかったパーティ（他のインスタンスがロックしている、または上限で途切れた）を rows から取り除きます。
+// 途中までのパーティを1つのエントリとして組ませないためのものです。
+func (s *mysqlStore) withoutPartialParties(ctx context.Context, tx *sql.Tx, rows []QueuedPlayer) ([]QueuedPlayer, error) {
+	got := make(map[string]int)
+	var parties []interface{}
+	for _, r := range rows {
+		if r.PartyID == "" {
+			continue
+		}
+		if got[r.PartyID] == 0 {
+			parties = append(parties, r.PartyID)
+		}
+		got[r.PartyID]++
+	}
+	if len(parties) == 0 {
+		return rows, nil
+	}
+
+	// ロックせずに数える（他のインスタンスがロックしているメンバーも含める）
+	query := "SELECT party_id, COUNT(*) FROM matchmaking_queue WHERE party_id IN (" + placeholders(len(parties)) + ") GROUP BY party_id"
+	res, err := s.query(ctx, tx, "queue.count_party_members", query, parties...)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	partial := make(map[string]bool)
+	for res.Next() {
+		var party string
+		var n int
+		if err := res.Scan(&party, &n); err != nil {
+			return nil, err
+		}
+		partial[party] = got[party] < n
+	}
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+
+	kept := rows[:0:0]
+	for _, r := range rows {
+		if !partial[r.PartyID] {
+			kept = append(kept, r)
+		}
+	}
+	return kept, nil
+}
+
+// saveSession はマッチング済みプレイヤーを待機キューから削除し、セッション情報を DB に登録します。
+func (s *mysqlStore) saveSession(ctx context.Context, tx *sql.Tx, session *model.SessionResult) error {
+	ids := make([]interface{}, 0, len(session.Participants))
+	for _, p := range session.Participants {
+		ids = append(ids, p.ID)
+	}
+	if len(ids) > 0 {
+		query := "DELETE FROM matchmaking_queue WHERE player_id IN (" + placeholders(len(ids)) + ")"
+		if _, err := s.exec(ctx, tx, "queue.delete_matched", query, ids...); err != nil {
+			return fmt.Errorf("待機プレイヤー削除エラー: %w", err)
+		}
+	}
+	if err := s.insertSession(ctx, tx, session); err != nil {
+		return fmt.Errorf("セッション登録エラー: %w", err)
+	}
+	return nil
+}
+
+// insertSession は生成したセッション情報を DB に登録します。
+// 参加者とチーム番号は session_players テーブルに登録します。
+// セッションが中止された際に待機キューへ戻せるよう、参加者の待機条件と待機開始時刻も保存します。
+// 開始時刻（start_time）は待機開始時刻と同じくアプリの時計を使います（期限切れの判定で比べるため）。
+// セッション ID が既存のものと重複した場合は、新しい ID で1回だけ再試行します（session.SessionID を書き換えます）。
+func (s *mysqlStore) insertSession(ctx context.Context, tx *sql.Tx, session *model.SessionResult) error {
+	query := `INSERT INTO sessions (session_id, game_mode, region, match_quality, rating_gap, win_probability, max_wait_seconds, min_wait_seconds, status, accept_deadline,
+			game_server_host, game_server_port, match_token, start_time)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?)`
+	var serverHost sql.NullString
+	var serverPort sql.NullInt64
+	if session.GameServer != nil {
+		serverHost = sql.NullString{String: session.GameServer.Host, Valid: true}
+		serverPort = sql.NullInt64{Int64: int64(session.GameServer.Port), Valid: true}
+	}
+	insert := func() error {
+		_, err := s.exec(ctx, tx, "session.insert", query, session.SessionID, session.GameMode, session.Region, session.Quality,
+			session.RatingGap, session.WinProbability, session.MaxWaitSeconds, session.MinWaitSeconds, session.Status, session.AcceptDeadline,
+			serverHost, serverPort, session.MatchToken, s.cfg.now())
+		return err
+	}
+	err := insert()
+	if isDuplicateEntry(err) {
+		slog.Warn("duplicate session id; retrying with a new id", "session_id", session.SessionID)
+		session.SessionID = string(model.NewSessionID())
+		// トークンにはセッションIDが含まれるため発行し直す
+		if session.MatchToken != "" {
+			session.MatchToken = ""
+			if s.cfg.ReissueMatchToken != nil {
+				s.cfg.ReissueMatchToken(session, s.cfg.now())
+			}
+		}
+		err = insert()
+	}
+	if err != nil {
+		return err
+	}
+
+	// 通知の前にプロセスが停止しても通知し直せるよう、セッションと同じトランザクションでアウトボックスに登録する
+	if _, err := s.exec(ctx, tx, "notification.insert", "INSERT INTO match_notifications (session_id, created_at) VALUES (?, ?)", session.SessionID, s.cfg.now()); err != nil {
+		return err
+	}
+
+	// ボットは players テーブルに登録しないため、レーティングは session_players に保存する
+	memberQuery := `INSERT INTO session_players (session_id, player_id, team, party_id, region, ping_ms, waiting_since, expires_at, priority, ready_state, is_bot, bot_rating,
+			min_rating, max_rating, max_rating_delta, attributes)
+		VALUES (?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	for _, p := range session.Participants {
+		var botRating sql.NullInt64
+		if p.IsBot {
+			botRating = sql.NullInt64{Int64: int64(p.Rating), Valid: true}
+		}
+		if _, err := s.exec(ctx, tx, "session.insert_player", memberQuery, session.SessionID, p.ID, p.Team, p.PartyID, p.Region, p.PingMS, p.WaitingSince, nullTime(p.ExpiresAt), p.Priority, p.ReadyState, p.IsBot, botRating,
+			p.RatingRange.Min, p.RatingRange.Max, p.RatingRange.MaxDelta, nullAttributes(p.Attributes)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddSpectator は確定済みのセッションに観戦者を追加します。
+// 同じセッションへの同時の追加で上限を超えないよう、セッションの行をロックして確認します。
+func (s *mysqlStore) AddSpectator(ctx context.Context, sessionID, playerID string, limit int) (bool, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = s.queryRow(ctx, tx, "spectators.lock_session", "SELECT status FROM sessions WHERE session_id = ? FOR UPDATE", sessionID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, model.ErrSessionNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	var n int
+	if err := s.queryRow(ctx, tx, "spectators.is_participant", "SELECT COUNT(*) FROM session_players WHERE session_id = ? AND player_id = ?", sessionID, playerID).Scan(&n); err != nil {
+		return false, err
+	}
+	if n > 0 {
+		return false, ErrSpectatorIsParticipant
+	}
+	if status != model.SessionActive {
+		return false, ErrSessionNotActive
+	}
+	res, err := s.exec(ctx, tx, "spectators.insert", "INSERT IGNORE INTO session_spectators (session_id, player_id, added_at) VALUES (?, ?, ?)", sessionID, playerID, s.cfg.now())
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		// 既に登録されている
+		return false, err
+	}
+	if err := s.queryRow(ctx, tx, "spectators.count", "SELECT COUNT(*) FROM session_spectators WHERE session_id = ?", sessionID).Scan(&n); err != nil {
+		return false, err
+	}
+	if n > limit {
+		return false, ErrSpectatorLimitReached
+	}
+	return true, tx.Commit()
+}
+
+// RemoveSpectator はセッションの観戦者を削除します。
+func (s *mysqlStore) RemoveSpectator(ctx context.Context, sessionID, playerID string) error {
+	res, err := s.exec(ctx, s.DB, "spectators.delete", "DELETE FROM session_spectators WHERE session_id = ? AND player_id = ?", sessionID, playerID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotSpectating
+	}
+	return nil
+}
+
+// RecentSession はプレイヤーが参加している成立直後の未終了のセッションを DB から取得します。
+func (s *mysqlStore) RecentSession(ctx context.Context, playerID string, startedAfter time.Time) (model.SessionResult, error) {
+	var sessionID string
+	query := `SELECT s.session_id
+		FROM session_players sp
+		JOIN sessions s ON s.session_id = sp.session_id
+		WHERE sp.player_id = ? AND sp.result_acked_at IS NULL AND s.status IN (?, ?) AND s.start_time >= ?
+		ORDER BY s.start_time DESC, s.session_id DESC
+		LIMIT 1`
+	err := s.queryRow(ctx, s.DB, "session.find_recent_for_player", query, playerID, model.SessionPendingAccept, model.SessionActive, startedAfter).Scan(&sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.SessionResult{}, model.ErrSessionNotFound
+	}
+	if err != nil {
+		return model.SessionResult{}, err
+	}
+	return s.loadSession(ctx, s.DB, sessionID)
+}
+
+// AckSessionResult はプレイヤーがセッションの結果を受け取った時刻を session_players に記録します。
+func (s *mysqlStore) AckSessionResult(ctx context.Context, sessionID, playerID string, at time.Time) error {
+	res, err := s.exec(ctx, s.DB, "session.ack_result", "UPDATE session_players SET result_acked_at = ? WHERE session_id = ? AND player_id = ? AND result_acked_at IS NULL", at, sessionID, playerID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	// 記録済みの参加者も更新されないため、参加者かどうかを確認する
+	var one int
+	err = s.queryRow(ctx, s.DB, "session.find_player", "SELECT 1 FROM session_players WHERE session_id = ? AND player_id = ?", sessionID, playerID).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.ErrSessionNotFound
+	}
+	return err
+}
+
+// GetSession はセッション情報と参加者を DB から取得します。
+func (s *mysqlStore) GetSession(ctx context.Context, sessionID string) (model.SessionResult, error) {
+	return s.loadSession(ctx, s.DB, sessionID)
+}
+
+// loadSession はセッション情報と参加者を DB から取得します。
+func (s *mysqlStore) loadSession(ctx context.Context, q sqlQueryer, sessionID string) (model.SessionResult, error) {
+	session := model.SessionResult{SessionID: sessionID}
+	var deadline, started sql.NullTime
+	var serverHost sql.NullString
+	var serverPort sql.NullInt64
+	// 対戦の質の指標はマイグレーション前に作成したセッションでは NULL のため 0 として返す
+	query := `SELECT game_mode, region, match_quality, COALESCE(rating_gap, 0), COALESCE(win_probability, 0), COALESCE(max_wait_seconds, 0), COALESCE(min_wait_seconds, 0),
+			status, accept_deadline, start_time, game_server_host, game_server_port, COALESCE(match_token, ''), COALESCE(outcome, ''), COALESCE(winning_team, 0)
+		FROM sessions WHERE session_id = ?`
+	err := s.queryRow(ctx, q, "session.get", query, sessionID).Scan(&session.GameMode, &session.Region, &session.Quality,
+		&session.RatingGap, &session.WinProbability, &session.MaxWaitSeconds, &session.MinWaitSeconds, &session.Status, &deadline, &started,
+		&serverHost, &serverPort, &session.MatchToken, &session.Outcome, &session.WinningTeam)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.SessionResult{}, model.ErrSessionNotFound
+	}
+	if err != nil {
+		return model.SessionResult{}, err
+	}
+	if deadline.Valid {
+		session.AcceptDeadline = &deadline.Time
+	}
+	if started.Valid {
+		session.StartedAt = &started.Time
+	}
+	if serverHost.Valid && serverPort.Valid {
+		session.GameServer = &model.GameServer{Host: serverHost.String, Port: int(serverPort.Int64)}
+	}
+
+	memberQuery := `SELECT sp.player_id, COALESCE(p.rating, sp.bot_rating, 0), sp.region, sp.ping_ms, sp.waiting_since, sp.expires_at, sp.priority, COALESCE(sp.party_id, ''), sp.team, sp.ready_state, sp.is_bot,
+			sp.min_rating, sp.max_rating, sp.max_rating_delta, COALESCE(sp.attributes, '')
+		FROM session_players sp
+		LEFT JOIN players p ON p.player_id = sp.player_id
+		WHERE sp.session_id = ?
+		ORDER BY sp.team ASC, sp.player_id ASC`
+	rows, err := s.query(ctx, q, "session.list_players", memberQuery, sessionID)
+	if err != nil {
+		return model.SessionResult{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p model.Participant
+		var expiresAt sql.NullTime
+		var attrs string
+		if err := rows.Scan(&p.ID, &p.Rating, &p.Region, &p.PingMS, &p.WaitingSince, &expiresAt, &p.Priority, &p.PartyID, &p.Team, &p.ReadyState, &p.IsBot,
+			&p.RatingRange.Min, &p.RatingRange.Max, &p.RatingRange.MaxDelta, &attrs); err != nil {
+			return model.SessionResult{}, err
+		}
+		p.ExpiresAt = expiresAt.Time
+		if p.Attributes, err = decodeAttributes(attrs); err != nil {
+			return model.SessionResult{}, err
+		}
+		session.Participants = append(session.Participants, p)
+	}
+	if err := rows.Err(); err != nil {
+		return model.SessionResult{}, err
+	}
+	// トランザクション内では結果を読み終えてから次のクエリを実行する
+	rows.Close()
+
+	spectators, err := s.query(ctx, q, "session.list_spectators", "SELECT player_id FROM session_spectators WHERE session_id = ? ORDER BY added_at ASC, player_id ASC", sessionID)
+	if err != nil {
+		return model.SessionResult{}, err
+	}
+	defer spectators.Close()
+	for spectators.Next() {
+		var id string
+		if err := spectators.Scan(&id); err != nil {
+			return model.SessionResult{}, err
+		}
+		session.Spectators = append(session.Spectators, id)
+	}
+	if err := spectators.Err(); err != nil {
+		return model.SessionResult{}, err
+	}
+	session.SetHeadToHead()
+	session.SetBots()
+	return session, nil
+}
+
+// PendingSessions は承諾待ちのセッションを返します。
+func (s *mysqlStore) PendingSessions(ctx context.Context) ([]model.SessionResult, error) {
+	rows, err := s.query(ctx, s.DB, "session.list_pending", "SELECT session_id, accept_deadline FROM sessions WHERE status = ?", model.SessionPendingAccept)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []model.SessionResult
+	for rows.Next() {
+		session := model.SessionResult{Status: model.SessionPendingAccept}
+		var deadline sql.NullTime
+		if err := rows.Scan(&session.SessionID, &deadline); err != nil {
+			return nil, err
+		}
+		if deadline.Valid {
+			session.AcceptDeadline = &deadline.Time
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// ResolveReadyCheck はセッションの行をロックして承諾状態を記録し、状態が確定すればセッションを更新します。
+func (s *mysqlStore) ResolveReadyCheck(ctx context.Context, sessionID, playerID, state string) (model.SessionResult, bool, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return model.SessionResult{}, false, err
+	}
+	session, resolved, err := s.resolveReadyCheckTx(ctx, tx, sessionID, playerID, state)
+	if err != nil {
+		tx.Rollback()
+		return model.SessionResult{}, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return model.SessionResult{}, false, err
+	}
+	return session, resolved, nil
+}
+
+// resolveReadyCheckTx は ResolveReadyCheck のトランザクション内の処理です。
+func (s *mysqlStore) resolveReadyCheckTx(ctx context.Context, tx *sql.Tx, sessionID, playerID, state string) (model.SessionResult, bool, error) {
+	var status string
+	err := s.queryRow(ctx, tx, "session.lock_status", "SELECT status FROM sessions WHERE session_id = ? FOR UPDATE", sessionID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.SessionResult{}, false, model.ErrSessionNotFound
+	}
+	if err != nil {
+		return model.SessionResult{}, false, err
+	}
+
+	if playerID != "" {
+		// ゲームに現れなかった報告は承諾済みの参加者にも記録する
+		from := []interface{}{model.ReadyPending, model.ReadyPending}
+		if state == model.ReadyNoShow {
+			from[1] = model.ReadyAccepted
+		}
+		res, err := s.exec(ctx, tx, "session.update_ready_state", "UPDATE session_players SET ready_state = ? WHERE session_id = ? AND player_id = ? AND ready_state IN (?, ?)",
+			append([]interface{}{state, sessionID, playerID}, from...)...)
+		if err != nil {
+			return model.SessionResult{}, false, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			if err := s.ensureParticipant(ctx, tx, sessionID, playerID); err != nil {
+				return model.SessionResult{}, false, err
+			}
+		}
+		// 既に中止済みのセッションを辞退した場合は、待機キューへ戻されていても取り除く（同時に辞退した場合）
+		if status == model.SessionAborted && (state == model.ReadyDeclined || state == model.ReadyNoShow) && !s.externalQueue {
+			if err := s.dequeueRequeuedPlayer(ctx, tx, playerID); err != nil {
+				return model.SessionResult{}, false, err
+			}
+		}
+	}
+
+	session, err := s.loadSession(ctx, tx, sessionID)
+	if err != nil {
+		return model.SessionResult{}, false, err
+	}
+	if !settleReadyCheck(&session, playerID == "") {
+		return session, false, nil
+	}
+
+	switch session.Status {
+	case model.SessionActive:
+		if err := s.incrementGamesPlayed(ctx, tx, session); err != nil {
+			return model.SessionResult{}, false, err
+		}
+		if err := s.recordRecentOpponents(ctx, tx, session); err != nil {
+			return model.SessionResult{}, false, err
+		}
+	case model.SessionAborted:
+		if s.externalQueue {
+			break
+		}
+		if err := s.requeueSurvivors(ctx, tx, session); err != nil {
+			return model.SessionResult{}, false, err
+		}
+	}
+	query := "UPDATE sessions SET status = ? WHERE session_id = ?"
+	args := []interface{}{session.Status, sessionID}
+	if session.Status == model.SessionAborted {
+		query = "UPDATE sessions SET status = ?, ended_at = ? WHERE session_id = ?"
+		args = []interface{}{session.Status, s.cfg.now(), sessionID}
+	}
+	if _, err := s.exec(ctx, tx, "session.update_status", query, args...); err != nil {
+		return model.SessionResult{}, false, err
+	}
+	return session, true, nil
+}
+
+// ExpireSessions は startedBefore より前に開始した確定済みのセッションを期限切れにします。
+func (s *mysqlStore) ExpireSessions(ctx context.Context, startedBefore time.Time) (int64, error) {
+	query := "UPDATE sessions SET status = ?, ended_at = ? WHERE status = ? AND start_time < ?"
+	res, err := s.exec(ctx, s.DB, "session.expire", query, model.SessionExpired, s.cfg.now(), model.SessionActive, startedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteEndedSessions は endedBefore より前に終了したセッションと参加者を削除します。
+func (s *mysqlStore) DeleteEndedSessions(ctx context.Context, endedBefore time.Time) (int64, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	ended := "SELECT session_id FROM sessions WHERE status IN (?, ?, ?) AND ended_at < ?"
+	query := "DELETE FROM session_players WHERE session_id IN (" + ended + ")"
+	if _, err := s.exec(ctx, tx, "session.delete_ended_players", query, model.SessionExpired, model.SessionAborted, model.SessionCompleted, endedBefore); err != nil {
+		return 0, err
+	}
+	query = "DELETE FROM session_spectators WHERE session_id IN (" + ended + ")"
+	if _, err := s.exec(ctx, tx, "session.delete_ended_spectators", query, model.SessionExpired, model.SessionAborted, model.SessionCompleted, endedBefore); err != nil {
+		return 0, err
+	}
+	query = "DELETE FROM match_notifications WHERE session_id IN (" + ended + ")"
+	if _, err := s.exec(ctx, tx, "session.delete_ended_notifications", query, model.SessionExpired, model.SessionAborted, model.SessionCompleted, endedBefore); err != nil {
+		return 0, err
+	}
+	res, err := s.exec(ctx, tx, "session.delete_ended", "DELETE FROM sessions WHERE status IN (?, ?, ?) AND ended_at < ?", model.SessionExpired, model.SessionAborted, model.SessionCompleted, endedBefore)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// UndeliveredNotifications は createdBefore より前に作成した未通知のマッチング結果を返します。
+func (s *mysqlStore) UndeliveredNotifications(ctx context.Context, createdBefore time.Time) ([]matchNotification, error) {
+	query := "SELECT session_id, created_at FROM match_notifications WHERE delivered_at IS NULL AND created_at < ? ORDER BY created_at ASC"
+	rows, err := s.query(ctx, s.DB, "notification.list_undelivered", query, createdBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var notifications []matchNotification
+	for rows.Next() {
+		var n matchNotification
+		if err := rows.Scan(&n.SessionID, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// MarkNotificationsDelivered はマッチング結果を通知済みにします。
+func (s *mysqlStore) MarkNotificationsDelivered(ctx context.Context, sessionIDs []string) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+	ids := make([]interface{}, len(sessionIDs))
+	for i, id := range sessionIDs {
+		ids[i] = id
+	}
+	query := "UPDATE match_notifications SET delivered_at = ? WHERE delivered_at IS NULL AND session_id IN (" + placeholders(len(ids)) + ")"
+	_, err := s.exec(ctx, s.DB, "notification.mark_delivered", query, append([]interface{}{s.cfg.now()}, ids...)...)
+	return err
+}
+
+// AbortUndeliveredSession は承諾待ち・確定済みのセッションを中止にし、マッチング結果を通知済みにします。
+func (s *mysqlStore) AbortUndeliveredSession(ctx context.Context, sessionID string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE sessions SET status = ?, ended_at = ? WHERE session_id = ? AND status IN (?, ?)"
+	if _, err := s.exec(ctx, tx, "session.abort_undelivered", query, model.SessionAborted, s.cfg.now(), sessionID, model.SessionPendingAccept, model.SessionActive); err != nil {
+		return err
+	}
+	if _, err := s.exec(ctx, tx, "notification.mark_delivered", "UPDATE match_notifications SET delivered_at = ? WHERE session_id = ?", s.cfg.now(), sessionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ensureParticipant はプレイヤーがセッションの参加者であることを確認します。
+func (s *mysqlStore) ensureParticipant(ctx context.Context, tx *sql.Tx, sessionID, playerID string) error {
+	var n int
+	query := "SELECT COUNT(*) FROM session_players WHERE session_id = ? AND player_id = ?"
+	if err := s.queryRow(ctx, tx, "session.count_participant", query, sessionID, playerID).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return model.ErrSessionNotFound
+	}
+	return nil
+}
+
+// incrementGamesPlayed は確定したセッションの参加者の対戦数を加算します。
+func (s *mysqlStore) incrementGamesPlayed(ctx context.Context, tx *sql.Tx, session model.SessionResult) error {
+	query := "UPDATE players SET games_played = games_played + 1, last_played_at = ? WHERE player_id = ?"
+	for _, p := range session.Participants {
+		if _, err := s.exec(ctx, tx, "player.increment_games_played", query, s.cfg.now(), p.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requeueSurvivors は中止されたセッションの参加者のうち、Requeued の参加者を元の待機開始時刻のまま待機キューへ戻します。
+// 有効期限は元のエントリのものを引き継ぎます（待機キューへ戻しても申告された有効期間を延ばさない）。
+func (s *mysqlStore) requeueSurvivors(ctx context.Context, tx *sql.Tx, session model.SessionResult) error {
+	query := `INSERT IGNORE INTO matchmaking_queue (player_id, party_id, region, game_mode, ping_ms, waiting_since, expires_at, priority, requeued,
+			min_rating, max_rating, max_rating_delta, attributes)
+		VALUES (?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, TRUE, ?, ?, ?, ?)`
+	for _, p := range session.Participants {
+		if !p.Requeued {
+			continue
+		}
+		if _, err := s.exec(ctx, tx, "queue.requeue", query, p.ID, p.PartyID, p.Region, session.GameMode, p.PingMS, p.WaitingSince, nullTime(p.ExpiresAt), p.Priority,
+			p.RatingRange.Min, p.RatingRange.Max, p.RatingRange.MaxDelta, nullAttributes(p.Attributes)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unfinishedSessions は ids のプレイヤーが参加している未終了（承諾待ち・確定）のセッションを、成立の古い順に返します。
+// lock には行のロックの指定（FOR UPDATE など。ロックしない場合は空文字）を渡します。
+func (s *mysqlStore) unfinishedSessions(ctx context.Context, q sqlQueryer, ids []interface{}, lock string) ([]playerSession, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	query := `SELECT sp.player_id, sp.session_id
+		FROM session_players sp
+		JOIN sessions s ON s.session_id = sp.session_id
+		WHERE sp.player_id IN (` + placeholders(len(ids)) + `) AND s.status IN (?, ?)
+		ORDER BY s.start_time, sp.session_id, sp.player_id ` + lock
+	rows, err := s.query(ctx, q, "session.list_unfinished_for_players", query, append(append([]interface{}{}, ids...), model.SessionPendingAccept, model.SessionActive)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var members []playerSession
+	for rows.Next() {
+		var m playerSession
+		if err := rows.Scan(&m.PlayerID, &m.SessionID); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// abandonSessions は members のプレイヤーの承諾状態を放棄（ReadyAbandoned）にしてセッションを中止し、中止したセッションを返します。
+// 他の参加者は辞退した参加者がいる場合と同じく、元の待機開始時刻のまま待機キューへ戻します（externalQueue の場合は呼び出し元で戻します）。
+func (s *mysqlStore) abandonSessions(ctx context.Context, tx *sql.Tx, members []playerSession) ([]model.SessionResult, error) {
+	sessionIDs, players := sessionMembers(members)
+	abandoned := make([]model.SessionResult, 0, len(sessionIDs))
+	for _, id := range sessionIDs {
+		args := []interface{}{model.ReadyAbandoned, id}
+		for _, playerID := range players[id] {
+			args = append(args, playerID)
+		}
+		query := "UPDATE session_players SET ready_state = ? WHERE session_id = ? AND player_id IN (" + placeholders(len(players[id])) + ")"
+		if _, err := s.exec(ctx, tx, "session.abandon", query, args...); err != nil {
+			return nil, err
+		}
+		session, _, err := s.resolveReadyCheckTx(ctx, tx, id, players[id][0], model.ReadyAbandoned)
+		if err != nil {
+			return nil, err
+		}
+		abandoned = append(abandoned, session)
+	}
+	return abandoned, nil
+}
+
+// dequeueRequeuedPlayer は中止されたセッションから待機キューへ戻されたプレイヤー（パーティの場合はパーティ全体）を取り除きます。
+func (s *mysqlStore) dequeueRequeuedPlayer(ctx context.Context, tx *sql.Tx, playerID string) error {
+	var partyID sql.NullString
+	query := "SELECT party_id FROM matchmaking_queue WHERE player_id = ? AND requeued = TRUE FOR UPDATE"
+	err := s.queryRow(ctx, tx, "queue.lock_requeued_player", query, playerID).Scan(&partyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if partyID.Valid {
+		_, err = s.exec(ctx, tx, "queue.delete_requeued_party", "DELETE FROM matchmaking_queue WHERE party_id = ? AND requeued = TRUE", partyID.String)
+	} else {
+		_, err = s.exec(ctx, tx, "queue.delete_requeued_player", "DELETE FROM matchmaking_queue WHERE player_id = ? AND requeued = TRUE", playerID)
+	}
+	return err
+}
+
+// getRecentOpponents は待機中エントリのプレイヤーについて、Config.RecentOpponentWindow 以内に対戦した組み合わせを取得します。
+func (s *mysqlStore) getRecentOpponents(ctx context.Context, q sqlQueryer, entries []model.QueueEntry) (model.OpponentSet, error) {
+	var ids []interface{}
+	for _, e := range entries {
+		for _, p := range e.Players {
+			ids = append(ids, p.ID)
+		}
+	}
+	recent := make(model.OpponentSet)
+	if len(ids) < 2 {
+		return recent, nil
+	}
+
+	query := `SELECT player_id, opponent_id FROM recent_matches
+		WHERE player_id IN (` + placeholders(len(ids)) + `) AND matched_at >= ?`
+	rows, err := s.query(ctx, q, "recent.list", query, append(ids, s.cfg.now().Add(-s.cfg.RecentOpponentWindow))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a, b string
+		if err := rows.Scan(&a, &b); err != nil {
+			return nil, err
+		}
+		recent.Add(a, b)
+	}
+	return recent, rows.Err()
+}
+
+// getBlockedPairs は待機中エントリのプレイヤー同士で、どちらかがもう一方をブロックしている組み合わせを1回のクエリで取得します。
+func (s *mysqlStore) getBlockedPairs(ctx context.Context, q sqlQueryer, entries []model.QueueEntry) (model.OpponentSet, error) {
+	var ids []interface{}
+	for _, e := range entries {
+		for _, p := range e.Players {
+			ids = append(ids, p.ID)
+		}
+	}
+	blocked := make(model.OpponentSet)
+	if len(ids) < 2 {
+		return blocked, nil
+	}
+
+	in := "(" + placeholders(len(ids)) + ")"
+	query := "SELECT player_id, blocked_id FROM blocked_pairs WHERE player_id IN " + in + " AND blocked_id IN " + in
+	rows, err := s.query(ctx, q, "blocks.list", query, append(append([]interface{}{}, ids...), ids...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a, b string
+		if err := rows.Scan(&a, &b); err != nil {
+			return nil, err
+		}
+		blocked.Add(a, b)
+	}
+	return blocked, rows.Err()
+}
+
+// recordRecentOpponents は確定したセッションで対戦した（異なるチームの）プレイヤーの組み合わせを記録します。
+// 参加者の古い記録はここで削除します。
+func (s *mysqlStore) recordRecentOpponents(ctx context.Context, tx *sql.Tx, session model.SessionResult) error {
+	now := s.cfg.now()
+	cleanup := "DELETE FROM recent_matches WHERE player_id = ? AND matched_at < ?"
+	for _, p := range session.Participants {
+		if _, err := s.exec(ctx, tx, "recent.cleanup", cleanup, p.ID, now.Add(-s.cfg.RecentOpponentWindow)); err != nil {
+			return err
+		}
+	}
+
+	query := `INSERT INTO recent_matches (player_id, opponent_id, matched_at) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE matched_at = VALUES(matched_at)`
+	for _, p := range session.Participants {
+		for _, o := range session.Participants {
+			if p.Team == o.Team || p.IsBot || o.IsBot {
+				continue
+			}
+			if _, err := s.exec(ctx, tx, "recent.upsert", query, p.ID, o.ID, now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetServiceState は service_state から値を取得します。未登録の場合は空文字を返します。
+func (s *mysqlStore) GetServiceState(ctx context.Context, key string) (string, error) {
+	var value string
+	err := s.queryRow(ctx, s.DB, "state.get", "SELECT state_value FROM service_state WHERE state_key = ?", key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+// SetServiceState は service_state に値を保存します。
+func (s *mysqlStore) SetServiceState(ctx context.Context, key, value string) error {
+	query := `INSERT INTO service_state (state_key, state_value, updated_at) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE state_value = VALUES(state_value), updated_at = VALUES(updated_at)`
+	_, err := s.exec(ctx, s.DB, "state.set", query, key, value, s.cfg.now())
+	return err
+}
+
+// CompareAndSwapServiceState は service_state の key の値が old の場合のみ new に置き換えます。
+// 未登録のキーは old が空文字の場合のみ登録し、new が空文字の場合は行を削除します。
+func (s *mysqlStore) CompareAndSwapServiceState(ctx context.Context, key, old, new string) (bool, error) {
+	var res sql.Result
+	var err error
+	switch {
+	case old == "":
+		// 登録済みの行は値が空文字の場合のみ更新する（更新しなかった場合の影響行数は 0）
+		query := `INSERT INTO service_state (state_key, state_value, updated_at) VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE updated_at = IF(state_value = '', VALUES(updated_at), updated_at),
+				state_value = IF(state_value = '', VALUES(state_value), state_value)`
+		res, err = s.exec(ctx, s.DB, "state.cas_insert", query, key, new, s.cfg.now())
+	case new == "":
+		res, err = s.exec(ctx, s.DB, "state.cas_delete", "DELETE FROM service_state WHERE state_key = ? AND state_value = ?", key, old)
+	default:
+		res, err = s.exec(ctx, s.DB, "state.cas_update", "UPDATE service_state SET state_value = ?, updated_at = ? WHERE state_key = ? AND state_value = ?", new, s.cfg.now(), key, old)
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// BackfillGamesPlayed は確定した（active・expired・completed の）セッションから、プレイヤーID順に players.games_played を再計算します。
+func (s *mysqlStore) BackfillGamesPlayed(ctx context.Context, cursor string, limit int) (string, int, error) {
+	ids, err := s.backfillPlayerIDs(ctx, cursor, limit)
+	if err != nil {
+		return "", 0, err
+	}
+
+	query := `UPDATE players SET games_played = (
+			SELECT COUNT(*) FROM session_players sp
+			JOIN sessions s ON s.session_id = sp.session_id
+			WHERE sp.player_id = players.player_id AND s.status IN (?, ?, ?)
+		) WHERE player_id = ?`
+	for _, id := range ids {
+		if _, err := s.exec(ctx, s.DB, "backfill.update_games_played", query, model.SessionActive, model.SessionExpired, model.SessionCompleted, id); err != nil {
+			return "", 0, err
+		}
+	}
+	if len(ids) == 0 {
+		return cursor, 0, nil
+	}
+	return ids[len(ids)-1], len(ids), nil
+}
+
+// DecayInactiveRatings は対戦していないプレイヤーのレーティングを mean へ近づけます。
+// 計算は decayedRating と同じく、mean との差に (1 - factor) を掛けて 0 の方向へ切り捨てます。
+func (s *mysqlStore) DecayInactiveRatings(ctx context.Context, inactiveBefore, decayedBefore time.Time, mean int, factor float64) (int64, error) {
+	query := `UPDATE players SET rating = ? + TRUNCATE((rating - ?) * ?, 0), rating_decayed_at = ?
+		WHERE COALESCE(last_played_at, created_at) < ? AND (rating_decayed_at IS NULL OR rating_decayed_at < ?) AND rating <> ?`
+	res, err := s.exec(ctx, s.DB, "players.decay_ratings", query, mean, mean, 1-factor, s.cfg.now(), inactiveBefore, decayedBefore, mean)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeletePlayers はプレイヤーと、そのプレイヤーに関係する行を1つのトランザクションで削除します。
+func (s *mysqlStore) DeletePlayers(ctx context.Context, playerIDs []string) error {
+	if len(playerIDs) == 0 {
+		return nil
+	}
+	ids := make([]interface{}, len(playerIDs))
+	for i, id := range playerIDs {
+		ids[i] = id
+	}
+	in := "(" + placeholders(len(ids)) + ")"
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	rows, err := s.query(ctx, tx, "players.lock_sessions", "SELECT DISTINCT session_id FROM session_players WHERE player_id IN "+in+" FOR UPDATE", ids...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	var sessionIDs []interface{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return err
+		}
+		sessionIDs = append(sessionIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	type stmt struct {
+		query string
+		args  []interface{}
+	}
+	var stmts []stmt
+	if len(sessionIDs) > 0 {
+		sessions := "(" + placeholders(len(sessionIDs)) + ")"
+		stmts = append(stmts,
+			stmt{"DELETE FROM session_players WHERE session_id IN " + sessions, sessionIDs},
+			stmt{"DELETE FROM session_spectators WHERE session_id IN " + sessions, sessionIDs},
+			stmt{"DELETE FROM match_notifications WHERE session_id IN " + sessions, sessionIDs},
+			stmt{"DELETE FROM sessions WHERE session_id IN " + sessions, sessionIDs},
+		)
+	}
+	stmts = append(stmts,
+		stmt{"DELETE FROM matchmaking_queue WHERE player_id IN " + in, ids},
+		stmt{"DELETE FROM recent_matches WHERE player_id IN " + in + " OR opponent_id IN " + in, append(append([]interface{}{}, ids...), ids...)},
+		stmt{"DELETE FROM blocked_pairs WHERE player_id IN " + in + " OR blocked_id IN " + in, append(append([]interface{}{}, ids...), ids...)},
+		stmt{"DELETE FROM head_to_head WHERE player_id IN " + in + " OR opponent_id IN " + in, append(append([]interface{}{}, ids...), ids...)},
+		stmt{"DELETE FROM session_spectators WHERE player_id IN " + in, ids},
+		stmt{"DELETE FROM queue_history WHERE player_id IN " + in, ids},
+		stmt{"DELETE FROM players WHERE player_id IN " + in, ids},
+	)
+	for _, st := range stmts {
+		if _, err := s.exec(ctx, tx, "players.delete_related", st.query, st.args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// nullTime はゼロ値の時刻を NULL として DB に渡すための値に変換します。
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// 応答しない DB でも、マッチングのトランザクションは context の期限で打ち切られ、ロールバックされる
+func TestCreateSessionsHonorsDeadline(t *testing.T) {
+	f := &fakeDB{hang: func(q string) bool { return strings.Contains(q, "FOR UPDATE") }}
+	s := newFakeMySQLStore(t, f)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	planned := false
+	plan := func([]model.QueueEntry, model.OpponentSet, model.OpponentSet) []model.SessionResult {
+		planned = true
+		return nil
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.CreateSessions(ctx, plan)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("CreateSessions did not return after the deadline")
+	}
+	if planned {
+		t.Error("plan was called after the queue query failed")
+	}
+	// database/sql は期限切れのトランザクションを非同期にロールバックする
+	deadline := time.Now().Add(time.Second)
+	for !slices.Contains(f.queries(), "ROLLBACK") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := f.queries(); !slices.Contains(got, "ROLLBACK") || slices.Contains(got, "COMMIT") {
+		t.Fatalf("statements = %q, want the transaction rolled back", got)
+	}
+}
+
+// ハンドラのリクエストが取り消された場合も、DB への問い合わせを待ち続けない
+func TestStoreCallsHonorCancellation(t *testing.T) {
+	f := &fakeDB{hang: func(string) bool { return true }}
+	s := newFakeMySQLStore(t, f)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.EnqueueEntry(ctx, model.QueueEntry{Players: []model.Player{{ID: "alice", Rating: 1500}}, Rating: 1500, GameMode: "duel"})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("EnqueueEntry did not return after the request was cancelled")
+	}
+}
@@ -0,0 +1,11 @@
+package store
+
+import (
+	"time"
+)
+
+// matchNotification はアウトボックスに登録した、まだ通知できていないマッチング結果です。
+type matchNotification struct {
+	SessionID string
+	CreatedAt time.Time
+}
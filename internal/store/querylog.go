@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/tracing"
+)
+
+// クエリのパラメータをログに出力する方法（環境変数 LOG_QUERY_PARAMS）
+const (
+	// QueryParamsNone はパラメータを出力しません。
+	QueryParamsNone = "none"
+	// QueryParamsRedacted は文字列（プレイヤー ID など）を型と長さに置き換え、それ以外の値のみ出力します。
+	QueryParamsRedacted = "redacted"
+	// QueryParamsFull はパラメータをそのまま出力します。個人を特定できる値が含まれるため、開発環境向けです。
+	QueryParamsFull = "full"
+)
+
+// explainTimeout は EXPLAIN の取得と保存にかける時間の上限です。
+const explainTimeout = 5 * time.Second
+
+// exec は name という名前で計測しながら r で書き込みのクエリを実行します。
+// 名前はダッシュボードでの集計に使うため、クエリを書いた場所で固定の値を付けます。
+func (s *mysqlStore) exec(ctx context.Context, r sqlQueryer, name, query string, args ...interface{}) (sql.Result, error) {
+	span := tracing.StartQuerySpan(ctx, name)
+	started := time.Now()
+	res, err := r.ExecContext(ctx, query, args...)
+	s.observeQuery(name, query, args, time.Since(started))
+	tracing.EndQuerySpan(span, err)
+	return res, err
+}
+
+// query は name という名前で計測しながら r で読み取りのクエリを実行します。
+func (s *mysqlStore) query(ctx context.Context, r sqlQueryer, name, query string, args ...interface{}) (*sql.Rows, error) {
+	span := tracing.StartQuerySpan(ctx, name)
+	started := time.Now()
+	rows, err := r.QueryContext(ctx, query, args...)
+	s.observeQuery(name, query, args, time.Since(started))
+	tracing.EndQuerySpan(span, err)
+	return rows, err
+}
+
+// queryRow は name という名前で計測しながら r で1行を返すクエリを実行します。
+func (s *mysqlStore) queryRow(ctx context.Context, r sqlQueryer, name, query string, args ...interface{}) *sql.Row {
+	span := tracing.StartQuerySpan(ctx, name)
+	started := time.Now()
+	row := r.QueryRowContext(ctx, query, args...)
+	s.observeQuery(name, query, args, time.Since(started))
+	tracing.EndQuerySpan(span, row.Err())
+	return row
+}
+
+// observeQuery はクエリの実行時間を記録し、遅いクエリはパラメータを伏せてログに出力します。
+// 機能フラグ explain_capture が有効な場合は、遅い読み取りのクエリの EXPLAIN を回数の上限まで取得します。
+// 書き込みのクエリはマッチングのトランザクション内で実行されることがあるため、EXPLAIN を取得しません。
+func (s *mysqlStore) observeQuery(name, query string, args []interface{}, d time.Duration) {
+	metrics.StoreQuerySeconds.WithLabelValues(name).Observe(d.Seconds())
+	if s.cfg.SlowQueryThreshold <= 0 || d < s.cfg.SlowQueryThreshold {
+		return
+	}
+	slog.Warn("slow query", "query", name, "duration_ms", durationMS(d), "params", redactQueryArgs(args, s.cfg.QueryParams))
+
+	if !isReadStatement(query) || s.cfg.ExplainCapture == nil || !s.cfg.ExplainCapture() || s.explainBudget == nil {
+		return
+	}
+	if ok, _ := s.explainBudget.Allow(name); !ok {
+		return
+	}
+	// 呼び出し元のトランザクションを延ばさないよう、別の接続で非同期に取得する
+	go s.captureExplain(name, query, args, d)
+}
+
+// captureExplain はクエリの実行計画を取得して query_diagnostics に保存します。
+func (s *mysqlStore) captureExplain(name, query string, args []interface{}, d time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), explainTimeout)
+	defer cancel()
+
+	var plan string
+	if err := s.DB.QueryRowContext(ctx, "EXPLAIN FORMAT=JSON "+query, args...).Scan(&plan); err != nil {
+		slog.Warn("EXPLAIN 取得エラー", "func", "captureExplain", "query", name, "error", err)
+		return
+	}
+	insert := "INSERT INTO query_diagnostics (query_name, statement, duration_ms, plan, captured_at) VALUES (?, ?, ?, ?, ?)"
+	if _, err := s.DB.ExecContext(ctx, insert, name, query, durationMS(d), plan, s.cfg.now()); err != nil {
+		slog.Warn("実行計画保存エラー", "func", "captureExplain", "query", name, "error", err)
+		return
+	}
+	slog.Info("query plan captured", "query", name, "duration_ms", durationMS(d))
+}
+
+// isReadStatement はクエリが SELECT 文かどうかを返します。
+func isReadStatement(query string) bool {
+	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(query)), "SELECT")
+}
+
+// durationMS は d をミリ秒で返します。
+func durationMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// redactQueryArgs はクエリのパラメータを mode に従ってログ出力用の文字列にします。
+func redactQueryArgs(args []interface{}, mode string) []string {
+	if mode == QueryParamsNone || len(args) == 0 {
+		return nil
+	}
+	out := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			if mode == QueryParamsFull {
+				out[i] = v
+			} else {
+				out[i] = fmt.Sprintf("string(len=%d)", len(v))
+			}
+		case []byte:
+			out[i] = fmt.Sprintf("bytes(len=%d)", len(v))
+		default:
+			out[i] = fmt.Sprint(v)
+		}
+	}
+	return out
+}
+
+// queryDiagnostic は保存された遅いクエリの実行計画です。
+type queryDiagnostic struct {
+	ID         int64           `json:"id"`
+	QueryName  string          `json:"query_name"`
+	Statement  string          `json:"statement"`
+	DurationMS float64         `json:"duration_ms"`
+	Plan       json.RawMessage `json:"plan"`
+	CapturedAt time.Time       `json:"captured_at"`
+}
+
+// MaxQueryDiagnostics は GET /admin/diagnostics/queries で返す件数の上限です。
+const MaxQueryDiagnostics = 100
+
+// QueryDiagnostics は保存された実行計画を新しい順に最大 limit 件返します。
+func (s *mysqlStore) QueryDiagnostics(ctx context.Context, limit int) ([]queryDiagnostic, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT id, query_name, statement, duration_ms, plan, captured_at
+		FROM query_diagnostics ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	diagnostics := []queryDiagnostic{}
+	for rows.Next() {
+		var d queryDiagnostic
+		var plan string
+		if err := rows.Scan(&d.ID, &d.QueryName, &d.Statement, &d.DurationMS, &plan, &d.CapturedAt); err != nil {
+			return nil, err
+		}
+		d.Plan = json.RawMessage(plan)
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics, rows.Err()
+}
@@ -0,0 +1,284 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"matchmaking_project/internal/ratelimit"
+	"matchmaking_project/internal/tracing"
+)
+
+// slowFakeDB は "slow" を含む文の実行に delay かかる fakeDB を返します。EXPLAIN には空の実行計画を返します。
+func slowFakeDB(delay time.Duration) *fakeDB {
+	wait := func(q string) {
+		if strings.Contains(q, "slow") && !strings.HasPrefix(q, "EXPLAIN") {
+			time.Sleep(delay)
+		}
+	}
+	return &fakeDB{
+		query: func(q string, _ []driver.Value) ([]string, [][]driver.Value, error) {
+			wait(q)
+			if strings.HasPrefix(q, "EXPLAIN") {
+				return []string{"EXPLAIN"}, [][]driver.Value{{"{}"}}, nil
+			}
+			return nil, nil, nil
+		},
+		exec: func(q string, _ []driver.Value) error {
+			wait(q)
+			return nil
+		},
+	}
+}
+
+// syncBuffer は複数の goroutine から書き込めるログの出力先です。
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// String は出力されたログを返します。
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// slowQueryLogs は出力された "slow query" のログを返します。
+func (b *syncBuffer) slowQueryLogs(t *testing.T) []map[string]interface{} {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		if rec["msg"] == "slow query" {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+// captureDefaultLogs はテストの間 slog の既定のロガーの出力を記録します。
+func captureDefaultLogs(t *testing.T) *syncBuffer {
+	t.Helper()
+	b := &syncBuffer{}
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(b, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return b
+}
+
+func TestSlowQueryThreshold(t *testing.T) {
+	logs := captureDefaultLogs(t)
+	s := newFakeMySQLStore(t, slowFakeDB(30*time.Millisecond))
+	s.cfg.SlowQueryThreshold = 20 * time.Millisecond
+	ctx := context.Background()
+
+	rows, err := s.query(ctx, s.DB, "queue.fast", "SELECT fast FROM queue WHERE player_id = ?", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if got := logs.slowQueryLogs(t); len(got) != 0 {
+		t.Fatalf("fast query logged: %v", got)
+	}
+
+	if _, err := s.exec(ctx, s.DB, "queue.slow_update", "UPDATE slow SET rating = ? WHERE player_id = ?", 1500, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	got := logs.slowQueryLogs(t)
+	if len(got) != 1 || got[0]["query"] != "queue.slow_update" || got[0]["duration_ms"].(float64) < 20 {
+		t.Fatalf("slow query logs = %v, want queue.slow_update over 20ms", got)
+	}
+
+	// しきい値が 0 の場合は出力しない
+	s.cfg.SlowQueryThreshold = 0
+	s.exec(ctx, s.DB, "queue.slow_update", "UPDATE slow SET rating = ?", 1500)
+	if got := logs.slowQueryLogs(t); len(got) != 1 {
+		t.Fatalf("slow query logs with the threshold off = %d, want still 1", len(got))
+	}
+}
+
+func TestRedactQueryArgs(t *testing.T) {
+	args := []interface{}{"alice", 1500, []byte("secret"), time.Second}
+	for _, tc := range []struct {
+		mode string
+		want []string
+	}{
+		{QueryParamsNone, nil},
+		{QueryParamsRedacted, []string{"string(len=5)", "1500", "bytes(len=6)", "1s"}},
+		{QueryParamsFull, []string{"alice", "1500", "bytes(len=6)", "1s"}},
+	} {
+		if got := redactQueryArgs(args, tc.mode); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: %q, want %q", tc.mode, got, tc.want)
+		}
+	}
+
+	// 遅いクエリのログにはプレイヤー ID をそのまま出力しない
+	logs := captureDefaultLogs(t)
+	s := newFakeMySQLStore(t, slowFakeDB(10*time.Millisecond))
+	s.cfg.SlowQueryThreshold = time.Millisecond
+	s.exec(context.Background(), s.DB, "players.slow_update", "UPDATE slow SET rating = ? WHERE id = ?", 1600, "alice")
+	got := logs.slowQueryLogs(t)
+	if len(got) != 1 {
+		t.Fatalf("slow query logs = %v, want 1", got)
+	}
+	if params, _ := json.Marshal(got[0]["params"]); string(params) != `["1600","string(len=5)"]` {
+		t.Errorf("params = %s, want the player id redacted", params)
+	}
+}
+
+// EXPLAIN は機能フラグが有効な場合に、遅い読み取りのクエリのみ回数の上限まで取得する
+func TestExplainCaptureBudget(t *testing.T) {
+	captureDefaultLogs(t)
+	f := slowFakeDB(10 * time.Millisecond)
+	s := newFakeMySQLStore(t, f)
+	s.cfg.SlowQueryThreshold = time.Millisecond
+	enabled := false
+	s.cfg.ExplainCapture = func() bool { return enabled }
+	s.explainBudget = ratelimit.New(ratelimit.Config{RPS: 1.0 / 3600, Burst: 2}, func() time.Time { return appEpoch })
+	ctx := context.Background()
+	selectSlow := func() {
+		rows, err := s.query(ctx, s.DB, "queue.slow_list", "SELECT slow FROM queue WHERE region = ?", "asia")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+	}
+
+	// フラグが無効な場合は取得しない
+	selectSlow()
+
+	// マッチングのトランザクション内の書き込みは、フラグが有効でも取得しない
+	enabled = true
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{"UPDATE slow SET status = ?", "INSERT INTO slow (id) VALUES (?)", "DELETE FROM slow WHERE id = ?"} {
+		if _, err := s.exec(ctx, tx, "sessions.slow_write", q, "x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 4 {
+		selectSlow()
+	}
+	// 取得は非同期のため、保存されるまで待つ
+	saved := func() int {
+		n := 0
+		for _, q := range f.queries() {
+			if strings.HasPrefix(q, "INSERT INTO query_diagnostics") {
+				n++
+			}
+		}
+		return n
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for saved() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	var explained []string
+	for _, q := range f.queries() {
+		if strings.HasPrefix(q, "EXPLAIN") {
+			explained = append(explained, q)
+		}
+	}
+	if len(explained) != 2 || saved() != 2 {
+		t.Fatalf("explained %q and saved %d plans, want 2 within the budget", explained, saved())
+	}
+	for _, q := range explained {
+		if q != "EXPLAIN FORMAT=JSON SELECT slow FROM queue WHERE region = ?" {
+			t.Errorf("explained %q, want only the slow SELECT", q)
+		}
+	}
+}
+
+// spanExporter はテストで記録したスパンの出力先です。
+// tracing.Tracer はグローバルの TracerProvider に最初に設定したものへ委譲し続けるため、パッケージで1回だけ設定します。
+var spanExporter = sync.OnceValue(func() *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	return exporter
+})
+
+// クエリごとに呼び出し元のスパンの子スパンを記録し、失敗したクエリはスパンにエラーを記録する
+func TestQuerySpans(t *testing.T) {
+	exporter := spanExporter()
+	exporter.Reset()
+	t.Cleanup(exporter.Reset)
+	s := newFakeMySQLStore(t, &fakeDB{exec: func(q string, _ []driver.Value) error {
+		if strings.Contains(q, "broken") {
+			return errors.New("deadlock")
+		}
+		return nil
+	}})
+
+	ctx, parent := tracing.Tracer.Start(context.Background(), "matchmaking.tick")
+	rows, err := s.query(ctx, s.DB, "queue.list", "SELECT id FROM queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if _, err := s.exec(ctx, s.DB, "queue.update", "UPDATE queue SET rating = ?", 1500); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.exec(ctx, s.DB, "queue.broken", "UPDATE broken SET rating = ?", 1500); err == nil {
+		t.Fatal("broken statement succeeded")
+	}
+	parent.End()
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	for _, name := range []string{"queue.list", "queue.update", "queue.broken"} {
+		span, ok := spans["db "+name]
+		if !ok {
+			t.Errorf("no span for %s, got %v", name, exporter.GetSpans())
+			continue
+		}
+		if span.Parent.SpanID() != parent.SpanContext().SpanID() || span.SpanKind != trace.SpanKindClient {
+			t.Errorf("%s: parent %s, kind %v, want a client span under the caller's span", name, span.Parent.SpanID(), span.SpanKind)
+		}
+		want := codes.Unset
+		if name == "queue.broken" {
+			want = codes.Error
+		}
+		if span.Status.Code != want {
+			t.Errorf("%s: status %v, want %v", name, span.Status, want)
+		}
+	}
+}
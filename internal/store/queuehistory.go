@@ -0,0 +1,199 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// QueueOutcome は待機キューでの待機の終わり方です（queue_history.outcome）。
+type QueueOutcome string
+
+const (
+	QueueOutcomeMatched   QueueOutcome = "matched"
+	QueueOutcomeTimedOut  QueueOutcome = "timed_out"
+	QueueOutcomeCancelled QueueOutcome = "cancelled"
+)
+
+// QueueHistoryRecord は待機を終えたプレイヤー1人分の記録です（待機の公平性の監査用）。
+type QueueHistoryRecord struct {
+	PlayerID string
+	// Rating は待機キューに登録した時点のプレイヤーのレーティングです。
+	Rating     int
+	GameMode   string
+	EnqueuedAt time.Time
+	ResolvedAt time.Time
+	Outcome    QueueOutcome
+}
+
+// WaitBandStats はレーティング帯ごとの待機の集計です。
+type WaitBandStats struct {
+	// MinRating, MaxRating は帯に含まれるレーティングの範囲です（両端を含む）。
+	MinRating int `json:"min_rating"`
+	MaxRating int `json:"max_rating"`
+	Entries   int `json:"entries"`
+	Matched   int `json:"matched"`
+	TimedOut  int `json:"timed_out"`
+	Cancelled int `json:"cancelled"`
+	// TimeoutRate は待機を終えたプレイヤーのうちタイムアウトした割合です。
+	TimeoutRate float64 `json:"timeout_rate"`
+	// WaitP50Seconds, WaitP90Seconds, WaitP99Seconds はマッチングが成立したプレイヤーの、待機開始から成立までの時間のパーセンタイルです。
+	WaitP50Seconds float64 `json:"wait_p50_seconds"`
+	WaitP90Seconds float64 `json:"wait_p90_seconds"`
+	WaitP99Seconds float64 `json:"wait_p99_seconds"`
+}
+
+// newWaitBands は境界 bands で区切ったレーティング帯（len(bands)+1 個）の、件数が 0 の集計を返します。
+func newWaitBands(bands []int) []WaitBandStats {
+	stats := make([]WaitBandStats, len(bands)+1)
+	for i := range stats {
+		stats[i].MinRating = model.MinRating
+		if i > 0 {
+			stats[i].MinRating = bands[i-1]
+		}
+		stats[i].MaxRating = model.MaxRating
+		if i < len(bands) {
+			stats[i].MaxRating = bands[i] - 1
+		}
+	}
+	return stats
+}
+
+// ratingBand は rating が含まれるレーティング帯の番号を返します（MySQL の INTERVAL と同じく、rating 以下の境界の数）。
+func ratingBand(bands []int, rating int) int {
+	return sort.SearchInts(bands, rating+1)
+}
+
+// RecordQueueHistory は待機の記録をまとめて保存します。
+func (s *mysqlStore) RecordQueueHistory(ctx context.Context, records []QueueHistoryRecord) error {
+	args := make([]interface{}, 0, len(records)*6)
+	values := make([]string, 0, len(records))
+	for _, r := range records {
+		values = append(values, "(?, ?, ?, ?, ?, ?)")
+		args = append(args, r.PlayerID, r.Rating, r.GameMode, r.EnqueuedAt, r.ResolvedAt, string(r.Outcome))
+	}
+	query := "INSERT INTO queue_history (player_id, rating, game_mode, enqueued_at, resolved_at, outcome) VALUES " + strings.Join(values, ", ")
+	if _, err := s.exec(ctx, s.DB, "queue_history.insert", query, args...); err != nil {
+		return fmt.Errorf("待機履歴保存エラー: %v", err)
+	}
+	return nil
+}
+
+// WaitStats は since 以降に待機を終えたプレイヤーを、境界 bands で区切ったレーティング帯ごとに集計します。mode が空でなければそのゲームモードだけを集計します。
+// レーティング帯は INTERVAL で求め、待機時間のパーセンタイルは MatchQualityStats と同じく ROW_NUMBER で最近傍順位法により求めます。
+func (s *mysqlStore) WaitStats(ctx context.Context, since time.Time, mode string, bands []int) ([]WaitBandStats, error) {
+	band := "0"
+	var args []interface{}
+	if len(bands) > 0 {
+		band = "INTERVAL(rating, " + placeholders(len(bands)) + ")"
+		for _, b := range bands {
+			args = append(args, b)
+		}
+	}
+	where := "resolved_at >= ?"
+	args = append(args, since)
+	if mode != "" {
+		where += " AND game_mode = ?"
+		args = append(args, mode)
+	}
+	query := `SELECT band, COUNT(*), SUM(outcome = 'matched'), SUM(outcome = 'timed_out'), SUM(outcome = 'cancelled'),
+			COALESCE(MAX(CASE WHEN outcome = 'matched' AND rn <= CEIL(0.5 * matched) THEN wait END), 0),
+			COALESCE(MAX(CASE WHEN outcome = 'matched' AND rn <= CEIL(0.9 * matched) THEN wait END), 0),
+			COALESCE(MAX(CASE WHEN outcome = 'matched' AND rn <= CEIL(0.99 * matched) THEN wait END), 0)
+		FROM (
+			SELECT band, outcome, wait,
+				ROW_NUMBER() OVER (PARTITION BY band, outcome ORDER BY wait) AS rn,
+				SUM(outcome = 'matched') OVER (PARTITION BY band) AS matched
+			FROM (
+				SELECT ` + band + ` AS band, outcome, TIMESTAMPDIFF(MICROSECOND, enqueued_at, resolved_at) / 1000000 AS wait
+				FROM queue_history WHERE ` + where + `
+			) h
+		) w
+		GROUP BY band`
+	rows, err := s.query(ctx, s.DB, "stats.waits", query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("待機履歴集計エラー: %v", err)
+	}
+	defer rows.Close()
+	stats := newWaitBands(bands)
+	for rows.Next() {
+		var i int
+		var b WaitBandStats
+		if err := rows.Scan(&i, &b.Entries, &b.Matched, &b.TimedOut, &b.Cancelled, &b.WaitP50Seconds, &b.WaitP90Seconds, &b.WaitP99Seconds); err != nil {
+			return nil, fmt.Errorf("待機履歴集計エラー: %v", err)
+		}
+		b.MinRating, b.MaxRating = stats[i].MinRating, stats[i].MaxRating
+		stats[i] = b
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("待機履歴集計エラー: %v", err)
+	}
+	return stats, nil
+}
+
+// DeleteQueueHistory は resolvedBefore より前に待機を終えた記録を削除し、削除した件数を返します。
+func (s *mysqlStore) DeleteQueueHistory(ctx context.Context, resolvedBefore time.Time) (int64, error) {
+	res, err := s.exec(ctx, s.DB, "queue_history.delete", "DELETE FROM queue_history WHERE resolved_at < ?", resolvedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RecordQueueHistory は待機の記録を保存します。
+func (s *MemoryStore) RecordQueueHistory(ctx context.Context, records []QueueHistoryRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queueHistory = append(s.queueHistory, records...)
+	return nil
+}
+
+// WaitStats は since 以降に待機を終えたプレイヤーを、境界 bands で区切ったレーティング帯ごとに集計します。
+func (s *MemoryStore) WaitStats(ctx context.Context, since time.Time, mode string, bands []int) ([]WaitBandStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := newWaitBands(bands)
+	waits := make([][]float64, len(stats))
+	for _, r := range s.queueHistory {
+		if r.ResolvedAt.Before(since) || (mode != "" && r.GameMode != mode) {
+			continue
+		}
+		i := ratingBand(bands, r.Rating)
+		stats[i].Entries++
+		switch r.Outcome {
+		case QueueOutcomeMatched:
+			stats[i].Matched++
+			waits[i] = append(waits[i], r.ResolvedAt.Sub(r.EnqueuedAt).Seconds())
+		case QueueOutcomeTimedOut:
+			stats[i].TimedOut++
+		case QueueOutcomeCancelled:
+			stats[i].Cancelled++
+		}
+	}
+	for i := range stats {
+		sort.Float64s(waits[i])
+		stats[i].WaitP50Seconds = nearestRankPercentile(waits[i], 0.5)
+		stats[i].WaitP90Seconds = nearestRankPercentile(waits[i], 0.9)
+		stats[i].WaitP99Seconds = nearestRankPercentile(waits[i], 0.99)
+	}
+	return stats, nil
+}
+
+// DeleteQueueHistory は resolvedBefore より前に待機を終えた記録を削除し、削除した件数を返します。
+func (s *MemoryStore) DeleteQueueHistory(ctx context.Context, resolvedBefore time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.queueHistory[:0]
+	for _, r := range s.queueHistory {
+		if !r.ResolvedAt.Before(resolvedBefore) {
+			kept = append(kept, r)
+		}
+	}
+	n := int64(len(s.queueHistory) - len(kept))
+	s.queueHistory = kept
+	return n, nil
+}
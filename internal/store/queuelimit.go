@@ -0,0 +1,35 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// queueAdmissionStateKey は MySQL で待機キューへの登録を直列化するための service_state のキーです。
+const queueAdmissionStateKey = "queue_admission"
+
+// ErrQueueFull は待機キューが上限（Config.MaxQueueSize）に達しているため登録できない場合のエラーです。
+var ErrQueueFull = errors.New("matchmaking queue is full")
+
+// checkQueueCapacity は tx の中で待機キューの人数を数え、n 人を登録できなければ ErrQueueFull を返します。
+// 人数の確認と登録の間に他のリクエストが登録しないよう、service_state の行をロックして登録をトランザクションの終了まで直列化します
+// （削除は人数を減らすだけなので直列化しません）。上限を設定していない場合は何もしません。
+func (s *mysqlStore) checkQueueCapacity(ctx context.Context, tx *sql.Tx, n int) error {
+	if s.cfg.MaxQueueSize <= 0 {
+		return nil
+	}
+	lock := `INSERT INTO service_state (state_key, state_value, updated_at) VALUES (?, '', ?)
+		ON DUPLICATE KEY UPDATE state_value = state_value`
+	if _, err := s.exec(ctx, tx, "queue.admission_lock", lock, queueAdmissionStateKey, s.cfg.now()); err != nil {
+		return err
+	}
+	var current int
+	if err := s.queryRow(ctx, tx, "queue.count", "SELECT COUNT(*) FROM matchmaking_queue").Scan(&current); err != nil {
+		return err
+	}
+	if !s.cfg.queueHasRoom(current, n) {
+		return ErrQueueFull
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"matchmaking_project/internal/model"
+)
+
+// MySQL では admission のロックを取ってから人数を数え、上限に達していれば登録せずにロールバックする
+func TestEnqueueEntryQueueFull(t *testing.T) {
+	f := &fakeDB{query: func(q string, _ []driver.Value) ([]string, [][]driver.Value, error) {
+		switch {
+		case q == "SELECT COUNT(*) FROM matchmaking_queue":
+			return []string{"COUNT(*)"}, [][]driver.Value{{int64(3)}}, nil
+		case strings.HasPrefix(q, "SELECT COUNT(*)"):
+			// 戻されたエントリはない
+			return []string{"COUNT(*)"}, [][]driver.Value{{int64(0)}}, nil
+		}
+		return nil, nil, nil
+	}}
+	s := newFakeMySQLStore(t, f)
+	s.cfg.MaxQueueSize = 3
+
+	_, err := s.EnqueueEntry(context.Background(), model.QueueEntry{Players: []model.Player{{ID: "alice", Rating: 1500}}, Rating: 1500, GameMode: "duel"})
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("err = %v, want ErrQueueFull", err)
+	}
+	queries := f.queries()
+	lock := slices.IndexFunc(queries, func(q string) bool { return strings.Contains(q, "INSERT INTO service_state") })
+	count := slices.Index(queries, "SELECT COUNT(*) FROM matchmaking_queue")
+	if lock < 0 || count < lock {
+		t.Fatalf("statements = %q, want the admission lock before the count", queries)
+	}
+	if got := f.find(t, "INSERT INTO service_state").Args[0]; got != queueAdmissionStateKey {
+		t.Errorf("lock key = %v, want %q", got, queueAdmissionStateKey)
+	}
+	if slices.ContainsFunc(queries, func(q string) bool { return strings.Contains(q, "INSERT INTO matchmaking_queue") }) {
+		t.Fatalf("statements = %q, want nothing inserted into the queue", queries)
+	}
+	if !slices.Contains(queries, "ROLLBACK") || slices.Contains(queries, "COMMIT") {
+		t.Fatalf("statements = %q, want the transaction rolled back", queries)
+	}
+}
+
+func TestQueueHasRoom(t *testing.T) {
+	for _, tc := range []struct {
+		max, current, n int
+		want            bool
+	}{
+		{0, 1000, 4, true},
+		{3, 2, 1, true},
+		{3, 3, 1, false},
+		// パーティは全員分の空きが必要
+		{3, 2, 2, false},
+	} {
+		if got := (Config{MaxQueueSize: tc.max}).queueHasRoom(tc.current, tc.n); got != tc.want {
+			t.Errorf("max %d, current %d, adding %d = %v, want %v", tc.max, tc.current, tc.n, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+package store
+
+// decayedRating は rating を mean へ factor の割合だけ近づけたレーティングを返します。
+func decayedRating(rating, mean int, factor float64) int {
+	return mean + int(float64(rating-mean)*(1-factor))
+}
@@ -0,0 +1,25 @@
+package store
+
+import (
+	"matchmaking_project/internal/model"
+)
+
+// allAccepted は参加者全員が承諾済みかどうかを返します。
+func allAccepted(session model.SessionResult) bool {
+	for _, p := range session.Participants {
+		if p.ReadyState != model.ReadyAccepted {
+			return false
+		}
+	}
+	return true
+}
+
+// anyDeclined は辞退した（またはゲームに現れなかった、セッションを放棄した）参加者がいるかどうかを返します。
+func anyDeclined(session model.SessionResult) bool {
+	for _, p := range session.Participants {
+		if p.ReadyState == model.ReadyDeclined || p.ReadyState == model.ReadyNoShow || p.ReadyState == model.ReadyAbandoned {
+			return true
+		}
+	}
+	return false
+}
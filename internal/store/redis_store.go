@@ -0,0 +1,613 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"matchmaking_project/internal/model"
+)
+
+// Redis のキー。待機キューは待機開始時刻（ミリ秒）をスコアとする ZSET で、
+// エントリの待機条件はプレイヤーごとの HASH に、パーティのメンバーは SET に保存します。
+const (
+	redisKeyPrefix   = "matchmaking:queue:"
+	redisQueueKey    = redisKeyPrefix + "waiting"
+	redisMatcherLock = "matchmaking:matcher:lock"
+)
+
+// redisStore は待機キューを Redis に、それ以外の状態を MySQL に保存する Store です。
+// 複数の API インスタンスで同じ待機キューを共有し、マッチングはロックを取得した1つのインスタンスのみが行います。
+type redisStore struct {
+	*mysqlStore
+	client *redis.Client
+}
+
+// NewRedisStore は MySQL の Store と Redis の待機キューを組み合わせた redisStore を生成します。
+func NewRedisStore(mysql *mysqlStore, addr string) (*redisStore, error) {
+	if addr == "" {
+		return nil, errors.New("store=redis には REDIS_ADDR の指定が必要です")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("Redis接続エラー（%s）: %v", addr, err)
+	}
+	mysql.externalQueue = true
+	return &redisStore{mysqlStore: mysql, client: client}, nil
+}
+
+// Ping は MySQL と Redis の両方に接続できるかを確認します。
+func (s *redisStore) Ping(ctx context.Context) error {
+	if err := s.mysqlStore.Ping(ctx); err != nil {
+		return err
+	}
+	return s.client.Ping(ctx).Err()
+}
+
+// Close は Redis と MySQL の接続を閉じます。
+func (s *redisStore) Close() error {
+	err := s.client.Close()
+	if dbErr := s.mysqlStore.Close(); dbErr != nil {
+		return dbErr
+	}
+	return err
+}
+
+// redisEntryKey はプレイヤーの待機条件を保存する HASH のキーを返します。
+func redisEntryKey(playerID string) string {
+	return redisKeyPrefix + "entry:" + playerID
+}
+
+// enqueueScript はエントリの全メンバーを待機キューへ登録します。
+// 全メンバーが中止されたセッションから戻された状態であれば待機の再開として扱います。
+// 戻り値は 1: 登録、2: 再開、0: 既に待機中のメンバーがいる、3: 待機キューが上限に達している、です。
+// KEYS[1]: 待機キュー, ARGV: 接頭辞, party_id, region, game_mode, 待機開始（ミリ秒）, 有効期限（ミリ秒、0 は無期限）, 待機キューの上限（0 は無制限）, 優先度,
+// 相手のレーティングの下限, 上限, 差の上限, 待機時間（秒、0 はゲームモードの待機時間）, 登録リクエストのスパンの文脈（traceparent）, (プレイヤーID, ping, 属性の JSON)...
+var enqueueScript = redis.NewScript(`
+local prefix, party = ARGV[1], ARGV[2]
+local existing, requeued = 0, 0
+for i = 14, #ARGV, 3 do
+	if redis.call("ZSCORE", KEYS[1], ARGV[i]) then
+		existing = existing + 1
+		local e = prefix .. "entry:" .. ARGV[i]
+		if redis.call("HGET", e, "requeued") == "1" and (redis.call("HGET", e, "party_id") or "") == party then
+			requeued = requeued + 1
+		end
+	end
+end
+local n = (#ARGV - 13) / 3
+if requeued == n then
+	for i = 14, #ARGV, 3 do
+		redis.call("HSET", prefix .. "entry:" .. ARGV[i], "requeued", "0", "expires_at", ARGV[6])
+	end
+	return 2
+end
+if existing > 0 then
+	return 0
+end
+local limit = tonumber(ARGV[7])
+if limit > 0 and redis.call("ZCARD", KEYS[1]) + n > limit then
+	return 3
+end
+for i = 14, #ARGV, 3 do
+	redis.call("ZADD", KEYS[1], ARGV[5], ARGV[i])
+	redis.call("HSET", prefix .. "entry:" .. ARGV[i], "party_id", party, "region", ARGV[3], "game_mode", ARGV[4], "expires_at", ARGV[6], "priority", ARGV[8], "ping_ms", ARGV[i + 1], "requeued", "0",
+		"min_rating", ARGV[9], "max_rating", ARGV[10], "max_rating_delta", ARGV[11], "max_wait_seconds", ARGV[12],
+		"trace_parent", ARGV[13], "attributes", ARGV[i + 2])
+	if party ~= "" then
+		redis.call("SADD", prefix .. "party:" .. party, ARGV[i])
+	end
+end
+return 1
+`)
+
+// dequeueScript はプレイヤー（パーティの場合はパーティ全体）を待機キューから取り除き、取り除いた人数を返します。
+// ARGV[3] が "1" の場合は、中止されたセッションから戻されたメンバーのみを取り除きます。
+// KEYS[1]: 待機キュー, ARGV: 接頭辞, プレイヤーID, 戻されたメンバーのみか
+var dequeueScript = redis.NewScript(`
+local prefix, id, only = ARGV[1], ARGV[2], ARGV[3]
+local e = prefix .. "entry:" .. id
+if redis.call("EXISTS", e) == 0 then
+	return 0
+end
+if only == "1" and redis.call("HGET", e, "requeued") ~= "1" then
+	return 0
+end
+local party = redis.call("HGET", e, "party_id") or ""
+local members = {id}
+if party ~= "" then
+	members = redis.call("SMEMBERS", prefix .. "party:" .. party)
+end
+local n = 0
+for _, m in ipairs(members) do
+	local me = prefix .. "entry:" .. m
+	if only ~= "1" or redis.call("HGET", me, "requeued") == "1" then
+		redis.call("ZREM", KEYS[1], m)
+		redis.call("DEL", me)
+		if party ~= "" then
+			redis.call("SREM", prefix .. "party:" .. party, m)
+		end
+		n = n + 1
+	end
+end
+return n
+`)
+
+// suspendScript はプレイヤー（パーティの場合はパーティ全体）をクライアントの再接続を待つ状態にし、有効期限を縮めます。
+// 待機キューにいない場合は 0 を返します。
+// KEYS[1]: 待機キュー, ARGV: 接頭辞, プレイヤーID, 有効期限（ミリ秒）
+var suspendScript = redis.NewScript(`
+local prefix, id, expires = ARGV[1], ARGV[2], tonumber(ARGV[3])
+local e = prefix .. "entry:" .. id
+if not redis.call("ZSCORE", KEYS[1], id) then
+	return 0
+end
+local party = redis.call("HGET", e, "party_id") or ""
+local members = {id}
+if party ~= "" then
+	members = redis.call("SMEMBERS", prefix .. "party:" .. party)
+end
+for _, m in ipairs(members) do
+	local me = prefix .. "entry:" .. m
+	local current = tonumber(redis.call("HGET", me, "expires_at") or "0") or 0
+	if current == 0 or current > expires then
+		redis.call("HSET", me, "expires_at", ARGV[3])
+	end
+	redis.call("HSET", me, "requeued", "1")
+end
+return 1
+`)
+
+// removeScript はプレイヤーを待機キューから取り除きます。
+// ARGV[2] にロックのトークンが指定された場合は、ロックを保持しているときのみ取り除き、保持していなければ -1 を返します。
+// KEYS[1]: 待機キュー, KEYS[2]: マッチングのロック, ARGV: 接頭辞, トークン, プレイヤーID...
+var removeScript = redis.NewScript(`
+local prefix = ARGV[1]
+if ARGV[2] ~= "" and redis.call("GET", KEYS[2]) ~= ARGV[2] then
+	return -1
+end
+for i = 3, #ARGV do
+	local e = prefix .. "entry:" .. ARGV[i]
+	local party = redis.call("HGET", e, "party_id") or ""
+	if party ~= "" then
+		redis.call("SREM", prefix .. "party:" .. party, ARGV[i])
+	end
+	redis.call("ZREM", KEYS[1], ARGV[i])
+	redis.call("DEL", e)
+end
+return #ARGV - 2
+`)
+
+// requeueScript は中止されたセッションの参加者を元の待機開始時刻のまま待機キューへ戻します。既に待機中の場合は何もしません。
+// KEYS[1]: 待機キュー, ARGV: 接頭辞, プレイヤーID, party_id, region, game_mode, 待機開始（ミリ秒）, 有効期限（ミリ秒）, 優先度, ping,
+// 相手のレーティングの下限, 上限, 差の上限, 属性の JSON
+var requeueScript = redis.NewScript(`
+local prefix, id, party = ARGV[1], ARGV[2], ARGV[3]
+if redis.call("ZSCORE", KEYS[1], id) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[6], id)
+redis.call("HSET", prefix .. "entry:" .. id, "party_id", party, "region", ARGV[4], "game_mode", ARGV[5], "expires_at", ARGV[7], "priority", ARGV[8], "ping_ms", ARGV[9], "requeued", "1",
+	"min_rating", ARGV[10], "max_rating", ARGV[11], "max_rating_delta", ARGV[12],
+	"attributes", ARGV[13])
+if party ~= "" then
+	redis.call("SADD", prefix .. "party:" .. party, id)
+end
+return 1
+`)
+
+// unlockScript はロックのトークンが一致する場合のみロックを解放します。
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// unixMilli は t をミリ秒の文字列にします。ゼロ値は 0（無期限）にします。
+func unixMilli(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+// parseUnixMilli は unixMilli で保存した値を時刻に戻します。
+func parseUnixMilli(s string) time.Time {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// parseIntField は待機条件に保存した整数（優先度・ping）を返します。導入前に登録されたエントリなど、値がない場合は 0 にします。
+func parseIntField(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// EnqueueEntry はプレイヤーを MySQL に登録してから、エントリを Redis の待機キューへ登録します。
+func (s *redisStore) EnqueueEntry(ctx context.Context, entry model.QueueEntry) (model.QueueEntry, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return model.QueueEntry{}, err
+	}
+	players := make([]model.Player, 0, len(entry.Players))
+	for _, member := range entry.Players {
+		player, err := s.getOrCreatePlayer(ctx, tx, member)
+		if err != nil {
+			tx.Rollback()
+			return model.QueueEntry{}, err
+		}
+		player.Region = entry.Region
+		player.Priority = entry.Priority
+		player.PingMS = member.PingMS
+		player.RatingRange = entry.RatingRange
+		player.Attributes = member.Attributes
+		players = append(players, player)
+	}
+	if err := tx.Commit(); err != nil {
+		return model.QueueEntry{}, err
+	}
+
+	args := []interface{}{redisKeyPrefix, entry.PartyID, entry.Region, entry.GameMode, unixMilli(s.cfg.entryWaitingSince(entry)), unixMilli(entry.ExpiresAt), max(s.cfg.MaxQueueSize, 0), entry.Priority,
+		entry.RatingRange.Min, entry.RatingRange.Max, entry.RatingRange.MaxDelta, int(entry.Timeout / time.Second), entry.TraceParent}
+	for _, p := range entry.Players {
+		args = append(args, p.ID, p.PingMS, encodeAttributes(p.Attributes))
+	}
+	res, err := enqueueScript.Run(ctx, s.client, []string{redisQueueKey}, args...).Int()
+	if err != nil {
+		return model.QueueEntry{}, fmt.Errorf("Redis待機キュー登録エラー: %v", err)
+	}
+	switch res {
+	case 0:
+		return model.QueueEntry{}, model.ErrAlreadyQueued
+	case 2:
+		return entry, nil
+	case 3:
+		return model.QueueEntry{}, ErrQueueFull
+	}
+	if entry.Abandoned, err = s.checkUnfinishedSessions(ctx, entry); err != nil {
+		if err := s.DequeuePlayer(context.WithoutCancel(ctx), entry.Players[0].ID); err != nil {
+			slog.ErrorContext(ctx, "登録の取り消しエラー", "func", "EnqueueEntry", "entry", entry.Key(), "error", err)
+		}
+		return model.QueueEntry{}, err
+	}
+	entry.Players = players
+	entry.Rating = model.AverageRating(players)
+	return entry, nil
+}
+
+// checkUnfinishedSessions は Redis の待機キューへ登録したエントリのメンバーが、未終了のセッションに参加していないことを MySQL で確認します。
+// 参加している場合、entry.ReplaceSession であればセッションを放棄して他の参加者を待機キューへ戻し、中止したセッションを返します。そうでなければ ActiveSessionError を返します。
+// 登録の後に確認するため、登録の直前に成立したセッションも見落としません。エラーの場合は呼び出し元で登録を取り消します。
+func (s *redisStore) checkUnfinishedSessions(ctx context.Context, entry model.QueueEntry) ([]model.SessionResult, error) {
+	members, err := s.unfinishedSessions(ctx, s.DB, entryPlayerIDs([]model.QueueEntry{entry}), "")
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+	if !entry.ReplaceSession {
+		return nil, &ActiveSessionError{members[0]}
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	abandoned, err := s.abandonSessions(ctx, tx, members)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	for _, session := range abandoned {
+		if err := s.requeueParticipants(ctx, session); err != nil {
+			return nil, err
+		}
+	}
+	return abandoned, nil
+}
+
+// DequeuePlayer は指定プレイヤー（パーティの場合はパーティ全体）を Redis の待機キューから削除します。
+func (s *redisStore) DequeuePlayer(ctx context.Context, playerID string) error {
+	return dequeueScript.Run(ctx, s.client, []string{redisQueueKey}, redisKeyPrefix, playerID, "0").Err()
+}
+
+// SuspendEntry はプレイヤー（パーティの場合はパーティ全体）を Redis の待機キュー上でクライアントの再接続を待つ状態にします。
+func (s *redisStore) SuspendEntry(ctx context.Context, playerID string, expiresAt time.Time) error {
+	n, err := suspendScript.Run(ctx, s.client, []string{redisQueueKey}, redisKeyPrefix, playerID, unixMilli(expiresAt)).Int()
+	if err != nil {
+		return fmt.Errorf("Redis待機キュー更新エラー: %v", err)
+	}
+	if n == 0 {
+		return ErrNotQueued
+	}
+	return nil
+}
+
+// ListQueuedPlayers は Redis の待機キューのプレイヤーを待機開始の古い順に返します。レーティングは MySQL から取得します。
+func (s *redisStore) ListQueuedPlayers(ctx context.Context) ([]QueuedPlayer, error) {
+	members, err := s.client.ZRangeWithScores(ctx, redisQueueKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Redis待機キュー取得エラー: %v", err)
+	}
+	players := []QueuedPlayer{}
+	if len(members) == 0 {
+		return players, nil
+	}
+
+	pipe := s.client.Pipeline()
+	entries := make([]*redis.MapStringStringCmd, len(members))
+	for i, m := range members {
+		entries[i] = pipe.HGetAll(ctx, redisEntryKey(m.Member.(string)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("Redis待機条件取得エラー: %v", err)
+	}
+
+	ids := make([]interface{}, len(members))
+	for i, m := range members {
+		ids[i] = m.Member
+	}
+	profiles, err := s.playerProfiles(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, m := range members {
+		id := m.Member.(string)
+		profile, ok := profiles[id]
+		fields := entries[i].Val()
+		// MySQL にいないプレイヤーや待機条件が欠けたエントリは、登録や削除の途中のため除外する
+		if !ok || len(fields) == 0 {
+			continue
+		}
+		attrs, err := decodeAttributes(fields["attributes"])
+		if err != nil {
+			return nil, err
+		}
+		players = append(players, QueuedPlayer{
+			ID:           id,
+			Rating:       profile.Rating,
+			PartyID:      fields["party_id"],
+			GameMode:     fields["game_mode"],
+			Region:       fields["region"],
+			PingMS:       parseIntField(fields["ping_ms"]),
+			WaitingSince: time.UnixMilli(int64(m.Score)),
+			ExpiresAt:    parseUnixMilli(fields["expires_at"]),
+			Priority:     parseIntField(fields["priority"]),
+			Requeued:     fields["requeued"] == "1",
+			GamesPlayed:  profile.GamesPlayed,
+			RatingRange: model.RatingRange{
+				Min:      parseIntField(fields["min_rating"]),
+				Max:      parseIntField(fields["max_rating"]),
+				MaxDelta: parseIntField(fields["max_rating_delta"]),
+			},
+			MaxWaitSeconds: parseIntField(fields["max_wait_seconds"]),
+			Attributes:     attrs,
+			TraceParent:    fields["trace_parent"],
+		})
+	}
+	return players, nil
+}
+
+// QueuePosition は Redis の待機キューでのプレイヤーの順番を返します。
+func (s *redisStore) QueuePosition(ctx context.Context, playerID string) (queuePosition, error) {
+	rows, err := s.ListQueuedPlayers(ctx)
+	if err != nil {
+		return queuePosition{}, err
+	}
+	return findQueuePosition(rows, playerID)
+}
+
+// playerProfiles はプレイヤーのレーティングと対戦数を MySQL から取得します。
+func (s *redisStore) playerProfiles(ctx context.Context, ids []interface{}) (map[string]model.PlayerProfile, error) {
+	query := "SELECT player_id, rating, games_played FROM players WHERE player_id IN (" + placeholders(len(ids)) + ")"
+	rows, err := s.query(ctx, s.DB, "player.list_ratings", query, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	profiles := make(map[string]model.PlayerProfile, len(ids))
+	for rows.Next() {
+		var p model.PlayerProfile
+		if err := rows.Scan(&p.ID, &p.Rating, &p.GamesPlayed); err != nil {
+			return nil, err
+		}
+		profiles[p.ID] = p
+	}
+	return profiles, rows.Err()
+}
+
+// SweepExpiredEntries は有効期限を過ぎたエントリを Redis の待機キューから削除します。
+func (s *redisStore) SweepExpiredEntries(ctx context.Context, now time.Time) (int64, error) {
+	players, err := s.ListQueuedPlayers(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var expired []string
+	for _, p := range players {
+		if !p.ExpiresAt.IsZero() && !p.ExpiresAt.After(now) {
+			expired = append(expired, p.ID)
+		}
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	if err := s.removeQueued(ctx, "", expired); err != nil {
+		return 0, err
+	}
+	return int64(len(expired)), nil
+}
+
+// removeQueued はプレイヤーを待機キューから取り除きます。token が空でなければ、ロックを保持している場合のみ取り除きます。
+func (s *redisStore) removeQueued(ctx context.Context, token string, ids []string) error {
+	args := []interface{}{redisKeyPrefix, token}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	n, err := removeScript.Run(ctx, s.client, []string{redisQueueKey, redisMatcherLock}, args...).Int()
+	if err != nil {
+		return fmt.Errorf("Redis待機キュー削除エラー: %v", err)
+	}
+	if n < 0 {
+		return errors.New("マッチングのロックを失いました")
+	}
+	return nil
+}
+
+// CreateSessions はマッチングのロックを取得できた場合のみ、待機キューからロビーを組んでセッションを保存します。
+// 他のインスタンスがロックを保持している場合は何もせずに空の結果を返します。
+// マッチしたプレイヤーはロックを保持していることを確認してから待機キューから取り除くため、
+// 処理が長引いてロックの有効期限が切れた場合は、別のインスタンスと重複してマッチングせずにロールバックします。
+func (s *redisStore) CreateSessions(ctx context.Context, plan matchPlanner) ([]model.SessionResult, error) {
+	token, err := s.acquireMatcherLock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, nil
+	}
+	defer s.releaseMatcherLock(token)
+
+	rows, err := s.ListQueuedPlayers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("待機プレイヤー取得エラー: %v", err)
+	}
+	entries := GroupQueueEntries(rows)
+	members, err := s.unfinishedSessions(ctx, s.DB, entryPlayerIDs(entries), "")
+	if err != nil {
+		return nil, fmt.Errorf("未終了のセッション取得エラー: %v", err)
+	}
+	entries = withoutPlayersInSession(entries, members)
+
+	recent, err := s.getRecentOpponents(ctx, s.DB, entries)
+	if err != nil {
+		return nil, fmt.Errorf("最近の対戦相手取得エラー: %v", err)
+	}
+	blocked, err := s.getBlockedPairs(ctx, s.DB, entries)
+	if err != nil {
+		return nil, fmt.Errorf("ブロック取得エラー: %v", err)
+	}
+	sessions := plan(entries, recent, blocked)
+	if len(sessions) == 0 {
+		return sessions, nil
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("トランザクション開始エラー: %v", err)
+	}
+	var matched []string
+	for i := range sessions {
+		if err := s.insertSession(ctx, tx, &sessions[i]); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("セッション登録エラー: %v", err)
+		}
+		for _, p := range sessions[i].Participants {
+			if !p.IsBot {
+				matched = append(matched, p.ID)
+			}
+		}
+	}
+	if err := s.removeQueued(ctx, token, matched); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		// 待機キューからは取り除いたため、プレイヤーはロングポーリングのタイムアウト後に登録し直す
+		return nil, fmt.Errorf("コミットエラー（待機キューから %d 人を削除済み）: %v", len(matched), err)
+	}
+	return sessions, nil
+}
+
+// acquireMatcherLock はマッチングのロックを取得し、解放に使うトークンを返します。
+// 他のインスタンスが保持している場合は空文字を返します。
+func (s *redisStore) acquireMatcherLock(ctx context.Context) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	ok, err := s.client.SetNX(ctx, redisMatcherLock, token, s.cfg.MatcherLockTTL).Result()
+	if err != nil {
+		return "", fmt.Errorf("マッチングのロック取得エラー: %v", err)
+	}
+	if !ok {
+		return "", nil
+	}
+	return token, nil
+}
+
+// releaseMatcherLock はマッチングのロックを解放します。有効期限が切れて別のインスタンスが取得している場合は解放しません。
+func (s *redisStore) releaseMatcherLock(token string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := unlockScript.Run(ctx, s.client, []string{redisMatcherLock}, token).Err(); err != nil {
+		slog.Warn("マッチングのロック解放エラー", "func", "releaseMatcherLock", "error", err)
+	}
+}
+
+// ResolveReadyCheck は承諾状態を MySQL に記録し、待機キューへの出し入れを Redis で行います。
+// MySQL のトランザクションの確定後に Redis を更新するため、その間に障害が起きた場合は
+// 戻されるはずの参加者が待機キューに戻らないことがあります（クライアントは登録し直せます）。
+func (s *redisStore) ResolveReadyCheck(ctx context.Context, sessionID, playerID, state string) (model.SessionResult, bool, error) {
+	session, resolved, err := s.mysqlStore.ResolveReadyCheck(ctx, sessionID, playerID, state)
+	if err != nil {
+		return model.SessionResult{}, false, err
+	}
+	switch {
+	case resolved && session.Status == model.SessionAborted:
+		if err := s.requeueParticipants(ctx, session); err != nil {
+			return model.SessionResult{}, false, err
+		}
+	case !resolved && playerID != "" && (state == model.ReadyDeclined || state == model.ReadyNoShow) && session.Status == model.SessionAborted:
+		// 既に中止済みのセッションを辞退した場合は、待機キューへ戻されていても取り除く（同時に辞退した場合）
+		if err := dequeueScript.Run(ctx, s.client, []string{redisQueueKey}, redisKeyPrefix, playerID, "1").Err(); err != nil {
+			return model.SessionResult{}, false, fmt.Errorf("Redis待機キュー削除エラー: %v", err)
+		}
+	}
+	return session, resolved, nil
+}
+
+// requeueParticipants は中止されたセッションの参加者のうち Requeued のものを、元の待機開始時刻のまま Redis の待機キューへ戻します。
+func (s *redisStore) requeueParticipants(ctx context.Context, session model.SessionResult) error {
+	for _, p := range session.Participants {
+		if !p.Requeued {
+			continue
+		}
+		args := []interface{}{redisKeyPrefix, p.ID, p.PartyID, p.Region, session.GameMode, unixMilli(p.WaitingSince), unixMilli(p.ExpiresAt), p.Priority, p.PingMS,
+			p.RatingRange.Min, p.RatingRange.Max, p.RatingRange.MaxDelta, encodeAttributes(p.Attributes)}
+		if err := requeueScript.Run(ctx, s.client, []string{redisQueueKey}, args...).Err(); err != nil {
+			return fmt.Errorf("Redis待機キュー再登録エラー: %v", err)
+		}
+	}
+	return nil
+}
+
+// DeletePlayers はプレイヤーを Redis の待機キューから取り除いてから、MySQL の関連する行を削除します。
+func (s *redisStore) DeletePlayers(ctx context.Context, playerIDs []string) error {
+	if len(playerIDs) == 0 {
+		return nil
+	}
+	if err := s.removeQueued(ctx, "", playerIDs); err != nil {
+		return err
+	}
+	return s.mysqlStore.DeletePlayers(ctx, playerIDs)
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// runEnqueueScript は enqueueScript で ids のエントリ（party が空でなければパーティ）を待機開始 waitingMS に登録し、戻り値を返します。
+func runEnqueueScript(t *testing.T, s *redisStore, limit int, waitingMS int64, party string, ids ...string) int {
+	t.Helper()
+	args := []interface{}{redisKeyPrefix, party, "asia", "ranked", waitingMS, 0, limit, 0, 0, 0, 0, 0, ""}
+	for _, id := range ids {
+		args = append(args, id, 30, "")
+	}
+	res, err := enqueueScript.Run(context.Background(), s.client, []string{redisQueueKey}, args...).Int()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// runDequeueScript は dequeueScript で id（パーティの場合はパーティ全体）を取り除き、取り除いた人数を返します。
+func runDequeueScript(t *testing.T, s *redisStore, id string, onlyRequeued bool) int {
+	t.Helper()
+	only := "0"
+	if onlyRequeued {
+		only = "1"
+	}
+	n, err := dequeueScript.Run(context.Background(), s.client, []string{redisQueueKey}, redisKeyPrefix, id, only).Int()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// redisQueued は Redis の待機キューのプレイヤーIDを順に返します。
+func redisQueued(t *testing.T, mr *miniredis.Miniredis) []string {
+	t.Helper()
+	if !mr.Exists(redisQueueKey) {
+		return nil
+	}
+	ids, err := mr.ZMembers(redisQueueKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestEnqueueScript(t *testing.T) {
+	s, mr := newMiniRedisStore(t)
+
+	if res := runEnqueueScript(t, s, 3, 1000, "", "alice"); res != 1 {
+		t.Fatalf("enqueue alice = %d, want 1 (registered)", res)
+	}
+	if score, _ := mr.ZScore(redisQueueKey, "alice"); score != 1000 {
+		t.Errorf("alice score = %v, want the waiting time 1000", score)
+	}
+	if got := mr.HGet(redisEntryKey("alice"), "game_mode"); got != "ranked" {
+		t.Errorf("alice game_mode = %q, want ranked", got)
+	}
+	if res := runEnqueueScript(t, s, 3, 2000, "", "alice"); res != 0 {
+		t.Fatalf("enqueue alice again = %d, want 0 (already queued)", res)
+	}
+
+	if res := runEnqueueScript(t, s, 3, 2000, "p1", "bob", "carol"); res != 1 {
+		t.Fatalf("enqueue party = %d, want 1", res)
+	}
+	members, _ := mr.Members(redisKeyPrefix + "party:p1")
+	if !slices.Equal(members, []string{"bob", "carol"}) {
+		t.Errorf("party members = %v, want bob and carol", members)
+	}
+	// 待機キューの上限（3人）を超える登録は何も変更しない
+	if res := runEnqueueScript(t, s, 3, 3000, "", "dave"); res != 3 {
+		t.Fatalf("enqueue over the limit = %d, want 3 (queue full)", res)
+	}
+	if got := redisQueued(t, mr); !slices.Equal(got, []string{"alice", "bob", "carol"}) {
+		t.Fatalf("queued = %v", got)
+	}
+
+	// 一部のメンバーだけが戻された状態のパーティは再開できない
+	mr.HSet(redisEntryKey("bob"), "requeued", "1")
+	if res := runEnqueueScript(t, s, 3, 4000, "p1", "bob", "carol"); res != 0 {
+		t.Fatalf("resume with one requeued member = %d, want 0", res)
+	}
+	// 全メンバーが戻された状態であれば、元の待機開始時刻のまま再開する
+	mr.HSet(redisEntryKey("carol"), "requeued", "1")
+	if res := runEnqueueScript(t, s, 3, 4000, "p1", "bob", "carol"); res != 2 {
+		t.Fatalf("resume = %d, want 2 (resumed)", res)
+	}
+	for _, id := range []string{"bob", "carol"} {
+		if got := mr.HGet(redisEntryKey(id), "requeued"); got != "0" {
+			t.Errorf("%s requeued = %q after resuming, want 0", id, got)
+		}
+		if score, _ := mr.ZScore(redisQueueKey, id); score != 2000 {
+			t.Errorf("%s score = %v after resuming, want the original 2000", id, score)
+		}
+	}
+}
+
+func TestDequeueScript(t *testing.T) {
+	s, mr := newMiniRedisStore(t)
+	runEnqueueScript(t, s, 0, 1000, "", "alice")
+	runEnqueueScript(t, s, 0, 2000, "p1", "bob", "carol")
+
+	if n := runDequeueScript(t, s, "zed", false); n != 0 {
+		t.Fatalf("dequeue unknown = %d, want 0", n)
+	}
+	// 戻されたメンバーのみを取り除く場合、戻されていないエントリは残す
+	if n := runDequeueScript(t, s, "alice", true); n != 0 {
+		t.Fatalf("dequeue not requeued alice = %d, want 0", n)
+	}
+	mr.HSet(redisEntryKey("carol"), "requeued", "1")
+	if n := runDequeueScript(t, s, "bob", true); n != 0 {
+		t.Fatalf("dequeue not requeued bob = %d, want 0", n)
+	}
+	if n := runDequeueScript(t, s, "carol", true); n != 1 {
+		t.Fatalf("dequeue requeued members of p1 = %d, want 1 (carol)", n)
+	}
+	if got := redisQueued(t, mr); !slices.Equal(got, []string{"alice", "bob"}) {
+		t.Fatalf("queued = %v, want alice and bob", got)
+	}
+	if mr.Exists(redisEntryKey("carol")) {
+		t.Error("carol's entry hash was kept")
+	}
+
+	// パーティのメンバーを指定するとパーティ全体を取り除く
+	if n := runDequeueScript(t, s, "bob", false); n != 1 {
+		t.Fatalf("dequeue p1 = %d, want 1 (bob)", n)
+	}
+	if n := runDequeueScript(t, s, "alice", false); n != 1 {
+		t.Fatalf("dequeue alice = %d, want 1", n)
+	}
+	if got := redisQueued(t, mr); len(got) != 0 {
+		t.Fatalf("queued = %v, want empty", got)
+	}
+	for _, key := range []string{redisEntryKey("alice"), redisEntryKey("bob"), redisKeyPrefix + "party:p1"} {
+		if mr.Exists(key) {
+			t.Errorf("%s was kept", key)
+		}
+	}
+}
+
+func TestMatcherLockToken(t *testing.T) {
+	s, mr := newMiniRedisStore(t)
+	ctx := context.Background()
+	runEnqueueScript(t, s, 0, 1000, "", "alice")
+	runEnqueueScript(t, s, 0, 2000, "", "bob")
+
+	token, err := s.acquireMatcherLock(ctx)
+	if err != nil || token == "" {
+		t.Fatalf("acquire = %q, %v, want a token", token, err)
+	}
+	if other, err := s.acquireMatcherLock(ctx); err != nil || other != "" {
+		t.Fatalf("acquire while held = %q, %v, want no token", other, err)
+	}
+	if ttl := mr.TTL(redisMatcherLock); ttl != s.cfg.MatcherLockTTL {
+		t.Errorf("lock TTL = %v, want %v", ttl, s.cfg.MatcherLockTTL)
+	}
+
+	// ロックを保持していないトークンでは待機キューから取り除かない
+	if err := s.removeQueued(ctx, "stale", []string{"alice"}); err == nil {
+		t.Fatal("remove with a stale token succeeded")
+	}
+	if got := redisQueued(t, mr); len(got) != 2 {
+		t.Fatalf("queued after a stale remove = %v, want both players", got)
+	}
+	if err := s.removeQueued(ctx, token, []string{"alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := redisQueued(t, mr); !slices.Equal(got, []string{"bob"}) {
+		t.Fatalf("queued = %v, want bob", got)
+	}
+
+	// 有効期限が切れて別のインスタンスが取得したロックは、古いトークンでは操作も解放もできない
+	mr.FastForward(s.cfg.MatcherLockTTL + time.Second)
+	next, err := s.acquireMatcherLock(ctx)
+	if err != nil || next == "" || next == token {
+		t.Fatalf("acquire after expiry = %q, %v, want a new token", next, err)
+	}
+	if err := s.removeQueued(ctx, token, []string{"bob"}); err == nil {
+		t.Fatal("remove with an expired token succeeded")
+	}
+	s.releaseMatcherLock(token)
+	if got, _ := mr.Get(redisMatcherLock); got != next {
+		t.Fatalf("lock = %q after releasing the old token, want the new holder's %q", got, next)
+	}
+	s.releaseMatcherLock(next)
+	if mr.Exists(redisMatcherLock) {
+		t.Fatal("lock was kept after its holder released it")
+	}
+}
@@ -0,0 +1,426 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+
+	"matchmaking_project/internal/model"
+)
+
+// SessionReport はゲームサーバから報告された対戦結果です。
+type SessionReport struct {
+	SessionID string
+	// Outcome は対戦結果の種類（model.OutcomeWin など）です。
+	Outcome string
+	// WinningTeam は Outcome が win の場合に勝利したチームの番号（1 始まり）です。それ以外の場合は 0 です。
+	WinningTeam int
+	// RatingChanges は参加者の現在のレーティングと対戦数（GamesPlayed）を設定したセッションから、プレイヤーごとのレーティングの変化量を求めます。
+	// 結果の記録と同じトランザクションで呼び出すため、同時に報告された別のセッションの結果と変化量の計算が競合しません。
+	// nil の場合はレーティングを変更しません（取り消された結果）。
+	RatingChanges func(session model.SessionResult) map[string]int
+}
+
+// ratingChanges は RatingChanges でレーティングの変化量を求めます。RatingChanges が nil の場合は変更しません。
+func (r SessionReport) ratingChanges(session model.SessionResult) map[string]int {
+	if r.RatingChanges == nil {
+		return nil
+	}
+	return r.RatingChanges(session)
+}
+
+// applyRatingChanges は参加者のレーティングに変化量を加えた値を、MinRating〜MaxRating の範囲に収めて返します。
+func applyRatingChanges(session *model.SessionResult, changes map[string]int) map[string]int {
+	updated := make(map[string]int, len(changes))
+	for i := range session.Participants {
+		p := &session.Participants[i]
+		delta, ok := changes[p.ID]
+		if !ok || p.IsBot {
+			continue
+		}
+		p.Rating = min(max(p.Rating+delta, model.MinRating), model.MaxRating)
+		updated[p.ID] = p.Rating
+	}
+	return updated
+}
+
+// resultRecords は対戦結果（outcome・winningTeam）を報告したセッションの、ボットを除く参加者ごとの成績と、
+// 参加者から見た相手（他のチームのボットを除く参加者）ごとの成績を返します。取り消された結果は数えません。
+// 3チーム以上のセッションで別のチームが勝利した場合、その2人の間では勝ちも負けも数えません。
+// 結果の報告とバックフィルで同じ数え方をするため、どちらもこの関数で集計します。
+func resultRecords(session model.SessionResult, outcome string, winningTeam int) (map[string]model.WinLossRecord, map[[2]string]model.WinLossRecord) {
+	players := make(map[string]model.WinLossRecord)
+	pairs := make(map[[2]string]model.WinLossRecord)
+	if outcome != model.OutcomeWin && outcome != model.OutcomeDraw {
+		return players, pairs
+	}
+	for _, p := range session.Participants {
+		if p.IsBot {
+			continue
+		}
+		var r model.WinLossRecord
+		switch {
+		case outcome == model.OutcomeDraw:
+			r.Draws = 1
+		case p.Team == winningTeam:
+			r.Wins = 1
+		default:
+			r.Losses = 1
+		}
+		players[p.ID] = players[p.ID].Add(r)
+
+		for _, o := range session.Participants {
+			if o.IsBot || o.Team == p.Team {
+				continue
+			}
+			var r model.WinLossRecord
+			switch {
+			case outcome == model.OutcomeDraw:
+				r.Draws = 1
+			case p.Team == winningTeam:
+				r.Wins = 1
+			case o.Team == winningTeam:
+				r.Losses = 1
+			default:
+				continue
+			}
+			key := [2]string{p.ID, o.ID}
+			pairs[key] = pairs[key].Add(r)
+		}
+	}
+	return players, pairs
+}
+
+// sortedPairs は相手ごとの成績のキーを順に並べて返します（行ロックの順序を揃えてデッドロックを避ける）。
+func sortedPairs(pairs map[[2]string]model.WinLossRecord) [][2]string {
+	keys := make([][2]string, 0, len(pairs))
+	for k := range pairs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	return keys
+}
+
+// RecordSessionResult は確定済みのセッションを行ロックして対戦結果を記録し、参加者のレーティングを更新します。
+func (s *mysqlStore) RecordSessionResult(ctx context.Context, report SessionReport) (model.SessionResult, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return model.SessionResult{}, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = s.queryRow(ctx, tx, "session.lock_status", "SELECT status FROM sessions WHERE session_id = ? FOR UPDATE", report.SessionID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.SessionResult{}, model.ErrSessionNotFound
+	}
+	if err != nil {
+		return model.SessionResult{}, err
+	}
+	if status != model.SessionActive {
+		return model.SessionResult{}, ErrSessionNotActive
+	}
+	session, err := s.loadSession(ctx, tx, report.SessionID)
+	if err != nil {
+		return model.SessionResult{}, err
+	}
+	// 同じプレイヤーの別のセッションの結果と同時に更新しないよう、レーティングを読む時点で行ロックする
+	for i := range session.Participants {
+		p := &session.Participants[i]
+		if p.IsBot {
+			continue
+		}
+		err := s.queryRow(ctx, tx, "player.lock_rating", "SELECT rating, games_played FROM players WHERE player_id = ? FOR UPDATE", p.ID).Scan(&p.Rating, &p.GamesPlayed)
+		if err != nil {
+			return model.SessionResult{}, err
+		}
+	}
+
+	for id, rating := range applyRatingChanges(&session, report.ratingChanges(session)) {
+		if _, err := s.exec(ctx, tx, "player.update_rating", "UPDATE players SET rating = ? WHERE player_id = ?", rating, id); err != nil {
+			return model.SessionResult{}, err
+		}
+	}
+	players, pairs := resultRecords(session, report.Outcome, report.WinningTeam)
+	for _, id := range slices.Sorted(maps.Keys(players)) {
+		r := players[id]
+		query := "UPDATE players SET wins = wins + ?, losses = losses + ?, draws = draws + ? WHERE player_id = ?"
+		if _, err := s.exec(ctx, tx, "player.record_result", query, r.Wins, r.Losses, r.Draws, id); err != nil {
+			return model.SessionResult{}, err
+		}
+	}
+	for _, pair := range sortedPairs(pairs) {
+		r := pairs[pair]
+		query := `INSERT INTO head_to_head (player_id, opponent_id, wins, losses, draws) VALUES (?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE wins = wins + VALUES(wins), losses = losses + VALUES(losses), draws = draws + VALUES(draws)`
+		if _, err := s.exec(ctx, tx, "head_to_head.record_result", query, pair[0], pair[1], r.Wins, r.Losses, r.Draws); err != nil {
+			return model.SessionResult{}, err
+		}
+	}
+	// 勝敗のつかなかった結果の winning_team は NULL のままにする
+	winningTeam := sql.NullInt64{Int64: int64(report.WinningTeam), Valid: report.WinningTeam > 0}
+	query := "UPDATE sessions SET status = ?, outcome = ?, winning_team = ?, ended_at = ? WHERE session_id = ?"
+	if _, err := s.exec(ctx, tx, "session.record_result", query, model.SessionCompleted, report.Outcome, winningTeam, s.cfg.now(), report.SessionID); err != nil {
+		return model.SessionResult{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return model.SessionResult{}, err
+	}
+	session.Status = model.SessionCompleted
+	session.Outcome = report.Outcome
+	session.WinningTeam = report.WinningTeam
+	// 更新後のレーティングで Player1, Player2 を設定し直す
+	session.Player1, session.Player2 = nil, nil
+	session.SetHeadToHead()
+	return session, nil
+}
+
+// RecordSessionResult は確定済みのセッションに対戦結果を記録し、参加者のレーティングを更新します。
+func (s *MemoryStore) RecordSessionResult(ctx context.Context, report SessionReport) (model.SessionResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.sessions[report.SessionID]
+	if !ok {
+		return model.SessionResult{}, model.ErrSessionNotFound
+	}
+	if stored.Status != model.SessionActive {
+		return model.SessionResult{}, ErrSessionNotActive
+	}
+	session, err := s.loadSession(report.SessionID)
+	if err != nil {
+		return model.SessionResult{}, err
+	}
+	for i := range session.Participants {
+		if p := &session.Participants[i]; !p.IsBot {
+			p.GamesPlayed = s.players[p.ID].GamesPlayed
+		}
+	}
+
+	for id, rating := range applyRatingChanges(&session, report.ratingChanges(session)) {
+		profile := s.players[id]
+		profile.Rating = rating
+		s.players[id] = profile
+	}
+	players, pairs := resultRecords(session, report.Outcome, report.WinningTeam)
+	for id, r := range players {
+		profile := s.players[id]
+		profile.WinLossRecord = profile.WinLossRecord.Add(r)
+		s.players[id] = profile
+	}
+	for pair, r := range pairs {
+		s.headToHead[pair] = s.headToHead[pair].Add(r)
+	}
+	stored.Status = model.SessionCompleted
+	stored.Outcome = report.Outcome
+	stored.WinningTeam = report.WinningTeam
+	s.sessions[report.SessionID] = stored
+	times := s.sessionTimes[report.SessionID]
+	times.Ended = s.now()
+	s.sessionTimes[report.SessionID] = times
+	session.Status = model.SessionCompleted
+	session.Outcome = report.Outcome
+	session.WinningTeam = report.WinningTeam
+	// 更新後のレーティングで Player1, Player2 を設定し直す
+	session.Player1, session.Player2 = nil, nil
+	session.SetHeadToHead()
+	return session, nil
+}
+
+// GetHeadToHead は head_to_head から playerID から見た opponentID との対戦成績を返します。
+func (s *mysqlStore) GetHeadToHead(ctx context.Context, playerID, opponentID string) (model.HeadToHead, error) {
+	h := model.HeadToHead{PlayerID: playerID, OpponentID: opponentID}
+	query := "SELECT wins, losses, draws FROM head_to_head WHERE player_id = ? AND opponent_id = ?"
+	err := s.queryRow(ctx, s.DB, "head_to_head.get", query, playerID, opponentID).Scan(&h.Wins, &h.Losses, &h.Draws)
+	if errors.Is(err, sql.ErrNoRows) {
+		return h, nil
+	}
+	return h, err
+}
+
+// GetHeadToHead は playerID から見た opponentID との対戦成績を返します。
+func (s *MemoryStore) GetHeadToHead(ctx context.Context, playerID, opponentID string) (model.HeadToHead, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return model.HeadToHead{PlayerID: playerID, OpponentID: opponentID, WinLossRecord: s.headToHead[[2]string{playerID, opponentID}]}, nil
+}
+
+// backfillPlayerIDs は cursor より後のプレイヤーIDを順に最大 limit 件返します。
+func (s *mysqlStore) backfillPlayerIDs(ctx context.Context, cursor string, limit int) ([]string, error) {
+	rows, err := s.query(ctx, s.DB, "backfill.list_players", "SELECT player_id FROM players WHERE player_id > ? ORDER BY player_id ASC LIMIT ?", cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// sessionOutcome は sessions s の対戦結果の種類です。0028 より前に報告した結果は outcome がなく、勝敗のついた結果だけなので win とみなします。
+const sessionOutcome = "COALESCE(s.outcome, '" + model.OutcomeWin + "')"
+
+// BackfillWinLoss は結果を報告した（completed の）セッションから、プレイヤーID順に players.wins・losses・draws を再計算します。
+func (s *mysqlStore) BackfillWinLoss(ctx context.Context, cursor string, limit int) (string, int, error) {
+	ids, err := s.backfillPlayerIDs(ctx, cursor, limit)
+	if err != nil || len(ids) == 0 {
+		return cursor, 0, err
+	}
+	// resultRecords と同じく、取り消された結果は数えない
+	query := `UPDATE players SET
+			wins = (SELECT COUNT(*) FROM session_players sp JOIN sessions s ON s.session_id = sp.session_id
+				WHERE sp.player_id = players.player_id AND s.status = ? AND ` + sessionOutcome + ` = ? AND sp.team = s.winning_team),
+			losses = (SELECT COUNT(*) FROM session_players sp JOIN sessions s ON s.session_id = sp.session_id
+				WHERE sp.player_id = players.player_id AND s.status = ? AND ` + sessionOutcome + ` = ? AND sp.team <> s.winning_team),
+			draws = (SELECT COUNT(*) FROM session_players sp JOIN sessions s ON s.session_id = sp.session_id
+				WHERE sp.player_id = players.player_id AND s.status = ? AND ` + sessionOutcome + ` = ?)
+		WHERE player_id = ?`
+	for _, id := range ids {
+		_, err := s.exec(ctx, s.DB, "backfill.update_win_loss", query,
+			model.SessionCompleted, model.OutcomeWin, model.SessionCompleted, model.OutcomeWin, model.SessionCompleted, model.OutcomeDraw, id)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+	return ids[len(ids)-1], len(ids), nil
+}
+
+// BackfillHeadToHead は結果を報告した（completed の）セッションから、プレイヤーID順にそのプレイヤーの head_to_head の行を作り直します。
+// 相手から見た行は相手のプレイヤーを処理するときに作り直します。
+func (s *mysqlStore) BackfillHeadToHead(ctx context.Context, cursor string, limit int) (string, int, error) {
+	ids, err := s.backfillPlayerIDs(ctx, cursor, limit)
+	if err != nil || len(ids) == 0 {
+		return cursor, 0, err
+	}
+	// resultRecords と同じく、他のチームのボットを除く参加者ごとに数え、勝敗も引き分けもない組み合わせの行は作らない
+	insert := `INSERT INTO head_to_head (player_id, opponent_id, wins, losses, draws)
+		SELECT me.player_id, opp.player_id,
+			SUM(` + sessionOutcome + ` = ? AND me.team = s.winning_team) AS wins,
+			SUM(` + sessionOutcome + ` = ? AND opp.team = s.winning_team) AS losses,
+			SUM(` + sessionOutcome + ` = ?) AS draws
+		FROM session_players me
+		JOIN session_players opp ON opp.session_id = me.session_id AND opp.team <> me.team AND NOT opp.is_bot
+		JOIN sessions s ON s.session_id = me.session_id
+		WHERE me.player_id = ? AND s.status = ? AND ` + sessionOutcome + ` IN (?, ?)
+		GROUP BY me.player_id, opp.player_id
+		HAVING wins + losses + draws > 0`
+	for _, id := range ids {
+		if err := s.rebuildHeadToHead(ctx, id, insert); err != nil {
+			return "", 0, err
+		}
+	}
+	return ids[len(ids)-1], len(ids), nil
+}
+
+// rebuildHeadToHead は1つのトランザクションで playerID の head_to_head の行を削除し、insert で作り直します。
+func (s *mysqlStore) rebuildHeadToHead(ctx context.Context, playerID, insert string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := s.exec(ctx, tx, "backfill.delete_head_to_head", "DELETE FROM head_to_head WHERE player_id = ?", playerID); err != nil {
+		return err
+	}
+	_, err = s.exec(ctx, tx, "backfill.insert_head_to_head", insert,
+		model.OutcomeWin, model.OutcomeWin, model.OutcomeDraw, playerID, model.SessionCompleted, model.OutcomeWin, model.OutcomeDraw)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// resultSessionRecords は結果を報告したすべてのセッションの成績を集計します（MemoryStore のバックフィル用。s.mu を保持して呼び出す）。
+func (s *MemoryStore) resultSessionRecords() (map[string]model.WinLossRecord, map[[2]string]model.WinLossRecord) {
+	players := make(map[string]model.WinLossRecord)
+	pairs := make(map[[2]string]model.WinLossRecord)
+	for _, session := range s.sessions {
+		if session.Status != model.SessionCompleted {
+			continue
+		}
+		// 0028 より前に報告した結果（mysqlStore の sessionOutcome を参照）
+		outcome := session.Outcome
+		if outcome == "" {
+			outcome = model.OutcomeWin
+		}
+		p, h := resultRecords(session, outcome, session.WinningTeam)
+		for id, r := range p {
+			players[id] = players[id].Add(r)
+		}
+		for pair, r := range h {
+			pairs[pair] = pairs[pair].Add(r)
+		}
+	}
+	return players, pairs
+}
+
+// backfillPlayerIDs は cursor より後のプレイヤーIDを順に最大 limit 件返します（s.mu を保持して呼び出す）。
+func (s *MemoryStore) backfillPlayerIDs(cursor string, limit int) []string {
+	var ids []string
+	for id := range s.players {
+		if id > cursor {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids
+}
+
+// BackfillWinLoss は結果を報告したセッションから、プレイヤーID順に勝ち・負け・引き分けの数を再計算します。
+func (s *MemoryStore) BackfillWinLoss(ctx context.Context, cursor string, limit int) (string, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := s.backfillPlayerIDs(cursor, limit)
+	if len(ids) == 0 {
+		return cursor, 0, nil
+	}
+	records, _ := s.resultSessionRecords()
+	for _, id := range ids {
+		profile := s.players[id]
+		profile.WinLossRecord = records[id]
+		s.players[id] = profile
+	}
+	return ids[len(ids)-1], len(ids), nil
+}
+
+// BackfillHeadToHead は結果を報告したセッションから、プレイヤーID順にそのプレイヤーから見た相手ごとの対戦成績を作り直します。
+func (s *MemoryStore) BackfillHeadToHead(ctx context.Context, cursor string, limit int) (string, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := s.backfillPlayerIDs(cursor, limit)
+	if len(ids) == 0 {
+		return cursor, 0, nil
+	}
+	_, pairs := s.resultSessionRecords()
+	selected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+	for pair := range s.headToHead {
+		if selected[pair[0]] {
+			delete(s.headToHead, pair)
+		}
+	}
+	for pair, r := range pairs {
+		if selected[pair[0]] {
+			s.headToHead[pair] = r
+		}
+	}
+	return ids[len(ids)-1], len(ids), nil
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	"matchmaking_project/internal/model"
+)
+
+// seedResultHistory は勝ち・負け・引き分けの数を記録する前に報告された対戦結果を MemoryStore に直接書き込みます。
+// プレイヤーの成績はゼロのままで、bob には古い値を残します。
+func seedResultHistory(s *MemoryStore) {
+	for _, id := range []string{"alice", "bob", "carol", "dave", "erin"} {
+		s.players[id] = model.PlayerProfile{ID: id, Rating: 1500}
+	}
+	bob := s.players["bob"]
+	bob.Wins = 5
+	s.players["bob"] = bob
+	s.headToHead[[2]string{"bob", "zed"}] = model.WinLossRecord{Wins: 3}
+
+	p := func(id string, team int) model.Participant {
+		return model.Participant{Player: model.Player{ID: id}, Team: team}
+	}
+	bot := model.Participant{Player: model.Player{ID: "bot-1", IsBot: true}, Team: 2}
+	for _, session := range []model.SessionResult{
+		// outcome を記録する前（0028 より前）に報告した結果は勝敗のついた結果として数える
+		{SessionID: "s1", Status: model.SessionCompleted, WinningTeam: 1, Participants: []model.Participant{p("alice", 1), p("bob", 2)}},
+		{SessionID: "s2", Status: model.SessionCompleted, Outcome: model.OutcomeDraw, Participants: []model.Participant{p("alice", 1), p("bob", 2)}},
+		{SessionID: "s3", Status: model.SessionCompleted, Outcome: model.OutcomeWin, WinningTeam: 2, Participants: []model.Participant{p("bob", 1), p("carol", 1), p("dave", 2), bot}},
+		{SessionID: "s4", Status: model.SessionCompleted, Outcome: model.OutcomeCancelled, Participants: []model.Participant{p("alice", 1), p("carol", 2)}},
+		{SessionID: "s5", Status: model.SessionActive, Participants: []model.Participant{p("alice", 1), p("dave", 2)}},
+		// 3チームの対戦では、勝ったチーム以外の2人の間は数えない
+		{SessionID: "s6", Status: model.SessionCompleted, Outcome: model.OutcomeWin, WinningTeam: 1, Participants: []model.Participant{p("carol", 1), p("dave", 2), p("erin", 3)}},
+	} {
+		s.sessions[session.SessionID] = session
+	}
+}
+
+// wantWinLoss, wantHeadToHead は seedResultHistory の対戦結果を最初から数えた成績です。
+var (
+	wantWinLoss = map[string]model.WinLossRecord{
+		"alice": {Wins: 1, Draws: 1},
+		"bob":   {Losses: 2, Draws: 1},
+		"carol": {Wins: 1, Losses: 1},
+		"dave":  {Wins: 1, Losses: 1},
+		"erin":  {Losses: 1},
+	}
+	wantHeadToHead = map[[2]string]model.WinLossRecord{
+		{"alice", "bob"}:  {Wins: 1, Draws: 1},
+		{"bob", "alice"}:  {Losses: 1, Draws: 1},
+		{"dave", "bob"}:   {Wins: 1},
+		{"bob", "dave"}:   {Losses: 1},
+		{"dave", "carol"}: {Wins: 1, Losses: 1},
+		{"carol", "dave"}: {Wins: 1, Losses: 1},
+		{"carol", "erin"}: {Wins: 1},
+		{"erin", "carol"}: {Losses: 1},
+	}
+)
+
+// runResultBackfill は cursor から完了するまで limit 件ずつ fn を呼び出し、バッチの数を返します。
+func runResultBackfill(t *testing.T, fn func(context.Context, string, int) (string, int, error), cursor string, limit int) int {
+	t.Helper()
+	batches := 0
+	for {
+		next, n, err := fn(context.Background(), cursor, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			if next != cursor {
+				t.Fatalf("empty batch moved the cursor from %q to %q", cursor, next)
+			}
+			return batches
+		}
+		cursor = next
+		batches++
+	}
+}
+
+func TestBackfillWinLossResumes(t *testing.T) {
+	s := NewMemoryStore(DefaultConfig())
+	seedResultHistory(s)
+
+	// 最初のバッチの後に中断する
+	cursor, n, err := s.BackfillWinLoss(context.Background(), "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor != "bob" || n != 2 {
+		t.Fatalf("first batch = (%q, %d), want (bob, 2)", cursor, n)
+	}
+	if got := s.players["carol"].WinLossRecord; got != (model.WinLossRecord{}) {
+		t.Fatalf("carol before resuming = %+v, want carol not yet processed", got)
+	}
+
+	if batches := runResultBackfill(t, s.BackfillWinLoss, cursor, 2); batches != 2 {
+		t.Errorf("resumed in %d batches, want 2", batches)
+	}
+	checkWinLoss(t, s)
+	// 同じ範囲をもう一度処理しても変わらない
+	runResultBackfill(t, s.BackfillWinLoss, "", 10)
+	checkWinLoss(t, s)
+}
+
+// checkWinLoss はプレイヤーの成績が wantWinLoss と一致することを確認します。
+func checkWinLoss(t *testing.T, s *MemoryStore) {
+	t.Helper()
+	for id, want := range wantWinLoss {
+		profile, err := s.GetPlayerProfile(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profile.WinLossRecord != want {
+			t.Errorf("%s = %+v, want %+v", id, profile.WinLossRecord, want)
+		}
+	}
+}
+
+func TestBackfillHeadToHeadResumes(t *testing.T) {
+	s := NewMemoryStore(DefaultConfig())
+	seedResultHistory(s)
+
+	cursor, _, err := s.BackfillHeadToHead(context.Background(), "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.headToHead[[2]string{"bob", "zed"}]; ok {
+		t.Fatal("stale head-to-head row of a processed player was kept")
+	}
+	if _, ok := s.headToHead[[2]string{"carol", "dave"}]; ok {
+		t.Fatal("head-to-head of an unprocessed player was written")
+	}
+
+	runResultBackfill(t, s.BackfillHeadToHead, cursor, 2)
+	if !maps.Equal(s.headToHead, wantHeadToHead) {
+		t.Fatalf("head-to-head = %v, want %v", s.headToHead, wantHeadToHead)
+	}
+	runResultBackfill(t, s.BackfillHeadToHead, "", 10)
+	if !maps.Equal(s.headToHead, wantHeadToHead) {
+		t.Fatalf("head-to-head after a second run = %v, want %v", s.headToHead, wantHeadToHead)
+	}
+	h, err := s.GetHeadToHead(context.Background(), "alice", "dave")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.PlayerID != "alice" || h.OpponentID != "dave" || h.WinLossRecord != (model.WinLossRecord{}) {
+		t.Errorf("never-finished pair = %+v, want an empty record", h)
+	}
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+)
+
+// TickRetry はマッチングプロセッサーの1回の処理の中で、一時的な DB エラーを再試行する方針です。
+// 再試行しても失敗した場合は、MatchmakingProcessor が次回までの間隔を processorMaxBackoff まで延ばします。
+var TickRetry = retryPolicy{Attempts: 3, Base: 100 * time.Millisecond, Max: time.Second, Retryable: isTransientDBError, OnRetry: func(attempt int, err error) {
+	metrics.DBRetries.Inc()
+	slog.Warn("一時的な DB エラーのため再試行します", "func", "runMatchmaking", "attempt", attempt, "error", err)
+}}
+
+// retryPolicy は失敗した処理を、待機時間を倍々に延ばしながら決められた回数まで再試行する方針です。
+type retryPolicy struct {
+	// Attempts は最初の試行を含む最大の試行回数です。1 以下の場合は再試行しません。
+	Attempts int
+	// Base は最初の再試行までの待機時間で、Max を上限に倍々に延ばします。
+	Base, Max time.Duration
+	// Retryable は再試行するエラーかどうかを判定します。nil の場合は再試行しません。
+	Retryable func(error) bool
+	// Sleep は再試行までの待機です。nil の場合は SleepContext を使います。
+	// ctx が先に終了した場合は false を返します。
+	Sleep func(ctx context.Context, d time.Duration) bool
+	// OnRetry は再試行の前に、attempt 回目（1 始まり）の失敗のエラーとともに呼び出されます。
+	OnRetry func(attempt int, err error)
+}
+
+// Do は fn を実行し、再試行するエラーの場合は待機してから再度実行します。
+// 最後の試行のエラー、または待機中に ctx が終了した場合は ctx のエラーを返します。
+func (p retryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	sleep := p.Sleep
+	if sleep == nil {
+		sleep = SleepContext
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= p.Attempts || p.Retryable == nil || !p.Retryable(err) {
+			return err
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err)
+		}
+		if !sleep(ctx, model.BackoffDelay(attempt, p.Base, p.Max)) {
+			return ctx.Err()
+		}
+	}
+}
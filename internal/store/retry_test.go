@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+)
+
+func TestIsTransientDBError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{driver.ErrBadConn, true},
+		{fmt.Errorf("create sessions: %w", driver.ErrBadConn), true},
+		{fmt.Errorf("commit: %w", &mysql.MySQLError{Number: mysqlErrDeadlock}), true},
+		{&mysql.MySQLError{Number: mysqlErrLockWaitTimeout}, true},
+		{&mysql.MySQLError{Number: 1062}, false},
+		{context.DeadlineExceeded, false},
+		{errors.New("syntax error"), false},
+	} {
+		if got := isTransientDBError(tc.err); got != tc.want {
+			t.Errorf("isTransientDBError(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+// fakeSleeper は retryPolicy の待機を記録し、実際には待ちません。
+type fakeSleeper struct {
+	delays []time.Duration
+}
+
+func (s *fakeSleeper) sleep(ctx context.Context, d time.Duration) bool {
+	s.delays = append(s.delays, d)
+	return ctx.Err() == nil
+}
+
+// 一時的なエラーは待機時間を Max まで倍々に延ばしながら Attempts 回まで試行し、それ以外のエラーは再試行しない
+func TestRetryPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		errs       []error
+		wantCalls  int
+		wantDelays []time.Duration
+		wantErr    error
+	}{
+		{"success", []error{nil}, 1, nil, nil},
+		{"recovers", []error{driver.ErrBadConn, driver.ErrBadConn, nil}, 3, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, nil},
+		{"gives up", []error{driver.ErrBadConn, driver.ErrBadConn, driver.ErrBadConn, driver.ErrBadConn, nil}, 4, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 250 * time.Millisecond}, driver.ErrBadConn},
+		{"permanent", []error{ErrPlayerNotFound, nil}, 1, nil, ErrPlayerNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sleeper := &fakeSleeper{}
+			var retried []int
+			p := retryPolicy{Attempts: 4, Base: 100 * time.Millisecond, Max: 250 * time.Millisecond, Retryable: isTransientDBError,
+				Sleep: sleeper.sleep, OnRetry: func(attempt int, _ error) { retried = append(retried, attempt) }}
+			calls := 0
+			err := p.Do(context.Background(), func(context.Context) error {
+				calls++
+				return tc.errs[calls-1]
+			})
+			if !errors.Is(err, tc.wantErr) || (tc.wantErr == nil && err != nil) {
+				t.Fatalf("err = %v, want %v", err, tc.wantErr)
+			}
+			if calls != tc.wantCalls || !slices.Equal(sleeper.delays, tc.wantDelays) {
+				t.Fatalf("calls = %d, delays = %v, want %d and %v", calls, sleeper.delays, tc.wantCalls, tc.wantDelays)
+			}
+			if len(retried) != len(tc.wantDelays) {
+				t.Fatalf("OnRetry called for attempts %v, want once per retry", retried)
+			}
+		})
+	}
+}
+
+// 待機中に ctx が終了した場合は再試行せず、ctx のエラーを返す
+func TestRetryPolicyStopsWhenContextEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := retryPolicy{Attempts: 5, Base: time.Second, Max: time.Second, Retryable: isTransientDBError, Sleep: func(context.Context, time.Duration) bool {
+		cancel()
+		return false
+	}}
+	calls := 0
+	err := p.Do(ctx, func(context.Context) error {
+		calls++
+		return driver.ErrBadConn
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Fatalf("err = %v after %d calls, want context.Canceled after 1", err, calls)
+	}
+}
+
+// マッチングのトランザクションがデッドロックで失敗した場合は、ロールバックしてから待機キューを読み直して組み直す
+func TestTickRetryReplansAfterDeadlock(t *testing.T) {
+	deadlocks := 1
+	f := &fakeDB{exec: func(q string, _ []driver.Value) error {
+		if strings.HasPrefix(q, "INSERT INTO sessions") && deadlocks > 0 {
+			deadlocks--
+			return &mysql.MySQLError{Number: mysqlErrDeadlock, Message: "Deadlock found when trying to get lock"}
+		}
+		return nil
+	}}
+	s := newFakeMySQLStore(t, f)
+	planned := 0
+	plan := func([]model.QueueEntry, model.OpponentSet, model.OpponentSet) []model.SessionResult {
+		planned++
+		return []model.SessionResult{{SessionID: string(model.NewSessionID()), GameMode: "duel", Status: model.SessionPendingAccept}}
+	}
+
+	sleeper := &fakeSleeper{}
+	p := TickRetry
+	p.Sleep = sleeper.sleep
+	before := testutil.ToFloat64(metrics.DBRetries)
+	var sessions []model.SessionResult
+	err := p.Do(context.Background(), func(ctx context.Context) error {
+		var err error
+		sessions, err = s.CreateSessions(ctx, plan)
+		return err
+	})
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("CreateSessions = %d sessions, %v, want 1 after a retry", len(sessions), err)
+	}
+	if planned != 2 || !slices.Equal(sleeper.delays, []time.Duration{TickRetry.Base}) {
+		t.Fatalf("planned %d times with delays %v, want 2 and one wait of %v", planned, sleeper.delays, TickRetry.Base)
+	}
+	if got := testutil.ToFloat64(metrics.DBRetries) - before; got != 1 {
+		t.Errorf("db retries = %v, want 1", got)
+	}
+	var ends []string
+	for _, q := range f.queries() {
+		if q == "ROLLBACK" || q == "COMMIT" {
+			ends = append(ends, q)
+		}
+	}
+	if !slices.Equal(ends, []string{"ROLLBACK", "COMMIT"}) {
+		t.Fatalf("transactions ended with %v, want the deadlocked one rolled back and the retry committed", ends)
+	}
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"fmt"
+	"log/slog"
+
+	"matchmaking_project/internal/model"
+)
+
+// playerSession はプレイヤーと、そのプレイヤーが参加している未終了（承諾待ち・確定）のセッションです。
+type playerSession struct {
+	PlayerID  string
+	SessionID string
+}
+
+// ActiveSessionError は未終了のセッションに参加しているプレイヤー（パーティの場合はメンバーのいずれか）が待機キューへ登録しようとした場合のエラーです。
+// ゲームサーバは同じプレイヤーが同時に2つのセッションに参加することを扱えないため、Store は登録と同じトランザクションで確認します。
+type ActiveSessionError struct {
+	playerSession
+}
+
+func (e *ActiveSessionError) Error() string {
+	return fmt.Sprintf("player %s is already in session %s", e.PlayerID, e.SessionID)
+}
+
+// sessionMembers は members をセッションごとにまとめ、セッションID（members に最初に現れた順）とセッションごとのプレイヤーIDを返します。
+func sessionMembers(members []playerSession) ([]string, map[string][]string) {
+	var ids []string
+	players := make(map[string][]string)
+	for _, m := range members {
+		if _, ok := players[m.SessionID]; !ok {
+			ids = append(ids, m.SessionID)
+		}
+		players[m.SessionID] = append(players[m.SessionID], m.PlayerID)
+	}
+	return ids, players
+}
+
+// withoutPlayersInSession は members のプレイヤーを含むエントリを entries から取り除きます。
+// 登録の確認をすり抜けて（または確認の前から）待機キューにいる、未終了のセッションの参加者を2つ目のセッションに入れないためのものです。
+// 取り除いたエントリは待機キューに残り、有効期限を過ぎれば削除されます。
+func withoutPlayersInSession(entries []model.QueueEntry, members []playerSession) []model.QueueEntry {
+	if len(members) == 0 {
+		return entries
+	}
+	inSession := make(map[string]string, len(members))
+	for _, m := range members {
+		inSession[m.PlayerID] = m.SessionID
+	}
+	kept := entries[:0:0]
+	for _, e := range entries {
+		skip := false
+		for _, p := range e.Players {
+			if sessionID, ok := inSession[p.ID]; ok {
+				slog.Warn("未終了のセッションの参加者を含むエントリをマッチングから除外", "func", "withoutPlayersInSession", "entry", e.Key(), "player_id", p.ID, "session_id", sessionID)
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// entryPlayerIDs はエントリの全メンバーのプレイヤーIDを返します。
+func entryPlayerIDs(entries []model.QueueEntry) []interface{} {
+	var ids []interface{}
+	for _, e := range entries {
+		for _, p := range e.Players {
+			ids = append(ids, p.ID)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"matchmaking_project/internal/model"
+)
+
+// pairAll は待機中のエントリを先頭から2件ずつ承諾待ちのセッションにする matchPlanner です。
+func pairAll(entries []model.QueueEntry, _, _ model.OpponentSet) []model.SessionResult {
+	var sessions []model.SessionResult
+	for i := 0; i+1 < len(entries); i += 2 {
+		session := model.SessionResult{SessionID: string(model.NewSessionID()), Status: model.SessionPendingAccept}
+		for team, e := range entries[i : i+2] {
+			for _, p := range e.Players {
+				session.Participants = append(session.Participants, model.Participant{Player: p, Team: team + 1})
+			}
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// soloEntry は1人のエントリを返します。
+func soloEntry(id string) model.QueueEntry {
+	return model.QueueEntry{Players: []model.Player{{ID: id}}, GameMode: "duel"}
+}
+
+// マッチングと同じプレイヤーの登録が並行しても、登録は待機中（ErrAlreadyQueued）か参加中（ActiveSessionError）として拒否され、
+// 同じプレイヤーが待機キューとセッションの両方に入ることはない（go test -race で確認）
+func TestEnqueueRacesSessionCreation(t *testing.T) {
+	ctx := context.Background()
+	for range 50 {
+		s := NewMemoryStore(DefaultConfig())
+		for _, id := range []string{"alice", "bob"} {
+			if _, err := s.EnqueueEntry(ctx, soloEntry(id)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var wg sync.WaitGroup
+		matched := make(chan struct{})
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			defer close(matched)
+			if _, err := s.CreateSessions(ctx, pairAll); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for done := false; !done; {
+				select {
+				case <-matched:
+					done = true
+				default:
+				}
+				_, err := s.EnqueueEntry(ctx, soloEntry("alice"))
+				var inSession *ActiveSessionError
+				switch {
+				case errors.As(err, &inSession):
+					if inSession.PlayerID != "alice" || inSession.SessionID == "" {
+						t.Errorf("active session error = %+v, want alice's session", inSession)
+					}
+				case errors.Is(err, model.ErrAlreadyQueued):
+				default:
+					t.Errorf("enqueue while matching = %v, want it rejected", err)
+					return
+				}
+			}
+		}()
+		wg.Wait()
+
+		if _, queued := s.queue["alice"]; queued {
+			t.Fatal("alice is queued while in a session")
+		}
+		if members := s.unfinishedSessions([]model.Player{{ID: "alice"}}); len(members) != 1 {
+			t.Fatalf("alice's unfinished sessions = %v, want 1", members)
+		}
+	}
+}
+
+// 登録の確認をすり抜けて待機キューにいる参加者は、マッチングの対象から除く（プロセッサー側の確認）
+func TestCreateSessionsSkipsPlayersInSession(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(DefaultConfig())
+	for _, id := range []string{"alice", "bob"} {
+		if _, err := s.EnqueueEntry(ctx, soloEntry(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.CreateSessions(ctx, pairAll); err != nil {
+		t.Fatal(err)
+	}
+	s.queue["alice"] = QueuedPlayer{ID: "alice", GameMode: "duel", WaitingSince: s.now()}
+	if _, err := s.EnqueueEntry(ctx, soloEntry("carol")); err != nil {
+		t.Fatal(err)
+	}
+
+	var planned []string
+	if _, err := s.CreateSessions(ctx, func(entries []model.QueueEntry, recent, blocked model.OpponentSet) []model.SessionResult {
+		for _, e := range entries {
+			planned = append(planned, model.PlayerIDs(e.Players)...)
+		}
+		return pairAll(entries, recent, blocked)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(planned, []string{"carol"}) {
+		t.Fatalf("planned entries = %v, want carol only", planned)
+	}
+}
+
+// ReplaceSession の登録は未終了のセッションを放棄（中止）してから登録する
+func TestEnqueueReplaceSession(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(DefaultConfig())
+	for _, id := range []string{"alice", "bob"} {
+		if _, err := s.EnqueueEntry(ctx, soloEntry(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sessions, err := s.CreateSessions(ctx, pairAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := soloEntry("alice")
+	entry.ReplaceSession = true
+	registered, err := s.EnqueueEntry(ctx, entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(registered.Abandoned) != 1 || registered.Abandoned[0].SessionID != sessions[0].SessionID {
+		t.Fatalf("abandoned = %+v, want %s", registered.Abandoned, sessions[0].SessionID)
+	}
+	session, err := s.GetSession(ctx, sessions[0].SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Status == model.SessionPendingAccept || session.Status == model.SessionActive {
+		t.Fatalf("status = %s, want the abandoned session ended", session.Status)
+	}
+	if _, queued := s.queue["alice"]; !queued {
+		t.Fatal("alice is not queued after replacing the session")
+	}
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"matchmaking_project/internal/model"
+)
+
+// MySQL では session_players を players と結合し、参加者を現在のレーティング付きの Player として返す
+func TestMySQLGetSessionJoinsPlayers(t *testing.T) {
+	f := &fakeDB{query: func(q string, _ []driver.Value) ([]string, [][]driver.Value, error) {
+		switch {
+		case strings.Contains(q, "FROM sessions WHERE"):
+			return make([]string, 15), [][]driver.Value{{"duel", "asia", int64(90), int64(40), 0.56, 12.0, 3.0, model.SessionActive, nil, appEpoch, nil, nil, "", "", int64(0)}}, nil
+		case strings.Contains(q, "FROM session_players"):
+			member := func(id string, rating int64, team int64) []driver.Value {
+				return []driver.Value{id, rating, "asia", int64(0), appEpoch, nil, int64(0), "", team, "accepted", false, int64(0), int64(0), int64(0), ""}
+			}
+			return make([]string, 15), [][]driver.Value{member("alice", 1540, 1), member("bob", 1500, 2)}, nil
+		}
+		return nil, nil, nil
+	}}
+	s := newFakeMySQLStore(t, f)
+
+	session, err := s.GetSession(context.Background(), "session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.StartedAt == nil || !session.StartedAt.Equal(appEpoch) || session.Status != model.SessionActive {
+		t.Fatalf("session = %+v, want the active session started at %v", session, appEpoch)
+	}
+	if session.Player1 == nil || session.Player1.ID != "alice" || session.Player1.Rating != 1540 || session.Player2 == nil || session.Player2.Rating != 1500 {
+		t.Fatalf("players = %v, %v, want alice 1540 and bob 1500", session.Player1, session.Player2)
+	}
+	if st := f.find(t, "FROM session_players"); !strings.Contains(st.Query, "LEFT JOIN players p ON p.player_id = sp.player_id") {
+		t.Errorf("member query = %q, want a join against players", st.Query)
+	}
+}
+
+func TestGetSessionNotFound(t *testing.T) {
+	s := newFakeMySQLStore(t, &fakeDB{})
+	if _, err := s.GetSession(context.Background(), "session-1"); !errors.Is(err, model.ErrSessionNotFound) {
+		t.Errorf("mysql: err = %v, want ErrSessionNotFound", err)
+	}
+	if _, err := NewMemoryStore(DefaultConfig()).GetSession(context.Background(), "session-1"); !errors.Is(err, model.ErrSessionNotFound) {
+		t.Errorf("memory: err = %v, want ErrSessionNotFound", err)
+	}
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// MYSQL_TEST_DSN を指定した場合は、2つの処理が同時に待機キューを取得しても、
+// FOR UPDATE SKIP LOCKED により互いに重ならないプレイヤーを取得することを MySQL に対して確認します（マイグレーションを適用します）。
+func TestConcurrentPullsAreDisjoint(t *testing.T) {
+	dsn := os.Getenv("MYSQL_TEST_DSN")
+	if dsn == "" {
+		t.Skip("MYSQL_TEST_DSN is not set")
+	}
+	cfg := DefaultConfig()
+	cfg.DSN = dsn
+	cfg.MatchBatchSize = 4
+	s, err := NewMySQLStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	ctx := context.Background()
+	ids := make([]string, 2*cfg.MatchBatchSize)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("skiplocked-%d", i)
+	}
+	t.Cleanup(func() {
+		if err := s.DeletePlayers(context.Background(), ids); err != nil {
+			t.Error(err)
+		}
+	})
+	for i, id := range ids {
+		entry := model.QueueEntry{
+			Players:      []model.Player{{ID: id, Rating: 1000}},
+			GameMode:     "duel",
+			Region:       "asia",
+			WaitingSince: appEpoch.Add(time.Duration(i) * time.Second),
+		}
+		if _, err := s.EnqueueEntry(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pulled := func(dst *[]string, hold func()) matchPlanner {
+		return func(entries []model.QueueEntry, _, _ model.OpponentSet) []model.SessionResult {
+			for _, e := range entries {
+				*dst = append(*dst, model.PlayerIDs(e.Players)...)
+			}
+			hold()
+			return nil
+		}
+	}
+
+	// 1つ目の処理はロックを保持したまま、2つ目の処理が取得し終えるまで待つ
+	var first, second []string
+	locked, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.CreateSessions(ctx, pulled(&first, func() {
+			close(locked)
+			<-release
+		}))
+		done <- err
+	}()
+	select {
+	case <-locked:
+	case err := <-done:
+		t.Fatalf("first pull: %v", err)
+	}
+	_, err = s.CreateSessions(ctx, pulled(&second, func() {}))
+	close(release)
+	if err != nil {
+		t.Fatalf("second pull: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("first pull: %v", err)
+	}
+
+	slices.Sort(first)
+	slices.Sort(second)
+	if !slices.Equal(first, ids[:cfg.MatchBatchSize]) || !slices.Equal(second, ids[cfg.MatchBatchSize:]) {
+		t.Fatalf("pulls = %v and %v, want the oldest batch and then the next one", first, second)
+	}
+}
@@ -0,0 +1,16 @@
+package store
+
+import (
+	"errors"
+)
+
+var (
+	// ErrSessionNotActive は確定済み（active）でないセッションに観戦者を追加しようとした場合のエラーです。
+	ErrSessionNotActive = errors.New("session is not active")
+	// ErrSpectatorIsParticipant は追加しようとした観戦者がセッションの参加者である場合のエラーです。
+	ErrSpectatorIsParticipant = errors.New("player is a participant of the session")
+	// ErrSpectatorLimitReached はセッションの観戦者が MaxSpectatorsPerSession に達している場合のエラーです。
+	ErrSpectatorLimitReached = errors.New("spectator limit reached")
+	// ErrNotSpectating は指定したプレイヤーがセッションの観戦者として登録されていない場合のエラーです。
+	ErrNotSpectating = errors.New("player is not a spectator of the session")
+)
@@ -0,0 +1,305 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"matchmaking_project/internal/model"
+)
+
+// ErrPlayerNotFound は指定したプレイヤーが存在しない場合のエラーです。
+var ErrPlayerNotFound = errors.New("player not found")
+
+// ErrNotQueued は指定したプレイヤーが待機キューにいない場合のエラーです。
+var ErrNotQueued = errors.New("player is not in the matchmaking queue")
+
+// matchPlanner は待機中のエントリ（待機開始順。未終了のセッションの参加者を含むエントリは除く）と最近の対戦相手の組み合わせ、ブロックしている組み合わせから、作成するセッションを決めます。
+type matchPlanner func(entries []model.QueueEntry, recent, blocked model.OpponentSet) []model.SessionResult
+
+// Store はマッチングの状態（プレイヤー・待機キュー・セッションなど）の保存先です。
+// 本番では mysqlStore を、テストや MySQL のないローカル開発では MemoryStore を使います。
+type Store interface {
+	// Ping は保存先に接続できるかを確認します。
+	Ping(ctx context.Context) error
+	// Close は保存先との接続を閉じます。
+	Close() error
+	// MatcherRole はマッチングのリーダー選出でのこのインスタンスの役割（leader / standby）を返します。選出を行っていない場合は空文字です。
+	MatcherRole() string
+
+	// GetPlayerProfile はプレイヤー情報を返します。存在しない場合は ErrPlayerNotFound を返します。
+	GetPlayerProfile(ctx context.Context, playerID string) (model.PlayerProfile, error)
+	// GetHeadToHead は playerID から見た opponentID との対戦成績を返します。対戦結果がない場合はゼロの成績を返します。
+	GetHeadToHead(ctx context.Context, playerID, opponentID string) (model.HeadToHead, error)
+	// SetPlayerRating はプレイヤーのレーティングを更新し、更新後のプレイヤー情報を返します。
+	// 存在しないプレイヤーであれば作成し、created を true にします。
+	SetPlayerRating(ctx context.Context, playerID string, rating int) (profile model.PlayerProfile, created bool, err error)
+
+	// TopPlayers はレーティングの高い順（同じ場合は対戦数の多い順、プレイヤーID順）に、offset 人を飛ばして最大 limit 人のプレイヤーを返します。
+	// セルフテストの合成プレイヤーは含めません。
+	TopPlayers(ctx context.Context, limit, offset int) ([]model.PlayerProfile, error)
+	// PlayerRank はプレイヤーの TopPlayers の順での順位（1 始まり）を返します。存在しない場合（合成プレイヤーを含む）は ErrPlayerNotFound を返します。
+	PlayerRank(ctx context.Context, playerID string) (int, error)
+
+	// BanPlayer はプレイヤーの参加禁止を登録します。既に登録されている場合は期限と理由を上書きし、created を false にします。
+	BanPlayer(ctx context.Context, ban PlayerBan) (created bool, err error)
+	// UnbanPlayer はプレイヤーの参加禁止を解除します。登録されていない場合は ErrNotBanned を返します。
+	UnbanPlayer(ctx context.Context, playerID string) error
+	// BlockPlayer はプレイヤーが blockedID のプレイヤーとマッチングされないよう登録します。既に登録されている場合は created を false にします。
+	// プレイヤーの登録数が limit に達している場合は ErrBlockLimitReached を返します。
+	BlockPlayer(ctx context.Context, playerID, blockedID string, limit int) (created bool, err error)
+	// UnblockPlayer はプレイヤーのブロックを解除します。登録されていない場合は ErrNotBlocked を返します。
+	UnblockPlayer(ctx context.Context, playerID, blockedID string) error
+	// ActiveBan は PlayerIDs のうち now の時点で参加禁止のプレイヤーがいれば、その禁止を返します（banned が true）。
+	ActiveBan(ctx context.Context, playerIDs []string, now time.Time) (ban PlayerBan, banned bool, err error)
+	// RecordCooldownOffense はプレイヤーの違反（辞退・不在）を記録し、違反の回数に応じたクールダウン（CooldownPolicy）を設定して返します。
+	// 存在しないプレイヤーの場合は ErrPlayerNotFound を、クールダウンを設けない設定の場合は ErrCooldownDisabled を返します。
+	RecordCooldownOffense(ctx context.Context, playerID string, now time.Time) (PlayerCooldown, error)
+	// ActiveCooldown は PlayerIDs のうち now の時点でクールダウン中のプレイヤーがいれば、期限の最も遅いクールダウンを返します（active が true）。
+	ActiveCooldown(ctx context.Context, playerIDs []string, now time.Time) (cooldown PlayerCooldown, active bool, err error)
+
+	// EnqueueEntry はエントリの各メンバーのプレイヤー情報を取得（未登録なら作成）し、待機キューへ登録します。
+	// メンバーの Rating が 0 でない場合（TRUST_CLIENT_RATING）は、プレイヤーのレーティングをその値で作成・上書きします。
+	// 中止されたセッションから待機キューへ戻されたエントリであれば、元の待機開始時刻のまま待機を再開します。
+	// 既にメンバーのいずれかが登録済みの場合は ErrAlreadyQueued を、待機キューが上限（Config.MaxQueueSize）に達している場合は ErrQueueFull を返します。
+	// メンバーのいずれかが未終了（承諾待ち・確定）のセッションに参加している場合は、登録と同じトランザクションで確認して ActiveSessionError を返します。
+	// entry.ReplaceSession の場合はそのセッションを放棄（中止）して登録し、中止したセッションを戻り値の Abandoned に設定します。
+	EnqueueEntry(ctx context.Context, entry model.QueueEntry) (model.QueueEntry, error)
+	// DequeuePlayer はプレイヤー（パーティで参加している場合はパーティ全体）を待機キューから削除します。
+	DequeuePlayer(ctx context.Context, playerID string) error
+	// SuspendEntry はプレイヤー（パーティの場合はパーティ全体）を、元の待機開始時刻のままクライアントの再接続を待つ状態（Requeued）にし、
+	// 有効期限を expiresAt までに縮めます。待機キューにいない場合は ErrNotQueued を返します。
+	SuspendEntry(ctx context.Context, playerID string, expiresAt time.Time) error
+	// ListQueuedPlayers は待機キューのプレイヤーを待機開始の古い順に返します。
+	ListQueuedPlayers(ctx context.Context) ([]QueuedPlayer, error)
+	// QueuePosition はプレイヤーの待機キューでの順番を返します。待機キューにいない場合は ErrNotQueued を返します。
+	QueuePosition(ctx context.Context, playerID string) (queuePosition, error)
+	// SweepExpiredEntries は有効期限を過ぎたエントリを待機キューから削除し、削除したプレイヤー数を返します。
+	SweepExpiredEntries(ctx context.Context, now time.Time) (int64, error)
+
+	// CreateSessions は待機キューを排他的に確認して plan にロビーを組ませ、返されたセッションを保存します。
+	// セッションの参加者は待機キューから削除します。保存したセッションを返します。
+	CreateSessions(ctx context.Context, plan matchPlanner) ([]model.SessionResult, error)
+	// GetSession はセッションと参加者を返します。存在しない場合は ErrSessionNotFound を返します。
+	GetSession(ctx context.Context, sessionID string) (model.SessionResult, error)
+	// RecentSession はプレイヤーが参加している、startedAfter 以降に成立した未終了（承諾待ち・確定）のセッションのうち最新のものを返します。
+	// 該当するセッションがない場合は ErrSessionNotFound を返します。
+	RecentSession(ctx context.Context, playerID string, startedAfter time.Time) (model.SessionResult, error)
+	// AckSessionResult はプレイヤーがセッションの結果を受け取ったことを記録し、以後 RecentSession でそのセッションを返さないようにします。
+	// プレイヤーがセッションの参加者でない場合は ErrSessionNotFound を返します。記録済みの場合も成功します。
+	AckSessionResult(ctx context.Context, sessionID, playerID string, at time.Time) error
+	// PendingSessions は承諾待ちのセッション（SessionID と AcceptDeadline のみ）を返します。
+	PendingSessions(ctx context.Context) ([]model.SessionResult, error)
+	// AddSpectator は確定済みのセッションに playerID を観戦者として追加します。既に観戦者の場合は created を false にします。
+	// セッションがない場合は ErrSessionNotFound、参加者の場合は ErrSpectatorIsParticipant、確定済みでない場合は ErrSessionNotActive、
+	// 観戦者が limit に達している場合は ErrSpectatorLimitReached を返します。
+	AddSpectator(ctx context.Context, sessionID, playerID string, limit int) (created bool, err error)
+	// RemoveSpectator はセッションの観戦者を削除します。登録されていない場合は ErrNotSpectating を返します。
+	RemoveSpectator(ctx context.Context, sessionID, playerID string) error
+	// ResolveReadyCheck は参加者の承諾・辞退を記録し、状態が確定すればセッションを更新します。
+	// playerID が空の場合は承諾期限切れとして扱います。状態が確定した場合は resolved が true になります。
+	ResolveReadyCheck(ctx context.Context, sessionID, playerID, state string) (session model.SessionResult, resolved bool, err error)
+
+	// UndeliveredNotifications は createdBefore より前に作成し、まだ通知できていないマッチング結果を作成の古い順に返します。
+	UndeliveredNotifications(ctx context.Context, createdBefore time.Time) ([]matchNotification, error)
+	// MarkNotificationsDelivered はセッションのマッチング結果を通知済みにします。
+	MarkNotificationsDelivered(ctx context.Context, sessionIDs []string) error
+	// AbortUndeliveredSession は通知できないまま古くなったセッションを中止（aborted）にし、通知済みにします。
+	// 既に終了しているセッションの状態は変えません。
+	AbortUndeliveredSession(ctx context.Context, sessionID string) error
+
+	// ExpireSessions は startedBefore より前に開始した確定済み（active）のセッションを期限切れ（expired）にし、その件数を返します。
+	ExpireSessions(ctx context.Context, startedBefore time.Time) (int64, error)
+	// RecordSessionResult は確定済み（active）のセッションに対戦結果を記録して終了（completed）にし、参加者のレーティングを更新します。
+	// レーティングの変化量は、参加者の現在のレーティングと対戦数を設定したセッションを report.RatingChanges に渡して求めます。
+	// 同じトランザクションで参加者の勝ち・負け・引き分けの数と、相手ごとの対戦成績（head-to-head）も更新します。
+	// セッションがない場合は ErrSessionNotFound、確定済みでない場合は ErrSessionNotActive を返します。
+	RecordSessionResult(ctx context.Context, report SessionReport) (model.SessionResult, error)
+	// DeleteEndedSessions は endedBefore より前に終了した（expired・aborted・completed の）セッションと参加者を削除し、削除したセッション数を返します。
+	DeleteEndedSessions(ctx context.Context, endedBefore time.Time) (int64, error)
+
+	// BeginIdempotentRequest は Idempotency-Key（key）のリクエストを処理中として ttl の間登録します。
+	// 期限内の登録が既にある場合は登録せず、その状態を返します（found が true）。
+	BeginIdempotentRequest(ctx context.Context, key string, req IdempotentRequest, ttl time.Duration) (existing IdempotentRequest, found bool, err error)
+	// FinishIdempotentRequest は key のリクエストのレスポンス（Done の req）を保存し、ttl の間保持します。
+	FinishIdempotentRequest(ctx context.Context, key string, req IdempotentRequest, ttl time.Duration) error
+	// AbandonIdempotentRequest は key の登録を取り消します（同じキーで再送されたリクエストを改めて処理する）。
+	AbandonIdempotentRequest(ctx context.Context, key string) error
+
+	// GetServiceState はサービス全体の状態を返します。未登録の場合は空文字を返します。
+	GetServiceState(ctx context.Context, key string) (string, error)
+	// SetServiceState はサービス全体の状態を保存します。
+	SetServiceState(ctx context.Context, key, value string) error
+	// CompareAndSwapServiceState は key の値が old の場合のみ new に置き換え、置き換えたかどうかを返します。
+	// old が空文字の場合は未登録（または空文字）のキーのみ登録し、new が空文字の場合はキーを削除します。
+	CompareAndSwapServiceState(ctx context.Context, key, old, new string) (bool, error)
+
+	// DecayInactiveRatings は inactiveBefore より後に対戦していない（セッションが確定していない）プレイヤーのうち、
+	// decayedBefore より後に減衰していないプレイヤーのレーティングを decayedRating で mean へ近づけ、減衰したプレイヤー数を返します。
+	// 一度も対戦していないプレイヤーは登録した時刻から数えます。
+	DecayInactiveRatings(ctx context.Context, inactiveBefore, decayedBefore time.Time, mean int, factor float64) (int64, error)
+
+	// DeletePlayers はプレイヤーと、そのプレイヤーが参加したセッション・待機キュー・最近の対戦相手・ブロック・待機履歴の記録を削除します。
+	// セルフテストの合成データの後片付け用です（セッションは他の参加者の分も含めて削除します）。
+	DeletePlayers(ctx context.Context, playerIDs []string) error
+
+	// QueryDiagnostics は保存された遅いクエリの実行計画を新しい順に最大 limit 件返します。
+	QueryDiagnostics(ctx context.Context, limit int) ([]queryDiagnostic, error)
+	// MatchQualityStats は since 以降に作成したセッションの対戦の質を集計します。
+	MatchQualityStats(ctx context.Context, since time.Time) (MatchQualityStats, error)
+
+	// AuditLogger は監査イベントを追記します。
+	AuditLogger
+	// ListAuditEvents は条件に合う監査イベントを追記した順に返します。
+	ListAuditEvents(ctx context.Context, q AuditQuery) ([]AuditEvent, error)
+
+	// RecordQueueHistory は待機を終えたプレイヤーの記録（待機の公平性の監査用）を保存します。
+	RecordQueueHistory(ctx context.Context, records []QueueHistoryRecord) error
+	// WaitStats は since 以降に待機を終えたプレイヤーを、境界 bands で区切ったレーティング帯ごとに集計します（len(bands)+1 個）。
+	// mode が空でなければそのゲームモードだけを集計します。
+	WaitStats(ctx context.Context, since time.Time, mode string, bands []int) ([]WaitBandStats, error)
+	// DeleteQueueHistory は resolvedBefore より前に待機を終えた記録を削除し、削除した件数を返します。
+	DeleteQueueHistory(ctx context.Context, resolvedBefore time.Time) (int64, error)
+
+	// BackfillGamesPlayed は cursor より後のプレイヤーを最大 limit 人、確定済みのセッションから対戦数を再計算します。
+	BackfillGamesPlayed(ctx context.Context, cursor string, limit int) (next string, n int, err error)
+	// BackfillWinLoss は cursor より後のプレイヤーを最大 limit 人、結果を報告したセッションから勝ち・負け・引き分けの数を再計算します。
+	BackfillWinLoss(ctx context.Context, cursor string, limit int) (next string, n int, err error)
+	// BackfillHeadToHead は cursor より後のプレイヤーを最大 limit 人、結果を報告したセッションからそのプレイヤーから見た相手ごとの対戦成績を再計算します。
+	BackfillHeadToHead(ctx context.Context, cursor string, limit int) (next string, n int, err error)
+}
+
+// queuePosition は待機キューでのプレイヤーの順番です。
+// マッチングはゲームモードごとに待機開始の古い順に行うため、同じゲームモードのプレイヤーの中での順番を数えます。
+type queuePosition struct {
+	Player QueuedPlayer
+	// Position は同じゲームモードで待機しているプレイヤーのうち、何番目に古いか（1 始まり）です。
+	Position int
+	// Waiting は同じゲームモードで待機しているプレイヤー数です。
+	Waiting int
+}
+
+// findQueuePosition は待機開始順に並んだ rows からプレイヤーの順番を求めます。
+func findQueuePosition(rows []QueuedPlayer, playerID string) (queuePosition, error) {
+	var pos queuePosition
+	found := false
+	for _, row := range rows {
+		if row.ID == playerID {
+			pos.Player = row
+			found = true
+			break
+		}
+	}
+	if !found {
+		return queuePosition{}, ErrNotQueued
+	}
+	for _, row := range rows {
+		if row.GameMode != pos.Player.GameMode {
+			continue
+		}
+		pos.Waiting++
+		if row.ID == playerID || row.WaitingSince.Before(pos.Player.WaitingSince) ||
+			(row.WaitingSince.Equal(pos.Player.WaitingSince) && row.ID < playerID) {
+			pos.Position++
+		}
+	}
+	return pos, nil
+}
+
+// StateStore は service_state の読み書きのみを行う Store の一部です。
+type StateStore interface {
+	GetServiceState(ctx context.Context, key string) (string, error)
+	SetServiceState(ctx context.Context, key, value string) error
+}
+
+// settleReadyCheck は承諾待ちのセッションの状態を参加者の承諾状態から決めます。
+// 全員が承諾していれば active に、辞退した参加者がいる（または expired）場合は aborted にして true を返します。
+// 確定済み（active）のセッションも、ゲームに現れなかった参加者が報告されていれば aborted にします。
+// aborted の場合、待機キューへ戻す参加者の Requeued を true にします。
+func settleReadyCheck(session *model.SessionResult, expired bool) bool {
+	if session.Status == model.SessionActive && anyDeclined(*session) {
+		session.Status = model.SessionAborted
+		markRequeued(session, false)
+		return true
+	}
+	if session.Status != model.SessionPendingAccept {
+		return false
+	}
+	switch {
+	case allAccepted(*session):
+		session.Status = model.SessionActive
+	case expired || anyDeclined(*session):
+		session.Status = model.SessionAborted
+		markRequeued(session, expired)
+	default:
+		return false
+	}
+	return true
+}
+
+// markRequeued は中止されたセッションの参加者のうち、辞退していない（ゲームに現れなかったと報告されていない）エントリのメンバーの Requeued を true にします。
+// パーティは1人でも辞退したメンバーがいればパーティ全体を戻しません。
+// expired が true の場合（承諾期限切れ）は、承諾していないメンバーも辞退とみなします。
+func markRequeued(session *model.SessionResult, expired bool) {
+	ok := make(map[string]bool)
+	for _, p := range session.Participants {
+		if p.IsBot {
+			continue
+		}
+		key := ParticipantEntryKey(p)
+		if _, seen := ok[key]; !seen {
+			ok[key] = true
+		}
+		if p.ReadyState == model.ReadyDeclined || p.ReadyState == model.ReadyNoShow || p.ReadyState == model.ReadyAbandoned || (expired && p.ReadyState != model.ReadyAccepted) {
+			ok[key] = false
+		}
+	}
+	for i := range session.Participants {
+		// ボットは待機キューへ戻さない（ok に含まれないため false になる）
+		session.Participants[i].Requeued = ok[ParticipantEntryKey(session.Participants[i])]
+	}
+}
+
+// ParticipantEntryKey は参加者が待機していたエントリのキー（QueueEntry.key と同じ形式）を返します。
+func ParticipantEntryKey(p model.Participant) string {
+	if p.PartyID != "" {
+		return "party:" + p.PartyID
+	}
+	return p.ID
+}
+
+// GroupQueueEntries は待機開始順に並んだプレイヤーを、パーティごとに1つのエントリへまとめます。
+// パーティの有効期限は最も早く期限が来るメンバーに合わせます。
+func GroupQueueEntries(rows []QueuedPlayer) []model.QueueEntry {
+	var entries []model.QueueEntry
+	partyIndex := make(map[string]int)
+	for _, row := range rows {
+		p := model.Player{ID: row.ID, Rating: row.Rating, Region: row.Region, PingMS: row.PingMS, WaitingSince: row.WaitingSince, ExpiresAt: row.ExpiresAt, Priority: row.Priority, GamesPlayed: row.GamesPlayed, RatingRange: row.RatingRange,
+			Attributes: row.Attributes}
+		if i, ok := partyIndex[row.PartyID]; ok && row.PartyID != "" {
+			entries[i].Players = append(entries[i].Players, p)
+			if !p.ExpiresAt.IsZero() && (entries[i].ExpiresAt.IsZero() || p.ExpiresAt.Before(entries[i].ExpiresAt)) {
+				entries[i].ExpiresAt = p.ExpiresAt
+			}
+			continue
+		}
+		if row.PartyID != "" {
+			partyIndex[row.PartyID] = len(entries)
+		}
+		entries = append(entries, model.QueueEntry{
+			PartyID:      row.PartyID,
+			Players:      []model.Player{p},
+			Region:       row.Region,
+			GameMode:     row.GameMode,
+			WaitingSince: row.WaitingSince,
+			Priority:     row.Priority,
+			ExpiresAt:    row.ExpiresAt,
+			RatingRange:  row.RatingRange,
+			TraceParent:  row.TraceParent,
+		})
+	}
+	for i := range entries {
+		entries[i].Rating = model.AverageRating(entries[i].Players)
+	}
+	return entries
+}
@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+)
+
+// TracerName は OpenTelemetry のトレーサーの名前です。
+const TracerName = "matchmaking"
+
+// Tracer はリクエスト・マッチング・DB のクエリのスパンを作成します。
+// グローバルの TracerProvider に委譲するため、tracingComponent が設定するまで（OTLP の送信先を設定しない場合は常に）何も記録しません。
+var Tracer = otel.Tracer(TracerName)
+
+// TracePropagator は HTTP ヘッダーと待機キューに保存するトレースの文脈（W3C traceparent）の形式です。
+var TracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// InjectTraceParent は ctx のスパンの文脈を W3C traceparent の形式で返します。スパンがない場合は空文字です。
+// マッチングは待機キューを介して非同期に行うため、エントリと一緒に保存してマッチングのスパンからたどれるようにします。
+func InjectTraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// extractTraceParent は InjectTraceParent で保存したスパンの文脈を返します。不正な値や空文字の場合は無効な文脈です。
+func extractTraceParent(traceParent string) trace.SpanContext {
+	if traceParent == "" {
+		return trace.SpanContext{}
+	}
+	ctx := propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier{"traceparent": traceParent})
+	return trace.SpanContextFromContext(ctx)
+}
+
+// TraceMatchedLobbies はマッチングの成立をスパンに記録します。
+// セッションごとに、参加したエントリの待機キューへの登録リクエストのスパンをリンクした matchmaking.match スパンを作成し、
+// 各エントリの登録リクエストのトレースには、待機開始からマッチング成立までの matchmaking.queue_wait スパンを追加します。
+// これにより、登録リクエストのトレースから待機キューでの待ち時間とマッチングまでを一続きに確認できます。
+func TraceMatchedLobbies(ctx context.Context, lobbies []queue.Lobby, sessions []model.SessionResult, now time.Time) {
+	for i, l := range lobbies {
+		var links []trace.Link
+		for _, e := range l.Entries() {
+			if sc := extractTraceParent(e.TraceParent); sc.IsValid() {
+				links = append(links, trace.Link{SpanContext: sc})
+			}
+		}
+		_, span := Tracer.Start(ctx, "matchmaking.match", trace.WithTimestamp(now), trace.WithLinks(links...),
+			trace.WithAttributes(attribute.String("matchmaking.session_id", sessions[i].SessionID), attribute.String("matchmaking.game_mode", l.GameMode),
+				attribute.Int("matchmaking.quality", sessions[i].Quality)))
+		matchSpan := span.SpanContext()
+		span.End()
+
+		for _, e := range l.Entries() {
+			sc := extractTraceParent(e.TraceParent)
+			if !sc.IsValid() || e.WaitingSince.IsZero() {
+				continue
+			}
+			parent := trace.ContextWithRemoteSpanContext(context.Background(), sc)
+			_, wait := Tracer.Start(parent, "matchmaking.queue_wait", trace.WithTimestamp(e.WaitingSince), trace.WithLinks(trace.Link{SpanContext: matchSpan}),
+				trace.WithAttributes(attribute.String("matchmaking.session_id", sessions[i].SessionID), attribute.String("matchmaking.entry", e.Key()),
+					attribute.Float64("matchmaking.wait_seconds", now.Sub(e.WaitingSince).Seconds())))
+			wait.End(trace.WithTimestamp(now))
+		}
+	}
+}
+
+// StartQuerySpan は DB のクエリ（name は StoreQuerySeconds のラベルと同じ名前）の子スパンを開始します。
+func StartQuerySpan(ctx context.Context, name string) trace.Span {
+	_, span := Tracer.Start(ctx, "db "+name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "mysql"), attribute.String("db.operation.name", name)))
+	return span
+}
+
+// EndQuerySpan はクエリのスパンを終了します。エラーの場合はスパンに記録します。
+func EndQuerySpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
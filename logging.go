@@ -0,0 +1,12 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+)
+
+// fatal はエラーログを出力してプロセスを終了します。
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -1,274 +1,880 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"matchmaking_project/internal/api"
+	"matchmaking_project/internal/lifecycle"
+	"matchmaking_project/internal/metrics"
+	"matchmaking_project/internal/model"
+	"matchmaking_project/internal/queue"
+	"matchmaking_project/internal/ratelimit"
+	"matchmaking_project/internal/secret"
+	"matchmaking_project/internal/store"
 )
 
-// Player はユーザ情報を表します。
-type Player struct {
-	ID     string `json:"id"`
-	Rating int    `json:"rating"`
-}
+// ビルドの情報です。ビルド時に -ldflags "-X main.version=..." で埋め込みます（README の build info を参照）。
+var (
+	version   = "unknown"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
 
-// SessionResult は対戦セッションの結果を表します。
-type SessionResult struct {
-	SessionID string `json:"session_id"`
-	Player1   Player `json:"player1"`
-	Player2   Player `json:"player2"`
-}
+func main() {
+	api.InitLogger()
+	apiCfg := api.DefaultConfig()
+	storeCfg := store.DefaultConfig()
+	apiCfg.Build = api.Build{Version: version, Commit: commit, Time: buildTime}
+	info := apiCfg.Build.Info(time.Now(), time.Now())
+	slog.Info("starting", "version", info.Version, "commit", info.Commit, "build_time", info.BuildTime, "go_version", info.GoVersion)
+
+	if v := os.Getenv("DB_DSN"); v != "" {
+		storeCfg.DSN = v
+	}
 
-var (
-	// グローバルDB接続
-	db *sql.DB
+	if v := os.Getenv("CROSS_REGION_FALLBACK"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			fatal("CROSS_REGION_FALLBACK の形式が不正です", "value", v, "error", err)
+		}
+		apiCfg.Queue.CrossRegionFallback = d
+	}
 
-	// 待機中のプレイヤーと対応するマッチ結果を返すチャネルのマップ
-	waitingChans      = make(map[string]chan SessionResult)
-	waitingChansMutex sync.Mutex
-)
+	for _, c := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"MATCHMAKING_TIMEOUT_MIN", &apiCfg.Queue.MinTimeout},
+		{"MATCHMAKING_TIMEOUT_MAX", &apiCfg.Queue.MaxTimeout},
+	} {
+		if v := os.Getenv(c.name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < time.Second {
+				fatal(c.name+" の形式が不正です（1s 以上）", "value", v, "error", err)
+			}
+			*c.dst = d
+		}
+	}
+	if apiCfg.Queue.MinTimeout > apiCfg.Queue.MaxTimeout {
+		fatal("MATCHMAKING_TIMEOUT_MIN が MATCHMAKING_TIMEOUT_MAX より長くなっています", "min", apiCfg.Queue.MinTimeout.String(), "max", apiCfg.Queue.MaxTimeout.String())
+	}
 
-// initDB は MySQL への接続を初期化します。
-// DSN は適宜ご自身の環境に合わせて変更してください。
-func initDB() error {
-	// 例: "user:password@tcp(127.0.0.1:3306)/dbname?parseTime=true&multiStatements=true"
-	dsn := "yusuke:password@tcp(127.0.0.1:3306)/matchmaking?parseTime=true"
-	var err error
-	db, err = sql.Open("mysql", dsn)
-	if err != nil {
-		return fmt.Errorf("DB接続エラー: %v", err)
+	for _, c := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"HTTP_READ_HEADER_TIMEOUT", &apiCfg.HTTPReadHeaderTimeout},
+		{"HTTP_READ_TIMEOUT", &apiCfg.HTTPReadTimeout},
+		{"HTTP_IDLE_TIMEOUT", &apiCfg.HTTPIdleTimeout},
+		{"HTTP_WRITE_TIMEOUT", &apiCfg.HTTPWriteTimeout},
+	} {
+		if v := os.Getenv(c.name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				fatal(c.name+" の形式が不正です", "value", v, "error", err)
+			}
+			*c.dst = d
+		}
 	}
-	if err = db.Ping(); err != nil {
-		return fmt.Errorf("DB Pingエラー: %v", err)
+	if v := os.Getenv("HTTP_MAX_HEADER_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1<<10 {
+			fatal("HTTP_MAX_HEADER_BYTES の形式が不正です（1024 以上）", "value", v, "error", err)
+		}
+		apiCfg.HTTPMaxHeaderBytes = n
 	}
-	return nil
-}
 
-// initSchemaFromFile は、外部ファイルからスキーマ情報を読み込みテーブルを作成します。
-func initSchemaFromFile(filename string) error {
-	data, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return fmt.Errorf("スキーマファイル読み込みエラー: %v", err)
+	if v := os.Getenv("GAME_MODES_FILE"); v != "" {
+		modes, err := queue.LoadGameModes(v, apiCfg.Queue.MinTimeout, apiCfg.Queue.MaxTimeout)
+		if err != nil {
+			fatal("GAME_MODES_FILE の読み込みに失敗しました", "value", v, "error", err)
+		}
+		apiCfg.Queue.GameModes = modes
+	}
+	if v := os.Getenv("GAME_MODES"); v != "" {
+		modes, err := apiCfg.Queue.GameModes.Restrict(strings.Split(v, ","))
+		if err != nil {
+			fatal("GAME_MODES の設定が不正です", "value", v, "error", err)
+		}
+		apiCfg.Queue.GameModes = modes
+	}
+	// 書き込みの期限が long-poll の待機時間より短いと、待機後のタイムアウトのレスポンスを返せない。
+	// ゲームモードの待機時間も含めて比べるため、GAME_MODES_FILE の読み込み後に確認する
+	if apiCfg.HTTPWriteTimeout > 0 && apiCfg.HTTPWriteTimeout <= apiCfg.Queue.LongestTimeout() {
+		fatal("HTTP_WRITE_TIMEOUT は long-poll の最長の待機時間より長くしてください", "write_timeout", apiCfg.HTTPWriteTimeout.String(), "longest_wait", apiCfg.Queue.LongestTimeout().String())
 	}
 
-	// ファイル内のSQL文をセミコロンで分割して個別に実行する
-	stmts := strings.Split(string(data), ";")
-	for _, stmt := range stmts {
-		stmt = strings.TrimSpace(stmt)
-		if stmt == "" {
-			continue
+	// ゲームモードの allocator_url を使うため、GAME_MODES_FILE の読み込み後に生成する
+	allocator, err := api.NewModeAllocator(os.Getenv("SESSION_ALLOCATOR_URL"), apiCfg.Queue.GameModes)
+	if err != nil {
+		fatal("SESSION_ALLOCATOR_URL の設定が不正です", "error", err)
+	}
+	if v := os.Getenv("SESSION_ALLOCATOR_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			fatal("SESSION_ALLOCATOR_TIMEOUT の形式が不正です", "value", v, "error", err)
 		}
-		_, err := db.Exec(stmt)
+		apiCfg.SessionAllocatorTimeout = d
+	}
+
+	if v := os.Getenv("TIMEOUT_HINTS_FILE"); v != "" {
+		hints, err := api.LoadTimeoutHints(v)
 		if err != nil {
-			return fmt.Errorf("ステートメント実行エラー [%s]: %v", stmt, err)
+			fatal("TIMEOUT_HINTS_FILE の読み込みに失敗しました", "value", v, "error", err)
 		}
+		apiCfg.TimeoutHints = hints
 	}
-	return nil
-}
 
-// insertWaitingPlayer は待機プレイヤーを DB に登録します。
-func insertWaitingPlayer(p Player) error {
-	query := "INSERT INTO matchmaking_queue (player_id, rating, waiting_since) VALUES (?, ?, NOW())"
-	_, err := db.Exec(query, p.ID, p.Rating)
-	return err
-}
+	// API キー（未設定の場合は認証しない。ローカル開発向け）
+	if v := os.Getenv("API_KEYS"); v != "" {
+		apiCfg.APIKeys = api.ParseAPIKeys(v)
+	} else {
+		slog.Warn("API_KEYS is not set; requests are not authenticated")
+	}
+	// プレイヤーのトークンの署名鍵（カンマ区切りで複数指定できる。ログインサーバの鍵の入れ替え用）
+	if v := os.Getenv("PLAYER_TOKEN_SECRET"); v != "" {
+		keys, err := secret.NewKeyRing(model.SplitCommaList(v)...)
+		if err != nil {
+			fatal("PLAYER_TOKEN_SECRET が不正です", "error", err)
+		}
+		apiCfg.PlayerTokenKeys = keys
+	} else {
+		slog.Warn("PLAYER_TOKEN_SECRET is not set; player ids in requests are trusted")
+	}
 
-// deleteWaitingPlayer は指定プレイヤーを DB の待機キューから削除します。
-func deleteWaitingPlayer(playerID string) error {
-	query := "DELETE FROM matchmaking_queue WHERE player_id = ?"
-	_, err := db.Exec(query, playerID)
-	return err
-}
+	// 再開用のトークンの署名鍵（再起動の前後で同じ鍵を使う。カンマ区切りで鍵の入れ替えに対応）
+	if v := os.Getenv("RESUME_TOKEN_SECRET"); v != "" {
+		keys, err := secret.NewKeyRing(model.SplitCommaList(v)...)
+		if err != nil {
+			fatal("RESUME_TOKEN_SECRET が不正です", "error", err)
+		}
+		apiCfg.ResumeTokenKeys = keys
+	}
 
-// getWaitingPlayers は待機中プレイヤーを DB から取得します。
-func getWaitingPlayers(tx *sql.Tx) ([]Player, error) {
-	query := "SELECT player_id, rating FROM matchmaking_queue ORDER BY waiting_since ASC FOR UPDATE"
-	rows, err := tx.Query(query)
-	if err != nil {
-		return nil, err
+	// マッチトークンの署名鍵（ゲームサーバの検証と同じ鍵を使う。カンマ区切りで鍵の入れ替えに対応）
+	if v := os.Getenv("MATCH_TOKEN_SECRET"); v != "" {
+		keys, err := secret.NewKeyRing(model.SplitCommaList(v)...)
+		if err != nil {
+			fatal("MATCH_TOKEN_SECRET が不正です", "error", err)
+		}
+		apiCfg.MatchTokenKeys = keys
 	}
-	defer rows.Close()
 
-	var players []Player
-	for rows.Next() {
-		var p Player
-		if err := rows.Scan(&p.ID, &p.Rating); err != nil {
-			return nil, err
+	// リバースプロキシの背後で動かす場合のパスの接頭辞と、転送ヘッダーを信頼するプロキシ
+	if v := os.Getenv("BASE_PATH"); v != "" {
+		p, err := api.ParseBasePath(v)
+		if err != nil {
+			fatal("BASE_PATH の設定が不正です", "value", v, "error", err)
 		}
-		players = append(players, p)
+		apiCfg.BasePath = p
+	}
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		prefixes, err := api.ParseTrustedProxies(v)
+		if err != nil {
+			fatal("TRUSTED_PROXIES の設定が不正です", "value", v, "error", err)
+		}
+		apiCfg.TrustedProxies = prefixes
 	}
-	return players, nil
-}
 
-// insertSession は生成したセッション情報を DB に登録します。
-func insertSession(session SessionResult) error {
-	query := "INSERT INTO sessions (session_id, player1_id, player2_id, start_time) VALUES (?, ?, ?, NOW())"
-	_, err := db.Exec(query, session.SessionID, session.Player1.ID, session.Player2.ID)
-	return err
-}
+	apiCfg.AdminSecret = os.Getenv("ADMIN_SECRET")
+	// 管理用エンドポイントの公開先（未指定の場合は API と同じポート、off の場合は公開しない）
+	adminAddr := os.Getenv("ADMIN_ADDR")
+	apiCfg.MountAdmin = adminAddr == ""
+	// gRPC の待ち受けアドレス（未指定の場合は :50051、off の場合は待ち受けない）
+	grpcAddr := os.Getenv("GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = ":50051"
+	}
 
-// createSession は新しいセッションIDを生成してセッション結果を返します。
-func createSession(p1, p2 Player) SessionResult {
-	sessionID := fmt.Sprintf("session-%d", time.Now().UnixNano())
-	return SessionResult{
-		SessionID: sessionID,
-		Player1:   p1,
-		Player2:   p2,
+	// CORS（既定ではどのオリジンも許可しない。開発時は CORS_ALLOWED_ORIGINS=* を指定する）
+	if v := os.Getenv("CORS_ALLOWED_ORIGINS"); v != "" {
+		origins, err := api.ParseCORSOrigins(v)
+		if err != nil {
+			fatal("CORS_ALLOWED_ORIGINS の設定が不正です", "value", v, "error", err)
+		}
+		apiCfg.CORS.AllowedOrigins = origins
+	} else {
+		slog.Warn("CORS_ALLOWED_ORIGINS is not set; cross-origin requests are not allowed")
+	}
+	if v := os.Getenv("CORS_ALLOWED_METHODS"); v != "" {
+		apiCfg.CORS.AllowedMethods = model.SplitCommaList(v)
+	}
+	if v := os.Getenv("CORS_ALLOWED_HEADERS"); v != "" {
+		apiCfg.CORS.AllowedHeaders = model.SplitCommaList(v)
+	}
+	if v := os.Getenv("CORS_MAX_AGE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			fatal("CORS_MAX_AGE の形式が不正です", "value", v, "error", err)
+		}
+		apiCfg.CORS.MaxAge = d
+	}
+	if v := os.Getenv("CORS_ALLOW_CREDENTIALS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			fatal("CORS_ALLOW_CREDENTIALS の形式が不正です", "value", v, "error", err)
+		}
+		apiCfg.CORS.AllowCredentials = b
 	}
-}
 
-// matchmakingProcessor は別ゴルーチンで動作し、DB上の待機プレイヤーを定期的にチェックしてマッチングを実施します。
-func matchmakingProcessor() {
-	for {
-		time.Sleep(1 * time.Second)
+	for _, c := range []struct {
+		prefix string
+		cfg    *ratelimit.Config
+	}{
+		{"RATE_LIMIT_PLAYER", &apiCfg.PlayerRateLimit},
+		{"RATE_LIMIT_IP", &apiCfg.IPRateLimit},
+	} {
+		if v := os.Getenv(c.prefix + "_RPS"); v != "" {
+			rps, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				fatal(c.prefix+"_RPS の形式が不正です", "value", v, "error", err)
+			}
+			c.cfg.RPS = rps
+		}
+		if v := os.Getenv(c.prefix + "_BURST"); v != "" {
+			burst, err := strconv.Atoi(v)
+			if err != nil {
+				fatal(c.prefix+"_BURST の形式が不正です", "value", v, "error", err)
+			}
+			c.cfg.Burst = burst
+		}
+	}
 
-		// トランザクションを開始して、待機プレイヤーの一覧を取得（FOR UPDATEで排他制御）
-		tx, err := db.Begin()
+	if v := os.Getenv("BOT_FILL_AFTER"); v != "" {
+		d, err := time.ParseDuration(v)
 		if err != nil {
-			log.Printf("matchmakingProcessor: トランザクション開始エラー: %v", err)
-			continue
+			fatal("BOT_FILL_AFTER の形式が不正です", "value", v, "error", err)
 		}
+		apiCfg.Queue.BotFillAfter = d
+	}
+	if v := os.Getenv("BOT_PROFILES"); v != "" {
+		profiles, err := queue.ParseBotProfiles(v)
+		if err != nil {
+			fatal("BOT_PROFILES の設定が不正です", "value", v, "error", err)
+		}
+		apiCfg.Queue.BotProfiles = profiles
+	}
 
-		players, err := getWaitingPlayers(tx)
+	if v := os.Getenv("RATING_TIERS"); v != "" {
+		tiers, err := queue.ParseRatingTiers(v)
 		if err != nil {
-			log.Printf("matchmakingProcessor: 待機プレイヤー取得エラー: %v", err)
-			tx.Rollback()
-			continue
-		}
-
-		// マッチング可能なプレイヤーが２人以上いる場合、先頭2名をマッチング
-		if len(players) >= 2 {
-			p1 := players[0]
-			p2 := players[1]
-			session := createSession(p1, p2)
-
-			// マッチング済みプレイヤーを待機キューから削除
-			delQuery := "DELETE FROM matchmaking_queue WHERE player_id IN (?, ?)"
-			if _, err := tx.Exec(delQuery, p1.ID, p2.ID); err != nil {
-				log.Printf("matchmakingProcessor: 待機プレイヤー削除エラー: %v", err)
-				tx.Rollback()
-				continue
-			}
+			fatal("RATING_TIERS の設定が不正です", "value", v, "error", err)
+		}
+		apiCfg.Queue.RatingTiers = tiers
+	}
 
-			// セッション情報を DB に登録
-			if err := insertSession(session); err != nil {
-				log.Printf("matchmakingProcessor: セッション登録エラー: %v", err)
-				tx.Rollback()
-				continue
-			}
+	if v := os.Getenv("MATCHER_LEADER_ELECTION"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			fatal("MATCHER_LEADER_ELECTION の形式が不正です", "value", v, "error", err)
+		}
+		storeCfg.LeaderElection = b
+	}
 
-			if err := tx.Commit(); err != nil {
-				log.Printf("matchmakingProcessor: コミットエラー: %v", err)
-				continue
-			}
-			log.Printf("Matched players %s and %s -> session %s", p1.ID, p2.ID, session.SessionID)
+	if v := os.Getenv("MATCHER_LOCK_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			fatal("MATCHER_LOCK_TTL の形式が不正です", "value", v, "error", err)
+		}
+		storeCfg.MatcherLockTTL = d
+	}
 
-			// マッチング結果を保持しているチャネルへ通知する
-			waitingChansMutex.Lock()
-			if ch, ok := waitingChans[p1.ID]; ok {
-				ch <- session
-				delete(waitingChans, p1.ID)
-			}
-			if ch, ok := waitingChans[p2.ID]; ok {
-				ch <- session
-				delete(waitingChans, p2.ID)
+	// 待機しているクライアントがいるエントリを削除しないよう、最も長い待機時間を基準にする
+	apiCfg.StaleEntryAge = 2 * apiCfg.Queue.LongestTimeout()
+	if v := os.Getenv("STALE_ENTRY_AGE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || (d > 0 && d <= apiCfg.Queue.LongestTimeout()) {
+			fatal("STALE_ENTRY_AGE の形式が不正です（0 または最も長い待機時間より長い値）", "value", v, "longest_timeout", apiCfg.Queue.LongestTimeout().String(), "error", err)
+		}
+		apiCfg.StaleEntryAge = d
+	}
+
+	for _, c := range []struct {
+		name string
+		dst  *time.Duration
+		zero bool
+	}{
+		{"RECENT_OPPONENT_WINDOW", &storeCfg.RecentOpponentWindow, true},
+		{"REMATCH_FALLBACK", &apiCfg.Queue.RematchFallback, true},
+		{"PROCESSOR_INTERVAL", &apiCfg.ProcessorInterval, false},
+		{"PROCESSOR_MAX_IDLE_INTERVAL", &apiCfg.Queue.ProcessorMaxIdleInterval, false},
+		{"MATCH_RESULT_WINDOW", &apiCfg.MatchResultWindow, false},
+		{"LEADERBOARD_CACHE_TTL", &apiCfg.LeaderboardCacheTTL, true},
+		{"PRIORITY_AGING_CEILING", &apiCfg.Queue.PriorityAgingCeiling, true},
+		{"RATING_TIER_SPILLOVER", &apiCfg.Queue.RatingTierSpillover, true},
+		{"PING_FALLBACK", &apiCfg.Queue.PingFallback, true},
+		{"STARVATION_THRESHOLD", &apiCfg.Queue.StarvationThreshold, true},
+		{"SOFT_TIMEOUT_MAX_WAIT", &apiCfg.SoftTimeoutMaxWait, true},
+		{"ACCEPT_WINDOW", &apiCfg.AcceptWindow, false},
+		{"SESSION_TTL", &apiCfg.SessionTTL, false},
+		{"SESSION_RETENTION", &apiCfg.SessionRetention, true},
+		{"SESSION_SWEEP_INTERVAL", &apiCfg.SessionSweepInterval, false},
+		{"NO_SHOW_PENALTY", &apiCfg.NoShowPenalty, true},
+		{"MATCH_COOLDOWN", &storeCfg.Cooldown.Base, true},
+		{"MATCH_COOLDOWN_MAX", &storeCfg.Cooldown.Max, false},
+		{"MATCH_COOLDOWN_RESET", &storeCfg.Cooldown.Reset, false},
+		{"STATS_STREAM_INTERVAL", &apiCfg.StatsStreamInterval, false},
+		{"DB_CLOCK_SKEW_THRESHOLD", &storeCfg.ClockSkewThreshold, true},
+		{"RATING_DECAY_INTERVAL", &apiCfg.RatingDecayInterval, false},
+		{"ADMIN_CONFIRMATION_TTL", &apiCfg.AdminConfirmationTTL, false},
+	} {
+		if v := os.Getenv(c.name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 || (d == 0 && !c.zero) {
+				fatal(c.name+" の形式が不正です", "value", v, "error", err)
 			}
-			waitingChansMutex.Unlock()
-		} else {
-			// マッチング可能なプレイヤーがいなければコミットして終了
-			tx.Commit()
+			*c.dst = d
 		}
 	}
-}
+	if storeCfg.Cooldown.Max < storeCfg.Cooldown.Base {
+		fatal("MATCH_COOLDOWN_MAX は MATCH_COOLDOWN 以上にしてください", "match_cooldown", storeCfg.Cooldown.Base.String(), "match_cooldown_max", storeCfg.Cooldown.Max.String())
+	}
 
-// matchmakingHandler は、プレイヤーの対戦開始リクエストを処理し、DBと in-memory の状態を更新します。
-func matchmakingHandler(w http.ResponseWriter, r *http.Request) {
-	var player Player
-	if err := json.NewDecoder(r.Body).Decode(&player); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
+	if v := os.Getenv("DEFAULT_RATING"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < model.MinRating || n > model.MaxRating {
+			fatal(fmt.Sprintf("DEFAULT_RATING の形式が不正です（%d〜%d）", model.MinRating, model.MaxRating), "value", v, "error", err)
+		}
+		apiCfg.RatingSeeds.Default = n
+	}
+	if v := os.Getenv("TRUST_CLIENT_RATING"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			fatal("TRUST_CLIENT_RATING の形式が不正です", "value", v, "error", err)
+		}
+		apiCfg.TrustClientRating = b
+		if b {
+			slog.Warn("TRUST_CLIENT_RATING が有効です。クライアントが申告したレーティングでプレイヤーのレーティングを上書きします（本番では無効にしてください）")
+		}
 	}
 
-	// まず DB に待機プレイヤーとして登録する
-	if err := insertWaitingPlayer(player); err != nil {
-		log.Printf("matchmakingHandler: DB登録エラー: %v", err)
-		http.Error(w, "Failed to register waiting player", http.StatusInternalServerError)
-		return
+	if v := os.Getenv("RATING_DECAY_INACTIVE_DAYS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fatal("RATING_DECAY_INACTIVE_DAYS の形式が不正です", "value", v, "error", err)
+		}
+		apiCfg.RatingDecayInactiveDays = n
+	}
+	if v := os.Getenv("RATING_DECAY_FACTOR"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 || f > 1 {
+			fatal("RATING_DECAY_FACTOR の形式が不正です（0 より大きく 1 以下）", "value", v, "error", err)
+		}
+		apiCfg.RatingDecayFactor = f
+	}
+
+	if v := os.Getenv("MAX_ENTRY_LIFETIME"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			fatal("MAX_ENTRY_LIFETIME の形式が不正です", "value", v, "error", err)
+		}
+		apiCfg.MaxEntryLifetime = d
+	}
+
+	// 遅いクエリのログと実行計画の取得
+	if v := os.Getenv("SLOW_QUERY_THRESHOLD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			fatal("SLOW_QUERY_THRESHOLD の形式が不正です", "value", v, "error", err)
+		}
+		storeCfg.SlowQueryThreshold = d
+	}
+	if v := os.Getenv("LOG_QUERY_PARAMS"); v != "" {
+		switch v {
+		case store.QueryParamsNone, store.QueryParamsRedacted, store.QueryParamsFull:
+			storeCfg.QueryParams = v
+		default:
+			fatal("LOG_QUERY_PARAMS の設定が不正です", "value", v)
+		}
+	}
+	if v := os.Getenv("TICK_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			fatal("TICK_TIMEOUT の形式が不正です", "value", v, "error", err)
+		}
+		apiCfg.TickTimeout = d
 	}
 
-	// マッチング結果を受け取るためのチャネルを作成し、in-memory マップに保存
-	matchChan := make(chan SessionResult, 1)
-	waitingChansMutex.Lock()
-	waitingChans[player.ID] = matchChan
-	waitingChansMutex.Unlock()
+	if v := os.Getenv("LEADERBOARD_MAX_LIMIT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			fatal("LEADERBOARD_MAX_LIMIT の形式が不正です", "value", v, "error", err)
+		}
+		apiCfg.LeaderboardMaxLimit = n
+	}
 
-	log.Printf("Player %s registered for matchmaking", player.ID)
+	if v := os.Getenv("IDEMPOTENCY_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			fatal("IDEMPOTENCY_TTL の形式が不正です", "value", v, "error", err)
+		}
+		apiCfg.IdempotencyTTL = d
+	}
 
-	// 30秒間、マッチング結果の通知を待つ
-	select {
-	case session := <-matchChan:
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(session); err != nil {
-			log.Printf("matchmakingHandler: レスポンスエンコードエラー: %v", err)
+	if v := os.Getenv("MAX_QUEUE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fatal("MAX_QUEUE_SIZE の形式が不正です", "value", v, "error", err)
 		}
-	case <-time.After(30 * time.Second):
-		// タイムアウト時、in-memory からチャネルを削除し、DBからも待機プレイヤーを削除
-		waitingChansMutex.Lock()
-		delete(waitingChans, player.ID)
-		waitingChansMutex.Unlock()
+		storeCfg.MaxQueueSize = n
+		apiCfg.MaxQueueSize = n
+	}
+	metrics.QueueCapacity.Set(float64(storeCfg.MaxQueueSize))
 
-		if err := deleteWaitingPlayer(player.ID); err != nil {
-			log.Printf("matchmakingHandler: タイムアウト時のDB削除エラー: %v", err)
+	if v := os.Getenv("MAX_CONCURRENT_ENQUEUES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fatal("MAX_CONCURRENT_ENQUEUES の形式が不正です", "value", v, "error", err)
 		}
-		http.Error(w, "No opponent found within timeout", http.StatusGatewayTimeout)
+		apiCfg.MaxConcurrentEnqueues = n
 	}
-}
 
-// corsMiddleware はCORSのためのヘッダーを追加するミドルウェアです。
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// 必要なヘッダーを設定
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if v := os.Getenv("NOTIFY_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			fatal("NOTIFY_CONCURRENCY の形式が不正です", "value", v, "error", err)
+		}
+		apiCfg.NotifyConcurrency = n
+	}
+	if v := os.Getenv("MAX_BLOCKS_PER_PLAYER"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			fatal("MAX_BLOCKS_PER_PLAYER の形式が不正です", "value", v, "error", err)
+		}
+		apiCfg.MaxBlocksPerPlayer = n
+	}
+	if v := os.Getenv("MAX_SPECTATORS_PER_SESSION"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fatal("MAX_SPECTATORS_PER_SESSION の形式が不正です", "value", v, "error", err)
+		}
+		apiCfg.MaxSpectatorsPerSession = n
+	}
+	if v := os.Getenv("MATCH_ATTRIBUTE_KEYS"); v != "" {
+		keys, err := queue.ParseMatchAttributeKeys(v)
+		if err != nil {
+			fatal("MATCH_ATTRIBUTE_KEYS の形式が不正です", "value", v, "error", err)
+		}
+		apiCfg.Queue.MatchAttributeKeys = keys
+	}
+	if v := os.Getenv("WAIT_STATS_RATING_BANDS"); v != "" {
+		bands, err := api.ParseRatingBands(v)
+		if err != nil {
+			fatal("WAIT_STATS_RATING_BANDS の形式が不正です", "value", v, "error", err)
+		}
+		apiCfg.WaitStatsRatingBands = bands
+	}
+
+	if v := os.Getenv("SKILL_SEED_RATINGS"); v != "" {
+		seeds, err := queue.ParseSkillSeedRatings(v)
+		if err != nil {
+			fatal("SKILL_SEED_RATINGS の形式が不正です", "value", v, "error", err)
+		}
+		apiCfg.RatingSeeds.Skills = seeds
+	}
+	storeCfg.RatingSeeds = apiCfg.RatingSeeds
+
+	if v := os.Getenv("PLACEMENT_MATCHES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fatal("PLACEMENT_MATCHES の形式が不正です", "value", v, "error", err)
+		}
+		apiCfg.Queue.PlacementMatches = n
+	}
+
+	if v := os.Getenv("MATCH_BATCH_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fatal("MATCH_BATCH_SIZE の形式が不正です", "value", v, "error", err)
+		}
+		storeCfg.MatchBatchSize = n
+	}
+
+	if v := os.Getenv("DB_MAX_OPEN_CONNS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			fatal("DB_MAX_OPEN_CONNS の形式が不正です", "value", v, "error", err)
+		}
+		storeCfg.MaxOpenConns = n
+	}
+
+	if v := os.Getenv("DB_MAX_IDLE_CONNS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fatal("DB_MAX_IDLE_CONNS の形式が不正です", "value", v, "error", err)
+		}
+		storeCfg.MaxIdleConns = n
+	}
+
+	if v := os.Getenv("DB_CONN_MAX_LIFETIME"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			fatal("DB_CONN_MAX_LIFETIME の形式が不正です", "value", v, "error", err)
+		}
+		storeCfg.ConnMaxLifetime = d
+	}
+
+	if v := os.Getenv("EXPLAIN_CAPTURE_PER_HOUR"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fatal("EXPLAIN_CAPTURE_PER_HOUR の形式が不正です", "value", v, "error", err)
+		}
+		storeCfg.ExplainCaptureBudget = ratelimit.Config{RPS: float64(n) / 3600, Burst: n}
+	}
+
+	// 機能フラグ（既定値 < 環境変数 FEATURE_FLAGS < 管理用エンドポイントでの変更）
+	flags := api.NewFeatureFlags()
+	if v := os.Getenv("FEATURE_FLAGS"); v != "" {
+		if err := flags.ApplyConfig(v); err != nil {
+			fatal("FEATURE_FLAGS の設定が不正です", "value", v, "error", err)
+		}
+	}
+	apiCfg.Flags = flags
+	storeCfg.ExplainCapture = flags.ExplainCaptureEnabled
+	// 保存時にセッションIDが変わった場合は、同じ鍵と有効期間でマッチトークンを発行し直す
+	storeCfg.ReissueMatchToken = apiCfg.MintMatchToken
+
+	// マッチングのアルゴリズム（未知の名前・オプションの場合は起動しない）
+	strategy := os.Getenv("MATCH_STRATEGY")
+	if strategy == "" {
+		strategy = queue.MatchStrategyRatingWindow
+	}
+	matcher, err := queue.NewMatcher(strategy, os.Getenv("MATCH_STRATEGY_OPTIONS"))
+	if err != nil {
+		fatal("MATCH_STRATEGY の設定が不正です", "strategy", strategy, "options", os.Getenv("MATCH_STRATEGY_OPTIONS"), "error", err)
+	}
+
+	storeKind := flag.String("store", "mysql", "状態の保存先（mysql / redis / memory）。redis は待機キューを Redis に置いて複数インスタンスで共有する（REDIS_ADDR が必要）。memory は MySQL なしでのローカル開発・テスト向けで、再起動すると状態は失われる")
+	selftestMode := flag.Bool("selftest", false, "合成プレイヤーでマッチングの一連の流れを確認し、結果を JSON で出力して終了する（失敗時は終了コード 1）")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// サブコマンドの実行（サーバは起動しない）
+	if flag.NArg() > 0 && flag.Arg(0) == "simulate" {
+		// 待機キューと時計はシミュレーションの中のものを使うため、保存先には接続しない
+		if err := api.RunSimulateCommand(flag.Args()[1:], os.Stdout, apiCfg); err != nil {
+			fatal("シミュレーション失敗", "error", err)
+		}
+		return
+	}
+	if flag.NArg() > 0 && flag.Arg(0) == "backfill" {
+		var st store.Store
+		lc := lifecycle.New()
+		lc.Add(storeComponent(*storeKind, os.Getenv("REDIS_ADDR"), storeCfg, &st))
+		if err := lc.Start(ctx); err != nil {
+			fatal("起動失敗", "error", err)
+		}
+		err := api.RunBackfillCommand(st, flag.Args()[1:])
+		lc.Stop()
+		if err != nil {
+			fatal("バックフィル失敗", "error", err)
+		}
+		return
+	}
+
+	// デプロイの判定用のセルフテスト（サーバは起動しない）
+	if *selftestMode {
+		var st store.Store
+		lc := lifecycle.New()
+		lc.Add(storeComponent(*storeKind, os.Getenv("REDIS_ADDR"), storeCfg, &st))
+		if err := lc.Start(ctx); err != nil {
+			fatal("起動失敗", "error", err)
+		}
+		testCtx, cancel := context.WithTimeout(ctx, api.SelftestTimeout)
+		report := api.NewServer(st, matcher, slog.Default(), apiCfg).RunSelftest(testCtx, *storeKind)
+		cancel()
+		lc.Stop()
+		json.NewEncoder(os.Stdout).Encode(report)
+		if !report.OK {
+			os.Exit(1)
+		}
+		return
+	}
 
-		// preflightリクエストの場合はここで終了
-		if r.Method == "OPTIONS" {
-			return
+	// TLS（TLS_CERT_FILE と TLS_KEY_FILE の両方が指定された場合のみ HTTPS で待ち受ける）
+	var serverTLS *tls.Config
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	switch {
+	case certFile != "" && keyFile != "":
+		cfg, err := api.NewServerTLSConfig(certFile, keyFile, os.Getenv("TLS_MIN_VERSION"))
+		if err != nil {
+			fatal("TLS の設定が不正です", "cert_file", certFile, "key_file", keyFile, "error", err)
 		}
+		serverTLS = cfg
+	case certFile != "" || keyFile != "":
+		fatal("TLS_CERT_FILE と TLS_KEY_FILE は両方指定してください")
+	}
 
-		next.ServeHTTP(w, r)
+	// 停止は登録と逆の依存順で行われる。リクエストの受付を先に止め、保存先は最後に閉じる。
+	slog.Info("matching strategy selected", "strategy", strategy)
+	metrics.RegisterMetrics(prometheus.DefaultRegisterer)
+	lc := lifecycle.New()
+	// トレースは全てのコンポーネントの停止後に送り切るよう、保存先より先に開始する
+	lc.Add(tracingComponent())
+	var st store.Store
+	sc := storeComponent(*storeKind, os.Getenv("REDIS_ADDR"), storeCfg, &st)
+	sc.DependsOn = append(sc.DependsOn, "tracing")
+	lc.Add(sc)
+	// Server は開いた保存先を使って組み立てるため、保存先までを先に開始する
+	if err := lc.Start(ctx); err != nil {
+		fatal("起動失敗", "error", err)
+	}
+	srv := api.NewServer(st, matcher, slog.Default(), apiCfg)
+	srv.Allocator = allocator
+	lc.Add(srv.NotifierComponent(os.Getenv("REDIS_ADDR")))
+	lc.Add(lifecycle.Component{
+		Name:      "flags",
+		DependsOn: []string{"store"},
+		Start: func(ctx context.Context) error {
+			return flags.Load(ctx, st)
+		},
 	})
-}
+	lc.Add(lifecycle.WorkerComponent("flag-refresher", []string{"flags"}, func(ctx context.Context) {
+		srv.RefreshFeatureFlags(ctx, st)
+	}))
+	lc.Add(lifecycle.Component{
+		Name:        "ready-check-expiries",
+		DependsOn:   []string{"store", "notifier"},
+		Start:       srv.ResumeReadyCheckExpiries,
+		Stop:        srv.Expiries.Stop,
+		StopTimeout: 10 * time.Second,
+	})
+	lc.Add(lifecycle.WorkerComponent("expiry-sweeper", []string{"store"}, srv.ExpirySweeper))
+	lc.Add(lifecycle.WorkerComponent("session-janitor", []string{"store"}, srv.SessionJanitor))
+	lc.Add(lifecycle.WorkerComponent("mode-schedule", []string{"store", "notifier"}, srv.ModeScheduleCloser))
+	if apiCfg.RatingDecayInactiveDays > 0 {
+		lc.Add(lifecycle.WorkerComponent("rating-decay", []string{"store"}, srv.RatingDecayer))
+	}
+	lc.Add(lifecycle.WorkerComponent("notification-outbox", []string{"store", "notifier"}, srv.NotificationOutbox))
+	if v := os.Getenv("WEBHOOK_URL"); v != "" {
+		// 署名の鍵はカンマ区切りで複数指定できる（先頭の鍵で署名する。受信側の鍵の入れ替え用）
+		keys, err := secret.NewKeyRing(model.SplitCommaList(os.Getenv("WEBHOOK_SECRET"))...)
+		if err != nil {
+			fatal("WEBHOOK_URL を指定する場合は WEBHOOK_SECRET が必要です", "error", err)
+		}
+		events, err := api.ParseWebhookEvents(os.Getenv("WEBHOOK_EVENTS"))
+		if err != nil {
+			fatal("WEBHOOK_EVENTS の設定が不正です", "value", os.Getenv("WEBHOOK_EVENTS"), "error", err)
+		}
+		srv.Webhook = api.NewWebhookSender(model.SplitCommaList(v), keys, events)
+		if v := os.Getenv("WEBHOOK_WORKERS"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				fatal("WEBHOOK_WORKERS の形式が不正です", "value", v, "error", err)
+			}
+			srv.Webhook.Workers = n
+		}
+		if v := os.Getenv("WEBHOOK_DEAD_LETTER"); v != "" {
+			f, err := os.OpenFile(v, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+			if err != nil {
+				fatal("WEBHOOK_DEAD_LETTER のファイルを開けません", "path", v, "error", err)
+			}
+			defer f.Close()
+			srv.Webhook.DeadLetter = f
+		}
+		lc.Add(lifecycle.WorkerComponent("webhook", nil, srv.Webhook.Run))
+	}
+	if v := os.Getenv("EVENT_LOG"); v != "" {
+		w := io.Writer(os.Stdout)
+		if v != "-" {
+			f, err := os.OpenFile(v, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+			if err != nil {
+				fatal("EVENT_LOG のファイルを開けません", "path", v, "error", err)
+			}
+			defer f.Close()
+			w = f
+		}
+		srv.Events = api.NewEventLogger(w)
+		lc.Add(lifecycle.WorkerComponent("event-log", nil, srv.Events.Run))
+	}
+	processor := lifecycle.WorkerComponent("matchmaking-processor", []string{"store", "notifier", "flags", "ready-check-expiries"}, srv.MatchmakingProcessor)
+	processor.StopTimeout = 10 * time.Second
+	if srv.Webhook != nil {
+		// 停止時は送信待ちを増やさないよう、マッチングプロセッサーを先に止める
+		processor.DependsOn = append(processor.DependsOn, "webhook")
+	}
+	if srv.Events != nil {
+		processor.DependsOn = append(processor.DependsOn, "event-log")
+	}
+	lc.Add(processor)
+	httpDeps := []string{"store", "notifier", "flags", "ready-check-expiries", "matchmaking-processor"}
+	switch adminAddr {
+	case "":
+		lc.Add(httpServerComponent(srv, "http", ":8080", srv, serverTLS, httpDeps))
+	case "off":
+		slog.Info("admin endpoints are disabled")
+		lc.Add(httpServerComponent(srv, "http", ":8080", srv, serverTLS, httpDeps))
+	default:
+		lc.Add(httpServerComponent(srv, "http", ":8080", srv, serverTLS, httpDeps))
+		lc.Add(httpServerComponent(srv, "admin-http", adminAddr, srv.AdminHandler(), serverTLS, httpDeps))
+	}
+	if grpcAddr == "off" {
+		slog.Info("gRPC server is disabled")
+	} else {
+		lc.Add(grpcServerComponent(srv, grpcAddr, serverTLS, httpDeps))
+	}
 
-func main() {
-	// DB初期化
-	if err := initDB(); err != nil {
-		log.Fatalf("DB初期化失敗: %v", err)
+	if err := lc.Start(ctx); err != nil {
+		fatal("起動失敗", "error", err)
 	}
-	defer db.Close()
+	slog.Info("matchmaking service running", "addr", ":8080", "admin_addr", adminAddr, "grpc_addr", grpcAddr, "tls", serverTLS != nil)
 
-	// スキーマの初期化（外部ファイルから）
-	if err := initSchemaFromFile("schema.sql"); err != nil {
-		log.Fatalf("スキーマ初期化失敗: %v", err)
+	<-ctx.Done()
+	slog.Info("shutting down")
+	lc.Stop()
+}
+
+// storeComponent は状態の保存先を開くコンポーネントを返します。開いた Store は dst に設定します。
+// kind が mysql の場合は MySQL に接続してスキーマを初期化し、memory の場合はプロセス内に保存します。
+// redis の場合は MySQL に加えて redisAddr の Redis に接続し、待機キューを Redis に保存します。
+func storeComponent(kind, redisAddr string, cfg store.Config, dst *store.Store) lifecycle.Component {
+	return lifecycle.Component{
+		Name: "store",
+		Start: func(context.Context) error {
+			switch kind {
+			case "mysql":
+				// スキーマの初期化（バイナリに埋め込んだマイグレーションを適用）
+				st, err := store.NewMySQLStore(cfg)
+				if err != nil {
+					return err
+				}
+				metrics.MetricsDB.Store(st.DB)
+				*dst = st
+			case "redis":
+				db, err := store.NewMySQLStore(cfg)
+				if err != nil {
+					return err
+				}
+				st, err := store.NewRedisStore(db, redisAddr)
+				if err != nil {
+					db.Close()
+					return err
+				}
+				metrics.MetricsDB.Store(db.DB)
+				*dst = st
+			case "memory":
+				slog.Warn("using in-memory store; state is lost on restart")
+				*dst = store.NewMemoryStore(cfg)
+			default:
+				return fmt.Errorf("unknown store %q (valid: mysql, redis, memory)", kind)
+			}
+			return nil
+		},
+		Stop: func(context.Context) error {
+			return (*dst).Close()
+		},
 	}
+}
 
-	// マッチングプロセッサーを別ゴルーチンで起動
-	go matchmakingProcessor()
+// httpServerComponent は addr で待ち受ける HTTP サーバのコンポーネントを name で返します。
+// タイムアウトなどのサーバの設定は srv の設定を使います。tlsConfig が nil でなければ HTTPS で待ち受けます。
+// 停止時は新しい接続の受付を止め、処理中のリクエスト（ロングポーリングを含む）の完了を待ちます。
+func httpServerComponent(srv *api.Server, name, addr string, handler http.Handler, tlsConfig *tls.Config, dependsOn []string) lifecycle.Component {
+	// 停止時にリクエストの context をキャンセルし、SSE のように接続が続く限り待機するハンドラを終了させる
+	base, cancelBase := context.WithCancelCause(context.Background())
+	hs := srv.NewHTTPServer(addr, handler, tlsConfig, base)
+	return lifecycle.Component{
+		Name:      name,
+		DependsOn: dependsOn,
+		Start: func(context.Context) error {
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				return err
+			}
+			mode := "http"
+			if tlsConfig != nil {
+				mode = "https"
+			}
+			slog.Info("listening", "server", name, "addr", addr, "mode", mode,
+				"read_header_timeout", hs.ReadHeaderTimeout.String(), "write_timeout", hs.WriteTimeout.String(), "idle_timeout", hs.IdleTimeout.String())
+			go func() {
+				serve := hs.Serve
+				if tlsConfig != nil {
+					// 証明書は TLSConfig.GetCertificate で読み込む
+					serve = func(ln net.Listener) error { return hs.ServeTLS(ln, "", "") }
+				}
+				if err := serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					fatal("server failed", "error", err)
+				}
+			}()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			cancelBase(api.ErrServerShutdown)
+			if err := hs.Shutdown(ctx); err != nil {
+				// 期限までに終わらなかったリクエストは接続ごと切断する
+				hs.Close()
+				return err
+			}
+			return nil
+		},
+		// ロングポーリングの待機時間（30秒）より長く待つ
+		StopTimeout: 35 * time.Second,
+	}
+}
 
-	// ハンドラにCORSミドルウェアを適用
-	http.Handle("/matchmaking", corsMiddleware(http.HandlerFunc(matchmakingHandler)))
-	
-	log.Println("Matchmaking service running on :8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatalf("Server failed: %v", err)
+// grpcServerComponent は addr で待ち受ける gRPC サーバ（Matchmaking サービス）のコンポーネントを返します。tlsConfig が nil でなければ TLS で待ち受けます。
+// 停止時は HTTP サーバと同じく待機中のストリームを ErrServerShutdown でキャンセルし（待機キューから削除する）、処理中の RPC の完了を待ちます。
+func grpcServerComponent(srv *api.Server, addr string, tlsConfig *tls.Config, dependsOn []string) lifecycle.Component {
+	base, cancelBase := context.WithCancelCause(context.Background())
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	gs := srv.GRPCServer(base, opts...)
+	return lifecycle.Component{
+		Name:      "grpc",
+		DependsOn: dependsOn,
+		Start: func(context.Context) error {
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				return err
+			}
+			slog.Info("listening", "server", "grpc", "addr", addr, "tls", tlsConfig != nil)
+			go func() {
+				if err := gs.Serve(ln); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+					fatal("gRPC server failed", "error", err)
+				}
+			}()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			cancelBase(api.ErrServerShutdown)
+			stopped := make(chan struct{})
+			go func() {
+				gs.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+				return nil
+			case <-ctx.Done():
+				// 期限までに終わらなかった RPC は接続ごと切断する
+				gs.Stop()
+				return ctx.Err()
+			}
+		},
+		StopTimeout: 35 * time.Second,
 	}
 }
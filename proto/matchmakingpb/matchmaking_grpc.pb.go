@@ -0,0 +1,253 @@
+// マッチングサービスの gRPC インターフェースの定義です。
+// HTTP API（POST /matchmaking・GET /matchmaking/stream・GET /sessions/...）と同じ待機キューとマッチングプロセッサーを使います（GRPC_ADDR で待ち受けます）。
+// Enqueue のストリームをクライアントがキャンセルした場合は、HTTP の切断と同じく待機キューから削除します。
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: matchmaking.proto
+
+package matchmakingpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Matchmaking_Enqueue_FullMethodName      = "/matchmaking.v1.Matchmaking/Enqueue"
+	Matchmaking_Cancel_FullMethodName       = "/matchmaking.v1.Matchmaking/Cancel"
+	Matchmaking_GetSession_FullMethodName   = "/matchmaking.v1.Matchmaking/GetSession"
+	Matchmaking_ReportResult_FullMethodName = "/matchmaking.v1.Matchmaking/ReportResult"
+)
+
+// MatchmakingClient is the client API for Matchmaking service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MatchmakingClient interface {
+	// Enqueue は待機キューへ登録し、マッチングの進行をイベントで返します。
+	// マッチングが成立すると match を送り、ストリームを終了します。
+	Enqueue(ctx context.Context, in *EnqueueRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[MatchEvent], error)
+	// Cancel は待機をやめて待機キューから削除します（パーティの場合はパーティ全体）。
+	Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*CancelResponse, error)
+	// GetSession はセッションと参加者を返します。
+	GetSession(ctx context.Context, in *GetSessionRequest, opts ...grpc.CallOption) (*Session, error)
+	// ReportResult は確定したセッションの対戦結果を記録します。
+	ReportResult(ctx context.Context, in *ReportResultRequest, opts ...grpc.CallOption) (*ReportResultResponse, error)
+}
+
+type matchmakingClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMatchmakingClient(cc grpc.ClientConnInterface) MatchmakingClient {
+	return &matchmakingClient{cc}
+}
+
+func (c *matchmakingClient) Enqueue(ctx context.Context, in *EnqueueRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[MatchEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Matchmaking_ServiceDesc.Streams[0], Matchmaking_Enqueue_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EnqueueRequest, MatchEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Matchmaking_EnqueueClient = grpc.ServerStreamingClient[MatchEvent]
+
+func (c *matchmakingClient) Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*CancelResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CancelResponse)
+	err := c.cc.Invoke(ctx, Matchmaking_Cancel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *matchmakingClient) GetSession(ctx context.Context, in *GetSessionRequest, opts ...grpc.CallOption) (*Session, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Session)
+	err := c.cc.Invoke(ctx, Matchmaking_GetSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *matchmakingClient) ReportResult(ctx context.Context, in *ReportResultRequest, opts ...grpc.CallOption) (*ReportResultResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReportResultResponse)
+	err := c.cc.Invoke(ctx, Matchmaking_ReportResult_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MatchmakingServer is the server API for Matchmaking service.
+// All implementations must embed UnimplementedMatchmakingServer
+// for forward compatibility.
+type MatchmakingServer interface {
+	// Enqueue は待機キューへ登録し、マッチングの進行をイベントで返します。
+	// マッチングが成立すると match を送り、ストリームを終了します。
+	Enqueue(*EnqueueRequest, grpc.ServerStreamingServer[MatchEvent]) error
+	// Cancel は待機をやめて待機キューから削除します（パーティの場合はパーティ全体）。
+	Cancel(context.Context, *CancelRequest) (*CancelResponse, error)
+	// GetSession はセッションと参加者を返します。
+	GetSession(context.Context, *GetSessionRequest) (*Session, error)
+	// ReportResult は確定したセッションの対戦結果を記録します。
+	ReportResult(context.Context, *ReportResultRequest) (*ReportResultResponse, error)
+	mustEmbedUnimplementedMatchmakingServer()
+}
+
+// UnimplementedMatchmakingServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMatchmakingServer struct{}
+
+func (UnimplementedMatchmakingServer) Enqueue(*EnqueueRequest, grpc.ServerStreamingServer[MatchEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Enqueue not implemented")
+}
+func (UnimplementedMatchmakingServer) Cancel(context.Context, *CancelRequest) (*CancelResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Cancel not implemented")
+}
+func (UnimplementedMatchmakingServer) GetSession(context.Context, *GetSessionRequest) (*Session, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSession not implemented")
+}
+func (UnimplementedMatchmakingServer) ReportResult(context.Context, *ReportResultRequest) (*ReportResultResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReportResult not implemented")
+}
+func (UnimplementedMatchmakingServer) mustEmbedUnimplementedMatchmakingServer() {}
+func (UnimplementedMatchmakingServer) testEmbeddedByValue()                     {}
+
+// UnsafeMatchmakingServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MatchmakingServer will
+// result in compilation errors.
+type UnsafeMatchmakingServer interface {
+	mustEmbedUnimplementedMatchmakingServer()
+}
+
+func RegisterMatchmakingServer(s grpc.ServiceRegistrar, srv MatchmakingServer) {
+	// If the following call pancis, it indicates UnimplementedMatchmakingServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Matchmaking_ServiceDesc, srv)
+}
+
+func _Matchmaking_Enqueue_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EnqueueRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MatchmakingServer).Enqueue(m, &grpc.GenericServerStream[EnqueueRequest, MatchEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Matchmaking_EnqueueServer = grpc.ServerStreamingServer[MatchEvent]
+
+func _Matchmaking_Cancel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MatchmakingServer).Cancel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Matchmaking_Cancel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MatchmakingServer).Cancel(ctx, req.(*CancelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Matchmaking_GetSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MatchmakingServer).GetSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Matchmaking_GetSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MatchmakingServer).GetSession(ctx, req.(*GetSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Matchmaking_ReportResult_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReportResultRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MatchmakingServer).ReportResult(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Matchmaking_ReportResult_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MatchmakingServer).ReportResult(ctx, req.(*ReportResultRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Matchmaking_ServiceDesc is the grpc.ServiceDesc for Matchmaking service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Matchmaking_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "matchmaking.v1.Matchmaking",
+	HandlerType: (*MatchmakingServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Cancel",
+			Handler:    _Matchmaking_Cancel_Handler,
+		},
+		{
+			MethodName: "GetSession",
+			Handler:    _Matchmaking_GetSession_Handler,
+		},
+		{
+			MethodName: "ReportResult",
+			Handler:    _Matchmaking_ReportResult_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Enqueue",
+			Handler:       _Matchmaking_Enqueue_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "matchmaking.proto",
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"matchmaking_project/internal/lifecycle"
+	"matchmaking_project/internal/tracing"
+)
+
+// tracingComponent は OTLP（HTTP）でトレースを送信するコンポーネントを返します。
+// 送信先は OpenTelemetry の標準の環境変数（OTEL_EXPORTER_OTLP_ENDPOINT・OTEL_EXPORTER_OTLP_TRACES_ENDPOINT・OTEL_EXPORTER_OTLP_HEADERS など）で設定し、
+// 送信先を指定しない場合はトレースを記録しません。停止時は送信待ちのスパンを送り切ります。
+func tracingComponent() lifecycle.Component {
+	var provider *sdktrace.TracerProvider
+	return lifecycle.Component{
+		Name: "tracing",
+		Start: func(ctx context.Context) error {
+			if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+				return nil
+			}
+			exporter, err := otlptracehttp.New(ctx)
+			if err != nil {
+				return fmt.Errorf("OTLP エクスポーター作成エラー: %v", err)
+			}
+			res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+				attribute.String("service.name", tracing.TracerName),
+				attribute.String("service.version", version),
+			))
+			if err != nil {
+				return fmt.Errorf("トレースのリソース作成エラー: %v", err)
+			}
+			provider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+			otel.SetTracerProvider(provider)
+			otel.SetTextMapPropagator(tracing.TracePropagator)
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			if provider == nil {
+				return nil
+			}
+			return provider.Shutdown(ctx)
+		},
+		StopTimeout: 10 * time.Second,
+	}
+}